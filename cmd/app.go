@@ -0,0 +1,204 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/jecoz/voicebr"
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/prefs"
+	"github.com/spf13/cobra"
+)
+
+var (
+	appName   string
+	appRename string
+	appKeyOut string
+)
+
+// appCmd groups the commands managing the Vonage application
+var appCmd = &cobra.Command{
+	Use:   "app",
+	Short: "Manage the Vonage application through the Applications API",
+	Long: `Manage the Vonage application through the Applications API.
+
+The API is authenticated with the credentials of the account, vonage.api_key
+and vonage.api_secret, rather than with the key of the application.`,
+}
+
+var appShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the application, or every application of the account without vonage.app_id",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		p := appPrefs(cmd)
+		ctx := context.Background()
+		if p.Vonage.AppID == "" {
+			apps, err := accountClient(p).Applications(ctx)
+			if err != nil {
+				log.Fatal(err)
+			}
+			printJSON(apps)
+			return
+		}
+		app, err := appClient(p).Application(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printJSON(app)
+	},
+}
+
+var appCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create an application with its voice webhooks pointed to --origin",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		p := appPrefs(cmd)
+		if p.Server.Origin == "" {
+			log.Fatal("server.origin is required, see --origin")
+		}
+		if appKeyOut == "" {
+			log.Fatal("--key-out is required: the private key is returned only once")
+		}
+		a := nexmo.Application{Name: appName}
+		a.SetVoiceWebhooks(p.Server.Origin)
+		app, err := accountClient(p).CreateApplication(context.Background(), a)
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeKey(appKeyOut, []byte(app.Keys.PrivateKey))
+		log.Printf("application %s created, set vonage.app_id to it and vonage.private_key to %s", app.ID, appKeyOut)
+		fmt.Println(app.ID)
+	},
+}
+
+var appUpdateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Point the voice webhooks of the application to --origin",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		p := appPrefs(cmd)
+		if p.Server.Origin == "" {
+			log.Fatal("server.origin is required, see --origin")
+		}
+		c := appClient(p)
+		ctx := context.Background()
+		app, err := c.Application(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		app.SetVoiceWebhooks(p.Server.Origin)
+		if appRename != "" {
+			app.Name = appRename
+		}
+		if app, err = c.UpdateApplication(ctx, app); err != nil {
+			log.Fatal(err)
+		}
+		printJSON(app)
+	},
+}
+
+var appRotateKeyCmd = &cobra.Command{
+	Use:   "rotate-key",
+	Short: "Replace the key pair of the application, writing the new private key to --key-out",
+	Long: `Replace the key pair of the application, writing the new private key to --key-out.
+
+The servers signing their requests with the old key are refused as soon as
+the rotation is done: point vonage.private_key to the new key and restart them.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		p := appPrefs(cmd)
+		if appKeyOut == "" {
+			log.Fatal("--key-out is required")
+		}
+		key, err := appClient(p).RotateAppKey(context.Background())
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeKey(appKeyOut, key)
+		log.Printf("key rotated, the new private key is at %s", appKeyOut)
+	},
+}
+
+// appPrefs returns the preferences of the app commands, which
+// require the credentials of the account.
+func appPrefs(cmd *cobra.Command) *prefs.MasterPrefs {
+	log.SetFlags(0)
+	p, err := loadPrefs(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if p.Vonage.APIKey == "" || p.Vonage.APISecret == "" {
+		log.Fatal(nexmo.ErrNoAccount)
+	}
+	return p
+}
+
+// accountClient returns a client of the account APIs only.
+func accountClient(p *prefs.MasterPrefs) *nexmo.Client {
+	c := nexmo.NewAccountClient(p.Vonage.APIKey, p.Vonage.APISecret)
+	if p.Vonage.BaseURL != "" {
+		c.BaseURL = p.Vonage.BaseURL
+	}
+	return c
+}
+
+// appClient returns the client of the configured application.
+func appClient(p *prefs.MasterPrefs) *nexmo.Client {
+	c, err := voicebr.NewClient(p, log.Default())
+	if err != nil {
+		log.Fatal(err)
+	}
+	return c
+}
+
+// writeKey writes the private key `key` to `path`, readable
+// by the owner only.
+func writeKey(path string, key []byte) {
+	if err := ioutil.WriteFile(path, key, 0600); err != nil {
+		log.Fatalf("unable to write private key: %v", err)
+	}
+}
+
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(appCmd)
+	for _, c := range []*cobra.Command{appShowCmd, appCreateCmd, appUpdateCmd, appRotateKeyCmd} {
+		appCmd.AddCommand(c)
+		addPrefsFlags(c)
+		addClientFlags(c)
+	}
+	appCreateCmd.Flags().StringVar(&appName, "name", "voicebr", "Name of the application")
+	appUpdateCmd.Flags().StringVar(&appRename, "name", "", "New name of the application, unchanged if empty")
+	for _, c := range []*cobra.Command{appCreateCmd, appRotateKeyCmd} {
+		c.Flags().StringVar(&appKeyOut, "key-out", "", "Path the private key of the application is written to")
+	}
+}
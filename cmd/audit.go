@@ -0,0 +1,96 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditFile      string
+	auditBroadcast int64
+)
+
+// auditCmd groups the commands dealing with the audit log
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Inspect the audit log",
+}
+
+// verifyCmd checks the hash chain of the audit log
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify that the audit log has not been altered",
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetFlags(0)
+		entries, err := storage.ReadAuditFile(auditFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = nexmo.VerifyAudit(entries); err != nil {
+			log.Fatalf("%s has been tampered with: %v", auditFile, err)
+		}
+		if len(entries) == 0 {
+			log.Printf("%s is empty", auditFile)
+			return
+		}
+		last := entries[len(entries)-1]
+		log.Printf("%s is intact: %d entries, last one at %v, hash %s", auditFile, len(entries), last.Time, last.Hash)
+	},
+}
+
+// auditShowCmd prints the entries of a broadcast, once the
+// audit log is verified
+var auditShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the audit entries of a broadcast: who started it, who was called and with which outcome",
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetFlags(0)
+		entries, err := storage.ReadAuditFile(auditFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = nexmo.VerifyAudit(entries); err != nil {
+			log.Fatalf("%s has been tampered with: %v", auditFile, err)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		for _, v := range nexmo.BroadcastAudit(entries, auditBroadcast) {
+			if err := enc.Encode(v); err != nil {
+				log.Fatal(err)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+	auditCmd.AddCommand(verifyCmd)
+	auditCmd.AddCommand(auditShowCmd)
+
+	for _, v := range []*cobra.Command{verifyCmd, auditShowCmd} {
+		v.Flags().StringVar(&auditFile, "file", "", "Path to the audit log")
+		v.MarkFlagRequired("file")
+	}
+	auditShowCmd.Flags().Int64Var(&auditBroadcast, "broadcast", 0, "Identifier of the broadcast")
+	auditShowCmd.MarkFlagRequired("broadcast")
+}
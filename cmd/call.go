@@ -0,0 +1,160 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jecoz/voicebr"
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/spf13/cobra"
+)
+
+// groupAll selects the whole broadcast list.
+const groupAll = "all"
+
+var (
+	callRec   string
+	callGroup string
+	callFrom  string
+	callPrio  string
+)
+
+// callCmd triggers a broadcast from the command line
+var callCmd = &cobra.Command{
+	Use:   "call",
+	Short: "Broadcast a recording and wait for every call to be placed",
+	Long: `Broadcast a recording to the broadcast list, or to one of its groups.
+
+The calls are answered by the voicebr server reachable at --origin, which
+must share this storage and webhooks signing key. If the recording is not
+stored yet but is a local file, it is uploaded first.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetFlags(0)
+		p, err := loadPrefs(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = voicebr.ValidatePrefs(p); err != nil {
+			log.Fatal(err)
+		}
+		if p.Webhooks.SigningKey == "" {
+			log.Fatal("webhooks.signing_key is required, or the server would refuse the calls")
+		}
+		client, err := voicebr.NewClient(p, log.Default())
+		if err != nil {
+			log.Fatal(err)
+		}
+		s, err := voicebr.NewStorage(p.Storage, log.Default())
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ctx := context.Background()
+		name, err := ensureRec(ctx, s, callRec)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var contacts []nexmo.Contact
+		if callGroup == groupAll {
+			contacts, err = nexmo.DecodeContacts(s.ReadBroadcastList, nil)
+			if err != nil && err != nexmo.ErrCorruptedContacts {
+				log.Fatal(err)
+			}
+			if err != nil {
+				log.Printf("warning: %v", err)
+			}
+		} else {
+			g, ok := s.(nexmo.GroupStore)
+			if !ok {
+				log.Fatal("the configured storage does not support groups")
+			}
+			if contacts, err = g.GroupMembers(ctx, callGroup); err != nil {
+				log.Fatal(err)
+			}
+		}
+		report, err := client.CallBroadcast(ctx, s, nexmo.Broadcast{RecName: name, From: callFrom, Priority: callPrio, RequestedBy: "cli"}, contacts)
+		if err != nil {
+			log.Fatalf("unable to broadcast %s: %v", name, err)
+		}
+
+		for _, v := range report.Results {
+			status := "ok"
+			if v.Err != nil {
+				status = v.Err.Error()
+			}
+			fmt.Printf("%s\t%d\t%s\n", v.Contact.Number, v.Attempts, status)
+		}
+		log.Printf("broadcast %d of %s done, succeeded: %d, failed: %d", report.Broadcast.ID, name, report.Succeeded, report.Failed)
+		if report.Failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// ensureRec returns the name of the recording `rec`, uploading
+// it to `s` if it is a local file that is not stored yet.
+func ensureRec(ctx context.Context, s nexmo.RecStore, rec string) (string, error) {
+	name := filepath.Base(rec)
+	r, _, err := s.OpenRec(ctx, name)
+	if err == nil {
+		r.Close()
+		return name, nil
+	}
+	if err != nexmo.ErrRecNotFound {
+		return "", err
+	}
+
+	file, err := os.Open(rec)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("recording %s not found, neither in storage nor locally", rec)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	log.Printf("uploading %s", rec)
+	meta, err := s.WriteRec(ctx, file, name, nexmo.RecMeta{
+		Name:        name,
+		ContentType: nexmo.ContentType(name),
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		return "", err
+	}
+	log.Printf("stored %s (%d bytes)", meta.Name, meta.Size)
+	return name, nil
+}
+
+func init() {
+	rootCmd.AddCommand(callCmd)
+
+	addPrefsFlags(callCmd)
+	addClientFlags(callCmd)
+	callCmd.Flags().StringVar(&callRec, "rec", "", "Name of the stored recording, or path of a local file to upload")
+	callCmd.Flags().StringVar(&callGroup, "group", groupAll, "Group of the broadcast list to call, \""+groupAll+"\" for the whole list")
+	callCmd.Flags().StringVar(&callFrom, "from", "", "Number to call from, among vonage.number and vonage.numbers, selected by the client if empty")
+	callCmd.Flags().StringVar(&callPrio, "priority", nexmo.PriorityRoutine, "Priority of the broadcast, either \""+nexmo.PriorityRoutine+"\" or \""+nexmo.PriorityEmergency+"\"")
+	callCmd.MarkFlagRequired("rec")
+}
@@ -0,0 +1,173 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jecoz/voicebr"
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/phone"
+	"github.com/spf13/cobra"
+)
+
+var (
+	contactList  string
+	contactLang  string
+	contactVoice string
+	contactTZ    string
+	importFormat string
+	replaceList  bool
+)
+
+// contactsCmd groups the commands managing the contact lists
+var contactsCmd = &cobra.Command{
+	Use:   "contacts",
+	Short: "Manage the broadcast list and the whitelist",
+}
+
+var contactsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Print the contacts of a list",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		s, list := contactsStore(cmd)
+		contacts, err := s.ListContacts(context.Background(), list)
+		if err != nil && err != nexmo.ErrCorruptedContacts {
+			log.Fatal(err)
+		}
+		for _, v := range contacts {
+			fmt.Printf("%s\t%s\t%s\n", v.Number, v.Name, v.Lang)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var contactsAddCmd = &cobra.Command{
+	Use:   "add <number> [name]",
+	Short: "Add a contact to a list, replacing the one with the same number",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		s, list := contactsStore(cmd)
+		number, err := phone.Normalize(args[0], nexmo.CountryCode)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var name string
+		if len(args) > 1 {
+			name = args[1]
+		}
+		c := nexmo.NewContact(number, name)
+		c.Lang, c.Voice, c.TZ = contactLang, contactVoice, contactTZ
+		if c.TZ != "" {
+			if _, err = time.LoadLocation(c.TZ); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if err = s.AddContact(context.Background(), list, c); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("%s added to the %s list", number, list)
+	},
+}
+
+var contactsRmCmd = &cobra.Command{
+	Use:     "rm <number>",
+	Aliases: []string{"remove"},
+	Short:   "Remove a contact from a list",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		s, list := contactsStore(cmd)
+		number, err := phone.Normalize(args[0], nexmo.CountryCode)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = s.RemoveContact(context.Background(), list, number); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("%s removed from the %s list", number, list)
+	},
+}
+
+var contactsImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Add the contacts of an address book to a list, or replace the list with them",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		s, list := contactsStore(cmd)
+		file, err := os.Open(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		contacts, invalid, err := nexmo.ImportContacts(file, importFormat)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, v := range invalid {
+			log.Printf("skipping %v", v)
+		}
+		add := nexmo.AppendContacts
+		if replaceList {
+			add = nexmo.WriteContacts
+		}
+		if err = add(context.Background(), s, list, contacts); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("%d contacts imported into the %s list", len(contacts), list)
+	},
+}
+
+// contactsStore returns the storage selected by the preferences
+// and the list selected by the --list flag, exiting on error.
+func contactsStore(cmd *cobra.Command) (nexmo.ContactsStore, nexmo.ContactList) {
+	log.SetFlags(0)
+	list := nexmo.ContactList(contactList)
+	if list != nexmo.BroadcastList && list != nexmo.Whitelist {
+		log.Fatalf("unknown list %q, either %q or %q", list, nexmo.BroadcastList, nexmo.Whitelist)
+	}
+	p, err := loadPrefs(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+	nexmo.CountryCode = p.Contacts.CountryCode
+	s, err := voicebr.NewStorage(p.Storage, log.Default())
+	if err != nil {
+		log.Fatal(err)
+	}
+	return s, list
+}
+
+func init() {
+	rootCmd.AddCommand(contactsCmd)
+	for _, v := range []*cobra.Command{contactsListCmd, contactsAddCmd, contactsRmCmd, contactsImportCmd} {
+		contactsCmd.AddCommand(v)
+		addPrefsFlags(v)
+		v.Flags().StringVar(&contactList, "list", string(nexmo.BroadcastList), "Contact list, either \"broadcast\" or \"whitelist\"")
+	}
+	contactsAddCmd.Flags().StringVar(&contactLang, "lang", "", "Language spoken to the contact")
+	contactsAddCmd.Flags().StringVar(&contactVoice, "voice", "", "Voice used to speak to the contact")
+	contactsAddCmd.Flags().StringVar(&contactTZ, "tz", "", "IANA time zone of the contact, e.g. Europe/Rome")
+	contactsImportCmd.Flags().StringVar(&importFormat, "format", nexmo.ContactsCSV, "Format of the address book, either \"csv\", \"vcard\" or \"google\"")
+	contactsImportCmd.Flags().BoolVar(&replaceList, "replace", false, "Replace the list with the imported contacts")
+}
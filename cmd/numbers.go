@@ -0,0 +1,126 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/spf13/cobra"
+)
+
+var (
+	numbersPattern string
+	numbersLinked  bool
+)
+
+// numbersCmd groups the commands managing the numbers of the account
+var numbersCmd = &cobra.Command{
+	Use:   "numbers",
+	Short: "Manage the numbers of the account through the Numbers API",
+	Long: `Manage the numbers of the account through the Numbers API.
+
+The API is authenticated with the credentials of the account, vonage.api_key
+and vonage.api_secret. Countries are ISO 3166-1 alpha-2 codes, e.g. IT.`,
+}
+
+var numbersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Print the numbers owned by the account",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		p := appPrefs(cmd)
+		f := nexmo.NumberFilter{Pattern: numbersPattern}
+		if numbersLinked {
+			if p.Vonage.AppID == "" {
+				log.Fatal("--linked requires vonage.app_id")
+			}
+			f.AppID = p.Vonage.AppID
+		}
+		numbers, err := accountClient(p).OwnedNumbers(context.Background(), f)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printNumbers(numbers)
+	},
+}
+
+var numbersSearchCmd = &cobra.Command{
+	Use:   "search <country>",
+	Short: "Print the voice numbers of a country available to be bought",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		p := appPrefs(cmd)
+		numbers, err := accountClient(p).SearchNumbers(context.Background(), args[0], nexmo.NumberFilter{Pattern: numbersPattern})
+		if err != nil {
+			log.Fatal(err)
+		}
+		printNumbers(numbers)
+	},
+}
+
+// numberCommand returns the command performing `op` on the
+// number given as argument.
+func numberCommand(use, short, done string, op func(*nexmo.Client, context.Context, string, string) error) *cobra.Command {
+	return &cobra.Command{
+		Use:   use + " <country> <number>",
+		Short: short,
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			p := appPrefs(cmd)
+			c := accountClient(p)
+			c.AppID = p.Vonage.AppID
+			if err := op(c, context.Background(), args[0], args[1]); err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("%s %s", args[1], done)
+		},
+	}
+}
+
+var (
+	numbersBuyCmd    = numberCommand("buy", "Buy a number", "bought", (*nexmo.Client).BuyNumber)
+	numbersCancelCmd = numberCommand("cancel", "Cancel the subscription of an owned number", "canceled", (*nexmo.Client).CancelNumber)
+	numbersLinkCmd   = numberCommand("link", "Link an owned number to the application, vonage.app_id", "linked", (*nexmo.Client).LinkNumber)
+)
+
+// printNumbers prints a number per line, followed by the application
+// it is linked to or, when available to be bought, by its monthly cost.
+func printNumbers(numbers []nexmo.Number) {
+	for _, v := range numbers {
+		last := v.AppID
+		if v.Cost != "" {
+			last = v.Cost
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\n", v.MSISDN, v.Country, v.Type, last)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(numbersCmd)
+	for _, c := range []*cobra.Command{numbersListCmd, numbersSearchCmd, numbersBuyCmd, numbersCancelCmd, numbersLinkCmd} {
+		numbersCmd.AddCommand(c)
+		addPrefsFlags(c)
+		addClientFlags(c)
+	}
+	numbersListCmd.Flags().BoolVar(&numbersLinked, "linked", false, "Print only the numbers linked to the application")
+	for _, c := range []*cobra.Command{numbersListCmd, numbersSearchCmd} {
+		c.Flags().StringVar(&numbersPattern, "pattern", "", "Print only the numbers starting with it, e.g. 3932")
+	}
+}
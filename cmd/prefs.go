@@ -0,0 +1,165 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jecoz/voicebr"
+	"github.com/jecoz/voicebr/prefs"
+	"github.com/spf13/cobra"
+)
+
+// prefsCmd groups the commands dealing with preferences files
+var prefsCmd = &cobra.Command{
+	Use:     "prefs",
+	Aliases: []string{"config"},
+	Short:   "Create and inspect voicebr preferences",
+}
+
+var initForce bool
+
+// initCmd writes the default preferences
+var initCmd = &cobra.Command{
+	Use:   "init [path]",
+	Short: "Write the default preferences to a new file, voicebr.json if no path is given",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetFlags(0)
+		path := "voicebr.json"
+		if len(args) > 0 {
+			path = args[0]
+		}
+		flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+		if initForce {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		}
+		file, err := os.OpenFile(path, flags, 0600)
+		if err != nil {
+			log.Fatal(err)
+		}
+		enc := json.NewEncoder(file)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(prefs.Default()); err != nil {
+			file.Close()
+			log.Fatal(err)
+		}
+		if err = file.Close(); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("default preferences written to %s", path)
+	},
+}
+
+// validateCmd checks the preferences the way the server does
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the effective preferences, after merging every layer",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetFlags(0)
+		p, err := loadPrefs(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = voicebr.ValidatePrefs(p); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("preferences are valid")
+	},
+}
+
+// resolveCmd prints the effective preferences
+var resolveCmd = &cobra.Command{
+	Use:   "resolve",
+	Short: "Print the effective preferences, after merging every layer and override",
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetFlags(0)
+		p, err := loadPrefs(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(p); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// varsCmd lists the environment overrides
+var varsCmd = &cobra.Command{
+	Use:   "vars",
+	Short: "List the environment variables overriding each preference",
+	Long: `List the environment variables overriding each preference.
+
+Preferences are resolved in this order, each step taking precedence
+over the previous ones: the defaults, the preferences file and its
+overlays, the environment variables and finally the command line
+flags, --set included. VOICEBR_PORT and VOICEBR_ORIGIN are accepted
+as shorthands of VOICEBR_SERVER_PORT and VOICEBR_SERVER_ORIGIN.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, v := range prefs.Paths() {
+			fmt.Printf("%-45s %s\n", prefs.EnvVar(v), v)
+		}
+	},
+}
+
+// migrateCmd upgrades preferences files to the current schema
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade the preferences files to the current schema version, keeping a backup",
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetFlags(0)
+		if prefsP == "" {
+			log.Fatal("--prefs is required")
+		}
+		for _, v := range prefs.Layers(prefsP, env) {
+			from, err := prefs.MigrateFile(v)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if from == prefs.CurrentVersion {
+				log.Printf("%s: up to date (version %d)", v, from)
+				continue
+			}
+			log.Printf("%s: migrated from version %d to %d, backup in %s.v%d.bak", v, from, prefs.CurrentVersion, v, from)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(prefsCmd)
+	prefsCmd.AddCommand(initCmd)
+	prefsCmd.AddCommand(validateCmd)
+	prefsCmd.AddCommand(resolveCmd)
+	prefsCmd.AddCommand(migrateCmd)
+	prefsCmd.AddCommand(varsCmd)
+
+	initCmd.Flags().BoolVar(&initForce, "force", false, "Overwrite the file if it exists")
+	addPrefsFlags(validateCmd)
+	addClientFlags(validateCmd)
+
+	addPrefsFlags(resolveCmd)
+	addClientFlags(resolveCmd)
+	migrateCmd.Flags().StringVar(&prefsP, "prefs", "", "Path to the base JSON preferences file")
+	migrateCmd.Flags().StringVar(&env, "env", "", "Environment overlay to migrate as well, defaults to $"+prefs.EnvName)
+}
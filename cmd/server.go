@@ -17,13 +17,21 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"net/http"
+	"net"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/jecoz/voicebr"
 	"github.com/jecoz/voicebr/nexmo"
-	"github.com/jecoz/voicebr/storage"
+	"github.com/jecoz/voicebr/prefs"
+	"github.com/jecoz/voicebr/tunnel"
 	"github.com/spf13/cobra"
 )
 
@@ -34,52 +42,172 @@ var (
 	rootDir string
 	pKey    string
 	port    int
+	prefsP  string
+	env     string
+	sets    []string
+	console bool
+	dash    bool
+
+	tunnelP       string
+	tunnelServer  string
+	tunnelSub     string
+	tunnelUpdates bool
 )
 
-// serverCmd represents the server command
+// serverCmd represents the serve command
 var serverCmd = &cobra.Command{
-	Use:   "server",
-	Short: "Start a voicebr server",
+	Use:     "serve",
+	Aliases: []string{"server"},
+	Short:   "Start a voicebr server",
 	Run: func(cmd *cobra.Command, args []string) {
 		log.SetFlags(0)
 		log.Printf("version: %s, commit: %s, built at: %s\n", Version, Commit, BuildTime)
-		log.Printf("app-id: %s, app-num: %s, origin: %s, root-dir: %s\n\n", appID, appNum, origin, rootDir)
 
-		log.Printf("loading private key from %s", pKey)
-		file, err := os.Open(pKey)
+		p, err := loadPrefs(cmd)
 		if err != nil {
 			log.Fatal(err)
 		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		var tun tunnel.Tunnel
+		if tunnelP != "" {
+			if tun, err = openTunnel(ctx, p); err != nil {
+				log.Fatal(err)
+			}
+			defer tun.Close()
+			p.Server.Origin = tun.URL()
+			log.Printf("tunnel: serving at %s", tun.URL())
+		}
+		log.Printf("app-id: %s, app-num: %s, origin: %s, root-dir: %s\n\n", p.Vonage.AppID, p.Vonage.Number, p.Server.Origin, p.Storage.Local.RootDir)
 
-		client, err := nexmo.NewClient(file, appID, appNum, origin)
-		file.Close()
+		opts := []voicebr.Option{voicebr.WithPrefs(p)}
+		if console {
+			opts = append(opts, voicebr.WithConsole())
+		}
+		if dash {
+			opts = append(opts, voicebr.WithDashboard())
+		}
+		srv, err := voicebr.New(opts...)
 		if err != nil {
-			panic(err)
+			log.Fatal(err)
 		}
-
-		log.Printf("creating local storage in: %s", rootDir)
-		s := &storage.Local{RootDir: rootDir}
-		r := nexmo.NewRouter(client, s, origin)
-
-		log.Printf("%v listening on port :%d\n\n", os.Args[0], port)
-		if err := http.ListenAndServe(fmt.Sprintf(":%d", port), r); err != nil {
+		if tun != nil && tunnelUpdates {
+			if err = updateWebhooks(ctx, srv.Client(), tun.URL()); err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("tunnel: application webhooks pointed to %s", tun.URL())
+		}
+		if err = srv.Run(ctx); err != nil {
 			log.Fatal(err)
 		}
 	},
 }
 
+// loadPrefs returns the preferences selected by the --prefs and
+// --env flags of `cmd`, overridden first by the VOICEBR_*
+// environment variables, then by the flags set explicitly and
+// finally by the --set flags.
+func loadPrefs(cmd *cobra.Command) (*prefs.MasterPrefs, error) {
+	p := prefs.Default()
+	if prefsP != "" {
+		layers := prefs.Layers(prefsP, env)
+		log.Printf("loading preferences from %v", layers)
+		var err error
+		if p, err = prefs.LoadLayers(layers...); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.ApplyEnv(os.Environ()); err != nil {
+		return nil, fmt.Errorf("environment: %v", err)
+	}
+
+	flags := cmd.Flags()
+	for _, v := range []struct {
+		flag string
+		path string
+	}{
+		{"root-dir", "storage.local.root_dir"},
+		{"app-id", "vonage.app_id"},
+		{"app-num", "vonage.number"},
+		{"private-key", "vonage.private_key"},
+		{"origin", "server.origin"},
+		{"port", "server.port"},
+	} {
+		if f := flags.Lookup(v.flag); f != nil && f.Changed {
+			if err := p.Set(v.path, f.Value.String()); err != nil {
+				return nil, fmt.Errorf("--%s: %v", v.flag, err)
+			}
+		}
+	}
+	for _, v := range sets {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("--set %q: want path=value", v)
+		}
+		if err := p.Set(kv[0], kv[1]); err != nil {
+			return nil, fmt.Errorf("--set: %v", err)
+		}
+	}
+	return p, nil
+}
+
+// openTunnel opens the tunnel selected by the --tunnel flags to
+// the port the server listens at.
+func openTunnel(ctx context.Context, p *prefs.MasterPrefs) (tunnel.Tunnel, error) {
+	host := p.Server.Host
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	return tunnel.Open(ctx, tunnelP, net.JoinHostPort(host, strconv.Itoa(p.Server.Port)), tunnel.Options{
+		Server:    tunnelServer,
+		Subdomain: tunnelSub,
+	})
+}
+
+// updateWebhooks points the voice webhooks of the application
+// of `c` to `origin`.
+func updateWebhooks(ctx context.Context, c *nexmo.Client, origin string) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	app, err := c.Application(ctx)
+	if err != nil {
+		return fmt.Errorf("tunnel: %v", err)
+	}
+	app.SetVoiceWebhooks(origin)
+	if _, err = c.UpdateApplication(ctx, app); err != nil {
+		return fmt.Errorf("tunnel: %v", err)
+	}
+	return nil
+}
+
+// addPrefsFlags registers the flags read by loadPrefs.
+func addPrefsFlags(c *cobra.Command) {
+	c.Flags().StringVar(&rootDir, "root-dir", ".", "Root storage directory path")
+	c.Flags().StringVar(&prefsP, "prefs", "", "Path to the JSON preferences file, optionally age encrypted")
+	c.Flags().StringVar(&env, "env", "", "Environment overlay to apply on top of the preferences file, defaults to $"+prefs.EnvName)
+	c.Flags().StringArrayVar(&sets, "set", nil, "Override a preference, e.g. delivery.max_attempts=3, taking precedence over the files and the environment")
+}
+
+// addClientFlags registers the flags overriding the vonage
+// and origin preferences.
+func addClientFlags(c *cobra.Command) {
+	c.Flags().StringVar(&origin, "origin", "", "Canonical protocol + authority of the web server that will handle nexmo callbacks")
+	c.Flags().StringVar(&pKey, "private-key", "", "Path to the private key that should be used to sign JWTs")
+	c.Flags().StringVar(&appID, "app-id", "", "Nexmo's application identifier")
+	c.Flags().StringVar(&appNum, "app-num", "", "Nexmo's application registered number")
+}
+
 func init() {
 	rootCmd.AddCommand(serverCmd)
 
+	addPrefsFlags(serverCmd)
+	addClientFlags(serverCmd)
 	serverCmd.Flags().IntVar(&port, "port", 4001, "Server listening port")
-	serverCmd.Flags().StringVar(&rootDir, "root-dir", ".", "Root storage directory path")
-	serverCmd.Flags().StringVar(&origin, "origin", "", "Canonical protocol + authority of the web server that will handle nexmo callbacks")
-	serverCmd.Flags().StringVar(&pKey, "private-key", "", "Path to the private key that should be used to sign JWTs")
-	serverCmd.Flags().StringVar(&appID, "app-id", "", "Nexmo's application identifier")
-	serverCmd.Flags().StringVar(&appNum, "app-num", "", "Nexmo's application registered number")
-
-	serverCmd.MarkFlagRequired("host-addr")
-	serverCmd.MarkFlagRequired("app-id")
-	serverCmd.MarkFlagRequired("app-num")
-	serverCmd.MarkFlagRequired("private-key")
+	serverCmd.Flags().BoolVar(&console, "console", false, "Enable the webhook test console at /admin/console")
+	serverCmd.Flags().BoolVar(&dash, "dashboard", false, "Enable the web dashboard at /admin/dashboard/")
+	serverCmd.Flags().StringVar(&tunnelP, "tunnel", "", "Expose the server through a public tunnel, either "+tunnel.Localtunnel+" or "+tunnel.Ngrok+", used as origin")
+	serverCmd.Flags().Lookup("tunnel").NoOptDefVal = tunnel.Localtunnel
+	serverCmd.Flags().StringVar(&tunnelServer, "tunnel-server", "", "Localtunnel server, or ngrok agent API, to open the tunnel through")
+	serverCmd.Flags().StringVar(&tunnelSub, "tunnel-subdomain", "", "Subdomain requested to the localtunnel server")
+	serverCmd.Flags().BoolVar(&tunnelUpdates, "tunnel-update-app", false, "Point the webhooks of the Vonage application to the tunnel, requires vonage.api_key and vonage.api_secret")
 }
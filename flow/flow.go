@@ -0,0 +1,184 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package flow models the multi-step interactions of a call,
+// e.g. answer, prompt, input, record and confirm, as state
+// machines. Nexmo reports each step to a different webhook: the
+// state of the call is persisted in a Store between them, keyed
+// by conversation UUID, instead of in ad-hoc maps of each handler.
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned by the stores when there is no
+	// session with the requested id.
+	ErrNotFound = errors.New("flow: session not found")
+	// ErrUnknownFlow is returned when starting a flow that
+	// has not been registered.
+	ErrUnknownFlow = errors.New("flow: unknown flow")
+)
+
+// Actions are the NCCO actions returned to nexmo.
+type Actions = []map[string]interface{}
+
+// State is the step a session is waiting at.
+type State string
+
+// Done ends the session: it is deleted instead of saved.
+const Done State = ""
+
+// Session is the state of a flow for a single call.
+type Session struct {
+	// ID is the conversation UUID of the call.
+	ID    string `json:"id"`
+	Flow  string `json:"flow"`
+	State State  `json:"state"`
+	// Data is where the steps keep what they need later on.
+	Data      map[string]string `json:"data,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// Get returns the value of `key` in the session data.
+func (s *Session) Get(key string) string {
+	return s.Data[key]
+}
+
+// Set sets `key` to `value` in the session data.
+func (s *Session) Set(key, value string) {
+	if s.Data == nil {
+		s.Data = make(map[string]string)
+	}
+	s.Data[key] = value
+}
+
+// Event is what nexmo reported to the webhook advancing
+// the session.
+type Event struct {
+	// Digits are the keys pressed, for input events.
+	Digits string
+}
+
+// Step handles `e` for the session `s` waiting at one of its
+// states, returning the state to move to and the actions to
+// answer nexmo with. The changes to `s` are saved along with
+// the new state.
+type Step func(ctx context.Context, s *Session, e Event) (State, Actions, error)
+
+// Flow is a state machine.
+type Flow struct {
+	Name string
+	// Start is the state of the new sessions.
+	Start State
+	Steps map[State]Step
+}
+
+// Store persists the sessions between the webhooks.
+type Store interface {
+	// LoadSession returns ErrNotFound if there is no session
+	// with id `id`, or if it is expired.
+	LoadSession(ctx context.Context, id string) (Session, error)
+	// SaveSession stores `s`, replacing the session with
+	// the same id.
+	SaveSession(ctx context.Context, s Session) error
+	DeleteSession(ctx context.Context, id string) error
+}
+
+// Machine runs the registered flows, persisting their sessions
+// in Store.
+type Machine struct {
+	Store Store
+
+	// mu serializes the steps, nexmo may report the
+	// events of a call concurrently.
+	mu    sync.Mutex
+	flows map[string]*Flow
+}
+
+// NewMachine returns a machine running `flows`, whose sessions
+// are saved in `store`.
+func NewMachine(store Store, flows ...*Flow) *Machine {
+	m := &Machine{Store: store, flows: make(map[string]*Flow)}
+	for _, f := range flows {
+		m.flows[f.Name] = f
+	}
+	return m
+}
+
+// Start begins the flow `name` for the call `id`, with `data`,
+// replacing any session the call already has.
+func (m *Machine) Start(ctx context.Context, id, name string, data map[string]string) (Session, error) {
+	f, ok := m.flows[name]
+	if !ok {
+		return Session{}, ErrUnknownFlow
+	}
+	now := time.Now()
+	s := Session{
+		ID:        id,
+		Flow:      f.Name,
+		State:     f.Start,
+		Data:      data,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := m.Store.SaveSession(ctx, s); err != nil {
+		return Session{}, err
+	}
+	return s, nil
+}
+
+// Handle advances the session of the call `id` with `e`,
+// returning the actions of its step.
+func (m *Machine) Handle(ctx context.Context, id string, e Event) (Actions, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, err := m.Store.LoadSession(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := m.flows[s.Flow]
+	if !ok {
+		return nil, ErrUnknownFlow
+	}
+	step, ok := f.Steps[s.State]
+	if !ok {
+		return nil, fmt.Errorf("flow: %s has no step for state %q", f.Name, s.State)
+	}
+
+	next, actions, err := step(ctx, &s, e)
+	if err != nil {
+		return nil, err
+	}
+	if next == Done {
+		return actions, m.Store.DeleteSession(ctx, id)
+	}
+	s.State = next
+	s.UpdatedAt = time.Now()
+	return actions, m.Store.SaveSession(ctx, s)
+}
+
+// Session returns the session of the call `id`.
+func (m *Machine) Session(ctx context.Context, id string) (Session, error) {
+	return m.Store.LoadSession(ctx, id)
+}
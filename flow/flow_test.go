@@ -0,0 +1,83 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package flow_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jecoz/voicebr/flow"
+)
+
+func TestMachine(t *testing.T) {
+	say := func(text string) flow.Actions {
+		return flow.Actions{{"action": "talk", "text": text}}
+	}
+	f := &flow.Flow{
+		Name:  "pin",
+		Start: "ask",
+		Steps: map[flow.State]flow.Step{
+			"ask": func(ctx context.Context, s *flow.Session, e flow.Event) (flow.State, flow.Actions, error) {
+				s.Set("pin", e.Digits)
+				return "confirm", say("confirm " + e.Digits), nil
+			},
+			"confirm": func(ctx context.Context, s *flow.Session, e flow.Event) (flow.State, flow.Actions, error) {
+				if e.Digits != "1" {
+					return "ask", say("again"), nil
+				}
+				return flow.Done, say("saved " + s.Get("pin")), nil
+			},
+		},
+	}
+	m := flow.NewMachine(flow.NewMemoryStore(), f)
+	ctx := context.TODO()
+
+	if _, err := m.Start(ctx, "CON-1", "missing", nil); err != flow.ErrUnknownFlow {
+		t.Fatalf("Wanted %v, found %v", flow.ErrUnknownFlow, err)
+	}
+	if _, err := m.Start(ctx, "CON-1", "pin", map[string]string{"caller": "393330000000"}); err != nil {
+		t.Fatalf("Unexpected start error: %v", err)
+	}
+	for _, v := range []struct {
+		digits string
+		text   string
+		state  flow.State
+	}{
+		{"42", "confirm 42", "confirm"},
+		{"2", "again", "ask"},
+		{"43", "confirm 43", "confirm"},
+		{"1", "saved 43", flow.Done},
+	} {
+		actions, err := m.Handle(ctx, "CON-1", flow.Event{Digits: v.digits})
+		if err != nil {
+			t.Fatalf("Unexpected handle error: %v", err)
+		}
+		if actions[0]["text"] != v.text {
+			t.Fatalf("Wanted %q, found %v", v.text, actions[0]["text"])
+		}
+		s, err := m.Session(ctx, "CON-1")
+		if v.state == flow.Done {
+			if err != flow.ErrNotFound {
+				t.Fatalf("Wanted the session to be over, found %v", err)
+			}
+			continue
+		}
+		if err != nil || s.State != v.state || s.Get("caller") != "393330000000" {
+			t.Fatalf("Wanted state %q, found %+v (%v)", v.state, s, err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package flow
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultTTL is the time the sessions are kept for, since
+// their last update, well beyond the length of any call.
+const DefaultTTL = time.Hour
+
+// MemoryStore keeps the sessions in memory: they are lost
+// on restart.
+type MemoryStore struct {
+	// TTL is DefaultTTL if zero.
+	TTL time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]Session
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string]Session)}
+}
+
+func (m *MemoryStore) ttl() time.Duration {
+	if m.TTL == 0 {
+		return DefaultTTL
+	}
+	return m.TTL
+}
+
+func (m *MemoryStore) LoadSession(ctx context.Context, id string) (Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok || time.Since(s.UpdatedAt) > m.ttl() {
+		return Session{}, ErrNotFound
+	}
+	s.Data = copyData(s.Data)
+	return s, nil
+}
+
+// SaveSession stores `s`, dropping the expired sessions.
+func (m *MemoryStore) SaveSession(ctx context.Context, s Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, v := range m.sessions {
+		if time.Since(v.UpdatedAt) > m.ttl() {
+			delete(m.sessions, k)
+		}
+	}
+	s.Data = copyData(s.Data)
+	m.sessions[s.ID] = s
+	return nil
+}
+
+func (m *MemoryStore) DeleteSession(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+// copyData keeps the stored sessions from being modified
+// without being saved.
+func copyData(data map[string]string) map[string]string {
+	acc := make(map[string]string, len(data))
+	for k, v := range data {
+		acc[k] = v
+	}
+	return acc
+}
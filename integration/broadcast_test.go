@@ -0,0 +1,210 @@
+//go:build integration
+// +build integration
+
+package integration_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/nexmo/nexmotest"
+	"github.com/jecoz/voicebr/prefs"
+)
+
+const apiKey = "integration"
+
+// voicebr is a running voicebr server.
+type voicebr struct {
+	t      *testing.T
+	origin string
+	cmd    *exec.Cmd
+	out    bytes.Buffer
+}
+
+// startVoicebr builds voicebr and serves it with the preferences
+// returned by `configure`, talking to the fake API `srv`.
+func startVoicebr(t *testing.T, srv *nexmotest.Server, configure func(p *prefs.MasterPrefs)) *voicebr {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "voicebr")
+	build := exec.Command("go", "build", "-o", bin, "../cmd/voicebr")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("Unable to build voicebr: %v\n%s", err, out)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	key := filepath.Join(dir, "private.key")
+	if err := ioutil.WriteFile(key, srv.PrivateKeyPEM(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	p := prefs.Default()
+	p.Vonage = prefs.Vonage{AppID: "app", Number: "393339999999", PrivateKey: key, BaseURL: srv.URL}
+	p.Server.Origin = fmt.Sprintf("http://127.0.0.1:%d", port)
+	p.Server.Port = port
+	p.Storage.Local.RootDir = dir
+	p.Storage.SQLite.Path = filepath.Join(dir, "voicebr.db")
+	p.Admin.APIKeys = []prefs.APIKey{{Name: "ci", Key: apiKey}}
+	if configure != nil {
+		configure(p)
+	}
+	b, _ := json.Marshal(p)
+	prefsPath := filepath.Join(dir, "prefs.json")
+	if err := ioutil.WriteFile(prefsPath, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	v := &voicebr{t: t, origin: p.Server.Origin}
+	v.cmd = exec.Command(bin, "serve", "--prefs", prefsPath)
+	v.cmd.Env = append(os.Environ(), prefs.EnvName+"=")
+	v.cmd.Stdout, v.cmd.Stderr = &v.out, &v.out
+	if err := v.cmd.Start(); err != nil {
+		t.Fatalf("Unable to start voicebr: %v", err)
+	}
+	for i := 0; ; i++ {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if i == 100 {
+			v.stop()
+			t.Fatalf("voicebr did not start listening:\n%s", v.out.String())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return v
+}
+
+func (v *voicebr) stop() {
+	v.cmd.Process.Kill()
+	v.cmd.Wait()
+	if v.t.Failed() {
+		v.t.Logf("voicebr output:\n%s", v.out.String())
+	}
+}
+
+// do sends `r`, built for an httptest recorder, to the server.
+func (v *voicebr) do(r *http.Request) *http.Response {
+	u, _ := url.Parse(v.origin + r.URL.RequestURI())
+	r.URL, r.Host, r.RequestURI = u, u.Host, ""
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		v.t.Fatalf("Unexpected request error: %v", err)
+	}
+	return resp
+}
+
+// admin calls the admin API, decoding the response into `dst`
+// if not nil.
+func (v *voicebr) admin(method, path, body string, dst interface{}) {
+	r, _ := http.NewRequest(method, v.origin+path, strings.NewReader(body))
+	r.Header.Set("X-API-Key", apiKey)
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		v.t.Fatalf("Unexpected request error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		v.t.Fatalf("%s %s: unexpected status %s: %s", method, path, resp.Status, b)
+	}
+	if dst != nil {
+		if err := json.NewDecoder(resp.Body).Decode(dst); err != nil {
+			v.t.Fatalf("%s %s: unexpected decode error: %v", method, path, err)
+		}
+	}
+}
+
+func waitCalls(srv *nexmotest.Server, n int) []nexmotest.Call {
+	deadline := time.Now().Add(10 * time.Second)
+	for len(srv.Calls()) < n && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	return srv.Calls()
+}
+
+func TestBroadcast(t *testing.T) {
+	srv, err := nexmotest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	v := startVoicebr(t, srv, nil)
+	defer v.stop()
+
+	v.admin("POST", "/admin/contacts/whitelist/import", "393330000000,Marco\n", nil)
+	v.admin("POST", "/admin/contacts/broadcast/import", "393331111111,Anna\n393332222222,Luca\n", nil)
+
+	// The broadcaster calls in and records the message.
+	resp := v.do(nexmotest.AnswerWebhook("393330000000", "CON-1"))
+	var ncco []map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&ncco)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || len(ncco) < 2 || ncco[1]["action"] != "record" {
+		t.Fatalf("Wanted a record NCCO, found %s %v", resp.Status, ncco)
+	}
+	audio := []byte("fake mp3")
+	recUUID, recURL := srv.AddRecording(audio)
+	v.do(nexmotest.RecordingWebhookLength(recURL, recUUID, "CON-1", 10*time.Second)).Body.Close()
+
+	// The message is broadcast to the whole list.
+	calls := waitCalls(srv, 2)
+	if len(calls) != 2 {
+		t.Fatalf("Wanted 2 calls, found %d", len(calls))
+	}
+	for _, c := range calls {
+		resp, err := http.Get(c.AnswerURL[0])
+		if err != nil {
+			t.Fatalf("Unexpected answer error: %v", err)
+		}
+		json.NewDecoder(resp.Body).Decode(&ncco)
+		resp.Body.Close()
+		if len(ncco) != 3 || ncco[1]["action"] != "stream" {
+			t.Fatalf("Wanted a playback NCCO, found %v", ncco)
+		}
+		streamURL := ncco[1]["streamUrl"].([]interface{})[0].(string)
+		resp, err = http.Get(streamURL)
+		if err != nil {
+			t.Fatalf("Unexpected stream error: %v", err)
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if !bytes.Equal(b, audio) {
+			t.Fatalf("Wanted the recording to be played, found %q", b)
+		}
+
+		u, _ := url.Parse(c.EventURL[0])
+		v.do(nexmotest.EventWebhook(u.RequestURI(), c.ConversationUUID, "completed", 15*time.Second)).Body.Close()
+	}
+
+	// The report lists both recipients as reached.
+	var broadcasts struct {
+		Broadcasts []nexmo.Broadcast `json:"broadcasts"`
+	}
+	v.admin("GET", "/admin/broadcasts", "", &broadcasts)
+	if len(broadcasts.Broadcasts) != 1 || broadcasts.Broadcasts[0].RecName != recUUID+".mp3" {
+		t.Fatalf("Unexpected broadcasts: %+v", broadcasts.Broadcasts)
+	}
+	var report nexmo.DeliveryReport
+	v.admin("GET", fmt.Sprintf("/broadcasts/%d/report", broadcasts.Broadcasts[0].ID), "", &report)
+	if report.Reached != 2 || report.Unreached != 0 || len(report.Recipients) != 2 {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+}
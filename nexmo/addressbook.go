@@ -0,0 +1,332 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jecoz/voicebr/phone"
+)
+
+// Formats understood by ImportContacts and ExportContacts.
+const (
+	ContactsCSV    = "csv"
+	ContactsVCard  = "vcard"
+	ContactsGoogle = "google"
+)
+
+// ImportContacts decodes the address book read from `r`, in
+// `format`. The entries without a valid phone number are
+// returned separately.
+func ImportContacts(r io.Reader, format string) ([]Contact, []*ContactError, error) {
+	switch format {
+	case ContactsCSV, "":
+		return ParseContacts(func(w io.Writer) error {
+			_, err := io.Copy(w, r)
+			return err
+		})
+	case ContactsVCard:
+		return DecodeVCards(r)
+	case ContactsGoogle:
+		return DecodeGoogleCSV(r)
+	default:
+		return nil, nil, fmt.Errorf("unknown contacts format %q", format)
+	}
+}
+
+// ExportContacts encodes `contacts` in `format`, which is
+// either ContactsCSV or ContactsVCard.
+func ExportContacts(w io.Writer, contacts []Contact, format string) error {
+	switch format {
+	case ContactsCSV, "":
+		return EncodeContacts(w, contacts)
+	case ContactsVCard:
+		return EncodeVCards(w, contacts)
+	default:
+		return fmt.Errorf("unknown contacts format %q", format)
+	}
+}
+
+// importedContact returns the contact `name`, reachable at
+// `number`, which is normalized.
+func importedContact(number, name string) (Contact, error) {
+	if strings.TrimSpace(number) == "" {
+		return Contact{}, fmt.Errorf("%s: no phone number", name)
+	}
+	n, err := phone.Normalize(number, CountryCode)
+	if err != nil {
+		return Contact{}, fmt.Errorf("%s: %v", name, err)
+	}
+	return NewContact(n, name), nil
+}
+
+// vcardProp is a content line of a vCard.
+type vcardProp struct {
+	Name   string
+	Params []string
+	Value  string
+}
+
+func parseVCardLine(line string) vcardProp {
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return vcardProp{Name: strings.ToUpper(line)}
+	}
+	fields := strings.Split(line[:i], ";")
+	name := strings.ToUpper(fields[0])
+	// Drop the group, as in "item1.TEL".
+	if j := strings.LastIndex(name, "."); j >= 0 {
+		name = name[j+1:]
+	}
+	return vcardProp{Name: name, Params: fields[1:], Value: line[i+1:]}
+}
+
+// types returns the lowercased TYPE parameters of `p`, both in
+// the "TYPE=cell,pref" and in the bare "CELL" vCard 2.1 form.
+// vCard 4 "PREF=1" parameters are returned as "pref".
+func (p vcardProp) types() []string {
+	var acc []string
+	for _, v := range p.Params {
+		v = strings.ToLower(v)
+		switch {
+		case strings.HasPrefix(v, "type="):
+			acc = append(acc, strings.Split(strings.Trim(v[5:], `"`), ",")...)
+		case strings.HasPrefix(v, "pref="):
+			acc = append(acc, "pref")
+		case !strings.Contains(v, "="):
+			acc = append(acc, v)
+		}
+	}
+	return acc
+}
+
+var vcardUnescaper = strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`)
+
+// vcardCard accumulates the properties of a vCard.
+type vcardCard struct {
+	line       int
+	fn, n      string
+	tel        string
+	telRank    int
+	hasContent bool
+}
+
+// telRank orders the phone numbers of a card: preferred
+// ones first, then the mobile ones, then the others.
+func telRank(types []string) int {
+	rank := 1
+	for _, t := range types {
+		switch t {
+		case "pref":
+			return 3
+		case "cell", "mobile", "iphone":
+			rank = 2
+		}
+	}
+	return rank
+}
+
+func (c *vcardCard) add(p vcardProp) {
+	switch p.Name {
+	case "FN":
+		c.fn = strings.TrimSpace(vcardUnescaper.Replace(p.Value))
+	case "N":
+		// Family;Given;Additional;Prefix;Suffix
+		parts := strings.Split(p.Value, ";")
+		var names []string
+		for _, i := range []int{3, 1, 2, 0, 4} {
+			if i < len(parts) && parts[i] != "" {
+				names = append(names, vcardUnescaper.Replace(parts[i]))
+			}
+		}
+		c.n = strings.Join(names, " ")
+	case "TEL":
+		value := strings.TrimPrefix(p.Value, "tel:")
+		if rank := telRank(p.types()); value != "" && rank > c.telRank {
+			c.tel, c.telRank = value, rank
+		}
+	}
+}
+
+func (c *vcardCard) contact() (Contact, error) {
+	name := c.fn
+	if name == "" {
+		name = c.n
+	}
+	return importedContact(c.tel, name)
+}
+
+// DecodeVCards decodes the vCards (versions 2.1 to 4.0) read from
+// `r`, using their formatted name and their preferred phone
+// number, or the mobile one. The line of invalid entries is the
+// one of their BEGIN:VCARD.
+func DecodeVCards(r io.Reader) ([]Contact, []*ContactError, error) {
+	acc := []Contact{}
+	var invalid []*ContactError
+	var card *vcardCard
+
+	// Content lines may be folded: the lines starting with
+	// a space or a tab continue the previous one.
+	var current string
+	currentLine := 0
+	flush := func() {
+		if current == "" {
+			return
+		}
+		p := parseVCardLine(current)
+		current = ""
+		switch {
+		case p.Name == "BEGIN" && strings.EqualFold(p.Value, "vcard"):
+			card = &vcardCard{line: currentLine}
+		case p.Name == "END" && strings.EqualFold(p.Value, "vcard") && card != nil:
+			c, err := card.contact()
+			if err != nil {
+				invalid = append(invalid, &ContactError{Line: card.line, Err: err})
+			} else {
+				acc = append(acc, c)
+			}
+			card = nil
+		case card != nil:
+			card.add(p)
+		}
+	}
+
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimRight(sc.Text(), "\r")
+		if strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t") {
+			current += text[1:]
+			continue
+		}
+		flush()
+		current, currentLine = text, line
+	}
+	flush()
+	if err := sc.Err(); err != nil {
+		return nil, nil, fmt.Errorf("decode vcards: %v", err)
+	}
+	if card != nil {
+		invalid = append(invalid, &ContactError{Line: card.line, Err: fmt.Errorf("missing END:VCARD")})
+	}
+	return acc, invalid, nil
+}
+
+var vcardEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\n", `\n`)
+
+// EncodeVCards writes `contacts` as version 3.0 vCards.
+func EncodeVCards(w io.Writer, contacts []Contact) error {
+	bw := bufio.NewWriter(w)
+	for _, v := range contacts {
+		fmt.Fprintf(bw, "BEGIN:VCARD\r\nVERSION:3.0\r\n")
+		fmt.Fprintf(bw, "FN:%s\r\n", vcardEscaper.Replace(v.Name))
+		fmt.Fprintf(bw, "N:%s;;;;\r\n", vcardEscaper.Replace(v.Name))
+		fmt.Fprintf(bw, "TEL;TYPE=CELL:+%s\r\n", v.Number)
+		fmt.Fprintf(bw, "END:VCARD\r\n")
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("encode vcards: %v", err)
+	}
+	return nil
+}
+
+// DecodeGoogleCSV decodes a Google Contacts csv export, using the
+// primary phone number of each contact, or the mobile one. As
+// records may span multiple lines, the line of invalid entries
+// is their row number, counting the header as the first row.
+func DecodeGoogleCSV(r io.Reader) ([]Contact, []*ContactError, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("decode google csv: unable to read header: %v", err)
+	}
+	cols := make(map[string]int, len(header))
+	for i, v := range header {
+		cols[strings.TrimSpace(strings.TrimPrefix(v, "\ufeff"))] = i
+	}
+	field := func(rec []string, name string) string {
+		if i, ok := cols[name]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+
+	acc := []Contact{}
+	var invalid []*ContactError
+	for row := 2; ; row++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if pe, ok := err.(*csv.ParseError); ok {
+				err = pe.Err
+			}
+			invalid = append(invalid, &ContactError{Line: row, Err: err})
+			continue
+		}
+
+		name := field(rec, "Name")
+		if name == "" {
+			var names []string
+			for _, v := range []string{"First Name", "Given Name", "Middle Name", "Additional Name", "Last Name", "Family Name"} {
+				if f := field(rec, v); f != "" {
+					names = append(names, f)
+				}
+			}
+			name = strings.Join(names, " ")
+		}
+
+		var tel string
+		best := 0
+		for i := 1; ; i++ {
+			prefix := fmt.Sprintf("Phone %d - ", i)
+			if _, ok := cols[prefix+"Value"]; !ok {
+				break
+			}
+			// Multiple numbers of the same type are
+			// separated by " ::: ".
+			value := strings.TrimSpace(strings.Split(field(rec, prefix+"Value"), ":::")[0])
+			if value == "" {
+				continue
+			}
+			typ := strings.ToLower(field(rec, prefix+"Type"))
+			rank := 1
+			switch {
+			case strings.HasPrefix(typ, "*"):
+				rank = 3
+			case strings.Contains(typ, "mobile"):
+				rank = 2
+			}
+			if rank > best {
+				tel, best = value, rank
+			}
+		}
+
+		c, err := importedContact(tel, name)
+		if err != nil {
+			invalid = append(invalid, &ContactError{Line: row, Err: err})
+			continue
+		}
+		acc = append(acc, c)
+	}
+	return acc, invalid, nil
+}
@@ -0,0 +1,90 @@
+package nexmo_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+func TestDecodeVCards(t *testing.T) {
+	nexmo.CountryCode = "39"
+	defer func() { nexmo.CountryCode = "" }()
+
+	contacts, invalid, err := nexmo.DecodeVCards(strings.NewReader("BEGIN:VCARD\r\n" +
+		"VERSION:3.0\r\n" +
+		"N:Rossi;Anna;;;\r\n" +
+		"FN:Anna Rossi\r\n" +
+		"TEL;TYPE=HOME:06 1234567\r\n" +
+		"item1.TEL;TYPE=CELL:333 111\r\n" +
+		" 1111\r\n" +
+		"END:VCARD\r\n" +
+		"BEGIN:VCARD\r\n" +
+		"VERSION:4.0\r\n" +
+		"N:Bianchi;Luca;;;\r\n" +
+		"TEL;VALUE=uri;TYPE=cell:tel:+39-333-2222222\r\n" +
+		"TEL;VALUE=uri;PREF=1;TYPE=work:tel:+44-20-79460018\r\n" +
+		"END:VCARD\r\n" +
+		"BEGIN:VCARD\r\n" +
+		"VERSION:2.1\r\n" +
+		"FN:No Phone\r\n" +
+		"END:VCARD\r\n"))
+	if err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if len(contacts) != 2 {
+		t.Fatalf("Wanted 2 contacts, found %d", len(contacts))
+	}
+	if c := contacts[0]; c.Name != "Anna Rossi" || c.Number != "393331111111" {
+		t.Fatalf("Unexpected contact: %+v", c)
+	}
+	if c := contacts[1]; c.Name != "Luca Bianchi" || c.Number != "442079460018" {
+		t.Fatalf("Unexpected contact: %+v", c)
+	}
+	if len(invalid) != 1 || invalid[0].Line != 15 {
+		t.Fatalf("Wanted an invalid entry on line 15, found %v", invalid)
+	}
+}
+
+func TestDecodeGoogleCSV(t *testing.T) {
+	nexmo.CountryCode = "39"
+	defer func() { nexmo.CountryCode = "" }()
+
+	contacts, invalid, err := nexmo.DecodeGoogleCSV(strings.NewReader(`First Name,Middle Name,Last Name,Notes,Phone 1 - Label,Phone 1 - Type,Phone 1 - Value,Phone 2 - Type,Phone 2 - Value
+Anna,,Rossi,"two
+lines",,Home,06 1234567,* Mobile,+39 333 1111111 ::: +39 333 0000000
+Luca,,Bianchi,,,Mobile,333 2222222,,
+Mario,,,,,,,,
+`))
+	if err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if len(contacts) != 2 {
+		t.Fatalf("Wanted 2 contacts, found %d", len(contacts))
+	}
+	if c := contacts[0]; c.Name != "Anna Rossi" || c.Number != "393331111111" {
+		t.Fatalf("Unexpected contact: %+v", c)
+	}
+	if c := contacts[1]; c.Name != "Luca Bianchi" || c.Number != "393332222222" {
+		t.Fatalf("Unexpected contact: %+v", c)
+	}
+	if len(invalid) != 1 || invalid[0].Line != 4 {
+		t.Fatalf("Wanted an invalid entry on row 4, found %v", invalid)
+	}
+}
+
+func TestEncodeVCards(t *testing.T) {
+	contacts := []nexmo.Contact{nexmo.NewContact("393331111111", "Rossi, Anna")}
+	var buf bytes.Buffer
+	if err := nexmo.EncodeVCards(&buf, contacts); err != nil {
+		t.Fatalf("Unexpected encode error: %v", err)
+	}
+	decoded, invalid, err := nexmo.DecodeVCards(&buf)
+	if err != nil || len(invalid) != 0 {
+		t.Fatalf("Unexpected decode error: %v %v", err, invalid)
+	}
+	if len(decoded) != 1 || decoded[0] != contacts[0] {
+		t.Fatalf("Wanted %+v, found %+v", contacts, decoded)
+	}
+}
@@ -0,0 +1,239 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultAllowlistRefresh is how often an IPAllowlist with an
+// URL and without a refresh interval downloads its ranges.
+const DefaultAllowlistRefresh = 24 * time.Hour
+
+// IPAllowlist restricts the webhooks to the addresses nexmo
+// sends them from, as a defense in depth alongside their
+// signatures.
+type IPAllowlist struct {
+	// URL, if set, is where the published ranges are downloaded
+	// from, every Refresh, in addition to the static ones. It
+	// serves either a JSON array of CIDRs or one CIDR per line.
+	URL     string
+	Refresh time.Duration
+	// TrustProxy takes the address of the caller from the last
+	// entry of the X-Forwarded-For header, appended by the
+	// reverse proxy the server is behind.
+	TrustProxy bool
+	Client     *http.Client
+	// Log receives the rejections.
+	Log *log.Logger
+
+	static  []*net.IPNet
+	mu      sync.RWMutex
+	fetched []*net.IPNet
+}
+
+// NewIPAllowlist returns an allowlist of the ranges `cidrs`,
+// which may be single addresses too.
+func NewIPAllowlist(cidrs []string) (*IPAllowlist, error) {
+	nets, err := parseCIDRs(cidrs)
+	if err != nil {
+		return nil, err
+	}
+	return &IPAllowlist{static: nets}, nil
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, v := range cidrs {
+		v = strings.TrimSpace(v)
+		if !strings.Contains(v, "/") {
+			if ip := net.ParseIP(v); ip != nil && ip.To4() != nil {
+				v += "/32"
+			} else {
+				v += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP range: %v", err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// parseRanges decodes the ranges published at an allowlist URL.
+func parseRanges(b []byte) ([]*net.IPNet, error) {
+	var cidrs []string
+	if b = bytes.TrimSpace(b); bytes.HasPrefix(b, []byte("[")) {
+		if err := json.Unmarshal(b, &cidrs); err != nil {
+			return nil, fmt.Errorf("unable to decode IP ranges: %v", err)
+		}
+		return parseCIDRs(cidrs)
+	}
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line != "" {
+			cidrs = append(cidrs, line)
+		}
+	}
+	return parseCIDRs(cidrs)
+}
+
+// Update downloads the ranges published at URL, replacing the
+// ones downloaded before. On error, the previous ones are kept.
+func (l *IPAllowlist) Update(ctx context.Context) error {
+	if l.URL == "" {
+		return nil
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", l.URL, nil)
+	if err != nil {
+		return fmt.Errorf("unable to create IP ranges request: %v", err)
+	}
+	client := l.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to download IP ranges: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to download IP ranges: %v", resp.Status)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("unable to read IP ranges: %v", err)
+	}
+	nets, err := parseRanges(b)
+	if err != nil {
+		return err
+	}
+	if len(nets) == 0 {
+		return fmt.Errorf("no IP ranges published at %s", l.URL)
+	}
+
+	l.mu.Lock()
+	l.fetched = nets
+	l.mu.Unlock()
+	return nil
+}
+
+// Run updates the ranges every Refresh until `ctx` is
+// canceled, starting immediately.
+func (l *IPAllowlist) Run(ctx context.Context) {
+	if l.URL == "" {
+		return
+	}
+	every := l.Refresh
+	if every <= 0 {
+		every = DefaultAllowlistRefresh
+	}
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		if err := l.Update(ctx); err != nil {
+			logger(l.Log).Printf("ip allowlist: %v", err)
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Allowed returns true if `ip` is in one of the ranges.
+func (l *IPAllowlist) Allowed(ip net.IP) bool {
+	for _, n := range l.static {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, n := range l.fetched {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP returns the address of the caller of `r`.
+func (l *IPAllowlist) remoteIP(r *http.Request) net.IP {
+	if l.TrustProxy {
+		if v := r.Header.Get("X-Forwarded-For"); v != "" {
+			hops := strings.Split(v, ",")
+			return net.ParseIP(strings.TrimSpace(hops[len(hops)-1]))
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// isAllowlisted returns true if the route at `p` is restricted
+// by the IPAllowlist: the recording webhooks and the events of
+// the played messages.
+func isAllowlisted(p string) bool {
+	p = path.Clean(p)
+	switch {
+	case strings.HasPrefix(p, "/record/"), strings.HasPrefix(p, "/store/"):
+		return true
+	case strings.HasPrefix(p, "/play/") && strings.HasSuffix(p, "/event"):
+		return true
+	}
+	return false
+}
+
+// Middleware rejects with 403 the webhooks reaching `next`
+// from addresses out of the ranges, leaving the other routes,
+// and the webhooks synthesized by the console, alone.
+func (l *IPAllowlist) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAllowlisted(r.URL.Path) || fromConsole(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if ip := l.remoteIP(r); ip == nil || !l.Allowed(ip) {
+			logger(l.Log).Printf("rejecting %s %s from %s: address not allowed", r.Method, r.URL.Path, r.RemoteAddr)
+			http.Error(w, "address not allowed", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
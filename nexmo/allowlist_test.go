@@ -0,0 +1,59 @@
+package nexmo_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+func TestIPAllowlist(t *testing.T) {
+	ranges := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("# published ranges\n10.1.0.0/16\n2001:db8::/32 # v6\n"))
+	}))
+	defer ranges.Close()
+
+	l, err := nexmo.NewIPAllowlist([]string{"192.0.2.0/24", "198.51.100.7"})
+	if err != nil {
+		t.Fatalf("Unexpected allowlist error: %v", err)
+	}
+	l.URL = ranges.URL
+	if err := l.Update(context.Background()); err != nil {
+		t.Fatalf("Unexpected update error: %v", err)
+	}
+
+	h := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i, v := range []struct {
+		path, addr string
+		want       int
+	}{
+		{"/record/voice/answer", "192.0.2.10:4000", http.StatusOK},
+		{"/store/recording/event", "198.51.100.7:4000", http.StatusOK},
+		{"/store/recording/event", "198.51.100.8:4000", http.StatusForbidden},
+		{"/play/recording/event", "10.1.2.3:4000", http.StatusOK},
+		{"/play/recording/event", "[2001:db8::1]:4000", http.StatusOK},
+		{"/record/voice/event", "203.0.113.1:4000", http.StatusForbidden},
+		{"/play/recording/message.mp3", "203.0.113.1:4000", http.StatusOK},
+		{"/admin/recordings", "203.0.113.1:4000", http.StatusOK},
+	} {
+		r := httptest.NewRequest("POST", v.path, nil)
+		r.RemoteAddr = v.addr
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != v.want {
+			t.Fatalf("%d: Wanted %d, found %d", i, v.want, w.Code)
+		}
+	}
+
+	l.TrustProxy = true
+	r := httptest.NewRequest("POST", "/record/voice/event", nil)
+	r.RemoteAddr = "127.0.0.1:4000"
+	r.Header.Set("X-Forwarded-For", "192.0.2.1, 203.0.113.1")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Wanted the spoofed address to be ignored, found %d", w.Code)
+	}
+}
@@ -0,0 +1,329 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// AnalyticsPeriod is the period the analytics cover when the
+// `since` query parameter is missing.
+const AnalyticsPeriod = 30 * 24 * time.Hour
+
+// CallStats are the outcomes of a set of outbound calls.
+type CallStats struct {
+	Calls      int     `json:"calls"`
+	Answered   int     `json:"answered"`
+	AnswerRate float64 `json:"answer_rate"`
+	// AvgRing is the average number of seconds the answered
+	// calls rang for, when nexmo reported it.
+	AvgRing float64 `json:"avg_ring"`
+
+	rang int
+	ring time.Duration
+}
+
+func (s *CallStats) add(c callOutcome) {
+	s.Calls++
+	if !c.answered {
+		return
+	}
+	s.Answered++
+	if c.ring > 0 {
+		s.rang++
+		s.ring += c.ring
+	}
+}
+
+func (s *CallStats) finish() {
+	if s.Calls > 0 {
+		s.AnswerRate = round(float64(s.Answered) / float64(s.Calls))
+	}
+	if s.rang > 0 {
+		s.AvgRing = round(s.ring.Seconds() / float64(s.rang))
+	}
+}
+
+// ContactStats are the outcomes of the calls to a number.
+type ContactStats struct {
+	Number string `json:"number"`
+	CallStats
+}
+
+// HourStats are the outcomes of the calls placed during an hour
+// of the day, from 0 to 23.
+type HourStats struct {
+	Hour int `json:"hour"`
+	CallStats
+}
+
+// TimeOfDay are the outcomes of a set of calls by the hour of
+// the day they were placed at. BestHour is the one with the
+// highest answer rate, nil if there were no calls.
+type TimeOfDay struct {
+	Hours    []HourStats `json:"hours"`
+	BestHour *int        `json:"best_hour,omitempty"`
+}
+
+// GroupStats are the outcomes of the calls to the members of
+// a group, see GroupStore.
+type GroupStats struct {
+	Group string `json:"group"`
+	TimeOfDay
+}
+
+// Analytics are the outcomes of the outbound calls placed
+// between Since and Until. The hours of the day are in
+// Location.
+type Analytics struct {
+	Since    time.Time      `json:"since"`
+	Until    time.Time      `json:"until"`
+	Location string         `json:"location"`
+	Total    CallStats      `json:"total"`
+	Contacts []ContactStats `json:"contacts"`
+	TimeOfDay
+	Groups []GroupStats `json:"groups"`
+}
+
+// BestHour returns the hour of the day `group` answers the most,
+// or the recipients as a whole when `group` is empty. Returns false
+// if there were no calls to tell.
+func (a Analytics) BestHour(group string) (int, bool) {
+	t := a.TimeOfDay
+	if group != "" {
+		t = TimeOfDay{}
+		for _, v := range a.Groups {
+			if v.Group == group {
+				t = v.TimeOfDay
+			}
+		}
+	}
+	if t.BestHour == nil {
+		return 0, false
+	}
+	return *t.BestHour, true
+}
+
+// callOutcome is what the events of an outbound call tell.
+type callOutcome struct {
+	number   string
+	start    time.Time
+	answered bool
+	ring     time.Duration
+}
+
+// callOutcomes groups `events` by call, returning the outbound
+// calls started between `since` and `until`, oldest first.
+func callOutcomes(since, until time.Time, events []CallEvent) []callOutcome {
+	type call struct {
+		callOutcome
+		ringing, answered time.Time
+	}
+	calls := make(map[string]*call)
+	for _, e := range events {
+		if e.Direction != "outbound" && e.BroadcastID == 0 {
+			continue
+		}
+		c, ok := calls[e.UUID]
+		if !ok {
+			c = &call{callOutcome: callOutcome{start: e.Timestamp}}
+			calls[e.UUID] = c
+		}
+		if c.number == "" {
+			c.number = e.To
+		}
+		if e.Timestamp.Before(c.start) {
+			c.start = e.Timestamp
+		}
+		switch e.Status {
+		case "ringing":
+			if c.ringing.IsZero() {
+				c.ringing = e.Timestamp
+			}
+		case "answered":
+			c.answered = e.Timestamp
+		case "completed":
+			// Calls whose answered event got lost are
+			// still told by their duration.
+			c.callOutcome.answered = c.callOutcome.answered || e.Duration > 0
+		}
+	}
+
+	acc := make([]callOutcome, 0, len(calls))
+	for _, c := range calls {
+		if c.number == "" || c.start.Before(since) || !c.start.Before(until) {
+			continue
+		}
+		if !c.answered.IsZero() {
+			c.callOutcome.answered = true
+			if !c.ringing.IsZero() && c.answered.After(c.ringing) {
+				c.ring = c.answered.Sub(c.ringing)
+			}
+		}
+		acc = append(acc, c.callOutcome)
+	}
+	sort.Slice(acc, func(i, j int) bool { return acc[i].start.Before(acc[j].start) })
+	return acc
+}
+
+// timeOfDay aggregates the calls to the numbers for which `keep`
+// returns true by their hour of the day in `loc`.
+func timeOfDay(calls []callOutcome, loc *time.Location, keep func(string) bool) TimeOfDay {
+	var hours [24]HourStats
+	for _, c := range calls {
+		if keep(c.number) {
+			hours[c.start.In(loc).Hour()].add(c)
+		}
+	}
+	t := TimeOfDay{Hours: []HourStats{}}
+	best := -1
+	for i, v := range hours {
+		if v.Calls == 0 {
+			continue
+		}
+		v.Hour = i
+		v.finish()
+		if best < 0 || v.AnswerRate > t.Hours[best].AnswerRate ||
+			v.AnswerRate == t.Hours[best].AnswerRate && v.Calls > t.Hours[best].Calls {
+			best = len(t.Hours)
+		}
+		t.Hours = append(t.Hours, v)
+	}
+	if best >= 0 {
+		hour := t.Hours[best].Hour
+		t.BestHour = &hour
+	}
+	return t
+}
+
+// NewAnalytics aggregates `events` into the outcomes of the outbound
+// calls started between `since` and `until`, by recipient and by
+// hour of the day in `loc`, UTC if nil. `groups` maps the names of
+// the groups to report to the numbers of their members.
+func NewAnalytics(since, until time.Time, loc *time.Location, events []CallEvent, groups map[string][]string) Analytics {
+	if loc == nil {
+		loc = time.UTC
+	}
+	calls := callOutcomes(since, until, events)
+	a := Analytics{
+		Since:    since,
+		Until:    until,
+		Location: loc.String(),
+		Contacts: []ContactStats{},
+		Groups:   []GroupStats{},
+	}
+	contacts := make(map[string]*ContactStats)
+	for _, c := range calls {
+		a.Total.add(c)
+		s, ok := contacts[c.number]
+		if !ok {
+			s = &ContactStats{Number: c.number}
+			contacts[c.number] = s
+		}
+		s.add(c)
+	}
+	a.Total.finish()
+	for _, v := range contacts {
+		v.finish()
+		a.Contacts = append(a.Contacts, *v)
+	}
+	sort.Slice(a.Contacts, func(i, j int) bool {
+		return a.Contacts[i].Number < a.Contacts[j].Number
+	})
+
+	a.TimeOfDay = timeOfDay(calls, loc, func(string) bool { return true })
+	for name, numbers := range groups {
+		members := make(map[string]bool, len(numbers))
+		for _, v := range numbers {
+			members[v] = true
+		}
+		a.Groups = append(a.Groups, GroupStats{
+			Group:     name,
+			TimeOfDay: timeOfDay(calls, loc, func(n string) bool { return members[n] }),
+		})
+	}
+	sort.Slice(a.Groups, func(i, j int) bool {
+		return a.Groups[i].Group < a.Groups[j].Group
+	})
+	return a
+}
+
+// makeAnalyticsHandler serves the analytics of the calls placed
+// between the `since` and `until` query parameters, in RFC 3339
+// format, the last AnalyticsPeriod if missing. The time of day of
+// the groups in the `group` query parameters, which may be
+// repeated, is reported too when `l` is a GroupStore.
+func makeAnalyticsHandler(l EventLog, loc *time.Location, lg *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		until := time.Now().UTC()
+		since := until.Add(-AnalyticsPeriod)
+		for k, dst := range map[string]*time.Time{"since": &since, "until": &until} {
+			v := r.URL.Query().Get(k)
+			if v == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, k+": "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			*dst = t
+		}
+
+		groups := make(map[string][]string)
+		if names := r.URL.Query()["group"]; len(names) > 0 {
+			g, ok := l.(GroupStore)
+			if !ok {
+				http.Error(w, "groups are not supported by the storage", http.StatusNotImplemented)
+				return
+			}
+			for _, name := range names {
+				members, err := g.GroupMembers(r.Context(), name)
+				if err == ErrNoHistory {
+					http.Error(w, "groups are not supported by the storage", http.StatusNotImplemented)
+					return
+				}
+				if err != nil {
+					logger(lg).Printf("analytics handler: %v", err)
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				groups[name] = []string{}
+				for _, v := range members {
+					groups[name] = append(groups[name], v.Number)
+				}
+			}
+		}
+
+		events, err := l.Events(r.Context(), "")
+		if err == ErrNoHistory {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		if err != nil {
+			logger(lg).Printf("analytics handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(NewAnalytics(since, until, loc, events, groups))
+	}
+}
@@ -0,0 +1,93 @@
+package nexmo_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestAnalytics(t *testing.T) {
+	_, c := newTestClient(t)
+	dir := t.TempDir()
+	db, err := storage.NewSQLite(dir + "/voicebr.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.TODO()
+
+	day := time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC)
+	event := func(uuid, to, status string, at time.Duration) nexmo.CallEvent {
+		return nexmo.CallEvent{UUID: uuid, Status: status, Direction: "outbound", To: to, Timestamp: day.Add(at)}
+	}
+	answered := func(uuid, to string, at, ring time.Duration) []nexmo.CallEvent {
+		done := event(uuid, to, "completed", at+ring+time.Minute)
+		done.Duration = time.Minute
+		return []nexmo.CallEvent{
+			event(uuid, to, "started", at),
+			event(uuid, to, "ringing", at+time.Second),
+			event(uuid, to, "answered", at+time.Second+ring),
+			done,
+		}
+	}
+	var events []nexmo.CallEvent
+	events = append(events, answered("a", "393331111111", 9*time.Hour, 5*time.Second)...)
+	events = append(events, answered("b", "393332222222", 9*time.Hour+30*time.Minute, 2*time.Second)...)
+	events = append(events,
+		event("c", "393331111111", "started", 18*time.Hour),
+		event("c", "393331111111", "ringing", 18*time.Hour+time.Second),
+		event("c", "393331111111", "timeout", 18*time.Hour+time.Minute),
+		event("d", "393332222222", "started", 18*time.Hour+10*time.Minute),
+		event("d", "393332222222", "unanswered", 18*time.Hour+11*time.Minute),
+		// Inbound calls and calls out of the period are left out.
+		nexmo.CallEvent{UUID: "e", Status: "answered", Direction: "inbound", From: "393331111111", Timestamp: day.Add(10 * time.Hour)},
+		event("f", "393331111111", "answered", -time.Hour),
+	)
+	for _, v := range events {
+		if err = db.LogEvent(ctx, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = db.AddContact(ctx, nexmo.BroadcastList, nexmo.NewContact("393331111111", "Anna")); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AddToGroup(ctx, "north", "393331111111"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := nexmo.NewRouter(c, storage.Combined{RecStore: &storage.Local{RootDir: dir}, ContactsStore: db}, c.Origin, nexmo.RouterOptions{})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/admin/analytics?since=2020-03-02T00:00:00Z&until=2020-03-03T00:00:00Z&group=north", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Wanted status 200, found %d", w.Code)
+	}
+	var a nexmo.Analytics
+	if err = json.NewDecoder(w.Body).Decode(&a); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+
+	if a.Total.Calls != 4 || a.Total.Answered != 2 || a.Total.AnswerRate != 0.5 || a.Total.AvgRing != 3.5 {
+		t.Fatalf("Unexpected total: %+v", a.Total)
+	}
+	if len(a.Contacts) != 2 || a.Contacts[0].Number != "393331111111" || a.Contacts[0].AnswerRate != 0.5 || a.Contacts[0].AvgRing != 5 {
+		t.Fatalf("Unexpected contacts: %+v", a.Contacts)
+	}
+	if len(a.Hours) != 2 || a.Hours[0].Hour != 9 || a.Hours[0].AnswerRate != 1 || a.Hours[1].Hour != 18 || a.Hours[1].AnswerRate != 0 {
+		t.Fatalf("Unexpected hours: %+v", a.Hours)
+	}
+	if hour, ok := a.BestHour(""); !ok || hour != 9 {
+		t.Fatalf("Wanted 9 as the best hour, found %d, %v", hour, ok)
+	}
+	if len(a.Groups) != 1 || a.Groups[0].Group != "north" || len(a.Groups[0].Hours) != 2 {
+		t.Fatalf("Unexpected groups: %+v", a.Groups)
+	}
+	if _, ok := a.BestHour("unknown"); ok {
+		t.Fatalf("Wanted no best hour for an unknown group")
+	}
+}
@@ -0,0 +1,201 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// ErrNoAccount is returned by the account APIs when the
+	// client has no API key and secret.
+	ErrNoAccount = errors.New("the account API key and secret are required")
+	// ErrAppNotFound is returned when nexmo does not know
+	// the application.
+	ErrAppNotFound = errors.New("application not found")
+)
+
+// Webhook is an URL nexmo requests, with its method.
+type Webhook struct {
+	Address    string `json:"address"`
+	HTTPMethod string `json:"http_method,omitempty"`
+}
+
+// VoiceWebhooks are the webhooks of the voice capability.
+type VoiceWebhooks struct {
+	AnswerURL         *Webhook `json:"answer_url,omitempty"`
+	FallbackAnswerURL *Webhook `json:"fallback_answer_url,omitempty"`
+	EventURL          *Webhook `json:"event_url,omitempty"`
+}
+
+// VoiceCapability enables the calls of an application.
+type VoiceCapability struct {
+	Webhooks VoiceWebhooks `json:"webhooks"`
+}
+
+// Capabilities are the APIs an application is enabled to use.
+type Capabilities struct {
+	Voice *VoiceCapability `json:"voice,omitempty"`
+}
+
+// AppKeys are the keys of an application. nexmo returns the
+// private key only when it generates the pair, on creation.
+type AppKeys struct {
+	PublicKey  string `json:"public_key,omitempty"`
+	PrivateKey string `json:"private_key,omitempty"`
+}
+
+// Application is a nexmo application, as served by the
+// Applications API.
+type Application struct {
+	ID           string       `json:"id,omitempty"`
+	Name         string       `json:"name"`
+	Capabilities Capabilities `json:"capabilities"`
+	Keys         AppKeys      `json:"keys"`
+}
+
+// SetVoiceWebhooks points the voice webhooks of `a` to the
+// router served at `origin`, enabling the voice capability.
+func (a *Application) SetVoiceWebhooks(origin string) {
+	if a.Capabilities.Voice == nil {
+		a.Capabilities.Voice = &VoiceCapability{}
+	}
+	a.Capabilities.Voice.Webhooks.AnswerURL = &Webhook{Address: origin + "/record/voice/answer", HTTPMethod: "GET"}
+	a.Capabilities.Voice.Webhooks.EventURL = &Webhook{Address: origin + "/record/voice/event", HTTPMethod: "POST"}
+}
+
+// accountHeader returns the header authenticating the requests
+// to the account APIs, which do not accept application tokens.
+func (c *Client) accountHeader() (http.Header, error) {
+	if c.APIKey == "" || c.APISecret == "" {
+		return nil, ErrNoAccount
+	}
+	auth := base64.StdEncoding.EncodeToString([]byte(c.APIKey + ":" + c.APISecret))
+	return http.Header{"Authorization": {"Basic " + auth}}, nil
+}
+
+// doApplication performs `method` on the application at `path`,
+// sending `a` if not nil, and decodes the one returned.
+func (c *Client) doApplication(ctx context.Context, l *Limiter, method, path string, a *Application) (Application, error) {
+	header, err := c.accountHeader()
+	if err != nil {
+		return Application{}, err
+	}
+	var buf bytes.Buffer
+	if a != nil {
+		if err := json.NewEncoder(&buf).Encode(a); err != nil {
+			return Application{}, fmt.Errorf("unable to encode application: %v", err)
+		}
+	}
+	resp, err := c.doPaced(ctx, l, method, c.BaseURL+path, &buf, header)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if apiStatus(err) == http.StatusNotFound {
+		return Application{}, ErrAppNotFound
+	}
+	if err != nil {
+		return Application{}, fmt.Errorf("application: %w", err)
+	}
+	var app Application
+	if err := json.NewDecoder(resp.Body).Decode(&app); err != nil {
+		return Application{}, fmt.Errorf("application: unable to decode response: %v", err)
+	}
+	return app, nil
+}
+
+// CreateApplication creates `a`, returning it as created. Unless
+// `a` has a public key, nexmo generates the key pair, returning
+// the private key in its Keys, the only time it is available.
+func (c *Client) CreateApplication(ctx context.Context, a Application) (Application, error) {
+	a.ID = ""
+	return c.doApplication(ctx, CallLimiter, "POST", "/v2/applications", &a)
+}
+
+// Applications returns the applications of the account, up to
+// the first 100.
+func (c *Client) Applications(ctx context.Context) ([]Application, error) {
+	header, err := c.accountHeader()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.doPaced(ctx, GetLimiter, "GET", c.BaseURL+"/v2/applications?page_size=100", nil, header)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("applications: %w", err)
+	}
+	var page struct {
+		Embedded struct {
+			Applications []Application `json:"applications"`
+		} `json:"_embedded"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("applications: unable to decode response: %v", err)
+	}
+	return page.Embedded.Applications, nil
+}
+
+// Application returns the application of the client.
+func (c *Client) Application(ctx context.Context) (Application, error) {
+	return c.doApplication(ctx, GetLimiter, "GET", "/v2/applications/"+c.AppID, nil)
+}
+
+// UpdateApplication replaces the application of the client
+// with `a`, returning it as updated.
+func (c *Client) UpdateApplication(ctx context.Context, a Application) (Application, error) {
+	a.ID = ""
+	return c.doApplication(ctx, CallLimiter, "PUT", "/v2/applications/"+c.AppID, &a)
+}
+
+// RotateAppKey replaces the key pair of the application of the
+// client with a new one, which the client signs its tokens with
+// from then on. It returns the new private key, PEM encoded, which
+// has to be stored in place of the old one: the tokens signed with
+// the latter are refused once the rotation is done. It must not be
+// called while the client is placing calls.
+func (c *Client) RotateAppKey(ctx context.Context) ([]byte, error) {
+	app, err := c.Application(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("rotate key: %v", err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("rotate key: %v", err)
+	}
+	app.Keys = AppKeys{PublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}))}
+	if _, err = c.UpdateApplication(ctx, app); err != nil {
+		return nil, err
+	}
+	c.key = key
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), nil
+}
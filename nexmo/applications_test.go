@@ -0,0 +1,91 @@
+package nexmo_test
+
+import (
+	"context"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/nexmo/nexmotest"
+)
+
+func TestClient_UpdateApplication(t *testing.T) {
+	srv, c := newTestClient(t)
+	if _, err := c.Application(context.TODO()); err != nexmo.ErrAppNotFound {
+		t.Fatalf("Wanted %v, found %v", nexmo.ErrAppNotFound, err)
+	}
+	srv.AddApplication(nexmo.Application{ID: "app", Name: "voicebr", Keys: nexmo.AppKeys{PublicKey: "pub"}})
+
+	app, err := c.Application(context.TODO())
+	if err != nil {
+		t.Fatalf("Unexpected application error: %v", err)
+	}
+	app.SetVoiceWebhooks("https://abc.loca.lt")
+	if app, err = c.UpdateApplication(context.TODO(), app); err != nil {
+		t.Fatalf("Unexpected update error: %v", err)
+	}
+	stored, _ := srv.Application("app")
+	hooks := stored.Capabilities.Voice
+	if hooks == nil || hooks.Webhooks.AnswerURL.Address != "https://abc.loca.lt/record/voice/answer" || hooks.Webhooks.EventURL.HTTPMethod != "POST" {
+		t.Fatalf("Unexpected voice capability: %+v", hooks)
+	}
+	if stored.Name != "voicebr" || stored.Keys.PublicKey != "pub" || app.ID != "app" {
+		t.Fatalf("Wanted the rest of the application to be kept, found %+v", stored)
+	}
+
+	c.APISecret = ""
+	if _, err = c.Application(context.TODO()); err != nexmo.ErrNoAccount {
+		t.Fatalf("Wanted %v, found %v", nexmo.ErrNoAccount, err)
+	}
+	c.APISecret = "wrong"
+	if _, err = c.Application(context.TODO()); err == nil {
+		t.Fatalf("Wanted the wrong credentials to be refused")
+	}
+}
+
+func TestClient_CreateApplication(t *testing.T) {
+	srv, _ := newTestClient(t)
+	c := nexmo.NewAccountClient(nexmotest.APIKey, nexmotest.APISecret)
+	c.BaseURL = srv.URL
+
+	a := nexmo.Application{Name: "voicebr"}
+	a.SetVoiceWebhooks("https://voicebr.example.com")
+	app, err := c.CreateApplication(context.TODO(), a)
+	if err != nil {
+		t.Fatalf("Unexpected create error: %v", err)
+	}
+	if app.ID == "" || app.Keys.PrivateKey == "" {
+		t.Fatalf("Wanted the application to be created with a key pair, found %+v", app)
+	}
+	// The returned private key signs the tokens of the application.
+	if _, err = nexmo.NewClientFromConfig(nexmo.Config{AppID: app.ID, PrivateKey: []byte(app.Keys.PrivateKey), Number: "393339999999"}); err != nil {
+		t.Fatalf("Unexpected client error: %v", err)
+	}
+
+	apps, err := c.Applications(context.TODO())
+	if err != nil || len(apps) != 1 || apps[0].ID != app.ID || apps[0].Keys.PrivateKey != "" {
+		t.Fatalf("Wanted the application to be listed without its private key, found %+v, %v", apps, err)
+	}
+}
+
+func TestClient_RotateAppKey(t *testing.T) {
+	srv, c := newTestClient(t)
+	srv.AddApplication(nexmo.Application{ID: "app", Name: "voicebr", Keys: nexmo.AppKeys{PublicKey: "old"}})
+
+	key, err := c.RotateAppKey(context.TODO())
+	if err != nil {
+		t.Fatalf("Unexpected rotate error: %v", err)
+	}
+	priv, err := jwt.ParseRSAPrivateKeyFromPEM(key)
+	if err != nil {
+		t.Fatalf("Unexpected private key error: %v", err)
+	}
+	app, _ := srv.Application("app")
+	pub, err := jwt.ParseRSAPublicKeyFromPEM([]byte(app.Keys.PublicKey))
+	if err != nil {
+		t.Fatalf("Unexpected public key error: %v", err)
+	}
+	if !pub.Equal(&priv.PublicKey) {
+		t.Fatalf("Wanted the public key of the new pair to be stored")
+	}
+}
@@ -0,0 +1,232 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// AudioFrameSize is the size of the audio frames sent to nexmo:
+// 20ms of RelayContentType audio.
+const AudioFrameSize = 640
+
+// audioFrameDuration is the audio length of AudioFrameSize bytes.
+const audioFrameDuration = 20 * time.Millisecond
+
+// ErrAudioBusy is returned when playing into a stream that
+// is already playing.
+var ErrAudioBusy = errors.New("audio stream is already playing")
+
+// audioAction returns the connect NCCO action connecting the
+// call to the audio source `stream`.
+func audioAction(origin string, urlKey []byte, stream string, ctx ConnectContext) map[string]interface{} {
+	return websocketAction(origin, urlKey, "/ws/audio/"+stream, ctx)
+}
+
+// AudioSources are named streams of audio generated by other
+// programs, e.g. alerts, which calls are connected to through
+// nexmo's websocket connect action. Every connected call hears
+// the same audio, from when it connects on.
+type AudioSources struct {
+	Log *log.Logger
+
+	mu      sync.Mutex
+	streams map[string]*relayStream
+}
+
+// NewAudioSources returns an empty set of audio sources.
+func NewAudioSources() *AudioSources {
+	return &AudioSources{streams: make(map[string]*relayStream)}
+}
+
+// open returns the stream `name`, creating it if needed. A new
+// stream is closed unless something plays into it within
+// RelayWait.
+func (a *AudioSources) open(name string) *relayStream {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if st, ok := a.streams[name]; ok {
+		return st
+	}
+	st := &relayStream{
+		done:      make(chan struct{}),
+		listeners: make(map[chan []byte]bool),
+	}
+	a.streams[name] = st
+	time.AfterFunc(RelayWait, func() {
+		st.mu.Lock()
+		started := st.started
+		st.mu.Unlock()
+		if !started {
+			logger(a.Log).Printf("audio: nothing played into %s, closing", name)
+			a.close(name, st)
+		}
+	})
+	return st
+}
+
+// close closes `st`, disconnecting its listeners, if it still
+// is the stream `name`.
+func (a *AudioSources) close(name string, st *relayStream) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.streams[name] != st {
+		return
+	}
+	delete(a.streams, name)
+	close(st.done)
+}
+
+// Play sends the RelayContentType audio read from `r` to the
+// calls connected to `name`, in real time, until `r` is over.
+// The calls are disconnected from the stream afterwards. Only
+// one source at a time can play into a stream, ErrAudioBusy is
+// returned otherwise.
+func (a *AudioSources) Play(ctx context.Context, name string, r io.Reader) error {
+	st := a.open(name)
+	if !st.start() {
+		return ErrAudioBusy
+	}
+	defer a.close(name, st)
+
+	ticker := time.NewTicker(audioFrameDuration)
+	defer ticker.Stop()
+	for {
+		frame := make([]byte, AudioFrameSize)
+		n, err := io.ReadFull(r, frame)
+		if n > 0 {
+			// The last frame is padded with silence.
+			st.publish(frame, false)
+		}
+		switch {
+		case err == io.EOF, err == io.ErrUnexpectedEOF:
+			return nil
+		case err != nil:
+			return err
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// makeAudioHandler serves the websockets connecting the calls
+// to the audio sources, implementing nexmo's side of the audio
+// over websocket protocol.
+func makeAudioHandler(a *AudioSources, urlKey []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := VerifyQuery(urlKey, r.URL.Path, r.URL.Query()); err != nil {
+			logger(a.Log).Printf("audio handler: %v", err)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		st := a.open(mux.Vars(r)["stream"])
+		ch := st.listen()
+		defer st.unlisten(ch)
+		conn, err := upgradeWS(w, r)
+		if err != nil {
+			logger(a.Log).Printf("audio handler: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer conn.Close()
+		relayListenerLoop(conn, st, ch)
+	}
+}
+
+// makePlayAudioHandler plays the request body, RelayContentType
+// audio, into the stream in the path, answering once it is over.
+func makePlayAudioHandler(a *AudioSources) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if v := r.Header.Get("content-type"); v != "" {
+			mt, params, err := mime.ParseMediaType(v)
+			if err != nil || (mt != "application/octet-stream" && (mt != "audio/l16" || params["rate"] != "16000")) {
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				return
+			}
+		}
+		name := mux.Vars(r)["stream"]
+		err := a.Play(r.Context(), name, r.Body)
+		switch {
+		case err == ErrAudioBusy:
+			w.WriteHeader(http.StatusConflict)
+			return
+		case err != nil:
+			logger(a.Log).Printf("play audio handler: %s: %v", name, err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// makeAudioBroadcastHandler calls the members of the `group`
+// query parameter, or the broadcast list if missing, connecting
+// them to the stream in the path. The `from` query parameter
+// selects the number they are called from.
+func makeAudioBroadcastHandler(s Storage, c *Client, a *AudioSources) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		group := r.URL.Query().Get("group")
+		by := "anonymous"
+		if p, ok := PrincipalFromContext(r.Context()); ok {
+			if !p.CanBroadcastTo(group) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			by = p.Name
+		}
+		from, ok := fromQuery(w, r, c)
+		if !ok {
+			return
+		}
+
+		contacts, err := RecipientsOf(r.Context(), s, group, c.Log)
+		switch {
+		case err == ErrNoHistory:
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		case err != nil:
+			c.logger().Printf("audio broadcast handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		b := Broadcast{Audio: mux.Vars(r)["stream"], From: from, RequestedBy: by}
+		a.open(b.Audio)
+		go func() {
+			report := c.broadcast(context.Background(), s, b, contacts)
+			c.logger().Printf("call: broadcast of audio %s done, succeeded: %d, failed: %d", b.Audio, report.Succeeded, report.Failed)
+		}()
+		c.logger().Printf("audio broadcast handler: calling %d contacts into %s, requested by %s", len(contacts), b.Audio, by)
+
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(b)
+	}
+}
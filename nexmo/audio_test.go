@@ -0,0 +1,81 @@
+package nexmo_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/nexmo/nexmotest"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestAudioSources(t *testing.T) {
+	srv, c := newTestClient(t)
+
+	dir := t.TempDir()
+	ioutil.WriteFile(dir+"/contacts.csv", []byte("393331111111,Anna\n"), 0644)
+	s := &storage.Local{RootDir: dir}
+
+	var h http.Handler
+	voicebr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r)
+	}))
+	defer voicebr.Close()
+	c.Origin = voicebr.URL
+	h = nexmo.NewRouter(c, s, c.Origin, nexmo.RouterOptions{AudioSources: nexmo.NewAudioSources()})
+
+	resp, err := http.Post(voicebr.URL+"/admin/audio/alerts/broadcast", "", nil)
+	if err != nil {
+		t.Fatalf("Unexpected broadcast error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Wanted status %d, found %s", http.StatusAccepted, resp.Status)
+	}
+	calls := srv.WaitCalls(1, waitTimeout)
+	if len(calls) != 1 || len(calls[0].NCCO) != 1 || calls[0].NCCO[0]["action"] != "connect" {
+		t.Fatalf("Wanted the recipient to be connected to the audio source, found %+v", calls)
+	}
+	uri := calls[0].NCCO[0]["endpoint"].([]interface{})[0].(map[string]interface{})["uri"].(string)
+	if !strings.Contains(uri, "/ws/audio/alerts?") {
+		t.Fatalf("Unexpected websocket uri: %s", uri)
+	}
+
+	listener, err := nexmotest.DialWebsocket(uri)
+	if err != nil {
+		t.Fatalf("Unexpected listener error: %v", err)
+	}
+	defer listener.Close()
+
+	pcm := bytes.Repeat([]byte{1}, 2*nexmo.AudioFrameSize+10)
+	resp, err = http.Post(voicebr.URL+"/admin/audio/alerts", nexmo.RelayContentType, bytes.NewReader(pcm))
+	if err != nil {
+		t.Fatalf("Unexpected play error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Wanted status %d, found %s", http.StatusNoContent, resp.Status)
+	}
+	var received []byte
+	for i := 0; i < 3; i++ {
+		data, err := listener.Receive()
+		if err != nil {
+			t.Fatalf("Unexpected receive error: %v", err)
+		}
+		if len(data) != nexmo.AudioFrameSize {
+			t.Fatalf("Wanted frames of %d bytes, found %d", nexmo.AudioFrameSize, len(data))
+		}
+		received = append(received, data...)
+	}
+	if !bytes.Equal(received[:len(pcm)], pcm) || bytes.Count(received[len(pcm):], []byte{0}) != len(received)-len(pcm) {
+		t.Fatalf("Wanted the audio followed by silence, found %v", received)
+	}
+	if _, err = listener.Receive(); err != io.EOF {
+		t.Fatalf("Wanted the listener to be disconnected, found %v", err)
+	}
+}
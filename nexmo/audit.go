@@ -0,0 +1,211 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Audited actions.
+const (
+	AuditRecordingStored = "recording.stored"
+	// AuditRecordingHosted is recorded in place of
+	// AuditRecordingStored when the recording is left on
+	// nexmo, see RouterOptions.Hosted.
+	AuditRecordingHosted = "recording.hosted"
+	// AuditRecordingDuplicate is recorded when a recording
+	// duplicates a recent one, see DuplicateGuard.
+	AuditRecordingDuplicate = "recording.duplicate"
+	AuditBroadcast          = "broadcast.created"
+	// AuditBroadcastCompleted records the outcome of each
+	// recipient of a broadcast, once it is over.
+	AuditBroadcastCompleted = "broadcast.completed"
+	AuditCallAttempt        = "call.attempt"
+	// AuditCallSuppressed is recorded for each recipient of a
+	// broadcast that is not called, as it opted out.
+	AuditCallSuppressed = "call.suppressed"
+	AuditOptOut         = "contact.opt_out"
+	// AuditSubjectErased is recorded when the data stored
+	// about a number is erased on request of its owner.
+	AuditSubjectErased = "subject.erased"
+)
+
+// AuditEntry is a record of the audit log. Each entry contains
+// the hash of the previous one, so that altering, removing or
+// reordering entries breaks the chain.
+type AuditEntry struct {
+	Seq     int64             `json:"seq"`
+	Time    time.Time         `json:"time"`
+	Action  string            `json:"action"`
+	Details map[string]string `json:"details,omitempty"`
+	Prev    string            `json:"prev"`
+	Hash    string            `json:"hash"`
+}
+
+// ComputeHash returns the hash of the entry, Hash excluded.
+func (e AuditEntry) ComputeHash() string {
+	e.Hash = ""
+	// Maps are encoded with sorted keys, hence the
+	// encoding is stable.
+	b, _ := json.Marshal(e)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Chain fills Seq, Prev and Hash of `e` so that it follows `prev`,
+// which is nil for the first entry of the log.
+func (e AuditEntry) Chain(prev *AuditEntry) AuditEntry {
+	e.Seq = 1
+	e.Prev = ""
+	if prev != nil {
+		e.Seq = prev.Seq + 1
+		e.Prev = prev.Hash
+	}
+	e.Hash = e.ComputeHash()
+	return e
+}
+
+// VerifyAudit checks that `entries`, a whole audit log in order,
+// form an unbroken hash chain.
+func VerifyAudit(entries []AuditEntry) error {
+	var prev *AuditEntry
+	for i, v := range entries {
+		want := v.Chain(prev)
+		if v.Seq != want.Seq {
+			return fmt.Errorf("audit entry %d: wanted sequence number %d, found %d", i+1, want.Seq, v.Seq)
+		}
+		if v.Prev != want.Prev {
+			return fmt.Errorf("audit entry %d: previous hash does not match", v.Seq)
+		}
+		if v.Hash != want.Hash {
+			return fmt.Errorf("audit entry %d: hash does not match its contents", v.Seq)
+		}
+		prev = &entries[i]
+	}
+	return nil
+}
+
+// BroadcastAudit returns the entries of `entries` concerning the
+// broadcast `id`, in order. Verify the whole log with VerifyAudit
+// first: the entries of a broadcast alone do not form a chain.
+func BroadcastAudit(entries []AuditEntry, id int64) []AuditEntry {
+	key := strconv.FormatInt(id, 10)
+	acc := []AuditEntry{}
+	for _, v := range entries {
+		if v.Details["broadcast_id"] == key {
+			acc = append(acc, v)
+		}
+	}
+	return acc
+}
+
+// Auditor is an append only log of the relevant actions
+// taken by voicebr.
+type Auditor interface {
+	Audit(ctx context.Context, action string, details map[string]string) error
+}
+
+// AuditReader is implemented by the Auditors able to read their
+// log back.
+type AuditReader interface {
+	// AuditLog returns the whole log, in order.
+	AuditLog(ctx context.Context) ([]AuditEntry, error)
+}
+
+func (c *Client) audit(ctx context.Context, action string, details map[string]string) {
+	if c.Audit == nil {
+		return
+	}
+	if err := c.Audit.Audit(ctx, action, details); err != nil {
+		c.logger().Printf("audit error: %v", err)
+	}
+}
+
+// auditCompleted records the outcome of the broadcast of
+// `report`.
+func (c *Client) auditCompleted(ctx context.Context, report *BroadcastReport) {
+	var delivered, undelivered []Contact
+	for _, v := range report.Results {
+		if v.Err == nil {
+			delivered = append(delivered, v.Contact)
+		} else {
+			undelivered = append(undelivered, v.Contact)
+		}
+	}
+	c.audit(ctx, AuditBroadcastCompleted, map[string]string{
+		"broadcast_id": strconv.FormatInt(report.Broadcast.ID, 10),
+		"succeeded":    strconv.Itoa(report.Succeeded),
+		"failed":       strconv.Itoa(report.Failed),
+		"delivered":    joinNumbers(delivered),
+		"undelivered":  joinNumbers(undelivered),
+	})
+}
+
+// joinNumbers returns the numbers of `contacts`, comma separated.
+func joinNumbers(contacts []Contact) string {
+	acc := make([]string, len(contacts))
+	for i, v := range contacts {
+		acc[i] = v.Number
+	}
+	return strings.Join(acc, ",")
+}
+
+// makeBroadcastAuditHandler serves the audit entries of a
+// broadcast, once the whole log has been verified. The hash of
+// the last entry of the log is returned too: comparing it with
+// a copy kept elsewhere proves that the log was not truncated.
+func makeBroadcastAuditHandler(a AuditReader, lg *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		entries, err := a.AuditLog(r.Context())
+		if err != nil {
+			logger(lg).Printf("broadcast audit handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		resp := map[string]interface{}{
+			"verified": true,
+			"entries":  BroadcastAudit(entries, id),
+		}
+		if err = VerifyAudit(entries); err != nil {
+			logger(lg).Printf("broadcast audit handler: the audit log has been tampered with: %v", err)
+			resp["verified"] = false
+			resp["error"] = err.Error()
+		}
+		if len(entries) > 0 {
+			resp["head"] = entries[len(entries)-1].Hash
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
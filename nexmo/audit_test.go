@@ -0,0 +1,85 @@
+package nexmo_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestBroadcastAudit(t *testing.T) {
+	srv, c := newTestClient(t)
+	srv.Fail = func(to string) int {
+		if to == "393332222222" {
+			return http.StatusBadRequest
+		}
+		return 0
+	}
+	dir := t.TempDir()
+	db, err := storage.NewSQLite(dir + "/voicebr.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	a, err := storage.OpenAuditFile(dir + "/audit.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	c.Audit = a
+	c.Policy.MaxAttempts = 1
+
+	contacts := []nexmo.Contact{nexmo.NewContact("393331111111", "Anna"), nexmo.NewContact("393332222222", "Bruno")}
+	var ids []int64
+	for i := 0; i < 2; i++ {
+		report, err := c.CallBroadcast(context.TODO(), db, nexmo.Broadcast{RecName: "rec.mp3", RequestedBy: "ops"}, contacts)
+		if err != nil {
+			t.Fatalf("Unexpected call error: %v", err)
+		}
+		ids = append(ids, report.Broadcast.ID)
+	}
+	if b, err := db.Broadcast(context.TODO(), ids[1]); err != nil || b.RequestedBy != "ops" {
+		t.Fatalf("Wanted the initiator to be stored, found %+v, %v", b, err)
+	}
+
+	r := nexmo.NewRouter(c, storage.Combined{RecStore: &storage.Local{RootDir: dir}, ContactsStore: db}, c.Origin, nexmo.RouterOptions{})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/broadcasts/%d/audit", ids[1]), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Wanted status 200, found %d", w.Code)
+	}
+	var resp struct {
+		Verified bool               `json:"verified"`
+		Head     string             `json:"head"`
+		Entries  []nexmo.AuditEntry `json:"entries"`
+	}
+	if err = json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if !resp.Verified || resp.Head == "" {
+		t.Fatalf("Wanted the audit log to be verified, found %+v", resp)
+	}
+
+	// The entries of the first broadcast are left out.
+	actions := []string{nexmo.AuditBroadcast, nexmo.AuditCallAttempt, nexmo.AuditCallAttempt, nexmo.AuditBroadcastCompleted}
+	if len(resp.Entries) != len(actions) {
+		t.Fatalf("Wanted %d entries, found %+v", len(actions), resp.Entries)
+	}
+	for i, v := range resp.Entries {
+		if v.Action != actions[i] {
+			t.Fatalf("Wanted entry %d to be %s, found %s", i, actions[i], v.Action)
+		}
+	}
+	created, completed := resp.Entries[0].Details, resp.Entries[3].Details
+	if created["requested_by"] != "ops" || created["recipients"] != "393331111111,393332222222" || created["rec_name"] != "rec.mp3" {
+		t.Fatalf("Unexpected broadcast entry: %v", created)
+	}
+	if completed["delivered"] != "393331111111" || completed["undelivered"] != "393332222222" {
+		t.Fatalf("Unexpected completion entry: %v", completed)
+	}
+}
@@ -0,0 +1,225 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrUnauthorized is returned by the authenticators when
+// the request does not carry credentials they recognize. It is
+// also wrapped by the *APIError of the requests nexmo refuses
+// with 401 Unauthorized.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Authentication methods.
+const (
+	AuthAPIKey = "api_key"
+	AuthBasic  = "basic"
+	AuthToken  = "token"
+	AuthOIDC   = "oidc"
+)
+
+// Principal identifies the sender of an authenticated request.
+type Principal struct {
+	Name string `json:"name"`
+	// Method is the mechanism that authenticated it,
+	// e.g. AuthAPIKey.
+	Method string `json:"method"`
+	// Scope restricts what the principal may do, nil
+	// meaning that it may do anything.
+	Scope *Scope `json:"scope,omitempty"`
+}
+
+// Authenticator identifies the sender of an admin request.
+// Other identity providers, e.g. OIDC, are plugged into the
+// router by implementing it.
+type Authenticator interface {
+	// Authenticate returns ErrUnauthorized if `r` does not
+	// carry valid credentials.
+	Authenticate(r *http.Request) (Principal, error)
+}
+
+// challenger is implemented by the authenticators that want
+// to tell the client how to authenticate, through the
+// WWW-Authenticate header of the 401 responses.
+type challenger interface {
+	Challenge() string
+}
+
+// loginRedirector is implemented by the authenticators that log
+// the browsers in through a page of their own, e.g. OIDC.
+type loginRedirector interface {
+	LoginURL(r *http.Request) string
+}
+
+// APIKeys authenticates the requests carrying one of its keys,
+// either in the X-API-Key header or as a bearer token. Each
+// key is mapped to the name of its holder.
+type APIKeys map[string]string
+
+// credential returns the key found either in the X-API-Key
+// header or as a bearer token, if any.
+func credential(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return ""
+	}
+	return strings.TrimPrefix(auth, "Bearer ")
+}
+
+func (k APIKeys) Authenticate(r *http.Request) (Principal, error) {
+	key := credential(r)
+	if key == "" {
+		return Principal{}, ErrUnauthorized
+	}
+
+	// Compare against every key, to avoid leaking which
+	// prefix matched through the response time.
+	var p Principal
+	for k, name := range k {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			p = Principal{Name: name, Method: AuthAPIKey}
+		}
+	}
+	if p.Name == "" {
+		return Principal{}, ErrUnauthorized
+	}
+	return p, nil
+}
+
+// BasicAuth authenticates the requests through HTTP basic
+// authentication. It maps each user to the bcrypt hash of
+// its password, as generated by `htpasswd -nB`.
+type BasicAuth map[string]string
+
+func (b BasicAuth) Authenticate(r *http.Request) (Principal, error) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return Principal{}, ErrUnauthorized
+	}
+	hash, ok := b[user]
+	if !ok {
+		return Principal{}, ErrUnauthorized
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)); err != nil {
+		return Principal{}, ErrUnauthorized
+	}
+	return Principal{Name: user, Method: AuthBasic}, nil
+}
+
+func (b BasicAuth) Challenge() string {
+	return `Basic realm="voicebr", charset="UTF-8"`
+}
+
+// AnyAuthenticator accepts the requests accepted by at least
+// one of its authenticators, tried in order. An empty one
+// refuses every request. When refused, the first error other
+// than ErrUnauthorized, if any, is returned.
+type AnyAuthenticator []Authenticator
+
+func (a AnyAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	var failed error
+	for _, v := range a {
+		p, err := v.Authenticate(r)
+		switch {
+		case err == nil:
+			return p, nil
+		case err != ErrUnauthorized && failed == nil:
+			failed = err
+		}
+	}
+	if failed != nil {
+		return Principal{}, failed
+	}
+	return Principal{}, ErrUnauthorized
+}
+
+func (a AnyAuthenticator) Challenge() string {
+	for _, v := range a {
+		if c, ok := v.(challenger); ok {
+			return c.Challenge()
+		}
+	}
+	return ""
+}
+
+func (a AnyAuthenticator) LoginURL(r *http.Request) string {
+	for _, v := range a {
+		if l, ok := v.(loginRedirector); ok {
+			return l.LoginURL(r)
+		}
+	}
+	return ""
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of `ctx` carrying `p`, for the
+// transports other than HTTP authenticating their requests.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the Principal of the
+// authenticated request `ctx` belongs to, if any.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// RequireAuth only lets through the requests authenticated by
+// `a`, adding their Principal to the request context.
+func RequireAuth(a Authenticator, next http.Handler) http.Handler {
+	return requireAuth(a, next, nil)
+}
+
+// requireAuth is RequireAuth, logging the authentication errors
+// to `lg`.
+func requireAuth(a Authenticator, next http.Handler, lg *log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := a.Authenticate(r)
+		if err != nil {
+			if err != ErrUnauthorized {
+				logger(lg).Printf("authenticate: %v", err)
+			}
+			// Browsers are sent to the login page, if any.
+			if l, ok := a.(loginRedirector); ok && r.Method == "GET" && strings.Contains(r.Header.Get("Accept"), "text/html") {
+				if u := l.LoginURL(r); u != "" {
+					http.Redirect(w, r, u, http.StatusFound)
+					return
+				}
+			}
+			if c, ok := a.(challenger); ok && c.Challenge() != "" {
+				w.Header().Set("WWW-Authenticate", c.Challenge())
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	})
+}
@@ -0,0 +1,88 @@
+package nexmo_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRequireAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := nexmo.AnyAuthenticator{
+		nexmo.APIKeys{"k3y": "ci"},
+		nexmo.BasicAuth{"alice": string(hash)},
+	}
+	r := nexmo.NewRouter(nil, &storage.Local{RootDir: t.TempDir()}, "https://example.com", nexmo.RouterOptions{
+		Console: true,
+		Auth:    auth,
+	})
+
+	tt := []struct {
+		name   string
+		header string
+		value  string
+		code   int
+	}{
+		{"none", "", "", 401},
+		{"api key header", "X-API-Key", "k3y", 200},
+		{"bearer", "Authorization", "Bearer k3y", 200},
+		{"wrong key", "X-API-Key", "key", 401},
+		{"basic", "Authorization", "Basic YWxpY2U6c2VjcmV0", 200},
+		{"wrong password", "Authorization", "Basic YWxpY2U6c2VjcmVU", 401},
+	}
+	for _, v := range tt {
+		req := httptest.NewRequest("GET", "/admin/console", nil)
+		if v.header != "" {
+			req.Header.Set(v.header, v.value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != v.code {
+			t.Fatalf("%s: wanted status %d, found %d", v.name, v.code, w.Code)
+		}
+		if w.Code == 401 && w.Header().Get("WWW-Authenticate") == "" {
+			t.Fatalf("%s: missing basic auth challenge", v.name)
+		}
+	}
+
+	// No credentials at all refuse every request.
+	r = nexmo.NewRouter(nil, &storage.Local{RootDir: t.TempDir()}, "https://example.com", nexmo.RouterOptions{
+		Console: true,
+		Auth:    nexmo.AnyAuthenticator{},
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/admin/console", nil))
+	if w.Code != 401 {
+		t.Fatalf("Wanted status 401, found %d", w.Code)
+	}
+}
+
+func TestRequireAuth_admin(t *testing.T) {
+	c := &nexmo.Client{Queue: nexmo.NewQueue()}
+	r := nexmo.NewRouter(c, &storage.Local{RootDir: t.TempDir()}, "https://example.com", nexmo.RouterOptions{
+		Auth:   nexmo.APIKeys{"k3y": "ci"},
+		Funnel: nexmo.NewFunnel(),
+	})
+
+	for _, path := range []string{"/admin/queue", "/admin/stats"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != 401 {
+			t.Fatalf("%s: wanted status 401, found %d", path, w.Code)
+		}
+
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-API-Key", "k3y")
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != 200 {
+			t.Fatalf("%s: wanted status 200, found %d", path, w.Code)
+		}
+	}
+}
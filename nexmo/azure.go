@@ -0,0 +1,100 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// AzureTTS synthesizes speech with Azure's Speech service.
+type AzureTTS struct {
+	// Key is the subscription key of the Speech resource,
+	// Region its region, e.g. "westeurope".
+	Key    string
+	Region string
+	// Voice is the default voice, e.g. "it-IT-ElsaNeural".
+	Voice string
+	// Client synthesizes the speech, a client with a 10
+	// seconds timeout if nil.
+	Client *http.Client
+}
+
+var defaultTTSClient = &http.Client{Timeout: 10 * time.Second}
+
+type azureSSML struct {
+	XMLName xml.Name `xml:"speak"`
+	Version string   `xml:"version,attr"`
+	Lang    string   `xml:"xml:lang,attr"`
+	Voice   struct {
+		Name string `xml:"name,attr"`
+		Text string `xml:",chardata"`
+	} `xml:"voice"`
+}
+
+func (a AzureTTS) Synthesize(ctx context.Context, text, lang, voice string) ([]byte, string, error) {
+	if voice == "" {
+		voice = a.Voice
+	}
+	ssml := azureSSML{Version: "1.0", Lang: lang}
+	ssml.Voice.Name, ssml.Voice.Text = voice, text
+	body, err := xml.Marshal(ssml)
+	if err != nil {
+		return nil, "", fmt.Errorf("azure tts: %v", err)
+	}
+
+	url := fmt.Sprintf("https://%s.tts.speech.microsoft.com/cognitiveservices/v1", a.Region)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, "", fmt.Errorf("azure tts: %v", err)
+	}
+	req.Header.Set("Ocp-Apim-Subscription-Key", a.Key)
+	req.Header.Set("Content-Type", "application/ssml+xml")
+	req.Header.Set("X-Microsoft-OutputFormat", "audio-16khz-128kbitrate-mono-mp3")
+	req.Header.Set("User-Agent", "voicebr")
+	audio, err := doTTS(a.Client, req)
+	if err != nil {
+		return nil, "", fmt.Errorf("azure tts: %v", err)
+	}
+	return audio, "mp3", nil
+}
+
+// doTTS performs `req` with `client`, defaultTTSClient if nil,
+// returning the body of the response.
+func doTTS(client *http.Client, req *http.Request) ([]byte, error) {
+	if client == nil {
+		client = defaultTTSClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s: %s", resp.Status, body)
+	}
+	return body, nil
+}
@@ -0,0 +1,156 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned in place of the requests made while
+// the API is considered unavailable, see Breaker.
+var ErrCircuitOpen = errors.New("nexmo API unavailable: circuit breaker open after consecutive failures")
+
+// DefaultBreakerCooldown is the cooldown of the breakers
+// that do not set one.
+const DefaultBreakerCooldown = 30 * time.Second
+
+// Breaker stops the requests to the API once Threshold of them
+// in a row failed, with either a network error or a server error.
+// Once open, the requests fail with ErrCircuitOpen until Cooldown
+// elapses. A single request is then let through to probe the API:
+// the breaker closes if it succeeds, and stays open for another
+// Cooldown otherwise. A nil Breaker never opens.
+type Breaker struct {
+	Threshold int
+	// Cooldown is DefaultBreakerCooldown if zero.
+	Cooldown time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+}
+
+// NewBreaker returns a breaker opening after `threshold`
+// consecutive failures.
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{Threshold: threshold, Cooldown: cooldown}
+}
+
+func (b *Breaker) cooldown() time.Duration {
+	if b.Cooldown == 0 {
+		return DefaultBreakerCooldown
+	}
+	return b.Cooldown
+}
+
+func (b *Breaker) tripped() bool {
+	return b.Threshold > 0 && b.failures >= b.Threshold
+}
+
+// Open reports whether the requests are being refused.
+func (b *Breaker) Open() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tripped() && time.Since(b.openedAt) < b.cooldown()
+}
+
+// Allow returns ErrCircuitOpen if the request should not be
+// made. Once the cooldown is over, it lets a single request
+// through and restarts the cooldown, so that a probe that
+// never reports back does not keep the breaker open.
+func (b *Breaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.tripped() {
+		return nil
+	}
+	if time.Since(b.openedAt) < b.cooldown() {
+		return ErrCircuitOpen
+	}
+	b.openedAt = time.Now()
+	return nil
+}
+
+// Record reports the outcome of a request let through by
+// Allow, returning true if it opened the breaker.
+func (b *Breaker) Record(failed bool) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failed {
+		b.failures = 0
+		return false
+	}
+	wasOpen := b.tripped()
+	b.failures++
+	if !b.tripped() {
+		return false
+	}
+	b.openedAt = time.Now()
+	return !wasOpen
+}
+
+// apiFailed reports whether the outcome of a request means that
+// the API is unavailable. Requests cancelled by the caller, and
+// those refused for being too many, do not count.
+func apiFailed(ctx context.Context, resp *http.Response, err error) bool {
+	if resp != nil {
+		return resp.StatusCode >= 500
+	}
+	return err != nil && ctx.Err() != context.Canceled
+}
+
+// cancelBody cancels the context of its request once closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// doTimeout performs the request, bounding it by RequestTimeout,
+// response body included.
+func (c *Client) doTimeout(ctx context.Context, method, url string, body io.Reader, header http.Header) (*http.Response, error) {
+	if c.RequestTimeout <= 0 {
+		return c.do(ctx, method, url, body, header)
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.RequestTimeout)
+	resp, err := c.do(ctx, method, url, body, header)
+	if resp == nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = cancelBody{resp.Body, cancel}
+	return resp, err
+}
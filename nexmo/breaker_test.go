@@ -0,0 +1,78 @@
+package nexmo_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestCallContacts_breaker(t *testing.T) {
+	srv, c := newTestClient(t)
+	var (
+		down     int32 = 1
+		attempts int32
+	)
+	srv.Fail = func(to string) int {
+		atomic.AddInt32(&attempts, 1)
+		if atomic.LoadInt32(&down) == 1 {
+			return http.StatusServiceUnavailable
+		}
+		return 0
+	}
+	c.Workers = 1
+	c.Policy = nexmo.DeliveryPolicy{MaxAttempts: 3, RetrySpacing: time.Millisecond}
+	c.Breaker = nexmo.NewBreaker(2, 100*time.Millisecond)
+	s := &storage.Local{RootDir: t.TempDir()}
+	contacts := []nexmo.Contact{
+		nexmo.NewContact("393331111111", "Anna"),
+		nexmo.NewContact("393332222222", "Luca"),
+		nexmo.NewContact("393333333333", "Marco"),
+	}
+
+	// The first contact trips the breaker, the others
+	// are not even tried.
+	report := c.CallContacts(context.TODO(), s, "a.mp3", contacts)
+	if n := atomic.LoadInt32(&attempts); n != 2 {
+		t.Fatalf("Wanted 2 attempts, found %d", n)
+	}
+	for _, v := range report.Results {
+		if v.Err != nexmo.ErrCircuitOpen {
+			t.Fatalf("Wanted %v, found %v", nexmo.ErrCircuitOpen, v.Err)
+		}
+	}
+
+	// Once the cooldown is over, a successful probe
+	// closes the breaker.
+	atomic.StoreInt32(&down, 0)
+	waitFor(t, "the cooldown", func() bool { return !c.Breaker.Open() })
+	if report = c.CallContacts(context.TODO(), s, "a.mp3", contacts); report.Succeeded != 3 {
+		t.Fatalf("Wanted 3 calls, found %+v", report.Results)
+	}
+}
+
+func TestClient_requestTimeout(t *testing.T) {
+	_, c := newTestClient(t)
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hung.Close()
+	c.RequestTimeout = 50 * time.Millisecond
+	c.MaxRetries = 0
+	c.Breaker = nexmo.NewBreaker(1, time.Hour)
+
+	if _, err := c.Get(context.TODO(), hung.URL); err == nil {
+		t.Fatalf("Wanted a timeout error")
+	}
+	if !c.Breaker.Open() {
+		t.Fatalf("Wanted the timeout to open the breaker")
+	}
+	if _, err := c.Get(context.TODO(), hung.URL); err == nil {
+		t.Fatalf("Wanted the request to be refused")
+	}
+}
@@ -0,0 +1,157 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+var (
+	ErrBroadcastNotFound = errors.New("broadcast not found")
+	ErrNoHistory         = errors.New("broadcast history not available")
+)
+
+const (
+	AttemptCreated = "created"
+	AttemptFailed  = "failed"
+)
+
+// Broadcast is a recording sent to the broadcast list.
+type Broadcast struct {
+	ID      int64  `json:"id"`
+	RecName string `json:"rec_name"`
+	// Conference, when set, is the conversation the recipients
+	// are bridged into, where the broadcaster speaks live. The
+	// broadcast has no recording then.
+	Conference string `json:"conference,omitempty"`
+	// Relay, when set, is the stream the broadcaster's speech
+	// is relayed to the recipients through, see Relay. The
+	// speech is stored under RecName once the stream is over.
+	Relay string `json:"relay,omitempty"`
+	// Audio, when set, is the audio source the recipients
+	// are connected to, see AudioSources.
+	Audio string `json:"audio,omitempty"`
+	// HostedURL, when set, is where nexmo hosts the recording,
+	// which is streamed from there instead of the storage, see
+	// RouterOptions.Hosted. It is not persisted.
+	HostedURL string `json:"hosted_url,omitempty"`
+	// From, when set, is the number shown to the recipients,
+	// one of those owned by the client.
+	From string `json:"from,omitempty"`
+	// Priority is either PriorityRoutine, when empty, or
+	// PriorityEmergency, see EmergencyOptions.
+	Priority string `json:"priority,omitempty"`
+	// Lang is the language spoken in the recording, if known,
+	// see Client.LangDetector.
+	Lang string `json:"lang,omitempty"`
+	// RequestedBy is who started the broadcast: the number of
+	// the caller who recorded it, or the principal requesting
+	// it through the API.
+	RequestedBy string `json:"requested_by,omitempty"`
+	// Cost is the estimated cost of the broadcast, when the
+	// client has a CostGuard.
+	Cost      *CostEstimate `json:"cost,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+	// Recipients is the broadcast list as it was when the
+	// broadcast started.
+	Recipients []Recipient `json:"recipients,omitempty"`
+}
+
+// live returns true if `b` connects the recipients to a live
+// session instead of playing a recording.
+func (b Broadcast) live() bool {
+	return b.Conference != "" || b.Relay != "" || b.Audio != ""
+}
+
+// hosted returns true if the recording of `b` is hosted by
+// nexmo rather than stored.
+func (b Broadcast) hosted() bool {
+	return b.HostedURL != ""
+}
+
+// Recipient is a contact of a broadcast list snapshot.
+type Recipient struct {
+	Number string `json:"number"`
+	Name   string `json:"name"`
+	Lang   string `json:"lang,omitempty"`
+	Voice  string `json:"voice,omitempty"`
+}
+
+// Snapshot returns the recipients of `contacts`.
+func Snapshot(contacts []Contact) []Recipient {
+	acc := make([]Recipient, 0, len(contacts))
+	for _, v := range contacts {
+		acc = append(acc, Recipient{
+			Number: v.Number,
+			Name:   v.Name,
+			Lang:   v.Lang,
+			Voice:  v.Voice,
+		})
+	}
+	return acc
+}
+
+// dedupeContacts drops the contacts whose number has already
+// been seen, which would otherwise be called more than once.
+func dedupeContacts(contacts []Contact, lg *log.Logger) []Contact {
+	seen := make(map[string]bool, len(contacts))
+	acc := make([]Contact, 0, len(contacts))
+	for _, v := range contacts {
+		if seen[v.Number] {
+			logger(lg).Printf("call: skipping duplicate contact %s (%s)", v.Number, v.Name)
+			continue
+		}
+		seen[v.Number] = true
+		acc = append(acc, v)
+	}
+	return acc
+}
+
+// CallAttempt is a single attempt of calling a contact
+// during a broadcast.
+type CallAttempt struct {
+	BroadcastID int64     `json:"broadcast_id"`
+	Number      string    `json:"number"`
+	Attempt     int       `json:"attempt"`
+	Status      string    `json:"status"`
+	Err         string    `json:"error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// BroadcastLog is implemented by the storages that are able
+// to keep track of the broadcasts and of their call attempts.
+// When the ContactsProvider passed to Client.Call implements
+// it, the broadcast is recorded.
+type BroadcastLog interface {
+	// CreateBroadcast stores `b` together with its recipients,
+	// returning it with its ID set.
+	CreateBroadcast(ctx context.Context, b Broadcast) (Broadcast, error)
+	LogAttempt(ctx context.Context, a CallAttempt) error
+}
+
+// BroadcastHistory is implemented by the storages that are able
+// to return what was recorded through BroadcastLog.
+type BroadcastHistory interface {
+	// Broadcast returns ErrBroadcastNotFound if `id` is unknown.
+	// Unlike Broadcasts, it returns the recipients too.
+	Broadcast(ctx context.Context, id int64) (Broadcast, error)
+	Broadcasts(ctx context.Context, since time.Time) ([]Broadcast, error)
+	Attempts(ctx context.Context, id int64) ([]CallAttempt, error)
+}
@@ -0,0 +1,151 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize is the default capacity of a RecCache.
+const DefaultCacheSize = 64 << 20
+
+type cachedRec struct {
+	data     []byte
+	meta     RecMeta
+	warmedAt time.Time
+}
+
+// RecCache keeps the recordings being broadcast in memory, so
+// that each recipient starts hearing the message as soon as the
+// call is answered, instead of waiting for the storage backend.
+// When full, the least recently warmed recordings are evicted.
+type RecCache struct {
+	// MaxBytes is the capacity of the cache,
+	// DefaultCacheSize if zero.
+	MaxBytes int64
+	Log      *log.Logger
+
+	mu   sync.Mutex
+	recs map[string]*cachedRec
+	size int64
+}
+
+func NewRecCache(maxBytes int64) *RecCache {
+	return &RecCache{
+		MaxBytes: maxBytes,
+		recs:     make(map[string]*cachedRec),
+	}
+}
+
+func (c *RecCache) maxBytes() int64 {
+	if c.MaxBytes <= 0 {
+		return DefaultCacheSize
+	}
+	return c.MaxBytes
+}
+
+// Warm loads the recording `name` from `s`, if not cached yet.
+// Recordings larger than the whole cache are not cached.
+func (c *RecCache) Warm(ctx context.Context, s RecStore, name string) error {
+	c.mu.Lock()
+	if rec, ok := c.recs[name]; ok {
+		rec.warmedAt = time.Now()
+		c.mu.Unlock()
+		return nil
+	}
+	c.mu.Unlock()
+
+	r, meta, err := s.OpenRec(ctx, name)
+	if err != nil {
+		return fmt.Errorf("warm cache: %v", err)
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("warm cache: unable to read %s: %v", name, err)
+	}
+	if int64(len(data)) > c.maxBytes() {
+		logger(c.Log).Printf("cache: %s is too large to be cached (%d bytes)", name, len(data))
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.recs[name]; ok {
+		return nil
+	}
+	for c.size+int64(len(data)) > c.maxBytes() {
+		c.evictOldest()
+	}
+	c.recs[name] = &cachedRec{data: data, meta: meta, warmedAt: time.Now()}
+	c.size += int64(len(data))
+	logger(c.Log).Printf("cache: %s warmed (%d bytes, %d cached)", name, len(data), c.size)
+	return nil
+}
+
+func (c *RecCache) evictOldest() {
+	var oldest string
+	for k, v := range c.recs {
+		if oldest == "" || v.warmedAt.Before(c.recs[oldest].warmedAt) {
+			oldest = k
+		}
+	}
+	c.size -= int64(len(c.recs[oldest].data))
+	delete(c.recs, oldest)
+}
+
+// Forget evicts the recording `name`, e.g. because it
+// has been deleted. It is a no-op on a nil cache.
+func (c *RecCache) Forget(name string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if rec, ok := c.recs[name]; ok {
+		c.size -= int64(len(rec.data))
+		delete(c.recs, name)
+	}
+}
+
+// Handler serves the cached recordings, handing the others
+// over to `next`. The path of the requests is the recording
+// name, as with RecStore.RecFileHandler.
+func (c *RecCache) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Base(r.URL.Path)
+		c.mu.Lock()
+		rec, ok := c.recs[name]
+		c.mu.Unlock()
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if rec.meta.ContentType != "" {
+			w.Header().Set("Content-Type", rec.meta.ContentType)
+		}
+		http.ServeContent(w, r, name, rec.meta.CreatedAt, bytes.NewReader(rec.data))
+	})
+}
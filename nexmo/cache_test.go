@@ -0,0 +1,55 @@
+package nexmo_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestRecCache(t *testing.T) {
+	ctx := context.Background()
+	s := &storage.Local{RootDir: t.TempDir()}
+	for _, name := range []string{"a.mp3", "b.mp3"} {
+		if _, err := s.WriteRec(ctx, strings.NewReader(strings.Repeat("x", 6)), name, nexmo.RecMeta{}); err != nil {
+			t.Fatalf("Unexpected write error: %v", err)
+		}
+	}
+
+	c := nexmo.NewRecCache(10)
+	misses := 0
+	h := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		misses++
+	}))
+	get := func(name string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/"+name, nil))
+		return w
+	}
+
+	if err := c.Warm(ctx, s, "a.mp3"); err != nil {
+		t.Fatalf("Unexpected warm error: %v", err)
+	}
+	if w := get("a.mp3"); w.Body.String() != "xxxxxx" || misses != 0 {
+		t.Fatalf("Unexpected cached response: %q, misses: %d", w.Body.String(), misses)
+	}
+
+	// Only one recording fits: warming b evicts a.
+	if err := c.Warm(ctx, s, "b.mp3"); err != nil {
+		t.Fatalf("Unexpected warm error: %v", err)
+	}
+	get("a.mp3")
+	if misses != 1 {
+		t.Fatalf("Wanted a.mp3 to be evicted, found %d misses", misses)
+	}
+
+	c.Forget("b.mp3")
+	get("b.mp3")
+	if misses != 2 {
+		t.Fatalf("Wanted b.mp3 to be forgotten, found %d misses", misses)
+	}
+}
@@ -0,0 +1,88 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jecoz/voicebr/phone"
+)
+
+// ErrNumberNotOwned is returned when a broadcast is asked to
+// show a number the client does not own.
+var ErrNumberNotOwned = errors.New("number not owned by the application")
+
+// Owns returns true if `number` is either Number or one
+// of Numbers.
+func (c *Client) Owns(number string) bool {
+	if number == c.Number {
+		return true
+	}
+	for _, v := range c.Numbers {
+		if v == number {
+			return true
+		}
+	}
+	return false
+}
+
+// callerID returns the number shown to `to` when receiving `b`:
+// its From, if set, or the owned number of the recipient's
+// country when CallerIDByCountry is set, or Number.
+func (c *Client) callerID(b Broadcast, to Contact) string {
+	if b.From != "" {
+		return b.From
+	}
+	if !c.CallerIDByCountry {
+		return c.Number
+	}
+	cc := phone.CountryCode(to.Number)
+	if phone.CountryCode(strings.TrimPrefix(c.Number, "+")) == cc {
+		return c.Number
+	}
+	for _, v := range c.Numbers {
+		if phone.CountryCode(v) == cc {
+			return v
+		}
+	}
+	return c.Number
+}
+
+// checkFrom returns ErrNumberNotOwned if `b` shows a number
+// the client does not own.
+func (c *Client) checkFrom(b Broadcast) error {
+	if b.From != "" && !c.Owns(b.From) {
+		return ErrNumberNotOwned
+	}
+	return nil
+}
+
+// fromQuery returns the `from` query parameter of `r`, the number
+// to show to the recipients. When the client does not own it,
+// the request is answered and false is returned.
+func fromQuery(w http.ResponseWriter, r *http.Request, c *Client) (string, bool) {
+	from := r.URL.Query().Get("from")
+	if from != "" && !c.Owns(from) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprintf(w, "%q is not owned by the application\n", from)
+		return "", false
+	}
+	return from, true
+}
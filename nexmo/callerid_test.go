@@ -0,0 +1,49 @@
+package nexmo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestCallerID(t *testing.T) {
+	srv, c := newTestClient(t)
+	s := &storage.Local{RootDir: t.TempDir()}
+	c.Numbers = []string{"33612345678", "14155550100"}
+	c.CallerIDByCountry = true
+
+	contacts := []nexmo.Contact{
+		{Number: "33611111111"},
+		{Number: "14155551111"},
+		{Number: "447700900123"},
+		{Number: "393331111111"},
+	}
+	report := c.CallContacts(context.TODO(), s, "a.mp3", contacts)
+	if report.Failed != 0 {
+		t.Fatalf("Unexpected failures: %+v", report.Results)
+	}
+	want := map[string]string{
+		"33611111111":  "33612345678",
+		"14155551111":  "14155550100",
+		"447700900123": "393339999999",
+		"393331111111": "393339999999",
+	}
+	for _, v := range srv.Calls() {
+		if v.From.Number != want[v.To[0].Number] {
+			t.Fatalf("Wanted %s to be called from %s, found %s", v.To[0].Number, want[v.To[0].Number], v.From.Number)
+		}
+	}
+
+	report, err := c.CallBroadcast(context.TODO(), s, nexmo.Broadcast{RecName: "a.mp3", From: "14155550100"}, contacts[:1])
+	if err != nil {
+		t.Fatalf("Unexpected call error: %v", err)
+	}
+	if calls := srv.Calls(); calls[len(calls)-1].From.Number != "14155550100" {
+		t.Fatalf("Wanted the selected number to be shown, found %s", calls[len(calls)-1].From.Number)
+	}
+	if _, err = c.CallBroadcast(context.TODO(), s, nexmo.Broadcast{RecName: "a.mp3", From: "447700900000"}, contacts); err != nexmo.ErrNumberNotOwned {
+		t.Fatalf("Wanted %v, found %v", nexmo.ErrNumberNotOwned, err)
+	}
+}
@@ -0,0 +1,184 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// CallRequest is the body of POST /v1/calls. Either Answer
+// or NCCO must be set.
+type CallRequest struct {
+	To               []Contact                `json:"to"`
+	From             Contact                  `json:"from"`
+	Answer           []string                 `json:"answer_url,omitempty"`
+	Event            []string                 `json:"event_url,omitempty"`
+	MachineDetection string                   `json:"machine_detection,omitempty"`
+	NCCO             []map[string]interface{} `json:"ncco,omitempty"`
+}
+
+// CallResponse is returned by nexmo when a call is created.
+type CallResponse struct {
+	UUID             string `json:"uuid"`
+	Status           string `json:"status"`
+	Direction        string `json:"direction"`
+	ConversationUUID string `json:"conversation_uuid"`
+}
+
+// CallInfo is the state of a call, as returned by
+// GET /v1/calls/{uuid}.
+type CallInfo struct {
+	UUID             string     `json:"uuid"`
+	ConversationUUID string     `json:"conversation_uuid"`
+	To               Contact    `json:"to"`
+	From             Contact    `json:"from"`
+	Status           string     `json:"status"`
+	Direction        string     `json:"direction"`
+	Rate             string     `json:"rate,omitempty"`
+	Price            string     `json:"price,omitempty"`
+	Duration         string     `json:"duration,omitempty"`
+	StartTime        *time.Time `json:"start_time,omitempty"`
+	EndTime          *time.Time `json:"end_time,omitempty"`
+	Network          string     `json:"network,omitempty"`
+}
+
+// CallFilter selects the calls returned by ListCalls. Zero
+// fields are not applied.
+type CallFilter struct {
+	Status           string
+	DateStart        time.Time
+	DateEnd          time.Time
+	ConversationUUID string
+	PageSize         int
+	RecordIndex      int
+	// Order is either "asc" or "desc".
+	Order string
+}
+
+func (f CallFilter) query() url.Values {
+	q := url.Values{}
+	if f.Status != "" {
+		q.Set("status", f.Status)
+	}
+	if !f.DateStart.IsZero() {
+		q.Set("date_start", f.DateStart.UTC().Format(time.RFC3339))
+	}
+	if !f.DateEnd.IsZero() {
+		q.Set("date_end", f.DateEnd.UTC().Format(time.RFC3339))
+	}
+	if f.ConversationUUID != "" {
+		q.Set("conversation_uuid", f.ConversationUUID)
+	}
+	if f.PageSize > 0 {
+		q.Set("page_size", strconv.Itoa(f.PageSize))
+	}
+	if f.RecordIndex > 0 {
+		q.Set("record_index", strconv.Itoa(f.RecordIndex))
+	}
+	if f.Order != "" {
+		q.Set("order", f.Order)
+	}
+	return q
+}
+
+// CallPage is a page of the calls matching a CallFilter.
+type CallPage struct {
+	Count       int        `json:"count"`
+	PageSize    int        `json:"page_size"`
+	RecordIndex int        `json:"record_index"`
+	Calls       []CallInfo `json:"-"`
+}
+
+// CreateCall places the call described by `r`. When nexmo does
+// not create it, the error is a *CallError.
+func (c *Client) CreateCall(ctx context.Context, r CallRequest) (CallResponse, error) {
+	var cr CallResponse
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(&r); err != nil {
+		return cr, fmt.Errorf("unable to encode ncco: %v", err)
+	}
+
+	req := buf.Bytes()
+	resp, err := c.Post(ctx, c.BaseURL+"/v1/calls", bytes.NewReader(req))
+	if err != nil {
+		return cr, newCallError(req, resp, err)
+	}
+	defer resp.Body.Close()
+
+	if err = json.NewDecoder(resp.Body).Decode(&cr); err != nil {
+		// The call was created anyway: returning an error
+		// would make the caller try again.
+		c.logger().Printf("create call: unable to decode response: %v", err)
+	}
+	return cr, nil
+}
+
+// GetCall returns the state of the call `uuid`, or
+// ErrCallNotFound if nexmo does not know it.
+func (c *Client) GetCall(ctx context.Context, uuid string) (CallInfo, error) {
+	var info CallInfo
+	resp, err := c.Get(ctx, c.BaseURL+"/v1/calls/"+uuid)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if apiStatus(err) == http.StatusNotFound {
+		return info, ErrCallNotFound
+	}
+	if err != nil {
+		return info, fmt.Errorf("unable to get call: %w", err)
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return info, fmt.Errorf("unable to decode call: %v", err)
+	}
+	return info, nil
+}
+
+// ListCalls returns the page of calls selected by `f`.
+func (c *Client) ListCalls(ctx context.Context, f CallFilter) (CallPage, error) {
+	var page struct {
+		CallPage
+		Embedded struct {
+			Calls []CallInfo `json:"calls"`
+		} `json:"_embedded"`
+	}
+	u := c.BaseURL + "/v1/calls"
+	if q := f.query(); len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	resp, err := c.Get(ctx, u)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return page.CallPage, fmt.Errorf("unable to list calls: %w", err)
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return page.CallPage, fmt.Errorf("unable to decode calls: %v", err)
+	}
+	page.CallPage.Calls = page.Embedded.Calls
+	if page.CallPage.Calls == nil {
+		page.CallPage.Calls = []CallInfo{}
+	}
+	return page.CallPage, nil
+}
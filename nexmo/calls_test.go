@@ -0,0 +1,50 @@
+package nexmo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+func TestListCalls(t *testing.T) {
+	_, c := newTestClient(t)
+
+	var created []nexmo.CallResponse
+	for _, v := range []string{"393331111111", "393332222222", "393333333333"} {
+		resp, err := c.CreateCall(context.TODO(), nexmo.CallRequest{
+			To:   []nexmo.Contact{nexmo.NewContact(v, "")},
+			From: nexmo.NewContact("393339999999", ""),
+			NCCO: []map[string]interface{}{{"action": "talk", "text": "ciao"}},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected create error: %v", err)
+		}
+		if resp.UUID == "" || resp.Status != "started" {
+			t.Fatalf("Unexpected create response: %+v", resp)
+		}
+		created = append(created, resp)
+	}
+	if err := c.Hangup(context.TODO(), created[0].UUID); err != nil {
+		t.Fatalf("Unexpected hangup error: %v", err)
+	}
+
+	info, err := c.GetCall(context.TODO(), created[0].UUID)
+	if err != nil {
+		t.Fatalf("Unexpected get error: %v", err)
+	}
+	if info.Status != "completed" || info.To.Number != "393331111111" || info.ConversationUUID != created[0].ConversationUUID {
+		t.Fatalf("Unexpected call info: %+v", info)
+	}
+	if _, err = c.GetCall(context.TODO(), "unknown"); err != nexmo.ErrCallNotFound {
+		t.Fatalf("Wanted ErrCallNotFound, found %v", err)
+	}
+
+	page, err := c.ListCalls(context.TODO(), nexmo.CallFilter{Status: "started", PageSize: 1, RecordIndex: 1})
+	if err != nil {
+		t.Fatalf("Unexpected list error: %v", err)
+	}
+	if page.Count != 2 || len(page.Calls) != 1 || page.Calls[0].UUID != created[2].UUID {
+		t.Fatalf("Unexpected page: %+v", page)
+	}
+}
@@ -0,0 +1,85 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// RecClaimer is implemented by the storages that are able to
+// remember which recordings have been processed, so that the
+// recording events nexmo delivers more than once are skipped,
+// across restarts too.
+type RecClaimer interface {
+	// ClaimRec marks the recording `uuid` as processed,
+	// returning false if it already was within RecClaimTTL.
+	ClaimRec(ctx context.Context, uuid string) (bool, error)
+}
+
+// RecClaimTTL is how long the claims of the recordings are kept
+// by the RecClaimers, after which the recording may be claimed
+// again. nexmo retries the webhooks for much less than that.
+const RecClaimTTL = 24 * time.Hour
+
+// recClaims remembers, in memory, the recordings processed by
+// the router when its storage is not a RecClaimer.
+type recClaims struct {
+	mu sync.Mutex
+	m  map[string]time.Time
+}
+
+func newRecClaims() *recClaims {
+	return &recClaims{m: make(map[string]time.Time)}
+}
+
+func (c *recClaims) ClaimRec(ctx context.Context, uuid string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k, v := range c.m {
+		if now.Sub(v) > RecClaimTTL {
+			delete(c.m, k)
+		}
+	}
+	if _, ok := c.m[uuid]; ok {
+		return false, nil
+	}
+	c.m[uuid] = now
+	return true, nil
+}
+
+// claimRec claims the recording `uuid` in `s`, if it is a
+// RecClaimer able to, or in `fallback` otherwise. If the claim
+// cannot be made, the recording is processed anyway, as a
+// duplicate broadcast is better than a lost one.
+func claimRec(ctx context.Context, s Storage, fallback *recClaims, uuid string, lg *log.Logger) bool {
+	if c, ok := s.(RecClaimer); ok {
+		claimed, err := c.ClaimRec(ctx, uuid)
+		if err == nil {
+			return claimed
+		}
+		if err != ErrNoHistory {
+			logger(lg).Printf("claim recording %s: %v", uuid, err)
+			return true
+		}
+	}
+	claimed, _ := fallback.ClaimRec(ctx, uuid)
+	return claimed
+}
@@ -17,6 +17,7 @@
 package nexmo
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/csv"
@@ -24,12 +25,19 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/google/uuid"
+	"github.com/jecoz/voicebr/phone"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -37,12 +45,113 @@ var (
 	GetLimiter  = NewLimiter(15)
 )
 
+// DefaultBaseURL is the address of nexmo's REST API.
+const DefaultBaseURL = "https://api.nexmo.com"
+
 type Client struct {
 	internal *http.Client
-	AppID    string
-	Number   string
-	Origin   string
-	key      interface{}
+	// BaseURL is the address of the REST API, which
+	// tests may point to a fake implementation.
+	BaseURL string
+	AppID   string
+	// APIKey and APISecret are the credentials of the account,
+	// required by the account APIs, e.g. the Applications API,
+	// which do not accept the application tokens.
+	APIKey    string
+	APISecret string
+	// RestURL is the address of the account REST API, serving
+	// the Numbers API, DefaultRestURL if empty.
+	RestURL string
+	// Number is the number shown to the recipients, unless
+	// a broadcast selects one of Numbers.
+	Number string
+	// Numbers are the other owned numbers a broadcast may
+	// show to its recipients, in E.164 format.
+	Numbers []string
+	// CallerIDByCountry shows to each recipient the owned
+	// number of the recipient's country, if any, to make
+	// the calls look local.
+	CallerIDByCountry bool
+	Origin            string
+	// Policy is the list default delivery policy, merged
+	// with each contact's own policy when calling.
+	Policy DeliveryPolicy
+	// Workers is the number of calls that are placed
+	// concurrently during a broadcast.
+	Workers int
+	// CallTimeout is the deadline of each call attempt,
+	// rate limiter wait included.
+	CallTimeout time.Duration
+	// RequestTimeout, if positive, bounds each attempt of the
+	// API requests, response body included.
+	RequestTimeout time.Duration
+	// Breaker, if set, fails the requests fast while the
+	// API is unavailable. The calls of the broadcasts are
+	// not retried while it is open.
+	Breaker *Breaker
+	// Prompts provides the voice used by Talk.
+	Prompts *PromptBook
+	// Audit, if set, records the broadcasts and their
+	// call attempts.
+	Audit Auditor
+	// URLKey signs the query parameters of the answer and
+	// event URLs of the outbound calls. See SignQuery.
+	URLKey []byte
+	// NCCOLimits are checked before creating each call.
+	NCCOLimits NCCOLimits
+	// MaxRetries is the number of times a request is retried
+	// when nexmo is overloaded, see Get and Post.
+	MaxRetries int
+	// Queue tracks the contacts being dispatched.
+	Queue *Queue
+	// Cache, if set, is warmed with the recording of each
+	// broadcast before the first call is placed.
+	Cache *RecCache
+	// QuietHours defer the calls of the recordings until the
+	// recipients' quiet hours are over. The recipients in
+	// their quiet hours are not called into live sessions.
+	QuietHours QuietHours
+	// Location is the time zone of the contacts that do not
+	// have one, time.Local if nil.
+	Location *time.Location
+	// Notifiers are told about each completed broadcast.
+	Notifiers []Notifier
+	// Costs, if set, keeps the estimated cost of each
+	// broadcast within a budget.
+	Costs *CostGuard
+	// Emergency configures the delivery of the broadcasts
+	// with PriorityEmergency.
+	Emergency EmergencyOptions
+	// Pacer, if set, serializes the calls to each number and
+	// may merge the broadcasts waiting for the same one.
+	Pacer *RecipientPacer
+	// Dispatcher, if set, runs the broadcasts started by the
+	// webhooks on the instance leading the dispatch.
+	Dispatcher *Dispatcher
+	// LangDetector, if set, identifies the language of the
+	// recordings lacking a transcript, which is then used for
+	// the prompts of the recipients without a language.
+	LangDetector LangDetector
+	// Log receives the logs of the client, the standard
+	// logger if nil.
+	Log   *log.Logger
+	key   interface{}
+	langs sync.Map
+}
+
+// logger returns `l`, or the standard logger if nil.
+func logger(l *log.Logger) *log.Logger {
+	if l == nil {
+		return log.Default()
+	}
+	return l
+}
+
+func (c *Client) logger() *log.Logger {
+	if c == nil {
+		return log.Default()
+	}
+	return logger(c.Log)
 }
 
 func NewClient(pKeyR io.Reader, appID, number, origin string) (*Client, error) {
@@ -57,23 +166,55 @@ func NewClient(pKeyR io.Reader, appID, number, origin string) (*Client, error) {
 	}
 
 	return &Client{
-		internal: http.DefaultClient,
-		AppID:    appID,
-		Number:   number,
-		Origin:   origin,
-		key:      key,
+		internal:    &http.Client{Timeout: DefaultRequestTimeout},
+		BaseURL:     DefaultBaseURL,
+		AppID:       appID,
+		Number:      number,
+		Origin:      origin,
+		Policy:      DefaultDeliveryPolicy,
+		Workers:     DefaultWorkers,
+		CallTimeout: 30 * time.Second,
+		Prompts:     NewPromptBook(),
+		NCCOLimits:  DefaultNCCOLimits,
+		MaxRetries:  3,
+		Queue:       NewQueue(),
+		key:         key,
 	}, nil
 }
 
+// NewAccountClient returns a client authenticated only as the
+// account, which is able to use the account APIs, e.g. to create
+// an application, but not to place calls.
+func NewAccountClient(apiKey, apiSecret string) *Client {
+	return &Client{
+		internal:   &http.Client{Timeout: DefaultRequestTimeout},
+		BaseURL:    DefaultBaseURL,
+		APIKey:     apiKey,
+		APISecret:  apiSecret,
+		MaxRetries: 3,
+	}
+}
+
+func (c *Client) prompts() *PromptBook {
+	if c.Prompts == nil {
+		return defaultPromptBook
+	}
+	return c.Prompts
+}
+
+// Token returns a JWT signed with the application private key,
+// valid for TokenTTL, which authenticates the API requests.
 func (c *Client) Token() (string, error) {
 	if c.key == nil {
 		return "", fmt.Errorf("token: found nil key. Use NewClient to create a valid Client")
 	}
+	now := time.Now()
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
 		"alg":            "RS256",
 		"typ":            "JWT",
 		"application_id": c.AppID,
-		"iat":            time.Now().Unix(),
+		"iat":            now.Unix(),
+		"exp":            now.Add(TokenTTL).Unix(),
 		"jti":            uuid.New().String(),
 	})
 
@@ -81,32 +222,119 @@ func (c *Client) Token() (string, error) {
 }
 
 func (c *Client) Get(ctx context.Context, url string) (*http.Response, error) {
-	if err := GetLimiter.Wait(ctx); err != nil {
-		return nil, fmt.Errorf("client: unable to perform Get: %v", err)
+	resp, err := c.doPaced(ctx, GetLimiter, "GET", url, nil, nil)
+	if err != nil {
+		return resp, fmt.Errorf("client: unable to perform Get: %w", err)
 	}
-	return c.Do("GET", url, nil)
+	return resp, nil
 }
 
 func (c *Client) Post(ctx context.Context, url string, body io.Reader) (*http.Response, error) {
-	if err := CallLimiter.Wait(ctx); err != nil {
-		return nil, fmt.Errorf("client: unable to perform Post: %v", err)
+	resp, err := c.doPaced(ctx, CallLimiter, "POST", url, body, nil)
+	if err != nil {
+		return resp, fmt.Errorf("client: unable to perform Post: %w", err)
 	}
-	return c.Do("POST", url, body)
+	return resp, nil
 }
 
-func (c *Client) Do(method, url string, body io.Reader) (*http.Response, error) {
-	token, err := c.Token()
-	if err != nil {
-		return nil, fmt.Errorf("unable to create authorization token: %v", err)
+// doPaced performs the request through `l`. When nexmo answers
+// 429 Too Many Requests, `l` is paused for the time requested by
+// the Retry-After header and the request is retried, as it was
+// not processed. Server errors are retried only for GET requests,
+// which are idempotent. At most MaxRetries retries are made.
+// `header`, if not nil, is added to the request. Each attempt goes
+// through Breaker, failing with ErrCircuitOpen when it is open.
+func (c *Client) doPaced(ctx context.Context, l *Limiter, method, url string, body io.Reader, header http.Header) (*http.Response, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = ioutil.ReadAll(body); err != nil {
+			return nil, fmt.Errorf("unable to read request body: %v", err)
+		}
+	}
+
+	for i := 0; ; i++ {
+		if err := c.Breaker.Allow(); err != nil {
+			return nil, err
+		}
+		if err := l.Wait(ctx); err != nil {
+			return nil, err
+		}
+		resp, err := c.doTimeout(ctx, method, url, bytes.NewReader(payload), header)
+		if c.Breaker.Record(apiFailed(ctx, resp, err)) {
+			c.logger().Printf("client: %d consecutive API failures, refusing requests for %v", c.Breaker.Threshold, c.Breaker.cooldown())
+		}
+		if resp == nil || err == nil || i >= c.MaxRetries {
+			return resp, err
+		}
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || !apiErr.Temporary() {
+			return resp, err
+		}
+		tooMany := errors.Is(err, ErrRateLimited)
+		if !tooMany && method != "GET" {
+			return resp, err
+		}
+		wait, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if !ok {
+			wait = time.Duration(1<<uint(i)) * time.Second
+		}
+		resp.Body.Close()
+
+		c.logger().Printf("client: %s %s: %s, retrying in %v", method, url, resp.Status, wait)
+		if tooMany {
+			l.Pause(wait)
+			continue
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 	}
+}
 
+// retryAfter parses the Retry-After header `v`, which contains
+// either a number of seconds or an HTTP date.
+func retryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func (c *Client) Do(method, url string, body io.Reader) (*http.Response, error) {
+	return c.do(context.Background(), method, url, body, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, url string, body io.Reader, header http.Header) (*http.Response, error) {
 	req, err := http.NewRequest(method, url, body)
 	if err != nil {
 		return nil, fmt.Errorf("unable to make request: %v", err)
 	}
-	req.Header.Set("Authorization", "Bearer "+token)
+	req = req.WithContext(ctx)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if req.Header.Get("Authorization") == "" {
+		token, err := c.Token()
+		if err != nil {
+			return nil, fmt.Errorf("unable to create authorization token: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
 
-	if method == "POST" {
+	if (method == "POST" || method == "PUT") && req.Header.Get("Content-Type") == "" {
 		req.Header.Set("Content-Type", "application/json")
 	}
 
@@ -122,6 +350,17 @@ type Contact struct {
 	Name   string `json:"-"`
 	Type   string `json:"type"`
 	Number string `json:"number"`
+	// Policy overrides the list delivery policy
+	// for this contact.
+	Policy DeliveryPolicy `json:"-"`
+	// Lang and Voice select the language and the
+	// voice used when speaking to this contact.
+	Lang  string `json:"-"`
+	Voice string `json:"-"`
+	// TZ is the IANA time zone of the contact, e.g.
+	// "Europe/Rome", which the quiet hours refer to. The
+	// client's Location is used when empty.
+	TZ string `json:"-"`
 }
 
 func NewContact(num, name string) Contact {
@@ -139,100 +378,523 @@ type ContactsProvider interface {
 
 var ErrCorruptedContacts = errors.New("contacts file read contains corrupted data, thus the result could be partial")
 
-func DecodeContacts(f func(io.Writer) error) ([]Contact, error) {
+// CountryCode is prepended to the national numbers found in
+// the contacts files and in the webhooks, see phone.Normalize.
+var CountryCode string
+
+// ContactError reports an invalid line of a contacts file.
+type ContactError struct {
+	Line int
+	Err  error
+}
+
+func (e *ContactError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// DecodeContacts decodes the contacts produced by `f`. Invalid
+// lines are logged to `lg`, if not nil, and skipped: if there are any, the valid
+// contacts are returned together with ErrCorruptedContacts.
+func DecodeContacts(f func(io.Writer) error, lg *log.Logger) ([]Contact, error) {
+	contacts, invalid, err := ParseContacts(f)
+	if err != nil {
+		return contacts, err
+	}
+	for _, v := range invalid {
+		logger(lg).Printf("decode contacts: discarding %v", v)
+	}
+	if len(invalid) > 0 {
+		return contacts, ErrCorruptedContacts
+	}
+	return contacts, nil
+}
+
+// ParseContacts decodes the contacts produced by `f`, one csv
+// record per line, returning the lines that are not valid
+// separately. Empty lines and lines starting with # are skipped.
+func ParseContacts(f func(io.Writer) error) ([]Contact, []*ContactError, error) {
 	var buf bytes.Buffer
 	if err := f(&buf); err != nil {
-		return []Contact{}, err
+		return []Contact{}, nil, err
 	}
 
-	r := csv.NewReader(&buf)
+	acc := []Contact{}
+	var invalid []*ContactError
+	sc := bufio.NewScanner(&buf)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		c, err := parseContact(text)
+		if err != nil {
+			invalid = append(invalid, &ContactError{Line: line, Err: err})
+			continue
+		}
+		acc = append(acc, c)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, fmt.Errorf("decode contacts: %v", err)
+	}
+	return acc, invalid, nil
+}
 
-	// lines starting with # are considered comments
-	r.Comment = rune('#')
+// parseContact decodes a single csv record: name and number
+// are required, the delivery policy, language, voice and
+// time zone columns are optional.
+func parseContact(line string) (Contact, error) {
+	r := csv.NewReader(strings.NewReader(line))
+	r.FieldsPerRecord = -1
+	rec, err := r.Read()
+	if pe, ok := err.(*csv.ParseError); ok {
+		err = pe.Err
+	}
+	if err != nil {
+		return Contact{}, err
+	}
+	if len(rec) < 2 {
+		return Contact{}, fmt.Errorf("number and name are required, found %d fields", len(rec))
+	}
 
-	recs, err := r.ReadAll()
+	number, err := phone.Normalize(rec[0], CountryCode)
+	if err != nil {
+		return Contact{}, err
+	}
+	policy, err := parsePolicy(rec[2:])
 	if err != nil {
-		return nil, fmt.Errorf("decode contacts: %v", err)
+		return Contact{}, fmt.Errorf("%s: %v", number, err)
+	}
+	c := NewContact(number, rec[1])
+	c.Policy = policy
+	if len(rec) > 5 {
+		c.Lang = rec[5]
+	}
+	if len(rec) > 6 {
+		c.Voice = rec[6]
 	}
+	if len(rec) > 7 && rec[7] != "" {
+		if _, err := time.LoadLocation(rec[7]); err != nil {
+			return Contact{}, fmt.Errorf("%s: %v", number, err)
+		}
+		c.TZ = rec[7]
+	}
+	return c, nil
+}
 
-	acc := make([]Contact, 0, len(recs))
-	for _, rec := range recs {
-		if len(rec) < 2 {
-			// discard record
-			continue
+// EncodeContacts writes `contacts` into `w` using the same csv
+// format understood by DecodeContacts.
+func EncodeContacts(w io.Writer, contacts []Contact) error {
+	cw := csv.NewWriter(w)
+	for _, v := range contacts {
+		rec := append([]string{v.Number, v.Name}, formatPolicy(v.Policy)...)
+		rec = append(rec, v.Lang, v.Voice, v.TZ)
+		// drop the optional columns that are not set
+		for len(rec) > 2 && rec[len(rec)-1] == "" {
+			rec = rec[:len(rec)-1]
 		}
-		acc = append(acc, NewContact(rec[0], rec[1]))
+		if err := cw.Write(rec); err != nil {
+			return fmt.Errorf("encode contacts: %v", err)
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("encode contacts: %v", err)
 	}
-	if len(acc) != len(recs) {
-		return acc, ErrCorruptedContacts
+	return nil
+}
+
+// Call broadcasts `recName` to the contacts of `p`'s broadcast
+// list, blocking until each of them has been processed. The
+// returned report lists the outcome of each contact. If the
+// contacts file is corrupted, the valid contacts are called
+// anyway and both the report and ErrCorruptedContacts are returned.
+func (c *Client) Call(ctx context.Context, p ContactsProvider, recName string) (*BroadcastReport, error) {
+	return c.callList(ctx, p, Broadcast{RecName: recName})
+}
+
+// callList is Call for the broadcast `b`.
+func (c *Client) callList(ctx context.Context, p ContactsProvider, b Broadcast) (*BroadcastReport, error) {
+	contacts, decodeErr := DecodeContacts(p.ReadBroadcastList, c.Log)
+	if decodeErr != nil && decodeErr != ErrCorruptedContacts {
+		return nil, fmt.Errorf("call: %v", decodeErr)
 	}
-	return acc, nil
+
+	c.logger().Printf("client: contacts decoded: %d", len(contacts))
+	report, _ := c.CallBroadcast(ctx, p, b, contacts)
+	return report, decodeErr
 }
 
-func (c *Client) Call(p ContactsProvider, recName string) {
-	contacts, err := DecodeContacts(p.ReadBroadcastList)
+// CallGroup broadcasts `recName` to the members of `group`,
+// like Call does with the whole broadcast list.
+func (c *Client) CallGroup(ctx context.Context, p ContactsProvider, g GroupStore, group, recName string) (*BroadcastReport, error) {
+	contacts, err := g.GroupMembers(ctx, group)
 	if err != nil {
-		if err == ErrCorruptedContacts {
-			log.Printf("call: %v", err)
-		} else {
-			log.Printf("call error: %v", err)
-			return
+		return nil, fmt.Errorf("call group: %v", err)
+	}
+	c.logger().Printf("client: %s group members: %d", group, len(contacts))
+	return c.CallContacts(ctx, p, recName, contacts), nil
+}
+
+// CallContacts broadcasts `recName` to `contacts`, logging the
+// broadcast in `p` if it implements BroadcastLog. The recording
+// is loaded in the client cache if `p` implements RecStore.
+func (c *Client) CallContacts(ctx context.Context, p ContactsProvider, recName string, contacts []Contact) *BroadcastReport {
+	report, _ := c.CallBroadcast(ctx, p, Broadcast{RecName: recName}, contacts)
+	return report
+}
+
+// CallBroadcast is CallContacts for the broadcast `b`, which
+// selects the recording and, optionally, the number shown to
+// the recipients. ErrNumberNotOwned is returned, and nobody is
+// called, if the client does not own that number. ErrOverBudget
+// is returned, together with the report, if the broadcast is
+// refused by the client's CostGuard.
+func (c *Client) CallBroadcast(ctx context.Context, p ContactsProvider, b Broadcast, contacts []Contact) (*BroadcastReport, error) {
+	if err := c.checkFrom(b); err != nil {
+		return nil, err
+	}
+	if err := ValidatePriority(b.Priority); err != nil {
+		return nil, err
+	}
+	if rs, ok := p.(RecStore); ok && c.Cache != nil {
+		if err := c.Cache.Warm(ctx, rs, b.RecName); err != nil {
+			c.logger().Printf("call: %v", err)
 		}
 	}
+	report := c.broadcast(ctx, p, b, contacts)
+	if e := report.Broadcast.Cost; e != nil && e.Refused {
+		return report, ErrOverBudget
+	}
+	return report, nil
+}
 
-	log.Printf("client: contacts decoded: %d", len(contacts))
+// broadcast delivers `b` to `contacts`, logging it in `p`
+// like CallContacts does.
+func (c *Client) broadcast(ctx context.Context, p ContactsProvider, b Broadcast, contacts []Contact) *BroadcastReport {
+	ctx, span := startSpan(ctx, "broadcast", trace.WithAttributes(attrRecName.String(b.RecName)))
+	defer span.End()
+	contacts = dedupeContacts(contacts, c.Log)
+	var suppressed []Contact
+	if l, ok := p.(SuppressionList); ok {
+		var err error
+		if contacts, suppressed, err = suppress(ctx, l, contacts); err != nil && err != ErrNoHistory {
+			c.logger().Printf("call: unable to read the suppression list: %v", err)
+		}
+	}
+	if b.Lang == "" && !b.live() && !b.hosted() {
+		b.Lang = c.recLang(ctx, p, b.RecName)
+	}
+	if c.Costs != nil {
+		var e CostEstimate
+		contacts, e = c.Costs.Limit(contacts)
+		b.Cost = &e
+		if e.Skipped > 0 {
+			c.logger().Printf("call: estimated cost %v, calling %d recipients", e, e.Called)
+		}
+	}
+	blog, _ := p.(BroadcastLog)
+	archive, _ := p.(FailureArchive)
+	b.CreatedAt = time.Now()
+	b.Recipients = Snapshot(contacts)
+	if blog != nil {
+		var err error
+		if b, err = blog.CreateBroadcast(ctx, b); err != nil {
+			c.logger().Printf("call: unable to log broadcast: %v", err)
+			blog = nil
+		}
+	}
+	if u, ok := p.(RecUsage); ok && blog != nil && !b.live() && !b.hosted() {
+		if err := u.UsedRec(ctx, b.RecName, b.ID); err != nil {
+			c.logger().Printf("call: unable to track the usage of %s: %v", b.RecName, err)
+		}
+	}
+	span.SetAttributes(attrBroadcastID.Int64(b.ID), attribute.Int("voicebr.recipients", len(contacts)))
+	details := map[string]string{
+		"broadcast_id": strconv.FormatInt(b.ID, 10),
+		"rec_name":     b.RecName,
+		"contacts":     strconv.Itoa(len(contacts)),
+		"recipients":   joinNumbers(contacts),
+	}
+	if b.RequestedBy != "" {
+		details["requested_by"] = b.RequestedBy
+	}
+	if b.Conference != "" {
+		details["conference"] = b.Conference
+	}
+	if b.Relay != "" {
+		details["relay"] = b.Relay
+	}
+	if b.Audio != "" {
+		details["audio"] = b.Audio
+	}
+	if b.From != "" {
+		details["from"] = b.From
+	}
+	if b.Priority != "" {
+		details["priority"] = b.Priority
+	}
+	if b.Lang != "" {
+		details["lang"] = b.Lang
+	}
+	if e := b.Cost; e != nil {
+		details["estimated_cost"] = strconv.FormatFloat(e.Cost, 'f', -1, 64)
+		if e.Skipped > 0 {
+			details["over_budget"] = strconv.Itoa(e.Skipped)
+		}
+	}
+	c.audit(ctx, AuditBroadcast, details)
+	c.auditSuppressed(ctx, b.ID, suppressed)
+	c.notifyStart(ctx, b)
+	if started, ok := ctx.Value(startedKey{}).(chan Broadcast); ok {
+		started <- b
+	}
+	onAttempt := func(to Contact, i int, err error) {
+		details := map[string]string{
+			"broadcast_id": strconv.FormatInt(b.ID, 10),
+			"number":       to.Number,
+			"attempt":      strconv.Itoa(i),
+			"status":       AttemptCreated,
+		}
+		if err != nil {
+			details["status"] = AttemptFailed
+			details["error"] = err.Error()
+		}
+		c.audit(ctx, AuditCallAttempt, details)
 
-	for _, v := range contacts {
-		go func(contact Contact) {
-			// We can make up to three req/sec. Give it twice as
-			// that time as deadline.
-			n := len(contacts) / 3
-			if n < 1 {
-				n = 1
+		if ce, ok := err.(*CallError); ok && archive != nil {
+			if err := archive.ArchiveFailure(ctx, ce.Failure(b, to, i)); err != nil && err != ErrNoHistory {
+				c.logger().Printf("call: unable to archive failure: %v", err)
 			}
+		}
 
-			d := n * 2
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(d))
-			defer cancel()
+		if blog == nil {
+			return
+		}
+		a := CallAttempt{
+			BroadcastID: b.ID,
+			Number:      to.Number,
+			Attempt:     i,
+			Status:      AttemptCreated,
+			CreatedAt:   time.Now(),
+		}
+		if err != nil {
+			a.Status = AttemptFailed
+			a.Err = err.Error()
+		}
+		if err := blog.LogAttempt(ctx, a); err != nil {
+			c.logger().Printf("call: unable to log attempt: %v", err)
+		}
+	}
 
-			log.Printf("calling %v, message: %v", contact.Name, recName)
-			if err := c.call(ctx, contact, recName); err != nil {
-				log.Printf("call error: %v", err)
-			}
-		}(v)
+	report := CollectResults(c.notifyFailures(ctx, b, c.Dispatch(ctx, contacts, b, onAttempt)))
+	report.Broadcast = b
+	span.SetAttributes(attribute.Int("voicebr.succeeded", report.Succeeded), attribute.Int("voicebr.failed", report.Failed))
+	c.auditCompleted(ctx, report)
+	c.notifyBroadcast(ctx, p, report)
+	return report
+}
+
+// CallAsync runs Call in the background, logging its outcome,
+// or queues it through the client's Dispatcher, if any. It is
+// meant for the webhook handlers, which cannot wait for the
+// whole broadcast to complete.
+func (c *Client) CallAsync(p ContactsProvider, recName string) {
+	c.enqueue(context.Background(), p, broadcastJob{RecName: recName})
+}
+
+// startedKey carries the channel StartBroadcast is told
+// through that its broadcast started.
+type startedKey struct{}
+
+// StartBroadcast runs CallBroadcast in the background, returning
+// `b` as soon as it starts, with its ID set if `p` is a
+// BroadcastLog. Its outcome is logged.
+func (c *Client) StartBroadcast(ctx context.Context, p ContactsProvider, b Broadcast, contacts []Contact) (Broadcast, error) {
+	if err := c.checkFrom(b); err != nil {
+		return b, err
+	}
+	if err := ValidatePriority(b.Priority); err != nil {
+		return b, err
+	}
+	started := make(chan Broadcast, 1)
+	failed := make(chan error, 1)
+	go func() {
+		// The broadcast outlives the request starting it.
+		ctx := context.WithValue(context.Background(), startedKey{}, started)
+		report, err := c.CallBroadcast(ctx, p, b, contacts)
+		if err != nil {
+			c.logger().Printf("call error: %v", err)
+			failed <- err
+			return
+		}
+		c.logger().Printf("call: broadcast of %v done, succeeded: %d, failed: %d", b.RecName, report.Succeeded, report.Failed)
+	}()
+	select {
+	case b = <-started:
+		return b, nil
+	case err := <-failed:
+		return b, err
+	case <-ctx.Done():
+		return b, ctx.Err()
 	}
 }
 
-func (c *Client) call(ctx context.Context, to Contact, recName string) error {
-	var buf bytes.Buffer
-	if err := json.NewEncoder(&buf).Encode(&struct {
-		To     []Contact `json:"to"`
-		From   Contact   `json:"from"`
-		Answer []string  `json:"answer_url"`
-		Event  []string  `json:"event_url"`
-	}{
+// call places a call playing the recording of `b` to `to`, and
+// then the recordings of the broadcasts `then`.
+func (c *Client) call(ctx context.Context, to Contact, b Broadcast, policy DeliveryPolicy, then ...Broadcast) error {
+	// The recipients without a language are spoken to in the
+	// language of the recording.
+	lang := to.Lang
+	if lang == "" {
+		lang = b.Lang
+	}
+	params := CallParams{
+		BroadcastID: b.ID,
+		Number:      to.Number,
+		Lang:        lang,
+		Voice:       to.Voice,
+		Sent:        b.CreatedAt,
+		Hosted:      b.HostedURL,
+	}
+	eventPath := "/play/recording/event"
+	eventURL := c.Origin + eventPath + "?" + SignQuery(c.URLKey, eventPath, params.Values())
+	req := CallRequest{
 		To: []Contact{to},
 		From: Contact{
 			Type:   "phone",
-			Number: c.Number,
+			Number: c.callerID(b, to),
 		},
-		Answer: []string{c.Origin + "/play/recording/" + recName},
-		Event:  []string{c.Origin + "/play/recording/event"},
+		Event:            []string{eventURL},
+		MachineDetection: policy.machineDetection(),
+	}
+
+	p := c.prompts().For(lang, to.Voice)
+	data := PromptData{
+		Lang:            lang,
+		RecName:         b.RecName,
+		BroadcastID:     b.ID,
+		RecipientNumber: to.Number,
+		When:            SpokenTime{Time: b.CreatedAt, Lang: lang},
+	}
+	var ncco []map[string]interface{}
+	if b.live() {
+		ncco = listenNCCO(c.Origin, c.URLKey, p, b, data)
+		req.NCCO = ncco
+	} else {
+		// The NCCO is served by the answer URL, check it now
+		// that the call can still be avoided.
+		answerPath := "/play/recording/" + b.RecName
+		for _, v := range then {
+			params.Then = append(params.Then, v.RecName)
+		}
+		ncco = playNCCO(c.Origin, p, data, 0, params.Then...)
+		req.Answer = []string{c.Origin + answerPath + "?" + SignQuery(c.URLKey, answerPath, params.Values())}
+	}
+	if err := c.NCCOLimits.Validate(ncco); err != nil {
+		return err
+	}
+	for _, v := range append(req.Answer, eventURL) {
+		if err := c.NCCOLimits.ValidateURL(v); err != nil {
+			return err
+		}
+	}
+
+	ctx, span := startSpan(ctx, "call.create", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attrBroadcastID.Int64(b.ID),
+		attrRecName.String(b.RecName),
+	))
+	resp, err := c.CreateCall(ctx, req)
+	span.SetAttributes(attrConversation.String(resp.ConversationUUID))
+	endSpan(span, err)
+	return err
+}
+
+const (
+	NotifySMS  = "sms"
+	NotifyCall = "call"
+)
+
+// Notify delivers `text` to `to`, either through an SMS or
+// through a phone call, depending on `via`.
+func (c *Client) Notify(ctx context.Context, via string, to Contact, text string) error {
+	switch via {
+	case NotifySMS:
+		return c.SendSMS(ctx, to, text)
+	case NotifyCall:
+		return c.Talk(ctx, to, text)
+	default:
+		return fmt.Errorf("notify: unknown channel %q", via)
+	}
+}
+
+// SendSMS sends `text` to `to` through nexmo's messages API.
+func (c *Client) SendSMS(ctx context.Context, to Contact, text string) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(map[string]string{
+		"message_type": "text",
+		"channel":      "sms",
+		"to":           to.Number,
+		"from":         c.Number,
+		"text":         text,
 	}); err != nil {
-		return fmt.Errorf("unable to encode ncco: %v", err)
+		return fmt.Errorf("unable to encode message: %v", err)
 	}
 
-	_, err := c.Post(ctx, "https://api.nexmo.com/v1/calls", &buf)
+	resp, err := c.Post(ctx, c.BaseURL+"/v1/messages", &buf)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
 	if err != nil {
-		return fmt.Errorf("unable to make call: %v", err)
+		return fmt.Errorf("unable to send sms: %w", err)
 	}
+	return nil
+}
 
+// Talk calls `to` and reads `text` out loud.
+func (c *Client) Talk(ctx context.Context, to Contact, text string) error {
+	p := c.prompts().For(to.Lang, to.Voice)
+	ncco := []map[string]interface{}{
+		{
+			"action":    "talk",
+			"voiceName": p.Voice,
+			"level":     p.Level,
+			"text":      text,
+		},
+	}
+	if err := c.NCCOLimits.Validate(ncco); err != nil {
+		return err
+	}
+
+	if _, err := c.CreateCall(ctx, CallRequest{
+		To: []Contact{to},
+		From: Contact{
+			Type:   "phone",
+			Number: c.Number,
+		},
+		NCCO: ncco,
+	}); err != nil {
+		return err
+	}
 	return nil
 }
 
+// checkStatus returns an *APIError if `resp` carries an error
+// status, decoding the error body, which is drained and closed.
 func checkStatus(resp *http.Response) error {
-	if resp.StatusCode == 200 || resp.StatusCode == 201 {
+	if resp.StatusCode == 200 || resp.StatusCode == 201 || resp.StatusCode == 202 || resp.StatusCode == 204 || resp.StatusCode == 206 {
 		return nil
 	}
-	return fmt.Errorf("request failed: %s", resp.Status)
+	e := &APIError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		RequestID:  resp.Header.Get("X-Request-Id"),
+	}
+	if r := resp.Request; r != nil {
+		// The query may carry credentials.
+		u := *r.URL
+		u.RawQuery = ""
+		e.Method, e.URL = r.Method, u.String()
+	}
+	e.readBody(resp)
+	return e
 }
@@ -0,0 +1,215 @@
+package nexmo_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+func readString(s string) func(io.Writer) error {
+	return func(w io.Writer) error {
+		_, err := io.Copy(w, strings.NewReader(s))
+		return err
+	}
+}
+
+func TestDecodeContacts_policy(t *testing.T) {
+	contacts, err := nexmo.DecodeContacts(readString(`# number,name,attempts,spacing,voicemail
+39111,foo
+39222,bar,3,30s,hangup
+39333,baz,,,leave
+39444,bad,x
+`), nil)
+	if err != nexmo.ErrCorruptedContacts {
+		t.Fatalf("Wanted ErrCorruptedContacts, found %v", err)
+	}
+	if len(contacts) != 3 {
+		t.Fatalf("Wanted 3 contacts, found %d", len(contacts))
+	}
+
+	defaults := nexmo.DeliveryPolicy{MaxAttempts: 2, RetrySpacing: time.Minute, Voicemail: nexmo.VoicemailLeave}
+	if p := contacts[0].Policy.Merge(defaults); p != defaults {
+		t.Fatalf("Wanted default policy, found %+v", p)
+	}
+	want := nexmo.DeliveryPolicy{MaxAttempts: 3, RetrySpacing: 30 * time.Second, Voicemail: nexmo.VoicemailHangup}
+	if p := contacts[1].Policy.Merge(defaults); p != want {
+		t.Fatalf("Wanted %+v, found %+v", want, p)
+	}
+	if p := contacts[2].Policy.Merge(defaults); p.MaxAttempts != 2 || p.Voicemail != nexmo.VoicemailLeave {
+		t.Fatalf("Unexpected merged policy: %+v", p)
+	}
+}
+
+func TestEncodeContacts(t *testing.T) {
+	c := nexmo.NewContact("39222", "bar")
+	c.Policy = nexmo.DeliveryPolicy{MaxAttempts: 3}
+	c.Lang = "en-GB"
+	contacts := []nexmo.Contact{nexmo.NewContact("39111", "foo"), c}
+
+	var buf bytes.Buffer
+	if err := nexmo.EncodeContacts(&buf, contacts); err != nil {
+		t.Fatalf("Unexpected encode error: %v", err)
+	}
+	decoded, err := nexmo.DecodeContacts(readString(buf.String()), nil)
+	if err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if len(decoded) != 2 || decoded[1].Policy != c.Policy || decoded[1].Lang != "en-GB" {
+		t.Fatalf("Unexpected round trip result: %+v", decoded)
+	}
+}
+
+func TestPromptsFor(t *testing.T) {
+	if p := nexmo.PromptsFor("en-GB", ""); p.Recorded != "Recorded message" {
+		t.Fatalf("Unexpected english prompts: %+v", p)
+	}
+	if p := nexmo.PromptsFor("xx", "Giorgio"); p.Recorded != "Messaggio registrato" || p.Voice != "Giorgio" {
+		t.Fatalf("Unexpected fallback prompts: %+v", p)
+	}
+}
+
+func TestPromptBook_Set(t *testing.T) {
+	book := nexmo.NewPromptBook()
+	if err := book.Set("it", nexmo.Prompts{Greeting: "Ciao {{.CallerName}}, parla pure"}); err != nil {
+		t.Fatalf("Unexpected set error: %v", err)
+	}
+	p := book.For("it", "")
+	if p.Voice != "Carla" || p.Level != nexmo.DefaultLevel {
+		t.Fatalf("Builtin fields were not kept: %+v", p)
+	}
+	if s := p.Render(p.Greeting, nexmo.PromptData{CallerName: "Marco"}); s != "Ciao Marco, parla pure" {
+		t.Fatalf("Wanted rendered greeting, found %q", s)
+	}
+	if err := book.Set("en", nexmo.Prompts{End: "{{.Unknown}}"}); err == nil {
+		t.Fatalf("Expected an error for an invalid template")
+	}
+}
+
+func TestSignQuery(t *testing.T) {
+	key := []byte("secret")
+	params := nexmo.CallParams{BroadcastID: 3, Number: "393331111111", Lang: "en", Then: []string{"b.mp3", "c.mp3"}}
+	signed := nexmo.SignQuery(key, "/play/recording/a.mp3", params.Values())
+
+	q, err := url.ParseQuery(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = nexmo.VerifyQuery(key, "/play/recording/a.mp3", q); err != nil {
+		t.Fatalf("Unexpected verify error: %v", err)
+	}
+	if got := nexmo.CallParamsFromQuery(q); !reflect.DeepEqual(got, params) {
+		t.Fatalf("Wanted %+v, found %+v", params, got)
+	}
+	if err = nexmo.VerifyQuery(key, "/play/recording/b.mp3", q); err != nexmo.ErrInvalidSignature {
+		t.Fatalf("Signature was accepted for another path")
+	}
+	q.Set("to", "393332222222")
+	if err = nexmo.VerifyQuery(key, "/play/recording/a.mp3", q); err != nexmo.ErrInvalidSignature {
+		t.Fatalf("Signature was accepted for altered parameters")
+	}
+}
+
+func TestSpeakTime(t *testing.T) {
+	now := time.Date(2019, 3, 6, 12, 0, 0, 0, time.UTC)
+	tt := []struct {
+		t    time.Time
+		lang string
+		want string
+	}{
+		{time.Date(2019, 3, 6, 10, 5, 0, 0, time.UTC), "it", "oggi alle 10:05"},
+		{time.Date(2019, 3, 5, 18, 30, 0, 0, time.UTC), "en-GB", "yesterday at 18:30"},
+		{time.Date(2019, 3, 4, 9, 0, 0, 0, time.UTC), "de", "Montag, 4. März um 9:00"},
+		{time.Date(2018, 12, 25, 9, 0, 0, 0, time.UTC), "xx", "martedì 25 dicembre 2018 alle 9:00"},
+	}
+	for _, v := range tt {
+		if got := nexmo.SpeakTime(v.t, v.lang, now); got != v.want {
+			t.Errorf("Wanted %q, found %q", v.want, got)
+		}
+	}
+}
+
+func TestParseContacts(t *testing.T) {
+	nexmo.CountryCode = "39"
+	defer func() { nexmo.CountryCode = "" }()
+
+	contacts, invalid, err := nexmo.ParseContacts(readString(`# number,name
++39 333 1111111,foo
+
+333-2222222,bar
+39444
+Unknown,baz
+"39555,qux
+`))
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+	if len(contacts) != 2 || contacts[0].Number != "393331111111" || contacts[1].Number != "393332222222" {
+		t.Fatalf("Unexpected contacts: %+v", contacts)
+	}
+	if len(invalid) != 3 {
+		t.Fatalf("Wanted 3 invalid lines, found %d", len(invalid))
+	}
+	for i, line := range []int{5, 6, 7} {
+		if invalid[i].Line != line {
+			t.Fatalf("Wanted error %d on line %d, found %v", i, line, invalid[i])
+		}
+	}
+}
+
+func TestSpeakDuration(t *testing.T) {
+	tt := []struct {
+		d    time.Duration
+		lang string
+		want string
+	}{
+		{42 * time.Second, "it", "42 secondi"},
+		{61 * time.Second, "en", "1 minute and 1 second"},
+		{2 * time.Minute, "de", "2 Minuten"},
+		{1500 * time.Millisecond, "xx", "2 secondi"},
+	}
+	for _, v := range tt {
+		if got := nexmo.SpeakDuration(v.d, v.lang); got != v.want {
+			t.Errorf("Wanted %q, found %q", v.want, got)
+		}
+	}
+}
+
+func TestCall_retryAfter(t *testing.T) {
+	srv, c := newTestClient(t)
+
+	var mu sync.Mutex
+	throttled := 0
+	srv.Fail = func(to string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		if throttled < 1 {
+			throttled++
+			return http.StatusTooManyRequests
+		}
+		return 0
+	}
+
+	start := time.Now()
+	report, err := c.Call(context.TODO(), contacts("393331111111,Anna\n"), "rec.mp3")
+	if err != nil {
+		t.Fatalf("Unexpected call error: %v", err)
+	}
+	if report.Succeeded != 1 || report.Results[0].Attempts != 1 {
+		t.Fatalf("Wanted the throttled call to be retried transparently, found %+v", report.Results)
+	}
+	if time.Since(start) < time.Second {
+		t.Fatalf("Retry-After was not honored")
+	}
+	if len(srv.Calls()) != 1 {
+		t.Fatalf("Wanted 1 call, found %d", len(srv.Calls()))
+	}
+}
@@ -0,0 +1,320 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// recordModePath is where the broadcaster's choice between
+// recording a message and speaking live is reported.
+const recordModePath = "/record/voice/mode"
+
+// NewConferenceName returns the name of a new live session,
+// either a conference or a relayed stream. Nexmo scopes the
+// conference names to the application.
+func NewConferenceName() string {
+	return "voicebr-" + uuid.New().String()
+}
+
+// conversationAction returns the conversation NCCO action
+// joining the conference `name`. The conference starts when
+// the moderator enters it and ends when the moderator leaves;
+// everyone else is muted.
+func conversationAction(name string, moderator bool) map[string]interface{} {
+	action := map[string]interface{}{
+		"action":       "conversation",
+		"name":         name,
+		"startOnEnter": moderator,
+		"endOnExit":    moderator,
+	}
+	if !moderator {
+		action["mute"] = true
+	}
+	return action
+}
+
+// liveNCCO returns the NCCO bringing the broadcaster into the
+// live session of `b`, either its conference or its relay.
+func liveNCCO(origin string, urlKey []byte, p Prompts, b Broadcast, data PromptData) []map[string]interface{} {
+	join := conversationAction(b.Conference, true)
+	if b.Relay != "" {
+		join = relayAction(origin, urlKey, b.Relay, relaySource, b.connectContext(data.CallerNumber))
+	}
+	return []map[string]interface{}{p.TalkAction(p.Live, data), join}
+}
+
+// listenNCCO returns the NCCO bringing a recipient into the
+// live session of `b`. The audio sources introduce themselves.
+func listenNCCO(origin string, urlKey []byte, p Prompts, b Broadcast, data PromptData) []map[string]interface{} {
+	if b.Audio != "" {
+		return []map[string]interface{}{audioAction(origin, urlKey, b.Audio, b.connectContext(b.RequestedBy))}
+	}
+	join := conversationAction(b.Conference, false)
+	if b.Relay != "" {
+		join = relayAction(origin, urlKey, b.Relay, relayListener, b.connectContext(b.RequestedBy))
+	}
+	return []map[string]interface{}{p.TalkAction(p.Listen, data), join}
+}
+
+// newLive returns the broadcast of a new live session: a relayed
+// stream when Passthrough is set, a conference otherwise.
+func (o RouterOptions) newLive() Broadcast {
+	name := NewConferenceName()
+	if o.relay == nil {
+		return Broadcast{Conference: name}
+	}
+	o.relay.Open(name)
+	return Broadcast{Relay: name, RecName: name + relayRecExt}
+}
+
+// modeNCCO returns the NCCO asking `caller` whether to record
+// a message or to speak live.
+func modeNCCO(origin string, urlKey []byte, caller Contact, opts RouterOptions) []map[string]interface{} {
+	p := opts.prompts().For(caller.Lang, caller.Voice)
+	menu := p.TalkAction(p.Menu, PromptData{
+		CallerName:   caller.Name,
+		CallerNumber: caller.Number,
+		Lang:         caller.Lang,
+	})
+	menu["bargeIn"] = true
+	ncco := []map[string]interface{}{menu}
+	if opts.Templates {
+		templates := p.TalkAction(p.Templates, PromptData{
+			CallerName:   caller.Name,
+			CallerNumber: caller.Number,
+			Lang:         caller.Lang,
+		})
+		templates["bargeIn"] = true
+		ncco = append(ncco, templates)
+	}
+	params := CallParams{Number: caller.Number, Lang: caller.Lang, Voice: caller.Voice}
+	return append(ncco, map[string]interface{}{
+		"action":   "input",
+		"type":     []string{"dtmf"},
+		"dtmf":     map[string]interface{}{"maxDigits": 1, "timeOut": 5},
+		"eventUrl": []string{origin + recordModePath + "?" + SignQuery(urlKey, recordModePath, params.Values())},
+	})
+}
+
+// Live brings `contacts` into the live session of `b`, either
+// its Conference or its Relay, where `caller` speaks, logging the
+// broadcast like CallContacts does. `caller` is not called, even
+// if among `contacts`.
+func (c *Client) Live(ctx context.Context, p ContactsProvider, b Broadcast, caller Contact, contacts []Contact) *BroadcastReport {
+	if b.RequestedBy == "" {
+		b.RequestedBy = caller.Number
+	}
+	acc := make([]Contact, 0, len(contacts))
+	for _, v := range contacts {
+		if v.Number != caller.Number {
+			acc = append(acc, v)
+		}
+	}
+	return c.broadcast(ctx, p, b, acc)
+}
+
+// CallLive calls `caller` into the live session of `b`, as
+// its speaker.
+func (c *Client) CallLive(ctx context.Context, caller Contact, b Broadcast) error {
+	if err := c.checkFrom(b); err != nil {
+		return err
+	}
+	p := c.prompts().For(caller.Lang, caller.Voice)
+	ncco := liveNCCO(c.Origin, c.URLKey, p, b, PromptData{
+		CallerName:   caller.Name,
+		CallerNumber: caller.Number,
+		Lang:         caller.Lang,
+	})
+	if err := c.NCCOLimits.Validate(ncco); err != nil {
+		return err
+	}
+	_, err := c.CreateCall(ctx, CallRequest{
+		To: []Contact{caller},
+		From: Contact{
+			Type:   "phone",
+			Number: c.callerID(b, caller),
+		},
+		NCCO: ncco,
+	})
+	return err
+}
+
+// RecipientsOf returns the members of `group`, or the contacts
+// of the broadcast list if empty. ErrNoHistory is returned if `s`
+// does not support groups.
+func RecipientsOf(ctx context.Context, s Storage, group string, lg *log.Logger) ([]Contact, error) {
+	if group == "" {
+		contacts, err := DecodeContacts(s.ReadBroadcastList, lg)
+		if err == ErrCorruptedContacts {
+			// The invalid entries have been logged.
+			err = nil
+		}
+		return contacts, err
+	}
+	g, ok := s.(GroupStore)
+	if !ok {
+		return nil, ErrNoHistory
+	}
+	return g.GroupMembers(ctx, group)
+}
+
+// liveAsync runs Live in the background, logging its outcome.
+func (c *Client) liveAsync(p ContactsProvider, b Broadcast, caller Contact, contacts []Contact) {
+	go func() {
+		report := c.Live(context.Background(), p, b, caller, contacts)
+		c.logger().Printf("call: live session of %s done, succeeded: %d, failed: %d", caller.Number, report.Succeeded, report.Failed)
+	}()
+}
+
+// makeRecordModeHandler answers the input action of modeNCCO:
+// pressing 2 starts a new live session, dialing the broadcast
+// list into it, and pressing 3, with Templates, asks for the code
+// of a template to broadcast; anything else, or nothing at all,
+// records a message as usual.
+func makeRecordModeHandler(s Storage, c *Client, origin string, urlKey []byte, opts RouterOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := originOf(r.Context(), origin)
+		if r.Method != "POST" {
+			return
+		}
+		defer r.Body.Close()
+		if err := VerifyQuery(urlKey, r.URL.Path, r.URL.Query()); err != nil {
+			opts.logger().Printf("record mode handler: %v", err)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		var event struct {
+			ConversationUUID string `json:"conversation_uuid"`
+			DTMF             struct {
+				Digits string `json:"digits"`
+			} `json:"dtmf"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			opts.logger().Printf("record mode handler error: unable to decode event: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		params := CallParamsFromQuery(r.URL.Query())
+		caller, err := whitelisted(s, params.Number, opts.Log)
+		if err != nil {
+			opts.logger().Printf("record mode handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if caller == nil {
+			opts.logger().Printf("record mode handler: number %s cannot broadcast anymore", params.Number)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		ncco := recordNCCO(origin, urlKey, *caller, opts)
+		if event.DTMF.Digits == "3" && opts.Templates {
+			ncco = templateNCCO(origin, urlKey, *caller, opts)
+		}
+		if event.DTMF.Digits == "2" {
+			if contacts, err := RecipientsOf(r.Context(), s, "", opts.Log); err != nil {
+				opts.logger().Printf("record mode handler: unable to go live: %v", err)
+			} else {
+				b := opts.newLive()
+				opts.logger().Printf("record mode handler: %s is speaking live in %s%s", caller.Number, b.Conference, b.Relay)
+				// No recording is coming.
+				opts.Watcher.Done(event.ConversationUUID)
+				c.liveAsync(s, b, *caller, contacts)
+				p := opts.prompts().For(caller.Lang, caller.Voice)
+				ncco = liveNCCO(origin, urlKey, p, b, PromptData{
+					CallerName:   caller.Name,
+					CallerNumber: caller.Number,
+					Lang:         caller.Lang,
+				})
+			}
+		}
+
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(ncco)
+	}
+}
+
+// makeStartConferenceHandler calls the broadcaster numbered as
+// the `caller` query parameter into a new live session, dialing
+// the members of the `group` query parameter into it, or the
+// broadcast list if missing, from the `from` query parameter if
+// set.
+func makeStartConferenceHandler(s Storage, c *Client, opts RouterOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		group := q.Get("group")
+		by := "anonymous"
+		if p, ok := PrincipalFromContext(r.Context()); ok {
+			if !p.CanBroadcastTo(group) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			by = p.Name
+		}
+		from, ok := fromQuery(w, r, c)
+		if !ok {
+			return
+		}
+
+		caller, err := whitelisted(s, q.Get("caller"), opts.Log)
+		if err != nil {
+			opts.logger().Printf("start conference handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if caller == nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprintf(w, "%q is not allowed to broadcast\n", q.Get("caller"))
+			return
+		}
+
+		contacts, err := RecipientsOf(r.Context(), s, group, opts.Log)
+		switch {
+		case err == ErrNoHistory:
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		case err != nil:
+			opts.logger().Printf("start conference handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		b := opts.newLive()
+		b.From, b.RequestedBy = from, by
+		if err := c.CallLive(r.Context(), *caller, b); err != nil {
+			opts.logger().Printf("start conference handler: unable to call %s: %v", caller.Number, err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		c.liveAsync(s, b, *caller, contacts)
+		opts.logger().Printf("start conference handler: %s is speaking live in %s%s, requested by %s", caller.Number, b.Conference, b.Relay, by)
+
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(b)
+	}
+}
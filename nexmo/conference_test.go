@@ -0,0 +1,68 @@
+package nexmo_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/nexmo/nexmotest"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestConference(t *testing.T) {
+	srv, c := newTestClient(t)
+
+	dir := t.TempDir()
+	ioutil.WriteFile(dir+"/whitelist.csv", []byte("393330000000,Marco,,,,en\n"), 0644)
+	ioutil.WriteFile(dir+"/contacts.csv", []byte("393330000000,Marco\n393331111111,Anna\n393332222222,Luca\n"), 0644)
+	s := &storage.Local{RootDir: dir}
+
+	r := nexmo.NewRouter(c, s, c.Origin, nexmo.RouterOptions{Conference: true})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, nexmotest.AnswerWebhook("393330000000", "CON-1"))
+	var ncco []map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&ncco); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if len(ncco) != 2 || ncco[1]["action"] != "input" {
+		t.Fatalf("Wanted the mode menu, found %v", ncco)
+	}
+
+	u, _ := url.Parse(ncco[1]["eventUrl"].([]interface{})[0].(string))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, nexmotest.InputWebhook(u.RequestURI(), "CON-1", "2"))
+	if err := json.NewDecoder(w.Body).Decode(&ncco); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if len(ncco) != 2 || ncco[1]["action"] != "conversation" || ncco[1]["startOnEnter"] != true {
+		t.Fatalf("Wanted to join the conference as moderator, found %v", ncco)
+	}
+	name := ncco[1]["name"]
+
+	calls := srv.WaitCalls(2, waitTimeout)
+	if len(calls) != 2 {
+		t.Fatalf("Wanted 2 recipients to be called, found %d", len(calls))
+	}
+	for _, v := range calls {
+		if v.To[0].Number == "393330000000" {
+			t.Fatalf("Wanted the broadcaster not to be called")
+		}
+		if len(v.NCCO) != 2 || v.NCCO[1]["name"] != name || v.NCCO[1]["mute"] != true {
+			t.Fatalf("Wanted %s to join the conference muted, found %v", v.To[0].Number, v.NCCO)
+		}
+	}
+
+	// The menu defaults to recording.
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, nexmotest.InputWebhook(u.RequestURI(), "CON-2", ""))
+	if err := json.NewDecoder(w.Body).Decode(&ncco); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if len(ncco) != 2 || ncco[1]["action"] != "record" {
+		t.Fatalf("Wanted a recording, found %v", ncco)
+	}
+}
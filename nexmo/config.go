@@ -0,0 +1,132 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// TokenTTL is the lifetime of the tokens signing the API
+// requests, see Client.Token.
+const TokenTTL = 15 * time.Minute
+
+// ErrInvalidToken is returned by ValidateToken when the token
+// was not issued by the application, or is expired.
+var ErrInvalidToken = errors.New("invalid application token")
+
+// Config identifies the nexmo application placing the calls.
+type Config struct {
+	AppID string
+	// PrivateKey is the PEM encoded private key of the
+	// application. PrivateKeyPath is read when empty.
+	PrivateKey     []byte
+	PrivateKeyPath string
+	// Number is the number shown to the recipients, in
+	// E.164 format.
+	Number string
+	// BaseURL is the address of the REST API,
+	// DefaultBaseURL if empty.
+	BaseURL string
+	// Origin is the address the webhooks are served at.
+	Origin string
+}
+
+// Validate checks that `c` has everything a client needs.
+func (c Config) Validate() error {
+	switch {
+	case c.AppID == "":
+		return fmt.Errorf("config: missing application id")
+	case len(c.PrivateKey) == 0 && c.PrivateKeyPath == "":
+		return fmt.Errorf("config: missing private key")
+	case len(c.PrivateKey) > 0 && c.PrivateKeyPath != "":
+		return fmt.Errorf("config: set either a private key or its path")
+	case c.Number == "":
+		return fmt.Errorf("config: missing number")
+	}
+	if c.BaseURL != "" {
+		if u, err := url.Parse(c.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("config: %q is not a valid base URL", c.BaseURL)
+		}
+	}
+	return nil
+}
+
+// privateKey returns the PEM encoded private key, reading
+// it from PrivateKeyPath if needed.
+func (c Config) privateKey() ([]byte, error) {
+	if len(c.PrivateKey) > 0 {
+		return c.PrivateKey, nil
+	}
+	b, err := ioutil.ReadFile(c.PrivateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("config: unable to read private key: %v", err)
+	}
+	return b, nil
+}
+
+// NewClientFromConfig validates `cfg` and returns a client
+// for the application it identifies.
+func NewClientFromConfig(cfg Config) (*Client, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	key, err := cfg.privateKey()
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewClient(bytes.NewReader(key), cfg.AppID, strings.TrimPrefix(cfg.Number, "+"), cfg.Origin)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.BaseURL != "" {
+		c.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+	}
+	return c, nil
+}
+
+// ValidateToken checks that `raw` was issued by Token, i.e. that
+// it is signed with the application private key, carries its id
+// and did not expire, returning its claims.
+func (c *Client) ValidateToken(raw string) (jwt.MapClaims, error) {
+	key, ok := c.key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("validate token: found nil key. Use NewClient to create a valid Client")
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		return &key.PublicKey, nil
+	})
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if id, _ := claims["application_id"].(string); id != c.AppID {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
@@ -0,0 +1,83 @@
+package nexmo_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/nexmo/nexmotest"
+)
+
+func TestNewClientFromConfig(t *testing.T) {
+	srv, err := nexmotest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err = ioutil.WriteFile(path, srv.PrivateKeyPEM(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		name string
+		cfg  nexmo.Config
+		ok   bool
+	}{
+		{"inline key", nexmo.Config{AppID: "app", PrivateKey: srv.PrivateKeyPEM(), Number: "+393339999999"}, true},
+		{"key path", nexmo.Config{AppID: "app", PrivateKeyPath: path, Number: "393339999999", BaseURL: srv.URL + "/"}, true},
+		{"both keys", nexmo.Config{AppID: "app", PrivateKey: srv.PrivateKeyPEM(), PrivateKeyPath: path, Number: "393339999999"}, false},
+		{"no key", nexmo.Config{AppID: "app", Number: "393339999999"}, false},
+		{"no app", nexmo.Config{PrivateKey: srv.PrivateKeyPEM(), Number: "393339999999"}, false},
+		{"bad key", nexmo.Config{AppID: "app", PrivateKey: []byte("not a key"), Number: "393339999999"}, false},
+		{"bad base URL", nexmo.Config{AppID: "app", PrivateKeyPath: path, Number: "393339999999", BaseURL: "api.nexmo.com"}, false},
+	}
+	for _, v := range tt {
+		c, err := nexmo.NewClientFromConfig(v.cfg)
+		if !v.ok {
+			if err == nil {
+				t.Fatalf("%s: wanted an error", v.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", v.name, err)
+		}
+		if c.Number != "393339999999" {
+			t.Fatalf("%s: wanted the number without the plus, found %s", v.name, c.Number)
+		}
+		if v.cfg.BaseURL != "" && c.BaseURL != srv.URL {
+			t.Fatalf("%s: wanted base URL %s, found %s", v.name, srv.URL, c.BaseURL)
+		}
+	}
+}
+
+func TestClient_ValidateToken(t *testing.T) {
+	srv, c := newTestClient(t)
+	token, err := c.Token()
+	if err != nil {
+		t.Fatalf("Unexpected token error: %v", err)
+	}
+	claims, err := c.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+	if claims["application_id"] != "app" || claims["exp"] == nil {
+		t.Fatalf("Unexpected claims: %v", claims)
+	}
+
+	other, err := srv.NewClient("other", "393339999999", "https://voicebr.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, err = other.Token(); err != nil {
+		t.Fatalf("Unexpected token error: %v", err)
+	}
+	if _, err = c.ValidateToken(token); err != nexmo.ErrInvalidToken {
+		t.Fatalf("Wanted %v, found %v", nexmo.ErrInvalidToken, err)
+	}
+	if _, err = c.ValidateToken("not.a.token"); err != nexmo.ErrInvalidToken {
+		t.Fatalf("Wanted %v, found %v", nexmo.ErrInvalidToken, err)
+	}
+}
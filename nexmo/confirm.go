@@ -0,0 +1,250 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ConfirmWait is how long the confirmation of a recording waits
+// for nexmo to report the recording's length before falling back
+// to the Recorded prompt.
+const ConfirmWait = 4 * time.Second
+
+// recLengths pairs the lengths of the recordings, reported by
+// the recording event, with the confirmations waiting for them,
+// which are requested by a notify action that may arrive first.
+type recLengths struct {
+	mu sync.Mutex
+	m  map[string]*recLength
+}
+
+type recLength struct {
+	done    chan struct{}
+	d       time.Duration
+	created time.Time
+}
+
+func newRecLengths() *recLengths {
+	return &recLengths{m: make(map[string]*recLength)}
+}
+
+// get returns the entry of `conversation`, creating it if needed.
+// Entries older than a minute are dropped, as their confirmation
+// is either done or never coming.
+func (l *recLengths) get(conversation string) *recLength {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for k, v := range l.m {
+		if now.Sub(v.created) > time.Minute {
+			delete(l.m, k)
+		}
+	}
+	v, ok := l.m[conversation]
+	if !ok {
+		v = &recLength{done: make(chan struct{}), created: now}
+		l.m[conversation] = v
+	}
+	return v
+}
+
+// Put records the length of the recording of `conversation`.
+// Safe to call on a nil receiver.
+func (l *recLengths) Put(conversation string, d time.Duration) {
+	if l == nil {
+		return
+	}
+	v := l.get(conversation)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-v.done:
+	default:
+		v.d = d
+		close(v.done)
+	}
+}
+
+// Wait returns the length of the recording of `conversation`,
+// waiting for it until `ctx` is done.
+func (l *recLengths) Wait(ctx context.Context, conversation string) (time.Duration, bool) {
+	v := l.get(conversation)
+	select {
+	case <-v.done:
+		l.mu.Lock()
+		delete(l.m, conversation)
+		l.mu.Unlock()
+		return v.d, true
+	case <-ctx.Done():
+		return 0, false
+	}
+}
+
+// recLengthOf returns the length of a recording from the start
+// and end times of its event, as formatted by nexmo.
+func recLengthOf(start, end string) (time.Duration, bool) {
+	s, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		return 0, false
+	}
+	e, err := time.Parse(time.RFC3339, end)
+	if err != nil || e.Before(s) {
+		return 0, false
+	}
+	return e.Sub(s), true
+}
+
+// confirmPayload identifies the caller to speak to.
+type confirmPayload struct {
+	Number     string `json:"number"`
+	Lang       string `json:"lang"`
+	Voice      string `json:"voice"`
+	CallerName string `json:"caller_name"`
+}
+
+// confirmAction returns the notify NCCO action that, placed after
+// the record action, asks for the confirmation of the recording.
+func confirmAction(eventURL string, caller Contact) map[string]interface{} {
+	return map[string]interface{}{
+		"action": "notify",
+		"payload": confirmPayload{
+			Number:     caller.Number,
+			Lang:       caller.Lang,
+			Voice:      caller.Voice,
+			CallerName: caller.Name,
+		},
+		"eventUrl": []string{eventURL},
+	}
+}
+
+// recordAgainPath is where the caller's choice of recording
+// a too long message again is reported.
+const recordAgainPath = "/record/voice/again"
+
+// makeRecordConfirmHandler answers the notify action of
+// confirmAction with the NCCO telling the caller how long the
+// message is. Messages longer than RecordOptions.MaxLength are
+// not broadcast: the caller is offered to record them again.
+func makeRecordConfirmHandler(origin string, urlKey []byte, opts RouterOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := originOf(r.Context(), origin)
+		if r.Method != "POST" {
+			return
+		}
+		defer r.Body.Close()
+
+		var event struct {
+			ConversationUUID string         `json:"conversation_uuid"`
+			Payload          confirmPayload `json:"payload"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			opts.logger().Printf("record confirm handler error: unable to decode event: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		caller := event.Payload
+		p := opts.prompts().For(caller.Lang, caller.Voice)
+		data := PromptData{
+			CallerName:   caller.CallerName,
+			CallerNumber: caller.Number,
+			Lang:         caller.Lang,
+		}
+		ncco := []map[string]interface{}{}
+		ctx, cancel := context.WithTimeout(r.Context(), ConfirmWait)
+		defer cancel()
+		switch d, ok := opts.lengths.Wait(ctx, event.ConversationUUID); {
+		case !ok:
+			opts.logger().Printf("record confirm handler: length of %s not reported in time", event.ConversationUUID)
+			ncco = append(ncco, p.TalkAction(p.Recorded, data))
+		case opts.Record.TooLong(d):
+			data.Length = SpokenDuration{Duration: opts.Record.MaxLength, Lang: caller.Lang}
+			params := CallParams{Number: caller.Number, Lang: caller.Lang, Voice: caller.Voice}
+			ncco = append(ncco, p.TalkAction(p.TooLong, data), map[string]interface{}{
+				"action":   "input",
+				"type":     []string{"dtmf"},
+				"dtmf":     map[string]interface{}{"maxDigits": 1, "timeOut": 10},
+				"eventUrl": []string{origin + recordAgainPath + "?" + SignQuery(urlKey, recordAgainPath, params.Values())},
+			})
+		default:
+			data.Length = SpokenDuration{Duration: d, Lang: caller.Lang}
+			ncco = append(ncco, p.TalkAction(p.Confirm, data))
+		}
+
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(ncco)
+	}
+}
+
+// makeRecordAgainHandler answers the input action offered by the
+// confirmation of a too long message: pressing 1 starts a new
+// recording, anything else ends the call.
+func makeRecordAgainHandler(s Storage, origin string, urlKey []byte, opts RouterOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := originOf(r.Context(), origin)
+		if r.Method != "POST" {
+			return
+		}
+		defer r.Body.Close()
+		if err := VerifyQuery(urlKey, r.URL.Path, r.URL.Query()); err != nil {
+			opts.logger().Printf("record again handler: %v", err)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		var event struct {
+			ConversationUUID string `json:"conversation_uuid"`
+			DTMF             struct {
+				Digits string `json:"digits"`
+			} `json:"dtmf"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			opts.logger().Printf("record again handler error: unable to decode event: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ncco := []map[string]interface{}{}
+		if event.DTMF.Digits == "1" {
+			params := CallParamsFromQuery(r.URL.Query())
+			caller, err := whitelisted(s, params.Number, opts.Log)
+			if err != nil {
+				opts.logger().Printf("record again handler: %v", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if caller == nil {
+				opts.logger().Printf("record again handler: number %s cannot broadcast anymore", params.Number)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			opts.logger().Printf("record again handler: %s is recording again", caller.Number)
+			opts.Watcher.Watch(event.ConversationUUID, *caller)
+			ncco = recordNCCO(origin, urlKey, *caller, opts)
+		}
+
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(ncco)
+	}
+}
@@ -0,0 +1,82 @@
+package nexmo_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/nexmo/nexmotest"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestRecordConfirmation(t *testing.T) {
+	srv, c := newTestClient(t)
+
+	dir := t.TempDir()
+	ioutil.WriteFile(dir+"/whitelist.csv", []byte("393330000000,Marco,,,,en\n"), 0644)
+	s := &storage.Local{RootDir: dir}
+
+	r := nexmo.NewRouter(c, s, c.Origin, nexmo.RouterOptions{
+		Record: nexmo.RecordOptions{Confirm: true, MaxLength: 2 * time.Minute},
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, nexmotest.AnswerWebhook("393330000000", "CON-1"))
+	var ncco []map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&ncco); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if len(ncco) != 3 || ncco[2]["action"] != "notify" {
+		t.Fatalf("Wanted a trailing notify action, found %v", ncco)
+	}
+
+	recUUID, recURL := srv.AddRecording([]byte("fake mp3"))
+	r.ServeHTTP(httptest.NewRecorder(), nexmotest.RecordingWebhookLength(recURL, recUUID, "CON-1", 65*time.Second))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, nexmotest.NotifyWebhook("/record/voice/confirm", "CON-1", ncco[2]["payload"]))
+	if err := json.NewDecoder(w.Body).Decode(&ncco); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if want := "Your message is 1 minute and 5 seconds long"; len(ncco) != 1 || ncco[0]["text"] != want {
+		t.Fatalf("Wanted %q, found %v", want, ncco)
+	}
+	first := recUUID
+	waitFor(t, "the recording to be stored", func() bool {
+		rec, _, err := s.OpenRec(context.TODO(), first+".mp3")
+		if err == nil {
+			rec.Close()
+		}
+		return err == nil
+	})
+
+	// Too long messages are discarded, and can be recorded again.
+	recUUID, recURL = srv.AddRecording([]byte("fake mp3"))
+	r.ServeHTTP(httptest.NewRecorder(), nexmotest.RecordingWebhookLength(recURL, recUUID, "CON-1", 3*time.Minute))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, nexmotest.NotifyWebhook("/record/voice/confirm", "CON-1", map[string]string{"number": "393330000000", "lang": "en"}))
+	if err := json.NewDecoder(w.Body).Decode(&ncco); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if len(ncco) != 2 || ncco[1]["action"] != "input" {
+		t.Fatalf("Wanted to be offered to record again, found %v", ncco)
+	}
+	u, _ := url.Parse(ncco[1]["eventUrl"].([]interface{})[0].(string))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, nexmotest.InputWebhook(u.RequestURI(), "CON-1", "1"))
+	if err := json.NewDecoder(w.Body).Decode(&ncco); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if len(ncco) != 3 || ncco[1]["action"] != "record" {
+		t.Fatalf("Wanted a new recording, found %v", ncco)
+	}
+
+	if _, _, err := s.OpenRec(context.TODO(), recUUID+".mp3"); err != nexmo.ErrRecNotFound {
+		t.Fatalf("Wanted the too long recording to be discarded, found %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ConnectContext is the information about the original call
+// that is passed downstream when a call is connected elsewhere,
+// so that PBXes can see who is calling and why.
+type ConnectContext struct {
+	Caller      string
+	RecName     string
+	BroadcastID string
+	// Custom is forwarded as is, as `X-` prefixed SIP headers
+	// for SIP endpoints, as the headers of the websockets, and
+	// as custom data otherwise.
+	Custom map[string]string
+}
+
+// connectContext returns the context of the calls connected
+// to the live session of `b`, started by `caller`.
+func (b Broadcast) connectContext(caller string) ConnectContext {
+	ctx := ConnectContext{Caller: caller, RecName: b.RecName}
+	if b.ID != 0 {
+		ctx.BroadcastID = strconv.FormatInt(b.ID, 10)
+	}
+	return ctx
+}
+
+func (c ConnectContext) fields() map[string]string {
+	acc := make(map[string]string, len(c.Custom)+3)
+	for k, v := range c.Custom {
+		acc[k] = v
+	}
+	if c.Caller != "" {
+		acc["Caller"] = c.Caller
+	}
+	if c.RecName != "" {
+		acc["Recording"] = c.RecName
+	}
+	if c.BroadcastID != "" {
+		acc["Broadcast"] = c.BroadcastID
+	}
+	return acc
+}
+
+// SIPHeaders returns the context encoded as custom SIP
+// headers, each one prefixed with `X-` if needed.
+func (c ConnectContext) SIPHeaders() map[string]string {
+	acc := make(map[string]string)
+	for k, v := range c.fields() {
+		if !strings.HasPrefix(strings.ToLower(k), "x-") {
+			k = "X-" + k
+		}
+		acc[k] = v
+	}
+	return acc
+}
+
+// ConnectSIPAction returns a `connect` NCCO action towards
+// the SIP `uri`, carrying `ctx` as custom SIP headers.
+func ConnectSIPAction(uri, from string, ctx ConnectContext) map[string]interface{} {
+	return map[string]interface{}{
+		"action": "connect",
+		"from":   from,
+		"endpoint": []map[string]interface{}{
+			{
+				"type":    "sip",
+				"uri":     uri,
+				"headers": ctx.SIPHeaders(),
+			},
+		},
+	}
+}
+
+// ConnectPhoneAction returns a `connect` NCCO action towards
+// the phone `number`. Phone endpoints do not support headers,
+// hence `ctx` is attached as the action's custom data, which
+// nexmo reports back in the call events.
+func ConnectPhoneAction(number, from string, ctx ConnectContext) map[string]interface{} {
+	action := map[string]interface{}{
+		"action": "connect",
+		"from":   from,
+		"endpoint": []map[string]interface{}{
+			{
+				"type":   "phone",
+				"number": number,
+			},
+		},
+	}
+	if fields := ctx.fields(); len(fields) > 0 {
+		action["customData"] = fields
+	}
+	return action
+}
@@ -0,0 +1,72 @@
+package nexmo_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+func TestConnectContext(t *testing.T) {
+	tt := []struct {
+		name    string
+		ctx     nexmo.ConnectContext
+		headers map[string]string
+	}{
+		{"empty", nexmo.ConnectContext{}, map[string]string{}},
+		{"fields", nexmo.ConnectContext{Caller: "393330000000", RecName: "rec.mp3", BroadcastID: "7"}, map[string]string{
+			"X-Caller":    "393330000000",
+			"X-Recording": "rec.mp3",
+			"X-Broadcast": "7",
+		}},
+		{"custom", nexmo.ConnectContext{Custom: map[string]string{"Team": "north", "x-ticket": "42", "X-Queue": "sales"}}, map[string]string{
+			"X-Team":   "north",
+			"x-ticket": "42",
+			"X-Queue":  "sales",
+		}},
+		{"fields win", nexmo.ConnectContext{Caller: "393330000000", Custom: map[string]string{"Caller": "forged"}}, map[string]string{
+			"X-Caller": "393330000000",
+		}},
+	}
+	for _, v := range tt {
+		if got := v.ctx.SIPHeaders(); !reflect.DeepEqual(got, v.headers) {
+			t.Fatalf("%s: Wanted headers %v, found %v", v.name, v.headers, got)
+		}
+		sip := nexmo.ConnectSIPAction("sip:desk@pbx.example.com", "393339999999", v.ctx)
+		if got := sip["endpoint"].([]map[string]interface{})[0]["headers"]; !reflect.DeepEqual(got, v.headers) {
+			t.Fatalf("%s: Wanted SIP endpoint headers %v, found %v", v.name, v.headers, got)
+		}
+	}
+}
+
+func TestConnectPhoneAction(t *testing.T) {
+	tt := []struct {
+		name string
+		ctx  nexmo.ConnectContext
+		data interface{}
+	}{
+		{"empty", nexmo.ConnectContext{}, nil},
+		{"fields", nexmo.ConnectContext{Caller: "393330000000", BroadcastID: "7", Custom: map[string]string{"Team": "north"}}, map[string]string{
+			"Caller":    "393330000000",
+			"Broadcast": "7",
+			"Team":      "north",
+		}},
+	}
+	for _, v := range tt {
+		action := nexmo.ConnectPhoneAction("393331111111", "393339999999", v.ctx)
+		endpoint := action["endpoint"].([]map[string]interface{})[0]
+		if endpoint["type"] != "phone" || endpoint["number"] != "393331111111" {
+			t.Fatalf("%s: Unexpected endpoint %v", v.name, endpoint)
+		}
+		data, ok := action["customData"]
+		if v.data == nil {
+			if ok {
+				t.Fatalf("%s: Wanted no custom data, found %v", v.name, data)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(data, v.data) {
+			t.Fatalf("%s: Wanted custom data %v, found %v", v.name, v.data, data)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Kinds of webhooks the console is able to synthesize.
+const (
+	ConsoleAnswer = "answer"
+	ConsolePlay   = "play"
+	ConsoleEvent  = "event"
+	ConsoleInput  = "input"
+)
+
+// consoleInputPaths are the handlers of the input webhooks the
+// console is able to synthesize, by their target.
+var consoleInputPaths = map[string]string{
+	"keypress": keypressPath,
+	"ivr":      ivrPath,
+	"mode":     recordModePath,
+	"template": templateCodePath,
+}
+
+// ConsoleRequest describes the webhook the console should
+// synthesize. Empty fields are given sample values.
+type ConsoleRequest struct {
+	Kind             string `json:"kind"`
+	From             string `json:"from"`
+	To               string `json:"to"`
+	ConversationUUID string `json:"conversation_uuid"`
+	// Status and Duration are used by event webhooks.
+	Status   string `json:"status"`
+	Duration int    `json:"duration"`
+	// RecName, Lang and Voice are used by play webhooks.
+	RecName string `json:"rec_name"`
+	Lang    string `json:"lang"`
+	Voice   string `json:"voice"`
+	// Target, Digits and Speech are used by input webhooks.
+	// Target is one of the keys of consoleInputPaths, keypress
+	// if empty; the keypresses of the outbound calls are made
+	// by To, the other inputs by From.
+	Target string `json:"target"`
+	Digits string `json:"digits"`
+	Speech string `json:"speech"`
+	// Replays is the replays left, used by keypress inputs.
+	Replays int `json:"replays"`
+}
+
+// ConsoleResult is the webhook sent by the console,
+// together with the router's response.
+type ConsoleResult struct {
+	Method string          `json:"method"`
+	URL    string          `json:"url"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	Status int             `json:"status"`
+	// Response is the NCCO, if any.
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+// request builds the webhook described by `c`, signing the
+// query parameters of the outbound calls with `urlKey`.
+func (c ConsoleRequest) request(urlKey []byte) (*http.Request, []byte, error) {
+	if c.From == "" {
+		c.From = "393330000000"
+	}
+	if c.To == "" {
+		c.To = "393339999999"
+	}
+	if c.ConversationUUID == "" {
+		c.ConversationUUID = fmt.Sprintf("CON-console-%d", time.Now().UnixNano())
+	}
+
+	switch c.Kind {
+	case ConsoleAnswer:
+		q := url.Values{}
+		q.Set("from", c.From)
+		q.Set("to", c.To)
+		q.Set("conversation_uuid", c.ConversationUUID)
+		q.Set("uuid", "console")
+		return httptest.NewRequest("GET", "/record/voice/answer?"+q.Encode(), nil), nil, nil
+	case ConsolePlay:
+		if c.RecName == "" {
+			c.RecName = "sample.mp3"
+		}
+		params := CallParams{Number: c.To, Lang: c.Lang, Voice: c.Voice}
+		path := "/play/recording/" + url.PathEscape(c.RecName)
+		path += "?" + SignQuery(urlKey, path, params.Values())
+		return httptest.NewRequest("GET", path, nil), nil, nil
+	case ConsoleEvent:
+		if c.Status == "" {
+			c.Status = "completed"
+		}
+		event := map[string]string{
+			"from":              c.From,
+			"to":                c.To,
+			"uuid":              "console",
+			"conversation_uuid": c.ConversationUUID,
+			"status":            c.Status,
+			"direction":         "inbound",
+			"timestamp":         time.Now().UTC().Format(time.RFC3339Nano),
+		}
+		if c.Status == "completed" {
+			event["duration"] = fmt.Sprintf("%d", c.Duration)
+		}
+		body, err := json.Marshal(event)
+		if err != nil {
+			return nil, nil, err
+		}
+		r := httptest.NewRequest("POST", "/record/voice/event", bytes.NewReader(body))
+		r.Header.Set("content-type", "application/json")
+		return r, body, nil
+	case ConsoleInput:
+		return c.input(urlKey)
+	default:
+		return nil, nil, fmt.Errorf("unknown webhook kind %q", c.Kind)
+	}
+}
+
+// input builds the input webhook described by `c`, reporting
+// its digits or speech to the handler of its target.
+func (c ConsoleRequest) input(urlKey []byte) (*http.Request, []byte, error) {
+	if c.Target == "" {
+		c.Target = "keypress"
+	}
+	path, ok := consoleInputPaths[c.Target]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown input target %q", c.Target)
+	}
+	params := CallParams{Number: c.From, Lang: c.Lang, Voice: c.Voice}
+	if c.Target == "keypress" {
+		params.Number = c.To
+	}
+	q := params.Values()
+	if c.Target == "keypress" {
+		if c.RecName == "" {
+			c.RecName = "sample.mp3"
+		}
+		q.Set("rec", c.RecName)
+		q.Set("replays", strconv.Itoa(c.Replays))
+	}
+
+	event := map[string]interface{}{
+		"uuid":              "console",
+		"conversation_uuid": c.ConversationUUID,
+		"dtmf":              map[string]interface{}{"digits": c.Digits, "timed_out": c.Digits == "" && c.Speech == ""},
+		"timestamp":         time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	if c.Speech != "" {
+		event["speech"] = map[string]interface{}{
+			"results": []map[string]string{{"text": c.Speech, "confidence": "1"}},
+		}
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := httptest.NewRequest("POST", path+"?"+SignQuery(urlKey, path, q), bytes.NewReader(body))
+	r.Header.Set("content-type", "application/json")
+	return r, body, nil
+}
+
+type consoleKey struct{}
+
+// withConsole marks the webhooks synthesized by the console,
+// which is authenticated already, as trusted.
+func withConsole(ctx context.Context) context.Context {
+	return context.WithValue(ctx, consoleKey{}, true)
+}
+
+func fromConsole(r *http.Request) bool {
+	v, _ := r.Context().Value(consoleKey{}).(bool)
+	return v
+}
+
+// makeConsoleSendHandler synthesizes the webhook described by the
+// request body and serves it with `router`, i.e. going through the
+// same handlers and middlewares nexmo's webhooks go through, but
+// for the replay and signature checks, which it skips. Inbound
+// calls started by the console are never reported by the watcher.
+func makeConsoleSendHandler(router http.Handler, urlKey []byte, opts RouterOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var c ConsoleRequest
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		req, body, err := c.request(urlKey)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, err)
+			return
+		}
+		req = req.WithContext(withConsole(r.Context()))
+
+		opts.logger().Printf("console: sending %s webhook %s", c.Kind, req.URL)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if c.Kind == ConsoleAnswer {
+			opts.Watcher.Done(req.URL.Query().Get("conversation_uuid"))
+		}
+
+		res := ConsoleResult{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Status: rec.Code,
+		}
+		if len(body) > 0 {
+			res.Body = body
+		}
+		if b := rec.Body.Bytes(); json.Valid(b) {
+			res.Response = b
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
+func consolePageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "text/html; charset=utf-8")
+	fmt.Fprint(w, consolePage)
+}
+
+const consolePage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>voicebr - webhook console</title>
+<style>
+body { font-family: sans-serif; margin: 2em; max-width: 60em; }
+label { display: block; margin: .4em 0; }
+label span { display: inline-block; width: 10em; }
+pre { background: #f4f4f4; padding: 1em; overflow: auto; }
+</style>
+</head>
+<body>
+<h1>Webhook console</h1>
+<p>Synthesizes nexmo webhooks and sends them to the local router. No call is placed.</p>
+<form id="console">
+<label><span>Webhook</span>
+<select name="kind">
+<option value="answer">answer (inbound recording call)</option>
+<option value="event">event (inbound call)</option>
+<option value="play">play recording (outbound answer)</option>
+<option value="input">input (keys pressed or words spoken)</option>
+</select></label>
+<label><span>From</span><input name="from" placeholder="393330000000"></label>
+<label><span>To</span><input name="to" placeholder="393339999999"></label>
+<label><span>Conversation UUID</span><input name="conversation_uuid"></label>
+<label><span>Event status</span><input name="status" placeholder="completed"></label>
+<label><span>Duration (s)</span><input name="duration" type="number" value="0"></label>
+<label><span>Recording</span><input name="rec_name" placeholder="sample.mp3"></label>
+<label><span>Language</span><input name="lang" placeholder="it"></label>
+<label><span>Voice</span><input name="voice"></label>
+<label><span>Input target</span>
+<select name="target">
+<option value="keypress">keypress (outbound call)</option>
+<option value="ivr">IVR menu</option>
+<option value="mode">record mode menu</option>
+<option value="template">template code</option>
+</select></label>
+<label><span>Digits</span><input name="digits"></label>
+<label><span>Speech</span><input name="speech"></label>
+<label><span>Replays left</span><input name="replays" type="number" value="0"></label>
+<button type="submit">Send</button>
+</form>
+<h2>Result</h2>
+<pre id="result"></pre>
+<script>
+document.getElementById("console").addEventListener("submit", function(e) {
+	e.preventDefault();
+	var req = {};
+	new FormData(e.target).forEach(function(v, k) { req[k] = k === "duration" || k === "replays" ? parseInt(v || "0", 10) : v; });
+	fetch("/admin/console/send", {method: "POST", body: JSON.stringify(req)})
+		.then(function(r) { return r.text(); })
+		.then(function(t) {
+			try { t = JSON.stringify(JSON.parse(t), null, 2); } catch (_) {}
+			document.getElementById("result").textContent = t;
+		});
+});
+</script>
+</body>
+</html>
+`
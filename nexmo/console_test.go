@@ -0,0 +1,120 @@
+package nexmo_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestConsole_play(t *testing.T) {
+	r := nexmo.NewRouter(nil, &storage.Local{RootDir: t.TempDir()}, "https://example.com", nexmo.RouterOptions{Console: true})
+
+	w := httptest.NewRecorder()
+	body := `{"kind": "play", "rec_name": "a.mp3", "lang": "en"}`
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/admin/console/send", strings.NewReader(body)))
+	if w.Code != 200 {
+		t.Fatalf("Wanted status 200, found %d", w.Code)
+	}
+
+	var res struct {
+		URL      string                   `json:"url"`
+		Status   int                      `json:"status"`
+		Response []map[string]interface{} `json:"response"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if res.URL != "/play/recording/a.mp3?lang=en&to=393339999999" || res.Status != 200 {
+		t.Fatalf("Unexpected console result: %+v", res)
+	}
+	if len(res.Response) != 3 || res.Response[0]["text"] != "Recorded message" {
+		t.Fatalf("Unexpected NCCO: %v", res.Response)
+	}
+}
+
+func TestConsole_input(t *testing.T) {
+	r := nexmo.NewRouter(nil, &storage.Local{RootDir: t.TempDir()}, "https://example.com", nexmo.RouterOptions{Console: true, Replays: 1})
+
+	send := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/admin/console/send", strings.NewReader(body)))
+		return w
+	}
+	w := send(`{"kind": "input", "digits": "1", "rec_name": "a.mp3", "lang": "en", "replays": 1}`)
+	if w.Code != 200 {
+		t.Fatalf("Wanted status 200, found %d", w.Code)
+	}
+	var res struct {
+		URL      string                   `json:"url"`
+		Status   int                      `json:"status"`
+		Response []map[string]interface{} `json:"response"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if !strings.HasPrefix(res.URL, "/play/recording/keypress?") || res.Status != 200 {
+		t.Fatalf("Unexpected console result: %+v", res)
+	}
+	if len(res.Response) == 0 || res.Response[0]["action"] != "stream" {
+		t.Fatalf("Wanted the message to be replayed, found %v", res.Response)
+	}
+
+	if w = send(`{"kind": "input", "target": "nowhere"}`); w.Code != 400 {
+		t.Fatalf("Wanted status 400, found %d", w.Code)
+	}
+}
+
+func TestConsole_replayGuard(t *testing.T) {
+	r := nexmo.NewRouter(nil, &storage.Local{RootDir: t.TempDir()}, "https://example.com", nexmo.RouterOptions{
+		Console: true,
+		Replay:  nexmo.NewReplayGuard(time.Minute, []byte("secret")),
+	})
+
+	w := httptest.NewRecorder()
+	body := `{"kind": "play", "rec_name": "a.mp3", "lang": "en"}`
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/admin/console/send", strings.NewReader(body)))
+	var res struct {
+		Status int `json:"status"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if res.Status != 200 {
+		t.Fatalf("Wanted the unsigned console webhook to pass, found status %d", res.Status)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/play/recording/a.mp3?lang=en", nil))
+	if w.Code != 403 {
+		t.Fatalf("Wanted the unsigned webhook to be rejected, found status %d", w.Code)
+	}
+}
+
+func TestConsole_allowlist(t *testing.T) {
+	l, err := nexmo.NewIPAllowlist([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("Unexpected allowlist error: %v", err)
+	}
+	r := nexmo.NewRouter(nil, &storage.Local{RootDir: t.TempDir()}, "https://example.com", nexmo.RouterOptions{
+		Console:   true,
+		Allowlist: l,
+	})
+
+	w := httptest.NewRecorder()
+	body := `{"kind": "event", "status": "started"}`
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/admin/console/send", strings.NewReader(body)))
+	var res struct {
+		Status int `json:"status"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if res.Status == 403 {
+		t.Fatal("Wanted the console webhook to skip the allowlist")
+	}
+}
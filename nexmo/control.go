@@ -0,0 +1,130 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrCallNotFound is returned when nexmo does not know the
+// call being modified, e.g. because it is already completed.
+var ErrCallNotFound = errors.New("call not found")
+
+// Actions accepted by PUT /v1/calls/{uuid}.
+const (
+	CallHangup    = "hangup"
+	CallMute      = "mute"
+	CallUnmute    = "unmute"
+	CallEarmuff   = "earmuff"
+	CallUnearmuff = "unearmuff"
+	CallTransfer  = "transfer"
+)
+
+// CallDestination is where a call is transferred to: either an
+// inline NCCO or the URL serving it.
+type CallDestination struct {
+	Type string                   `json:"type"`
+	NCCO []map[string]interface{} `json:"ncco,omitempty"`
+	URL  []string                 `json:"url,omitempty"`
+}
+
+// CallUpdate is the body of PUT /v1/calls/{uuid}.
+type CallUpdate struct {
+	Action string `json:"action"`
+	// Destination is required by CallTransfer only.
+	Destination *CallDestination `json:"destination,omitempty"`
+}
+
+func (c *Client) Put(ctx context.Context, url string, body io.Reader) (*http.Response, error) {
+	resp, err := c.doPaced(ctx, CallLimiter, "PUT", url, body, nil)
+	if err != nil {
+		return resp, fmt.Errorf("client: unable to perform Put: %w", err)
+	}
+	return resp, nil
+}
+
+// UpdateCall applies `u` to the call identified by `uuid`.
+// ErrCallNotFound is returned if nexmo does not know it.
+func (c *Client) UpdateCall(ctx context.Context, uuid string, u CallUpdate) error {
+	if u.Action == CallTransfer && u.Destination == nil {
+		return fmt.Errorf("update call: transfer requires a destination")
+	}
+	if u.Destination != nil {
+		if err := c.NCCOLimits.Validate(u.Destination.NCCO); err != nil {
+			return err
+		}
+		for _, v := range u.Destination.URL {
+			if err := c.NCCOLimits.ValidateURL(v); err != nil {
+				return err
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(&u); err != nil {
+		return fmt.Errorf("unable to encode call update: %v", err)
+	}
+	resp, err := c.Put(ctx, c.BaseURL+"/v1/calls/"+uuid, &buf)
+	if resp != nil {
+		resp.Body.Close()
+	}
+	if apiStatus(err) == http.StatusNotFound {
+		return ErrCallNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("unable to %s call: %w", u.Action, err)
+	}
+	return nil
+}
+
+// Hangup terminates the call `uuid`.
+func (c *Client) Hangup(ctx context.Context, uuid string) error {
+	return c.UpdateCall(ctx, uuid, CallUpdate{Action: CallHangup})
+}
+
+// Mute stops the audio of the call `uuid` from being
+// heard by the other parties.
+func (c *Client) Mute(ctx context.Context, uuid string) error {
+	return c.UpdateCall(ctx, uuid, CallUpdate{Action: CallMute})
+}
+
+func (c *Client) Unmute(ctx context.Context, uuid string) error {
+	return c.UpdateCall(ctx, uuid, CallUpdate{Action: CallUnmute})
+}
+
+// Transfer makes the call `uuid` continue with `ncco`.
+func (c *Client) Transfer(ctx context.Context, uuid string, ncco []map[string]interface{}) error {
+	return c.UpdateCall(ctx, uuid, CallUpdate{
+		Action:      CallTransfer,
+		Destination: &CallDestination{Type: "ncco", NCCO: ncco},
+	})
+}
+
+// TransferURL makes the call `uuid` continue with the NCCO
+// served by `answerURL`.
+func (c *Client) TransferURL(ctx context.Context, uuid, answerURL string) error {
+	return c.UpdateCall(ctx, uuid, CallUpdate{
+		Action:      CallTransfer,
+		Destination: &CallDestination{Type: "ncco", URL: []string{answerURL}},
+	})
+}
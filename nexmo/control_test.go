@@ -0,0 +1,44 @@
+package nexmo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+func TestUpdateCall(t *testing.T) {
+	srv, c := newTestClient(t)
+
+	if err := c.Talk(context.TODO(), nexmo.NewContact("393331111111", "Anna"), "ciao"); err != nil {
+		t.Fatalf("Unexpected talk error: %v", err)
+	}
+	uuid := srv.Calls()[0].UUID
+
+	ncco := []map[string]interface{}{{"action": "talk", "text": "arrivederci"}}
+	if err := c.Mute(context.TODO(), uuid); err != nil {
+		t.Fatalf("Unexpected mute error: %v", err)
+	}
+	if err := c.Transfer(context.TODO(), uuid, ncco); err != nil {
+		t.Fatalf("Unexpected transfer error: %v", err)
+	}
+	if err := c.Hangup(context.TODO(), uuid); err != nil {
+		t.Fatalf("Unexpected hangup error: %v", err)
+	}
+	if err := c.Hangup(context.TODO(), "unknown"); err != nexmo.ErrCallNotFound {
+		t.Fatalf("Wanted ErrCallNotFound, found %v", err)
+	}
+
+	updates := srv.Calls()[0].Updates
+	if len(updates) != 3 {
+		t.Fatalf("Wanted 3 updates, found %d", len(updates))
+	}
+	for i, v := range []string{nexmo.CallMute, nexmo.CallTransfer, nexmo.CallHangup} {
+		if updates[i].Action != v {
+			t.Fatalf("Wanted action %d to be %s, found %s", i, v, updates[i].Action)
+		}
+	}
+	if d := updates[1].Destination; d == nil || d.Type != "ncco" || d.NCCO[0]["text"] != "arrivederci" {
+		t.Fatalf("Unexpected transfer destination: %+v", d)
+	}
+}
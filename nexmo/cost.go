@@ -0,0 +1,131 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrOverBudget is returned when a broadcast is refused because
+// its estimated cost exceeds the budget of the CostGuard.
+var ErrOverBudget = errors.New("broadcast over budget")
+
+// PriceTable is the per minute price of the calls, by prefix of
+// the destination number.
+type PriceTable struct {
+	// Prices maps the prefixes, e.g. "39" or "393", to the
+	// price. The longest matching prefix wins.
+	Prices map[string]float64
+	// Default is the price of the numbers matching no prefix.
+	Default float64
+}
+
+// Price returns the per minute price of calling `number`.
+func (t PriceTable) Price(number string) float64 {
+	for i := len(number); i > 0; i-- {
+		if p, ok := t.Prices[number[:i]]; ok {
+			return p
+		}
+	}
+	return t.Default
+}
+
+// CostEstimate is the estimated cost of a broadcast.
+type CostEstimate struct {
+	// Total is the cost of calling every recipient.
+	Total float64 `json:"total"`
+	// Max is the budget, zero if unlimited.
+	Max float64 `json:"max,omitempty"`
+	// Called is the number of recipients called within the
+	// budget, and Cost what calling them costs.
+	Called int     `json:"called"`
+	Cost   float64 `json:"cost"`
+	// Skipped is the number of recipients left out.
+	Skipped int  `json:"skipped,omitempty"`
+	Refused bool `json:"refused,omitempty"`
+}
+
+// CostGuard keeps the estimated cost of each broadcast within a
+// budget. Each recipient is expected to be called once: retries
+// are not accounted for.
+type CostGuard struct {
+	Prices PriceTable
+	// Minutes is the billed length of each call, 1 if zero.
+	Minutes int
+	// MaxPerBroadcast is the budget, unlimited if zero.
+	MaxPerBroadcast float64
+	// Truncate, instead of refusing the whole broadcast, goes
+	// through the recipients in order and calls the ones whose
+	// cost still fits in the budget, skipping the others: a
+	// cheaper recipient listed after an expensive one that did
+	// not fit is still called.
+	Truncate bool
+}
+
+// cost returns the estimated cost of calling `to`.
+func (g *CostGuard) cost(to Contact) float64 {
+	minutes := g.Minutes
+	if minutes < 1 {
+		minutes = 1
+	}
+	return g.Prices.Price(to.Number) * float64(minutes)
+}
+
+// Limit returns the contacts that can be called within the
+// budget, together with the estimate of the broadcast. When the
+// broadcast is refused, no contact is returned.
+func (g *CostGuard) Limit(contacts []Contact) ([]Contact, CostEstimate) {
+	e := CostEstimate{Max: g.MaxPerBroadcast}
+	costs := make([]float64, len(contacts))
+	for i, v := range contacts {
+		costs[i] = g.cost(v)
+		e.Total += costs[i]
+	}
+	e.Total = round(e.Total)
+	if e.Max <= 0 || e.Total <= e.Max {
+		e.Called, e.Cost = len(contacts), e.Total
+		return contacts, e
+	}
+	if !g.Truncate {
+		e.Skipped, e.Refused = len(contacts), true
+		return nil, e
+	}
+
+	allowed := make([]Contact, 0, len(contacts))
+	for i, v := range contacts {
+		if round(e.Cost+costs[i]) > e.Max {
+			continue
+		}
+		e.Cost += costs[i]
+		allowed = append(allowed, v)
+	}
+	e.Cost = round(e.Cost)
+	e.Called, e.Skipped = len(allowed), len(contacts)-len(allowed)
+	return allowed, e
+}
+
+// round rounds `v` to 4 decimal places, hiding the errors of
+// the float sums.
+func round(v float64) float64 {
+	return math.Round(v*1e4) / 1e4
+}
+
+func (e CostEstimate) String() string {
+	return fmt.Sprintf("%.4f for %d recipients, budget %.4f", e.Total, e.Called+e.Skipped, e.Max)
+}
@@ -0,0 +1,88 @@
+package nexmo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestCostGuard(t *testing.T) {
+	g := &nexmo.CostGuard{
+		Prices: nexmo.PriceTable{
+			Prices:  map[string]float64{"39": 0.02, "393": 0.1},
+			Default: 0.5,
+		},
+		Minutes:         2,
+		MaxPerBroadcast: 1,
+	}
+	contacts := []nexmo.Contact{
+		nexmo.NewContact("393331111111", "Anna"),  // 0.2
+		nexmo.NewContact("440201234567", "John"),  // 1
+		nexmo.NewContact("390471123456", "Luca"),  // 0.04
+		nexmo.NewContact("393332222222", "Marco"), // 0.2
+	}
+
+	allowed, e := g.Limit(contacts)
+	if len(allowed) != 0 || !e.Refused || e.Total != 1.44 || e.Skipped != 4 {
+		t.Fatalf("Wanted the broadcast to be refused, found %v and %+v", allowed, e)
+	}
+
+	// John does not fit, the cheaper ones after him still do.
+	g.Truncate = true
+	allowed, e = g.Limit(contacts)
+	if len(allowed) != 3 || allowed[1].Name != "Luca" || allowed[2].Name != "Marco" || e.Cost != 0.44 || e.Called != 3 || e.Skipped != 1 {
+		t.Fatalf("Wanted John to be left out, found %v and %+v", allowed, e)
+	}
+
+	// Once the budget is spent, everybody else is skipped.
+	g.MaxPerBroadcast = 0.25
+	allowed, e = g.Limit(contacts)
+	if len(allowed) != 2 || allowed[0].Name != "Anna" || allowed[1].Name != "Luca" || e.Skipped != 2 {
+		t.Fatalf("Wanted Anna and Luca to be called, found %v and %+v", allowed, e)
+	}
+
+	g.MaxPerBroadcast = 0
+	if allowed, e = g.Limit(contacts); len(allowed) != 4 || e.Cost != e.Total {
+		t.Fatalf("Wanted everybody to be called, found %v and %+v", allowed, e)
+	}
+}
+
+func TestCallBroadcast_costGuard(t *testing.T) {
+	srv, c := newTestClient(t)
+	s, err := storage.NewSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	c.Costs = &nexmo.CostGuard{
+		Prices:          nexmo.PriceTable{Default: 0.1},
+		MaxPerBroadcast: 0.15,
+	}
+
+	contacts := []nexmo.Contact{nexmo.NewContact("393331111111", "Anna"), nexmo.NewContact("393332222222", "Luca")}
+	report, err := c.CallBroadcast(context.TODO(), s, nexmo.Broadcast{RecName: "a.mp3"}, contacts)
+	if err != nexmo.ErrOverBudget {
+		t.Fatalf("Wanted %v, found %v", nexmo.ErrOverBudget, err)
+	}
+	if len(srv.Calls()) != 0 || len(report.Results) != 0 {
+		t.Fatalf("Wanted nobody to be called, found %+v", srv.Calls())
+	}
+
+	c.Costs.Truncate = true
+	if report, err = c.CallBroadcast(context.TODO(), s, nexmo.Broadcast{RecName: "a.mp3"}, contacts); err != nil {
+		t.Fatalf("Unexpected call error: %v", err)
+	}
+	if len(srv.Calls()) != 1 || report.Succeeded != 1 {
+		t.Fatalf("Wanted only Anna to be called, found %+v", srv.Calls())
+	}
+
+	b, err := s.Broadcast(context.TODO(), report.Broadcast.ID)
+	if err != nil {
+		t.Fatalf("Unexpected broadcast error: %v", err)
+	}
+	if b.Cost == nil || b.Cost.Total != 0.2 || b.Cost.Cost != 0.1 || b.Cost.Skipped != 1 {
+		t.Fatalf("Wanted the estimate to be stored, found %+v", b.Cost)
+	}
+}
@@ -0,0 +1,176 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// dashboardHistory is how far back the dashboard looks for
+// broadcasts when no `since` parameter is provided.
+const dashboardHistory = 30 * 24 * time.Hour
+
+// dashboardHandler serves the embedded dashboard under
+// /admin/dashboard/.
+func dashboardHandler() http.Handler {
+	root, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix("/admin/dashboard/", http.FileServer(http.FS(root)))
+}
+
+func makeListRecsHandler(s RecStore, lg *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recs, err := s.ListRecs(r.Context())
+		if err != nil {
+			logger(lg).Printf("list recordings handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"recordings": recs,
+		})
+	}
+}
+
+func makeDeleteRecHandler(s RecStore, cache *RecCache, lg *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+		cache.Forget(name)
+		switch err := s.DeleteRec(r.Context(), name); {
+		case err == ErrRecNotFound:
+			w.WriteHeader(http.StatusNotFound)
+		case err != nil:
+			logger(lg).Printf("delete recording handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+// makeRebroadcastHandler broadcasts again an already stored
+// recording to the current broadcast list or, if the `group`
+// query parameter is set, to the members of that group. The
+// `from` query parameter selects the number shown to them, and
+// the `priority` one the priority of the broadcast.
+func makeRebroadcastHandler(s Storage, c *Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name, group := mux.Vars(r)["name"], r.URL.Query().Get("group")
+		by := "anonymous"
+		if p, ok := PrincipalFromContext(r.Context()); ok {
+			if !p.CanBroadcastTo(group) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			by = p.Name
+		}
+		from, ok := fromQuery(w, r, c)
+		if !ok {
+			return
+		}
+		priority := r.URL.Query().Get("priority")
+		if err := ValidatePriority(priority); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rebroadcast(w, r, s, c, Broadcast{RecName: name, From: from, Priority: priority, RequestedBy: by}, group, by)
+	}
+}
+
+// rebroadcast broadcasts `b`, whose stored recording is played,
+// to the members of `group`, or to the broadcast list if empty,
+// in the background, answering `r` with 202 once started.
+func rebroadcast(w http.ResponseWriter, r *http.Request, s Storage, c *Client, b Broadcast, group, by string) {
+	name := b.RecName
+	rec, _, err := s.OpenRec(r.Context(), name)
+	switch {
+	case err == ErrRecNotFound:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case err != nil:
+		c.logger().Printf("rebroadcast handler: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rec.Close()
+
+	contacts, err := RecipientsOf(r.Context(), s, group, c.Log)
+	switch {
+	case err == ErrNoHistory:
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	case err != nil:
+		c.logger().Printf("rebroadcast handler: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	c.logger().Printf("rebroadcast handler: broadcasting %s again to %d contacts, requested by %s", name, len(contacts), by)
+	go func() {
+		report, err := c.CallBroadcast(context.Background(), s, b, contacts)
+		if err != nil {
+			c.logger().Printf("call error: %v", err)
+			return
+		}
+		c.logger().Printf("call: broadcast of %v done, succeeded: %d, failed: %d", name, report.Succeeded, report.Failed)
+	}()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// makeBroadcastsHandler serves the broadcasts started after the
+// `since` query parameter, in RFC 3339 format, or in the last
+// 30 days if missing.
+func makeBroadcastsHandler(h BroadcastHistory, lg *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		since := time.Now().Add(-dashboardHistory)
+		if v := r.URL.Query().Get("since"); v != "" {
+			var err error
+			if since, err = time.Parse(time.RFC3339, v); err != nil {
+				http.Error(w, "since: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		bs, err := h.Broadcasts(r.Context(), since)
+		switch {
+		case err == ErrNoHistory:
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		case err != nil:
+			logger(lg).Printf("broadcasts handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"broadcasts": bs,
+		})
+	}
+}
@@ -0,0 +1,146 @@
+"use strict";
+
+function el(tag, text) {
+	var e = document.createElement(tag);
+	if (text !== undefined) {
+		e.textContent = text;
+	}
+	return e;
+}
+
+function button(text, onclick) {
+	var b = el("button", text);
+	b.addEventListener("click", onclick);
+	return b;
+}
+
+function row(cells) {
+	var tr = el("tr");
+	cells.forEach(function(c) {
+		var td = el("td");
+		if (c instanceof Node) {
+			td.appendChild(c);
+		} else {
+			td.textContent = c;
+		}
+		tr.appendChild(td);
+	});
+	return tr;
+}
+
+function when(s) {
+	return s ? new Date(s).toLocaleString() : "-";
+}
+
+function size(n) {
+	if (n < 1024) {
+		return n + " B";
+	}
+	if (n < 1024 * 1024) {
+		return (n / 1024).toFixed(1) + " KiB";
+	}
+	return (n / 1024 / 1024).toFixed(1) + " MiB";
+}
+
+// length formats a duration, in nanoseconds.
+function length(ns) {
+	if (!ns) {
+		return "-";
+	}
+	var s = Math.round(ns / 1e9);
+	return Math.floor(s / 60) + ":" + ("0" + s % 60).slice(-2);
+}
+
+function check(r) {
+	if (r.status === 401) {
+		// The session expired: reloading goes through the login.
+		location.reload();
+	}
+	if (!r.ok) {
+		throw new Error(r.status + " " + r.statusText);
+	}
+	return r;
+}
+
+function loadRecordings() {
+	fetch("/admin/recordings").then(check).then(function(r) { return r.json(); }).then(function(data) {
+		var body = document.querySelector("#recordings tbody");
+		body.textContent = "";
+		(data.recordings || []).sort(function(a, b) {
+			return new Date(b.created_at) - new Date(a.created_at);
+		}).forEach(function(rec) {
+			var audio = el("audio");
+			audio.controls = true;
+			audio.preload = "none";
+			audio.src = "/static/" + encodeURIComponent(rec.name);
+
+			var actions = el("span");
+			actions.appendChild(button("Broadcast again", function() { rebroadcast(rec.name); }));
+			actions.appendChild(button("Delete", function() { remove(rec.name); }));
+			var broadcasts = (rec.broadcasts || []).join(", ") || "-";
+			body.appendChild(row([rec.name, when(rec.created_at), rec.caller || "-", length(rec.duration), size(rec.size), broadcasts, audio, actions]));
+		});
+	}).catch(function(err) { alert("Unable to list recordings: " + err.message); });
+}
+
+function rebroadcast(name) {
+	if (!confirm("Broadcast " + name + " again to the whole broadcast list?")) {
+		return;
+	}
+	fetch("/admin/recordings/" + encodeURIComponent(name) + "/broadcast", {method: "POST"}).then(check).then(function() {
+		setTimeout(loadBroadcasts, 1000);
+	}).catch(function(err) { alert("Unable to broadcast " + name + ": " + err.message); });
+}
+
+function remove(name) {
+	if (!confirm("Delete " + name + "? This cannot be undone.")) {
+		return;
+	}
+	fetch("/admin/recordings/" + encodeURIComponent(name), {method: "DELETE"}).then(check).then(loadRecordings)
+		.catch(function(err) { alert("Unable to delete " + name + ": " + err.message); });
+}
+
+function loadBroadcasts() {
+	fetch("/admin/broadcasts").then(function(r) {
+		if (r.status === 404 || r.status === 501) {
+			document.getElementById("no-history").hidden = false;
+			document.getElementById("broadcasts").hidden = true;
+			return {broadcasts: []};
+		}
+		return check(r).json();
+	}).then(function(data) {
+		var body = document.querySelector("#broadcasts tbody");
+		body.textContent = "";
+		(data.broadcasts || []).sort(function(a, b) { return b.id - a.id; }).forEach(function(b) {
+			body.appendChild(row([b.id, b.rec_name || (b.audio ? "audio: " + b.audio : "live: " + b.conference), when(b.created_at), button("Details", function() { loadReport(b.id); })]));
+		});
+	}).catch(function(err) { alert("Unable to list broadcasts: " + err.message); });
+}
+
+function loadReport(id) {
+	fetch("/broadcasts/" + id + "/report").then(check).then(function(r) { return r.json(); }).then(function(report) {
+		document.getElementById("report-id").textContent = id;
+		document.getElementById("report-summary").textContent =
+			report.reached + " reached, " + report.unreached + " unreached";
+		document.getElementById("report-pdf").href = "/broadcasts/" + id + "/report.pdf";
+
+		var body = document.getElementById("report-recipients");
+		body.textContent = "";
+		(report.recipients || []).forEach(function(rr) {
+			var status = el("span", rr.reached ? "reached" : "unreached");
+			status.className = rr.reached ? "reached" : "unreached";
+			if (rr.attempts === 0) {
+				status.textContent = "not called";
+				status.className = "uncalled";
+			}
+			body.appendChild(row([
+				rr.number, rr.name || "", rr.attempts, status,
+				rr.attempts > 0 ? when(rr.last_attempt) : "-", rr.last_error || ""
+			]));
+		});
+		document.getElementById("report").hidden = false;
+	}).catch(function(err) { alert("Unable to load report " + id + ": " + err.message); });
+}
+
+loadRecordings();
+loadBroadcasts();
@@ -0,0 +1,82 @@
+package nexmo_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestDashboard(t *testing.T) {
+	dir, err := ioutil.TempDir("", "voicebr-dashboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &storage.Local{RootDir: dir}
+	if _, err := s.WriteRec(context.Background(), strings.NewReader("data"), "a.mp3", nexmo.RecMeta{}); err != nil {
+		t.Fatalf("Unexpected write error: %v", err)
+	}
+	r := nexmo.NewRouter(nil, s, "https://example.com", nexmo.RouterOptions{Dashboard: true})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/admin/dashboard/", nil))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "app.js") {
+		t.Fatalf("Unexpected dashboard response: %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/admin/recordings", nil))
+	var res struct {
+		Recordings []nexmo.RecMeta `json:"recordings"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if len(res.Recordings) != 1 || res.Recordings[0].Name != "a.mp3" {
+		t.Fatalf("Unexpected recordings: %+v", res.Recordings)
+	}
+
+	for _, code := range []int{204, 404} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("DELETE", "/admin/recordings/a.mp3", nil))
+		if w.Code != code {
+			t.Fatalf("Wanted status %d, found %d", code, w.Code)
+		}
+	}
+}
+
+func TestWebhooksOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "voicebr-dashboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &storage.Local{RootDir: dir}
+	if _, err := s.WriteRec(context.Background(), strings.NewReader("data"), "a.mp3", nexmo.RecMeta{}); err != nil {
+		t.Fatalf("Unexpected write error: %v", err)
+	}
+	h := nexmo.WebhooksOnly(nexmo.NewRouter(nil, s, "https://example.com", nexmo.RouterOptions{Dashboard: true}))
+
+	for path, code := range map[string]int{
+		"/static/a.mp3":                 200,
+		"/admin/dashboard/":             404,
+		"/admin/recordings":             404,
+		"/static/../admin/recordings":   404,
+		"/play/recording/../../admin/x": 404,
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != code {
+			t.Fatalf("%s: wanted status %d, found %d", path, code, w.Code)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// IP families of DialOptions.
+const (
+	// IPAny lets the system order the addresses, racing the
+	// families as in RFC 6555 ("happy eyeballs").
+	IPAny      = ""
+	PreferIPv4 = "prefer-ipv4"
+	PreferIPv6 = "prefer-ipv6"
+	IPv4Only   = "ipv4"
+	IPv6Only   = "ipv6"
+)
+
+// DefaultFallbackDelay is how long the preferred family is
+// tried alone before racing the other one.
+const DefaultFallbackDelay = 300 * time.Millisecond
+
+// DefaultDialTimeout bounds the establishment of the
+// connections.
+const DefaultDialTimeout = 30 * time.Second
+
+// DialOptions configures the connections the client opens
+// towards nexmo, for the hosts where the egress address matters,
+// e.g. because of NATs or of allowlists.
+type DialOptions struct {
+	// Family is one of the IP* or Prefer* constants.
+	Family string
+	// LocalAddr is the source IP of the connections.
+	LocalAddr string
+	// Interface is the network interface whose addresses are
+	// used as source IPs. It excludes LocalAddr.
+	Interface string
+	// FallbackDelay overrides DefaultFallbackDelay when
+	// positive. When negative, the families are tried one
+	// after the other.
+	FallbackDelay time.Duration
+	// Timeout bounds the establishment of each connection,
+	// DefaultDialTimeout if zero.
+	Timeout time.Duration
+}
+
+// Dialer opens connections as configured by DialOptions.
+type Dialer struct {
+	family  string
+	delay   time.Duration
+	timeout time.Duration
+	// local4 and local6 are the source IPs of each family,
+	// nil to let the system choose.
+	local4, local6 net.IP
+}
+
+// NewDialer checks `o`, resolving its interface if any.
+func NewDialer(o DialOptions) (*Dialer, error) {
+	d := &Dialer{family: o.Family, delay: o.FallbackDelay, timeout: o.Timeout}
+	if d.delay == 0 {
+		d.delay = DefaultFallbackDelay
+	}
+	if d.timeout == 0 {
+		d.timeout = DefaultDialTimeout
+	}
+	switch o.Family {
+	case IPAny, PreferIPv4, PreferIPv6, IPv4Only, IPv6Only:
+	default:
+		return nil, fmt.Errorf("dialer: unknown family %q", o.Family)
+	}
+
+	var ips []net.IP
+	switch {
+	case o.LocalAddr != "" && o.Interface != "":
+		return nil, fmt.Errorf("dialer: set either a local address or an interface")
+	case o.LocalAddr != "":
+		ip := net.ParseIP(o.LocalAddr)
+		if ip == nil {
+			return nil, fmt.Errorf("dialer: %q is not an IP address", o.LocalAddr)
+		}
+		ips = append(ips, ip)
+	case o.Interface != "":
+		iface, err := net.InterfaceByName(o.Interface)
+		if err != nil {
+			return nil, fmt.Errorf("dialer: %v", err)
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("dialer: addresses of %s: %v", o.Interface, err)
+		}
+		for _, v := range addrs {
+			if n, ok := v.(*net.IPNet); ok && !n.IP.IsLinkLocalUnicast() {
+				ips = append(ips, n.IP)
+			}
+		}
+		if len(ips) == 0 {
+			return nil, fmt.Errorf("dialer: %s has no usable address", o.Interface)
+		}
+	}
+	for _, v := range ips {
+		if v.To4() != nil && d.local4 == nil {
+			d.local4 = v
+		} else if v.To4() == nil && d.local6 == nil {
+			d.local6 = v
+		}
+	}
+	if len(ips) > 0 {
+		// Without a source address, a family is unusable.
+		switch {
+		case d.local4 == nil && (o.Family == IPv4Only || o.Family == PreferIPv4):
+			return nil, fmt.Errorf("dialer: no IPv4 source address")
+		case d.local6 == nil && (o.Family == IPv6Only || o.Family == PreferIPv6):
+			return nil, fmt.Errorf("dialer: no IPv6 source address")
+		case d.local4 == nil:
+			d.family = IPv6Only
+		case d.local6 == nil:
+			d.family = IPv4Only
+		}
+	}
+	return d, nil
+}
+
+func (d *Dialer) dialer(network string) *net.Dialer {
+	nd := &net.Dialer{
+		Timeout:       d.timeout,
+		KeepAlive:     30 * time.Second,
+		FallbackDelay: d.delay,
+	}
+	local := d.local4
+	if network == "tcp6" {
+		local = d.local6
+	}
+	if local != nil {
+		nd.LocalAddr = &net.TCPAddr{IP: local}
+	}
+	return nd
+}
+
+// DialContext connects to `addr`, restricting `network` to the
+// configured family.
+func (d *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if network != "tcp" {
+		return d.dialer(network).DialContext(ctx, network, addr)
+	}
+	switch d.family {
+	case IPv4Only:
+		return d.dialer("tcp4").DialContext(ctx, "tcp4", addr)
+	case IPv6Only:
+		return d.dialer("tcp6").DialContext(ctx, "tcp6", addr)
+	case PreferIPv4:
+		return d.race(ctx, "tcp4", "tcp6", addr)
+	case PreferIPv6:
+		return d.race(ctx, "tcp6", "tcp4", addr)
+	default:
+		if d.local4 != nil || d.local6 != nil {
+			return d.race(ctx, "tcp6", "tcp4", addr)
+		}
+		return d.dialer("tcp").DialContext(ctx, "tcp", addr)
+	}
+}
+
+// race dials `addr` over `primary`, and over `fallback` too if
+// the former fails or takes longer than the fallback delay. The
+// first connection established wins.
+func (d *Dialer) race(ctx context.Context, primary, fallback, addr string) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn    net.Conn
+		err     error
+		primary bool
+	}
+	results := make(chan result, 2)
+	dial := func(network string) {
+		conn, err := d.dialer(network).DialContext(ctx, network, addr)
+		results <- result{conn, err, network == primary}
+	}
+	go dial(primary)
+	pending, fellBack := 1, false
+	fallBack := func() {
+		fellBack = true
+		pending++
+		go dial(fallback)
+	}
+
+	var timer <-chan time.Time
+	if d.delay > 0 {
+		t := time.NewTimer(d.delay)
+		defer t.Stop()
+		timer = t.C
+	}
+	var firstErr error
+	for {
+		select {
+		case <-timer:
+			if !fellBack {
+				fallBack()
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				// Close the loser, if it connects anyway.
+				go func(n int) {
+					for ; n > 0; n-- {
+						if r := <-results; r.conn != nil {
+							r.conn.Close()
+						}
+					}
+				}(pending)
+				return r.conn, nil
+			}
+			if firstErr == nil || r.primary {
+				firstErr = r.err
+			}
+			if !fellBack {
+				fallBack()
+			} else if pending == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
+
+// SetDialOptions makes the client connect to nexmo as
+// configured by `o`, see SetTransportOptions.
+func (c *Client) SetDialOptions(o DialOptions) error {
+	return c.SetTransportOptions(TransportOptions{Dial: o})
+}
@@ -0,0 +1,59 @@
+package nexmo_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+func TestDialer(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	for _, o := range []nexmo.DialOptions{
+		{Family: nexmo.IPv4Only, LocalAddr: "127.0.0.1"},
+		// The IPv6 loopback is not listening: IPv4 is
+		// fallen back to.
+		{Family: nexmo.PreferIPv6},
+		{Family: nexmo.PreferIPv6, FallbackDelay: -1},
+	} {
+		d, err := nexmo.NewDialer(o)
+		if err != nil {
+			t.Fatalf("Unexpected dialer error: %v", err)
+		}
+		conn, err := d.DialContext(context.TODO(), "tcp", net.JoinHostPort("localhost", port))
+		if err != nil {
+			t.Fatalf("%+v: unexpected dial error: %v", o, err)
+		}
+		if ip := conn.LocalAddr().(*net.TCPAddr).IP; ip.To4() == nil {
+			t.Fatalf("%+v: wanted an IPv4 connection, found %v", o, ip)
+		}
+		conn.Close()
+	}
+
+	for _, o := range []nexmo.DialOptions{
+		{Family: "ipv5"},
+		{LocalAddr: "localhost"},
+		{Family: nexmo.IPv6Only, LocalAddr: "127.0.0.1"},
+		{LocalAddr: "127.0.0.1", Interface: "lo"},
+	} {
+		if _, err := nexmo.NewDialer(o); err == nil {
+			t.Fatalf("%+v: wanted an error", o)
+		}
+	}
+}
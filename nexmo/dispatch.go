@@ -0,0 +1,238 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultWorkers matches the number of calls per second
+// allowed by CallLimiter: more workers would only wait
+// on the limiter.
+const DefaultWorkers = 3
+
+// CallResult is the outcome of delivering a message to a contact.
+type CallResult struct {
+	Contact  Contact `json:"contact"`
+	Attempts int     `json:"attempts"`
+	Err      error   `json:"-"`
+	// Error is the message of Err, for the JSON encoding.
+	Error string `json:"error,omitempty"`
+}
+
+func newCallResult(to Contact, attempts int, err error) CallResult {
+	r := CallResult{Contact: to, Attempts: attempts, Err: err}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// BroadcastReport aggregates the results of a broadcast.
+type BroadcastReport struct {
+	Broadcast Broadcast    `json:"broadcast"`
+	Results   []CallResult `json:"results"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+}
+
+// Dispatch calls each contact using a bounded pool of workers,
+// retrying according to each contact's delivery policy, raised
+// by the client's EmergencyOptions for emergency broadcasts. The
+// results are sent on the returned channel as soon as they are
+// available; the channel is closed when every contact has been
+// processed. `onAttempt`, if not nil, is called after each call
+// attempt. The recording played is `b`'s. The contacts in their
+// quiet hours are called once these are over, or not at all when
+// `b` is live.
+func (c *Client) Dispatch(ctx context.Context, contacts []Contact, b Broadcast, onAttempt func(Contact, int, error)) <-chan CallResult {
+	workers := c.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(contacts) {
+		workers = len(contacts)
+	}
+
+	jobs := make(chan Contact)
+	results := make(chan CallResult)
+	ctx, cancel := context.WithCancel(ctx)
+	qid := c.Queue.add(b, len(contacts), workers, cancel)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for contact := range jobs {
+				c.Queue.dequeued(qid)
+				res := c.deliver(ctx, contact, b, onAttempt)
+				c.Queue.delivered(qid, res.Err)
+				results <- res
+			}
+		}()
+	}
+
+	go func() {
+		// The contacts in their quiet hours wait in a single
+		// queue, ordered by when they can be called.
+		var deferred []deferredContact
+		now := time.Now()
+		for _, v := range contacts {
+			at := c.callableAt(v, now)
+			switch {
+			case !at.After(now):
+				jobs <- v
+			case b.live():
+				c.Queue.dequeued(qid)
+				c.Queue.delivered(qid, ErrQuietHours)
+				results <- newCallResult(v, 0, ErrQuietHours)
+			default:
+				c.logger().Printf("call: deferring %v until %v, in quiet hours", v.Number, at)
+				c.Queue.deferred(qid, 1)
+				deferred = append(deferred, deferredContact{v, at})
+			}
+		}
+		sort.SliceStable(deferred, func(i, j int) bool {
+			return deferred[i].at.Before(deferred[j].at)
+		})
+		for _, v := range deferred {
+			t := time.NewTimer(time.Until(v.at))
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+			}
+			t.Stop()
+			c.Queue.deferred(qid, -1)
+			jobs <- v.contact
+		}
+		close(jobs)
+		wg.Wait()
+		c.Queue.finish(qid)
+		cancel()
+		close(results)
+	}()
+
+	return results
+}
+
+// deferredContact is a contact that cannot be called until `at`.
+type deferredContact struct {
+	contact Contact
+	at      time.Time
+}
+
+// deliver calls `to` until either the call is placed or its
+// delivery policy does not allow further attempts.
+func (c *Client) deliver(ctx context.Context, to Contact, b Broadcast, onAttempt func(Contact, int, error)) CallResult {
+	policy := to.Policy.Merge(c.Policy)
+	if b.emergency() {
+		ctx = withUrgency(ctx)
+		policy = c.Emergency.escalate(policy)
+		if text := c.Emergency.SMS; text != "" {
+			go func() {
+				// The SMS outlives the broadcast, which
+				// may end before it is sent.
+				ctx, cancel := context.WithTimeout(withUrgency(context.Background()), time.Minute)
+				defer cancel()
+				if err := c.SendSMS(ctx, to, text); err != nil {
+					c.logger().Printf("call: unable to text %v: %v", to.Number, err)
+				}
+			}()
+		}
+	}
+	for i := 1; ; i++ {
+		if err := ctx.Err(); err != nil {
+			return newCallResult(to, i-1, err)
+		}
+		if c.Breaker.Open() {
+			// The queued calls fail fast instead of piling
+			// up on an unavailable API.
+			return newCallResult(to, i-1, ErrCircuitOpen)
+		}
+
+		c.logger().Printf("calling %v (attempt %d/%d), message: %v", to.Name, i, policy.MaxAttempts, b.RecName)
+		err := c.callWithTimeout(ctx, to, b, policy)
+		if onAttempt != nil {
+			onAttempt(to, i, err)
+		}
+		if err == nil {
+			return newCallResult(to, i, nil)
+		}
+		c.logger().Printf("call error: %v", err)
+		if _, ok := err.(*NCCOError); ok || errors.Is(err, ErrUnauthorized) {
+			// The same call would be rejected again.
+			return newCallResult(to, i, err)
+		}
+		if i >= policy.MaxAttempts {
+			c.logger().Printf("call: giving up on %v after %d attempts", to.Name, i)
+			return newCallResult(to, i, err)
+		}
+		if c.Breaker.Open() {
+			c.logger().Printf("call: giving up on %v, the API is unavailable", to.Name)
+			return newCallResult(to, i, ErrCircuitOpen)
+		}
+
+		next := time.Now().Add(policy.RetrySpacing)
+		if at := c.callableAt(to, next); at.After(next) && !b.live() {
+			c.logger().Printf("call: deferring %v until %v, in quiet hours", to.Number, at)
+			next = at
+		}
+		select {
+		case <-time.After(time.Until(next)):
+		case <-ctx.Done():
+		}
+	}
+}
+
+// callWithTimeout calls `to` once Pacer allows it: CallTimeout
+// bounds the call, not the wait.
+func (c *Client) callWithTimeout(ctx context.Context, to Contact, b Broadcast, policy DeliveryPolicy) error {
+	merged := true
+	err := c.Pacer.Do(ctx, to.Number, b, func(then []Broadcast) error {
+		merged = false
+		ctx := ctx
+		if c.CallTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, c.CallTimeout)
+			defer cancel()
+		}
+		return c.call(ctx, to, b, policy, then...)
+	})
+	if merged && err == nil {
+		c.logger().Printf("call: %v of %v merged into a call of another broadcast", b.RecName, to.Number)
+	}
+	return err
+}
+
+// CollectResults drains `results`, aggregating them.
+func CollectResults(results <-chan CallResult) *BroadcastReport {
+	acc := &BroadcastReport{Results: []CallResult{}}
+	for v := range results {
+		acc.Results = append(acc.Results, v)
+		if v.Err == nil {
+			acc.Succeeded++
+		} else {
+			acc.Failed++
+		}
+	}
+	return acc
+}
@@ -0,0 +1,44 @@
+package nexmo_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+func TestDispatch_workers(t *testing.T) {
+	srv, c := newTestClient(t)
+	c.Workers = 2
+
+	var mu sync.Mutex
+	active, max := 0, 0
+	srv.Fail = func(to string) int {
+		mu.Lock()
+		if active++; active > max {
+			max = active
+		}
+		mu.Unlock()
+		// Hold the call, so that the next ones pile up.
+		time.Sleep(400 * time.Millisecond)
+		mu.Lock()
+		active--
+		mu.Unlock()
+		return 0
+	}
+
+	var contacts []nexmo.Contact
+	for i := 0; i < 5; i++ {
+		contacts = append(contacts, nexmo.NewContact(fmt.Sprintf("39333111111%d", i), ""))
+	}
+	report := nexmo.CollectResults(c.Dispatch(context.TODO(), contacts, nexmo.Broadcast{RecName: "rec.mp3"}, nil))
+	if report.Succeeded != len(contacts) {
+		t.Fatalf("Wanted %d calls, found %+v", len(contacts), report.Results)
+	}
+	if max < 1 || max > c.Workers {
+		t.Fatalf("Wanted at most %d concurrent calls, found %d", c.Workers, max)
+	}
+}
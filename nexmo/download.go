@@ -0,0 +1,268 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultDownloadWindow is the time a recording download is
+// retried for, when no other window is configured.
+const DefaultDownloadWindow = 10 * time.Minute
+
+// DefaultMaxRecSize is the size of the largest recording that is
+// downloaded, when no other limit is configured. It fits about
+// two hours of mp3 recorded by nexmo.
+const DefaultMaxRecSize = 128 << 20
+
+// DefaultDownloadAttemptTimeout is the time each download
+// attempt is given, when no other timeout is configured.
+const DefaultDownloadAttemptTimeout = 2 * time.Minute
+
+const (
+	minDownloadBackoff = time.Second
+	maxDownloadBackoff = time.Minute
+)
+
+// ErrRecTooLarge is returned when a recording exceeds the
+// maximum size of the downloads.
+var ErrRecTooLarge = errors.New("recording exceeds the maximum size")
+
+// ErrForeignRec is returned when a recording is not served by
+// nexmo, which would receive the application token.
+var ErrForeignRec = errors.New("recording not hosted by nexmo")
+
+// contentTypeError reports a download whose content is not
+// a recording, e.g. an error page.
+type contentTypeError string
+
+func (e contentTypeError) Error() string {
+	return fmt.Sprintf("unexpected content type %q", string(e))
+}
+
+// DownloadOptions limits the recording downloads.
+type DownloadOptions struct {
+	// Window is the time failed downloads are retried for,
+	// DefaultDownloadWindow if zero.
+	Window time.Duration
+	// AttemptTimeout is the time each attempt is given,
+	// DefaultDownloadAttemptTimeout if zero.
+	AttemptTimeout time.Duration
+	// MaxSize is the size of the largest recording accepted,
+	// DefaultMaxRecSize if zero.
+	MaxSize int64
+	// ContentTypes, when not empty, are the MIME types accepted,
+	// see RecContentTypes. Contents served as a generic binary
+	// stream are accepted if they look like a recording.
+	ContentTypes []string
+}
+
+func (o DownloadOptions) window() time.Duration {
+	if o.Window <= 0 {
+		return DefaultDownloadWindow
+	}
+	return o.Window
+}
+
+func (o DownloadOptions) attemptTimeout() time.Duration {
+	if o.AttemptTimeout <= 0 {
+		return DefaultDownloadAttemptTimeout
+	}
+	return o.AttemptTimeout
+}
+
+func (o DownloadOptions) maxSize() int64 {
+	if o.MaxSize <= 0 {
+		return DefaultMaxRecSize
+	}
+	return o.MaxSize
+}
+
+// DownloadRec downloads the recording at `url`. Failed downloads
+// are retried with an exponential backoff as long as the next
+// attempt starts within the window of `opts` from the first one.
+// Downloads interrupted while reading the body are resumed from
+// where they stopped, when the server supports range requests.
+// Recordings that are too large or of an unexpected content type
+// are rejected without retrying, and the ones not hosted by nexmo
+// are not even requested.
+func (c *Client) DownloadRec(ctx context.Context, url string, opts DownloadOptions) (data []byte, err error) {
+	ctx, span := startSpan(ctx, "recording.download", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() {
+		span.SetAttributes(attribute.Int("voicebr.rec_size", len(data)))
+		endSpan(span, err)
+	}()
+
+	if !c.hostsRec(url) {
+		return nil, fmt.Errorf("download rec: %s: %w", url, ErrForeignRec)
+	}
+
+	start := time.Now()
+	wait := minDownloadBackoff
+	var buf bytes.Buffer
+	for i := 1; ; i++ {
+		err := c.downloadRec(ctx, url, &buf, opts)
+		if err == nil {
+			data := buf.Bytes()
+			c.logger().Printf("download rec: %s: %d bytes, sha256 %x", url, len(data), sha256.Sum256(data))
+			return data, nil
+		}
+		if _, ok := err.(contentTypeError); ok || err == ErrRecTooLarge {
+			return nil, fmt.Errorf("download rec: %v", err)
+		}
+		if time.Since(start)+wait > opts.window() {
+			return nil, fmt.Errorf("download rec: giving up after %d attempts: %v", i, err)
+		}
+		c.logger().Printf("download rec: attempt %d failed after %d bytes, retrying in %v: %v", i, buf.Len(), wait, err)
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if wait *= 2; wait > maxDownloadBackoff {
+			wait = maxDownloadBackoff
+		}
+	}
+}
+
+// hostsRec returns true if `src` is served by nexmo, which is
+// the only host the requests carrying the application token
+// may be forwarded to.
+func (c *Client) hostsRec(src string) bool {
+	u, err := url.Parse(src)
+	if err != nil || u.Scheme != "https" && u.Scheme != "http" {
+		return false
+	}
+	if base, err := url.Parse(c.BaseURL); err == nil && u.Host == base.Host {
+		return true
+	}
+	host := u.Hostname()
+	return strings.HasSuffix(host, ".nexmo.com") || strings.HasSuffix(host, ".vonage.com")
+}
+
+// downloadRec appends the recording at `url` to `buf`, asking
+// only for the bytes following the ones already in `buf`.
+func (c *Client) downloadRec(ctx context.Context, url string, buf *bytes.Buffer, opts DownloadOptions) error {
+	ctx, cancel := context.WithTimeout(ctx, opts.attemptTimeout())
+	defer cancel()
+
+	var header http.Header
+	if buf.Len() > 0 {
+		header = http.Header{"Range": {fmt.Sprintf("bytes=%d-", buf.Len())}}
+	}
+	resp, err := c.doPaced(ctx, GetLimiter, "GET", url, nil, header)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if apiStatus(err) == http.StatusRequestedRangeNotSatisfiable {
+		buf.Reset()
+		return fmt.Errorf("resume refused, starting over")
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case resp.StatusCode != http.StatusPartialContent:
+		// The server ignored the range, if any.
+		buf.Reset()
+	case rangeStart(resp.Header.Get("Content-Range")) != int64(buf.Len()):
+		buf.Reset()
+		return fmt.Errorf("unexpected content range %q, starting over", resp.Header.Get("Content-Range"))
+	}
+	max := opts.maxSize()
+	if resp.ContentLength > 0 && int64(buf.Len())+resp.ContentLength > max {
+		return ErrRecTooLarge
+	}
+	if buf.Len() == 0 {
+		if err := checkContentType(resp, opts.ContentTypes); err != nil {
+			return err
+		}
+	}
+
+	n, err := io.Copy(buf, io.LimitReader(resp.Body, max-int64(buf.Len())+1))
+	if int64(buf.Len()) > max {
+		return ErrRecTooLarge
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read body: %v", err)
+	}
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return fmt.Errorf("body truncated at %d of %d bytes", n, resp.ContentLength)
+	}
+	if buf.Len() > 0 && len(opts.ContentTypes) > 0 && isGenericContentType(resp) && SniffRecFormat(buf.Bytes()) == "" {
+		ct := resp.Header.Get("Content-Type")
+		buf.Reset()
+		return contentTypeError(ct)
+	}
+	return nil
+}
+
+// rangeStart returns the first byte of the Content-Range header
+// `v`, e.g. 100 for "bytes 100-199/200", or -1 if invalid.
+func rangeStart(v string) int64 {
+	v = strings.TrimPrefix(v, "bytes ")
+	i := strings.IndexByte(v, '-')
+	if i < 0 {
+		return -1
+	}
+	n, err := strconv.ParseInt(v[:i], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+func isGenericContentType(resp *http.Response) bool {
+	t, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return t == "" || t == "application/octet-stream" || t == "binary/octet-stream"
+}
+
+// checkContentType returns a contentTypeError if `resp` is neither
+// of `accepted` nor a generic binary stream, which is checked once
+// downloaded. Anything is accepted if `accepted` is empty.
+func checkContentType(resp *http.Response, accepted []string) error {
+	if len(accepted) == 0 || isGenericContentType(resp) {
+		return nil
+	}
+	ct := resp.Header.Get("Content-Type")
+	t, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return contentTypeError(ct)
+	}
+	for _, v := range accepted {
+		if strings.EqualFold(t, v) {
+			return nil
+		}
+	}
+	return contentTypeError(ct)
+}
@@ -0,0 +1,128 @@
+package nexmo_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+func TestDownloadRec_retry(t *testing.T) {
+	_, c := newTestClient(t)
+
+	var mu sync.Mutex
+	requests := 0
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if requests++; requests == 1 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("fake mp3"))
+	}))
+	defer flaky.Close()
+	c.BaseURL = flaky.URL
+
+	data, err := c.DownloadRec(context.TODO(), flaky.URL, nexmo.DownloadOptions{Window: time.Minute})
+	if err != nil {
+		t.Fatalf("Unexpected download error: %v", err)
+	}
+	if string(data) != "fake mp3" || requests != 2 {
+		t.Fatalf("Wanted the recording after 2 requests, found %q after %d", data, requests)
+	}
+}
+
+func TestDownloadRec_resume(t *testing.T) {
+	_, c := newTestClient(t)
+
+	data := []byte("ID3 fake mp3 recording")
+	var ranges []string
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Header().Set("Content-Type", "audio/mpeg")
+		if len(ranges) == 1 {
+			// Drop the connection halfway.
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			w.Write(data[:10])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 10-%d/%d", len(data)-1, len(data)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(data[10:])
+	}))
+	defer flaky.Close()
+	c.BaseURL = flaky.URL
+
+	opts := nexmo.DownloadOptions{Window: time.Minute, ContentTypes: nexmo.RecContentTypes(nexmo.FormatMP3)}
+	got, err := c.DownloadRec(context.TODO(), flaky.URL, opts)
+	if err != nil {
+		t.Fatalf("Unexpected download error: %v", err)
+	}
+	if string(got) != string(data) || len(ranges) != 2 || ranges[1] != "bytes=10-" {
+		t.Fatalf("Wanted the resumed recording, found %q after ranges %q", got, ranges)
+	}
+}
+
+func TestDownloadRec_rejected(t *testing.T) {
+	_, c := newTestClient(t)
+
+	tt := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{"error page", "text/html", "<html>oops</html>"},
+		{"not audio", "application/octet-stream", "definitely not a recording"},
+		{"too large", "audio/mpeg", "ID3" + strings.Repeat("x", 64)},
+	}
+	for _, v := range tt {
+		requests := 0
+		bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Header().Set("Content-Type", v.contentType)
+			w.Write([]byte(v.body))
+		}))
+		c.BaseURL = bad.URL
+		opts := nexmo.DownloadOptions{
+			Window:       time.Minute,
+			MaxSize:      32,
+			ContentTypes: nexmo.RecContentTypes(nexmo.FormatMP3),
+		}
+		if _, err := c.DownloadRec(context.TODO(), bad.URL, opts); err == nil {
+			t.Fatalf("%s: wanted download error", v.name)
+		}
+		if requests != 1 {
+			t.Fatalf("%s: wanted no retries, found %d requests", v.name, requests)
+		}
+		bad.Close()
+	}
+}
+
+func TestDownloadRec_foreign(t *testing.T) {
+	_, c := newTestClient(t)
+
+	var auth []string
+	foreign := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = append(auth, r.Header.Get("Authorization"))
+		w.Write([]byte("fake mp3"))
+	}))
+	defer foreign.Close()
+
+	_, err := c.DownloadRec(context.TODO(), foreign.URL+"/v1/files/rec", nexmo.DownloadOptions{Window: time.Minute})
+	if !errors.Is(err, nexmo.ErrForeignRec) {
+		t.Fatalf("Wanted %v, found %v", nexmo.ErrForeignRec, err)
+	}
+	if len(auth) != 0 {
+		t.Fatalf("Wanted no requests to the foreign host, found %d carrying %q", len(auth), auth)
+	}
+}
@@ -0,0 +1,222 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// DefaultSimilarity is the default similarity above which
+// two recordings are considered duplicates.
+const DefaultSimilarity = 0.95
+
+// envelopeFrame is the duration summarized by each value
+// of a fingerprint envelope.
+const envelopeFrame = 100 * time.Millisecond
+
+// maxEnvelopeShift is the number of frames the envelopes are
+// shifted by when comparing them, so that recordings starting
+// a bit earlier or later still match.
+const maxEnvelopeShift = 10
+
+// Fingerprint identifies the content of a recording.
+type Fingerprint struct {
+	// Hash is the SHA-256 of the recording file.
+	Hash string
+	// Envelope is the loudness of each envelopeFrame of the
+	// audio, normalized to its peak. It is empty if the
+	// recording could not be decoded.
+	Envelope []float64
+}
+
+// NewFingerprint returns the fingerprint of the recording
+// `data`, encoded in `format`. The audio is decoded natively
+// if it is a PCM wav file, with ffmpeg otherwise. Recordings
+// that cannot be decoded are fingerprinted by hash alone.
+func NewFingerprint(ctx context.Context, data []byte, format string) Fingerprint {
+	h := sha256.Sum256(data)
+	f := Fingerprint{Hash: hex.EncodeToString(h[:])}
+
+	wav := data
+	if format != FormatWAV {
+		var err error
+		if wav, err = decodeFFmpeg(ctx, data, format); err != nil {
+			return f
+		}
+	}
+	if env, err := envelope(wav); err == nil {
+		f.Envelope = env
+	}
+	return f
+}
+
+// decodeFFmpeg converts `data` to a 8kHz mono wav file.
+func decodeFFmpeg(ctx context.Context, data []byte, format string) ([]byte, error) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-loglevel", "error",
+		"-f", format, "-i", "pipe:0", "-ac", "1", "-ar", "8000", "-f", "wav", "pipe:1")
+	cmd.Stdin = bytes.NewReader(data)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg: %v: %s", err, stderr.String())
+	}
+	return out.Bytes(), nil
+}
+
+func envelope(wav []byte) ([]float64, error) {
+	f, samples, err := parseWAV(wav)
+	if err != nil {
+		return nil, err
+	}
+	if f.AudioFormat != 1 || (f.BitsPerSample != 8 && f.BitsPerSample != 16) || f.BlockAlign == 0 || f.SampleRate == 0 {
+		return nil, fmt.Errorf("unsupported wav format")
+	}
+
+	align := int(f.BlockAlign)
+	step := int(f.BitsPerSample / 8)
+	perFrame := int(time.Duration(f.SampleRate)*envelopeFrame/time.Second) * align
+	var env []float64
+	peak := 0.0
+	for off := 0; off+perFrame <= len(samples); off += perFrame {
+		sum, n := 0.0, 0
+		for i := off; i+step <= off+perFrame; i += step {
+			v := f.sample(samples[i:])
+			sum += v * v
+			n++
+		}
+		rms := math.Sqrt(sum / float64(n))
+		if rms > peak {
+			peak = rms
+		}
+		env = append(env, rms)
+	}
+	if peak == 0 {
+		return nil, fmt.Errorf("silent recording")
+	}
+	for i := range env {
+		env[i] /= peak
+	}
+	return env, nil
+}
+
+// Similarity returns how similar `f` and `o` are, between 0
+// and 1, which means that they are the same file.
+func (f Fingerprint) Similarity(o Fingerprint) float64 {
+	if f.Hash == o.Hash {
+		return 1
+	}
+	a, b := f.Envelope, o.Envelope
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	if float64(len(a)) < 0.9*float64(len(b)) {
+		// Durations are too different.
+		return 0
+	}
+
+	best := 0.0
+	for shift := -maxEnvelopeShift; shift <= maxEnvelopeShift; shift++ {
+		diff, n := 0.0, 0
+		for i := range a {
+			j := i + shift
+			if j < 0 || j >= len(b) {
+				continue
+			}
+			diff += math.Abs(a[i] - b[j])
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+		if s := 1 - diff/float64(n); s > best {
+			best = s
+		}
+	}
+	return best
+}
+
+type recentRec struct {
+	name string
+	fp   Fingerprint
+	at   time.Time
+}
+
+// DuplicateGuard remembers the fingerprints of the recordings
+// stored within Window, spotting the ones that are recorded
+// twice, e.g. by mistake. It is not persisted across restarts.
+type DuplicateGuard struct {
+	Window time.Duration
+	// Threshold is the similarity above which recordings are
+	// duplicates, DefaultSimilarity if zero.
+	Threshold float64
+	// Hold, if true, keeps the duplicates from being broadcast:
+	// they are stored, and can be broadcast from the dashboard.
+	Hold bool
+
+	mu     sync.Mutex
+	recent []recentRec
+}
+
+func NewDuplicateGuard(window time.Duration) *DuplicateGuard {
+	return &DuplicateGuard{Window: window}
+}
+
+func (g *DuplicateGuard) threshold() float64 {
+	if g.Threshold <= 0 {
+		return DefaultSimilarity
+	}
+	return g.Threshold
+}
+
+// Check returns the name of the recording stored within Window
+// that `fp` duplicates, if any, and remembers `fp` as the
+// fingerprint of `name`.
+func (g *DuplicateGuard) Check(name string, fp Fingerprint) (string, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	recent := g.recent[:0]
+	for _, v := range g.recent {
+		if now.Sub(v.at) < g.Window {
+			recent = append(recent, v)
+		}
+	}
+	g.recent = append(recent, recentRec{name: name, fp: fp, at: now})
+
+	for _, v := range recent {
+		if v.name != name && fp.Similarity(v.fp) >= g.threshold() {
+			return v.name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,43 @@
+package nexmo_test
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+// speech returns 5s of noise bursts of random loudness,
+// starting after `lead` samples of silence.
+func speech(seed int64, lead int, gain float64) []int16 {
+	r := rand.New(rand.NewSource(seed))
+	samples := make([]int16, lead+5*8000)
+	for i := lead; i < len(samples); i += 800 {
+		level := r.Float64() * 20000 * gain
+		for j := i; j < i+800 && j < len(samples); j++ {
+			samples[j] = int16(level * (r.Float64()*2 - 1))
+		}
+	}
+	return samples
+}
+
+func TestDuplicateGuard(t *testing.T) {
+	ctx := context.Background()
+	fp := func(samples []int16) nexmo.Fingerprint {
+		return nexmo.NewFingerprint(ctx, wav(samples), nexmo.FormatWAV)
+	}
+	g := nexmo.NewDuplicateGuard(time.Minute)
+
+	if _, ok := g.Check("a.wav", fp(speech(1, 0, 1))); ok {
+		t.Fatalf("Unexpected duplicate of the first recording")
+	}
+	if _, ok := g.Check("b.wav", fp(speech(2, 0, 1))); ok {
+		t.Fatalf("Unexpected duplicate of a different recording")
+	}
+	// Same message, a bit quieter and starting later.
+	if dup, ok := g.Check("c.wav", fp(speech(1, 1600, 0.5))); !ok || dup != "a.wav" {
+		t.Fatalf("Wanted c.wav to duplicate a.wav, found %q (%v)", dup, ok)
+	}
+}
@@ -0,0 +1,81 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// DefaultElevenLabsURL is the address of ElevenLabs' API.
+const DefaultElevenLabsURL = "https://api.elevenlabs.io"
+
+// DefaultElevenLabsModel is the model ElevenLabs speaks with,
+// supporting every language of the builtin prompts.
+const DefaultElevenLabsModel = "eleven_multilingual_v2"
+
+// ElevenLabsTTS synthesizes speech with ElevenLabs. Voices are
+// identified by their id.
+type ElevenLabsTTS struct {
+	Key string
+	// Voice is the id of the default voice.
+	Voice string
+	// Model is DefaultElevenLabsModel if empty.
+	Model string
+	// BaseURL is DefaultElevenLabsURL if empty.
+	BaseURL string
+	// Client synthesizes the speech, a client with a 10
+	// seconds timeout if nil.
+	Client *http.Client
+}
+
+func (e ElevenLabsTTS) Synthesize(ctx context.Context, text, lang, voice string) ([]byte, string, error) {
+	if voice == "" {
+		voice = e.Voice
+	}
+	model := e.Model
+	if model == "" {
+		model = DefaultElevenLabsModel
+	}
+	base := e.BaseURL
+	if base == "" {
+		base = DefaultElevenLabsURL
+	}
+	body, err := json.Marshal(map[string]string{
+		"text":     text,
+		"model_id": model,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("elevenlabs tts: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", base+"/v1/text-to-speech/"+voice, bytes.NewReader(body))
+	if err != nil {
+		return nil, "", fmt.Errorf("elevenlabs tts: %v", err)
+	}
+	req.Header.Set("xi-api-key", e.Key)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "audio/mpeg")
+	audio, err := doTTS(e.Client, req)
+	if err != nil {
+		return nil, "", fmt.Errorf("elevenlabs tts: %v", err)
+	}
+	return audio, "mp3", nil
+}
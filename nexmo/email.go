@@ -0,0 +1,170 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxAttachmentSize is the size of the largest recording
+// attached to the emails. Larger ones are linked only.
+const MaxAttachmentSize = 10 << 20
+
+// EmailNotifier emails the summaries of the broadcasts through
+// an SMTP server.
+type EmailNotifier struct {
+	// Addr is the host:port of the SMTP server.
+	Addr string
+	// Auth authenticates to the server, if set.
+	Auth smtp.Auth
+	From string
+	To   []string
+	// Recs, if set, is where the recordings attached to the
+	// emails are read from.
+	Recs RecStore
+	// Send delivers the message, smtp.SendMail if nil.
+	Send func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewEmailNotifier returns a notifier emailing `to` from `from`
+// through the server at `host`:`port`, authenticating with
+// `username` and `password` if the username is not empty.
+func NewEmailNotifier(host string, port int, username, password, from string, to []string) *EmailNotifier {
+	e := &EmailNotifier{
+		Addr: net.JoinHostPort(host, strconv.Itoa(port)),
+		From: from,
+		To:   to,
+	}
+	if username != "" {
+		e.Auth = smtp.PlainAuth("", username, password, host)
+	}
+	return e
+}
+
+func (e *EmailNotifier) NotifyBroadcast(ctx context.Context, s BroadcastSummary) error {
+	msg, err := e.message(ctx, s)
+	if err != nil {
+		return fmt.Errorf("email notifier: %v", err)
+	}
+	send := e.Send
+	if send == nil {
+		send = smtp.SendMail
+	}
+	if err = send(e.Addr, e.Auth, e.From, e.To, msg); err != nil {
+		return fmt.Errorf("email notifier: unable to send: %v", err)
+	}
+	return nil
+}
+
+// message returns the email of `s`: a plain text summary,
+// followed by the recording if it is small enough.
+func (e *EmailNotifier) message(ctx context.Context, s BroadcastSummary) ([]byte, error) {
+	b := s.Broadcast
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "Broadcast %d completed.\r\n\r\n", b.ID)
+	if b.RecName != "" {
+		fmt.Fprintf(&body, "Recording:  %s\r\n", b.RecName)
+	}
+	fmt.Fprintf(&body, "Started:    %s\r\n", b.CreatedAt.Format(time.RFC1123))
+	fmt.Fprintf(&body, "Recipients: %d\r\n", s.Succeeded+s.Failed)
+	fmt.Fprintf(&body, "Called:     %d\r\n", s.Succeeded)
+	fmt.Fprintf(&body, "Failed:     %d\r\n", s.Failed)
+	if s.RecURL != "" {
+		fmt.Fprintf(&body, "\r\nListen to it at %s\r\n", s.RecURL)
+	}
+	if s.Transcript != "" {
+		fmt.Fprintf(&body, "\r\nTranscript:\r\n%s\r\n", s.Transcript)
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "From: %s\r\n", e.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", fmt.Sprintf("Broadcast %d: %d called, %d failed", b.ID, s.Succeeded, s.Failed)))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", w.Boundary())
+
+	part, err := w.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return nil, err
+	}
+	part.Write(body.Bytes())
+
+	if e.Recs != nil && s.RecURL != "" {
+		if err = e.attach(ctx, w, b.RecName); err != nil {
+			return nil, err
+		}
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// attach adds the recording `name` to `w`, unless it is too
+// large or it cannot be found.
+func (e *EmailNotifier) attach(ctx context.Context, w *multipart.Writer, name string) error {
+	rec, meta, err := e.Recs.OpenRec(ctx, name)
+	if err == ErrRecNotFound {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to open recording: %v", err)
+	}
+	defer rec.Close()
+	if meta.Size > MaxAttachmentSize {
+		return nil
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(rec, MaxAttachmentSize+1))
+	if err != nil {
+		return fmt.Errorf("unable to read recording: %v", err)
+	}
+	if len(data) > MaxAttachmentSize {
+		return nil
+	}
+
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {ContentType(name)},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(name)})},
+	})
+	if err != nil {
+		return err
+	}
+	enc := base64.StdEncoding.EncodeToString(data)
+	for len(enc) > 76 {
+		io.WriteString(part, enc[:76]+"\r\n")
+		enc = enc[76:]
+	}
+	_, err = io.WriteString(part, enc+"\r\n")
+	return err
+}
@@ -0,0 +1,86 @@
+package nexmo_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestEmailNotifier(t *testing.T) {
+	srv, c := newTestClient(t)
+	s := &storage.Local{RootDir: t.TempDir()}
+	if _, err := s.WriteRec(context.TODO(), strings.NewReader("fake mp3"), "a.mp3", nexmo.RecMeta{}); err != nil {
+		t.Fatalf("Unexpected write error: %v", err)
+	}
+	if err := s.WriteTranscript(context.TODO(), nexmo.Transcript{RecName: "a.mp3", Text: "The office is closed today."}); err != nil {
+		t.Fatalf("Unexpected transcript error: %v", err)
+	}
+
+	var sent [][]byte
+	e := nexmo.NewEmailNotifier("smtp.example.com", 587, "", "", "voicebr@example.com", []string{"admin@example.com"})
+	e.Recs = s
+	e.Send = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		if addr != "smtp.example.com:587" || len(to) != 1 || to[0] != "admin@example.com" {
+			t.Errorf("Unexpected envelope: %s %v", addr, to)
+		}
+		sent = append(sent, msg)
+		return nil
+	}
+	c.Notifiers = []nexmo.Notifier{e}
+	srv.Fail = func(to string) int {
+		if to == "393332222222" {
+			return http.StatusBadRequest
+		}
+		return 0
+	}
+
+	contacts := []nexmo.Contact{nexmo.NewContact("393331111111", "Anna"), nexmo.NewContact("393332222222", "Luca")}
+	c.CallContacts(context.TODO(), s, "a.mp3", contacts)
+	if len(sent) != 1 {
+		t.Fatalf("Wanted one email, found %d", len(sent))
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(sent[0]))
+	if err != nil {
+		t.Fatalf("Unexpected message error: %v", err)
+	}
+	if subject := msg.Header.Get("Subject"); !strings.Contains(subject, "1 called, 1 failed") {
+		t.Fatalf("Unexpected subject: %q", subject)
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("Unexpected content type error: %v", err)
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	part, err := mr.NextPart()
+	if err != nil {
+		t.Fatalf("Unexpected part error: %v", err)
+	}
+	body, _ := ioutil.ReadAll(part)
+	for _, want := range []string{"https://voicebr.example.com/static/a.mp3", "The office is closed today."} {
+		if !strings.Contains(string(body), want) {
+			t.Fatalf("Wanted %q in the body, found %q", want, body)
+		}
+	}
+	if part, err = mr.NextPart(); err != nil {
+		t.Fatalf("Unexpected part error: %v", err)
+	}
+	if part.FileName() != "a.mp3" {
+		t.Fatalf("Wanted a.mp3 to be attached, found %q", part.FileName())
+	}
+	// multipart decodes quoted-printable parts only.
+	data, _ := ioutil.ReadAll(part)
+	if string(data) != "ZmFrZSBtcDM=\r\n" {
+		t.Fatalf("Unexpected attachment: %q", data)
+	}
+}
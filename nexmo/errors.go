@@ -0,0 +1,143 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// maxErrorBody is the size of the error bodies read, the rest is
+// discarded.
+const maxErrorBody = 64 << 10
+
+// ErrRateLimited is wrapped by the *APIError returned when nexmo
+// keeps answering 429 Too Many Requests once the retries are over.
+var ErrRateLimited = errors.New("rate limited")
+
+// APIError is returned when nexmo answers a request with an error
+// status. It wraps ErrRateLimited or ErrUnauthorized when the
+// status is 429 or 401: use errors.Is to branch on them.
+type APIError struct {
+	Method string
+	URL    string
+	// StatusCode and Status are the ones of the response.
+	StatusCode int
+	Status     string
+	// RequestID identifies the request when reporting it to
+	// nexmo, empty if the response did not carry it.
+	RequestID string
+	// Type, Title and Detail describe the error, as found in
+	// its JSON body, if any.
+	Type   string
+	Title  string
+	Detail string
+	// InvalidParameters lists the fields of the request that
+	// were refused.
+	InvalidParameters []InvalidParameter
+	// Body is the error body, truncated to 64KiB.
+	Body []byte
+}
+
+// InvalidParameter is a field of a request refused by nexmo.
+type InvalidParameter struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s %s: %s", e.Method, e.URL, e.Status)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	} else if e.Title != "" {
+		msg += ": " + e.Title
+	}
+	if len(e.InvalidParameters) > 0 {
+		invalid := make([]string, len(e.InvalidParameters))
+		for i, v := range e.InvalidParameters {
+			invalid[i] = v.Name + " " + v.Reason
+		}
+		msg += " (" + strings.Join(invalid, ", ") + ")"
+	}
+	if e.RequestID != "" {
+		msg += " (request " + e.RequestID + ")"
+	}
+	return msg
+}
+
+// readBody drains and closes the body of `resp`, decoding the
+// error it describes into `e`. The body is replaced with what
+// was read, for the callers inspecting it.
+func (e *APIError) readBody(resp *http.Response) {
+	e.Body, _ = ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxErrorBody))
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(e.Body))
+
+	var body struct {
+		Type              string             `json:"type"`
+		Title             string             `json:"title"`
+		Detail            string             `json:"detail"`
+		Instance          string             `json:"instance"`
+		InvalidParameters []InvalidParameter `json:"invalid_parameters"`
+		// The REST APIs, e.g. the numbers one, describe
+		// their errors differently.
+		Label string `json:"error-code-label"`
+	}
+	if json.Unmarshal(e.Body, &body) != nil {
+		return
+	}
+	e.Type, e.Title, e.Detail = body.Type, body.Title, body.Detail
+	if e.Detail == "" {
+		e.Detail = body.Label
+	}
+	e.InvalidParameters = body.InvalidParameters
+	if e.RequestID == "" {
+		e.RequestID = body.Instance
+	}
+}
+
+func (e *APIError) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// Temporary returns true if the request may succeed once retried.
+func (e *APIError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// apiStatus returns the status of the *APIError wrapped by `err`,
+// or zero.
+func apiStatus(err error) int {
+	var e *APIError
+	if errors.As(err, &e) {
+		return e.StatusCode
+	}
+	return 0
+}
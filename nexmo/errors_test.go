@@ -0,0 +1,90 @@
+package nexmo_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+func TestCall_apiErrors(t *testing.T) {
+	srv, c := newTestClient(t)
+	c.MaxRetries = 0
+	c.Policy = nexmo.DeliveryPolicy{MaxAttempts: 3, RetrySpacing: time.Millisecond}
+
+	tt := []struct {
+		code     int
+		kind     error
+		attempts int
+	}{
+		{http.StatusTooManyRequests, nexmo.ErrRateLimited, 3},
+		{http.StatusUnauthorized, nexmo.ErrUnauthorized, 1},
+		{http.StatusBadRequest, nil, 3},
+	}
+	for _, v := range tt {
+		srv.Fail = func(to string) int { return v.code }
+		report, err := c.Call(context.TODO(), contacts("393331111111,Anna\n"), "rec.mp3")
+		if err != nil {
+			t.Fatalf("%d: unexpected call error: %v", v.code, err)
+		}
+		res := report.Results[0]
+		if res.Attempts != v.attempts {
+			t.Fatalf("%d: wanted %d attempts, found %d", v.code, v.attempts, res.Attempts)
+		}
+		var apiErr *nexmo.APIError
+		if !errors.As(res.Err, &apiErr) {
+			t.Fatalf("%d: wanted an *APIError, found %v", v.code, res.Err)
+		}
+		if apiErr.StatusCode != v.code || apiErr.RequestID == "" || apiErr.Method != "POST" || apiErr.Detail != "failure requested by the test" {
+			t.Fatalf("%d: unexpected error %+v", v.code, apiErr)
+		}
+		if v.kind != nil && !errors.Is(res.Err, v.kind) {
+			t.Fatalf("%d: wanted %v, found %v", v.code, v.kind, res.Err)
+		}
+	}
+}
+
+func TestAPIError_body(t *testing.T) {
+	_, c := newTestClient(t)
+	c.MaxRetries = 0
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{
+			"type": "https://developer.nexmo.com/api-errors#invalid-params",
+			"title": "Invalid parameters",
+			"detail": "The request failed due to validation errors",
+			"instance": "bf0ca0bf927b3b52e3cb03217e1a1ddf",
+			"invalid_parameters": [{"name": "capabilities.voice.webhooks.answer_url.address", "reason": "must be a URL"}]
+		}`))
+	}))
+	defer api.Close()
+
+	resp, err := c.Get(context.TODO(), api.URL+"/v2/applications?secret=1")
+	var apiErr *nexmo.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Wanted an *APIError, found %v", err)
+	}
+	if apiErr.Title != "Invalid parameters" || apiErr.RequestID != "bf0ca0bf927b3b52e3cb03217e1a1ddf" {
+		t.Fatalf("Unexpected error %+v", apiErr)
+	}
+	if len(apiErr.InvalidParameters) != 1 || apiErr.InvalidParameters[0].Reason != "must be a URL" {
+		t.Fatalf("Unexpected invalid parameters %+v", apiErr.InvalidParameters)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "validation errors") || !strings.Contains(msg, "answer_url.address must be a URL") || strings.Contains(msg, "secret") {
+		t.Fatalf("Unexpected message %q", msg)
+	}
+
+	// The body is still there for the callers inspecting it.
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil || !strings.Contains(string(b), "invalid_parameters") {
+		t.Fatalf("Wanted the error body to be readable, found %q, %v", b, err)
+	}
+}
@@ -0,0 +1,125 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// CallEvent is a voice event sent by nexmo to the event
+// webhooks, e.g. started, ringing, answered or completed.
+type CallEvent struct {
+	ConversationUUID string `json:"conversation_uuid"`
+	UUID             string `json:"uuid"`
+	Status           string `json:"status"`
+	Direction        string `json:"direction,omitempty"`
+	From             string `json:"from,omitempty"`
+	To               string `json:"to,omitempty"`
+	// BroadcastID is set for the events of outbound calls.
+	BroadcastID int64 `json:"broadcast_id,omitempty"`
+	// Duration is only reported by completed calls.
+	Duration time.Duration `json:"duration,omitempty"`
+	// Rate, the per minute price, and Price, what the call
+	// cost, are only reported by completed calls too.
+	Rate      float64   `json:"rate,omitempty"`
+	Price     float64   `json:"price,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// DecodeCallEvent decodes the body of an event webhook. Events
+// without a timestamp are given the current time.
+func DecodeCallEvent(b []byte) (CallEvent, error) {
+	var raw struct {
+		ConversationUUID string `json:"conversation_uuid"`
+		UUID             string `json:"uuid"`
+		Status           string `json:"status"`
+		Direction        string `json:"direction"`
+		From             string `json:"from"`
+		To               string `json:"to"`
+		Duration         string `json:"duration"`
+		Rate             string `json:"rate"`
+		Price            string `json:"price"`
+		Timestamp        string `json:"timestamp"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return CallEvent{}, fmt.Errorf("unable to decode event: %v", err)
+	}
+
+	e := CallEvent{
+		ConversationUUID: raw.ConversationUUID,
+		UUID:             raw.UUID,
+		Status:           raw.Status,
+		Direction:        raw.Direction,
+		From:             raw.From,
+		To:               raw.To,
+		Timestamp:        time.Now().UTC(),
+	}
+	if raw.Duration != "" {
+		secs, err := strconv.Atoi(raw.Duration)
+		if err != nil {
+			return e, fmt.Errorf("unable to decode event duration: %v", err)
+		}
+		e.Duration = time.Duration(secs) * time.Second
+	}
+	if raw.Rate != "" {
+		rate, err := strconv.ParseFloat(raw.Rate, 64)
+		if err != nil {
+			return e, fmt.Errorf("unable to decode event rate: %v", err)
+		}
+		e.Rate = rate
+	}
+	if raw.Price != "" {
+		price, err := strconv.ParseFloat(raw.Price, 64)
+		if err != nil {
+			return e, fmt.Errorf("unable to decode event price: %v", err)
+		}
+		e.Price = price
+	}
+	if raw.Timestamp != "" {
+		ts, err := time.Parse(time.RFC3339Nano, raw.Timestamp)
+		if err != nil {
+			return e, fmt.Errorf("unable to decode event timestamp: %v", err)
+		}
+		e.Timestamp = ts
+	}
+	return e, nil
+}
+
+// EventLog is implemented by the storages that are able to
+// persist the voice events. When the router's storage implements
+// it, events are stored and exposed at /admin/events.
+type EventLog interface {
+	LogEvent(ctx context.Context, e CallEvent) error
+	// Events returns the events of `conversationUUID`, or every
+	// event if empty, oldest first.
+	Events(ctx context.Context, conversationUUID string) ([]CallEvent, error)
+}
+
+// EventSink receives the voice events as they are delivered by
+// nexmo, letting other systems follow the calls.
+type EventSink interface {
+	Consume(ctx context.Context, e CallEvent) error
+}
+
+// NopSink is an EventSink discarding every event.
+type NopSink struct{}
+
+func (NopSink) Consume(ctx context.Context, e CallEvent) error { return nil }
@@ -0,0 +1,108 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// maxArchivedBody is the size over which archived bodies are
+// truncated.
+const maxArchivedBody = 16 << 10
+
+// CallError is returned when nexmo does not create a call. It
+// carries the exchange, with the secrets of the request removed.
+type CallError struct {
+	Request []byte
+	// Status is zero when no response was received.
+	Status   int
+	Response []byte
+	Err      error
+}
+
+func (e *CallError) Error() string {
+	return fmt.Sprintf("unable to make call: %v", e.Err)
+}
+
+func (e *CallError) Unwrap() error {
+	return e.Err
+}
+
+// CallFailure is an archived CallError.
+type CallFailure struct {
+	BroadcastID int64     `json:"broadcast_id"`
+	Number      string    `json:"number"`
+	Attempt     int       `json:"attempt"`
+	Request     string    `json:"request"`
+	Status      int       `json:"status"`
+	Response    string    `json:"response"`
+	Err         string    `json:"error"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// FailureArchive is implemented by the storages that are able
+// to keep the calls nexmo refused to create. When the
+// ContactsProvider passed to Client.Call implements it, the
+// failures of the broadcast are archived.
+type FailureArchive interface {
+	ArchiveFailure(ctx context.Context, f CallFailure) error
+	// Failures returns ErrNoHistory if the storage is
+	// not able to archive failures.
+	Failures(ctx context.Context, broadcastID int64) ([]CallFailure, error)
+}
+
+// sigParam matches the signatures of the webhook URLs, which
+// must not be archived.
+var sigParam = regexp.MustCompile(`((?:\?|&|\\u0026)` + signatureParam + `=)[^&"\\]*`)
+
+// redactRequest removes the webhook signatures from `b`.
+func redactRequest(b []byte) []byte {
+	return sigParam.ReplaceAll(b, []byte("${1}REDACTED"))
+}
+
+// newCallError reads what is left of the body of `resp`, which
+// may be nil, closing it.
+func newCallError(req []byte, resp *http.Response, err error) *CallError {
+	e := &CallError{Request: redactRequest(req), Err: err}
+	if resp == nil {
+		return e
+	}
+	defer resp.Body.Close()
+	e.Status = resp.StatusCode
+	e.Response, _ = ioutil.ReadAll(io.LimitReader(resp.Body, maxArchivedBody))
+	return e
+}
+
+// Failure returns `e` as the archived failure of `attempt`.
+func (e *CallError) Failure(b Broadcast, to Contact, attempt int) CallFailure {
+	return CallFailure{
+		BroadcastID: b.ID,
+		Number:      to.Number,
+		Attempt:     attempt,
+		Request:     string(e.Request),
+		Status:      e.Status,
+		Response:    string(e.Response),
+		Err:         e.Err.Error(),
+		CreatedAt:   time.Now(),
+	}
+}
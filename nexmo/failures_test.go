@@ -0,0 +1,64 @@
+package nexmo_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestCall_archiveFailures(t *testing.T) {
+	srv, c := newTestClient(t)
+	srv.Fail = func(to string) int {
+		if to == "393332222222" {
+			return http.StatusBadRequest
+		}
+		return 0
+	}
+
+	dir, err := ioutil.TempDir("", "voicebr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := storage.NewSQLite(dir + "/voicebr.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, v := range []nexmo.Contact{nexmo.NewContact("393331111111", "Anna"), nexmo.NewContact("393332222222", "Bruno")} {
+		if err = db.AddContact(context.TODO(), nexmo.BroadcastList, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c.URLKey = []byte("secret")
+	c.Policy.MaxAttempts = 1
+	report, err := c.Call(context.TODO(), db, "rec.mp3")
+	if err != nil {
+		t.Fatalf("Unexpected call error: %v", err)
+	}
+
+	failures, err := db.Failures(context.TODO(), report.Broadcast.ID)
+	if err != nil {
+		t.Fatalf("Unexpected failures error: %v", err)
+	}
+	if len(failures) != 1 {
+		t.Fatalf("Wanted 1 failure, found %d", len(failures))
+	}
+	f := failures[0]
+	if f.Number != "393332222222" || f.Status != http.StatusBadRequest {
+		t.Fatalf("Unexpected failure: %+v", f)
+	}
+	if !strings.Contains(f.Response, "failure requested by the test") {
+		t.Fatalf("Response body was not archived: %q", f.Response)
+	}
+	if strings.Count(f.Request, "sig=REDACTED") != 2 {
+		t.Fatalf("Wanted the signatures to be redacted, found %s", f.Request)
+	}
+}
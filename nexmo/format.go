@@ -0,0 +1,104 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"fmt"
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+// Recording formats supported by nexmo's record action.
+const (
+	FormatMP3 = "mp3"
+	FormatWAV = "wav"
+	FormatOGG = "ogg"
+)
+
+// DefaultRecFormat is used when no format is configured.
+const DefaultRecFormat = FormatMP3
+
+var recContentTypes = map[string]string{
+	FormatMP3: "audio/mpeg",
+	FormatWAV: "audio/wav",
+	FormatOGG: "audio/ogg",
+}
+
+// recContentTypeAliases are the other MIME types a recording
+// in each format may be served as.
+var recContentTypeAliases = map[string][]string{
+	FormatMP3: {"audio/mp3", "audio/mpeg3"},
+	FormatWAV: {"audio/x-wav", "audio/wave", "audio/vnd.wave"},
+	FormatOGG: {"application/ogg", "audio/vorbis"},
+}
+
+// RecContentTypes returns the MIME types a recording in
+// `format` may be served as.
+func RecContentTypes(format string) []string {
+	t, ok := recContentTypes[format]
+	if !ok {
+		return nil
+	}
+	return append([]string{t}, recContentTypeAliases[format]...)
+}
+
+// SniffRecFormat returns the format of the recording `data`,
+// looking at its first bytes, or an empty string if it is
+// not a recording.
+func SniffRecFormat(data []byte) string {
+	switch {
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		return FormatWAV
+	case len(data) >= 4 && string(data[:4]) == "OggS":
+		return FormatOGG
+	case len(data) >= 3 && string(data[:3]) == "ID3",
+		len(data) >= 2 && data[0] == 0xff && data[1]&0xe0 == 0xe0:
+		// Either an ID3 tag or an MPEG audio frame sync.
+		return FormatMP3
+	}
+	return ""
+}
+
+// ValidateRecFormat returns an error if nexmo is not able
+// to record in `format`.
+func ValidateRecFormat(format string) error {
+	if _, ok := recContentTypes[format]; !ok {
+		return fmt.Errorf("unsupported recording format %q, use one of mp3, wav or ogg", format)
+	}
+	return nil
+}
+
+// ContentType returns the MIME type of the file `name`, looking
+// at its extension. Recording formats are resolved without relying
+// on the system MIME database.
+func ContentType(name string) string {
+	ext := filepath.Ext(name)
+	if t, ok := recContentTypes[RecFormat(name)]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// RecFormat returns the format of the recording `name`,
+// looking at its extension.
+func RecFormat(name string) string {
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+}
@@ -0,0 +1,148 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"sync"
+	"time"
+)
+
+// Stages of the inbound call flow, in order.
+const (
+	// StageAuth is reached when the call is answered.
+	StageAuth = "auth"
+	// StageGreet is reached when the caller is authorized
+	// and greeted.
+	StageGreet = "greet"
+	// StageRecording is reached when the recording arrives.
+	StageRecording = "recording"
+	// StageConfirmation is reached when the recording is
+	// stored and broadcasted.
+	StageConfirmation = "confirmation"
+)
+
+var stages = []string{StageAuth, StageGreet, StageRecording, StageConfirmation}
+
+// durationBuckets are the upper bounds of the inbound
+// call duration histogram.
+var durationBuckets = []time.Duration{
+	30 * time.Second,
+	time.Minute,
+	2 * time.Minute,
+	5 * time.Minute,
+}
+
+// Funnel keeps track of how far inbound callers get into
+// the recording flow, and of how long their calls last.
+type Funnel struct {
+	mu        sync.Mutex
+	reached   map[string]int
+	calls     int
+	total     time.Duration
+	max       time.Duration
+	histogram []int
+}
+
+func NewFunnel() *Funnel {
+	return &Funnel{
+		reached:   make(map[string]int),
+		histogram: make([]int, len(durationBuckets)+1),
+	}
+}
+
+// Reach records that a caller reached `stage`.
+func (f *Funnel) Reach(stage string) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reached[stage]++
+}
+
+// Completed records the duration of a completed inbound call.
+func (f *Funnel) Completed(d time.Duration) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+	f.total += d
+	if d > f.max {
+		f.max = d
+	}
+	i := 0
+	for i < len(durationBuckets) && d > durationBuckets[i] {
+		i++
+	}
+	f.histogram[i]++
+}
+
+// StageStats describes a single stage of the funnel.
+type StageStats struct {
+	Stage   string `json:"stage"`
+	Reached int    `json:"reached"`
+	// DroppedOff is the number of callers that reached this
+	// stage but not the next one.
+	DroppedOff int `json:"dropped_off"`
+}
+
+type DurationBucket struct {
+	// UpTo is the upper bound of the bucket, in seconds.
+	// Zero means no upper bound.
+	UpTo  float64 `json:"up_to"`
+	Calls int     `json:"calls"`
+}
+
+type FunnelStats struct {
+	Stages      []StageStats     `json:"stages"`
+	Calls       int              `json:"calls"`
+	AvgDuration float64          `json:"avg_duration"`
+	MaxDuration float64          `json:"max_duration"`
+	Durations   []DurationBucket `json:"durations"`
+}
+
+// Stats returns a snapshot of the funnel.
+func (f *Funnel) Stats() FunnelStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	acc := FunnelStats{
+		Stages:      make([]StageStats, len(stages)),
+		Calls:       f.calls,
+		MaxDuration: f.max.Seconds(),
+		Durations:   make([]DurationBucket, len(f.histogram)),
+	}
+	for i, v := range stages {
+		acc.Stages[i] = StageStats{Stage: v, Reached: f.reached[v]}
+		if i+1 < len(stages) {
+			acc.Stages[i].DroppedOff = f.reached[v] - f.reached[stages[i+1]]
+		}
+	}
+	if f.calls > 0 {
+		acc.AvgDuration = f.total.Seconds() / float64(f.calls)
+	}
+	for i, v := range f.histogram {
+		acc.Durations[i].Calls = v
+		if i < len(durationBuckets) {
+			acc.Durations[i].UpTo = durationBuckets[i].Seconds()
+		}
+	}
+	return acc
+}
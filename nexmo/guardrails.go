@@ -0,0 +1,99 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// NCCOLimits are the limits outbound NCCOs are checked against
+// before the calls are created, so that broadcasts fail fast
+// instead of having calls rejected by nexmo one by one.
+type NCCOLimits struct {
+	// MaxBytes is the size of the JSON encoded NCCO.
+	MaxBytes int
+	// MaxActions is the number of actions of the NCCO.
+	MaxActions int
+	// MaxTextLength is the length of the text of talk actions.
+	MaxTextLength int
+	// MaxURLLength applies to every URL, the answer and event
+	// URLs of the calls included.
+	MaxURLLength int
+}
+
+// DefaultNCCOLimits are conservative limits, within the
+// ones documented by nexmo.
+var DefaultNCCOLimits = NCCOLimits{
+	MaxBytes:      32 * 1024,
+	MaxActions:    32,
+	MaxTextLength: 1500,
+	MaxURLLength:  2048,
+}
+
+// NCCOError is returned when an NCCO, or a call, exceeds the
+// NCCOLimits. Retrying does not help: calls failing with it are
+// not attempted again.
+type NCCOError struct {
+	Reason string
+}
+
+func (e *NCCOError) Error() string {
+	return "ncco rejected: " + e.Reason
+}
+
+func nccoErrorf(format string, args ...interface{}) error {
+	return &NCCOError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// ValidateURL checks the length of `u`. A zero limit disables
+// the check, as with every other field of NCCOLimits.
+func (l NCCOLimits) ValidateURL(u string) error {
+	if l.MaxURLLength > 0 && len(u) > l.MaxURLLength {
+		return nccoErrorf("url is %d bytes long, max is %d: %.64s...", len(u), l.MaxURLLength, u)
+	}
+	return nil
+}
+
+// Validate checks `ncco` against the limits.
+func (l NCCOLimits) Validate(ncco []map[string]interface{}) error {
+	if l.MaxActions > 0 && len(ncco) > l.MaxActions {
+		return nccoErrorf("%d actions, max is %d", len(ncco), l.MaxActions)
+	}
+	b, err := json.Marshal(ncco)
+	if err != nil {
+		return fmt.Errorf("unable to encode ncco: %v", err)
+	}
+	if l.MaxBytes > 0 && len(b) > l.MaxBytes {
+		return nccoErrorf("%d bytes, max is %d", len(b), l.MaxBytes)
+	}
+
+	for i, action := range ncco {
+		if text, ok := action["text"].(string); ok && l.MaxTextLength > 0 && len([]rune(text)) > l.MaxTextLength {
+			return nccoErrorf("action %d (%v): text is %d characters long, max is %d", i, action["action"], len([]rune(text)), l.MaxTextLength)
+		}
+		for _, k := range []string{"streamUrl", "eventUrl"} {
+			urls, _ := action[k].([]string)
+			for _, u := range urls {
+				if err := l.ValidateURL(u); err != nil {
+					return nccoErrorf("action %d (%v): %s: %v", i, action["action"], k, err.(*NCCOError).Reason)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package nexmo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+func TestCall_nccoLimits(t *testing.T) {
+	srv, c := newTestClient(t)
+
+	c.Policy.MaxAttempts = 3
+	c.NCCOLimits.MaxURLLength = 32
+
+	report, err := c.Call(context.TODO(), contacts("393331111111,Anna\n"), "rec.mp3")
+	if err != nil {
+		t.Fatalf("Unexpected call error: %v", err)
+	}
+	if report.Failed != 1 || report.Results[0].Attempts != 1 {
+		t.Fatalf("Wanted a single failed attempt, found %+v", report.Results)
+	}
+	if _, ok := report.Results[0].Err.(*nexmo.NCCOError); !ok {
+		t.Fatalf("Wanted an NCCOError, found %v", report.Results[0].Err)
+	}
+	if len(srv.Calls()) != 0 {
+		t.Fatalf("Calls were created anyway")
+	}
+}
@@ -0,0 +1,58 @@
+package nexmo_test
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/nexmo/nexmotest"
+)
+
+// waitTimeout bounds the waits for the asynchronous parts
+// of the broadcast flow.
+const waitTimeout = 5 * time.Second
+
+// newTestClient starts a fake nexmo server, closed with the test,
+// and returns it together with a client talking to it.
+func newTestClient(t *testing.T) (*nexmotest.Server, *nexmo.Client) {
+	t.Helper()
+	srv, err := nexmotest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+	c, err := srv.NewClient("app", "393339999999", "https://voicebr.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, c
+}
+
+// waitFor polls `cond` until it returns true, failing the test
+// if it does not within waitTimeout.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.After(waitTimeout)
+	for !cond() {
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+	}
+}
+
+// contacts is a nexmo.ContactsProvider serving a fixed list.
+type contacts string
+
+func (c contacts) ReadBroadcastList(w io.Writer) error {
+	_, err := io.WriteString(w, string(c))
+	return err
+}
+
+func (c contacts) ReadWhitelist(w io.Writer) error {
+	return nil
+}
@@ -0,0 +1,141 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Lifecycle events posted by the WebhookNotifier.
+const (
+	HookBroadcastStarted   = "broadcast.started"
+	HookBroadcastCompleted = "broadcast.completed"
+	HookCallFailed         = "call.failed"
+)
+
+// HookPayload is the JSON body posted by the WebhookNotifier.
+type HookPayload struct {
+	Event     string    `json:"event"`
+	Broadcast Broadcast `json:"broadcast"`
+	// Recipients is the number of recipients of Broadcast,
+	// whose list is not posted as it could be long.
+	Recipients int `json:"recipients"`
+	// Succeeded and Failed are set on completion.
+	Succeeded int `json:"succeeded,omitempty"`
+	Failed    int `json:"failed,omitempty"`
+	// RecURL and Transcript are set on completion, see
+	// BroadcastSummary.
+	RecURL     string `json:"rec_url,omitempty"`
+	Transcript string `json:"transcript,omitempty"`
+	// Call is set on call failures.
+	Call      *CallResult `json:"call,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// WebhookNotifier posts the lifecycle events of the broadcasts
+// to an URL: their start, their completion and the recipients
+// that could not be called.
+type WebhookNotifier struct {
+	URL string
+	// Slack posts the events as Slack messages, i.e. a
+	// {"text": ...} object, instead of HookPayloads. This is
+	// what Slack's incoming webhooks and most chat services
+	// compatible with them expect.
+	Slack bool
+	// Client posts the events, a client with a 10 seconds
+	// timeout if nil.
+	Client *http.Client
+}
+
+var defaultHookClient = &http.Client{Timeout: 10 * time.Second}
+
+func (h *WebhookNotifier) NotifyStart(ctx context.Context, b Broadcast) error {
+	return h.post(ctx, HookPayload{Event: HookBroadcastStarted, Broadcast: b})
+}
+
+func (h *WebhookNotifier) NotifyFailure(ctx context.Context, b Broadcast, r CallResult) error {
+	return h.post(ctx, HookPayload{Event: HookCallFailed, Broadcast: b, Call: &r})
+}
+
+func (h *WebhookNotifier) NotifyBroadcast(ctx context.Context, s BroadcastSummary) error {
+	return h.post(ctx, HookPayload{
+		Event:      HookBroadcastCompleted,
+		Broadcast:  s.Broadcast,
+		Succeeded:  s.Succeeded,
+		Failed:     s.Failed,
+		RecURL:     s.RecURL,
+		Transcript: s.Transcript,
+	})
+}
+
+// slackText returns the text of the Slack message of `p`.
+func slackText(p HookPayload) string {
+	b := p.Broadcast
+	switch p.Event {
+	case HookBroadcastStarted:
+		return fmt.Sprintf("Broadcast %d started, calling %d recipients.", b.ID, p.Recipients)
+	case HookCallFailed:
+		return fmt.Sprintf("Broadcast %d: unable to call %s after %d attempts: %s", b.ID, p.Call.Contact.Number, p.Call.Attempts, p.Call.Error)
+	default:
+		text := fmt.Sprintf("Broadcast %d completed: %d called, %d failed.", b.ID, p.Succeeded, p.Failed)
+		if p.RecURL != "" {
+			text += fmt.Sprintf(" <%s|Listen to the recording>", p.RecURL)
+		}
+		return text
+	}
+}
+
+func (h *WebhookNotifier) post(ctx context.Context, p HookPayload) error {
+	p.Timestamp = time.Now()
+	p.Recipients = len(p.Broadcast.Recipients)
+	p.Broadcast.Recipients = nil
+	var v interface{} = p
+	if h.Slack {
+		v = map[string]string{"text": slackText(p)}
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("webhook notifier: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", h.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("webhook notifier: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := h.Client
+	if client == nil {
+		client = defaultHookClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook notifier: unable to post %s: %v", p.Event, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook notifier: unable to post %s: %s", p.Event, resp.Status)
+	}
+	return nil
+}
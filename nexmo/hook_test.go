@@ -0,0 +1,76 @@
+package nexmo_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	srv, c := newTestClient(t)
+	var (
+		mu     sync.Mutex
+		events []nexmo.HookPayload
+		texts  []string
+	)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v struct {
+			nexmo.HookPayload
+			Text string `json:"text"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			t.Errorf("Unexpected decode error: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if v.Text != "" {
+			texts = append(texts, v.Text)
+		} else {
+			events = append(events, v.HookPayload)
+		}
+	}))
+	defer hook.Close()
+	c.Notifiers = []nexmo.Notifier{
+		&nexmo.WebhookNotifier{URL: hook.URL},
+		&nexmo.WebhookNotifier{URL: hook.URL, Slack: true},
+	}
+	srv.Fail = func(to string) int {
+		if to == "393332222222" {
+			return http.StatusBadRequest
+		}
+		return 0
+	}
+
+	contacts := []nexmo.Contact{nexmo.NewContact("393331111111", "Anna"), nexmo.NewContact("393332222222", "Luca")}
+	c.CallContacts(context.TODO(), &storage.Local{RootDir: t.TempDir()}, "a.mp3", contacts)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 3 || len(texts) != 3 {
+		t.Fatalf("Wanted 3 events and 3 messages, found %+v and %q", events, texts)
+	}
+	for i, want := range []string{nexmo.HookBroadcastStarted, nexmo.HookCallFailed, nexmo.HookBroadcastCompleted} {
+		if events[i].Event != want {
+			t.Fatalf("Wanted event %d to be %s, found %s", i, want, events[i].Event)
+		}
+	}
+	if events[0].Recipients != 2 || len(events[0].Broadcast.Recipients) != 0 {
+		t.Fatalf("Wanted only the number of recipients, found %+v", events[0])
+	}
+	if call := events[1].Call; call == nil || call.Contact.Number != "393332222222" {
+		t.Fatalf("Wanted Luca's call to fail, found %+v", call)
+	}
+	if e := events[2]; e.Succeeded != 1 || e.Failed != 1 || e.RecURL != "https://voicebr.example.com/static/a.mp3" {
+		t.Fatalf("Unexpected completion: %+v", e)
+	}
+	if !strings.Contains(texts[2], "1 called, 1 failed") {
+		t.Fatalf("Unexpected Slack message: %q", texts[2])
+	}
+}
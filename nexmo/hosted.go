@@ -0,0 +1,126 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// hostedPath serves the recordings hosted by nexmo, see
+// RouterOptions.Hosted.
+const hostedPath = "/hosted/recording"
+
+// DefaultHostedTTL is how long the URLs streaming the recordings
+// hosted by nexmo are valid.
+const DefaultHostedTTL = 10 * time.Minute
+
+func (o RouterOptions) hostedTTL() time.Duration {
+	if o.HostedTTL <= 0 {
+		return DefaultHostedTTL
+	}
+	return o.HostedTTL
+}
+
+// hostedURL returns the URL streaming the recording at `src`,
+// signed with `urlKey` and expiring after `ttl`.
+func hostedURL(origin string, urlKey []byte, src string, ttl time.Duration) string {
+	q := url.Values{}
+	q.Set("src", src)
+	q.Set("exp", strconv.FormatInt(time.Now().Add(ttl).Unix(), 10))
+	return origin + hostedPath + "?" + SignQuery(urlKey, hostedPath, q)
+}
+
+// withHosted returns `ncco` streaming `src` in place of the
+// stored recording `name`.
+func withHosted(ncco []map[string]interface{}, origin string, urlKey []byte, name, src string, ttl time.Duration) []map[string]interface{} {
+	static := origin + "/static/" + name
+	for _, v := range ncco {
+		if u, ok := v["streamUrl"].([]string); ok && len(u) == 1 && u[0] == static {
+			v["streamUrl"] = []string{hostedURL(origin, urlKey, src, ttl)}
+		}
+	}
+	return ncco
+}
+
+// hostRecording leaves `rec` on nexmo, broadcasting it straight
+// away, see RouterOptions.Hosted.
+func hostRecording(ctx context.Context, s Storage, c *Client, opts RouterOptions, rec pendingRecording) {
+	opts.Watcher.Done(rec.Conversation)
+	group, _ := opts.ivr.recorded(ctx, rec.Conversation, rec.Name)
+	c.audit(ctx, AuditRecordingHosted, map[string]string{
+		"rec_name":          rec.Name,
+		"conversation_uuid": rec.Conversation,
+	})
+	c.enqueue(ctx, s, broadcastJob{RecName: rec.Name, HostedURL: rec.URL, Group: group, By: rec.Caller})
+	opts.Funnel.Reach(StageConfirmation)
+}
+
+// makeHostedHandler streams the recordings hosted by nexmo to
+// the calls, through the URLs made by hostedURL.
+func makeHostedHandler(c *Client, urlKey []byte, opts RouterOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if err := VerifyQuery(urlKey, r.URL.Path, q); err != nil {
+			opts.logger().Printf("hosted recording handler: %v", err)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		exp, err := strconv.ParseInt(q.Get("exp"), 10, 64)
+		if err != nil || time.Now().Unix() > exp {
+			opts.logger().Printf("hosted recording handler: expired url")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		src := q.Get("src")
+		if !c.hostsRec(src) {
+			opts.logger().Printf("hosted recording handler: %q is not hosted by nexmo", src)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		var header http.Header
+		if v := r.Header.Get("Range"); v != "" {
+			header = http.Header{"Range": {v}}
+		}
+		resp, err := c.doPaced(r.Context(), GetLimiter, "GET", src, nil, header)
+		if resp != nil {
+			defer resp.Body.Close()
+		}
+		if err != nil {
+			opts.logger().Printf("hosted recording handler: %v", err)
+			switch code := apiStatus(err); code {
+			case http.StatusNotFound, http.StatusRequestedRangeNotSatisfiable:
+				w.WriteHeader(code)
+			default:
+				w.WriteHeader(http.StatusBadGateway)
+			}
+			return
+		}
+		for _, k := range []string{"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges"} {
+			if v := resp.Header.Get(k); v != "" {
+				w.Header().Set(k, v)
+			}
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}
+}
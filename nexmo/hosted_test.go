@@ -0,0 +1,82 @@
+package nexmo_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/nexmo/nexmotest"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestHostedRecording(t *testing.T) {
+	srv, c := newTestClient(t)
+	dir := t.TempDir()
+	ioutil.WriteFile(dir+"/whitelist.csv", []byte("393330000000,Marco\n"), 0644)
+	ioutil.WriteFile(dir+"/contacts.csv", []byte("393331111111,Anna\n"), 0644)
+	s := &storage.Local{RootDir: dir}
+
+	c.URLKey = []byte("secret")
+	r := nexmo.NewRouter(c, s, c.Origin, nexmo.RouterOptions{Hosted: true})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, nexmotest.AnswerWebhook("393330000000", "CON-1"))
+	var answer []struct {
+		EventURL []string `json:"eventUrl"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&answer); err != nil || len(answer) != 2 {
+		t.Fatalf("Unexpected answer NCCO: %+v, %v", answer, err)
+	}
+	eventURL, _ := url.Parse(answer[1].EventURL[0])
+	recUUID, recURL := srv.AddRecording([]byte("fake mp3"))
+	req := nexmotest.RecordingWebhook(recURL, recUUID, "CON-1")
+	req.URL.RawQuery = eventURL.RawQuery
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	calls := srv.WaitCalls(1, waitTimeout)
+	if len(calls) != 1 {
+		t.Fatalf("Wanted 1 call, found %d", len(calls))
+	}
+	ncco, err := nexmotest.Answer(r, calls[0])
+	if err != nil {
+		t.Fatalf("Unexpected answer error: %v", err)
+	}
+	if len(ncco) != 3 {
+		t.Fatalf("Unexpected NCCO: %v", ncco)
+	}
+	stream, _ := url.Parse(ncco[1]["streamUrl"].([]interface{})[0].(string))
+	if stream.Path != "/hosted/recording" {
+		t.Fatalf("Wanted the recording to be streamed from nexmo, found %v", stream)
+	}
+
+	get := func(u *url.URL) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", u.RequestURI(), nil))
+		return w
+	}
+	if w := get(stream); w.Code != http.StatusOK || w.Body.String() != "fake mp3" {
+		t.Fatalf("Wanted the recording, found %d %q", w.Code, w.Body.String())
+	}
+	recs, err := s.ListRecs(context.TODO())
+	if err != nil {
+		t.Fatalf("Unexpected list error: %v", err)
+	}
+	if len(recs) != 0 {
+		t.Fatalf("Wanted no stored recordings, found %v", recs)
+	}
+
+	// The source is signed, and cannot be swapped.
+	q := stream.Query()
+	q.Set("src", strings.Replace(q.Get("src"), recUUID, "other", 1))
+	tampered := *stream
+	tampered.RawQuery = q.Encode()
+	if w := get(&tampered); w.Code != http.StatusForbidden {
+		t.Fatalf("Wanted status %d, found %d", http.StatusForbidden, w.Code)
+	}
+}
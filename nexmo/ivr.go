@@ -0,0 +1,282 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jecoz/voicebr/flow"
+)
+
+// ivrPath is where the choices of the broadcasters in the
+// IVR are reported.
+const ivrPath = "/record/voice/ivr"
+
+// ivrFlow is the name of the IVR flow.
+const ivrFlow = "ivr"
+
+// States of the IVR flow.
+const (
+	// ivrMenu waits for the choice of the menu.
+	ivrMenu flow.State = "menu"
+	// ivrGroup waits for the number of the group.
+	ivrGroup flow.State = "group"
+	// ivrRecording waits for the recording, which is
+	// reported to storeRecording.
+	ivrRecording flow.State = "recording"
+)
+
+// ivr runs the IVR sessions, keyed by conversation UUID, and
+// holds the last recording of each broadcaster, keyed by number,
+// which is lost on restart.
+type ivr struct {
+	machine *flow.Machine
+	log     *log.Logger
+
+	mu   sync.Mutex
+	last map[string]string
+}
+
+// newIVR returns the IVR, saving its sessions in `store`. The
+// steps of the flow answer with the NCCOs of the router.
+func newIVR(store flow.Store, c *Client, origin string, urlKey []byte, opts RouterOptions) *ivr {
+	v := &ivr{last: make(map[string]string), log: opts.Log}
+	v.machine = flow.NewMachine(store, &flow.Flow{
+		Name:  ivrFlow,
+		Start: ivrMenu,
+		Steps: map[flow.State]flow.Step{
+			ivrMenu:  v.menuStep(c, origin, urlKey, opts),
+			ivrGroup: v.groupStep(origin, urlKey, opts),
+		},
+	})
+	return v
+}
+
+// start begins the IVR session of `caller`'s call.
+func (v *ivr) start(ctx context.Context, conversation string, caller Contact) error {
+	_, err := v.machine.Start(ctx, conversation, ivrFlow, map[string]string{
+		"number": caller.Number,
+		"name":   caller.Name,
+		"lang":   caller.Lang,
+		"voice":  caller.Voice,
+	})
+	return err
+}
+
+// sessionCaller returns the broadcaster of `s`.
+func sessionCaller(s *flow.Session) Contact {
+	return Contact{
+		Number: s.Get("number"),
+		Name:   s.Get("name"),
+		Lang:   s.Get("lang"),
+		Voice:  s.Get("voice"),
+	}
+}
+
+// menuStep answers the choice of the menu: 1 records a message,
+// 2 plays back the last one, 3 asks for the group and 4 cancels
+// the last broadcast; anything else, or nothing at all, records
+// a message as the flow without IVR does.
+func (v *ivr) menuStep(c *Client, origin string, urlKey []byte, opts RouterOptions) flow.Step {
+	return func(ctx context.Context, s *flow.Session, e flow.Event) (flow.State, flow.Actions, error) {
+		origin := originOf(ctx, origin)
+		caller := sessionCaller(s)
+		p := opts.prompts().For(caller.Lang, caller.Voice)
+		data := callerData(caller)
+		last, hasLast := v.lastRec(caller.Number)
+
+		switch e.Digits {
+		case "2":
+			if !hasLast {
+				return ivrMenu, ivrMenuNCCO(origin, urlKey, caller, opts, p.TalkAction(p.IVRNone, data)), nil
+			}
+			return ivrMenu, ivrMenuNCCO(origin, urlKey, caller, opts, map[string]interface{}{
+				"action":    "stream",
+				"level":     p.Level,
+				"streamUrl": []string{origin + "/static/" + last},
+			}), nil
+		case "3":
+			return ivrGroup, ivrGroupNCCO(origin, urlKey, caller, opts), nil
+		case "4":
+			if !hasLast || c.Queue.Cancel(last) == 0 {
+				return ivrMenu, ivrMenuNCCO(origin, urlKey, caller, opts, p.TalkAction(p.IVRNone, data)), nil
+			}
+			opts.logger().Printf("ivr handler: %s canceled the broadcast of %s", caller.Number, last)
+			return ivrMenu, ivrMenuNCCO(origin, urlKey, caller, opts, p.TalkAction(p.IVRCanceled, data)), nil
+		default:
+			opts.Watcher.Watch(s.ID, caller)
+			return ivrRecording, recordNCCO(origin, urlKey, caller, opts), nil
+		}
+	}
+}
+
+// groupStep answers the position of the group in IVRGroups,
+// 0 choosing the whole broadcast list.
+func (v *ivr) groupStep(origin string, urlKey []byte, opts RouterOptions) flow.Step {
+	return func(ctx context.Context, s *flow.Session, e flow.Event) (flow.State, flow.Actions, error) {
+		origin := originOf(ctx, origin)
+		caller := sessionCaller(s)
+		i, err := strconv.Atoi(e.Digits)
+		if err != nil || i < 0 || i > len(opts.IVRGroups) {
+			return ivrGroup, ivrGroupNCCO(origin, urlKey, caller, opts), nil
+		}
+		group := ""
+		if i > 0 {
+			group = opts.IVRGroups[i-1]
+		}
+		s.Set("group", group)
+		opts.logger().Printf("ivr handler: %s is broadcasting to %q", caller.Number, group)
+
+		p := opts.prompts().For(caller.Lang, caller.Voice)
+		data := callerData(caller)
+		data.Group = group
+		return ivrMenu, ivrMenuNCCO(origin, urlKey, caller, opts, p.TalkAction(p.IVRGroupSet, data)), nil
+	}
+}
+
+// recorded remembers `recName` as the last recording of the
+// broadcaster of `conversation`, returning the group it has to
+// be broadcast to, and false if the conversation has no IVR
+// session. Safe to call on a nil receiver.
+func (v *ivr) recorded(ctx context.Context, conversation, recName string) (string, bool) {
+	if v == nil {
+		return "", false
+	}
+	s, err := v.machine.Session(ctx, conversation)
+	if err != nil {
+		if err != flow.ErrNotFound {
+			logger(v.log).Printf("ivr: %v", err)
+		}
+		return "", false
+	}
+	v.mu.Lock()
+	v.last[s.Get("number")] = recName
+	v.mu.Unlock()
+	return s.Get("group"), true
+}
+
+// lastRec returns the last recording of `number`, or false.
+func (v *ivr) lastRec(number string) (string, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	name, ok := v.last[number]
+	return name, ok
+}
+
+// ivrMenuNCCO returns the NCCO speaking the IVR menu to
+// `caller`, preceded by `before`.
+func ivrMenuNCCO(origin string, urlKey []byte, caller Contact, opts RouterOptions, before ...map[string]interface{}) []map[string]interface{} {
+	p := opts.prompts().For(caller.Lang, caller.Voice)
+	menu := p.TalkAction(p.IVRMenu, callerData(caller))
+	menu["bargeIn"] = true
+	return append(before, menu, ivrInputAction(origin, urlKey, caller, 1))
+}
+
+// ivrGroupNCCO returns the NCCO asking `caller` the position
+// of the group.
+func ivrGroupNCCO(origin string, urlKey []byte, caller Contact, opts RouterOptions) []map[string]interface{} {
+	p := opts.prompts().For(caller.Lang, caller.Voice)
+	return []map[string]interface{}{
+		p.TalkAction(p.IVRGroup, callerData(caller)),
+		ivrInputAction(origin, urlKey, caller, 2),
+	}
+}
+
+// ivrInputAction returns the input action reporting up to
+// `digits` digits to ivrPath.
+func ivrInputAction(origin string, urlKey []byte, caller Contact, digits int) map[string]interface{} {
+	params := CallParams{Number: caller.Number, Lang: caller.Lang, Voice: caller.Voice}
+	return map[string]interface{}{
+		"action":   "input",
+		"type":     []string{"dtmf"},
+		"dtmf":     map[string]interface{}{"maxDigits": digits, "submitOnHash": true, "timeOut": 5},
+		"eventUrl": []string{origin + ivrPath + "?" + SignQuery(urlKey, ivrPath, params.Values())},
+	}
+}
+
+func callerData(caller Contact) PromptData {
+	return PromptData{
+		CallerName:   caller.Name,
+		CallerNumber: caller.Number,
+		Lang:         caller.Lang,
+		When:         SpokenTime{Time: time.Now(), Lang: caller.Lang},
+	}
+}
+
+// makeIVRHandler answers the input actions of the IVR,
+// advancing the session of the call.
+func makeIVRHandler(s Storage, v *ivr, origin string, urlKey []byte, opts RouterOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := originOf(r.Context(), origin)
+		if r.Method != "POST" {
+			return
+		}
+		defer r.Body.Close()
+		if err := VerifyQuery(urlKey, r.URL.Path, r.URL.Query()); err != nil {
+			opts.logger().Printf("ivr handler: %v", err)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		var event struct {
+			ConversationUUID string `json:"conversation_uuid"`
+			DTMF             struct {
+				Digits string `json:"digits"`
+			} `json:"dtmf"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			opts.logger().Printf("ivr handler error: unable to decode event: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		params := CallParamsFromQuery(r.URL.Query())
+		caller, err := whitelisted(s, params.Number, opts.Log)
+		if err != nil {
+			opts.logger().Printf("ivr handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if caller == nil {
+			opts.logger().Printf("ivr handler: number %s cannot broadcast anymore", params.Number)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		ncco, err := v.machine.Handle(r.Context(), event.ConversationUUID, flow.Event{Digits: event.DTMF.Digits})
+		if err == flow.ErrNotFound {
+			// The session expired, or has been lost: start over.
+			err = v.start(r.Context(), event.ConversationUUID, *caller)
+			ncco = ivrMenuNCCO(origin, urlKey, *caller, opts)
+		}
+		if err != nil {
+			opts.logger().Printf("ivr handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(ncco)
+	}
+}
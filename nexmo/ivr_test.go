@@ -0,0 +1,98 @@
+package nexmo_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/nexmo/nexmotest"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestIVR(t *testing.T) {
+	srv, c := newTestClient(t)
+
+	dir := t.TempDir()
+	db, err := storage.NewSQLite(dir + "/voicebr.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	marco := nexmo.NewContact("393330000000", "Marco")
+	marco.Lang = "en"
+	if err = db.AddContact(context.TODO(), nexmo.Whitelist, marco); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []nexmo.Contact{nexmo.NewContact("393331111111", "Anna"), nexmo.NewContact("393332222222", "Luca")} {
+		if err = db.AddContact(context.TODO(), nexmo.BroadcastList, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = db.AddToGroup(context.TODO(), "staff", "393331111111"); err != nil {
+		t.Fatal(err)
+	}
+	s := storage.Combined{RecStore: &storage.Local{RootDir: dir}, ContactsStore: db}
+
+	r := nexmo.NewRouter(c, s, c.Origin, nexmo.RouterOptions{IVR: true, IVRGroups: []string{"staff"}})
+
+	var ncco []map[string]interface{}
+	choose := func(conversation, digits string) {
+		t.Helper()
+		u, _ := url.Parse(ncco[len(ncco)-1]["eventUrl"].([]interface{})[0].(string))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, nexmotest.InputWebhook(u.RequestURI(), conversation, digits))
+		if err := json.NewDecoder(w.Body).Decode(&ncco); err != nil {
+			t.Fatalf("Unexpected decode error: %v", err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, nexmotest.AnswerWebhook("393330000000", "CON-1"))
+	if err = json.NewDecoder(w.Body).Decode(&ncco); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if len(ncco) != 2 || ncco[1]["action"] != "input" {
+		t.Fatalf("Wanted the IVR menu, found %v", ncco)
+	}
+	choose("CON-1", "2")
+	if want := "You have not broadcast any message recently."; len(ncco) != 3 || ncco[0]["text"] != want {
+		t.Fatalf("Wanted %q, found %v", want, ncco)
+	}
+	choose("CON-1", "3")
+	choose("CON-1", "7")
+	if want := "Type the number of the group, followed by the hash key, or 0 for everyone."; len(ncco) != 2 || ncco[0]["text"] != want {
+		t.Fatalf("Wanted %q, found %v", want, ncco)
+	}
+	choose("CON-1", "1")
+	if want := "Recipients: group staff"; len(ncco) != 3 || ncco[0]["text"] != want {
+		t.Fatalf("Wanted %q, found %v", want, ncco)
+	}
+	choose("CON-1", "1")
+	if len(ncco) != 2 || ncco[1]["action"] != "record" {
+		t.Fatalf("Wanted a recording, found %v", ncco)
+	}
+
+	recUUID, recURL := srv.AddRecording([]byte("fake mp3"))
+	r.ServeHTTP(httptest.NewRecorder(), nexmotest.RecordingWebhook(recURL, recUUID, "CON-1"))
+	waitFor(t, "the broadcast to end", func() bool {
+		stats := c.Queue.Stats(nexmo.CallLimiter)
+		return len(stats) == 1 && stats[0].EndedAt != nil
+	})
+	if calls := srv.Calls(); len(calls) != 1 || calls[0].To[0].Number != "393331111111" {
+		t.Fatalf("Wanted only the staff to be called, found %+v", calls)
+	}
+
+	// The next call plays the message back.
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, nexmotest.AnswerWebhook("393330000000", "CON-2"))
+	if err = json.NewDecoder(w.Body).Decode(&ncco); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	choose("CON-2", "2")
+	if want := c.Origin + "/static/" + recUUID + ".mp3"; len(ncco) != 3 || ncco[0]["streamUrl"].([]interface{})[0] != want {
+		t.Fatalf("Wanted %s to be played back, found %v", want, ncco)
+	}
+}
@@ -0,0 +1,142 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// keypressPath is where the digit pressed by the recipients
+// after the message is reported.
+const keypressPath = "/play/recording/keypress"
+
+// replayDigit is the key the recipients press to listen to
+// the message again.
+const replayDigit = "1"
+
+// withKeypress returns `ncco`, a playNCCO, letting the recipient
+// interrupt the last message and press a key after it: replayDigit
+// while `replays`, the replays left, is positive, and optOutDigit
+// if `optOut` is set. The input action replaces the End prompt,
+// which its event handler speaks when no such key is pressed.
+func withKeypress(ncco []map[string]interface{}, origin string, urlKey []byte, p Prompts, data PromptData, params CallParams, replays int, optOut bool) []map[string]interface{} {
+	if replays <= 0 && !optOut {
+		return ncco
+	}
+	last := ncco[len(ncco)-2]
+	stream := make(map[string]interface{}, len(last)+1)
+	for k, v := range last {
+		stream[k] = v
+	}
+	stream["bargeIn"] = true
+	acc := append(append([]map[string]interface{}{}, ncco[:len(ncco)-2]...), stream)
+	if replays > 0 {
+		hint := p.TalkAction(p.Replay, data)
+		hint["bargeIn"] = true
+		acc = append(acc, hint)
+	}
+	if optOut {
+		hint := p.TalkAction(p.OptOut, data)
+		hint["bargeIn"] = true
+		acc = append(acc, hint)
+	}
+
+	q := params.Values()
+	q.Set("rec", data.RecName)
+	q.Set("replays", strconv.Itoa(replays))
+	return append(acc, map[string]interface{}{
+		"action":   "input",
+		"type":     []string{"dtmf"},
+		"dtmf":     map[string]interface{}{"maxDigits": 1, "timeOut": 3},
+		"eventUrl": []string{origin + keypressPath + "?" + SignQuery(urlKey, keypressPath, q)},
+	})
+}
+
+// makeKeypressHandler answers the input action of withKeypress:
+// when the recipient pressed replayDigit the message is played
+// again, and when they pressed optOutDigit the number is added
+// to the suppression list of `s`.
+func makeKeypressHandler(s Storage, c *Client, origin string, urlKey []byte, opts RouterOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			return
+		}
+		defer r.Body.Close()
+		origin := originOf(r.Context(), origin)
+		if err := VerifyQuery(urlKey, r.URL.Path, r.URL.Query()); err != nil {
+			opts.logger().Printf("keypress handler: %v", err)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		var event struct {
+			DTMF struct {
+				Digits string `json:"digits"`
+			} `json:"dtmf"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			opts.logger().Printf("keypress handler error: unable to decode event: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		q := r.URL.Query()
+		params := CallParamsFromQuery(q)
+		replays, _ := strconv.Atoi(q.Get("replays"))
+		p := opts.prompts().For(params.Lang, params.Voice)
+		data := PromptData{
+			Lang:            params.Lang,
+			RecName:         q.Get("rec"),
+			BroadcastID:     params.BroadcastID,
+			RecipientNumber: params.Number,
+			When:            SpokenTime{Time: params.Sent, Lang: params.Lang},
+		}
+		ncco := []map[string]interface{}{p.TalkAction(p.End, data)}
+		switch event.DTMF.Digits {
+		case replayDigit:
+			if replays <= 0 || data.RecName == "" {
+				break
+			}
+			opts.logger().Printf("keypress handler: replaying %s to %s", data.RecName, params.Number)
+			// The Recorded prompt is not spoken again.
+			ncco = playNCCO(origin, p, data, opts.Loop, params.Then...)[1:]
+			if params.Hosted != "" {
+				ncco = withHosted(ncco, origin, urlKey, data.RecName, params.Hosted, opts.hostedTTL())
+			}
+			ncco = withKeypress(ncco, origin, urlKey, p, data, params, replays-1, opts.OptOut)
+		case optOutDigit:
+			if !opts.OptOut {
+				break
+			}
+			ok, err := optOut(r.Context(), s, c, params, opts)
+			if err != nil {
+				opts.logger().Printf("keypress handler: %v", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if ok {
+				ncco = []map[string]interface{}{p.TalkAction(p.OptedOut, data)}
+			}
+		}
+
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(ncco)
+	}
+}
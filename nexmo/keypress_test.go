@@ -0,0 +1,66 @@
+package nexmo_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/nexmo/nexmotest"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestReplay(t *testing.T) {
+	srv, c := newTestClient(t)
+	s := &storage.Local{RootDir: t.TempDir()}
+	r := nexmo.NewRouter(c, s, c.Origin, nexmo.RouterOptions{Replays: 1, Loop: 2, OptOut: true})
+
+	anna := nexmo.NewContact("393331111111", "Anna")
+	anna.Lang = "en"
+	if report := c.CallContacts(context.TODO(), s, "a.mp3", []nexmo.Contact{anna}); report.Succeeded != 1 {
+		t.Fatalf("Unexpected failures: %+v", report.Results)
+	}
+	call := srv.Calls()[0]
+	ncco, err := nexmotest.Answer(r, call)
+	if err != nil {
+		t.Fatalf("Unexpected answer error: %v", err)
+	}
+	en := nexmo.PromptsFor("en", "")
+	if len(ncco) != 5 || ncco[1]["loop"] != float64(2) || ncco[1]["bargeIn"] != true {
+		t.Fatalf("Wanted the message to loop twice, found %v", ncco)
+	}
+	if ncco[2]["text"] != en.Replay || ncco[3]["text"] != en.OptOut || ncco[4]["action"] != "input" {
+		t.Fatalf("Wanted the replay and opt out hints to precede an input, found %v", ncco)
+	}
+
+	press := func(ncco []map[string]interface{}, digits string) []map[string]interface{} {
+		t.Helper()
+		u, _ := url.Parse(ncco[len(ncco)-1]["eventUrl"].([]interface{})[0].(string))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, nexmotest.InputWebhook(u.RequestURI(), call.ConversationUUID, digits))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Wanted status 200, found %d", w.Code)
+		}
+		var acc []map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&acc); err != nil {
+			t.Fatalf("Unexpected decode error: %v", err)
+		}
+		return acc
+	}
+
+	// The replay plays the message again, without offering
+	// another one.
+	ncco = press(ncco, "1")
+	if len(ncco) != 3 || ncco[0]["action"] != "stream" || ncco[0]["loop"] != float64(2) || ncco[1]["text"] != en.OptOut {
+		t.Fatalf("Wanted the message to be replayed, found %v", ncco)
+	}
+	if got := press(ncco, "1"); len(got) != 1 || got[0]["text"] != en.End {
+		t.Fatalf("Wanted the replays to be over, found %v", got)
+	}
+	if got := press(ncco, "9"); len(got) != 1 || got[0]["text"] != en.OptedOut {
+		t.Fatalf("Wanted Anna to opt out, found %v", got)
+	}
+}
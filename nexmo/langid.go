@@ -0,0 +1,89 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+)
+
+// LangDetector identifies the language spoken in a recording,
+// so that the prompts surrounding it are spoken in the same
+// language.
+type LangDetector interface {
+	// DetectLang returns the language of `audio`, encoded in
+	// `format`, or an empty string if it cannot be told.
+	DetectLang(ctx context.Context, audio []byte, format string) (string, error)
+}
+
+// TranscriberLang is a LangDetector delegating to a Transcriber,
+// for the engines reporting the language of their transcripts.
+type TranscriberLang struct {
+	Transcriber Transcriber
+}
+
+func (d TranscriberLang) DetectLang(ctx context.Context, audio []byte, format string) (string, error) {
+	t, err := d.Transcriber.Transcribe(ctx, audio, format)
+	if err != nil {
+		return "", err
+	}
+	return t.Lang, nil
+}
+
+// recLang returns the language of the recording `recName`,
+// empty if unknown. The language of its transcript is used
+// when `p` stores one, otherwise the recording is run through
+// the client's LangDetector, once.
+func (c *Client) recLang(ctx context.Context, p ContactsProvider, recName string) string {
+	if ts, ok := p.(TranscriptStore); ok {
+		if t, err := ts.Transcript(ctx, recName); err == nil && t.Lang != "" {
+			return baseLang(t.Lang)
+		}
+	}
+	if c.LangDetector == nil {
+		return ""
+	}
+	if lang, ok := c.langs.Load(recName); ok {
+		return lang.(string)
+	}
+	rs, ok := p.(RecStore)
+	if !ok {
+		return ""
+	}
+	lang, err := detectRecLang(ctx, c.LangDetector, rs, recName)
+	if err != nil {
+		c.logger().Printf("call: unable to detect the language of %s: %v", recName, err)
+		return ""
+	}
+	lang = baseLang(lang)
+	c.langs.Store(recName, lang)
+	return lang
+}
+
+func detectRecLang(ctx context.Context, d LangDetector, rs RecStore, name string) (string, error) {
+	rec, meta, err := rs.OpenRec(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("unable to open %s: %v", name, err)
+	}
+	audio, err := ioutil.ReadAll(rec)
+	rec.Close()
+	if err != nil {
+		return "", fmt.Errorf("unable to read %s: %v", name, err)
+	}
+	return d.DetectLang(ctx, audio, RecFormat(meta.Name))
+}
@@ -0,0 +1,67 @@
+package nexmo_test
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+)
+
+type langDetector struct {
+	lang  string
+	calls int
+}
+
+func (d *langDetector) DetectLang(ctx context.Context, audio []byte, format string) (string, error) {
+	d.calls++
+	return d.lang, nil
+}
+
+func TestLangDetection(t *testing.T) {
+	srv, c := newTestClient(t)
+	d := &langDetector{lang: "en-GB"}
+	c.LangDetector = d
+	s := &storage.Local{RootDir: t.TempDir()}
+	for _, v := range []string{"a.mp3", "b.mp3"} {
+		if _, err := s.WriteRec(context.TODO(), strings.NewReader("fake mp3"), v, nexmo.RecMeta{}); err != nil {
+			t.Fatalf("Unexpected write error: %v", err)
+		}
+	}
+	if err := s.WriteTranscript(context.TODO(), nexmo.Transcript{RecName: "b.mp3", Lang: "fr", Text: "Bonjour"}); err != nil {
+		t.Fatalf("Unexpected write error: %v", err)
+	}
+
+	langs := func() map[string]string {
+		acc := make(map[string]string)
+		for _, v := range srv.Calls() {
+			u, err := url.Parse(v.AnswerURL[0])
+			if err != nil {
+				t.Fatalf("Unexpected parse error: %v", err)
+			}
+			acc[v.To[0].Number] = u.Query().Get("lang")
+		}
+		return acc
+	}
+	contacts := []nexmo.Contact{nexmo.NewContact("393330000001", ""), {Number: "393330000002", Lang: "de"}}
+	for i := 0; i < 2; i++ {
+		if r := c.CallContacts(context.TODO(), s, "a.mp3", contacts); r.Failed != 0 {
+			t.Fatalf("Unexpected call failures: %+v", r.Results)
+		}
+	}
+	if l := langs(); l["393330000001"] != "en" || l["393330000002"] != "de" {
+		t.Fatalf("Wanted the recording language for the contact without one only, found %v", l)
+	}
+	if d.calls != 1 {
+		t.Fatalf("Wanted the language to be detected once, found %d detections", d.calls)
+	}
+
+	if r := c.CallContacts(context.TODO(), s, "b.mp3", contacts[:1]); r.Failed != 0 {
+		t.Fatalf("Unexpected call failures: %+v", r.Results)
+	}
+	if l := langs(); l["393330000001"] != "fr" || d.calls != 1 {
+		t.Fatalf("Wanted the transcript language to be used, found %v after %d detections", l, d.calls)
+	}
+}
@@ -0,0 +1,258 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os/exec"
+)
+
+// ErrLoudnessUnsupported is returned when the loudness of a
+// recording cannot be normalized, e.g. because it is compressed
+// and ffmpeg is not available.
+var ErrLoudnessUnsupported = errors.New("loudness normalization not supported for this recording")
+
+// DefaultLoudness is the integrated loudness recommended by
+// EBU R128, in LUFS.
+const DefaultLoudness = -23.0
+
+// loudnessCeiling is the highest sample peak allowed after the
+// gain is applied, about -1 dBFS.
+const loudnessCeiling = 0.891
+
+// LoudnessNormalizer brings the recordings to the same integrated
+// loudness, measured as EBU R128 does, so that the recipients hear
+// every message at the same volume however the broadcasters held
+// their phones. The gain is lowered when needed not to clip.
+type LoudnessNormalizer struct {
+	// Target is the integrated loudness, in LUFS,
+	// DefaultLoudness if zero.
+	Target float64
+	// FFmpeg decodes and encodes the formats other than
+	// wav, which is normalized natively.
+	FFmpeg FFmpeg
+}
+
+func (n LoudnessNormalizer) target() float64 {
+	if n.Target == 0 {
+		return DefaultLoudness
+	}
+	return n.Target
+}
+
+// Normalize returns the recording `data`, encoded in `format`, at
+// the target loudness. Silent recordings and those shorter than
+// the 400ms measurement window are returned as they are.
+func (n LoudnessNormalizer) Normalize(ctx context.Context, data []byte, format string) ([]byte, error) {
+	if format == FormatWAV {
+		return n.normalizeWAV(data)
+	}
+	bin, err := exec.LookPath(n.FFmpeg.path())
+	if err != nil {
+		return nil, ErrLoudnessUnsupported
+	}
+	// Measure the decoded audio, then apply the gain to
+	// the original one, keeping its encoding.
+	pcm, err := runFFmpeg(ctx, bin, data, "-f", format, "-i", "pipe:0", "-acodec", "pcm_s16le", "-f", FormatWAV, "pipe:1")
+	if err != nil {
+		return nil, fmt.Errorf("loudness: %v", err)
+	}
+	f, samples, err := parseWAV(pcm)
+	if err != nil {
+		return nil, fmt.Errorf("loudness: %v", err)
+	}
+	gain, ok := n.gain(f, samples)
+	if !ok {
+		return data, nil
+	}
+	out, err := runFFmpeg(ctx, bin, data, "-f", format, "-i", "pipe:0",
+		"-af", fmt.Sprintf("volume=%fdB", 20*math.Log10(gain)), "-f", format, "pipe:1")
+	if err != nil {
+		return nil, fmt.Errorf("loudness: %v", err)
+	}
+	return out, nil
+}
+
+func (n LoudnessNormalizer) normalizeWAV(data []byte) ([]byte, error) {
+	f, samples, err := parseWAV(data)
+	if err != nil {
+		return nil, fmt.Errorf("loudness: %v", err)
+	}
+	if !f.pcm() {
+		return nil, ErrLoudnessUnsupported
+	}
+	gain, ok := n.gain(f, samples)
+	if !ok {
+		return data, nil
+	}
+	out := make([]byte, len(samples))
+	copy(out, samples)
+	step := int(f.BitsPerSample / 8)
+	for i := 0; i+step <= len(out); i += step {
+		v := math.Max(-1, math.Min(f.sample(out[i:])*gain, 1))
+		if f.BitsPerSample == 8 {
+			out[i] = byte(math.Round(v*127) + 128)
+		} else {
+			binary.LittleEndian.PutUint16(out[i:], uint16(int16(math.Round(v*32767))))
+		}
+	}
+	return encodeWAV(f, out), nil
+}
+
+// gain returns the factor the samples have to be multiplied by to
+// reach the target loudness, false if their loudness cannot be
+// measured.
+func (n LoudnessNormalizer) gain(f wavFormat, samples []byte) (float64, bool) {
+	if !f.pcm() {
+		return 0, false
+	}
+	loudness, peak, ok := measureLoudness(f, samples)
+	if !ok || peak == 0 {
+		return 0, false
+	}
+	gain := math.Pow(10, (n.target()-loudness)/20)
+	if peak*gain > loudnessCeiling {
+		gain = loudnessCeiling / peak
+	}
+	return gain, true
+}
+
+// pcm reports whether `f` is 8 or 16 bit PCM, which
+// sample is able to read.
+func (f wavFormat) pcm() bool {
+	return f.AudioFormat == 1 && (f.BitsPerSample == 8 || f.BitsPerSample == 16) && f.Channels > 0 && f.SampleRate > 0
+}
+
+// biquad is a second order IIR filter.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+func (q *biquad) filter(x float64) float64 {
+	y := q.b0*x + q.z1
+	q.z1 = q.b1*x - q.a1*y + q.z2
+	q.z2 = q.b2*x - q.a2*y
+	return y
+}
+
+// kWeighting returns the two stages of the K-weighting filter of
+// ITU-R BS.1770 at sample rate `rate`: a high shelf modeling the
+// head, followed by a high pass.
+func kWeighting(rate float64) (shelf, highPass biquad) {
+	const (
+		shelfF0   = 1681.974450955533
+		shelfGain = 3.999843853973347
+		shelfQ    = 0.7071752369554196
+		passF0    = 38.13547087602444
+		passQ     = 0.5003270373238773
+	)
+	k := math.Tan(math.Pi * shelfF0 / rate)
+	vh := math.Pow(10, shelfGain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/shelfQ + k*k
+	shelf = biquad{
+		b0: (vh + vb*k/shelfQ + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/shelfQ + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/shelfQ + k*k) / a0,
+	}
+
+	k = math.Tan(math.Pi * passF0 / rate)
+	a0 = 1 + k/passQ + k*k
+	highPass = biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/passQ + k*k) / a0,
+	}
+	return shelf, highPass
+}
+
+// measureLoudness returns the integrated loudness, in LUFS, of the
+// PCM `samples`, gated as EBU R128 does, together with their sample
+// peak. It returns false if the samples are shorter than a block,
+// or silent.
+func measureLoudness(f wavFormat, samples []byte) (float64, float64, bool) {
+	channels := int(f.Channels)
+	step := int(f.BitsPerSample / 8)
+	frames := len(samples) / (step * channels)
+
+	// The mean square of the K-weighted samples of each
+	// 100ms step, summed over the channels.
+	hop := int(f.SampleRate) / 10
+	if hop == 0 || frames < 4*hop {
+		return 0, 0, false
+	}
+	filters := make([][2]biquad, channels)
+	for i := range filters {
+		filters[i][0], filters[i][1] = kWeighting(float64(f.SampleRate))
+	}
+	steps := make([]float64, frames/hop)
+	peak := 0.0
+	for i := 0; i < len(steps)*hop; i++ {
+		for ch := 0; ch < channels; ch++ {
+			v := f.sample(samples[(i*channels+ch)*step:])
+			peak = math.Max(peak, math.Abs(v))
+			y := filters[ch][1].filter(filters[ch][0].filter(v))
+			steps[i/hop] += y * y / float64(hop)
+		}
+	}
+
+	// Blocks are 400ms long and overlap by 75%.
+	blocks := make([]float64, 0, len(steps)-3)
+	for i := 0; i+4 <= len(steps); i++ {
+		blocks = append(blocks, (steps[i]+steps[i+1]+steps[i+2]+steps[i+3])/4)
+	}
+	lufs := func(z float64) float64 { return -0.691 + 10*math.Log10(z) }
+	gated := func(threshold float64) (float64, int) {
+		sum, n := 0.0, 0
+		for _, z := range blocks {
+			if z > 0 && lufs(z) > threshold {
+				sum += z
+				n++
+			}
+		}
+		return sum, n
+	}
+	sum, n := gated(-70)
+	if n == 0 {
+		return 0, peak, false
+	}
+	if sum, n = gated(lufs(sum/float64(n)) - 10); n == 0 {
+		return 0, peak, false
+	}
+	return lufs(sum / float64(n)), peak, true
+}
+
+// normalizedRec returns the recording `data` normalized by `n`. If
+// normalization fails, the recording is returned as is.
+func normalizedRec(ctx context.Context, n *LoudnessNormalizer, data []byte, format string, lg *log.Logger) []byte {
+	normalized, err := n.Normalize(ctx, data, format)
+	if err != nil {
+		logger(lg).Printf("store recording handler: unable to normalize loudness: %v", err)
+		return data
+	}
+	return normalized
+}
@@ -0,0 +1,66 @@
+package nexmo_test
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+// sine returns `secs` seconds of a 1kHz sine at 8kHz,
+// with amplitude `amp`.
+func sine(amp float64, secs int) []int16 {
+	samples := make([]int16, secs*8000)
+	for i := range samples {
+		samples[i] = int16(amp * 32767 * math.Sin(2*math.Pi*1000*float64(i)/8000))
+	}
+	return samples
+}
+
+// rms returns the root mean square of the samples of the
+// 16 bit mono wav file `data`.
+func rms(data []byte) float64 {
+	samples := data[44:]
+	sum := 0.0
+	for i := 0; i+2 <= len(samples); i += 2 {
+		v := float64(int16(binary.LittleEndian.Uint16(samples[i:]))) / 32768
+		sum += v * v
+	}
+	return math.Sqrt(sum / float64(len(samples)/2))
+}
+
+func TestLoudnessNormalizer_wav(t *testing.T) {
+	n := nexmo.LoudnessNormalizer{}
+	quiet, err := n.Normalize(context.TODO(), wav(sine(0.01, 3)), nexmo.FormatWAV)
+	if err != nil {
+		t.Fatalf("Unexpected normalize error: %v", err)
+	}
+	loud, err := n.Normalize(context.TODO(), wav(sine(0.5, 3)), nexmo.FormatWAV)
+	if err != nil {
+		t.Fatalf("Unexpected normalize error: %v", err)
+	}
+	// A 1kHz sine at -23 LUFS has a RMS of about -23 dBFS.
+	for _, v := range [][]byte{quiet, loud} {
+		if db := 20 * math.Log10(rms(v)); math.Abs(db-nexmo.DefaultLoudness) > 1 {
+			t.Fatalf("Wanted about %v dBFS, found %v", nexmo.DefaultLoudness, db)
+		}
+	}
+
+	// The gain is lowered not to clip.
+	n.Target = -5
+	clipped, err := n.Normalize(context.TODO(), wav(sine(0.5, 3)), nexmo.FormatWAV)
+	if err != nil {
+		t.Fatalf("Unexpected normalize error: %v", err)
+	}
+	if peak := rms(clipped) * math.Sqrt2; peak > 0.9 {
+		t.Fatalf("Wanted the peak to stay under -1 dBFS, found %v", peak)
+	}
+
+	// Silence is left as it is.
+	silence := wav(make([]int16, 8000))
+	if out, err := n.Normalize(context.TODO(), silence, nexmo.FormatWAV); err != nil || len(out) != len(silence) {
+		t.Fatalf("Wanted silence to be left as is, found %d bytes, %v", len(out), err)
+	}
+}
@@ -0,0 +1,620 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package nexmotest provides a fake implementation of nexmo's
+// REST API, together with helpers that synthesize its webhooks,
+// so that the router, the Client and the broadcast flow can be
+// tested without credentials and without placing real calls.
+package nexmotest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+// Endpoint is a party of a call, as encoded by nexmo.
+type Endpoint struct {
+	Type   string `json:"type"`
+	Number string `json:"number"`
+}
+
+// Call is a call created through POST /v1/calls.
+type Call struct {
+	UUID             string                   `json:"uuid"`
+	ConversationUUID string                   `json:"conversation_uuid"`
+	To               []Endpoint               `json:"to"`
+	From             Endpoint                 `json:"from"`
+	AnswerURL        []string                 `json:"answer_url"`
+	EventURL         []string                 `json:"event_url"`
+	MachineDetection string                   `json:"machine_detection"`
+	NCCO             []map[string]interface{} `json:"ncco"`
+	// Status is "started" until the call is hung up.
+	Status string `json:"-"`
+	// Updates are the modifications received through
+	// PUT /v1/calls/{uuid}, in order.
+	Updates []nexmo.CallUpdate `json:"-"`
+}
+
+// Message is a message sent through POST /v1/messages.
+type Message struct {
+	UUID        string `json:"message_uuid"`
+	MessageType string `json:"message_type"`
+	Channel     string `json:"channel"`
+	To          string `json:"to"`
+	From        string `json:"from"`
+	Text        string `json:"text"`
+}
+
+// The credentials of the account accepted by the fake server,
+// set on the clients it creates.
+const (
+	APIKey    = "key"
+	APISecret = "secret"
+)
+
+// Server is a fake nexmo REST API. Requests must carry a JWT
+// signed with the key of one of the clients it created, or
+// the credentials of the account for the account APIs.
+type Server struct {
+	*httptest.Server
+	// Fail, if set, is consulted before creating each call
+	// or message: a status code different from zero is
+	// returned instead of creating it. 429 responses ask
+	// to retry after a second.
+	Fail func(to string) int
+
+	key *rsa.PrivateKey
+
+	mu         sync.Mutex
+	calls      []Call
+	messages   []Message
+	recordings map[string][]byte
+	apps       map[string]nexmo.Application
+	numbers    []nexmo.Number
+	// changed is closed, and replaced, whenever a call
+	// or a message is created or updated.
+	changed chan struct{}
+}
+
+// NewServer starts a fake nexmo REST API. Close it when done.
+func NewServer() (*Server, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("nexmotest: unable to generate key: %v", err)
+	}
+	s := &Server{
+		key:        key,
+		recordings: make(map[string][]byte),
+		apps:       make(map[string]nexmo.Application),
+		changed:    make(chan struct{}),
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/v1/calls", s.handleCreateCall).Methods("POST")
+	r.HandleFunc("/v1/calls", s.handleListCalls).Methods("GET")
+	r.HandleFunc("/v1/calls/{uuid}", s.handleGetCall).Methods("GET")
+	r.HandleFunc("/v1/calls/{uuid}", s.handleUpdateCall).Methods("PUT")
+	r.HandleFunc("/v1/messages", s.handleSendMessage).Methods("POST")
+	r.HandleFunc("/v1/files/{uuid}", s.handleRecording).Methods("GET")
+	r.Handle("/account/numbers", s.account(http.HandlerFunc(s.handleOwnedNumbers))).Methods("GET")
+	r.Handle("/number/search", s.account(http.HandlerFunc(s.handleSearchNumbers))).Methods("GET")
+	r.Handle("/number/{op:buy|cancel|update}", s.account(http.HandlerFunc(s.handleNumber))).Methods("POST")
+	r.Handle("/v2/applications", s.account(http.HandlerFunc(s.handleCreateApp))).Methods("POST")
+	r.Handle("/v2/applications", s.account(http.HandlerFunc(s.handleListApps))).Methods("GET")
+	r.Handle("/v2/applications/{id}", s.account(http.HandlerFunc(s.handleGetApp))).Methods("GET")
+	r.Handle("/v2/applications/{id}", s.account(http.HandlerFunc(s.handleUpdateApp))).Methods("PUT")
+	s.Server = httptest.NewServer(s.authorize(r))
+	return s, nil
+}
+
+// PrivateKeyPEM returns the application private key accepted
+// by the fake server, PEM encoded.
+func (s *Server) PrivateKeyPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(s.key),
+	})
+}
+
+// NewClient returns a client talking to the fake server.
+func (s *Server) NewClient(appID, number, origin string) (*nexmo.Client, error) {
+	c, err := nexmo.NewClient(bytes.NewReader(s.PrivateKeyPEM()), appID, number, origin)
+	if err != nil {
+		return nil, err
+	}
+	c.BaseURL = s.URL
+	c.APIKey, c.APISecret = APIKey, APISecret
+	c.RestURL = s.URL
+	return c, nil
+}
+
+// AddNumber adds `n` to the numbers owned by the account.
+func (s *Server) AddNumber(n nexmo.Number) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.numbers = append(s.numbers, n)
+}
+
+// Numbers returns the numbers owned by the account.
+func (s *Server) Numbers() []nexmo.Number {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]nexmo.Number{}, s.numbers...)
+}
+
+// AddApplication registers `a`, which the Applications API
+// then serves.
+func (s *Server) AddApplication(a nexmo.Application) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apps[a.ID] = a
+}
+
+// Application returns the application `id`, and false if
+// there is none.
+func (s *Server) Application(id string) (nexmo.Application, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.apps[id]
+	return a, ok
+}
+
+// Calls returns the calls created so far.
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call{}, s.calls...)
+}
+
+// Messages returns the messages sent so far.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message{}, s.messages...)
+}
+
+// WaitCalls returns the calls created so far as soon as they
+// are at least `n`, or after `timeout`.
+func (s *Server) WaitCalls(n int, timeout time.Duration) []Call {
+	s.wait(func() bool { return len(s.calls) >= n }, timeout)
+	return s.Calls()
+}
+
+// WaitMessages returns the messages sent so far as soon as
+// they are at least `n`, or after `timeout`.
+func (s *Server) WaitMessages(n int, timeout time.Duration) []Message {
+	s.wait(func() bool { return len(s.messages) >= n }, timeout)
+	return s.Messages()
+}
+
+// wait returns when `ready`, called with the lock held, returns
+// true, or after `timeout`.
+func (s *Server) wait(ready func() bool, timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		s.mu.Lock()
+		ok, changed := ready(), s.changed
+		s.mu.Unlock()
+		if ok {
+			return
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return
+		}
+	}
+}
+
+// notify wakes up the waiters. The lock must be held.
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// AddRecording makes `data` downloadable, returning its
+// uuid and the URL nexmo would report in the recording event.
+func (s *Server) AddRecording(data []byte) (string, string) {
+	id := uuid.New().String()
+	s.mu.Lock()
+	s.recordings[id] = data
+	s.mu.Unlock()
+	return id, s.URL + "/v1/files/" + id
+}
+
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := r.BasicAuth(); ok {
+			// Checked by account.
+			next.ServeHTTP(w, r)
+			return
+		}
+		raw := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		_, err := jwt.Parse(raw, func(t *jwt.Token) (interface{}, error) {
+			if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+				return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+			}
+			return &s.key.PublicKey, nil
+		})
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// account refuses the requests without the credentials of
+// the account.
+func (s *Server) account(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key, secret, ok := r.BasicAuth(); !ok || key != APIKey || secret != APISecret {
+			writeError(w, http.StatusUnauthorized, "invalid account credentials")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) fail(w http.ResponseWriter, to string) bool {
+	if s.Fail == nil {
+		return false
+	}
+	if code := s.Fail(to); code != 0 {
+		if code == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "1")
+		}
+		writeError(w, code, "failure requested by the test")
+		return true
+	}
+	return false
+}
+
+func (s *Server) handleCreateCall(w http.ResponseWriter, r *http.Request) {
+	var c Call
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(c.To) != 1 || (len(c.AnswerURL) == 0 && len(c.NCCO) == 0) {
+		writeError(w, http.StatusBadRequest, "exactly one recipient and either answer_url or ncco are required")
+		return
+	}
+	if s.fail(w, c.To[0].Number) {
+		return
+	}
+
+	c.UUID = uuid.New().String()
+	c.ConversationUUID = "CON-" + uuid.New().String()
+	c.Status = "started"
+	s.mu.Lock()
+	s.calls = append(s.calls, c)
+	s.notify()
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, map[string]string{
+		"uuid":              c.UUID,
+		"status":            "started",
+		"direction":         "outbound",
+		"conversation_uuid": c.ConversationUUID,
+	})
+}
+
+func (c Call) info() nexmo.CallInfo {
+	return nexmo.CallInfo{
+		UUID:             c.UUID,
+		ConversationUUID: c.ConversationUUID,
+		To:               nexmo.Contact{Type: c.To[0].Type, Number: c.To[0].Number},
+		From:             nexmo.Contact{Type: c.From.Type, Number: c.From.Number},
+		Status:           c.Status,
+		Direction:        "outbound",
+	}
+}
+
+func (s *Server) handleGetCall(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range s.calls {
+		if v.UUID == mux.Vars(r)["uuid"] {
+			writeJSON(w, http.StatusOK, v.info())
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "call not found")
+}
+
+// handleOwnedNumbers supports the pattern, application_id,
+// size and index parameters.
+func (s *Server) handleOwnedNumbers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var numbers []nexmo.Number
+	for _, v := range s.Numbers() {
+		if strings.HasPrefix(v.MSISDN, q.Get("pattern")) && (q.Get("application_id") == "" || v.AppID == q.Get("application_id")) {
+			numbers = append(numbers, v)
+		}
+	}
+	writeNumbers(w, r, numbers)
+}
+
+// handleSearchNumbers offers ten voice numbers of the country,
+// made of its code, 0 and the pattern.
+func (s *Server) handleSearchNumbers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var numbers []nexmo.Number
+	for i := 0; i < 10; i++ {
+		numbers = append(numbers, nexmo.Number{
+			Country:  q.Get("country"),
+			MSISDN:   fmt.Sprintf("390%s%d", q.Get("pattern"), i),
+			Type:     "landline",
+			Features: []string{"VOICE"},
+			Cost:     "0.90",
+		})
+	}
+	writeNumbers(w, r, numbers)
+}
+
+func writeNumbers(w http.ResponseWriter, r *http.Request, numbers []nexmo.Number) {
+	size, _ := strconv.Atoi(r.URL.Query().Get("size"))
+	index, _ := strconv.Atoi(r.URL.Query().Get("index"))
+	if size <= 0 {
+		size = 10
+	}
+	if index <= 0 {
+		index = 1
+	}
+	page := []nexmo.Number{}
+	for i := (index - 1) * size; i < len(numbers) && i < index*size; i++ {
+		page = append(page, numbers[i])
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"count": len(numbers), "numbers": page})
+}
+
+// statusMethodFailed is returned by the Numbers API when the
+// operation is not possible, e.g. buying an owned number.
+const statusMethodFailed = 420
+
+// handleNumber buys, cancels or links the number, answering as
+// the Numbers API does: with the error code in the body.
+func (s *Server) handleNumber(w http.ResponseWriter, r *http.Request) {
+	country, msisdn := r.FormValue("country"), r.FormValue("msisdn")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	owned := -1
+	for i, v := range s.numbers {
+		if v.MSISDN == msisdn {
+			owned = i
+		}
+	}
+	result := func(code int, label string) {
+		writeJSON(w, code, map[string]string{"error-code": strconv.Itoa(code), "error-code-label": label})
+	}
+	switch op := mux.Vars(r)["op"]; {
+	case op == "buy" && owned >= 0:
+		result(statusMethodFailed, "number already owned")
+	case op == "buy":
+		s.numbers = append(s.numbers, nexmo.Number{Country: country, MSISDN: msisdn, Type: "landline", Features: []string{"VOICE"}})
+		result(http.StatusOK, "success")
+	case owned < 0:
+		result(statusMethodFailed, "number not owned")
+	case op == "cancel":
+		s.numbers = append(s.numbers[:owned], s.numbers[owned+1:]...)
+		result(http.StatusOK, "success")
+	default:
+		s.numbers[owned].AppID = r.FormValue("app_id")
+		result(http.StatusOK, "success")
+	}
+}
+
+// handleCreateApp generates the key pair of the applications
+// created without a public key.
+func (s *Server) handleCreateApp(w http.ResponseWriter, r *http.Request) {
+	var a nexmo.Application
+	if err := json.NewDecoder(r.Body).Decode(&a); err != nil || a.Name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	a.ID = uuid.New().String()
+	if a.Keys.PublicKey == "" {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		pub, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		a.Keys.PublicKey = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}))
+		s.AddApplication(a)
+		priv, _ := x509.MarshalPKCS8PrivateKey(key)
+		a.Keys.PrivateKey = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: priv}))
+	} else {
+		s.AddApplication(a)
+	}
+	writeJSON(w, http.StatusCreated, a)
+}
+
+func (s *Server) handleListApps(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	apps := make([]nexmo.Application, 0, len(s.apps))
+	for _, v := range s.apps {
+		apps = append(apps, v)
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"total_items": len(apps),
+		"_embedded":   map[string]interface{}{"applications": apps},
+	})
+}
+
+func (s *Server) handleGetApp(w http.ResponseWriter, r *http.Request) {
+	a, ok := s.Application(mux.Vars(r)["id"])
+	if !ok {
+		writeError(w, http.StatusNotFound, "application not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, a)
+}
+
+func (s *Server) handleUpdateApp(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, ok := s.Application(id); !ok {
+		writeError(w, http.StatusNotFound, "application not found")
+		return
+	}
+	var a nexmo.Application
+	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	a.ID = id
+	s.AddApplication(a)
+	writeJSON(w, http.StatusOK, a)
+}
+
+// handleListCalls supports the status and conversation_uuid
+// filters, and pagination.
+func (s *Server) handleListCalls(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	size, err := strconv.Atoi(q.Get("page_size"))
+	if err != nil || size <= 0 {
+		size = 10
+	}
+	index, _ := strconv.Atoi(q.Get("record_index"))
+
+	s.mu.Lock()
+	matching := []nexmo.CallInfo{}
+	for _, v := range s.calls {
+		if status := q.Get("status"); status != "" && v.Status != status {
+			continue
+		}
+		if conv := q.Get("conversation_uuid"); conv != "" && v.ConversationUUID != conv {
+			continue
+		}
+		matching = append(matching, v.info())
+	}
+	s.mu.Unlock()
+
+	page := []nexmo.CallInfo{}
+	if index < len(matching) {
+		page = matching[index:]
+	}
+	if len(page) > size {
+		page = page[:size]
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"count":        len(matching),
+		"page_size":    size,
+		"record_index": index,
+		"_embedded": map[string]interface{}{
+			"calls": page,
+		},
+	})
+}
+
+func (s *Server) handleUpdateCall(w http.ResponseWriter, r *http.Request) {
+	var u nexmo.CallUpdate
+	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	switch u.Action {
+	case nexmo.CallHangup, nexmo.CallMute, nexmo.CallUnmute, nexmo.CallEarmuff, nexmo.CallUnearmuff:
+	case nexmo.CallTransfer:
+		if u.Destination == nil || (len(u.Destination.NCCO) == 0 && len(u.Destination.URL) == 0) {
+			writeError(w, http.StatusBadRequest, "transfer requires a destination")
+			return
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "unknown action "+u.Action)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, v := range s.calls {
+		if v.UUID == mux.Vars(r)["uuid"] {
+			s.calls[i].Updates = append(v.Updates, u)
+			s.notify()
+			if u.Action == nexmo.CallHangup {
+				s.calls[i].Status = "completed"
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "call not found")
+}
+
+func (s *Server) handleSendMessage(w http.ResponseWriter, r *http.Request) {
+	var m Message
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if s.fail(w, m.To) {
+		return
+	}
+
+	m.UUID = uuid.New().String()
+	s.mu.Lock()
+	s.messages = append(s.messages, m)
+	s.notify()
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"message_uuid": m.UUID})
+}
+
+func (s *Server) handleRecording(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	data, ok := s.recordings[mux.Vars(r)["uuid"]]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "recording not found")
+		return
+	}
+	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Write(data)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, detail string) {
+	w.Header().Set("X-Request-Id", uuid.New().String())
+	writeJSON(w, code, map[string]string{
+		"type":   "https://developer.nexmo.com/api-errors",
+		"title":  http.StatusText(code),
+		"detail": detail,
+	})
+}
@@ -0,0 +1,124 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmotest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+)
+
+// AnswerWebhook returns the request nexmo makes when `from`
+// calls the application number.
+func AnswerWebhook(from, conversationUUID string) *http.Request {
+	q := url.Values{}
+	q.Set("from", from)
+	q.Set("conversation_uuid", conversationUUID)
+	q.Set("uuid", "fake-"+conversationUUID)
+	return httptest.NewRequest("GET", "/record/voice/answer?"+q.Encode(), nil)
+}
+
+// EventWebhook returns the voice event request nexmo posts
+// to `path`. `duration` is only reported by completed calls.
+func EventWebhook(path, conversationUUID, status string, duration time.Duration) *http.Request {
+	event := map[string]string{
+		"uuid":              "fake-" + conversationUUID,
+		"conversation_uuid": conversationUUID,
+		"status":            status,
+		"timestamp":         time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	if status == "completed" {
+		event["duration"] = fmt.Sprintf("%d", int(duration.Seconds()))
+	}
+	return jsonRequest(path, event)
+}
+
+// RecordingWebhook returns the request nexmo posts once the
+// recording `recUUID`, see Server.AddRecording, is available.
+func RecordingWebhook(recURL, recUUID, conversationUUID string) *http.Request {
+	return RecordingWebhookLength(recURL, recUUID, conversationUUID, 0)
+}
+
+// RecordingWebhookLength is RecordingWebhook, reporting a
+// recording `length` long.
+func RecordingWebhookLength(recURL, recUUID, conversationUUID string, length time.Duration) *http.Request {
+	end := time.Now().UTC()
+	return jsonRequest("/store/recording/event", map[string]string{
+		"recording_url":     recURL,
+		"recording_uuid":    recUUID,
+		"conversation_uuid": conversationUUID,
+		"start_time":        end.Add(-length).Format(time.RFC3339),
+		"end_time":          end.Format(time.RFC3339),
+	})
+}
+
+// NotifyWebhook returns the request nexmo posts to `path` when
+// the call flow reaches a notify action carrying `payload`.
+func NotifyWebhook(path, conversationUUID string, payload interface{}) *http.Request {
+	return jsonRequest(path, map[string]interface{}{
+		"conversation_uuid": conversationUUID,
+		"payload":           payload,
+		"timestamp":         time.Now().UTC().Format(time.RFC3339Nano),
+	})
+}
+
+// InputWebhook returns the request nexmo posts to `path` when
+// the caller presses `digits` during an input action.
+func InputWebhook(path, conversationUUID, digits string) *http.Request {
+	return jsonRequest(path, map[string]interface{}{
+		"conversation_uuid": conversationUUID,
+		"dtmf":              map[string]interface{}{"digits": digits, "timed_out": false},
+		"timestamp":         time.Now().UTC().Format(time.RFC3339Nano),
+	})
+}
+
+// Answer simulates nexmo answering `call`: its answer URL is
+// requested from `h`, and the returned NCCO is decoded.
+func Answer(h http.Handler, call Call) ([]map[string]interface{}, error) {
+	if len(call.NCCO) > 0 {
+		return call.NCCO, nil
+	}
+	if len(call.AnswerURL) == 0 {
+		return nil, fmt.Errorf("call %s has neither ncco nor answer_url", call.UUID)
+	}
+	u, err := url.Parse(call.AnswerURL[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid answer url: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", u.RequestURI(), nil))
+	if w.Code != http.StatusOK {
+		return nil, fmt.Errorf("answer url %s returned %d", u.RequestURI(), w.Code)
+	}
+	var ncco []map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&ncco); err != nil {
+		return nil, fmt.Errorf("unable to decode ncco: %v", err)
+	}
+	return ncco, nil
+}
+
+func jsonRequest(path string, v interface{}) *http.Request {
+	b, _ := json.Marshal(v)
+	r := httptest.NewRequest("POST", path, bytes.NewReader(b))
+	r.Header.Set("Content-Type", "application/json")
+	return r
+}
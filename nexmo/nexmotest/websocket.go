@@ -0,0 +1,155 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmotest
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// Websocket is nexmo's side of the websocket opened by a
+// connect action.
+type Websocket struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// DialWebsocket opens the ws:// `uri` like nexmo does, sending
+// the connection metadata first.
+func DialWebsocket(uri string) (*Websocket, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("nexmotest: %v", err)
+	}
+	conn, err := net.Dial("tcp", u.Host)
+	if err != nil {
+		return nil, fmt.Errorf("nexmotest: %v", err)
+	}
+
+	key := make([]byte, 16)
+	rand.Read(key)
+	req, _ := http.NewRequest("GET", "http://"+u.Host+u.RequestURI(), nil)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", base64.StdEncoding.EncodeToString(key))
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err = req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("nexmotest: %v", err)
+	}
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("nexmotest: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, fmt.Errorf("nexmotest: websocket refused: %s", resp.Status)
+	}
+
+	ws := &Websocket{conn: conn, r: r}
+	meta, _ := json.Marshal(map[string]string{
+		"event":        "websocket:connected",
+		"content-type": "audio/l16;rate=16000",
+	})
+	if err = ws.write(0x1, meta); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ws, nil
+}
+
+// Send sends the audio frame `data`.
+func (ws *Websocket) Send(data []byte) error {
+	return ws.write(0x2, data)
+}
+
+// write sends a single masked frame, as clients must.
+func (ws *Websocket) write(op byte, data []byte) error {
+	hdr := []byte{0x80 | op}
+	switch n := len(data); {
+	case n < 126:
+		hdr = append(hdr, 0x80|byte(n))
+	case n <= 0xffff:
+		hdr = append(hdr, 0x80|126, byte(n>>8), byte(n))
+	default:
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], uint64(n))
+		hdr = append(append(hdr, 0x80|127), b[:]...)
+	}
+	mask := make([]byte, 4)
+	rand.Read(mask)
+	masked := make([]byte, len(data))
+	for i := range data {
+		masked[i] = data[i] ^ mask[i%4]
+	}
+	if _, err := ws.conn.Write(append(append(hdr, mask...), masked...)); err != nil {
+		return fmt.Errorf("nexmotest: %v", err)
+	}
+	return nil
+}
+
+// Receive returns the next audio frame, or io.EOF once the
+// server closes the websocket.
+func (ws *Websocket) Receive() ([]byte, error) {
+	for {
+		var h [2]byte
+		if _, err := io.ReadFull(ws.r, h[:]); err != nil {
+			return nil, err
+		}
+		n := uint64(h[1] & 0x7f)
+		switch n {
+		case 126:
+			var b [2]byte
+			if _, err := io.ReadFull(ws.r, b[:]); err != nil {
+				return nil, err
+			}
+			n = uint64(binary.BigEndian.Uint16(b[:]))
+		case 127:
+			var b [8]byte
+			if _, err := io.ReadFull(ws.r, b[:]); err != nil {
+				return nil, err
+			}
+			n = binary.BigEndian.Uint64(b[:])
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(ws.r, data); err != nil {
+			return nil, err
+		}
+		switch h[0] & 0x0f {
+		case 0x2:
+			return data, nil
+		case 0x8:
+			return nil, io.EOF
+		}
+	}
+}
+
+// Close closes the websocket, as nexmo does when the call ends.
+func (ws *Websocket) Close() error {
+	ws.write(0x8, []byte{0x03, 0xe8})
+	return ws.conn.Close()
+}
@@ -0,0 +1,124 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"net/url"
+)
+
+// BroadcastSummary is what the notifiers are told about a
+// completed broadcast.
+type BroadcastSummary struct {
+	Broadcast Broadcast
+	Succeeded int
+	Failed    int
+	// RecURL is where the recording is served, empty for
+	// the broadcasts without one, like the conferences, or
+	// whose recording is hosted by nexmo.
+	RecURL string
+	// Transcript is the text of the recording, if it has
+	// been transcribed.
+	Transcript string
+}
+
+// Notifier delivers the summaries of the completed broadcasts,
+// e.g. to the administrators.
+type Notifier interface {
+	NotifyBroadcast(ctx context.Context, s BroadcastSummary) error
+}
+
+// StartNotifier is implemented by the notifiers that are also
+// told when the broadcasts start.
+type StartNotifier interface {
+	NotifyStart(ctx context.Context, b Broadcast) error
+}
+
+// FailureNotifier is implemented by the notifiers that are also
+// told about each recipient that could not be called, once the
+// attempts to call it are over.
+type FailureNotifier interface {
+	NotifyFailure(ctx context.Context, b Broadcast, r CallResult) error
+}
+
+// notifyStart tells the StartNotifiers that `b` has started.
+func (c *Client) notifyStart(ctx context.Context, b Broadcast) {
+	for _, v := range c.Notifiers {
+		if n, ok := v.(StartNotifier); ok {
+			if err := n.NotifyStart(ctx, b); err != nil {
+				c.logger().Printf("notify start error: %v", err)
+			}
+		}
+	}
+}
+
+// notifyFailures tells the FailureNotifiers about the failed
+// results of `b` as they are read from `results`, which are
+// passed on.
+func (c *Client) notifyFailures(ctx context.Context, b Broadcast, results <-chan CallResult) <-chan CallResult {
+	var notifiers []FailureNotifier
+	for _, v := range c.Notifiers {
+		if n, ok := v.(FailureNotifier); ok {
+			notifiers = append(notifiers, n)
+		}
+	}
+	if len(notifiers) == 0 {
+		return results
+	}
+	out := make(chan CallResult)
+	go func() {
+		defer close(out)
+		for r := range results {
+			if r.Err != nil {
+				for _, n := range notifiers {
+					if err := n.NotifyFailure(ctx, b, r); err != nil {
+						c.logger().Printf("notify failure error: %v", err)
+					}
+				}
+			}
+			out <- r
+		}
+	}()
+	return out
+}
+
+// notifyBroadcast tells the notifiers about `report`. The
+// transcript is read from `p`, if it is a TranscriptStore.
+func (c *Client) notifyBroadcast(ctx context.Context, p ContactsProvider, report *BroadcastReport) {
+	if len(c.Notifiers) == 0 {
+		return
+	}
+	b := report.Broadcast
+	s := BroadcastSummary{
+		Broadcast: b,
+		Succeeded: report.Succeeded,
+		Failed:    report.Failed,
+	}
+	if b.RecName != "" && b.Conference == "" && b.Audio == "" && !b.hosted() {
+		s.RecURL = c.Origin + "/static/" + url.PathEscape(b.RecName)
+		if ts, ok := p.(TranscriptStore); ok {
+			if t, err := ts.Transcript(ctx, b.RecName); err == nil {
+				s.Transcript = t.Text
+			}
+		}
+	}
+	for _, v := range c.Notifiers {
+		if err := v.NotifyBroadcast(ctx, s); err != nil {
+			c.logger().Printf("notify broadcast error: %v", err)
+		}
+	}
+}
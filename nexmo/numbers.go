@@ -0,0 +1,179 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultRestURL is the address of nexmo's account REST API,
+// serving the Numbers API among others.
+const DefaultRestURL = "https://rest.nexmo.com"
+
+// numbersPageSize is the largest page of the Numbers API.
+const numbersPageSize = 100
+
+// Number is a phone number, either owned by the account or
+// available to be bought.
+type Number struct {
+	// Country is the ISO 3166-1 alpha-2 code of the
+	// country of the number, e.g. "IT".
+	Country string `json:"country"`
+	// MSISDN is the number in E.164 format, without
+	// the leading plus.
+	MSISDN string `json:"msisdn"`
+	// Type is e.g. "landline" or "mobile-lvn".
+	Type     string   `json:"type"`
+	Features []string `json:"features"`
+	// AppID is the application the number is linked to,
+	// if any. Owned numbers only.
+	AppID string `json:"app_id,omitempty"`
+	// Cost is the monthly price of the number. Available
+	// numbers only.
+	Cost string `json:"cost,omitempty"`
+}
+
+// NumberFilter selects the numbers listed by OwnedNumbers and
+// SearchNumbers. Empty fields select every number.
+type NumberFilter struct {
+	// Pattern is matched against the beginning of the
+	// numbers, e.g. "3932".
+	Pattern string
+	// AppID selects the numbers linked to an application.
+	// Owned numbers only.
+	AppID string
+}
+
+func (c *Client) restURL() string {
+	if c.RestURL == "" {
+		return DefaultRestURL
+	}
+	return c.RestURL
+}
+
+// listNumbers pages through the numbers served at `path`.
+func (c *Client) listNumbers(ctx context.Context, path string, params url.Values) ([]Number, error) {
+	header, err := c.accountHeader()
+	if err != nil {
+		return nil, err
+	}
+	params.Set("size", strconv.Itoa(numbersPageSize))
+	var numbers []Number
+	for index := 1; ; index++ {
+		params.Set("index", strconv.Itoa(index))
+		resp, err := c.doPaced(ctx, GetLimiter, "GET", c.restURL()+path+"?"+params.Encode(), nil, header)
+		if err != nil {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, fmt.Errorf("numbers: %w", err)
+		}
+		var page struct {
+			Count   int      `json:"count"`
+			Numbers []Number `json:"numbers"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("numbers: unable to decode response: %v", err)
+		}
+		numbers = append(numbers, page.Numbers...)
+		if len(page.Numbers) < numbersPageSize || len(numbers) >= page.Count {
+			return numbers, nil
+		}
+	}
+}
+
+// OwnedNumbers returns the numbers owned by the account selected
+// by `f`.
+func (c *Client) OwnedNumbers(ctx context.Context, f NumberFilter) ([]Number, error) {
+	params := url.Values{}
+	if f.Pattern != "" {
+		params.Set("pattern", f.Pattern)
+		params.Set("search_pattern", "0")
+	}
+	if f.AppID != "" {
+		params.Set("application_id", f.AppID)
+	}
+	return c.listNumbers(ctx, "/account/numbers", params)
+}
+
+// SearchNumbers returns the voice numbers of `country` available
+// to be bought, selected by the Pattern of `f`.
+func (c *Client) SearchNumbers(ctx context.Context, country string, f NumberFilter) ([]Number, error) {
+	params := url.Values{"country": {strings.ToUpper(country)}, "features": {"VOICE"}}
+	if f.Pattern != "" {
+		params.Set("pattern", f.Pattern)
+		params.Set("search_pattern", "0")
+	}
+	return c.listNumbers(ctx, "/number/search", params)
+}
+
+// postNumber performs the operation at `path` on the number
+// `msisdn` of `country`.
+func (c *Client) postNumber(ctx context.Context, path, country, msisdn string, params url.Values) error {
+	params.Set("country", strings.ToUpper(country))
+	params.Set("msisdn", strings.TrimPrefix(msisdn, "+"))
+	header, err := c.accountHeader()
+	if err != nil {
+		return err
+	}
+	header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.doPaced(ctx, CallLimiter, "POST", c.restURL()+path, strings.NewReader(params.Encode()), header)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		// The error label, if any, is part of the *APIError.
+		return fmt.Errorf("numbers: %w", err)
+	}
+	var result struct {
+		Code  string `json:"error-code"`
+		Label string `json:"error-code-label"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if result.Code != "" && result.Code != "200" {
+		return fmt.Errorf("numbers: %s", result.Label)
+	}
+	return nil
+}
+
+// BuyNumber buys the number `msisdn` of `country`.
+func (c *Client) BuyNumber(ctx context.Context, country, msisdn string) error {
+	return c.postNumber(ctx, "/number/buy", country, msisdn, url.Values{})
+}
+
+// CancelNumber cancels the subscription of the number `msisdn`
+// of `country`, which is then no longer owned.
+func (c *Client) CancelNumber(ctx context.Context, country, msisdn string) error {
+	return c.postNumber(ctx, "/number/cancel", country, msisdn, url.Values{})
+}
+
+// LinkNumber links the number `msisdn` of `country` to the
+// application of the client, so that its calls reach the
+// webhooks of the application.
+func (c *Client) LinkNumber(ctx context.Context, country, msisdn string) error {
+	if c.AppID == "" {
+		return fmt.Errorf("numbers: link requires an application")
+	}
+	return c.postNumber(ctx, "/number/update", country, msisdn, url.Values{"app_id": {c.AppID}})
+}
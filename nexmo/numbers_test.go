@@ -0,0 +1,59 @@
+package nexmo_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+func TestClient_numbers(t *testing.T) {
+	srv, c := newTestClient(t)
+	ctx := context.TODO()
+
+	available, err := c.SearchNumbers(ctx, "it", nexmo.NumberFilter{Pattern: "2"})
+	if err != nil {
+		t.Fatalf("Unexpected search error: %v", err)
+	}
+	if len(available) != 10 || available[0].Country != "IT" || available[0].Cost == "" {
+		t.Fatalf("Unexpected available numbers: %+v", available)
+	}
+	if err = c.BuyNumber(ctx, "IT", "+"+available[0].MSISDN); err != nil {
+		t.Fatalf("Unexpected buy error: %v", err)
+	}
+	if err = c.BuyNumber(ctx, "IT", available[0].MSISDN); err == nil {
+		t.Fatalf("Wanted an owned number not to be bought again")
+	}
+	if err = c.LinkNumber(ctx, "IT", available[0].MSISDN); err != nil {
+		t.Fatalf("Unexpected link error: %v", err)
+	}
+
+	// More than a page of numbers.
+	for i := 0; i < 150; i++ {
+		srv.AddNumber(nexmo.Number{Country: "IT", MSISDN: fmt.Sprintf("39331%07d", i)})
+	}
+	owned, err := c.OwnedNumbers(ctx, nexmo.NumberFilter{})
+	if err != nil {
+		t.Fatalf("Unexpected list error: %v", err)
+	}
+	if len(owned) != 151 {
+		t.Fatalf("Wanted 151 owned numbers, found %d", len(owned))
+	}
+	linked, err := c.OwnedNumbers(ctx, nexmo.NumberFilter{AppID: "app"})
+	if err != nil || len(linked) != 1 || linked[0].MSISDN != available[0].MSISDN {
+		t.Fatalf("Wanted the linked number only, found %+v, %v", linked, err)
+	}
+
+	if err = c.CancelNumber(ctx, "IT", available[0].MSISDN); err != nil {
+		t.Fatalf("Unexpected cancel error: %v", err)
+	}
+	if len(srv.Numbers()) != 150 {
+		t.Fatalf("Wanted the number to be canceled, found %d numbers", len(srv.Numbers()))
+	}
+
+	c.APIKey = ""
+	if _, err = c.OwnedNumbers(ctx, nexmo.NumberFilter{}); err != nexmo.ErrNoAccount {
+		t.Fatalf("Wanted %v, found %v", nexmo.ErrNoAccount, err)
+	}
+}
@@ -0,0 +1,524 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// OIDCAnyGroup, used as a Roles key, matches every user
+// the provider authenticates.
+const OIDCAnyGroup = "*"
+
+// Paths of the OIDC login flow.
+const (
+	OIDCLoginPath    = "/admin/oidc/login"
+	OIDCCallbackPath = "/admin/oidc/callback"
+)
+
+const (
+	oidcSessionCookie = "voicebr_session"
+	oidcStateCookie   = "voicebr_oidc_state"
+)
+
+// OIDC authenticates the users of an OpenID Connect provider,
+// e.g. Google or Keycloak, through their ID tokens. API clients
+// send them as bearer tokens, while browsers obtain them through
+// the login flow, see LoginHandler and CallbackHandler, which
+// stores them in a session cookie.
+type OIDC struct {
+	// Issuer is the URL of the provider, e.g.
+	// "https://accounts.google.com".
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is where the provider sends the users back
+	// to, i.e. the origin followed by OIDCCallbackPath.
+	RedirectURL string
+	// GroupsClaim is the ID token claim listing the groups of
+	// the user, "groups" if empty.
+	GroupsClaim string
+	// Roles maps the groups of the users to the scope they are
+	// granted, nil granting everything. Users belonging to more
+	// groups are granted the union of their scopes, while the ones
+	// belonging to none are refused. See OIDCAnyGroup.
+	Roles map[string]*Scope
+	// Client talks to the provider, http.DefaultClient if nil.
+	Client *http.Client
+
+	Log *log.Logger
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]interface{}
+	fetched   time.Time
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+func (o *OIDC) client() *http.Client {
+	if o.Client == nil {
+		return http.DefaultClient
+	}
+	return o.Client
+}
+
+func (o *OIDC) getJSON(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := o.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// provider returns the provider configuration, fetching it
+// on first use.
+func (o *OIDC) provider(ctx context.Context) (*oidcDiscovery, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.discovery != nil {
+		return o.discovery, nil
+	}
+	var d oidcDiscovery
+	if err := o.getJSON(ctx, strings.TrimSuffix(o.Issuer, "/")+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %v", err)
+	}
+	if d.Issuer != o.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer %q does not match %q", d.Issuer, o.Issuer)
+	}
+	o.discovery = &d
+	return o.discovery, nil
+}
+
+// key returns the signing key `kid`. The key set is fetched again
+// when the key is unknown, as providers rotate them, at most once
+// a minute.
+func (o *OIDC) key(ctx context.Context, kid string) (interface{}, error) {
+	d, err := o.provider(ctx)
+	if err != nil {
+		return nil, err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if k, ok := o.keys[kid]; ok {
+		return k, nil
+	}
+	if time.Since(o.fetched) < time.Minute {
+		return nil, fmt.Errorf("oidc: unknown key %q", kid)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	o.fetched = time.Now()
+	if err := o.getJSON(ctx, d.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("oidc keys: %v", err)
+	}
+	o.keys = make(map[string]interface{}, len(set.Keys))
+	for _, v := range set.Keys {
+		k, err := v.publicKey()
+		if err != nil {
+			logger(o.Log).Printf("oidc keys: skipping %q: %v", v.Kid, err)
+			continue
+		}
+		o.keys[v.Kid] = k
+	}
+	if k, ok := o.keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("oidc: unknown key %q", kid)
+}
+
+// jwk is a JSON web key, as served by the jwks_uri.
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	if k.Use != "" && k.Use != "sig" {
+		return nil, fmt.Errorf("not a signing key")
+	}
+	num := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := num(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := num(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := num(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := num(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// verify checks the signature, issuer, audience and expiration
+// of the ID token `raw`, returning its claims.
+func (o *OIDC) verify(ctx context.Context, raw string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		switch t.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		default:
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		kid, _ := t.Header["kid"].(string)
+		return o.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !claims.VerifyIssuer(o.Issuer, true) {
+		return nil, fmt.Errorf("unexpected issuer %v", claims["iss"])
+	}
+	if !audience(claims, o.ClientID) {
+		return nil, fmt.Errorf("unexpected audience %v", claims["aud"])
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, fmt.Errorf("token does not expire")
+	}
+	return claims, nil
+}
+
+// audience reports whether `id` is among the audiences of
+// `claims`, which may either be a string or a list.
+func audience(claims jwt.MapClaims, id string) bool {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return aud == id
+	case []interface{}:
+		for _, v := range aud {
+			if v == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// principal maps the user of `claims` to a Principal, through
+// its groups.
+func (o *OIDC) principal(claims jwt.MapClaims) (Principal, error) {
+	name := ""
+	for _, v := range []string{"email", "preferred_username", "sub"} {
+		if s, ok := claims[v].(string); ok && s != "" {
+			name = s
+			break
+		}
+	}
+
+	claim := o.GroupsClaim
+	if claim == "" {
+		claim = "groups"
+	}
+	groups := []string{OIDCAnyGroup}
+	if list, ok := claims[claim].([]interface{}); ok {
+		for _, v := range list {
+			if s, ok := v.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+	}
+
+	var scope *Scope
+	granted := false
+	for _, g := range groups {
+		s, ok := o.Roles[g]
+		switch {
+		case !ok:
+			continue
+		case s == nil:
+			return Principal{Name: name, Method: AuthOIDC}, nil
+		case !granted:
+			granted, scope = true, s
+		default:
+			scope = scope.union(s)
+		}
+	}
+	if !granted {
+		return Principal{}, fmt.Errorf("oidc: %s belongs to no role", name)
+	}
+	return Principal{Name: name, Method: AuthOIDC, Scope: scope}, nil
+}
+
+// union returns a scope granting what either `s` or `o` grant.
+func (s *Scope) union(o *Scope) *Scope {
+	acc := &Scope{Actions: append([]string{}, s.Actions...)}
+	for _, v := range o.Actions {
+		if !contains(acc.Actions, v) {
+			acc.Actions = append(acc.Actions, v)
+		}
+	}
+	// No groups allows the whole list.
+	if len(s.Groups) == 0 || len(o.Groups) == 0 {
+		return acc
+	}
+	acc.Groups = append([]string{}, s.Groups...)
+	for _, v := range o.Groups {
+		if !contains(acc.Groups, v) {
+			acc.Groups = append(acc.Groups, v)
+		}
+	}
+	return acc
+}
+
+// Authenticate accepts the requests carrying a valid ID token,
+// either as a bearer token or in the session cookie.
+func (o *OIDC) Authenticate(r *http.Request) (Principal, error) {
+	raw := credential(r)
+	if c, err := r.Cookie(oidcSessionCookie); raw == "" && err == nil {
+		raw = c.Value
+	}
+	// Other credentials, e.g. API keys, are not JWTs.
+	if strings.Count(raw, ".") != 2 {
+		return Principal{}, ErrUnauthorized
+	}
+	claims, err := o.verify(r.Context(), raw)
+	if err != nil {
+		logger(o.Log).Printf("oidc: %v", err)
+		return Principal{}, ErrUnauthorized
+	}
+	p, err := o.principal(claims)
+	if err != nil {
+		logger(o.Log).Print(err)
+		return Principal{}, ErrUnauthorized
+	}
+	return p, nil
+}
+
+// LoginURL is where the browsers are redirected to log in.
+func (o *OIDC) LoginURL(r *http.Request) string {
+	return OIDCLoginPath + "?" + url.Values{"next": {r.URL.RequestURI()}}.Encode()
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// LoginHandler redirects the users to the provider, which will
+// send them back to the CallbackHandler.
+func (o *OIDC) LoginHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d, err := o.provider(r.Context())
+		if err != nil {
+			logger(o.Log).Printf("oidc login handler: %v", err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		state, err := randomString()
+		if err != nil {
+			logger(o.Log).Printf("oidc login handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		next := r.URL.Query().Get("next")
+		if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") {
+			next = "/admin/dashboard/"
+		}
+
+		// The state doubles as nonce, and is checked on the
+		// way back against the cookie set here.
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcStateCookie,
+			Value:    state + "|" + next,
+			Path:     OIDCCallbackPath,
+			MaxAge:   600,
+			HttpOnly: true,
+			Secure:   strings.HasPrefix(o.RedirectURL, "https://"),
+			SameSite: http.SameSiteLaxMode,
+		})
+		q := url.Values{
+			"response_type": {"code"},
+			"client_id":     {o.ClientID},
+			"redirect_uri":  {o.RedirectURL},
+			"scope":         {"openid email profile"},
+			"state":         {state},
+			"nonce":         {state},
+		}
+		http.Redirect(w, r, d.AuthorizationEndpoint+"?"+q.Encode(), http.StatusFound)
+	}
+}
+
+// CallbackHandler exchanges the authorization code for an ID
+// token, storing it in the session cookie of the user.
+func (o *OIDC) CallbackHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, err := r.Cookie(oidcStateCookie)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		parts := strings.SplitN(c.Value, "|", 2)
+		if len(parts) != 2 || r.URL.Query().Get("state") != parts[0] {
+			logger(o.Log).Printf("oidc callback handler: state mismatch")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		state, next := parts[0], parts[1]
+		if e := r.URL.Query().Get("error"); e != "" {
+			logger(o.Log).Printf("oidc callback handler: provider error: %s", e)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		raw, err := o.exchange(r.Context(), r.URL.Query().Get("code"))
+		if err != nil {
+			logger(o.Log).Printf("oidc callback handler: %v", err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		claims, err := o.verify(r.Context(), raw)
+		if err != nil {
+			logger(o.Log).Printf("oidc callback handler: %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if claims["nonce"] != state {
+			logger(o.Log).Printf("oidc callback handler: nonce mismatch")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		p, err := o.principal(claims)
+		if err != nil {
+			logger(o.Log).Printf("oidc callback handler: %v", err)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		logger(o.Log).Printf("oidc callback handler: %s logged in", p.Name)
+
+		exp, _ := claims["exp"].(float64)
+		secure := strings.HasPrefix(o.RedirectURL, "https://")
+		http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: OIDCCallbackPath, MaxAge: -1})
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcSessionCookie,
+			Value:    raw,
+			Path:     "/",
+			Expires:  time.Unix(int64(exp), 0),
+			HttpOnly: true,
+			Secure:   secure,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, next, http.StatusFound)
+	}
+}
+
+// exchange redeems the authorization `code` at the token
+// endpoint, returning the ID token.
+func (o *OIDC) exchange(ctx context.Context, code string) (string, error) {
+	d, err := o.provider(ctx)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {o.RedirectURL},
+	}
+	req, err := http.NewRequest("POST", d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(o.ClientID), url.QueryEscape(o.ClientSecret))
+	resp, err := o.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("token exchange: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("token exchange: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || token.IDToken == "" {
+		return "", fmt.Errorf("token exchange: status %d: %s", resp.StatusCode, token.Error)
+	}
+	return token.IDToken, nil
+}
@@ -0,0 +1,188 @@
+package nexmo_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+)
+
+// fakeProvider is an OpenID Connect provider issuing the
+// tokens returned by its sign method.
+type fakeProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+	// code is the authorization code exchanged for idToken.
+	code, idToken string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/auth",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": "k1",
+				"kty": "RSA",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != p.code {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": p.idToken})
+	})
+	p.Server = httptest.NewServer(mux)
+	return p
+}
+
+func (p *fakeProvider) sign(t *testing.T, claims jwt.MapClaims) string {
+	if _, ok := claims["iss"]; !ok {
+		claims["iss"] = p.URL
+	}
+	if _, ok := claims["exp"]; !ok {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "k1"
+	s, err := token.SignedString(p.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestOIDC_Authenticate(t *testing.T) {
+	p := newFakeProvider(t)
+	defer p.Close()
+	o := &nexmo.OIDC{
+		Issuer:   p.URL,
+		ClientID: "voicebr",
+		Roles: map[string]*nexmo.Scope{
+			"admins":  nil,
+			"ops":     {Actions: []string{nexmo.ActionBroadcast}, Groups: []string{"north"}},
+			"support": {Actions: []string{nexmo.ActionReports}},
+		},
+	}
+
+	tt := []struct {
+		name   string
+		claims jwt.MapClaims
+		ok     bool
+		scope  *nexmo.Scope
+	}{
+		{"admin", jwt.MapClaims{"aud": "voicebr", "email": "a@example.com", "groups": []string{"admins", "ops"}}, true, nil},
+		{"union", jwt.MapClaims{"aud": []string{"voicebr"}, "email": "b@example.com", "groups": []string{"ops", "support"}}, true,
+			&nexmo.Scope{Actions: []string{nexmo.ActionBroadcast, nexmo.ActionReports}}},
+		{"no role", jwt.MapClaims{"aud": "voicebr", "email": "c@example.com", "groups": []string{"sales"}}, false, nil},
+		{"wrong audience", jwt.MapClaims{"aud": "other", "email": "a@example.com", "groups": []string{"admins"}}, false, nil},
+		{"wrong issuer", jwt.MapClaims{"iss": "https://evil.example.com", "aud": "voicebr", "groups": []string{"admins"}}, false, nil},
+		{"expired", jwt.MapClaims{"aud": "voicebr", "exp": time.Now().Add(-time.Minute).Unix(), "groups": []string{"admins"}}, false, nil},
+	}
+	for _, v := range tt {
+		req := httptest.NewRequest("GET", "/admin/recordings", nil)
+		req.Header.Set("Authorization", "Bearer "+p.sign(t, v.claims))
+		principal, err := o.Authenticate(req)
+		if v.ok != (err == nil) {
+			t.Fatalf("%s: unexpected authenticate error: %v", v.name, err)
+		}
+		if !v.ok {
+			continue
+		}
+		if principal.Method != nexmo.AuthOIDC || principal.Name != v.claims["email"] {
+			t.Fatalf("%s: unexpected principal %+v", v.name, principal)
+		}
+		if (principal.Scope == nil) != (v.scope == nil) || v.scope != nil && strings.Join(principal.Scope.Actions, ",") != strings.Join(v.scope.Actions, ",") {
+			t.Fatalf("%s: wanted scope %+v, found %+v", v.name, v.scope, principal.Scope)
+		}
+		if v.scope != nil && len(principal.Scope.Groups) != 0 {
+			t.Fatalf("%s: wanted the whole list, found groups %v", v.name, principal.Scope.Groups)
+		}
+	}
+}
+
+func TestOIDC_login(t *testing.T) {
+	p := newFakeProvider(t)
+	defer p.Close()
+	o := &nexmo.OIDC{
+		Issuer:      p.URL,
+		ClientID:    "voicebr",
+		RedirectURL: "https://voicebr.example.com" + nexmo.OIDCCallbackPath,
+		Roles:       map[string]*nexmo.Scope{nexmo.OIDCAnyGroup: nil},
+	}
+	r := nexmo.NewRouter(nil, &storage.Local{RootDir: t.TempDir()}, "https://voicebr.example.com", nexmo.RouterOptions{
+		Dashboard: true,
+		Auth:      nexmo.AnyAuthenticator{o},
+		OIDC:      o,
+	})
+
+	// Browsers are sent to the login page first.
+	req := httptest.NewRequest("GET", "/admin/dashboard/", nil)
+	req.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusFound || !strings.HasPrefix(w.Header().Get("Location"), nexmo.OIDCLoginPath) {
+		t.Fatalf("Wanted a redirect to the login, found %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", nexmo.OIDCLoginPath+"?next=/admin/dashboard/", nil))
+	u, err := url.Parse(w.Header().Get("Location"))
+	if err != nil || !strings.HasPrefix(u.String(), p.URL+"/auth") {
+		t.Fatalf("Wanted a redirect to the provider, found %q", w.Header().Get("Location"))
+	}
+	state := u.Query().Get("state")
+
+	p.code = "c0de"
+	p.idToken = p.sign(t, jwt.MapClaims{"aud": "voicebr", "sub": "42", "nonce": state})
+	req = httptest.NewRequest("GET", nexmo.OIDCCallbackPath+"?"+url.Values{"code": {"c0de"}, "state": {state}}.Encode(), nil)
+	for _, c := range w.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/admin/dashboard/" {
+		t.Fatalf("Wanted a redirect to the dashboard, found %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	req = httptest.NewRequest("GET", "/admin/dashboard/", nil)
+	for _, c := range w.Result().Cookies() {
+		if c.MaxAge >= 0 {
+			req.AddCookie(c)
+		}
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Wanted the dashboard, found %d", w.Code)
+	}
+}
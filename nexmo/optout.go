@@ -0,0 +1,186 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jecoz/voicebr/phone"
+)
+
+// optOutDigit is the key the recipients press to opt out.
+const optOutDigit = "9"
+
+// Suppression is a number that is not called anymore.
+type Suppression struct {
+	Number string `json:"number"`
+	// Reason is either SuppressedOptOut or SuppressedAdmin.
+	Reason string `json:"reason"`
+	// BroadcastID is the broadcast the recipient opted
+	// out from, if any.
+	BroadcastID int64     `json:"broadcast_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+const (
+	SuppressedOptOut = "opt-out"
+	SuppressedAdmin  = "admin"
+)
+
+// SuppressionList is implemented by the storage backends that
+// persist the numbers the broadcasts skip.
+type SuppressionList interface {
+	// Suppress adds `s` to the list, replacing the entry
+	// of the same number.
+	Suppress(ctx context.Context, s Suppression) error
+	// Unsuppress removes `number` from the list. Returns
+	// ErrContactNotFound if it is not there.
+	Unsuppress(ctx context.Context, number string) error
+	Suppressions(ctx context.Context) ([]Suppression, error)
+}
+
+// suppress returns the contacts that are not in `l`, and the
+// ones that are, separately.
+func suppress(ctx context.Context, l SuppressionList, contacts []Contact) ([]Contact, []Contact, error) {
+	list, err := l.Suppressions(ctx)
+	if err != nil {
+		return contacts, nil, err
+	}
+	if len(list) == 0 {
+		return contacts, nil, nil
+	}
+	numbers := make(map[string]bool, len(list))
+	for _, v := range list {
+		numbers[v.Number] = true
+	}
+	var allowed, suppressed []Contact
+	for _, v := range contacts {
+		if numbers[v.Number] {
+			suppressed = append(suppressed, v)
+		} else {
+			allowed = append(allowed, v)
+		}
+	}
+	return allowed, suppressed, nil
+}
+
+// optOut adds the recipient of the call of `params` to the
+// suppression list of `s`, returning false if `s` is not one.
+func optOut(ctx context.Context, s Storage, c *Client, params CallParams, opts RouterOptions) (bool, error) {
+	l, ok := s.(SuppressionList)
+	if !ok {
+		return false, nil
+	}
+	err := l.Suppress(ctx, Suppression{
+		Number:      params.Number,
+		Reason:      SuppressedOptOut,
+		BroadcastID: params.BroadcastID,
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		return false, fmt.Errorf("unable to suppress %s: %v", params.Number, err)
+	}
+	opts.logger().Printf("opt out: %s opted out from broadcast %d", params.Number, params.BroadcastID)
+	if c != nil {
+		c.audit(ctx, AuditOptOut, map[string]string{
+			"broadcast_id": strconv.FormatInt(params.BroadcastID, 10),
+			"number":       params.Number,
+		})
+	}
+	return true, nil
+}
+
+func makeSuppressionsHandler(l SuppressionList, lg *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := l.Suppressions(r.Context())
+		switch {
+		case err == ErrNoHistory:
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		case err != nil:
+			logger(lg).Printf("suppressions handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"suppressions": list,
+		})
+	}
+}
+
+// makeSuppressHandler adds the number in the path to the
+// suppression list, on behalf of an administrator.
+func makeSuppressHandler(l SuppressionList, lg *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		number, err := phone.Normalize(mux.Vars(r)["number"], CountryCode)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = l.Suppress(r.Context(), Suppression{
+			Number:    number,
+			Reason:    SuppressedAdmin,
+			CreatedAt: time.Now(),
+		})
+		switch {
+		case err == ErrNoHistory:
+			w.WriteHeader(http.StatusNotImplemented)
+		case err != nil:
+			logger(lg).Printf("suppress handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+func makeUnsuppressHandler(l SuppressionList, lg *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := l.Unsuppress(r.Context(), mux.Vars(r)["number"])
+		switch {
+		case err == ErrContactNotFound:
+			w.WriteHeader(http.StatusNotFound)
+		case err == ErrNoHistory:
+			w.WriteHeader(http.StatusNotImplemented)
+		case err != nil:
+			logger(lg).Printf("unsuppress handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+// auditSuppressed records that `suppressed` were not called
+// by broadcast `id`.
+func (c *Client) auditSuppressed(ctx context.Context, id int64, suppressed []Contact) {
+	for _, v := range suppressed {
+		c.logger().Printf("call: skipping %s, who opted out", v.Number)
+		c.audit(ctx, AuditCallSuppressed, map[string]string{
+			"broadcast_id": strconv.FormatInt(id, 10),
+			"number":       v.Number,
+		})
+	}
+}
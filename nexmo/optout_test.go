@@ -0,0 +1,72 @@
+package nexmo_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/nexmo/nexmotest"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestOptOut(t *testing.T) {
+	srv, c := newTestClient(t)
+	s := &storage.Local{RootDir: t.TempDir()}
+	r := nexmo.NewRouter(c, s, c.Origin, nexmo.RouterOptions{OptOut: true})
+
+	anna := nexmo.NewContact("393331111111", "Anna")
+	anna.Lang = "en"
+	contacts := []nexmo.Contact{anna, nexmo.NewContact("393332222222", "Luca")}
+	if report := c.CallContacts(context.TODO(), s, "a.mp3", contacts); report.Succeeded != 2 {
+		t.Fatalf("Unexpected failures: %+v", report.Results)
+	}
+	var call nexmotest.Call
+	for _, v := range srv.Calls() {
+		if v.To[0].Number == "393331111111" {
+			call = v
+		}
+	}
+
+	u, _ := url.Parse(call.AnswerURL[0])
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", u.RequestURI(), nil))
+	var ncco []map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&ncco); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if len(ncco) != 4 || ncco[3]["action"] != "input" || ncco[1]["bargeIn"] != true {
+		t.Fatalf("Wanted the message to be followed by an input, found %v", ncco)
+	}
+
+	u, _ = url.Parse(ncco[3]["eventUrl"].([]interface{})[0].(string))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, nexmotest.InputWebhook(u.RequestURI(), call.ConversationUUID, "9"))
+	if err := json.NewDecoder(w.Body).Decode(&ncco); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if want := "You will not receive these messages anymore."; len(ncco) != 1 || ncco[0]["text"] != want {
+		t.Fatalf("Wanted %q, found %v", want, ncco)
+	}
+	list, err := s.Suppressions(context.TODO())
+	if err != nil {
+		t.Fatalf("Unexpected suppressions error: %v", err)
+	}
+	if len(list) != 1 || list[0].Number != "393331111111" || list[0].Reason != nexmo.SuppressedOptOut {
+		t.Fatalf("Wanted Anna to be suppressed, found %+v", list)
+	}
+
+	report := c.CallContacts(context.TODO(), s, "b.mp3", contacts)
+	if report.Succeeded != 1 || len(srv.Calls()) != 3 || srv.Calls()[2].To[0].Number != "393332222222" {
+		t.Fatalf("Wanted only Luca to be called, found %+v", report.Results)
+	}
+
+	if err = s.Unsuppress(context.TODO(), "393331111111"); err != nil {
+		t.Fatalf("Unexpected unsuppress error: %v", err)
+	}
+	if err = s.Unsuppress(context.TODO(), "393331111111"); err != nexmo.ErrContactNotFound {
+		t.Fatalf("Wanted %v, found %v", nexmo.ErrContactNotFound, err)
+	}
+}
@@ -0,0 +1,127 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// OriginResolver derives the origin the webhooks answer with, i.e.
+// the protocol and authority the actions of their NCCOs point to,
+// from the requests, so that a deployment reachable under more
+// than one hostname keeps each call on the hostname nexmo reached
+// it at. Hosts that are not allowed fall back to the canonical
+// origin, so that a forged header cannot redirect the calls.
+type OriginResolver struct {
+	// TrustProxy takes the protocol and the host from the
+	// X-Forwarded-Proto and X-Forwarded-Host headers set by a
+	// reverse proxy, instead of the request itself.
+	TrustProxy bool
+
+	hosts []string
+}
+
+// NewOriginResolver returns a resolver allowing `hosts`, each either
+// a hostname, with an optional port, or a "*." wildcard matching
+// any of the subdomains of a domain, e.g. "*.example.com".
+func NewOriginResolver(hosts []string) (*OriginResolver, error) {
+	o := &OriginResolver{}
+	for _, v := range hosts {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v == "" || strings.ContainsAny(v, "/?#@ ") || strings.Contains(v[1:], "*") {
+			return nil, fmt.Errorf("origin resolver: %q is not a valid host", v)
+		}
+		o.hosts = append(o.hosts, v)
+	}
+	return o, nil
+}
+
+// Resolve returns the origin `r` was sent to, or `fallback` if its
+// host is not allowed.
+func (o *OriginResolver) Resolve(r *http.Request, fallback string) string {
+	proto, host := "http", r.Host
+	if r.TLS != nil {
+		proto = "https"
+	}
+	if o.TrustProxy {
+		if v := forwarded(r, "X-Forwarded-Proto"); v != "" {
+			proto = strings.ToLower(v)
+		}
+		if v := forwarded(r, "X-Forwarded-Host"); v != "" {
+			host = v
+		}
+	}
+	if proto != "http" && proto != "https" || !o.allowed(host) {
+		return fallback
+	}
+	return proto + "://" + strings.ToLower(host)
+}
+
+// forwarded returns the first value of the header `key`, which
+// proxies chain separating them with commas.
+func forwarded(r *http.Request, key string) string {
+	v := r.Header.Get(key)
+	if i := strings.IndexByte(v, ','); i >= 0 {
+		v = v[:i]
+	}
+	return strings.TrimSpace(v)
+}
+
+func (o *OriginResolver) allowed(host string) bool {
+	host = strings.ToLower(host)
+	for _, v := range o.hosts {
+		if v == host {
+			return true
+		}
+		if strings.HasPrefix(v, "*.") {
+			// The wildcard does not match the port, if any.
+			name := host
+			if i := strings.LastIndexByte(name, ':'); i >= 0 && !strings.HasSuffix(name, "]") {
+				name = name[:i]
+			}
+			if strings.HasSuffix(name, v[1:]) && len(name) > len(v)-1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Middleware resolves the origin of the requests, which the
+// handlers read with originOf, falling back to `origin`.
+func (o *OriginResolver) Middleware(origin string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), originKey{}, o.Resolve(r, origin))
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+type originKey struct{}
+
+// originOf returns the origin resolved for the request of `ctx`,
+// or `origin` if there is none.
+func originOf(ctx context.Context, origin string) string {
+	if v, ok := ctx.Value(originKey{}).(string); ok {
+		return v
+	}
+	return origin
+}
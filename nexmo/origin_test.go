@@ -0,0 +1,89 @@
+package nexmo_test
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/nexmo/nexmotest"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestOriginResolver(t *testing.T) {
+	o, err := nexmo.NewOriginResolver([]string{"voicebr.example.com", "*.voicebr.example.org", "localhost:4001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.TrustProxy = true
+	fallback := "https://voicebr.example.com"
+
+	tt := []struct {
+		name  string
+		host  string
+		proto string
+		fwd   string
+		want  string
+	}{
+		{"host", "localhost:4001", "", "", "http://localhost:4001"},
+		{"forwarded", "10.0.0.1:4001", "https", "eu.voicebr.example.org", "https://eu.voicebr.example.org"},
+		{"forwarded chain", "10.0.0.1:4001", "https, http", "eu.voicebr.example.org, proxy", "https://eu.voicebr.example.org"},
+		{"wildcard port", "10.0.0.1:4001", "https", "eu.voicebr.example.org:8443", "https://eu.voicebr.example.org:8443"},
+		{"not allowed", "10.0.0.1:4001", "https", "evil.example.com", fallback},
+		{"wildcard apex", "10.0.0.1:4001", "https", "voicebr.example.org", fallback},
+		{"bad proto", "10.0.0.1:4001", "ftp", "voicebr.example.com", fallback},
+	}
+	for _, v := range tt {
+		req := httptest.NewRequest("POST", "/record/voice/answer", nil)
+		req.Host = v.host
+		if v.proto != "" {
+			req.Header.Set("X-Forwarded-Proto", v.proto)
+		}
+		if v.fwd != "" {
+			req.Header.Set("X-Forwarded-Host", v.fwd)
+		}
+		if got := o.Resolve(req, fallback); got != v.want {
+			t.Fatalf("%s: wanted %s, found %s", v.name, v.want, got)
+		}
+	}
+
+	// The headers are ignored without a proxy.
+	o.TrustProxy = false
+	req := httptest.NewRequest("POST", "/record/voice/answer", nil)
+	req.Host = "evil.example.com"
+	req.Header.Set("X-Forwarded-Host", "voicebr.example.com")
+	if got := o.Resolve(req, fallback); got != fallback {
+		t.Fatalf("Wanted %s, found %s", fallback, got)
+	}
+
+	if _, err = nexmo.NewOriginResolver([]string{"https://voicebr.example.com"}); err == nil {
+		t.Fatalf("Wanted an URL to be refused as host")
+	}
+}
+
+func TestRouter_origins(t *testing.T) {
+	_, c := newTestClient(t)
+	dir := t.TempDir()
+	ioutil.WriteFile(dir+"/whitelist.csv", []byte("393330000000,Marco\n"), 0644)
+	o, err := nexmo.NewOriginResolver([]string{"*.voicebr.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.TrustProxy = true
+	r := nexmo.NewRouter(c, &storage.Local{RootDir: dir}, c.Origin, nexmo.RouterOptions{Origins: o})
+
+	for host, want := range map[string]string{
+		"eu.voicebr.example.com": "https://eu.voicebr.example.com/store/recording/event",
+		"evil.example.com":       c.Origin + "/store/recording/event",
+	} {
+		req := nexmotest.AnswerWebhook("393330000000", "CON-1")
+		req.Header.Set("X-Forwarded-Proto", "https")
+		req.Header.Set("X-Forwarded-Host", host)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if !strings.Contains(w.Body.String(), want) {
+			t.Fatalf("%s: wanted the NCCO to point to %s, found %s", host, want, w.Body.String())
+		}
+	}
+}
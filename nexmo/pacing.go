@@ -0,0 +1,236 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RecipientPacer serializes the calls to each number, so that
+// the recipients of broadcasts recorded close to each other are
+// not called twice in quick succession. Live and emergency
+// broadcasts are not paced. It is not persisted across restarts.
+type RecipientPacer struct {
+	// Gap is the minimum time between two calls placed to the
+	// same number. It should be longer than a typical call.
+	Gap time.Duration
+	// Merge, if true, places a single call for the broadcasts
+	// waiting for the same number, streaming their recordings
+	// back-to-back.
+	Merge bool
+
+	mu    sync.Mutex
+	lines map[string]*pacedLine
+}
+
+func NewRecipientPacer(gap time.Duration, merge bool) *RecipientPacer {
+	return &RecipientPacer{Gap: gap, Merge: merge}
+}
+
+// pacedLine is the state of the calls to a number.
+type pacedLine struct {
+	// holder is the call allowed to be placed, nil if none.
+	holder  *pacedCall
+	waiting []*pacedCall
+	// last is when the last call was placed.
+	last time.Time
+}
+
+// pacedCall is a call waiting for, or holding, its line.
+type pacedCall struct {
+	b Broadcast
+	// ready is closed when the call holds the line.
+	ready chan struct{}
+	// placing is set once merging into the call is no longer
+	// possible.
+	placing bool
+	// then are the broadcasts merged into the call.
+	then   []Broadcast
+	merged []*pacedFollower
+}
+
+// plays returns true if the call plays recording `name`.
+func (pc *pacedCall) plays(name string) bool {
+	if pc.b.RecName == name {
+		return true
+	}
+	for _, v := range pc.then {
+		if v.RecName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// pacedFollower is a broadcast merged into another's call,
+// waiting for its outcome.
+type pacedFollower struct {
+	done chan struct{}
+	err  error
+	// dropped is set when the leading call gave up waiting
+	// without being placed.
+	dropped bool
+}
+
+// Do calls `call` for broadcast `b` once no other call to `number`
+// is being placed and Gap elapsed since the last one. `call` is
+// passed the broadcasts merged into it, whose recordings should
+// be played after `b`'s. When `b` is merged into another call,
+// `call` is not called and the outcome of that call is returned.
+func (p *RecipientPacer) Do(ctx context.Context, number string, b Broadcast, call func(then []Broadcast) error) error {
+	if p == nil || b.live() || b.emergency() {
+		return call(nil)
+	}
+	for {
+		f, pc := p.enqueue(number, b)
+		if f != nil {
+			select {
+			case <-f.done:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			if f.dropped {
+				continue
+			}
+			return f.err
+		}
+		return p.place(ctx, number, pc, call)
+	}
+}
+
+// enqueue either merges `b` into a call to `number` that is not
+// being placed yet, returning the follower, or queues a new call.
+func (p *RecipientPacer) enqueue(number string, b Broadcast) (*pacedFollower, *pacedCall) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.lines == nil {
+		p.lines = make(map[string]*pacedLine)
+	}
+	l, ok := p.lines[number]
+	if !ok {
+		l = &pacedLine{}
+		p.lines[number] = l
+	}
+	if p.Merge {
+		candidates := l.waiting
+		if l.holder != nil {
+			candidates = append([]*pacedCall{l.holder}, candidates...)
+		}
+		for _, v := range candidates {
+			// The hosted recordings are streamed through
+			// the answer URL of their own broadcast.
+			if v.placing || v.b.live() || v.b.hosted() || b.hosted() {
+				continue
+			}
+			f := &pacedFollower{done: make(chan struct{})}
+			v.merged = append(v.merged, f)
+			if !v.plays(b.RecName) {
+				v.then = append(v.then, b)
+			}
+			return f, nil
+		}
+	}
+	pc := &pacedCall{b: b, ready: make(chan struct{})}
+	if l.holder == nil {
+		l.holder = pc
+		close(pc.ready)
+	} else {
+		l.waiting = append(l.waiting, pc)
+	}
+	return nil, pc
+}
+
+// place waits for `pc` to hold its line and for Gap to elapse,
+// then calls `call`.
+func (p *RecipientPacer) place(ctx context.Context, number string, pc *pacedCall, call func([]Broadcast) error) error {
+	select {
+	case <-pc.ready:
+	case <-ctx.Done():
+		p.release(number, pc, nil, false)
+		return ctx.Err()
+	}
+
+	p.mu.Lock()
+	wait := time.Until(p.lines[number].last.Add(p.Gap))
+	p.mu.Unlock()
+	if wait > 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			p.release(number, pc, nil, false)
+			return ctx.Err()
+		}
+	}
+
+	p.mu.Lock()
+	pc.placing = true
+	then := pc.then
+	p.mu.Unlock()
+
+	err := call(then)
+	p.release(number, pc, err, true)
+	return err
+}
+
+// release hands the line of `pc` to the next waiting call, telling
+// the broadcasts merged into `pc` about the outcome `err` of its
+// call, if `placed`, or to queue again otherwise.
+func (p *RecipientPacer) release(number string, pc *pacedCall, err error, placed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	l := p.lines[number]
+	for _, f := range pc.merged {
+		f.err, f.dropped = err, !placed
+		close(f.done)
+	}
+	pc.merged, pc.placing = nil, true
+	if placed {
+		l.last = time.Now()
+	}
+
+	if l.holder != pc {
+		for i, v := range l.waiting {
+			if v == pc {
+				l.waiting = append(l.waiting[:i], l.waiting[i+1:]...)
+				break
+			}
+		}
+		return
+	}
+	l.holder = nil
+	if len(l.waiting) > 0 {
+		l.holder = l.waiting[0]
+		l.waiting = l.waiting[1:]
+		close(l.holder.ready)
+		return
+	}
+	if time.Since(l.last) >= p.Gap {
+		delete(p.lines, number)
+		return
+	}
+	time.AfterFunc(time.Until(l.last.Add(p.Gap)), func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.lines[number] == l && l.holder == nil && len(l.waiting) == 0 {
+			delete(p.lines, number)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package nexmo_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestRecipientPacer(t *testing.T) {
+	p := nexmo.NewRecipientPacer(300*time.Millisecond, true)
+	var (
+		mu     sync.Mutex
+		placed []time.Time
+		then   [][]nexmo.Broadcast
+	)
+	call := func(b []nexmo.Broadcast) error {
+		mu.Lock()
+		defer mu.Unlock()
+		placed = append(placed, time.Now())
+		then = append(then, b)
+		return nil
+	}
+
+	// The first call holds the line while the others queue.
+	release := make(chan struct{})
+	first := make(chan error)
+	go func() {
+		first <- p.Do(context.TODO(), "393331111111", nexmo.Broadcast{RecName: "a.mp3"}, func(b []nexmo.Broadcast) error {
+			<-release
+			return call(b)
+		})
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for _, v := range []string{"b.mp3", "c.mp3", "b.mp3"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			errs <- p.Do(context.TODO(), "393331111111", nexmo.Broadcast{RecName: name}, call)
+		}(v)
+	}
+	// Other numbers are not paced.
+	if err := p.Do(context.TODO(), "393332222222", nexmo.Broadcast{RecName: "d.mp3"}, func([]nexmo.Broadcast) error { return nil }); err != nil {
+		t.Fatalf("Unexpected do error: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	if err := <-first; err != nil {
+		t.Fatalf("Unexpected do error: %v", err)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Unexpected do error: %v", err)
+		}
+	}
+
+	if len(placed) != 2 {
+		t.Fatalf("Wanted the waiting broadcasts to be merged into a call, found %d calls", len(placed))
+	}
+	if gap := placed[1].Sub(placed[0]); gap < p.Gap {
+		t.Fatalf("Wanted the calls at least %v apart, found %v", p.Gap, gap)
+	}
+	if len(then[0]) != 0 || len(then[1]) != 1 {
+		t.Fatalf("Wanted a single recording to follow the second call's, found %v", then[1])
+	}
+}
+
+func TestPlayRecordingHandler_then(t *testing.T) {
+	r := nexmo.NewRouter(nil, &storage.Local{RootDir: t.TempDir()}, "https://example.com", nexmo.RouterOptions{})
+	params := nexmo.CallParams{Number: "393331111111", Lang: "en", Then: []string{"b.mp3"}}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/play/recording/a.mp3?"+"?"+params.Values().Encode(), nil))
+	var ncco []map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&ncco); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	var streams []interface{}
+	for _, v := range ncco {
+		if v["action"] == "stream" {
+			streams = append(streams, v["streamUrl"].([]interface{})[0])
+		}
+	}
+	if len(streams) != 2 || streams[0] != "https://example.com/static/a.mp3" || streams[1] != "https://example.com/static/b.mp3" {
+		t.Fatalf("Wanted both recordings streamed, found %v", streams)
+	}
+}
@@ -0,0 +1,207 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// RecRangeReader is implemented by the RecStores able to read
+// a part of a recording without reading what precedes it, which
+// makes seeking through the recordings they serve cheap.
+type RecRangeReader interface {
+	// StatRec returns the metadata of the recording `name`,
+	// or ErrRecNotFound.
+	StatRec(ctx context.Context, name string) (RecMeta, error)
+	// OpenRecRange returns a reader over `length` bytes of the
+	// recording `name`, starting at `offset`.
+	OpenRecRange(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error)
+}
+
+// errNoRange is returned by parseRange when the range is
+// not satisfiable.
+var errNoRange = errors.New("range not satisfiable")
+
+// parseRange returns the offset and length of the byte range
+// in `header`, the Range header of a request for `size` bytes.
+// A missing, malformed or multiple range selects all the bytes,
+// which is what the response is allowed to contain anyway.
+func parseRange(header string, size int64) (int64, int64, error) {
+	spec := strings.TrimPrefix(header, "bytes=")
+	if header == "" || spec == header || strings.Contains(spec, ",") {
+		return 0, size, nil
+	}
+	i := strings.Index(spec, "-")
+	if i < 0 {
+		return 0, size, nil
+	}
+	first, last := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+	if first == "" {
+		// The last `last` bytes.
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, size, nil
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, errNoRange
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, nil
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, size, nil
+	}
+	if start >= size {
+		return 0, 0, errNoRange
+	}
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, size, nil
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end - start + 1, nil
+}
+
+// limitedReadCloser closes the reader it limits.
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// openRange returns the part of the recording `name` selected
+// by `header`, seeking through the recording when `s` is not a
+// RecRangeReader.
+func openRange(ctx context.Context, s RecStore, name, header string) (io.ReadCloser, RecMeta, int64, int64, error) {
+	if rr, ok := s.(RecRangeReader); ok {
+		meta, err := rr.StatRec(ctx, name)
+		if err != nil {
+			return nil, meta, 0, 0, err
+		}
+		offset, length, err := parseRange(header, meta.Size)
+		if err != nil {
+			return nil, meta, 0, 0, err
+		}
+		rc, err := rr.OpenRecRange(ctx, name, offset, length)
+		return rc, meta, offset, length, err
+	}
+
+	rc, meta, err := s.OpenRec(ctx, name)
+	if err != nil {
+		return nil, meta, 0, 0, err
+	}
+	offset, length, err := parseRange(header, meta.Size)
+	if err != nil {
+		rc.Close()
+		return nil, meta, 0, 0, err
+	}
+	if _, err = io.CopyN(ioutil.Discard, rc, offset); err != nil {
+		rc.Close()
+		return nil, meta, 0, 0, fmt.Errorf("unable to seek to %d: %v", offset, err)
+	}
+	return limitedReadCloser{io.LimitReader(rc, length), rc}, meta, offset, length, nil
+}
+
+// ServeRec writes the recording `name` of `s` to `w`, honouring
+// a single byte range in the Range header of `r`, so that the
+// players can seek through it. Ranges are ignored when If-Range
+// does not match the recording's modification time.
+func ServeRec(w http.ResponseWriter, r *http.Request, s RecStore, name string, lg *log.Logger) {
+	header := r.Header.Get("Range")
+	if v := r.Header.Get("If-Range"); v != "" && header != "" {
+		if rr, ok := s.(RecRangeReader); ok {
+			meta, err := rr.StatRec(r.Context(), name)
+			if err == nil && v != meta.CreatedAt.UTC().Format(http.TimeFormat) {
+				header = ""
+			}
+		} else {
+			header = ""
+		}
+	}
+
+	rc, meta, offset, length, err := openRange(r.Context(), s, name, header)
+	switch {
+	case err == ErrRecNotFound:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case err == errNoRange:
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", meta.Size))
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return
+	case err != nil:
+		logger(lg).Printf("serve rec: %s: %v", name, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer rc.Close()
+
+	contentType := meta.ContentType
+	if contentType == "" {
+		contentType = ContentType(name)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Accept-Ranges", "bytes")
+	if !meta.CreatedAt.IsZero() {
+		w.Header().Set("Last-Modified", meta.CreatedAt.UTC().Format(http.TimeFormat))
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	status := http.StatusOK
+	if length != meta.Size {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, meta.Size))
+		status = http.StatusPartialContent
+	}
+	w.WriteHeader(status)
+	if r.Method == "HEAD" {
+		return
+	}
+	if _, err := io.Copy(w, rc); err != nil {
+		logger(lg).Printf("serve rec: %s: %v", name, err)
+	}
+}
+
+// RecHandler serves the recordings of `s` with ServeRec. The path
+// of the requests is the recording name, as with RecFileHandler.
+func RecHandler(s RecStore, lg *log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			w.Header().Set("Allow", "GET, HEAD")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		name := path.Base(r.URL.Path)
+		if name == "/" || name == "." {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		ServeRec(w, r, s, name, lg)
+	})
+}
@@ -0,0 +1,114 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	// VoicemailLeave plays the message to answering machines too.
+	VoicemailLeave = "leave"
+	// VoicemailHangup hangs up as soon as an answering
+	// machine is detected.
+	VoicemailHangup = "hangup"
+)
+
+// DeliveryPolicy describes how hard voicebr should try to
+// deliver a message to a contact. Zero fields are considered
+// unset, and are filled in by Merge.
+type DeliveryPolicy struct {
+	MaxAttempts  int
+	RetrySpacing time.Duration
+	Voicemail    string
+}
+
+// DefaultDeliveryPolicy is used when neither the contact
+// nor the list provide a value.
+var DefaultDeliveryPolicy = DeliveryPolicy{
+	MaxAttempts:  1,
+	RetrySpacing: time.Minute,
+	Voicemail:    VoicemailLeave,
+}
+
+// Merge returns a copy of `p` where unset fields are
+// taken from `defaults`.
+func (p DeliveryPolicy) Merge(defaults DeliveryPolicy) DeliveryPolicy {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = defaults.MaxAttempts
+	}
+	if p.RetrySpacing == 0 {
+		p.RetrySpacing = defaults.RetrySpacing
+	}
+	if p.Voicemail == "" {
+		p.Voicemail = defaults.Voicemail
+	}
+	return p
+}
+
+// machineDetection maps the voicemail behaviour to the value
+// expected by nexmo's `machine_detection` call parameter.
+func (p DeliveryPolicy) machineDetection() string {
+	switch p.Voicemail {
+	case VoicemailHangup:
+		return "hangup"
+	case VoicemailLeave:
+		return "continue"
+	default:
+		return ""
+	}
+}
+
+// parsePolicy decodes the optional policy columns of a contacts
+// record: max attempts, retry spacing and voicemail behaviour.
+// Empty columns are left unset.
+func parsePolicy(cols []string) (DeliveryPolicy, error) {
+	var p DeliveryPolicy
+	var err error
+	if len(cols) > 0 && cols[0] != "" {
+		if p.MaxAttempts, err = strconv.Atoi(cols[0]); err != nil || p.MaxAttempts < 0 {
+			return p, fmt.Errorf("invalid max attempts %q", cols[0])
+		}
+	}
+	if len(cols) > 1 && cols[1] != "" {
+		if p.RetrySpacing, err = time.ParseDuration(cols[1]); err != nil {
+			return p, fmt.Errorf("invalid retry spacing %q", cols[1])
+		}
+	}
+	if len(cols) > 2 && cols[2] != "" {
+		switch cols[2] {
+		case VoicemailLeave, VoicemailHangup:
+			p.Voicemail = cols[2]
+		default:
+			return p, fmt.Errorf("invalid voicemail behaviour %q", cols[2])
+		}
+	}
+	return p, nil
+}
+
+func formatPolicy(p DeliveryPolicy) []string {
+	cols := []string{"", "", p.Voicemail}
+	if p.MaxAttempts != 0 {
+		cols[0] = strconv.Itoa(p.MaxAttempts)
+	}
+	if p.RetrySpacing != 0 {
+		cols[1] = p.RetrySpacing.String()
+	}
+	return cols
+}
@@ -0,0 +1,90 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Priorities of the broadcasts. An empty priority is routine.
+const (
+	PriorityRoutine   = "routine"
+	PriorityEmergency = "emergency"
+)
+
+// ValidatePriority returns an error if `p` is not one of the
+// priorities, or empty.
+func ValidatePriority(p string) error {
+	switch p {
+	case "", PriorityRoutine, PriorityEmergency:
+		return nil
+	default:
+		return fmt.Errorf("unknown priority %q, either %q or %q", p, PriorityRoutine, PriorityEmergency)
+	}
+}
+
+// DefaultEmergencyPolicy fills the unset fields of the
+// EmergencyOptions' policy.
+var DefaultEmergencyPolicy = DeliveryPolicy{
+	MaxAttempts:  3,
+	RetrySpacing: 15 * time.Second,
+}
+
+// EmergencyOptions configures the delivery of the broadcasts
+// with PriorityEmergency. Their calls always go first: the
+// routine calls wait on the CallLimiter while emergency ones
+// are waiting too.
+type EmergencyOptions struct {
+	// Policy raises the delivery policy of the recipients:
+	// they are called at least Policy.MaxAttempts times, at
+	// most Policy.RetrySpacing apart.
+	Policy DeliveryPolicy
+	// SMS, if not empty, is texted to each recipient while
+	// the first call is placed.
+	SMS string
+}
+
+// escalate returns `p` raised to the emergency policy.
+func (o EmergencyOptions) escalate(p DeliveryPolicy) DeliveryPolicy {
+	e := o.Policy.Merge(DefaultEmergencyPolicy)
+	if p.MaxAttempts < e.MaxAttempts {
+		p.MaxAttempts = e.MaxAttempts
+	}
+	if p.RetrySpacing > e.RetrySpacing {
+		p.RetrySpacing = e.RetrySpacing
+	}
+	return p
+}
+
+func (b Broadcast) emergency() bool {
+	return b.Priority == PriorityEmergency
+}
+
+type urgentKey struct{}
+
+// withUrgency marks the requests made with the returned context
+// as urgent, see Limiter.Wait.
+func withUrgency(ctx context.Context) context.Context {
+	return context.WithValue(ctx, urgentKey{}, true)
+}
+
+func isUrgent(ctx context.Context) bool {
+	v, _ := ctx.Value(urgentKey{}).(bool)
+	return v
+}
@@ -0,0 +1,73 @@
+package nexmo_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestEmergency(t *testing.T) {
+	srv, c := newTestClient(t)
+	c.Workers = 1
+	c.Emergency = nexmo.EmergencyOptions{
+		Policy: nexmo.DeliveryPolicy{MaxAttempts: 2, RetrySpacing: 10 * time.Millisecond},
+		SMS:    "Evacuate the building.",
+	}
+	var mu sync.Mutex
+	failed := false
+	srv.Fail = func(to string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		if to == "393330000001" && !failed {
+			failed = true
+			return http.StatusBadRequest
+		}
+		return 0
+	}
+	s := &storage.Local{RootDir: t.TempDir()}
+
+	var routine []nexmo.Contact
+	for i := 0; i < 6; i++ {
+		routine = append(routine, nexmo.NewContact(fmt.Sprintf("39333111111%d", i), ""))
+	}
+	done := make(chan *nexmo.BroadcastReport)
+	go func() {
+		done <- c.CallContacts(context.TODO(), s, "routine.mp3", routine)
+	}()
+	srv.WaitCalls(1, waitTimeout)
+
+	emergency := []nexmo.Contact{nexmo.NewContact("393330000001", ""), nexmo.NewContact("393330000002", "")}
+	report, err := c.CallBroadcast(context.TODO(), s, nexmo.Broadcast{RecName: "fire.mp3", Priority: nexmo.PriorityEmergency}, emergency)
+	if err != nil {
+		t.Fatalf("Unexpected call error: %v", err)
+	}
+	if report.Succeeded != 2 || report.Results[0].Attempts != 2 {
+		t.Fatalf("Wanted the failed call to be retried, found %+v", report.Results)
+	}
+	calls := srv.Calls()
+	routineCalls := 0
+	for _, v := range calls {
+		if v.To[0].Number[:9] == "393330000" {
+			break
+		}
+		routineCalls++
+	}
+	if routineCalls > 2 {
+		t.Fatalf("Wanted the emergency calls to go first, found them after %d routine calls", routineCalls)
+	}
+	if m := srv.WaitMessages(2, waitTimeout); len(m) != 2 || m[0].Text != "Evacuate the building." {
+		t.Fatalf("Wanted the recipients to be texted, found %+v", m)
+	}
+	if r := <-done; r.Succeeded != 6 {
+		t.Fatalf("Wanted the routine broadcast to complete, found %+v", r.Results)
+	}
+	if _, err = c.CallBroadcast(context.TODO(), s, nexmo.Broadcast{RecName: "fire.mp3", Priority: "high"}, emergency); err == nil {
+		t.Fatalf("Wanted an unknown priority to be refused")
+	}
+}
@@ -0,0 +1,315 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+)
+
+// DefaultLang is the language used for contacts
+// that do not specify one.
+const DefaultLang = "it"
+
+// DefaultLevel is the volume of the spoken prompts.
+const DefaultLevel = 0.5
+
+// Prompts are the sentences spoken by voicebr in
+// a specific language, and the voice speaking them.
+// Sentences are text/template templates executed
+// with PromptData.
+type Prompts struct {
+	Voice string
+	Level float64
+	// Greeting is spoken to the broadcaster before recording.
+	Greeting string
+	// Confirm is spoken to the broadcaster after recording,
+	// when RecordOptions.Confirm is set.
+	Confirm string
+	// TooLong replaces Confirm when the message exceeds
+	// RecordOptions.MaxLength, offering to record it again
+	// by pressing 1. Its Length is the maximum length.
+	TooLong string
+	// Menu replaces Greeting when RouterOptions.Conference is
+	// set, asking the broadcaster to press 1 to record a
+	// message or 2 to speak live.
+	Menu string
+	// Live is spoken to the broadcaster before joining the
+	// conference, Listen to the recipients.
+	Live   string
+	Listen string
+	// Recorded and End surround the broadcasted message.
+	Recorded string
+	End      string
+	// OptOut follows the message when RouterOptions.OptOut is
+	// set, asking the recipients to press 9 to stop receiving
+	// the broadcasts. OptedOut confirms they will not.
+	OptOut   string
+	OptedOut string
+	// Replay follows the message when RouterOptions.Replays is
+	// set, offering to press 1 to listen to it again.
+	Replay string
+	// Templates follows Menu when RouterOptions.Templates is
+	// set, offering to press 3 to broadcast a template, whose
+	// code TemplateCode asks for. TemplateSent confirms the
+	// broadcast, its RecName being the template name, while
+	// TemplateUnknown reports a code matching no template.
+	Templates       string
+	TemplateCode    string
+	TemplateSent    string
+	TemplateUnknown string
+	// IVRMenu replaces Greeting and Menu when RouterOptions.IVR
+	// is set. IVRGroup asks the number of the group to broadcast
+	// to, and IVRGroupSet confirms it, its Group being empty for
+	// the whole broadcast list. IVRCanceled confirms that the
+	// last broadcast has been canceled, and IVRNone reports that
+	// the broadcaster has none to play back or to cancel.
+	IVRMenu     string
+	IVRGroup    string
+	IVRGroupSet string
+	IVRCanceled string
+	IVRNone     string
+
+	lang   string
+	speech *Speech
+}
+
+// PromptData is the data available to the prompt templates.
+// The caller is the broadcaster, and is only known while
+// recording; the recipient and the broadcast are only known
+// while playing the recording.
+type PromptData struct {
+	CallerName      string
+	CallerNumber    string
+	Lang            string
+	RecName         string
+	BroadcastID     int64
+	RecipientNumber string
+	// When is the time the message was recorded.
+	When SpokenTime
+	// Length is the length of the recording, only known
+	// when confirming it to the caller.
+	Length SpokenDuration
+	// Group is the group chosen by the caller through the
+	// IVR, if any.
+	Group string
+}
+
+// Render executes the template `text` with `data`. On failure,
+// `text` is returned as is, so that something is spoken anyway.
+func (p Prompts) Render(text string, data PromptData) string {
+	t, err := template.New("prompt").Parse(text)
+	if err != nil {
+		log.Printf("prompts: %v", err)
+		return text
+	}
+	var buf bytes.Buffer
+	if err = t.Execute(&buf, data); err != nil {
+		log.Printf("prompts: %v", err)
+		return text
+	}
+	return buf.String()
+}
+
+// TalkAction returns a `talk` NCCO action speaking the
+// rendered `text` with the prompts' voice and level. When the
+// prompts come from a PromptBook with Speech, a `stream` action
+// playing the synthesized text is returned instead.
+func (p Prompts) TalkAction(text string, data PromptData) map[string]interface{} {
+	text = p.Render(text, data)
+	if p.speech != nil {
+		if a, ok := p.speech.streamAction(text, p.lang, p.Level); ok {
+			return a
+		}
+	}
+	return map[string]interface{}{
+		"action":    "talk",
+		"voiceName": p.Voice,
+		"level":     p.Level,
+		"text":      text,
+	}
+}
+
+// texts returns the templates of the prompts.
+func (p Prompts) texts() []string {
+	return []string{p.Greeting, p.Confirm, p.TooLong, p.Menu, p.Live, p.Listen, p.Recorded, p.End, p.OptOut, p.OptedOut, p.Replay, p.Templates, p.TemplateCode, p.TemplateSent, p.TemplateUnknown, p.IVRMenu, p.IVRGroup, p.IVRGroupSet, p.IVRCanceled, p.IVRNone}
+}
+
+func (p Prompts) validate() error {
+	for _, v := range p.texts() {
+		t, err := template.New("prompt").Parse(v)
+		if err != nil {
+			return err
+		}
+		if err = t.Execute(&bytes.Buffer{}, PromptData{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var builtinPrompts = map[string]Prompts{
+	"it": {Voice: "Carla", Greeting: "Parla pure {{.CallerName}}", Confirm: "Il tuo messaggio dura {{.Length}}", TooLong: "Il messaggio non verrà inviato perché supera la durata massima di {{.Length}}. Premi 1 per registrarlo di nuovo.", Menu: "Premi 1 per registrare un messaggio, o 2 per parlare in diretta a tutti.", Live: "Sei in diretta, i destinatari si collegano man mano che rispondono.", Listen: "Annuncio in diretta", Recorded: "Messaggio registrato", End: "Fine messaggio", OptOut: "Premi 9 per non ricevere più questi messaggi.", OptedOut: "Non riceverai più questi messaggi.", Replay: "Premi 1 per riascoltare il messaggio.", Templates: "Premi 3 per inviare un messaggio salvato.", TemplateCode: "Digita il codice del messaggio salvato, seguito dal tasto cancelletto.", TemplateSent: "Invio del messaggio {{.RecName}} in corso", TemplateUnknown: "Nessun messaggio salvato ha questo codice.", IVRMenu: "Premi 1 per registrare un nuovo messaggio, 2 per ascoltare l'ultimo, 3 per scegliere i destinatari, o 4 per annullare l'ultimo invio.", IVRGroup: "Digita il numero del gruppo, seguito dal tasto cancelletto, o 0 per tutti.", IVRGroupSet: "Destinatari: {{if .Group}}gruppo {{.Group}}{{else}}tutti{{end}}", IVRCanceled: "L'ultimo invio è stato annullato.", IVRNone: "Non hai inviato messaggi di recente."},
+	"en": {Voice: "Kimberly", Greeting: "Go ahead {{.CallerName}}", Confirm: "Your message is {{.Length}} long", TooLong: "Your message will not be sent, as it is longer than {{.Length}}. Press 1 to record it again.", Menu: "Press 1 to record a message, or 2 to speak live to everyone.", Live: "You are live, recipients join as they answer.", Listen: "Live announcement", Recorded: "Recorded message", End: "End of message", OptOut: "Press 9 to stop receiving these messages.", OptedOut: "You will not receive these messages anymore.", Replay: "Press 1 to listen to the message again.", Templates: "Press 3 to broadcast a saved message.", TemplateCode: "Type the code of the saved message, followed by the hash key.", TemplateSent: "Broadcasting {{.RecName}}", TemplateUnknown: "No saved message has this code.", IVRMenu: "Press 1 to record a new message, 2 to listen to your last one, 3 to choose the recipients, or 4 to cancel your last broadcast.", IVRGroup: "Type the number of the group, followed by the hash key, or 0 for everyone.", IVRGroupSet: "Recipients: {{if .Group}}group {{.Group}}{{else}}everyone{{end}}", IVRCanceled: "Your last broadcast has been canceled.", IVRNone: "You have not broadcast any message recently."},
+	"de": {Voice: "Marlene", Greeting: "Bitte sprechen {{.CallerName}}", Confirm: "Ihre Nachricht ist {{.Length}} lang", TooLong: "Ihre Nachricht wird nicht gesendet, da sie länger als {{.Length}} ist. Drücken Sie 1, um sie erneut aufzunehmen.", Menu: "Drücken Sie 1, um eine Nachricht aufzunehmen, oder 2, um live zu allen zu sprechen.", Live: "Sie sind live, die Empfänger kommen hinzu, sobald sie antworten.", Listen: "Live-Durchsage", Recorded: "Aufgezeichnete Nachricht", End: "Ende der Nachricht", OptOut: "Drücken Sie 9, um diese Nachrichten nicht mehr zu erhalten.", OptedOut: "Sie erhalten diese Nachrichten nicht mehr.", Replay: "Drücken Sie 1, um die Nachricht erneut anzuhören.", Templates: "Drücken Sie 3, um eine gespeicherte Nachricht zu senden.", TemplateCode: "Geben Sie den Code der gespeicherten Nachricht ein, gefolgt von der Rautetaste.", TemplateSent: "{{.RecName}} wird gesendet", TemplateUnknown: "Keine gespeicherte Nachricht hat diesen Code.", IVRMenu: "Drücken Sie 1, um eine neue Nachricht aufzunehmen, 2, um Ihre letzte anzuhören, 3, um die Empfänger zu wählen, oder 4, um Ihre letzte Sendung abzubrechen.", IVRGroup: "Geben Sie die Nummer der Gruppe ein, gefolgt von der Rautetaste, oder 0 für alle.", IVRGroupSet: "Empfänger: {{if .Group}}Gruppe {{.Group}}{{else}}alle{{end}}", IVRCanceled: "Ihre letzte Sendung wurde abgebrochen.", IVRNone: "Sie haben in letzter Zeit keine Nachricht gesendet."},
+	"fr": {Voice: "Celine", Greeting: "Allez-y {{.CallerName}}", Confirm: "Votre message dure {{.Length}}", TooLong: "Votre message ne sera pas envoyé car il dépasse {{.Length}}. Appuyez sur 1 pour l'enregistrer à nouveau.", Menu: "Appuyez sur 1 pour enregistrer un message, ou sur 2 pour parler en direct à tous.", Live: "Vous êtes en direct, les destinataires rejoignent l'appel dès qu'ils répondent.", Listen: "Annonce en direct", Recorded: "Message enregistré", End: "Fin du message", OptOut: "Appuyez sur 9 pour ne plus recevoir ces messages.", OptedOut: "Vous ne recevrez plus ces messages.", Replay: "Appuyez sur 1 pour réécouter le message.", Templates: "Appuyez sur 3 pour diffuser un message enregistré à l'avance.", TemplateCode: "Tapez le code du message, suivi de la touche dièse.", TemplateSent: "Diffusion de {{.RecName}} en cours", TemplateUnknown: "Aucun message ne correspond à ce code.", IVRMenu: "Appuyez sur 1 pour enregistrer un nouveau message, 2 pour écouter le dernier, 3 pour choisir les destinataires, ou 4 pour annuler votre dernière diffusion.", IVRGroup: "Tapez le numéro du groupe, suivi de la touche dièse, ou 0 pour tous.", IVRGroupSet: "Destinataires : {{if .Group}}groupe {{.Group}}{{else}}tous{{end}}", IVRCanceled: "Votre dernière diffusion a été annulée.", IVRNone: "Vous n'avez diffusé aucun message récemment."},
+	"es": {Voice: "Conchita", Greeting: "Adelante {{.CallerName}}", Confirm: "Su mensaje dura {{.Length}}", TooLong: "Su mensaje no se enviará porque dura más de {{.Length}}. Pulse 1 para grabarlo de nuevo.", Menu: "Pulse 1 para grabar un mensaje, o 2 para hablar en directo con todos.", Live: "Está en directo, los destinatarios se unen a medida que responden.", Listen: "Anuncio en directo", Recorded: "Mensaje grabado", End: "Fin del mensaje", OptOut: "Pulse 9 para dejar de recibir estos mensajes.", OptedOut: "Ya no recibirá estos mensajes.", Replay: "Pulse 1 para volver a escuchar el mensaje.", Templates: "Pulse 3 para enviar un mensaje guardado.", TemplateCode: "Marque el código del mensaje guardado, seguido de la tecla almohadilla.", TemplateSent: "Enviando {{.RecName}}", TemplateUnknown: "Ningún mensaje guardado tiene este código.", IVRMenu: "Pulse 1 para grabar un nuevo mensaje, 2 para escuchar el último, 3 para elegir los destinatarios, o 4 para cancelar su último envío.", IVRGroup: "Marque el número del grupo, seguido de la tecla almohadilla, o 0 para todos.", IVRGroupSet: "Destinatarios: {{if .Group}}grupo {{.Group}}{{else}}todos{{end}}", IVRCanceled: "Su último envío ha sido cancelado.", IVRNone: "No ha enviado ningún mensaje recientemente."},
+}
+
+// PromptBook holds the prompts of each supported language.
+type PromptBook struct {
+	// Fallback is the language used when the requested
+	// one is not available.
+	Fallback string
+	Level    float64
+	// Speech, if set, speaks the prompts with a TTS provider
+	// instead of nexmo's built-in voices.
+	Speech *Speech
+	langs  map[string]Prompts
+}
+
+// NewPromptBook returns a book containing the builtin prompts.
+func NewPromptBook() *PromptBook {
+	b := &PromptBook{
+		Fallback: DefaultLang,
+		Level:    DefaultLevel,
+		langs:    make(map[string]Prompts, len(builtinPrompts)),
+	}
+	for k, v := range builtinPrompts {
+		b.langs[k] = v
+	}
+	return b
+}
+
+// Set overrides the prompts of `lang` with the non empty
+// fields of `p`, adding the language if needed.
+func (b *PromptBook) Set(lang string, p Prompts) error {
+	lang = baseLang(lang)
+	if err := p.validate(); err != nil {
+		return fmt.Errorf("prompts of %q: %v", lang, err)
+	}
+
+	acc := b.langs[lang]
+	if p.Voice != "" {
+		acc.Voice = p.Voice
+	}
+	if p.Level != 0 {
+		acc.Level = p.Level
+	}
+	if p.Greeting != "" {
+		acc.Greeting = p.Greeting
+	}
+	if p.Confirm != "" {
+		acc.Confirm = p.Confirm
+	}
+	if p.TooLong != "" {
+		acc.TooLong = p.TooLong
+	}
+	if p.Menu != "" {
+		acc.Menu = p.Menu
+	}
+	if p.Live != "" {
+		acc.Live = p.Live
+	}
+	if p.Listen != "" {
+		acc.Listen = p.Listen
+	}
+	if p.Recorded != "" {
+		acc.Recorded = p.Recorded
+	}
+	if p.End != "" {
+		acc.End = p.End
+	}
+	if p.OptOut != "" {
+		acc.OptOut = p.OptOut
+	}
+	if p.OptedOut != "" {
+		acc.OptedOut = p.OptedOut
+	}
+	if p.Replay != "" {
+		acc.Replay = p.Replay
+	}
+	if p.Templates != "" {
+		acc.Templates = p.Templates
+	}
+	if p.TemplateCode != "" {
+		acc.TemplateCode = p.TemplateCode
+	}
+	if p.TemplateSent != "" {
+		acc.TemplateSent = p.TemplateSent
+	}
+	if p.TemplateUnknown != "" {
+		acc.TemplateUnknown = p.TemplateUnknown
+	}
+	if p.IVRMenu != "" {
+		acc.IVRMenu = p.IVRMenu
+	}
+	if p.IVRGroup != "" {
+		acc.IVRGroup = p.IVRGroup
+	}
+	if p.IVRGroupSet != "" {
+		acc.IVRGroupSet = p.IVRGroupSet
+	}
+	if p.IVRCanceled != "" {
+		acc.IVRCanceled = p.IVRCanceled
+	}
+	if p.IVRNone != "" {
+		acc.IVRNone = p.IVRNone
+	}
+	b.langs[lang] = acc
+	return nil
+}
+
+// For returns the prompts of `lang`, which may be either a
+// language ("en") or a locale ("en-GB"). Unknown languages fall
+// back to Fallback. When `voice` is not empty, it overrides the
+// language's voice.
+func (b *PromptBook) For(lang, voice string) Prompts {
+	lang = baseLang(lang)
+	p, ok := b.langs[lang]
+	if !ok {
+		lang = b.Fallback
+		p = b.langs[lang]
+	}
+	p.lang, p.speech = lang, b.Speech
+	if p.Level == 0 {
+		p.Level = b.Level
+	}
+	if voice != "" {
+		p.Voice = voice
+	}
+	return p
+}
+
+var defaultPromptBook = NewPromptBook()
+
+// PromptsFor returns the builtin prompts of `lang`,
+// see PromptBook.For.
+func PromptsFor(lang, voice string) Prompts {
+	return defaultPromptBook.For(lang, voice)
+}
+
+func baseLang(lang string) string {
+	lang = strings.ToLower(lang)
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		lang = lang[:i]
+	}
+	return lang
+}
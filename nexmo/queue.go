@@ -0,0 +1,209 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// finishedKept is the number of completed broadcasts that
+// are still reported by Queue.Stats.
+const finishedKept = 10
+
+// QueueStats is the state of the outbound queue of a broadcast.
+type QueueStats struct {
+	BroadcastID int64  `json:"broadcast_id"`
+	RecName     string `json:"rec_name"`
+	Priority    string `json:"priority,omitempty"`
+	Total       int    `json:"total"`
+	// Queued contacts are waiting for a worker.
+	Queued int `json:"queued"`
+	// Deferred contacts are waiting for their quiet hours
+	// to end, before being queued.
+	Deferred int `json:"deferred"`
+	// InFlight contacts are being called, or are waiting
+	// for their next attempt.
+	InFlight  int        `json:"in_flight"`
+	Succeeded int        `json:"succeeded"`
+	Failed    int        `json:"failed"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	// NextDequeue estimates when the next queued contact will
+	// be picked up. It is missing when the workers are all
+	// busy, or when nothing is queued.
+	NextDequeue *time.Time `json:"next_dequeue,omitempty"`
+	// Canceled broadcasts do not call their remaining
+	// contacts.
+	Canceled bool `json:"canceled,omitempty"`
+}
+
+// Queue keeps track of the contacts dispatched by a Client,
+// for each broadcast in progress.
+type Queue struct {
+	mu      sync.Mutex
+	seq     int
+	entries map[int]*queueEntry
+	order   []int
+}
+
+type queueEntry struct {
+	stats       QueueStats
+	workers     int
+	lastDequeue time.Time
+	cancel      context.CancelFunc
+}
+
+func NewQueue() *Queue {
+	return &Queue{entries: make(map[int]*queueEntry)}
+}
+
+func (q *Queue) add(b Broadcast, contacts, workers int, cancel context.CancelFunc) int {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.seq++
+	q.entries[q.seq] = &queueEntry{
+		stats: QueueStats{
+			BroadcastID: b.ID,
+			RecName:     b.RecName,
+			Priority:    b.Priority,
+			Total:       contacts,
+			Queued:      contacts,
+			StartedAt:   time.Now(),
+		},
+		workers: workers,
+		cancel:  cancel,
+	}
+	q.order = append(q.order, q.seq)
+	return q.seq
+}
+
+func (q *Queue) update(id int, f func(*queueEntry)) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if e, ok := q.entries[id]; ok {
+		f(e)
+	}
+}
+
+func (q *Queue) dequeued(id int) {
+	q.update(id, func(e *queueEntry) {
+		e.stats.Queued--
+		e.stats.InFlight++
+		e.lastDequeue = time.Now()
+	})
+}
+
+// deferred moves `n` contacts from the queued ones to the
+// deferred ones, or back when negative.
+func (q *Queue) deferred(id int, n int) {
+	q.update(id, func(e *queueEntry) {
+		e.stats.Queued -= n
+		e.stats.Deferred += n
+	})
+}
+
+func (q *Queue) delivered(id int, err error) {
+	q.update(id, func(e *queueEntry) {
+		e.stats.InFlight--
+		if err == nil {
+			e.stats.Succeeded++
+		} else {
+			e.stats.Failed++
+		}
+	})
+}
+
+// finish marks the broadcast as completed, forgetting the
+// oldest completed broadcasts.
+func (q *Queue) finish(id int) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if e, ok := q.entries[id]; ok {
+		now := time.Now()
+		e.stats.EndedAt = &now
+	}
+	finished := 0
+	for i := len(q.order) - 1; i >= 0; i-- {
+		k := q.order[i]
+		if q.entries[k].stats.EndedAt == nil {
+			continue
+		}
+		if finished++; finished > finishedKept {
+			delete(q.entries, k)
+			q.order = append(q.order[:i], q.order[i+1:]...)
+		}
+	}
+}
+
+// Cancel stops the broadcasts of `recName` in progress: their
+// queued and deferred contacts are not called, and the failed
+// calls are not retried. The calls already placed go on. Returns
+// the number of broadcasts canceled.
+func (q *Queue) Cancel(recName string) int {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := 0
+	for _, e := range q.entries {
+		if e.stats.RecName != recName || e.stats.EndedAt != nil || e.stats.Canceled {
+			continue
+		}
+		e.stats.Canceled = true
+		e.cancel()
+		n++
+	}
+	return n
+}
+
+// Stats returns the state of the recent broadcasts, oldest
+// first. Dequeue estimates assume that calls are paced by `l`.
+func (q *Queue) Stats(l *Limiter) []QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	acc := make([]QueueStats, 0, len(q.order))
+	for _, k := range q.order {
+		e := q.entries[k]
+		s := e.stats
+		if s.EndedAt == nil && s.Queued > 0 && s.InFlight < e.workers {
+			next := e.lastDequeue.Add(l.Interval())
+			if next.Before(now) {
+				next = now
+			}
+			s.NextDequeue = &next
+		}
+		acc = append(acc, s)
+	}
+	return acc
+}
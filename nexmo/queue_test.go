@@ -0,0 +1,69 @@
+package nexmo_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+func TestQueue_stats(t *testing.T) {
+	srv, c := newTestClient(t)
+	srv.Fail = func(to string) int {
+		if to == "393332222222" {
+			return http.StatusBadRequest
+		}
+		return 0
+	}
+
+	c.Policy.MaxAttempts = 1
+	if _, err := c.Call(context.TODO(), contacts("393331111111,Anna\n393332222222,Bruno\n"), "rec.mp3"); err != nil {
+		t.Fatalf("Unexpected call error: %v", err)
+	}
+
+	stats := c.Queue.Stats(nexmo.CallLimiter)
+	if len(stats) != 1 {
+		t.Fatalf("Wanted 1 broadcast, found %d", len(stats))
+	}
+	s := stats[0]
+	if s.Total != 2 || s.Queued != 0 || s.InFlight != 0 || s.Succeeded != 1 || s.Failed != 1 {
+		t.Fatalf("Unexpected queue state: %+v", s)
+	}
+	if s.EndedAt == nil || s.NextDequeue != nil {
+		t.Fatalf("Wanted a completed broadcast, found %+v", s)
+	}
+}
+
+func TestQueue_cancel(t *testing.T) {
+	srv, c := newTestClient(t)
+	c.Location = time.UTC
+	now := time.Now().UTC()
+	sinceMidnight := now.Sub(now.Truncate(24 * time.Hour))
+	c.QuietHours = nexmo.QuietHours{Start: sinceMidnight - time.Minute, End: sinceMidnight + time.Hour}
+
+	done := make(chan *nexmo.BroadcastReport)
+	go func() {
+		done <- c.CallContacts(context.TODO(), contacts("393331111111,Anna\n"), "a.mp3", []nexmo.Contact{nexmo.NewContact("393331111111", "Anna")})
+	}()
+	waitFor(t, "the contact to be deferred", func() bool {
+		stats := c.Queue.Stats(nexmo.CallLimiter)
+		return len(stats) == 1 && stats[0].Deferred == 1
+	})
+	if n := c.Queue.Cancel("a.mp3"); n != 1 {
+		t.Fatalf("Wanted 1 broadcast to be canceled, found %d", n)
+	}
+
+	select {
+	case report := <-done:
+		if report.Failed != 1 || report.Results[0].Err != context.Canceled || len(srv.Calls()) != 0 {
+			t.Fatalf("Wanted Anna not to be called, found %+v", report.Results)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wanted the broadcast to end once canceled")
+	}
+	if stats := c.Queue.Stats(nexmo.CallLimiter); !stats[0].Canceled {
+		t.Fatalf("Wanted the broadcast to be reported as canceled, found %+v", stats[0])
+	}
+}
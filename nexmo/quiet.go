@@ -0,0 +1,105 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrQuietHours is the outcome of the live sessions for the
+// recipients in their quiet hours, who are not called.
+var ErrQuietHours = errors.New("recipient in quiet hours")
+
+// QuietHours is the daily interval when the recipients must not
+// be called, in their own time zone. Start and End are offsets
+// from midnight; the interval spans midnight when End comes
+// before Start. The zero value, or any with Start equal to End,
+// allows calling at any time.
+type QuietHours struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// ParseQuietHours returns the quiet hours from `start` to `end`,
+// both in "15:04" format.
+func ParseQuietHours(start, end string) (QuietHours, error) {
+	var q QuietHours
+	for _, v := range []struct {
+		s   string
+		dst *time.Duration
+	}{{start, &q.Start}, {end, &q.End}} {
+		t, err := time.Parse("15:04", v.s)
+		if err != nil {
+			return QuietHours{}, fmt.Errorf("invalid time of day %q, use the 15:04 format", v.s)
+		}
+		*v.dst = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	return q, nil
+}
+
+// Contains returns true if `t` falls in the quiet hours, in
+// the location of `t`.
+func (q QuietHours) Contains(t time.Time) bool {
+	h, m, s := t.Clock()
+	d := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second
+	switch {
+	case q.Start == q.End:
+		return false
+	case q.Start < q.End:
+		return d >= q.Start && d < q.End
+	default:
+		return d >= q.Start || d < q.End
+	}
+}
+
+// Next returns the first time, from `t` on, that is not in
+// the quiet hours.
+func (q QuietHours) Next(t time.Time) time.Time {
+	if !q.Contains(t) {
+		return t
+	}
+	y, m, d := t.Date()
+	end := time.Date(y, m, d, 0, 0, 0, 0, t.Location()).Add(q.End)
+	if !end.After(t) {
+		end = time.Date(y, m, d+1, 0, 0, 0, 0, t.Location()).Add(q.End)
+	}
+	return end
+}
+
+// location returns the time zone of `to`, or the client's
+// default one.
+func (c *Client) location(to Contact) *time.Location {
+	if to.TZ != "" {
+		loc, err := time.LoadLocation(to.TZ)
+		if err == nil {
+			return loc
+		}
+		c.logger().Printf("call: %s: %v", to.Number, err)
+	}
+	if c.Location != nil {
+		return c.Location
+	}
+	return time.Local
+}
+
+// callableAt returns the first time, from `now` on, `to` may
+// be called at.
+func (c *Client) callableAt(to Contact, now time.Time) time.Time {
+	return c.QuietHours.Next(now.In(c.location(to)))
+}
@@ -0,0 +1,83 @@
+package nexmo_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestQuietHours(t *testing.T) {
+	q, err := nexmo.ParseQuietHours("22:00", "07:00")
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+	rome, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		t.Skipf("time zone database not available: %v", err)
+	}
+	day := func(d, h, m int) time.Time {
+		return time.Date(2020, time.March, d, h, m, 0, 0, rome)
+	}
+	tt := []struct {
+		t    time.Time
+		next time.Time
+	}{
+		{day(2, 12, 0), day(2, 12, 0)},
+		{day(2, 21, 59), day(2, 21, 59)},
+		{day(2, 22, 0), day(3, 7, 0)},
+		{day(2, 23, 30), day(3, 7, 0)},
+		{day(3, 3, 0), day(3, 7, 0)},
+		{day(3, 7, 0), day(3, 7, 0)},
+	}
+	for _, v := range tt {
+		if next := q.Next(v.t); !next.Equal(v.next) {
+			t.Fatalf("Wanted %v to be followed by %v, found %v", v.t, v.next, next)
+		}
+	}
+
+	// The quiet hours are in the local time of the recipient.
+	if q.Contains(day(2, 22, 30).In(time.UTC)) {
+		t.Fatal("22:30 in Rome is 21:30 UTC, which is not in the quiet hours")
+	}
+	if !(nexmo.QuietHours{}).Next(day(2, 23, 0)).Equal(day(2, 23, 0)) {
+		t.Fatal("The zero quiet hours should allow calling at any time")
+	}
+	if _, err = nexmo.ParseQuietHours("22", "7:00"); err == nil {
+		t.Fatal("Wanted an error parsing an invalid time")
+	}
+}
+
+func TestCallContacts_quietHours(t *testing.T) {
+	srv, c := newTestClient(t)
+	s := &storage.Local{RootDir: t.TempDir()}
+
+	// Anna's quiet hours are over in 2 seconds, Luca's time
+	// zone is an hour ahead, past them.
+	c.Location = time.UTC
+	now := time.Now().UTC()
+	sinceMidnight := now.Sub(now.Truncate(24 * time.Hour))
+	c.QuietHours = nexmo.QuietHours{Start: sinceMidnight - 30*time.Minute, End: sinceMidnight + 2*time.Second}
+	luca := nexmo.NewContact("393332222222", "Luca")
+	luca.TZ = "Etc/GMT-1"
+	contacts := []nexmo.Contact{nexmo.NewContact("393331111111", "Anna"), luca}
+
+	done := make(chan *nexmo.BroadcastReport)
+	go func() {
+		done <- c.CallContacts(context.TODO(), s, "a.mp3", contacts)
+	}()
+	calls := srv.WaitCalls(1, waitTimeout)
+	if len(calls) != 1 || calls[0].To[0].Number != luca.Number {
+		t.Fatalf("Wanted only Luca to be called, found %+v", calls)
+	}
+	if stats := c.Queue.Stats(nexmo.CallLimiter); len(stats) != 1 || stats[0].Deferred != 1 {
+		t.Fatalf("Wanted a deferred contact, found %+v", stats)
+	}
+
+	report := <-done
+	if report.Succeeded != 2 || len(srv.Calls()) != 2 {
+		t.Fatalf("Wanted both contacts to be called, found %+v", report.Results)
+	}
+}
@@ -2,12 +2,29 @@ package nexmo
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"golang.org/x/time/rate"
 )
 
+// RateBucket paces the events of the limiters sharing it, e.g.
+// the ones of the replicas of a deployment, which would exceed
+// the limits of nexmo if each applied them on its own.
+type RateBucket interface {
+	// Wait blocks until the caller is allowed to perform
+	// a request.
+	Wait(ctx context.Context) error
+}
+
 type Limiter struct {
 	internal *rate.Limiter
+	shared   RateBucket
+
+	mu          sync.Mutex
+	pausedUntil time.Time
+	// urgent is the number of urgent callers waiting.
+	urgent int
 }
 
 // NewLimiter creates a new Limiter intance that
@@ -22,6 +39,89 @@ func NewLimiter(r int) *Limiter {
 
 // Wait blocks until the caller is allowed to perform
 // a request acoording to the limiter's configuration.
+// Callers whose context is urgent go first: the others
+// wait as long as an urgent caller is waiting.
 func (l *Limiter) Wait(ctx context.Context) error {
+	if isUrgent(ctx) {
+		l.mu.Lock()
+		l.urgent++
+		l.mu.Unlock()
+		defer func() {
+			l.mu.Lock()
+			l.urgent--
+			l.mu.Unlock()
+		}()
+	} else if err := l.yield(ctx); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	pause := time.Until(l.pausedUntil)
+	l.mu.Unlock()
+	if pause > 0 {
+		select {
+		case <-time.After(pause):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	l.mu.Lock()
+	shared := l.shared
+	l.mu.Unlock()
+	if shared != nil {
+		err := shared.Wait(ctx)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		// Pacing each replica on its own beats not
+		// calling at all.
+	}
 	return l.internal.Wait(ctx)
 }
+
+// Share paces the callers through `b`, at the same rate of `l`,
+// or again on their own if `b` is nil. When `b` fails, they are
+// paced on their own. Pauses and urgency stay local.
+func (l *Limiter) Share(b RateBucket) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.shared = b
+}
+
+// Rate is the number of events allowed per second.
+func (l *Limiter) Rate() int {
+	return int(l.internal.Limit())
+}
+
+// yield blocks until no urgent caller is waiting.
+func (l *Limiter) yield(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		n := l.urgent
+		l.mu.Unlock()
+		if n == 0 {
+			return nil
+		}
+		select {
+		case <-time.After(l.Interval()):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Pause blocks every waiter for `d`, e.g. because the server
+// asked to slow down. Overlapping pauses do not add up: the
+// one ending last wins.
+func (l *Limiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// Interval is the minimum time between two events.
+func (l *Limiter) Interval() time.Duration {
+	return time.Duration(float64(time.Second) / float64(l.internal.Limit()))
+}
@@ -2,6 +2,7 @@ package nexmo_test
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -41,3 +42,42 @@ func TestLimit(t *testing.T) {
 		t.Fatalf("Unexpected limiter error: %v", err)
 	}
 }
+
+// bucket is a nexmo.RateBucket counting its waiters.
+type bucket struct {
+	waits int
+	err   error
+}
+
+func (b *bucket) Wait(ctx context.Context) error {
+	b.waits++
+	return b.err
+}
+
+func TestLimiter_Share(t *testing.T) {
+	l := nexmo.NewLimiter(1)
+	b := &bucket{}
+	l.Share(b)
+
+	// The shared bucket paces the callers in place of l.
+	ctx := context.TODO()
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(ctx); err != nil {
+			t.Fatalf("%d: Unexpected limiter error: %v", i, err)
+		}
+	}
+	if b.waits != 3 {
+		t.Fatalf("Wanted 3 waits on the shared bucket, found %d", b.waits)
+	}
+
+	// l takes over when the bucket fails.
+	b.err = errors.New("unavailable")
+	if err := l.Wait(ctx); err != nil {
+		t.Fatalf("Unexpected limiter error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err == nil {
+		t.Fatal("Limiter did not block")
+	}
+}
@@ -0,0 +1,146 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Bounds of the record action options, as documented by nexmo.
+const (
+	MinRecordTimeOut      = 3 * time.Second
+	MaxRecordTimeOut      = 7200 * time.Second
+	MinRecordEndOnSilence = 3 * time.Second
+	MaxRecordEndOnSilence = 10 * time.Second
+)
+
+// RecordOptions configures the record action of the inbound calls.
+type RecordOptions struct {
+	// TimeOut is the maximum length of a recording,
+	// nexmo's default (2h) if zero.
+	TimeOut time.Duration
+	// EndOnSilence stops the recording after that much
+	// silence. Zero disables it.
+	EndOnSilence time.Duration
+	// NoBeep disables the beep played when the
+	// recording starts.
+	NoBeep bool
+	// Confirm tells the caller how long the message is
+	// once the recording stops, so that who forgot to
+	// press # learns that the silence was recorded too.
+	Confirm bool
+	// MaxLength discards the recordings longer than that,
+	// which are never broadcast: when Confirm is set, the
+	// caller is offered to record the message again. The
+	// recording itself is stopped shortly after MaxLength.
+	// Zero disables the check.
+	MaxLength time.Duration
+	// Channels, when not empty, records each leg of the
+	// conversation on its own channel, e.g. "caller" and
+	// "callee" when recording a connect or conference flow.
+	// The labels are stored in the recording's RecMeta.
+	Channels []string
+}
+
+// maxLengthGrace is how long the recording goes on after
+// MaxLength, so that too long messages can be told apart
+// from the ones that just fit.
+const maxLengthGrace = 2 * time.Second
+
+// MaxRecordChannels is the maximum number of channels of
+// a split recording.
+const MaxRecordChannels = 32
+
+// Validate checks the options against nexmo's bounds.
+func (o RecordOptions) Validate() error {
+	if o.TimeOut != 0 && (o.TimeOut < MinRecordTimeOut || o.TimeOut > MaxRecordTimeOut) {
+		return fmt.Errorf("record timeout must be between %v and %v, found %v", MinRecordTimeOut, MaxRecordTimeOut, o.TimeOut)
+	}
+	if o.EndOnSilence != 0 && (o.EndOnSilence < MinRecordEndOnSilence || o.EndOnSilence > MaxRecordEndOnSilence) {
+		return fmt.Errorf("record end on silence must be between %v and %v, found %v", MinRecordEndOnSilence, MaxRecordEndOnSilence, o.EndOnSilence)
+	}
+	if o.MaxLength != 0 && (o.MaxLength < MinRecordTimeOut || o.MaxLength+maxLengthGrace > MaxRecordTimeOut) {
+		return fmt.Errorf("record max length must be between %v and %v, found %v", MinRecordTimeOut, MaxRecordTimeOut-maxLengthGrace, o.MaxLength)
+	}
+	if len(o.Channels) > MaxRecordChannels {
+		return fmt.Errorf("at most %d record channels are supported, found %d", MaxRecordChannels, len(o.Channels))
+	}
+	return nil
+}
+
+// Action returns the record NCCO action, recording in `format`
+// and reporting the recording to `eventURL`. To record a connect
+// flow, place it before the connect action. When recording on
+// multiple channels, their labels are appended to `eventURL`, see
+// RecChannelsFromQuery.
+func (o RecordOptions) Action(format, eventURL string) map[string]interface{} {
+	if len(o.Channels) > 0 {
+		sep := "?"
+		if strings.Contains(eventURL, "?") {
+			sep = "&"
+		}
+		eventURL += sep + url.Values{"channels": {strings.Join(o.Channels, ",")}}.Encode()
+	}
+	action := map[string]interface{}{
+		"action":    "record",
+		"beepStart": !o.NoBeep,
+		"format":    format,
+		"eventUrl":  []string{eventURL},
+		"endOnKey":  "#",
+	}
+	if len(o.Channels) > 0 {
+		action["split"] = "conversation"
+		action["channels"] = len(o.Channels)
+	}
+	if timeOut := o.timeOut(); timeOut != 0 {
+		action["timeOut"] = int(timeOut / time.Second)
+	}
+	if o.EndOnSilence != 0 {
+		action["endOnSilence"] = int(o.EndOnSilence / time.Second)
+	}
+	return action
+}
+
+// timeOut returns the record action timeout, which is the
+// shortest between TimeOut and MaxLength, plus its grace.
+func (o RecordOptions) timeOut() time.Duration {
+	if o.MaxLength == 0 {
+		return o.TimeOut
+	}
+	if max := o.MaxLength + maxLengthGrace; o.TimeOut == 0 || max < o.TimeOut {
+		return max
+	}
+	return o.TimeOut
+}
+
+// TooLong returns true if a recording `d` long exceeds MaxLength.
+func (o RecordOptions) TooLong(d time.Duration) bool {
+	return o.MaxLength > 0 && d > o.MaxLength
+}
+
+// RecChannelsFromQuery returns the channel labels added to the
+// record event URL by RecordOptions.Action.
+func RecChannelsFromQuery(q url.Values) []string {
+	v := q.Get("channels")
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
@@ -0,0 +1,318 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// RelayWait is how long a relayed stream waits for the
+// broadcaster to connect before being closed.
+const RelayWait = time.Minute
+
+// RelayContentType is the audio format exchanged with nexmo's
+// websockets: 16 bit linear PCM at 16kHz, in 20ms frames.
+const RelayContentType = "audio/l16;rate=16000"
+
+// relayFormat describes RelayContentType, for storing the
+// relayed speech.
+var relayFormat = wavFormat{
+	AudioFormat:   1,
+	Channels:      1,
+	SampleRate:    16000,
+	ByteRate:      32000,
+	BlockAlign:    2,
+	BitsPerSample: 16,
+}
+
+// relayRecExt is the extension of the relayed speech recordings.
+const relayRecExt = ".wav"
+
+// relayBacklog is the number of frames queued for each listener:
+// when a listener falls behind, its oldest frames are dropped to
+// keep the delay low.
+const relayBacklog = 25
+
+const (
+	relaySource   = "source"
+	relayListener = "listen"
+)
+
+// relayAction returns the connect NCCO action opening the
+// websocket of `stream`, as either its source or a listener.
+func relayAction(origin string, urlKey []byte, stream, role string, ctx ConnectContext) map[string]interface{} {
+	return websocketAction(origin, urlKey, "/ws/relay/"+stream+"/"+role, ctx)
+}
+
+// websocketAction returns the connect NCCO action opening the
+// websocket served at `path`, exchanging RelayContentType audio.
+// nexmo sends `ctx` as the first, text, message.
+func websocketAction(origin string, urlKey []byte, path string, ctx ConnectContext) map[string]interface{} {
+	uri := origin + path + "?" + SignQuery(urlKey, path, nil)
+	if strings.HasPrefix(uri, "https://") {
+		uri = "wss://" + strings.TrimPrefix(uri, "https://")
+	} else {
+		uri = "ws://" + strings.TrimPrefix(uri, "http://")
+	}
+	endpoint := map[string]interface{}{
+		"type":         "websocket",
+		"uri":          uri,
+		"content-type": RelayContentType,
+	}
+	if fields := ctx.fields(); len(fields) > 0 {
+		endpoint["headers"] = fields
+	}
+	return map[string]interface{}{
+		"action":   "connect",
+		"endpoint": []map[string]interface{}{endpoint},
+	}
+}
+
+// Relay fans the audio of each broadcaster speaking live out
+// to the recipients, with the delay of a single audio frame.
+// Both sides connect to it through nexmo's websocket connect
+// action.
+type Relay struct {
+	// MaxSize is the size of the largest recording kept of
+	// a stream, DefaultMaxRecSize if zero. Longer streams
+	// are still relayed.
+	MaxSize int64
+	Log     *log.Logger
+
+	mu      sync.Mutex
+	streams map[string]*relayStream
+}
+
+type relayStream struct {
+	done chan struct{}
+
+	mu        sync.Mutex
+	started   bool
+	listeners map[chan []byte]bool
+	pcm       bytes.Buffer
+}
+
+// NewRelay returns an empty relay.
+func NewRelay() *Relay {
+	return &Relay{streams: make(map[string]*relayStream)}
+}
+
+// Open prepares the stream `name`, which is closed unless its
+// source connects within RelayWait.
+func (r *Relay) Open(name string) {
+	st := &relayStream{
+		done:      make(chan struct{}),
+		listeners: make(map[chan []byte]bool),
+	}
+	r.mu.Lock()
+	r.streams[name] = st
+	r.mu.Unlock()
+
+	time.AfterFunc(RelayWait, func() {
+		st.mu.Lock()
+		started := st.started
+		st.mu.Unlock()
+		if !started {
+			logger(r.Log).Printf("relay: no source connected to %s, closing", name)
+			r.close(name)
+		}
+	})
+}
+
+func (r *Relay) stream(name string) *relayStream {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.streams[name]
+}
+
+// close closes `name`, disconnecting its listeners, and returns
+// the audio of its source.
+func (r *Relay) close(name string) []byte {
+	r.mu.Lock()
+	st, ok := r.streams[name]
+	delete(r.streams, name)
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	close(st.done)
+	return st.pcm.Bytes()
+}
+
+func (r *Relay) maxSize() int64 {
+	if r.MaxSize == 0 {
+		return DefaultMaxRecSize
+	}
+	return r.MaxSize
+}
+
+// start marks the source as connected, returning false
+// if another one did already.
+func (st *relayStream) start() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.started {
+		return false
+	}
+	st.started = true
+	return true
+}
+
+func (st *relayStream) publish(frame []byte, keep bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if keep {
+		st.pcm.Write(frame)
+	}
+	for ch := range st.listeners {
+		select {
+		case ch <- frame:
+		default:
+			// Drop the oldest frame to make room.
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- frame
+		}
+	}
+}
+
+func (st *relayStream) listen() chan []byte {
+	ch := make(chan []byte, relayBacklog)
+	st.mu.Lock()
+	st.listeners[ch] = true
+	st.mu.Unlock()
+	return ch
+}
+
+func (st *relayStream) unlisten(ch chan []byte) {
+	st.mu.Lock()
+	delete(st.listeners, ch)
+	st.mu.Unlock()
+}
+
+// makeRelayHandler serves the websockets of the relayed streams.
+// When the source disconnects the stream is over: its listeners
+// are disconnected and the speech is stored in `s`.
+func makeRelayHandler(rl *Relay, s RecStore, urlKey []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := VerifyQuery(urlKey, r.URL.Path, r.URL.Query()); err != nil {
+			logger(rl.Log).Printf("relay handler: %v", err)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		name, role := mux.Vars(r)["stream"], mux.Vars(r)["role"]
+		st := rl.stream(name)
+		if st == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if role == relaySource && !st.start() {
+			logger(rl.Log).Printf("relay handler: %s has a source already", name)
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		// The listeners are registered before the handshake
+		// completes, so that they do not miss the first frames.
+		var ch chan []byte
+		if role != relaySource {
+			ch = st.listen()
+			defer st.unlisten(ch)
+		}
+		conn, err := upgradeWS(w, r)
+		if err != nil {
+			logger(rl.Log).Printf("relay handler: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer conn.Close()
+
+		if role == relaySource {
+			relaySourceLoop(conn, st, rl.maxSize())
+			pcm := rl.close(name)
+			logger(rl.Log).Printf("relay handler: %s is over, storing %d bytes of speech", name, len(pcm))
+			if len(pcm) == 0 {
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			wav := encodeWAV(relayFormat, pcm)
+			if _, err := s.WriteRec(ctx, bytes.NewReader(wav), name+relayRecExt, RecMeta{
+				ContentType: ContentType(name + relayRecExt),
+				CreatedAt:   time.Now(),
+			}); err != nil {
+				logger(rl.Log).Printf("relay handler: unable to store %s: %v", name, err)
+			}
+			return
+		}
+		relayListenerLoop(conn, st, ch)
+	}
+}
+
+// relaySourceLoop publishes the audio frames of `conn` until it
+// closes, keeping at most `max` bytes of them.
+func relaySourceLoop(conn *wsConn, st *relayStream, max int64) {
+	var kept int64
+	for {
+		op, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		// Text messages carry nexmo's metadata.
+		if op != wsBinary {
+			continue
+		}
+		kept += int64(len(data))
+		st.publish(data, kept <= max)
+	}
+}
+
+// relayListenerLoop sends the audio frames that `st` publishes
+// on `ch` to `conn` until either of them is over.
+func relayListenerLoop(conn *wsConn, st *relayStream, ch chan []byte) {
+	// The listener's own audio is discarded.
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case frame := <-ch:
+			if err := conn.WriteMessage(wsBinary, frame); err != nil {
+				return
+			}
+		case <-st.done:
+			return
+		case <-gone:
+			return
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package nexmo_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/nexmo/nexmotest"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestPassthrough(t *testing.T) {
+	srv, c := newTestClient(t)
+
+	dir := t.TempDir()
+	ioutil.WriteFile(dir+"/whitelist.csv", []byte("393330000000,Marco,,,,en\n"), 0644)
+	ioutil.WriteFile(dir+"/contacts.csv", []byte("393331111111,Anna\n"), 0644)
+	s := &storage.Local{RootDir: dir}
+
+	var h http.Handler
+	voicebr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r)
+	}))
+	defer voicebr.Close()
+	c.Origin = voicebr.URL
+	h = nexmo.NewRouter(c, s, c.Origin, nexmo.RouterOptions{Conference: true, Passthrough: true})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, nexmotest.AnswerWebhook("393330000000", "CON-1"))
+	var ncco []map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&ncco); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	u, _ := url.Parse(ncco[1]["eventUrl"].([]interface{})[0].(string))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, nexmotest.InputWebhook(u.RequestURI(), "CON-1", "2"))
+	if err := json.NewDecoder(w.Body).Decode(&ncco); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if len(ncco) != 2 || ncco[1]["action"] != "connect" {
+		t.Fatalf("Wanted to connect to the relay, found %v", ncco)
+	}
+	sourceURI := ncco[1]["endpoint"].([]interface{})[0].(map[string]interface{})["uri"].(string)
+
+	calls := srv.WaitCalls(1, waitTimeout)
+	if len(calls) != 1 || len(calls[0].NCCO) != 2 {
+		t.Fatalf("Wanted the recipient to be called into the relay, found %+v", calls)
+	}
+	listen := calls[0].NCCO[1]["endpoint"].([]interface{})[0].(map[string]interface{})
+	listenURI := listen["uri"].(string)
+	if headers, _ := listen["headers"].(map[string]interface{}); headers["Caller"] != "393330000000" {
+		t.Fatalf("Wanted the broadcaster in the listener headers, found %v", listen["headers"])
+	}
+
+	listener, err := nexmotest.DialWebsocket(listenURI)
+	if err != nil {
+		t.Fatalf("Unexpected listener error: %v", err)
+	}
+	defer listener.Close()
+	source, err := nexmotest.DialWebsocket(sourceURI)
+	if err != nil {
+		t.Fatalf("Unexpected source error: %v", err)
+	}
+
+	frames := []string{"frame-1", "frame-2", "frame-3"}
+	for _, v := range frames {
+		if err = source.Send([]byte(v)); err != nil {
+			t.Fatalf("Unexpected send error: %v", err)
+		}
+	}
+	for _, want := range frames {
+		data, err := listener.Receive()
+		if err != nil {
+			t.Fatalf("Unexpected receive error: %v", err)
+		}
+		if string(data) != want {
+			t.Fatalf("Wanted %q, found %q", want, data)
+		}
+	}
+	source.Close()
+	if _, err = listener.Receive(); err != io.EOF {
+		t.Fatalf("Wanted the listener to be disconnected, found %v", err)
+	}
+
+	u, _ = url.Parse(sourceURI)
+	name := strings.Split(u.Path, "/")[3] + ".wav"
+	waitFor(t, "the speech to be stored as "+name, func() bool {
+		rc, _, err := s.OpenRec(context.TODO(), name)
+		if err != nil {
+			return false
+		}
+		rc.Close()
+		return true
+	})
+}
@@ -0,0 +1,279 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// DefaultReplayWindow is the age of the oldest webhook accepted
+// by a ReplayGuard without a window.
+const DefaultReplayWindow = 5 * time.Minute
+
+// DefaultReplayMemory is how long a ReplayGuard without a memory
+// remembers the webhooks carrying no time, like the answer ones.
+const DefaultReplayMemory = 24 * time.Hour
+
+// maxWebhookSkew is how far in the future the time of a webhook
+// may be, to make up for the clock of nexmo being ahead.
+const maxWebhookSkew = 30 * time.Second
+
+// maxWebhookSize is the size of the largest webhook body read by
+// ReplayGuard.
+const maxWebhookSize = 1 << 20
+
+// replayPrefixes are the paths of the webhooks checked by
+// ReplayGuard: the answer and event callbacks of the calls.
+var replayPrefixes = []string{
+	"/record/voice/",
+	"/store/recording/",
+	"/play/recording/",
+}
+
+// ReplayGuard rejects the webhooks that are older than Window or
+// that have been processed already, so that captured requests
+// cannot be replayed to trigger recordings and broadcasts. It is
+// not persisted across restarts.
+type ReplayGuard struct {
+	Window time.Duration
+	// Memory is how long the webhooks whose age is unknown,
+	// having neither a timestamp nor a signature, are
+	// remembered, DefaultReplayMemory if zero. Past Window,
+	// the other ones are rejected as stale anyway.
+	Memory time.Duration
+	// Secret, if set, is the signature secret of the account:
+	// the webhooks must then carry the JWT nexmo signs with it,
+	// whose issue time and identifier take the place of the
+	// ones of the payload.
+	Secret []byte
+	// State, if set, remembers the webhooks in place of the
+	// guard, so that the instances sharing it reject the ones
+	// processed by any of them.
+	State SharedState
+	// Log receives the rejections.
+	Log *log.Logger
+
+	mu sync.Mutex
+	// seen maps the webhooks to the time they are forgotten.
+	seen map[string]time.Time
+}
+
+func NewReplayGuard(window time.Duration, secret []byte) *ReplayGuard {
+	return &ReplayGuard{Window: window, Secret: secret}
+}
+
+func (g *ReplayGuard) window() time.Duration {
+	if g.Window <= 0 {
+		return DefaultReplayWindow
+	}
+	return g.Window
+}
+
+func (g *ReplayGuard) memory() time.Duration {
+	if g.Memory <= 0 {
+		return DefaultReplayMemory
+	}
+	return g.Memory
+}
+
+// webhookID contains the fields identifying a webhook.
+type webhookID struct {
+	UUID             string `json:"uuid"`
+	ConversationUUID string `json:"conversation_uuid"`
+	Status           string `json:"status"`
+	RecordingUUID    string `json:"recording_uuid"`
+	Timestamp        string `json:"timestamp"`
+}
+
+// key returns the key webhook `id` is remembered with, empty
+// if it carries no identifier.
+func (id webhookID) key(p string) string {
+	if id.UUID == "" && id.ConversationUUID == "" && id.RecordingUUID == "" {
+		return ""
+	}
+	return strings.Join([]string{p, id.UUID, id.ConversationUUID, id.Status, id.RecordingUUID, id.Timestamp}, "\x00")
+}
+
+var (
+	ErrStaleWebhook    = errors.New("webhook is too old")
+	ErrReplayedWebhook = errors.New("webhook was already processed")
+	ErrFutureWebhook   = errors.New("webhook is from the future")
+)
+
+// Check returns an error if `r`, whose body is `body`, is stale,
+// replayed, or lacks a valid signature when Secret is set.
+// Otherwise it remembers `r` for Window, or for Memory when
+// its age cannot be told.
+func (g *ReplayGuard) Check(r *http.Request, body []byte) error {
+	var id webhookID
+	q := r.URL.Query()
+	id.UUID = q.Get("uuid")
+	id.ConversationUUID = q.Get("conversation_uuid")
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &id); err != nil {
+			return fmt.Errorf("unable to decode webhook: %v", err)
+		}
+	}
+
+	now := time.Now()
+	key := id.key(path.Clean(r.URL.Path))
+	ttl := g.memory()
+	if len(g.Secret) > 0 {
+		claims, err := g.verify(r, body)
+		if err != nil {
+			return err
+		}
+		iat := time.Unix(int64(claims["iat"].(float64)), 0)
+		if err := g.checkTime(now, iat); err != nil {
+			return err
+		}
+		if jti, _ := claims["jti"].(string); jti != "" {
+			key = "jti\x00" + jti
+		}
+		ttl = g.window() + maxWebhookSkew
+	}
+	if id.Timestamp != "" {
+		t, err := time.Parse(time.RFC3339Nano, id.Timestamp)
+		if err != nil {
+			return fmt.Errorf("invalid webhook timestamp %q: %v", id.Timestamp, err)
+		}
+		if err := g.checkTime(now, t); err != nil {
+			return err
+		}
+		ttl = g.window() + maxWebhookSkew
+	}
+	if key == "" {
+		return nil
+	}
+	if g.State != nil {
+		ok, err := g.State.Claim(r.Context(), webhookKey+key, ttl)
+		switch {
+		case err != nil:
+			return fmt.Errorf("unable to check webhook: %v", err)
+		case !ok:
+			return ErrReplayedWebhook
+		}
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for k, until := range g.seen {
+		if now.After(until) {
+			delete(g.seen, k)
+		}
+	}
+	if _, ok := g.seen[key]; ok {
+		return ErrReplayedWebhook
+	}
+	if g.seen == nil {
+		g.seen = make(map[string]time.Time)
+	}
+	g.seen[key] = now.Add(ttl)
+	return nil
+}
+
+// checkTime returns an error if a webhook sent at `t` is older
+// than Window or newer than `now`, give or take a clock skew.
+func (g *ReplayGuard) checkTime(now, t time.Time) error {
+	switch {
+	case now.Sub(t) > g.window():
+		return ErrStaleWebhook
+	case t.Sub(now) > maxWebhookSkew:
+		return ErrFutureWebhook
+	}
+	return nil
+}
+
+// verify checks the JWT signed with Secret carried by `r`,
+// together with the hash of `body` it contains, returning its
+// claims.
+func (g *ReplayGuard) verify(r *http.Request, body []byte) (jwt.MapClaims, error) {
+	raw := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if raw == "" {
+		return nil, fmt.Errorf("missing webhook signature")
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		return g.Secret, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook signature: %v", err)
+	}
+	if _, ok := claims["iat"].(float64); !ok {
+		return nil, fmt.Errorf("webhook signature has no issue time")
+	}
+	if h, ok := claims["payload_hash"].(string); ok && len(body) > 0 {
+		sum := sha256.Sum256(body)
+		if !strings.EqualFold(h, hex.EncodeToString(sum[:])) {
+			return nil, fmt.Errorf("webhook payload does not match its signature")
+		}
+	}
+	return claims, nil
+}
+
+// Middleware rejects with 403 the stale and replayed webhooks
+// reaching `next`, leaving the other routes, and the webhooks
+// synthesized by the console, alone.
+func (g *ReplayGuard) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isReplayChecked(r.URL.Path) || fromConsole(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookSize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if err := g.Check(r, body); err != nil {
+			logger(g.Log).Printf("rejecting %s %s: %v", r.Method, r.URL.Path, err)
+			http.Error(w, "webhook rejected", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isReplayChecked(p string) bool {
+	p = path.Clean(p)
+	for _, v := range replayPrefixes {
+		if strings.HasPrefix(p, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package nexmo_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+func TestReplayGuard(t *testing.T) {
+	g := nexmo.NewReplayGuard(time.Minute, nil)
+	h := g.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	post := func(p, body, token string) int {
+		r := httptest.NewRequest("POST", p, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	event := func(status string, at time.Time) string {
+		return `{"uuid":"u1","conversation_uuid":"c1","status":"` + status + `","timestamp":"` + at.UTC().Format(time.RFC3339Nano) + `"}`
+	}
+
+	now := time.Now()
+	for i, v := range []struct {
+		path, body string
+		want       int
+	}{
+		{"/record/voice/event", event("started", now), http.StatusOK},
+		{"/record/voice/event", event("answered", now), http.StatusOK},
+		{"/record/voice/event", event("started", now), http.StatusForbidden},
+		{"/record/voice/event", event("completed", now.Add(-2*time.Minute)), http.StatusForbidden},
+		{"/record/voice/event", event("completed", now.Add(time.Hour)), http.StatusForbidden},
+		{"/record/voice/event", event("ringing", now.Add(10*time.Second)), http.StatusOK},
+		{"/record/voice/event", `{"uuid":"u9","pad":"` + strings.Repeat("x", 2<<20) + `"}`, http.StatusBadRequest},
+		{"/store/recording/event", event("started", now), http.StatusOK},
+		{"/admin/recordings", event("started", now), http.StatusOK},
+		{"/admin/recordings", event("started", now), http.StatusOK},
+	} {
+		if code := post(v.path, v.body, ""); code != v.want {
+			t.Fatalf("%d: Wanted %d, found %d", i, v.want, code)
+		}
+	}
+
+	secret := []byte("secret")
+	g.Secret = secret
+	sign := func(body string, iat time.Time, jti string) string {
+		sum := sha256.Sum256([]byte(body))
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"iat":          iat.Unix(),
+			"jti":          jti,
+			"payload_hash": hex.EncodeToString(sum[:]),
+		}).SignedString(secret)
+		if err != nil {
+			t.Fatalf("Unexpected signing error: %v", err)
+		}
+		return s
+	}
+	body := `{"uuid":"u2","status":"started"}`
+	for i, v := range []struct {
+		body, token string
+		want        int
+	}{
+		{body, "", http.StatusForbidden},
+		{body, sign(`{"uuid":"u3"}`, now, "j0"), http.StatusForbidden},
+		{body, sign(body, now.Add(-2*time.Minute), "j1"), http.StatusForbidden},
+		{body, sign(body, now, "j2"), http.StatusOK},
+		{body, sign(body, now, "j2"), http.StatusForbidden},
+		{body, sign(body, now, "j3"), http.StatusOK},
+	} {
+		if code := post("/record/voice/event", v.body, v.token); code != v.want {
+			t.Fatalf("signed %d: Wanted %d, found %d", i, v.want, code)
+		}
+	}
+}
+
+func TestReplayGuard_answer(t *testing.T) {
+	g := nexmo.NewReplayGuard(10*time.Millisecond, nil)
+	h := g.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	answer := func() int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/record/voice/answer?uuid=u1&conversation_uuid=c1", nil))
+		return w.Code
+	}
+
+	if code := answer(); code != http.StatusOK {
+		t.Fatalf("Wanted %d, found %d", http.StatusOK, code)
+	}
+	// The answers carry no time, and are remembered past
+	// the window.
+	time.Sleep(50 * time.Millisecond)
+	if code := answer(); code != http.StatusForbidden {
+		t.Fatalf("Wanted the replayed answer to be rejected, found %d", code)
+	}
+}
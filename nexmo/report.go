@@ -0,0 +1,238 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// RecipientReport is the outcome of a broadcast for
+// a single recipient.
+type RecipientReport struct {
+	Number   string `json:"number"`
+	Name     string `json:"name,omitempty"`
+	Attempts int    `json:"attempts"`
+	// Reached is true if at least one call was placed.
+	Reached bool      `json:"reached"`
+	LastErr string    `json:"last_error,omitempty"`
+	First   time.Time `json:"first_attempt"`
+	Last    time.Time `json:"last_attempt"`
+}
+
+// DeliveryReport is the proof of notification of a broadcast.
+type DeliveryReport struct {
+	Broadcast   Broadcast         `json:"broadcast"`
+	Recipients  []RecipientReport `json:"recipients"`
+	Reached     int               `json:"reached"`
+	Unreached   int               `json:"unreached"`
+	GeneratedAt time.Time         `json:"generated_at"`
+	attempts    []CallAttempt
+}
+
+// NewDeliveryReport summarizes `attempts`, the call attempts
+// of broadcast `b`. The recipients of `b` that have never been
+// called are reported as unreached.
+func NewDeliveryReport(b Broadcast, attempts []CallAttempt) *DeliveryReport {
+	byNumber := make(map[string]*RecipientReport)
+	for _, v := range b.Recipients {
+		byNumber[v.Number] = &RecipientReport{Number: v.Number, Name: v.Name}
+	}
+	for _, a := range attempts {
+		r, ok := byNumber[a.Number]
+		if !ok {
+			r = &RecipientReport{Number: a.Number}
+			byNumber[a.Number] = r
+		}
+		r.Attempts++
+		if r.First.IsZero() || a.CreatedAt.Before(r.First) {
+			r.First = a.CreatedAt
+		}
+		if a.CreatedAt.After(r.Last) {
+			r.Last = a.CreatedAt
+		}
+		switch a.Status {
+		case AttemptCreated:
+			r.Reached = true
+			r.LastErr = ""
+		case AttemptFailed:
+			if !r.Reached {
+				r.LastErr = a.Err
+			}
+		}
+	}
+
+	report := &DeliveryReport{
+		Broadcast:   b,
+		Recipients:  make([]RecipientReport, 0, len(byNumber)),
+		GeneratedAt: time.Now(),
+		attempts:    attempts,
+	}
+	for _, r := range byNumber {
+		if r.Reached {
+			report.Reached++
+		} else {
+			report.Unreached++
+		}
+		report.Recipients = append(report.Recipients, *r)
+	}
+	sort.Slice(report.Recipients, func(i, j int) bool {
+		return report.Recipients[i].Number < report.Recipients[j].Number
+	})
+	return report
+}
+
+// timelineBuckets is the maximum number of bars of
+// the report's timeline chart.
+const timelineBuckets = 30
+
+// timeline groups the attempts in at most timelineBuckets
+// intervals, starting from the broadcast creation, returning
+// the interval size and the placed and failed calls of each.
+func (r *DeliveryReport) timeline() (time.Duration, []int, []int) {
+	start := r.Broadcast.CreatedAt
+	end := start
+	for _, a := range r.attempts {
+		if a.CreatedAt.After(end) {
+			end = a.CreatedAt
+		}
+	}
+	size := time.Minute
+	for end.Sub(start) >= size*timelineBuckets {
+		size *= 2
+	}
+
+	n := int(end.Sub(start)/size) + 1
+	placed, failed := make([]int, n), make([]int, n)
+	for _, a := range r.attempts {
+		i := int(a.CreatedAt.Sub(start) / size)
+		if i < 0 {
+			i = 0
+		}
+		if a.Status == AttemptCreated {
+			placed[i]++
+		} else {
+			failed[i]++
+		}
+	}
+	return size, placed, failed
+}
+
+// WritePDF renders the report as a printable A4 document,
+// made of a summary, the timeline of the call attempts and
+// the per recipient outcome.
+func (r *DeliveryReport) WritePDF(w io.Writer) error {
+	const layout = "2006-01-02 15:04:05 MST"
+
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetTitle(fmt.Sprintf("Broadcast %d delivery report", r.Broadcast.ID), true)
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.CellFormat(0, 10, fmt.Sprintf("Generated on %s - page %d", r.GeneratedAt.Format(layout), pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	// Summary.
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(0, 10, fmt.Sprintf("Broadcast %d delivery report", r.Broadcast.ID), "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 11)
+	for _, v := range [][2]string{
+		{"Recording", r.Broadcast.RecName},
+		{"Started", r.Broadcast.CreatedAt.Format(layout)},
+		{"Recipients", fmt.Sprintf("%d", len(r.Recipients))},
+		{"Reached", fmt.Sprintf("%d", r.Reached)},
+		{"Unreached", fmt.Sprintf("%d", r.Unreached)},
+		{"Call attempts", fmt.Sprintf("%d", len(r.attempts))},
+	} {
+		pdf.CellFormat(40, 7, v[0], "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 7, tr(v[1]), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(5)
+
+	// Timeline chart.
+	size, placed, failed := r.timeline()
+	pdf.SetFont("Helvetica", "B", 12)
+	pdf.CellFormat(0, 8, fmt.Sprintf("Timeline (one bar every %v)", size), "", 1, "L", false, 0, "")
+
+	max := 1
+	for i := range placed {
+		if v := placed[i] + failed[i]; v > max {
+			max = v
+		}
+	}
+	const chartW, chartH = 180.0, 50.0
+	x0, y0 := pdf.GetX(), pdf.GetY()+chartH
+	barW := chartW / float64(timelineBuckets)
+	for i := range placed {
+		x := x0 + float64(i)*barW
+		hp := chartH * float64(placed[i]) / float64(max)
+		hf := chartH * float64(failed[i]) / float64(max)
+		pdf.SetFillColor(76, 175, 80)
+		pdf.Rect(x, y0-hp, barW*0.8, hp, "F")
+		pdf.SetFillColor(229, 57, 53)
+		pdf.Rect(x, y0-hp-hf, barW*0.8, hf, "F")
+	}
+	pdf.Line(x0, y0, x0+chartW, y0)
+	pdf.SetFont("Helvetica", "", 8)
+	pdf.SetXY(x0, y0+1)
+	pdf.CellFormat(chartW/2, 5, fmt.Sprintf("max %d attempts per bar; green: placed, red: failed", max), "", 0, "L", false, 0, "")
+	pdf.CellFormat(chartW/2, 5, fmt.Sprintf("+%v", size*time.Duration(len(placed))), "", 1, "R", false, 0, "")
+	pdf.Ln(5)
+
+	// Recipients table.
+	header := []string{"Number", "Attempts", "Outcome", "Last attempt", "Error"}
+	widths := []float64{35, 20, 25, 45, 65}
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.SetFillColor(230, 230, 230)
+	for i, v := range header {
+		pdf.CellFormat(widths[i], 7, v, "1", 0, "L", true, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetFont("Helvetica", "", 9)
+	for _, v := range r.Recipients {
+		outcome := "unreached"
+		if v.Reached {
+			outcome = "reached"
+		}
+		errText := v.LastErr
+		if len(errText) > 45 {
+			errText = errText[:42] + "..."
+		}
+		last := "-"
+		if v.Attempts > 0 {
+			last = v.Last.Format(layout)
+		} else {
+			outcome = "not called"
+		}
+		row := []string{v.Number, fmt.Sprintf("%d", v.Attempts), outcome, last, tr(errText)}
+		for i, c := range row {
+			pdf.CellFormat(widths[i], 6, c, "1", 0, "L", false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+
+	if err := pdf.Output(w); err != nil {
+		return fmt.Errorf("unable to render report: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package nexmo_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+func TestNewDeliveryReport(t *testing.T) {
+	start := time.Date(2019, 3, 1, 10, 0, 0, 0, time.UTC)
+	b := nexmo.Broadcast{ID: 7, RecName: "rec.mp3", CreatedAt: start}
+	attempts := []nexmo.CallAttempt{
+		{BroadcastID: 7, Number: "393331111111", Attempt: 1, Status: nexmo.AttemptFailed, Err: "busy", CreatedAt: start},
+		{BroadcastID: 7, Number: "393331111111", Attempt: 2, Status: nexmo.AttemptCreated, CreatedAt: start.Add(time.Minute)},
+		{BroadcastID: 7, Number: "393332222222", Attempt: 1, Status: nexmo.AttemptFailed, Err: "unreachable", CreatedAt: start.Add(2 * time.Minute)},
+	}
+
+	r := nexmo.NewDeliveryReport(b, attempts)
+	if r.Reached != 1 || r.Unreached != 1 {
+		t.Fatalf("Wanted 1 reached and 1 unreached, found %d and %d", r.Reached, r.Unreached)
+	}
+	if v := r.Recipients[0]; v.Attempts != 2 || !v.Reached || v.LastErr != "" {
+		t.Fatalf("Unexpected recipient report: %+v", v)
+	}
+	if v := r.Recipients[1]; v.Reached || v.LastErr != "unreachable" {
+		t.Fatalf("Unexpected recipient report: %+v", v)
+	}
+
+	var buf bytes.Buffer
+	if err := r.WritePDF(&buf); err != nil {
+		t.Fatalf("Unexpected pdf error: %v", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")) {
+		t.Fatalf("Output is not a PDF document")
+	}
+}
@@ -24,111 +24,546 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/jecoz/voicebr/flow"
+	"github.com/jecoz/voicebr/phone"
+	"go.opentelemetry.io/otel/trace"
 )
 
-const recFormat = "mp3"
+// RouterOptions contains the optional components of the
+// router. Each of them may be left nil.
+type RouterOptions struct {
+	// Watcher reports interrupted recordings to broadcasters.
+	Watcher *RecordingWatcher
+	// Funnel tracks the inbound call flow. It is exposed
+	// at /admin/stats.
+	Funnel *Funnel
+	// RecFormat is the format recordings are made in,
+	// DefaultRecFormat if empty.
+	RecFormat string
+	// Prompts are the sentences spoken to the callers,
+	// the builtin ones if nil.
+	Prompts *PromptBook
+	// Console enables the webhook test console, at
+	// /admin/console.
+	Console bool
+	// Dashboard enables the web dashboard, at
+	// /admin/dashboard/.
+	Dashboard bool
+	// Auth authenticates the requests to the admin routes, the
+	// dashboard and the broadcast reports. When nil, they are
+	// open to anyone reaching the router.
+	Auth Authenticator
+	// OIDC, if set, serves the login flow of its provider at
+	// OIDCLoginPath. It should be among the authenticators
+	// of Auth too.
+	OIDC *OIDC
+	// Record configures the record action.
+	Record RecordOptions
+	// TrimSilence removes the leading and trailing silence
+	// of the recordings before storing them.
+	TrimSilence bool
+	// Transcoder, if set, normalizes the stored and uploaded
+	// recordings to Audio, in the recording format, before
+	// they are broadcast.
+	Transcoder Transcoder
+	Audio      AudioTarget
+	// Loudness, if set, normalizes the loudness of the stored
+	// and uploaded recordings, after transcoding them.
+	Loudness *LoudnessNormalizer
+	// DownloadWindow is the time failed recording downloads
+	// are retried for, DefaultDownloadWindow if zero.
+	DownloadWindow time.Duration
+	// MaxRecSize is the size of the largest recording that is
+	// downloaded, DefaultMaxRecSize if zero.
+	MaxRecSize int64
+	// Hosted leaves the recordings made by the broadcasters on
+	// nexmo: instead of downloading and storing them, the calls
+	// stream them through URLs signed with the client's URLKey,
+	// valid for HostedTTL, DefaultHostedTTL if zero. Trimming,
+	// transcoding, loudness, transcripts and duplicates need
+	// the audio, and are skipped.
+	Hosted    bool
+	HostedTTL time.Duration
+	// Transcripts, if set, transcribes the stored recordings.
+	Transcripts *TranscriptWorker
+	// Duplicates, if set, spots the recordings that duplicate
+	// a recent one.
+	Duplicates *DuplicateGuard
+	// Conference lets the broadcasters choose, pressing 2,
+	// to speak live to the recipients, bridged into a single
+	// conference, instead of recording a message. It enables
+	// POST /admin/conferences too.
+	Conference bool
+	// Passthrough relays the speech of the broadcasters that
+	// choose to speak live to the recipients through nexmo's
+	// websockets, instead of bridging them into a conference.
+	// The speech is stored, but not broadcast again, once over.
+	// It has no effect without Conference.
+	Passthrough bool
+	// AudioSources, if set, connects calls to its streams at
+	// /ws/audio/{stream}. Clients play into the streams with
+	// POST /admin/audio/{stream}, and dial a group into them
+	// with POST /admin/audio/{stream}/broadcast.
+	AudioSources *AudioSources
+	// OptOut lets the recipients of the recorded messages press
+	// 9 to stop receiving the broadcasts. Their numbers are
+	// added to the suppression list of the storage, which the
+	// dispatcher skips, if it is a SuppressionList.
+	OptOut bool
+	// Replays is how many times the recipients of the recorded
+	// messages may press 1 to listen to them again.
+	Replays int
+	// Loop is how many times the recorded messages are
+	// streamed in a row, once if zero.
+	Loop int
+	// Templates adds a third option to the menu of Conference:
+	// pressing 3 and typing the code of a template broadcasts it
+	// to the broadcast list. It has no effect without Conference.
+	Templates bool
+	// IVR greets the broadcasters with a menu instead: 1 records
+	// a message, 2 plays back their last one, 3 asks for the
+	// position of the group in IVRGroups to broadcast to, and 4
+	// cancels their last broadcast. It takes the place of the
+	// menu of Conference.
+	IVR       bool
+	IVRGroups []string
+	// Sessions persists the state of the call flows between
+	// the webhooks, like the IVR's. When nil, the storage is
+	// used if it implements flow.Store, memory otherwise.
+	Sessions flow.Store
+	// Replay, if set, rejects the stale and replayed answer
+	// and event webhooks.
+	Replay *ReplayGuard
+	// Origins, if set, resolves the origin the answer and event
+	// webhooks point the calls to from the requests, instead of
+	// always using the canonical one.
+	Origins *OriginResolver
+	// Allowlist, if set, restricts the answer and event webhooks
+	// to the addresses nexmo sends them from.
+	Allowlist *IPAllowlist
+	// Events receives the voice events of both the inbound
+	// and the outbound calls, NopSink if nil.
+	Events EventSink
+	// Log receives the logs of the handlers, the one of the
+	// client if nil.
+	Log *log.Logger
 
-type Storage interface {
-	ContactsProvider
-	RecFileHandler() http.Handler
-	WriteRec(src io.Reader, fileName string) (string, error)
+	// ivr is set by NewRouter when IVR is.
+	ivr *ivr
+	// lengths is set by NewRouter when confirming recordings.
+	lengths *recLengths
+	// claims is set by NewRouter, see claimRec.
+	claims *recClaims
+	// relay is set by NewRouter when Passthrough is set.
+	relay *Relay
 }
 
-func NewRouter(c *Client, s Storage, origin string) *mux.Router {
+func (o RouterOptions) download() DownloadOptions {
+	return DownloadOptions{
+		Window:       o.DownloadWindow,
+		MaxSize:      o.MaxRecSize,
+		ContentTypes: RecContentTypes(o.recFormat()),
+	}
+}
+
+func (o RouterOptions) recFormat() string {
+	if o.RecFormat == "" {
+		return DefaultRecFormat
+	}
+	return o.RecFormat
+}
+
+// transcoder returns Transcoder, or FFmpeg if nil.
+func (o RouterOptions) transcoder() Transcoder {
+	if o.Transcoder == nil {
+		return FFmpeg{}
+	}
+	return o.Transcoder
+}
+
+func (o RouterOptions) audioTarget() AudioTarget {
+	t := o.Audio
+	t.Format = o.recFormat()
+	return t
+}
+
+func (o RouterOptions) logger() *log.Logger {
+	return logger(o.Log)
+}
+
+func (o RouterOptions) prompts() *PromptBook {
+	if o.Prompts == nil {
+		return defaultPromptBook
+	}
+	return o.Prompts
+}
+
+// NewRouter returns the router handling nexmo's callbacks.
+func NewRouter(c *Client, s Storage, origin string, opts RouterOptions) *mux.Router {
 	r := mux.NewRouter()
-	r.HandleFunc("/record/voice/answer", makeRecordAnswerHandler(s, origin))
-	r.HandleFunc("/record/voice/event", LogEventHandler)
-	r.HandleFunc("/store/recording/event", makeStoreRecordingEventHandler(s, c))
-	r.HandleFunc("/play/recording/event", LogEventHandler)
-	r.HandleFunc("/play/recording/{name}", makePlayRecordingHandler(origin))
-	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", s.RecFileHandler()))
-	r.Use(loggingMiddleware)
+	opts.claims = newRecClaims()
+	if opts.Events == nil {
+		opts.Events = NopSink{}
+	}
+	var (
+		urlKey []byte
+		cache  *RecCache
+	)
+	if c != nil {
+		urlKey, cache = c.URLKey, c.Cache
+		if opts.Log == nil {
+			opts.Log = c.Log
+		}
+	}
+	if opts.Record.Confirm {
+		opts.lengths = newRecLengths()
+		r.HandleFunc("/record/voice/confirm", makeRecordConfirmHandler(origin, urlKey, opts))
+		r.HandleFunc("/record/voice/again", makeRecordAgainHandler(s, origin, urlKey, opts))
+	}
+	if c == nil {
+		// There is no one to dial into the conference, nor
+		// to broadcast through the IVR.
+		opts.Conference = false
+		opts.IVR = false
+	}
+	if opts.IVR {
+		if opts.Sessions == nil {
+			opts.Sessions, _ = s.(flow.Store)
+		}
+		if opts.Sessions == nil {
+			opts.Sessions = flow.NewMemoryStore()
+		}
+		opts.ivr = newIVR(opts.Sessions, c, origin, urlKey, opts)
+		r.HandleFunc(ivrPath, makeIVRHandler(s, opts.ivr, origin, urlKey, opts))
+	}
+	if opts.Conference && opts.Passthrough {
+		opts.relay = NewRelay()
+		opts.relay.MaxSize = opts.MaxRecSize
+		opts.relay.Log = opts.Log
+		r.HandleFunc("/ws/relay/{stream}/{role:source|listen}", makeRelayHandler(opts.relay, s, urlKey)).Methods("GET")
+	}
+	if opts.Conference {
+		r.HandleFunc(recordModePath, makeRecordModeHandler(s, c, origin, urlKey, opts))
+		if opts.Templates {
+			r.HandleFunc(templateCodePath, makeTemplateCodeHandler(s, c, urlKey, opts))
+		}
+	}
+	r.HandleFunc("/record/voice/answer", makeRecordAnswerHandler(s, origin, urlKey, opts))
+	r.HandleFunc("/record/voice/event", makeRecordEventHandler(s, opts))
+	if c != nil {
+		// The recordings are downloaded and broadcast
+		// through the client.
+		r.HandleFunc(storeRecordingPath, makeStoreRecordingEventHandler(s, c, urlKey, opts))
+	}
+	r.HandleFunc("/play/recording/event", makeEventHandler(s, urlKey, opts))
+	protect := func(action string, h http.Handler) http.Handler {
+		if opts.Auth == nil {
+			return h
+		}
+		return requireAuth(opts.Auth, RequireAction(action, h), opts.Log)
+	}
+	if opts.OIDC != nil {
+		r.HandleFunc(OIDCLoginPath, opts.OIDC.LoginHandler()).Methods("GET")
+		r.HandleFunc(OIDCCallbackPath, opts.OIDC.CallbackHandler()).Methods("GET")
+	}
+	r.Handle("/admin/contacts/{list}/import", protect(ActionContacts, makeImportContactsHandler(s, opts.Log))).Methods("POST")
+	r.Handle("/admin/contacts/{list}/export", protect(ActionContacts, makeExportContactsHandler(s, opts.Log))).Methods("GET")
+	r.Handle("/admin/recordings", protect(ActionRecordings, makeListRecsHandler(s, opts.Log))).Methods("GET")
+	r.Handle("/admin/recordings/{name}", protect(ActionRecordings, makeDeleteRecHandler(s, cache, opts.Log))).Methods("DELETE")
+	if ts, ok := s.(TemplateStore); ok {
+		r.Handle("/admin/templates", protect(ActionRecordings, makeTemplatesHandler(ts, opts.Log))).Methods("GET")
+		r.Handle("/admin/templates/{name}", protect(ActionRecordings, makeSaveTemplateHandler(s, ts, opts.Log))).Methods("PUT")
+		r.Handle("/admin/templates/{name}", protect(ActionRecordings, makeDeleteTemplateHandler(ts, opts.Log))).Methods("DELETE")
+	}
+	if c != nil {
+		r.Handle("/admin/recordings", protect(ActionRecordings, makeUploadRecHandler(s, c, opts))).Methods("POST")
+		r.Handle("/admin/recordings/{name}/broadcast", protect(ActionBroadcast, makeRebroadcastHandler(s, c))).Methods("POST")
+		r.Handle("/admin/broadcasts", protect(ActionBroadcast, makeStartBroadcastHandler(s, c))).Methods("POST")
+	}
+	if a := opts.AudioSources; a != nil {
+		r.HandleFunc("/ws/audio/{stream}", makeAudioHandler(a, urlKey)).Methods("GET")
+		r.Handle("/admin/audio/{stream}", protect(ActionBroadcast, makePlayAudioHandler(a))).Methods("POST")
+		if c != nil {
+			r.Handle("/admin/audio/{stream}/broadcast", protect(ActionBroadcast, makeAudioBroadcastHandler(s, c, a))).Methods("POST")
+		}
+	}
+	if opts.Conference {
+		r.Handle("/admin/conferences", protect(ActionBroadcast, makeStartConferenceHandler(s, c, opts))).Methods("POST")
+	}
+	if c != nil && c.Queue != nil {
+		r.Handle("/admin/queue", protect(ActionReports, makeQueueHandler(c.Queue))).Methods("GET")
+	}
+	if l, ok := s.(SuppressionList); ok {
+		r.Handle("/admin/suppressions", protect(ActionContacts, makeSuppressionsHandler(l, opts.Log))).Methods("GET")
+		r.Handle("/admin/suppressions/{number}", protect(ActionContacts, makeSuppressHandler(l, opts.Log))).Methods("PUT")
+		r.Handle("/admin/suppressions/{number}", protect(ActionContacts, makeUnsuppressHandler(l, opts.Log))).Methods("DELETE")
+	}
+	r.Handle("/admin/subjects/{number}/export", protect(ActionAdmin, makeExportSubjectHandler(s, opts.Log))).Methods("GET")
+	r.Handle("/admin/subjects/{number}", protect(ActionAdmin, makeEraseSubjectHandler(s, c, cache, opts.Log))).Methods("DELETE")
+	if opts.OptOut || opts.Replays > 0 {
+		r.HandleFunc(keypressPath, makeKeypressHandler(s, c, origin, urlKey, opts))
+	}
+	r.HandleFunc("/play/recording/{name}", makePlayRecordingHandler(origin, urlKey, opts))
+	recFiles := s.RecFileHandler()
+	if cache != nil {
+		recFiles = cache.Handler(recFiles)
+	}
+	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", recFiles))
+	if c != nil {
+		r.HandleFunc(hostedPath, makeHostedHandler(c, urlKey, opts)).Methods("GET")
+	}
+	if sp := opts.prompts().Speech; sp != nil {
+		r.PathPrefix("/tts/").Handler(http.StripPrefix("/tts/", sp.Handler()))
+	}
+	if opts.Funnel != nil {
+		r.Handle("/admin/stats", protect(ActionReports, makeStatsHandler(opts.Funnel))).Methods("GET")
+	}
+	if h, ok := s.(BroadcastHistory); ok {
+		r.Handle("/broadcasts/{id:[0-9]+}/report", protect(ActionReports, makeReportHandler(h, false, opts.Log))).Methods("GET")
+		r.Handle("/broadcasts/{id:[0-9]+}/report.pdf", protect(ActionReports, makeReportHandler(h, true, opts.Log))).Methods("GET")
+		r.Handle("/admin/broadcasts", protect(ActionReports, makeBroadcastsHandler(h, opts.Log))).Methods("GET")
+	}
+	if ts, ok := s.(TranscriptStore); ok {
+		r.Handle("/recordings/{name}/transcript", protect(ActionReports, makeTranscriptHandler(ts, opts.Log))).Methods("GET")
+	}
+	if a, ok := s.(FailureArchive); ok {
+		r.Handle("/broadcasts/{id:[0-9]+}/failures", protect(ActionReports, makeFailuresHandler(a, opts.Log))).Methods("GET")
+	}
+	if c != nil {
+		if a, ok := c.Audit.(AuditReader); ok {
+			r.Handle("/broadcasts/{id:[0-9]+}/audit", protect(ActionReports, makeBroadcastAuditHandler(a, opts.Log))).Methods("GET")
+		}
+	}
+	if ts, ok := s.(TokenStore); ok {
+		r.Handle("/admin/tokens", protect(ActionTokens, makeCreateTokenHandler(ts, opts.Log))).Methods("POST")
+		r.Handle("/admin/tokens", protect(ActionTokens, makeListTokensHandler(ts, opts.Log))).Methods("GET")
+		r.Handle("/admin/tokens/{id}", protect(ActionTokens, makeRevokeTokenHandler(ts, opts.Log))).Methods("DELETE")
+	}
+	if l, ok := s.(EventLog); ok {
+		r.Handle("/admin/events", protect(ActionReports, makeEventsHandler(l, opts.Log))).Methods("GET")
+		var loc *time.Location
+		if c != nil {
+			loc = c.Location
+		}
+		r.Handle("/admin/analytics", protect(ActionReports, makeAnalyticsHandler(l, loc, opts.Log))).Methods("GET")
+	}
+	if l, ok := s.(UsageLog); ok {
+		r.Handle("/admin/usage", protect(ActionReports, makeUsageHandler(l, opts.Log))).Methods("GET")
+	}
+	if opts.Console {
+		r.Handle("/admin/console", protect(ActionAdmin, http.HandlerFunc(consolePageHandler))).Methods("GET")
+		r.Handle("/admin/console/send", protect(ActionAdmin, makeConsoleSendHandler(r, urlKey, opts))).Methods("POST")
+	}
+	if opts.Dashboard {
+		r.Handle("/admin/dashboard", http.RedirectHandler("/admin/dashboard/", http.StatusMovedPermanently))
+		r.PathPrefix("/admin/dashboard/").Handler(protect(ActionReports, dashboardHandler())).Methods("GET")
+	}
+	r.Use(makeLoggingMiddleware(opts.Log))
+	if opts.Origins != nil {
+		r.Use(opts.Origins.Middleware(origin))
+	}
+	if opts.Allowlist != nil {
+		r.Use(opts.Allowlist.Middleware)
+	}
+	if opts.Replay != nil {
+		r.Use(opts.Replay.Middleware)
+	}
 
 	return r
 }
 
+// webhookPrefixes are the paths of the routes nexmo reaches
+// during a call: its webhooks and the recordings it plays.
+var webhookPrefixes = []string{
+	"/record/voice/",
+	"/store/recording/",
+	"/play/recording/",
+	"/static/",
+	"/hosted/",
+	"/tts/",
+	"/ws/relay/",
+	"/ws/audio/",
+}
+
+// WebhooksOnly wraps the router `h`, answering not found to
+// every request but the ones nexmo makes. Use it to serve the
+// router publicly while the admin routes are served elsewhere.
+func WebhooksOnly(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := path.Clean(r.URL.Path)
+		for _, v := range webhookPrefixes {
+			if strings.HasPrefix(p, v) {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+}
+
+// answerRequest contains the fields of nexmo's answer
+// callback used by voicebr.
+type answerRequest struct {
+	From             string `json:"from"`
+	ConversationUUID string `json:"conversation_uuid"`
+}
+
 func CallerFromRequest(r *http.Request) (string, error) {
+	answer, err := answerFromRequest(r)
+	return answer.From, err
+}
+
+// answerFromRequest decodes the answer callback, normalizing
+// the calling number.
+func answerFromRequest(r *http.Request) (answerRequest, error) {
+	var answer answerRequest
+	var err error
 	if r.Method == "POST" {
-		return callerFromRequestBody(r.Body)
+		answer, err = answerFromRequestBody(r.Body)
 	} else {
-		return callerFromRequestQuery(r)
+		answer, err = answerFromRequestQuery(r)
+	}
+	if err != nil {
+		return answer, err
 	}
+	if answer.From, err = phone.Normalize(answer.From, CountryCode); err != nil {
+		return answer, fmt.Errorf("unable to parse calling number: %v", err)
+	}
+	return answer, nil
 }
 
-func callerFromRequestBody(p io.ReadCloser) (string, error) {
+func answerFromRequestBody(p io.ReadCloser) (answerRequest, error) {
 	defer func() {
 		p.Close()
 	}()
 
-	var body struct {
-		From string `json:"from"`
-	}
+	var body answerRequest
 	if err := json.NewDecoder(p).Decode(&body); err != nil {
-		return "", fmt.Errorf("unable to find calling number in request body: %v", err)
+		return body, fmt.Errorf("unable to find calling number in request body: %v", err)
 	}
-	return body.From, nil
+	return body, nil
 }
 
-func callerFromRequestQuery(r *http.Request) (string, error) {
-	from := r.URL.Query().Get("from")
-	if from == "" {
-		return "", fmt.Errorf("unable to find calling number in query parameters")
+func answerFromRequestQuery(r *http.Request) (answerRequest, error) {
+	answer := answerRequest{
+		From:             r.URL.Query().Get("from"),
+		ConversationUUID: r.URL.Query().Get("conversation_uuid"),
+	}
+	if answer.From == "" {
+		return answer, fmt.Errorf("unable to find calling number in query parameters")
 	}
-	return from, nil
+	return answer, nil
 }
 
-func makeRecordAnswerHandler(s Storage, origin string) http.HandlerFunc {
+func makeRecordAnswerHandler(s Storage, origin string, urlKey []byte, opts RouterOptions) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		from, err := CallerFromRequest(r)
+		origin := originOf(r.Context(), origin)
+		ctx, span := startSpan(r.Context(), "webhook.answer", trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+		opts.Funnel.Reach(StageAuth)
+		answer, err := answerFromRequest(r)
+		from := answer.From
+		span.SetAttributes(attrConversation.String(answer.ConversationUUID))
 		if err != nil {
-			log.Printf("answer handler: %v", err)
+			opts.logger().Printf("answer handler: %v", err)
+			failSpan(span, err)
 
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
 
-		log.Printf("answer handler: authenticating %s...", from)
-		whitelist, err := DecodeContacts(s.ReadWhitelist)
+		opts.logger().Printf("answer handler: authenticating %s...", from)
+		caller, err := whitelisted(s, from, opts.Log)
 		if err != nil {
-			log.Printf("answer handler: unable to decode whitelist: %v", err)
+			opts.logger().Printf("answer handler: %v", err)
+			failSpan(span, err)
 
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-
-		var caller *Contact
-		for i, v := range whitelist {
-			if v.Number == from {
-				caller = &whitelist[i]
-			}
-		}
 		if caller == nil {
-			log.Printf("answer handler: number %s cannot broadcast", from)
+			opts.logger().Printf("answer handler: number %s cannot broadcast", from)
 
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
+		opts.Funnel.Reach(StageGreet)
+		if opts.IVR {
+			// The recording is watched once chosen.
+			if err := opts.ivr.start(ctx, answer.ConversationUUID, *caller); err != nil {
+				opts.logger().Printf("answer handler: %v", err)
+				failSpan(span, err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("content-type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(ivrMenuNCCO(origin, urlKey, *caller, opts))
+			return
+		}
+		opts.Watcher.Watch(answer.ConversationUUID, *caller)
 
+		ncco := recordNCCO(origin, urlKey, *caller, opts)
+		if opts.Conference {
+			ncco = modeNCCO(origin, urlKey, *caller, opts)
+		}
 		w.Header().Set("content-type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode([]map[string]interface{}{
-			{
-				"action":    "talk",
-				"voiceName": "Carla",
-				"level":     0.5,
-				"text":      "Parla pure" + caller.Name,
-			},
-			{
-				"action":    "record",
-				"beepStart": true,
-				"format":    recFormat,
-				"eventUrl":  []string{origin + "/store/recording/event"},
-				"endOnKey":  "#",
-			},
-		})
+		json.NewEncoder(w).Encode(ncco)
+	}
+}
+
+// whitelisted returns the contact of the whitelist numbered
+// `number`, or nil if the number cannot broadcast.
+func whitelisted(s Storage, number string, lg *log.Logger) (*Contact, error) {
+	whitelist, err := DecodeContacts(s.ReadWhitelist, lg)
+	if err == ErrCorruptedContacts {
+		// The invalid entries have been logged, the
+		// valid ones may still broadcast.
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode whitelist: %v", err)
+	}
+
+	var caller *Contact
+	for i, v := range whitelist {
+		if v.Number == number {
+			caller = &whitelist[i]
+		}
 	}
+	return caller, nil
+}
+
+// storeRecordingPath receives the recording events.
+const storeRecordingPath = "/store/recording/event"
+
+// recordNCCO returns the NCCO greeting `caller` and recording
+// the message, followed by its confirmation if enabled. The
+// recording event carries `caller`, signed with `urlKey`.
+func recordNCCO(origin string, urlKey []byte, caller Contact, opts RouterOptions) []map[string]interface{} {
+	p := opts.prompts().For(caller.Lang, caller.Voice)
+	data := PromptData{
+		CallerName:   caller.Name,
+		CallerNumber: caller.Number,
+		Lang:         caller.Lang,
+		When:         SpokenTime{Time: time.Now(), Lang: caller.Lang},
+	}
+	ncco := []map[string]interface{}{
+		p.TalkAction(p.Greeting, data),
+		opts.Record.Action(opts.recFormat(), origin+storeRecordingPath+"?"+SignQuery(urlKey, storeRecordingPath, url.Values{"caller": {caller.Number}})),
+	}
+	if opts.Record.Confirm {
+		ncco = append(ncco, confirmAction(origin+"/record/voice/confirm", caller))
+	}
+	return ncco
 }
 
 func LogEventHandler(w http.ResponseWriter, r *http.Request) {
@@ -148,77 +583,560 @@ func LogEventHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[EVENT] %v", buf.String())
 }
 
-func makeStoreRecordingEventHandler(s Storage, c *Client) http.HandlerFunc {
+// makeEventHandler logs the events it receives, persisting
+// them if `s` implements EventLog and publishing them to the
+// events sink. The query parameters, signed with `urlKey`,
+// correlate the event with its broadcast.
+func makeEventHandler(s Storage, urlKey []byte, opts RouterOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			return
+		}
+		if err := VerifyQuery(urlKey, r.URL.Path, r.URL.Query()); err != nil {
+			opts.logger().Printf("event handler: %v", err)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		params := CallParamsFromQuery(r.URL.Query())
+		ctx, span := startSpan(r.Context(), "webhook.call_event", trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attrBroadcastID.Int64(params.BroadcastID)))
+		defer span.End()
+		defer func() {
+			r.Body.Close()
+			w.WriteHeader(http.StatusOK)
+		}()
+
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, r.Body); err != nil {
+			opts.logger().Printf("event handler error: unable to read body: %v", err)
+			return
+		}
+		opts.logger().Printf("[EVENT] %v", buf.String())
+		publishEvent(ctx, s, opts.Events, buf.Bytes(), params, opts.Log)
+	}
+}
+
+// publishEvent stores the event encoded in `body`, if `s`
+// implements EventLog, and hands it to `sink`. Failures are
+// only logged, as nexmo does not care about them. The span of
+// `ctx` is told about the conversation and status of the event.
+func publishEvent(ctx context.Context, s Storage, sink EventSink, body []byte, params CallParams, lg *log.Logger) {
+	e, err := DecodeCallEvent(body)
+	if err != nil {
+		logger(lg).Printf("publish event: %v", err)
+		return
+	}
+	e.BroadcastID = params.BroadcastID
+	trace.SpanFromContext(ctx).SetAttributes(attrConversation.String(e.ConversationUUID), attrStatus.String(e.Status))
+	if l, ok := s.(EventLog); ok {
+		if err = l.LogEvent(ctx, e); err != nil {
+			logger(lg).Printf("persist event: %v", err)
+		}
+	}
+	if err = sink.Consume(ctx, e); err != nil {
+		logger(lg).Printf("publish event: %v", err)
+	}
+}
+
+// makeEventsHandler returns the events of the conversation
+// given in the `conversation_uuid` query parameter, or every
+// event if missing.
+func makeEventsHandler(l EventLog, lg *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		events, err := l.Events(r.Context(), r.URL.Query().Get("conversation_uuid"))
+		if err == ErrNoHistory {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		if err != nil {
+			logger(lg).Printf("events handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(events)
+	}
+}
+
+// makeRecordEventHandler logs, persists and publishes the events of
+// the inbound calls, reporting to `watcher` the ones that have been completed.
+func makeRecordEventHandler(s Storage, opts RouterOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			return
+		}
+		ctx, span := startSpan(r.Context(), "webhook.record_event", trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+		defer func() {
+			r.Body.Close()
+			w.WriteHeader(http.StatusOK)
+		}()
+
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, r.Body); err != nil {
+			opts.logger().Printf("record event handler error: unable to read body: %v", err)
+			return
+		}
+		opts.logger().Printf("[EVENT] %v", buf.String())
+		publishEvent(ctx, s, opts.Events, buf.Bytes(), CallParams{}, opts.Log)
+
+		var event struct {
+			Status           string `json:"status"`
+			ConversationUUID string `json:"conversation_uuid"`
+			Duration         string `json:"duration"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &event); err != nil {
+			opts.logger().Printf("record event handler error: unable to decode event: %v", err)
+			return
+		}
+		if event.Status == "completed" {
+			opts.Watcher.Completed(event.ConversationUUID)
+			secs, _ := strconv.Atoi(event.Duration)
+			opts.Funnel.Completed(time.Duration(secs) * time.Second)
+		}
+	}
+}
+
+func makeStoreRecordingEventHandler(s Storage, c *Client, urlKey []byte, opts RouterOptions) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" {
 			return
 		}
 		defer r.Body.Close()
+		// The query carries the caller the recording is
+		// attributed to.
+		if err := VerifyQuery(urlKey, r.URL.Path, r.URL.Query()); err != nil {
+			opts.logger().Printf("store recording handler: %v", err)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		ctx, span := startSpan(r.Context(), "webhook.recording", trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
 
 		var content struct {
-			RecordingURL  string `json:"recording_url"`
-			RecordingUUID string `json:"recording_uuid"`
+			RecordingURL     string `json:"recording_url"`
+			RecordingUUID    string `json:"recording_uuid"`
+			ConversationUUID string `json:"conversation_uuid"`
+			StartTime        string `json:"start_time"`
+			EndTime          string `json:"end_time"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&content); err != nil {
-			log.Printf("store recording handler error: unable to decode recorinding event: %v", err)
+			opts.logger().Printf("store recording handler error: unable to decode recorinding event: %v", err)
+			failSpan(span, err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		span.SetAttributes(attrConversation.String(content.ConversationUUID), attrRecName.String(content.RecordingUUID))
+		// nexmo may deliver the same event more than once.
+		if !claimRec(ctx, s, opts.claims, content.RecordingUUID, opts.Log) {
+			opts.logger().Printf("store recording handler: %s already processed, skipping", content.RecordingUUID)
+			return
+		}
+		opts.Watcher.Hold(content.ConversationUUID)
+		opts.Funnel.Reach(StageRecording)
+		d, ok := recLengthOf(content.StartTime, content.EndTime)
+		if ok {
+			opts.lengths.Put(content.ConversationUUID, d)
+			if opts.Record.TooLong(d) {
+				opts.logger().Printf("store recording handler: %s is %v long, longer than %v: discarded", content.RecordingUUID, d, opts.Record.MaxLength)
+				if opts.Record.Confirm {
+					// The caller is told and offered to
+					// record again.
+					opts.Watcher.Done(content.ConversationUUID)
+				} else {
+					opts.Watcher.Failed(content.ConversationUUID)
+				}
+				return
+			}
+		}
+
+		// The download is retried for a while if nexmo is not
+		// ready to serve the recording: do not keep the webhook
+		// waiting, as nexmo would time out and send it again.
+		rec := pendingRecording{
+			URL:          content.RecordingURL,
+			Name:         content.RecordingUUID + "." + opts.recFormat(),
+			Conversation: content.ConversationUUID,
+			Channels:     RecChannelsFromQuery(r.URL.Query()),
+			Caller:       r.URL.Query().Get("caller"),
+			Duration:     d,
+		}
+		go storeRecording(trace.ContextWithSpan(context.Background(), span), s, c, opts, rec)
+	}
+}
+
+// pendingRecording is a recording that nexmo reported as
+// available, which still has to be downloaded.
+type pendingRecording struct {
+	URL          string
+	Name         string
+	Conversation string
+	Channels     []string
+	Caller       string
+	Duration     time.Duration
+}
+
+// storeRecording downloads `rec`, stores it and broadcasts it.
+// The broadcaster is notified through the watcher if the
+// recording cannot be stored.
+func storeRecording(ctx context.Context, s Storage, c *Client, opts RouterOptions, rec pendingRecording) {
+	ctx, span := startSpan(ctx, "recording.store", trace.WithAttributes(
+		attrConversation.String(rec.Conversation),
+		attrRecName.String(rec.Name),
+	))
+	defer span.End()
+
+	if opts.Hosted && c.hostsRec(rec.URL) {
+		hostRecording(ctx, s, c, opts, rec)
+		return
+	}
+
+	// Download mp3 file with the recording. It will
+	// later be used into the outbound calls.
+	data, err := c.DownloadRec(ctx, rec.URL, opts.download())
+	if err != nil {
+		opts.logger().Printf("store recording handler error: unable to download file: %v", err)
+		failSpan(span, err)
+		opts.Watcher.Failed(rec.Conversation)
+		return
+	}
+
+	meta := RecMeta{
+		Name:        rec.Name,
+		ContentType: ContentType(rec.Name),
+		CreatedAt:   time.Now(),
+		Channels:    rec.Channels,
+		Caller:      rec.Caller,
+		Duration:    rec.Duration,
+	}
+	if opts.TrimSilence {
+		data = trimmedRec(ctx, data, opts.recFormat(), opts.Log)
+	}
+	if opts.Transcoder != nil {
+		data = transcodedRec(ctx, opts.Transcoder, data, opts.audioTarget(), opts.Log)
+	}
+	if opts.Loudness != nil {
+		data = normalizedRec(ctx, opts.Loudness, data, opts.recFormat(), opts.Log)
+	}
+	if meta, err = s.WriteRec(ctx, bytes.NewReader(data), rec.Name, meta); err != nil {
+		opts.logger().Println(err)
+		failSpan(span, err)
+		opts.Watcher.Failed(rec.Conversation)
+		return
+	}
+	opts.Watcher.Done(rec.Conversation)
+	group, _ := opts.ivr.recorded(ctx, rec.Conversation, rec.Name)
+	opts.Transcripts.Enqueue(rec.Name)
+	c.audit(ctx, AuditRecordingStored, map[string]string{
+		"rec_name":          rec.Name,
+		"size":              strconv.FormatInt(meta.Size, 10),
+		"conversation_uuid": rec.Conversation,
+	})
+
+	if g := opts.Duplicates; g != nil {
+		if dup, ok := g.Check(rec.Name, NewFingerprint(ctx, data, opts.recFormat())); ok {
+			opts.logger().Printf("store recording handler: %s duplicates %s, recorded less than %v ago", rec.Name, dup, g.Window)
+			c.audit(ctx, AuditRecordingDuplicate, map[string]string{
+				"rec_name":  rec.Name,
+				"duplicate": dup,
+				"held":      strconv.FormatBool(g.Hold),
+			})
+			if g.Hold {
+				opts.logger().Printf("store recording handler: %s held, broadcast it from the dashboard if intended", rec.Name)
+				return
+			}
+		}
+	}
+
+	// Make outbound phone call that will play the saved
+	// recording, to the group of the IVR session, if any.
+	c.enqueue(ctx, s, broadcastJob{RecName: rec.Name, Group: group, By: rec.Caller})
+	opts.Funnel.Reach(StageConfirmation)
+}
+
+// trimmedRec returns the recording `data` without its leading
+// and trailing silence. If trimming fails, the recording is
+// returned as is.
+func trimmedRec(ctx context.Context, data []byte, format string, lg *log.Logger) []byte {
+	trimmed, err := TrimSilence(ctx, data, format)
+	if err != nil {
+		logger(lg).Printf("store recording handler: unable to trim silence: %v", err)
+		return data
+	}
+	logger(lg).Printf("store recording handler: trimmed %d bytes of silence", len(data)-len(trimmed))
+	return trimmed
+}
+
+func makePlayRecordingHandler(origin string, urlKey []byte, opts RouterOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := originOf(r.Context(), origin)
+		if err := VerifyQuery(urlKey, r.URL.Path, r.URL.Query()); err != nil {
+			opts.logger().Printf("play recording handler: %v", err)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		name := mux.Vars(r)["name"]
+		params := CallParamsFromQuery(r.URL.Query())
+		p := opts.prompts().For(params.Lang, params.Voice)
+		data := PromptData{
+			Lang:            params.Lang,
+			RecName:         name,
+			BroadcastID:     params.BroadcastID,
+			RecipientNumber: params.Number,
+			When:            SpokenTime{Time: params.Sent, Lang: params.Lang},
+		}
+
+		ncco := playNCCO(origin, p, data, opts.Loop, params.Then...)
+		if params.Hosted != "" {
+			ncco = withHosted(ncco, origin, urlKey, data.RecName, params.Hosted, opts.hostedTTL())
+		}
+		ncco = withKeypress(ncco, origin, urlKey, p, data, params, opts.Replays, opts.OptOut)
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(ncco)
+	}
+}
+
+// playNCCO returns the NCCO of the outbound calls, playing
+// `data.RecName`, followed by the recordings `then`, between
+// the Recorded and End prompts. Each recording is played
+// `loop` times in a row, once if zero.
+func playNCCO(origin string, p Prompts, data PromptData, loop int, then ...string) []map[string]interface{} {
+	ncco := []map[string]interface{}{p.TalkAction(p.Recorded, data)}
+	for _, v := range append([]string{data.RecName}, then...) {
+		stream := map[string]interface{}{
+			"action":    "stream",
+			"level":     p.Level,
+			"streamUrl": []string{origin + "/static/" + v},
+		}
+		// nexmo loops forever on zero.
+		if loop > 1 {
+			stream["loop"] = loop
+		}
+		ncco = append(ncco, stream)
+	}
+	return append(ncco, p.TalkAction(p.End, data))
+}
 
-		// Download mp3 file with the recording. It will
-		// later be used into the outbound calls.
-		resp, err := c.Get(context.Background(), content.RecordingURL)
+func makeQueueHandler(q *Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"broadcasts": q.Stats(CallLimiter),
+		})
+	}
+}
+
+func makeStatsHandler(f *Funnel) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"funnel": f.Stats(),
+		})
+	}
+}
+
+func makeTranscriptHandler(ts TranscriptStore, lg *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, err := ts.Transcript(r.Context(), mux.Vars(r)["name"])
+		switch {
+		case err == ErrTranscriptNotFound:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case err == ErrNoHistory:
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		case err != nil:
+			logger(lg).Printf("transcript handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(t)
+	}
+}
+
+// maxImportSize is the size of the largest address book
+// accepted by the import handler.
+const maxImportSize = 10 << 20
+
+func contactListFromRequest(r *http.Request) (ContactList, bool) {
+	switch list := ContactList(mux.Vars(r)["list"]); list {
+	case BroadcastList, Whitelist:
+		return list, true
+	default:
+		return "", false
+	}
+}
+
+// makeImportContactsHandler adds the contacts of the address book
+// in the request body to a list, replacing the ones with the same
+// number. The format query parameter selects the address book
+// format, see ImportContacts.
+func makeImportContactsHandler(s ContactsStore, lg *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, ok := contactListFromRequest(r)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body := http.MaxBytesReader(w, r.Body, maxImportSize)
+		contacts, invalid, err := ImportContacts(body, r.URL.Query().Get("format"))
 		if err != nil {
-			log.Printf("store recording handler error: unable to download file: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		defer resp.Body.Close()
 
-		recName := content.RecordingUUID + "." + recFormat
-		if _, err = s.WriteRec(resp.Body, recName); err != nil {
-			log.Println(err)
+		// replace=true drops the contacts missing from the
+		// imported ones.
+		add, verb := AppendContacts, "added to"
+		if r.URL.Query().Get("replace") == "true" {
+			add, verb = WriteContacts, "replacing"
+		}
+		if err := add(r.Context(), s, list, contacts); err != nil {
+			logger(lg).Printf("import contacts handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+		logger(lg).Printf("import contacts handler: %d contacts %s %s, %d discarded", len(contacts), verb, list, len(invalid))
 
-		// Make outbound phone call that will play the saved
-		// recording.
-		c.Call(s, recName)
+		errs := make([]map[string]interface{}, 0, len(invalid))
+		for _, v := range invalid {
+			errs = append(errs, map[string]interface{}{
+				"line":  v.Line,
+				"error": v.Err.Error(),
+			})
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"imported": len(contacts),
+			"invalid":  errs,
+		})
 	}
 }
 
-func makePlayRecordingHandler(origin string) http.HandlerFunc {
+// makeExportContactsHandler serves the contacts of a list, in the
+// format selected by the format query parameter.
+func makeExportContactsHandler(s ContactsStore, lg *log.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		name := mux.Vars(r)["name"]
+		list, ok := contactListFromRequest(r)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		format := r.URL.Query().Get("format")
+		contentType, ext := "text/csv", "csv"
+		switch format {
+		case ContactsCSV, "":
+		case ContactsVCard:
+			contentType, ext = "text/vcard", "vcf"
+		default:
+			http.Error(w, fmt.Sprintf("unknown contacts format %q", format), http.StatusBadRequest)
+			return
+		}
 
+		contacts, err := s.ListContacts(r.Context(), list)
+		if err != nil && err != ErrCorruptedContacts {
+			logger(lg).Printf("export contacts handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var buf bytes.Buffer
+		if err = ExportContacts(&buf, contacts, format); err != nil {
+			logger(lg).Printf("export contacts handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("content-type", contentType)
+		w.Header().Set("content-disposition", fmt.Sprintf("attachment; filename=\"%s.%s\"", list, ext))
+		w.Write(buf.Bytes())
+	}
+}
+
+// makeFailuresHandler serves the calls of a broadcast that
+// nexmo refused to create, with its responses.
+func makeFailuresHandler(a FailureArchive, lg *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		failures, err := a.Failures(r.Context(), id)
+		switch {
+		case err == ErrNoHistory:
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		case err != nil:
+			logger(lg).Printf("failures handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
 		w.Header().Set("content-type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode([]map[string]interface{}{
-			{
-				"action":    "talk",
-				"voiceName": "Carla",
-				"level":     0.5,
-				"text":      "Messaggio registrato",
-			},
-			{
-				"action":    "stream",
-				"level":     0.5,
-				"streamUrl": []string{origin + "/static/" + name},
-			},
-			{
-				"action":    "talk",
-				"voiceName": "Carla",
-				"level":     0.5,
-				"text":      "Fine messaggio",
-			},
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"failures": failures,
 		})
 	}
 }
 
-func loggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Do stuff here
-		log.Printf("[%s] %s", r.Method, r.RequestURI)
-		// Call the next handler, which can be another middleware in the chain, or the final handler.
-		next.ServeHTTP(w, r)
-	})
+// makeReportHandler serves the delivery report of a broadcast,
+// either as JSON or as a PDF document if `asPDF` is true.
+func makeReportHandler(h BroadcastHistory, asPDF bool, lg *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		b, err := h.Broadcast(r.Context(), id)
+		switch {
+		case err == ErrBroadcastNotFound:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case err == ErrNoHistory:
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		case err != nil:
+			logger(lg).Printf("report handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		attempts, err := h.Attempts(r.Context(), id)
+		if err != nil {
+			logger(lg).Printf("report handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		report := NewDeliveryReport(b, attempts)
+		if !asPDF {
+			w.Header().Set("content-type", "application/json")
+			json.NewEncoder(w).Encode(report)
+			return
+		}
+
+		var buf bytes.Buffer
+		if err = report.WritePDF(&buf); err != nil {
+			logger(lg).Printf("report handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("content-type", "application/pdf")
+		w.Header().Set("content-disposition", fmt.Sprintf("attachment; filename=\"broadcast-%d.pdf\"", id))
+		w.Write(buf.Bytes())
+	}
+}
+
+func makeLoggingMiddleware(lg *log.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Do stuff here
+			logger(lg).Printf("[%s] %s", r.Method, r.RequestURI)
+			// Call the next handler, which can be another middleware in the chain, or the final handler.
+			next.ServeHTTP(w, r)
+		})
+	}
 }
@@ -0,0 +1,141 @@
+package nexmo_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/nexmo/nexmotest"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestBroadcastFlow(t *testing.T) {
+	srv, c := newTestClient(t)
+
+	dir, err := ioutil.TempDir("", "voicebr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(dir+"/whitelist.csv", []byte("393330000000,Marco\n"), 0644)
+	ioutil.WriteFile(dir+"/contacts.csv", []byte("393331111111,Anna,,,,en\n393332222222,Luca\n"), 0644)
+	s := &storage.Local{RootDir: dir}
+
+	c.URLKey = []byte("secret")
+	r := nexmo.NewRouter(c, s, c.Origin, nexmo.RouterOptions{})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, nexmotest.AnswerWebhook("393330000000", "CON-1"))
+	if w.Code != 200 {
+		t.Fatalf("Wanted answer status 200, found %d", w.Code)
+	}
+
+	var answer []struct {
+		Action   string   `json:"action"`
+		EventURL []string `json:"eventUrl"`
+	}
+	if err = json.NewDecoder(w.Body).Decode(&answer); err != nil || len(answer) != 2 || answer[1].Action != "record" {
+		t.Fatalf("Unexpected answer NCCO: %+v, %v", answer, err)
+	}
+	eventURL, err := url.Parse(answer[1].EventURL[0])
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+
+	recUUID, recURL := srv.AddRecording([]byte("fake mp3"))
+	req := nexmotest.RecordingWebhookLength(recURL, recUUID, "CON-1", 12*time.Second)
+	req.URL.RawQuery = eventURL.RawQuery
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	// The broadcast runs asynchronously.
+	calls := srv.WaitCalls(2, waitTimeout)
+	if len(calls) != 2 {
+		t.Fatalf("Wanted 2 calls, found %d", len(calls))
+	}
+
+	rec, meta, err := s.OpenRec(context.TODO(), recUUID+".mp3")
+	if err != nil {
+		t.Fatalf("Unexpected open error: %v", err)
+	}
+	rec.Close()
+	if meta.Caller != "393330000000" || meta.Duration != 12*time.Second {
+		t.Fatalf("Wanted the caller and the length of the recording, found %+v", meta)
+	}
+
+	for _, v := range calls {
+		ncco, err := nexmotest.Answer(r, v)
+		if err != nil {
+			t.Fatalf("Unexpected answer error: %v", err)
+		}
+		if len(ncco) != 3 || ncco[1]["action"] != "stream" {
+			t.Fatalf("Unexpected NCCO: %v", ncco)
+		}
+		if v.To[0].Number == "393331111111" && ncco[0]["text"] != "Recorded message" {
+			t.Fatalf("Wanted an english prompt, found %v", ncco[0]["text"])
+		}
+	}
+
+	// The caller the recordings are attributed to is signed.
+	q := eventURL.Query()
+	q.Set("caller", "393339999998")
+	req = nexmotest.RecordingWebhook(recURL, "forged", "CON-2")
+	req.URL.RawQuery = q.Encode()
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Wanted status %d, found %d", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestNewRouter_nilClient(t *testing.T) {
+	r := nexmo.NewRouter(nil, &storage.Local{RootDir: t.TempDir()}, "https://example.com", nexmo.RouterOptions{})
+
+	// Without a client, there is no one to download the
+	// recordings with.
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, nexmotest.RecordingWebhook("https://api.nexmo.com/v1/files/rec", "rec", "CON-1"))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Wanted status %d, found %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestBroadcastFlow_lostRecording(t *testing.T) {
+	srv, c := newTestClient(t)
+
+	dir, err := ioutil.TempDir("", "voicebr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(dir+"/whitelist.csv", []byte("393330000000,Marco\n"), 0644)
+
+	notified := make(chan nexmo.Contact, 1)
+	r := nexmo.NewRouter(c, &storage.Local{RootDir: dir}, c.Origin, nexmo.RouterOptions{
+		Watcher: nexmo.NewRecordingWatcher(time.Minute, func(caller nexmo.Contact) {
+			notified <- caller
+		}),
+		DownloadWindow: 500 * time.Millisecond,
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), nexmotest.AnswerWebhook("393330000000", "CON-1"))
+	r.ServeHTTP(httptest.NewRecorder(), nexmotest.RecordingWebhook(srv.URL+"/v1/files/missing", "missing", "CON-1"))
+
+	select {
+	case caller := <-notified:
+		if caller.Number != "393330000000" {
+			t.Fatalf("Unexpected notification for %s", caller.Number)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Lost recording was not notified")
+	}
+	if len(srv.Calls()) != 0 {
+		t.Fatalf("Calls were created anyway")
+	}
+}
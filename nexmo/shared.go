@@ -0,0 +1,320 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultLeaseTTL is the lifetime of the leadership of a
+// Dispatcher without a LeaseTTL.
+const DefaultLeaseTTL = 15 * time.Second
+
+const (
+	dispatchQueue  = "voicebr:broadcasts"
+	dispatchLeader = "voicebr:dispatcher"
+	webhookKey     = "voicebr:webhook:"
+)
+
+// ErrNoJob is returned by SharedState.Pop when the queue
+// stayed empty.
+var ErrNoJob = errors.New("no job queued")
+
+// SharedState is the state the instances of a distributed
+// deployment share, e.g. the ones behind a load balancer.
+type SharedState interface {
+	// Claim sets `key` for `ttl`, returning false if it was
+	// set already.
+	Claim(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	// Push appends `job` to `queue`.
+	Push(ctx context.Context, queue string, job []byte) error
+	// Pop removes the oldest job of `queue`, waiting up to `wait`
+	// for one. Returns ErrNoJob if none was pushed meanwhile.
+	Pop(ctx context.Context, queue string, wait time.Duration) ([]byte, error)
+	// Lead makes `id` the leader of `name` for `ttl`, or extends
+	// its leadership, unless another instance leads already.
+	// Returns whether `id` leads.
+	Lead(ctx context.Context, name, id string, ttl time.Duration) (bool, error)
+	// Resign gives up the leadership of `name`, if `id` leads.
+	Resign(ctx context.Context, name, id string) error
+}
+
+// MemoryState is a SharedState for the instances of a single
+// process, e.g. the tests.
+type MemoryState struct {
+	mu      sync.Mutex
+	keys    map[string]time.Time
+	queues  map[string][][]byte
+	pushed  chan struct{}
+	leaders map[string]memoryLease
+}
+
+type memoryLease struct {
+	id      string
+	expires time.Time
+}
+
+func NewMemoryState() *MemoryState {
+	return &MemoryState{
+		keys:    make(map[string]time.Time),
+		queues:  make(map[string][][]byte),
+		pushed:  make(chan struct{}),
+		leaders: make(map[string]memoryLease),
+	}
+}
+
+func (m *MemoryState) Claim(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if exp, ok := m.keys[key]; ok && now.Before(exp) {
+		return false, nil
+	}
+	m.keys[key] = now.Add(ttl)
+	return true, nil
+}
+
+func (m *MemoryState) Push(ctx context.Context, queue string, job []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queues[queue] = append(m.queues[queue], job)
+	close(m.pushed)
+	m.pushed = make(chan struct{})
+	return nil
+}
+
+func (m *MemoryState) Pop(ctx context.Context, queue string, wait time.Duration) ([]byte, error) {
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	for {
+		m.mu.Lock()
+		if q := m.queues[queue]; len(q) > 0 {
+			m.queues[queue] = q[1:]
+			m.mu.Unlock()
+			return q[0], nil
+		}
+		pushed := m.pushed
+		m.mu.Unlock()
+		select {
+		case <-pushed:
+		case <-t.C:
+			return nil, ErrNoJob
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (m *MemoryState) Lead(ctx context.Context, name, id string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if l, ok := m.leaders[name]; ok && l.id != id && now.Before(l.expires) {
+		return false, nil
+	}
+	m.leaders[name] = memoryLease{id: id, expires: now.Add(ttl)}
+	return true, nil
+}
+
+func (m *MemoryState) Resign(ctx context.Context, name, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if l, ok := m.leaders[name]; ok && l.id == id {
+		delete(m.leaders, name)
+	}
+	return nil
+}
+
+// Dispatcher queues the broadcasts started by the webhooks of
+// any instance in State, running them on the instance leading
+// the dispatch, so that a deployment of many instances calls
+// each recipient once. The storage of the instances must be
+// shared too, e.g. in a cloud bucket.
+type Dispatcher struct {
+	State SharedState
+	// ID identifies the instance, its host name followed by a
+	// random suffix if empty.
+	ID string
+	// LeaseTTL is how long the leadership lasts unless
+	// renewed, DefaultLeaseTTL if zero.
+	LeaseTTL time.Duration
+
+	once sync.Once
+}
+
+func NewDispatcher(state SharedState, id string) *Dispatcher {
+	return &Dispatcher{State: state, ID: id}
+}
+
+func (d *Dispatcher) id() string {
+	d.once.Do(func() {
+		if d.ID != "" {
+			return
+		}
+		host, _ := os.Hostname()
+		d.ID = strings.TrimPrefix(host+"-"+uuid.NewString()[:8], "-")
+	})
+	return d.ID
+}
+
+func (d *Dispatcher) leaseTTL() time.Duration {
+	if d.LeaseTTL <= 0 {
+		return DefaultLeaseTTL
+	}
+	return d.LeaseTTL
+}
+
+// broadcastJob is a broadcast queued by a Dispatcher.
+type broadcastJob struct {
+	RecName string `json:"rec_name"`
+	// Group, if set, is the group of the IVR session
+	// recording RecName.
+	Group string `json:"group,omitempty"`
+	// By is who requested the broadcast, see
+	// Broadcast.RequestedBy.
+	By string `json:"by,omitempty"`
+	// HostedURL is where nexmo hosts RecName, see
+	// Broadcast.HostedURL.
+	HostedURL string `json:"hosted_url,omitempty"`
+	// Trace carries the span that queued the broadcast.
+	Trace map[string]string `json:"trace,omitempty"`
+}
+
+// enqueue runs `j` through the client's Dispatcher, if any,
+// or in the background otherwise, as a child of the span of
+// `ctx`.
+func (c *Client) enqueue(ctx context.Context, s ContactsProvider, j broadcastJob) {
+	j.Trace = traceCarrier(ctx)
+	if d := c.Dispatcher; d != nil {
+		b, _ := json.Marshal(j)
+		err := d.State.Push(context.Background(), dispatchQueue, b)
+		if err == nil {
+			c.logger().Printf("call: broadcast of %v queued", j.RecName)
+			return
+		}
+		// Calling from here beats not calling at all.
+		c.logger().Printf("call: unable to queue the broadcast of %v, starting it here: %v", j.RecName, err)
+	}
+	go c.runJob(s, j)
+}
+
+func (c *Client) runJob(p ContactsProvider, j broadcastJob) {
+	ctx := tracedContext(j.Trace)
+	var (
+		report *BroadcastReport
+		err    error
+	)
+	b := Broadcast{RecName: j.RecName, RequestedBy: j.By, HostedURL: j.HostedURL}
+	if j.Group == "" {
+		report, err = c.callList(ctx, p, b)
+	} else {
+		s, ok := p.(Storage)
+		if !ok {
+			c.logger().Printf("call error: unable to read the members of %q: not a storage", j.Group)
+			return
+		}
+		var contacts []Contact
+		if contacts, err = RecipientsOf(ctx, s, j.Group, c.Log); err != nil {
+			c.logger().Printf("call error: unable to read the members of %q: %v", j.Group, err)
+			return
+		}
+		report, err = c.CallBroadcast(ctx, s, b, contacts)
+	}
+	if err != nil {
+		c.logger().Printf("call error: %v", err)
+	}
+	if report == nil {
+		return
+	}
+	if j.Group == "" {
+		c.logger().Printf("call: broadcast of %v done, succeeded: %d, failed: %d", j.RecName, report.Succeeded, report.Failed)
+	} else {
+		c.logger().Printf("call: broadcast of %v to %q done, succeeded: %d, failed: %d", j.RecName, j.Group, report.Succeeded, report.Failed)
+	}
+}
+
+// RunDispatcher runs the broadcasts queued through the client's
+// Dispatcher while this instance leads it, reading the contacts
+// from `p`, until `ctx` is canceled. The instances that do not
+// lead check every a third of the lease whether they can.
+func (c *Client) RunDispatcher(ctx context.Context, p ContactsProvider) error {
+	d := c.Dispatcher
+	if d == nil {
+		return fmt.Errorf("dispatcher: missing dispatcher")
+	}
+	ttl := d.leaseTTL()
+	leading := false
+	defer func() {
+		if leading {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := d.State.Resign(ctx, dispatchLeader, d.id()); err != nil {
+				c.logger().Printf("dispatcher: unable to resign: %v", err)
+			}
+		}
+	}()
+	for ctx.Err() == nil {
+		ok, err := d.State.Lead(ctx, dispatchLeader, d.id(), ttl)
+		if err != nil && ctx.Err() == nil {
+			c.logger().Printf("dispatcher: unable to lead: %v", err)
+		}
+		if ok != leading {
+			if ok {
+				c.logger().Printf("dispatcher: %s leads the dispatch", d.id())
+			} else {
+				c.logger().Printf("dispatcher: %s no longer leads the dispatch", d.id())
+			}
+			leading = ok
+		}
+
+		renew := time.Now().Add(ttl / 3)
+		idle := !leading
+		for !idle && ctx.Err() == nil && time.Now().Before(renew) {
+			b, err := d.State.Pop(ctx, dispatchQueue, time.Until(renew))
+			switch {
+			case err == ErrNoJob || ctx.Err() != nil:
+				continue
+			case err != nil:
+				c.logger().Printf("dispatcher: unable to pop a broadcast: %v", err)
+				idle = true
+				continue
+			}
+			var j broadcastJob
+			if err := json.Unmarshal(b, &j); err != nil {
+				c.logger().Printf("dispatcher: dropping invalid broadcast %q: %v", b, err)
+				continue
+			}
+			go c.runJob(p, j)
+		}
+		if idle {
+			select {
+			case <-time.After(time.Until(renew)):
+			case <-ctx.Done():
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package nexmo_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+func TestDispatcher(t *testing.T) {
+	srv, a := newTestClient(t)
+	b, err := srv.NewClient("app", "393339999999", "https://voicebr.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := nexmo.NewMemoryState()
+	a.Dispatcher = &nexmo.Dispatcher{State: state, ID: "a", LeaseTTL: 300 * time.Millisecond}
+	b.Dispatcher = &nexmo.Dispatcher{State: state, ID: "b", LeaseTTL: 300 * time.Millisecond}
+
+	// a leads, the broadcast started by b's webhook runs there.
+	if ok, _ := state.Lead(context.TODO(), "voicebr:dispatcher", "a", time.Second); !ok {
+		t.Fatal("Wanted a to lead")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- a.RunDispatcher(ctx, contacts("393331111111,Anna\n")) }()
+	go func() { done <- b.RunDispatcher(ctx, contacts("393332222222,Luca\n")) }()
+
+	b.CallAsync(contacts(""), "a.mp3")
+	calls := srv.WaitCalls(1, waitTimeout)
+	if len(calls) != 1 || calls[0].To[0].Number != "393331111111" {
+		t.Fatalf("Wanted the leader to call its contacts, found %+v", calls)
+	}
+	cancel()
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatalf("Unexpected run error: %v", err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	if calls = srv.Calls(); len(calls) != 1 {
+		t.Fatalf("Wanted a single call, found %d", len(calls))
+	}
+}
+
+func TestReplayGuard_sharedState(t *testing.T) {
+	state := nexmo.NewMemoryState()
+	body := `{"uuid":"u1","conversation_uuid":"c1","status":"started","timestamp":"` + time.Now().UTC().Format(time.RFC3339Nano) + `"}`
+	for i, want := range []error{nil, nexmo.ErrReplayedWebhook} {
+		// Each instance has its own guard.
+		g := nexmo.NewReplayGuard(time.Minute, nil)
+		g.State = state
+		r := httptest.NewRequest("POST", "/record/voice/event", strings.NewReader(body))
+		if err := g.Check(r, []byte(body)); err != want {
+			t.Fatalf("%d: Wanted %v, found %v", i, want, err)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ErrInvalidSignature is returned when the signature of
+// a query string is missing or does not match.
+var ErrInvalidSignature = errors.New("invalid query signature")
+
+// signatureParam is the query parameter carrying the signature.
+const signatureParam = "sig"
+
+// CallParams are the per call parameters carried by the answer
+// and event URLs of the outbound calls, allowing the handlers to
+// tailor the NCCO to the recipient and to correlate the events.
+type CallParams struct {
+	BroadcastID int64
+	Number      string
+	Lang        string
+	Voice       string
+	// Sent is when the broadcast started.
+	Sent time.Time
+	// Then are the recordings played after the broadcast's one,
+	// merged into the call by a RecipientPacer.
+	Then []string
+	// Hosted is where nexmo hosts the broadcast's recording,
+	// see Broadcast.HostedURL.
+	Hosted string
+}
+
+// Values encodes the non empty parameters.
+func (p CallParams) Values() url.Values {
+	q := url.Values{}
+	if p.BroadcastID != 0 {
+		q.Set("broadcast_id", strconv.FormatInt(p.BroadcastID, 10))
+	}
+	if p.Number != "" {
+		q.Set("to", p.Number)
+	}
+	if p.Lang != "" {
+		q.Set("lang", p.Lang)
+	}
+	if p.Voice != "" {
+		q.Set("voice", p.Voice)
+	}
+	if !p.Sent.IsZero() {
+		q.Set("sent", strconv.FormatInt(p.Sent.Unix(), 10))
+	}
+	for _, v := range p.Then {
+		q.Add("then", v)
+	}
+	if p.Hosted != "" {
+		q.Set("hosted", p.Hosted)
+	}
+	return q
+}
+
+// CallParamsFromQuery decodes the parameters encoded by Values.
+func CallParamsFromQuery(q url.Values) CallParams {
+	id, _ := strconv.ParseInt(q.Get("broadcast_id"), 10, 64)
+	p := CallParams{
+		BroadcastID: id,
+		Number:      q.Get("to"),
+		Lang:        q.Get("lang"),
+		Voice:       q.Get("voice"),
+		Then:        q["then"],
+		Hosted:      q.Get("hosted"),
+	}
+	if sent, err := strconv.ParseInt(q.Get("sent"), 10, 64); err == nil {
+		p.Sent = time.Unix(sent, 0)
+	}
+	return p
+}
+
+func signature(key []byte, path string, q url.Values) string {
+	unsigned := url.Values{}
+	for k, v := range q {
+		if k != signatureParam {
+			unsigned[k] = v
+		}
+	}
+	mac := hmac.New(sha256.New, key)
+	// Encode sorts the parameters by key.
+	mac.Write([]byte(path + "?" + unsigned.Encode()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignQuery encodes `q`, adding an HMAC-SHA256 signature of both
+// `path` and `q` made with `key`. Without a key, `q` is not signed.
+func SignQuery(key []byte, path string, q url.Values) string {
+	if len(key) == 0 {
+		return q.Encode()
+	}
+	signed := url.Values{}
+	for k, v := range q {
+		signed[k] = v
+	}
+	signed.Set(signatureParam, signature(key, path, q))
+	return signed.Encode()
+}
+
+// VerifyQuery checks the signature added by SignQuery. Without
+// a key, every query is considered valid.
+func VerifyQuery(key []byte, path string, q url.Values) error {
+	if len(key) == 0 {
+		return nil
+	}
+	sig, err := hex.DecodeString(q.Get(signatureParam))
+	if err != nil || len(sig) == 0 {
+		return ErrInvalidSignature
+	}
+	want, _ := hex.DecodeString(signature(key, path, q))
+	if !hmac.Equal(sig, want) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
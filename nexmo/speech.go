@@ -0,0 +1,169 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"fmt"
+	"time"
+)
+
+// timeWords contains what is needed to speak a date in a language.
+type timeWords struct {
+	today, yesterday, tomorrow string
+	// at introduces the time, e.g. "at" in "today at 10:30".
+	at       string
+	weekdays [7]string
+	months   [12]string
+	// date formats weekday, day and month.
+	date func(weekday string, day int, month string) string
+	// second, minute and their plurals name the units of
+	// a duration, whose parts are joined by and.
+	second, seconds, minute, minutes, and string
+}
+
+var speechWords = map[string]timeWords{
+	"it": {
+		today: "oggi", yesterday: "ieri", tomorrow: "domani", at: "alle",
+		weekdays: [7]string{"domenica", "lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato"},
+		months:   [12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+		second:   "secondo", seconds: "secondi", minute: "minuto", minutes: "minuti", and: "e",
+		date: func(w string, d int, m string) string {
+			return fmt.Sprintf("%s %d %s", w, d, m)
+		},
+	},
+	"en": {
+		today: "today", yesterday: "yesterday", tomorrow: "tomorrow", at: "at",
+		weekdays: [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+		months:   [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		second:   "second", seconds: "seconds", minute: "minute", minutes: "minutes", and: "and",
+		date: func(w string, d int, m string) string {
+			return fmt.Sprintf("%s, %s %d", w, m, d)
+		},
+	},
+	"de": {
+		today: "heute", yesterday: "gestern", tomorrow: "morgen", at: "um",
+		weekdays: [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+		months:   [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		second:   "Sekunde", seconds: "Sekunden", minute: "Minute", minutes: "Minuten", and: "und",
+		date: func(w string, d int, m string) string {
+			return fmt.Sprintf("%s, %d. %s", w, d, m)
+		},
+	},
+	"fr": {
+		today: "aujourd'hui", yesterday: "hier", tomorrow: "demain", at: "à",
+		weekdays: [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		months:   [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		second:   "seconde", seconds: "secondes", minute: "minute", minutes: "minutes", and: "et",
+		date: func(w string, d int, m string) string {
+			return fmt.Sprintf("%s %d %s", w, d, m)
+		},
+	},
+	"es": {
+		today: "hoy", yesterday: "ayer", tomorrow: "mañana", at: "a las",
+		weekdays: [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		months:   [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		second:   "segundo", seconds: "segundos", minute: "minuto", minutes: "minutos", and: "y",
+		date: func(w string, d int, m string) string {
+			return fmt.Sprintf("%s %d de %s", w, d, m)
+		},
+	},
+}
+
+// SpeakTime renders `t` as a phrase that sounds natural when
+// read by a text to speech engine in `lang`, relative to `now`:
+// "oggi alle 10:30", "yesterday at 9:05", "Montag, 3. März um
+// 18:00". Unknown languages fall back to DefaultLang. The year
+// is only spoken when it differs from `now`'s.
+func SpeakTime(t time.Time, lang string, now time.Time) string {
+	words, ok := speechWords[baseLang(lang)]
+	if !ok {
+		words = speechWords[DefaultLang]
+	}
+	t = t.In(now.Location())
+
+	clock := fmt.Sprintf("%d:%02d", t.Hour(), t.Minute())
+	day := func(v time.Time) time.Time {
+		y, m, d := v.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, v.Location())
+	}
+	switch days := int(day(t).Sub(day(now)).Hours() / 24); days {
+	case 0:
+		return words.today + " " + words.at + " " + clock
+	case -1:
+		return words.yesterday + " " + words.at + " " + clock
+	case 1:
+		return words.tomorrow + " " + words.at + " " + clock
+	}
+
+	date := words.date(words.weekdays[t.Weekday()], t.Day(), words.months[t.Month()-1])
+	if t.Year() != now.Year() {
+		date = fmt.Sprintf("%s %d", date, t.Year())
+	}
+	return date + " " + words.at + " " + clock
+}
+
+// SpokenTime is a time that templates print using SpeakTime,
+// e.g. "messaggio registrato {{.When}}".
+type SpokenTime struct {
+	Time time.Time
+	Lang string
+}
+
+func (t SpokenTime) String() string {
+	if t.Time.IsZero() {
+		return ""
+	}
+	return SpeakTime(t.Time, t.Lang, time.Now())
+}
+
+// SpeakDuration renders `d`, rounded to the second, as a phrase
+// in `lang`: "42 secondi", "1 minute and 5 seconds". Unknown
+// languages fall back to DefaultLang.
+func SpeakDuration(d time.Duration, lang string) string {
+	words, ok := speechWords[baseLang(lang)]
+	if !ok {
+		words = speechWords[DefaultLang]
+	}
+	secs := int(d.Round(time.Second) / time.Second)
+	unit := func(n int, one, many string) string {
+		if n == 1 {
+			return "1 " + one
+		}
+		return fmt.Sprintf("%d %s", n, many)
+	}
+
+	m, sec := secs/60, secs%60
+	switch {
+	case m == 0:
+		return unit(sec, words.second, words.seconds)
+	case sec == 0:
+		return unit(m, words.minute, words.minutes)
+	default:
+		return unit(m, words.minute, words.minutes) + " " + words.and + " " + unit(sec, words.second, words.seconds)
+	}
+}
+
+// SpokenDuration is a duration that templates print using
+// SpeakDuration, e.g. "il tuo messaggio dura {{.Length}}".
+type SpokenDuration struct {
+	Duration time.Duration
+	Lang     string
+}
+
+func (d SpokenDuration) String() string {
+	return SpeakDuration(d.Duration, d.Lang)
+}
@@ -0,0 +1,160 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrRecNotFound     = errors.New("recording not found")
+	ErrContactNotFound = errors.New("contact not found")
+)
+
+// RecMeta describes a stored recording.
+type RecMeta struct {
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Channels labels the channels of split recordings,
+	// e.g. "caller" and "callee". Empty for mono ones.
+	Channels []string `json:"channels,omitempty"`
+	// Caller is the number of the broadcaster who recorded
+	// it, and Duration its length, when known.
+	Caller   string        `json:"caller,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+	// Broadcasts are the ids of the broadcasts that played
+	// it, when the store is a RecUsage.
+	Broadcasts []int64 `json:"broadcasts,omitempty"`
+}
+
+// RecUsage is implemented by the recording stores that keep
+// track of the broadcasts playing each recording.
+type RecUsage interface {
+	// UsedRec records that broadcast `id` played `name`.
+	UsedRec(ctx context.Context, name string, id int64) error
+}
+
+// ContactList identifies one of the contact lists
+// managed by a Storage.
+type ContactList string
+
+const (
+	BroadcastList ContactList = "broadcast"
+	Whitelist     ContactList = "whitelist"
+)
+
+// RecStore is implemented by storage backends that are
+// able to persist recordings.
+type RecStore interface {
+	// WriteRec stores the contents of `src` under `name`. The
+	// returned metadata reflects what has actually been stored,
+	// i.e. its size is filled in by the backend.
+	WriteRec(ctx context.Context, src io.Reader, name string, meta RecMeta) (RecMeta, error)
+	// OpenRec returns a reader over the recording `name`. Returns
+	// ErrRecNotFound if no such recording exists.
+	OpenRec(ctx context.Context, name string) (io.ReadCloser, RecMeta, error)
+	ListRecs(ctx context.Context) ([]RecMeta, error)
+	DeleteRec(ctx context.Context, name string) error
+	// RecFileHandler serves the recordings over HTTP.
+	RecFileHandler() http.Handler
+}
+
+// ContactsStore is implemented by storage backends that are
+// able to manage contact lists, other than just reading them.
+type ContactsStore interface {
+	ContactsProvider
+	ListContacts(ctx context.Context, list ContactList) ([]Contact, error)
+	// AddContact adds `c` to `list`, replacing any contact
+	// with the same number.
+	AddContact(ctx context.Context, list ContactList, c Contact) error
+	// RemoveContact removes the contact identified by `number`
+	// from `list`. Returns ErrContactNotFound if it is not there.
+	RemoveContact(ctx context.Context, list ContactList, number string) error
+}
+
+// ContactsWriter is implemented by the contacts stores able to
+// update many contacts of a list at once, atomically.
+type ContactsWriter interface {
+	// AppendContacts adds `contacts` to `list`, replacing
+	// the contacts with the same numbers.
+	AppendContacts(ctx context.Context, list ContactList, contacts []Contact) error
+	// WriteContacts replaces the contents of `list`
+	// with `contacts`.
+	WriteContacts(ctx context.Context, list ContactList, contacts []Contact) error
+}
+
+// AppendContacts adds `contacts` to `list` of `s`, at once if
+// `s` is a ContactsWriter, one by one otherwise.
+func AppendContacts(ctx context.Context, s ContactsStore, list ContactList, contacts []Contact) error {
+	if w, ok := s.(ContactsWriter); ok {
+		return w.AppendContacts(ctx, list, contacts)
+	}
+	for _, v := range contacts {
+		if err := s.AddContact(ctx, list, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteContacts replaces the contents of `list` of `s` with
+// `contacts`, at once if `s` is a ContactsWriter. Otherwise the
+// contacts missing from `contacts` are removed one by one, and
+// the others added.
+func WriteContacts(ctx context.Context, s ContactsStore, list ContactList, contacts []Contact) error {
+	if w, ok := s.(ContactsWriter); ok {
+		return w.WriteContacts(ctx, list, contacts)
+	}
+	old, err := s.ListContacts(ctx, list)
+	if err != nil && err != ErrCorruptedContacts {
+		return err
+	}
+	keep := make(map[string]bool, len(contacts))
+	for _, v := range contacts {
+		keep[v.Number] = true
+	}
+	for _, v := range old {
+		if keep[v.Number] {
+			continue
+		}
+		if err = s.RemoveContact(ctx, list, v.Number); err != nil && err != ErrContactNotFound {
+			return err
+		}
+	}
+	return AppendContacts(ctx, s, list, contacts)
+}
+
+// GroupStore is implemented by storage backends that organize
+// the broadcast list contacts in groups.
+type GroupStore interface {
+	// GroupMembers returns the broadcast list contacts
+	// that belong to `group`.
+	GroupMembers(ctx context.Context, group string) ([]Contact, error)
+}
+
+// Storage is what the router needs to persist recordings
+// and to know who is allowed to broadcast, and to whom.
+type Storage interface {
+	RecStore
+	ContactsStore
+}
@@ -0,0 +1,253 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/jecoz/voicebr/phone"
+)
+
+// SubjectRecords are the call logs a SubjectStore keeps about
+// a phone number.
+type SubjectRecords struct {
+	// Groups are the contact groups the number belongs to.
+	Groups []string `json:"groups"`
+	// Broadcasts are the ids of the broadcasts that had
+	// the number among their recipients.
+	Broadcasts []int64       `json:"broadcasts"`
+	Attempts   []CallAttempt `json:"attempts"`
+	Failures   []CallFailure `json:"failures"`
+	Events     []CallEvent   `json:"events"`
+}
+
+// SubjectStore is implemented by the storages able to find and
+// erase the records tied to a phone number, so that its owner,
+// the data subject, can obtain or remove them.
+type SubjectStore interface {
+	SubjectRecords(ctx context.Context, number string) (SubjectRecords, error)
+	// EraseSubjectRecords removes what SubjectRecords
+	// returns for `number`.
+	EraseSubjectRecords(ctx context.Context, number string) error
+}
+
+// SubjectContact is an entry of a contact list, with the
+// fields that Contact keeps out of its JSON encoding.
+type SubjectContact struct {
+	List   ContactList `json:"list"`
+	Number string      `json:"number"`
+	Name   string      `json:"name"`
+	Lang   string      `json:"lang,omitempty"`
+	Voice  string      `json:"voice,omitempty"`
+	TZ     string      `json:"tz,omitempty"`
+}
+
+// SubjectData is what a Storage keeps about a phone number.
+type SubjectData struct {
+	Number   string           `json:"number"`
+	Contacts []SubjectContact `json:"contacts"`
+	// Recordings are the ones the number recorded, and
+	// Transcripts their transcripts.
+	Recordings   []RecMeta     `json:"recordings"`
+	Transcripts  []Transcript  `json:"transcripts"`
+	Suppressions []Suppression `json:"suppressions"`
+	// Records is nil when the storage is not a SubjectStore.
+	Records *SubjectRecords `json:"records,omitempty"`
+}
+
+// CollectSubject returns what `s` stores about `number`, looking
+// into the optional interfaces it implements too.
+func CollectSubject(ctx context.Context, s Storage, number string) (SubjectData, error) {
+	d := SubjectData{
+		Number:       number,
+		Contacts:     []SubjectContact{},
+		Recordings:   []RecMeta{},
+		Transcripts:  []Transcript{},
+		Suppressions: []Suppression{},
+	}
+	for _, list := range []ContactList{BroadcastList, Whitelist} {
+		contacts, err := s.ListContacts(ctx, list)
+		if err != nil && err != ErrCorruptedContacts {
+			return d, fmt.Errorf("collect subject: %v", err)
+		}
+		for _, v := range contacts {
+			if v.Number == number {
+				d.Contacts = append(d.Contacts, SubjectContact{
+					List:   list,
+					Number: v.Number,
+					Name:   v.Name,
+					Lang:   v.Lang,
+					Voice:  v.Voice,
+					TZ:     v.TZ,
+				})
+			}
+		}
+	}
+
+	recs, err := s.ListRecs(ctx)
+	if err != nil {
+		return d, fmt.Errorf("collect subject: %v", err)
+	}
+	ts, _ := s.(TranscriptStore)
+	for _, v := range recs {
+		if v.Caller != number {
+			continue
+		}
+		d.Recordings = append(d.Recordings, v)
+		if ts == nil {
+			continue
+		}
+		switch t, err := ts.Transcript(ctx, v.Name); {
+		case err == ErrTranscriptNotFound || err == ErrNoHistory:
+		case err != nil:
+			return d, fmt.Errorf("collect subject: %v", err)
+		default:
+			d.Transcripts = append(d.Transcripts, t)
+		}
+	}
+
+	if l, ok := s.(SuppressionList); ok {
+		list, err := l.Suppressions(ctx)
+		if err != nil && err != ErrNoHistory {
+			return d, fmt.Errorf("collect subject: %v", err)
+		}
+		for _, v := range list {
+			if v.Number == number {
+				d.Suppressions = append(d.Suppressions, v)
+			}
+		}
+	}
+
+	if ss, ok := s.(SubjectStore); ok {
+		switch records, err := ss.SubjectRecords(ctx, number); {
+		case err == ErrNoHistory:
+		case err != nil:
+			return d, fmt.Errorf("collect subject: %v", err)
+		default:
+			d.Records = &records
+		}
+	}
+	return d, nil
+}
+
+// EraseSubject removes from `s` the data `d`, as returned by
+// CollectSubject, apart from the suppressions: they are kept so
+// that the number is not called again.
+func EraseSubject(ctx context.Context, s Storage, d SubjectData) error {
+	for _, v := range d.Contacts {
+		if err := s.RemoveContact(ctx, v.List, v.Number); err != nil && err != ErrContactNotFound {
+			return fmt.Errorf("erase subject: %v", err)
+		}
+	}
+	// The stores remove the transcripts together with
+	// their recordings.
+	for _, v := range d.Recordings {
+		if err := s.DeleteRec(ctx, v.Name); err != nil && err != ErrRecNotFound {
+			return fmt.Errorf("erase subject: %v", err)
+		}
+	}
+	if d.Records == nil {
+		return nil
+	}
+	if err := s.(SubjectStore).EraseSubjectRecords(ctx, d.Number); err != nil && err != ErrNoHistory {
+		return fmt.Errorf("erase subject: %v", err)
+	}
+	return nil
+}
+
+// subjectHash identifies `number` in the audit log, which
+// outlives the erasure of its data.
+func subjectHash(number string) string {
+	sum := sha256.Sum256([]byte(number))
+	return hex.EncodeToString(sum[:])
+}
+
+// makeExportSubjectHandler returns what is stored about the
+// number in the path.
+func makeExportSubjectHandler(s Storage, lg *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		number, err := phone.Normalize(mux.Vars(r)["number"], CountryCode)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		d, err := CollectSubject(r.Context(), s, number)
+		if err != nil {
+			logger(lg).Printf("export subject handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", number+".json"))
+		json.NewEncoder(w).Encode(d)
+	}
+}
+
+// makeEraseSubjectHandler removes what is stored about the number
+// in the path, responding with what was removed and with what was
+// retained, i.e. its suppressions. With the `dry_run` query
+// parameter set to true nothing is removed. The audit log, being
+// append only, keeps its entries: the erasure is audited with the
+// hash of the number.
+func makeEraseSubjectHandler(s Storage, c *Client, cache *RecCache, lg *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		number, err := phone.Normalize(mux.Vars(r)["number"], CountryCode)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+		d, err := CollectSubject(r.Context(), s, number)
+		if err != nil {
+			logger(lg).Printf("erase subject handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !dryRun {
+			for _, v := range d.Recordings {
+				cache.Forget(v.Name)
+			}
+			if err = EraseSubject(r.Context(), s, d); err != nil {
+				logger(lg).Printf("erase subject handler: %v", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if c != nil {
+				c.audit(r.Context(), AuditSubjectErased, map[string]string{
+					"subject":    subjectHash(number),
+					"contacts":   strconv.Itoa(len(d.Contacts)),
+					"recordings": strconv.Itoa(len(d.Recordings)),
+				})
+			}
+		}
+		retained := map[string]interface{}{"suppressions": d.Suppressions}
+		d.Suppressions = []Suppression{}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"dry_run":  dryRun,
+			"removed":  d,
+			"retained": retained,
+		})
+	}
+}
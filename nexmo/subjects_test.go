@@ -0,0 +1,127 @@
+package nexmo_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestSubjects(t *testing.T) {
+	_, c := newTestClient(t)
+	dir := t.TempDir()
+	db, err := storage.NewSQLite(dir + "/voicebr.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s := storage.Combined{RecStore: &storage.Local{RootDir: dir}, ContactsStore: db}
+	ctx := context.TODO()
+
+	anna, luca := nexmo.NewContact("393331111111", "Anna"), nexmo.NewContact("393332222222", "Luca")
+	for _, v := range []nexmo.ContactList{nexmo.BroadcastList, nexmo.Whitelist} {
+		if err = s.AddContact(ctx, v, anna); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = s.AddContact(ctx, nexmo.BroadcastList, luca); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.WriteRec(ctx, strings.NewReader("audio"), "anna.mp3", nexmo.RecMeta{ContentType: "audio/mpeg", Caller: anna.Number}); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.WriteTranscript(ctx, nexmo.Transcript{RecName: "anna.mp3", Text: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if report := c.CallContacts(ctx, s, "anna.mp3", []nexmo.Contact{anna, luca}); report.Succeeded != 2 {
+		t.Fatalf("Unexpected failures: %+v", report.Results)
+	}
+	for _, v := range []string{anna.Number, luca.Number} {
+		if err = s.LogEvent(ctx, nexmo.CallEvent{UUID: v, Status: "completed", To: v, Timestamp: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = s.Suppress(ctx, nexmo.Suppression{Number: anna.Number, Reason: nexmo.SuppressedAdmin}); err != nil {
+		t.Fatal(err)
+	}
+	r := nexmo.NewRouter(c, s, c.Origin, nexmo.RouterOptions{})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/admin/subjects/+39%20333%201111111/export", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Wanted status 200, found %d", w.Code)
+	}
+	var d nexmo.SubjectData
+	if err = json.NewDecoder(w.Body).Decode(&d); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if d.Number != anna.Number || len(d.Contacts) != 2 || d.Contacts[0].Name != "Anna" {
+		t.Fatalf("Wanted Anna's contacts, found %+v", d.Contacts)
+	}
+	if len(d.Recordings) != 1 || len(d.Transcripts) != 1 || d.Transcripts[0].Text != "hello" {
+		t.Fatalf("Wanted Anna's recording and its transcript, found %+v, %+v", d.Recordings, d.Transcripts)
+	}
+	if len(d.Suppressions) != 1 || d.Records == nil {
+		t.Fatalf("Wanted Anna's suppression and records, found %+v", d)
+	}
+	if rec := d.Records; len(rec.Broadcasts) != 1 || len(rec.Attempts) == 0 || len(rec.Events) != 1 {
+		t.Fatalf("Wanted Anna's call logs, found %+v", rec)
+	}
+
+	var resp struct {
+		DryRun   bool              `json:"dry_run"`
+		Removed  nexmo.SubjectData `json:"removed"`
+		Retained struct {
+			Suppressions []nexmo.Suppression `json:"suppressions"`
+		} `json:"retained"`
+	}
+	erase := func(query string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("DELETE", "/admin/subjects/393331111111"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Wanted status 200, found %d", w.Code)
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Unexpected decode error: %v", err)
+		}
+		if len(resp.Removed.Contacts) != 2 || len(resp.Removed.Recordings) != 1 || len(resp.Removed.Suppressions) != 0 {
+			t.Fatalf("Unexpected removed data: %+v", resp.Removed)
+		}
+		if len(resp.Retained.Suppressions) != 1 {
+			t.Fatalf("Wanted the suppression to be retained, found %+v", resp.Retained)
+		}
+	}
+
+	erase("?dry_run=true")
+	if !resp.DryRun {
+		t.Fatalf("Wanted a dry run")
+	}
+	if after, err := nexmo.CollectSubject(ctx, s, anna.Number); err != nil || len(after.Contacts) != 2 || len(after.Recordings) != 1 {
+		t.Fatalf("Wanted the dry run to leave the data untouched, found %+v, %v", after, err)
+	}
+
+	erase("")
+	after, err := nexmo.CollectSubject(ctx, s, anna.Number)
+	if err != nil {
+		t.Fatalf("Unexpected collect error: %v", err)
+	}
+	if len(after.Contacts) != 0 || len(after.Recordings) != 0 || len(after.Transcripts) != 0 {
+		t.Fatalf("Wanted Anna's data to be erased, found %+v", after)
+	}
+	if rec := after.Records; len(rec.Broadcasts) != 0 || len(rec.Attempts) != 0 || len(rec.Events) != 0 {
+		t.Fatalf("Wanted Anna's call logs to be erased, found %+v", rec)
+	}
+	if len(after.Suppressions) != 1 {
+		t.Fatalf("Wanted Anna to stay suppressed, found %+v", after.Suppressions)
+	}
+	if other, err := nexmo.CollectSubject(ctx, s, luca.Number); err != nil || len(other.Contacts) != 1 || len(other.Records.Events) != 1 {
+		t.Fatalf("Wanted Luca's data to be kept, found %+v, %v", other, err)
+	}
+}
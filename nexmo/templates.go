@@ -0,0 +1,346 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// templateCodePath is where the code of the template chosen
+// by the broadcaster is reported.
+const templateCodePath = "/record/voice/template"
+
+// ErrTemplateNotFound is returned when no template has the
+// requested name or code.
+var ErrTemplateNotFound = errors.New("template not found")
+
+var (
+	templateNameRx = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	templateCodeRx = regexp.MustCompile(`^[0-9]{1,6}$`)
+)
+
+// Template is a stored recording saved under a friendly name,
+// e.g. "evacuation-drill", to be broadcast again without
+// recording it anew.
+type Template struct {
+	Name    string `json:"name"`
+	RecName string `json:"recording"`
+	// Code, if set, lets the broadcasters choose the template
+	// over the phone, typing it after pressing 3 in the menu.
+	Code      string    `json:"code,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (t Template) validate() error {
+	if !templateNameRx.MatchString(t.Name) {
+		return fmt.Errorf("invalid template name %q: only lowercase letters, digits, '-' and '_' are allowed", t.Name)
+	}
+	if t.RecName == "" {
+		return fmt.Errorf("template %s: recording is required", t.Name)
+	}
+	if t.Code != "" && !templateCodeRx.MatchString(t.Code) {
+		return fmt.Errorf("template %s: code must be made of 1 to 6 digits", t.Name)
+	}
+	return nil
+}
+
+// TemplateStore is implemented by the storage backends that
+// persist the templates.
+type TemplateStore interface {
+	// SaveTemplate stores `t`, replacing the template with
+	// the same name.
+	SaveTemplate(ctx context.Context, t Template) error
+	Templates(ctx context.Context) ([]Template, error)
+	// DeleteTemplate returns ErrTemplateNotFound if there
+	// is no template named `name`.
+	DeleteTemplate(ctx context.Context, name string) error
+}
+
+// FindTemplate returns the template of `ts` matching `match`,
+// or ErrTemplateNotFound.
+func FindTemplate(ctx context.Context, ts TemplateStore, match func(Template) bool) (Template, error) {
+	list, err := ts.Templates(ctx)
+	if err != nil {
+		return Template{}, err
+	}
+	for _, v := range list {
+		if match(v) {
+			return v, nil
+		}
+	}
+	return Template{}, ErrTemplateNotFound
+}
+
+func makeTemplatesHandler(ts TemplateStore, lg *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := ts.Templates(r.Context())
+		switch {
+		case err == ErrNoHistory:
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		case err != nil:
+			logger(lg).Printf("templates handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"templates": list,
+		})
+	}
+}
+
+// makeSaveTemplateHandler saves the stored recording of the
+// body's `recording` field under the name in the path. Codes
+// cannot be shared by templates.
+func makeSaveTemplateHandler(s Storage, ts TemplateStore, lg *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var t Template
+		if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		t.Name = mux.Vars(r)["name"]
+		t.CreatedAt = time.Now()
+		if err := t.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		rec, _, err := s.OpenRec(r.Context(), t.RecName)
+		switch {
+		case err == ErrRecNotFound:
+			http.Error(w, "recording not found", http.StatusUnprocessableEntity)
+			return
+		case err != nil:
+			logger(lg).Printf("save template handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rec.Close()
+
+		if t.Code != "" {
+			other, err := FindTemplate(r.Context(), ts, func(v Template) bool {
+				return v.Code == t.Code && v.Name != t.Name
+			})
+			switch {
+			case err == nil:
+				http.Error(w, fmt.Sprintf("code %s is used by template %s", t.Code, other.Name), http.StatusConflict)
+				return
+			case err != ErrTemplateNotFound && err != ErrNoHistory:
+				logger(lg).Printf("save template handler: %v", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+
+		switch err := ts.SaveTemplate(r.Context(), t); {
+		case err == ErrNoHistory:
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		case err != nil:
+			logger(lg).Printf("save template handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(t)
+	}
+}
+
+func makeDeleteTemplateHandler(ts TemplateStore, lg *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch err := ts.DeleteTemplate(r.Context(), mux.Vars(r)["name"]); {
+		case err == ErrTemplateNotFound:
+			w.WriteHeader(http.StatusNotFound)
+		case err == ErrNoHistory:
+			w.WriteHeader(http.StatusNotImplemented)
+		case err != nil:
+			logger(lg).Printf("delete template handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+// ResolveRecName returns the recording of the template `name`, if
+// `s` is a TemplateStore that has it, or `name` itself otherwise.
+func ResolveRecName(ctx context.Context, s Storage, name string) (string, error) {
+	ts, ok := s.(TemplateStore)
+	if !ok {
+		return name, nil
+	}
+	t, err := FindTemplate(ctx, ts, func(v Template) bool { return v.Name == name })
+	switch {
+	case err == nil:
+		return t.RecName, nil
+	case err == ErrTemplateNotFound || err == ErrNoHistory:
+		return name, nil
+	default:
+		return "", err
+	}
+}
+
+// makeStartBroadcastHandler broadcasts the body's `recording`,
+// either the name of a template or of a stored recording, to the
+// members of `group`, or to the broadcast list if empty, showing
+// them `from` if set, with `priority`.
+func makeStartBroadcastHandler(s Storage, c *Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var req struct {
+			Recording string `json:"recording"`
+			Group     string `json:"group"`
+			From      string `json:"from"`
+			Priority  string `json:"priority"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Recording == "" {
+			http.Error(w, "recording is required", http.StatusBadRequest)
+			return
+		}
+		if err := ValidatePriority(req.Priority); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		by := "anonymous"
+		if p, ok := PrincipalFromContext(r.Context()); ok {
+			if !p.CanBroadcastTo(req.Group) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			by = p.Name
+		}
+		if req.From != "" && !c.Owns(req.From) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprintf(w, "%q is not owned by the application\n", req.From)
+			return
+		}
+
+		name, err := ResolveRecName(r.Context(), s, req.Recording)
+		if err != nil {
+			c.logger().Printf("start broadcast handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rebroadcast(w, r, s, c, Broadcast{RecName: name, From: req.From, Priority: req.Priority, RequestedBy: by}, req.Group, by)
+	}
+}
+
+// templateNCCO returns the NCCO asking `caller` the code of
+// the template to broadcast.
+func templateNCCO(origin string, urlKey []byte, caller Contact, opts RouterOptions) []map[string]interface{} {
+	p := opts.prompts().For(caller.Lang, caller.Voice)
+	ask := p.TalkAction(p.TemplateCode, PromptData{
+		CallerName:   caller.Name,
+		CallerNumber: caller.Number,
+		Lang:         caller.Lang,
+	})
+	ask["bargeIn"] = true
+	params := CallParams{Number: caller.Number, Lang: caller.Lang, Voice: caller.Voice}
+	return []map[string]interface{}{
+		ask,
+		{
+			"action":   "input",
+			"type":     []string{"dtmf"},
+			"dtmf":     map[string]interface{}{"maxDigits": 6, "submitOnHash": true, "timeOut": 5},
+			"eventUrl": []string{origin + templateCodePath + "?" + SignQuery(urlKey, templateCodePath, params.Values())},
+		},
+	}
+}
+
+// makeTemplateCodeHandler answers the input action of
+// templateNCCO, broadcasting the template with the typed code
+// to the broadcast list.
+func makeTemplateCodeHandler(s Storage, c *Client, urlKey []byte, opts RouterOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			return
+		}
+		defer r.Body.Close()
+		if err := VerifyQuery(urlKey, r.URL.Path, r.URL.Query()); err != nil {
+			opts.logger().Printf("template code handler: %v", err)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		var event struct {
+			ConversationUUID string `json:"conversation_uuid"`
+			DTMF             struct {
+				Digits string `json:"digits"`
+			} `json:"dtmf"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			opts.logger().Printf("template code handler error: unable to decode event: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		params := CallParamsFromQuery(r.URL.Query())
+		caller, err := whitelisted(s, params.Number, opts.Log)
+		if err != nil {
+			opts.logger().Printf("template code handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if caller == nil {
+			opts.logger().Printf("template code handler: number %s cannot broadcast anymore", params.Number)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		// No recording is coming.
+		opts.Watcher.Done(event.ConversationUUID)
+		p := opts.prompts().For(caller.Lang, caller.Voice)
+		data := PromptData{
+			CallerName:   caller.Name,
+			CallerNumber: caller.Number,
+			Lang:         caller.Lang,
+		}
+		ncco := []map[string]interface{}{p.TalkAction(p.TemplateUnknown, data)}
+		if ts, ok := s.(TemplateStore); ok && event.DTMF.Digits != "" {
+			t, err := FindTemplate(r.Context(), ts, func(v Template) bool { return v.Code == event.DTMF.Digits })
+			switch {
+			case err == nil:
+				opts.logger().Printf("template code handler: %s is broadcasting template %s", caller.Number, t.Name)
+				c.enqueue(context.Background(), s, broadcastJob{RecName: t.RecName, By: caller.Number})
+				data.RecName = t.Name
+				ncco = []map[string]interface{}{p.TalkAction(p.TemplateSent, data)}
+			case err != ErrTemplateNotFound:
+				opts.logger().Printf("template code handler: %v", err)
+			}
+		}
+
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(ncco)
+	}
+}
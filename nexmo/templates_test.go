@@ -0,0 +1,89 @@
+package nexmo_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/nexmo/nexmotest"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestTemplates(t *testing.T) {
+	srv, c := newTestClient(t)
+
+	dir := t.TempDir()
+	ioutil.WriteFile(dir+"/whitelist.csv", []byte("393330000000,Marco,,,,en\n"), 0644)
+	ioutil.WriteFile(dir+"/contacts.csv", []byte("393331111111,Anna\n393332222222,Luca\n"), 0644)
+	s := &storage.Local{RootDir: dir}
+	if _, err := s.WriteRec(context.TODO(), strings.NewReader("fake mp3"), "drill.mp3", nexmo.RecMeta{}); err != nil {
+		t.Fatalf("Unexpected write error: %v", err)
+	}
+
+	r := nexmo.NewRouter(c, s, c.Origin, nexmo.RouterOptions{Conference: true, Templates: true})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("PUT", "/admin/templates/evacuation-drill", strings.NewReader(`{"recording": "missing.mp3"}`)))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Wanted %d, found %d", http.StatusUnprocessableEntity, w.Code)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("PUT", "/admin/templates/evacuation-drill", strings.NewReader(`{"recording": "drill.mp3", "code": "42"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected save template status: %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("PUT", "/admin/templates/other", strings.NewReader(`{"recording": "drill.mp3", "code": "42"}`)))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("Wanted %d, found %d", http.StatusConflict, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/admin/broadcasts", strings.NewReader(`{"recording": "evacuation-drill"}`)))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Unexpected broadcast status: %d", w.Code)
+	}
+	calls := srv.WaitCalls(2, waitTimeout)
+	if len(calls) != 2 || !strings.Contains(calls[0].AnswerURL[0], "/play/recording/drill.mp3") {
+		t.Fatalf("Wanted the template to be broadcast, found %+v", calls)
+	}
+
+	// The broadcasters choose it over the phone too.
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, nexmotest.AnswerWebhook("393330000000", "CON-1"))
+	var ncco []map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&ncco); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if len(ncco) != 3 || ncco[2]["action"] != "input" {
+		t.Fatalf("Wanted the menu to offer the templates, found %v", ncco)
+	}
+	u, _ := url.Parse(ncco[2]["eventUrl"].([]interface{})[0].(string))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, nexmotest.InputWebhook(u.RequestURI(), "CON-1", "3"))
+	if err := json.NewDecoder(w.Body).Decode(&ncco); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if len(ncco) != 2 || ncco[1]["action"] != "input" {
+		t.Fatalf("Wanted to be asked the code, found %v", ncco)
+	}
+	u, _ = url.Parse(ncco[1]["eventUrl"].([]interface{})[0].(string))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, nexmotest.InputWebhook(u.RequestURI(), "CON-1", "42"))
+	if err := json.NewDecoder(w.Body).Decode(&ncco); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if want := "Broadcasting evacuation-drill"; len(ncco) != 1 || ncco[0]["text"] != want {
+		t.Fatalf("Wanted %q, found %v", want, ncco)
+	}
+	calls = srv.WaitCalls(4, waitTimeout)
+	if len(calls) != 4 {
+		t.Fatalf("Wanted the template to be broadcast again, found %d calls", len(calls))
+	}
+}
@@ -0,0 +1,327 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+var ErrTokenNotFound = errors.New("token not found")
+
+// Actions a Scope may grant.
+const (
+	ActionBroadcast  = "broadcast"
+	ActionRecordings = "recordings"
+	ActionContacts   = "contacts"
+	ActionReports    = "reports"
+	ActionTokens     = "tokens"
+	// ActionAdmin cannot be granted: only the principals
+	// without a scope, i.e. static keys and users, have it.
+	ActionAdmin = "admin"
+)
+
+var scopeActions = []string{ActionBroadcast, ActionRecordings, ActionContacts, ActionReports, ActionTokens}
+
+// tokenPrefix marks the secrets of the API tokens, so that
+// they are not confused with the other bearer credentials.
+const tokenPrefix = "vbr_"
+
+// Scope restricts what a Principal may do.
+type Scope struct {
+	Actions []string `json:"actions"`
+	// Groups restricts the broadcasts to these groups of
+	// the broadcast list. Empty allows the whole list.
+	Groups []string `json:"groups,omitempty"`
+}
+
+// Validate returns an error if `s` grants unknown actions, or
+// restricts to some groups while granting ActionContacts, which
+// edits the whole lists.
+func (s Scope) Validate() error {
+	for _, v := range s.Actions {
+		if !contains(scopeActions, v) {
+			return fmt.Errorf("scope: unknown action %q", v)
+		}
+	}
+	if len(s.Groups) > 0 && contains(s.Actions, ActionContacts) {
+		return fmt.Errorf("scope: %s cannot be restricted to groups", ActionContacts)
+	}
+	return nil
+}
+
+// Within reports whether `s` grants nothing more than `o`.
+// A nil `o` grants everything.
+func (s Scope) Within(o *Scope) bool {
+	if o == nil {
+		return true
+	}
+	for _, v := range s.Actions {
+		if !contains(o.Actions, v) {
+			return false
+		}
+	}
+	if len(o.Groups) == 0 {
+		return true
+	}
+	if len(s.Groups) == 0 {
+		return false
+	}
+	for _, v := range s.Groups {
+		if !contains(o.Groups, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Can reports whether `p` may perform `action`.
+func (p Principal) Can(action string) bool {
+	if p.Scope == nil {
+		return true
+	}
+	return action != ActionAdmin && contains(p.Scope.Actions, action)
+}
+
+// CanBroadcastTo reports whether `p` may broadcast to `group`,
+// the empty string standing for the whole broadcast list.
+func (p Principal) CanBroadcastTo(group string) bool {
+	if !p.Can(ActionBroadcast) {
+		return false
+	}
+	if p.Scope == nil || len(p.Scope.Groups) == 0 {
+		return true
+	}
+	return contains(p.Scope.Groups, group)
+}
+
+// Token is an API token with a limited scope, which allows
+// to delegate part of the administration.
+type Token struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Scope     Scope      `json:"scope"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	// Hash identifies the token, see HashToken. The
+	// secret itself is never stored.
+	Hash string `json:"-"`
+}
+
+// NewToken returns a token named `name` granting `scope`,
+// together with its secret.
+func NewToken(name string, scope Scope) (Token, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return Token{}, "", fmt.Errorf("unable to generate token: %v", err)
+	}
+	secret := tokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return Token{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Scope:     scope,
+		CreatedAt: time.Now(),
+		Hash:      HashToken(secret),
+	}, secret, nil
+}
+
+// HashToken returns the hex encoded SHA-256 of `secret`. The
+// secrets are random, hence salting them is not needed.
+func HashToken(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
+
+// TokenStore is implemented by the storage backends that are
+// able to persist the API tokens.
+type TokenStore interface {
+	SaveToken(ctx context.Context, t Token) error
+	// TokenByHash returns ErrTokenNotFound if no token
+	// hashes to `hash`.
+	TokenByHash(ctx context.Context, hash string) (Token, error)
+	Tokens(ctx context.Context) ([]Token, error)
+	// RevokeToken returns ErrTokenNotFound if `id` is unknown.
+	RevokeToken(ctx context.Context, id string, at time.Time) error
+}
+
+// TokenAuth authenticates the requests carrying the secret of
+// a token of Store that has not been revoked, in the same way
+// as APIKeys.
+type TokenAuth struct {
+	Store TokenStore
+}
+
+func (a TokenAuth) Authenticate(r *http.Request) (Principal, error) {
+	secret := credential(r)
+	if !strings.HasPrefix(secret, tokenPrefix) {
+		return Principal{}, ErrUnauthorized
+	}
+	t, err := a.Store.TokenByHash(r.Context(), HashToken(secret))
+	switch {
+	case err == ErrTokenNotFound || err == ErrNoHistory:
+		return Principal{}, ErrUnauthorized
+	case err != nil:
+		return Principal{}, err
+	case t.RevokedAt != nil:
+		return Principal{}, ErrUnauthorized
+	}
+	return Principal{Name: t.Name, Method: AuthToken, Scope: &t.Scope}, nil
+}
+
+// RequireAction only lets through the requests whose Principal
+// may perform `action`. Requests without a Principal, i.e. when
+// authentication is disabled, are let through.
+func RequireAction(action string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p, ok := PrincipalFromContext(r.Context()); ok && !p.Can(action) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tokenRequest is the body of the token creation requests.
+type tokenRequest struct {
+	Name  string `json:"name"`
+	Scope Scope  `json:"scope"`
+}
+
+// makeCreateTokenHandler creates a token, responding with its
+// secret. Principals may only create tokens within their scope.
+func makeCreateTokenHandler(ts TokenStore, lg *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req tokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Name == "" || len(req.Scope.Actions) == 0 {
+			http.Error(w, "name and scope actions are required", http.StatusBadRequest)
+			return
+		}
+		if err := req.Scope.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if p, ok := PrincipalFromContext(r.Context()); ok && !req.Scope.Within(p.Scope) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		t, secret, err := NewToken(req.Name, req.Scope)
+		if err != nil {
+			logger(lg).Printf("create token handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		switch err = ts.SaveToken(r.Context(), t); {
+		case err == ErrNoHistory:
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		case err != nil:
+			logger(lg).Printf("create token handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":  t,
+			"secret": secret,
+		})
+	}
+}
+
+func makeListTokensHandler(ts TokenStore, lg *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokens, err := ts.Tokens(r.Context())
+		switch {
+		case err == ErrNoHistory:
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		case err != nil:
+			logger(lg).Printf("list tokens handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"tokens": tokens,
+		})
+	}
+}
+
+// makeRevokeTokenHandler revokes a token. Principals may only
+// revoke the tokens within their scope.
+func makeRevokeTokenHandler(ts TokenStore, lg *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		if p, ok := PrincipalFromContext(r.Context()); ok && p.Scope != nil {
+			tokens, err := ts.Tokens(r.Context())
+			switch {
+			case err == ErrNoHistory:
+				w.WriteHeader(http.StatusNotImplemented)
+				return
+			case err != nil:
+				logger(lg).Printf("revoke token handler: %v", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			for _, t := range tokens {
+				if t.ID == id && !t.Scope.Within(p.Scope) {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+			}
+		}
+
+		switch err := ts.RevokeToken(r.Context(), id, time.Now()); {
+		case err == ErrTokenNotFound:
+			w.WriteHeader(http.StatusNotFound)
+		case err == ErrNoHistory:
+			w.WriteHeader(http.StatusNotImplemented)
+		case err != nil:
+			logger(lg).Printf("revoke token handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package nexmo_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestTokens(t *testing.T) {
+	dir := t.TempDir()
+	db, err := storage.NewSQLite(filepath.Join(dir, "voicebr.db"))
+	if err != nil {
+		t.Fatalf("Unexpected open error: %v", err)
+	}
+	defer db.Close()
+	s := storage.Combined{RecStore: &storage.Local{RootDir: dir}, ContactsStore: db}
+	r := nexmo.NewRouter(nil, s, "https://example.com", nexmo.RouterOptions{
+		Auth: nexmo.AnyAuthenticator{nexmo.APIKeys{"root": "admin"}, nexmo.TokenAuth{Store: s}},
+	})
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/admin/tokens", "root", `{"name": "auditor", "scope": {"actions": ["reports", "tokens"]}}`)
+	if w.Code != 201 {
+		t.Fatalf("Wanted status 201, found %d", w.Code)
+	}
+	var created struct {
+		Token  nexmo.Token `json:"token"`
+		Secret string      `json:"secret"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+
+	for _, v := range []struct {
+		method, path, body string
+		code               int
+	}{
+		{"GET", "/admin/broadcasts", "", 200},
+		{"GET", "/admin/recordings", "", 403},
+		// Tokens may not grant more than their creator.
+		{"POST", "/admin/tokens", `{"name": "x", "scope": {"actions": ["broadcast"]}}`, 403},
+		{"POST", "/admin/tokens", `{"name": "x", "scope": {"actions": ["reports"]}}`, 201},
+	} {
+		if w := do(v.method, v.path, created.Secret, v.body); w.Code != v.code {
+			t.Fatalf("%s %s: wanted status %d, found %d", v.method, v.path, v.code, w.Code)
+		}
+	}
+
+	if w := do("DELETE", "/admin/tokens/"+created.Token.ID, "root", ""); w.Code != 204 {
+		t.Fatalf("Wanted status 204, found %d", w.Code)
+	}
+	if w := do("GET", "/admin/broadcasts", created.Secret, ""); w.Code != 401 {
+		t.Fatalf("Wanted status 401 after revocation, found %d", w.Code)
+	}
+}
+
+func TestScope_within(t *testing.T) {
+	parent := &nexmo.Scope{Actions: []string{"broadcast", "reports"}, Groups: []string{"volunteers"}}
+	tt := []struct {
+		scope  nexmo.Scope
+		within bool
+	}{
+		{nexmo.Scope{Actions: []string{"broadcast"}, Groups: []string{"volunteers"}}, true},
+		{nexmo.Scope{Actions: []string{"broadcast"}}, false},
+		{nexmo.Scope{Actions: []string{"tokens"}, Groups: []string{"volunteers"}}, false},
+		{nexmo.Scope{Actions: []string{"reports"}, Groups: []string{"staff"}}, false},
+	}
+	for i, v := range tt {
+		if found := v.scope.Within(parent); found != v.within {
+			t.Fatalf("%d: wanted %v, found %v", i, v.within, found)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the name of the tracer of the spans covering the
+// lifecycle of the broadcasts: the answer webhook, the recording
+// event and download, the broadcast and each of its calls, and
+// their events. They are exported by the global TracerProvider,
+// see otel.SetTracerProvider.
+const TracerName = "github.com/jecoz/voicebr/nexmo"
+
+// The attributes linking the spans of a broadcast.
+const (
+	attrBroadcastID  = attribute.Key("voicebr.broadcast_id")
+	attrConversation = attribute.Key("voicebr.conversation_uuid")
+	attrRecName      = attribute.Key("voicebr.rec_name")
+	attrStatus       = attribute.Key("voicebr.call_status")
+)
+
+// startSpan starts the span `name`, child of the one of `ctx`,
+// if any.
+func startSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.GetTracerProvider().Tracer(TracerName).Start(ctx, name, opts...)
+}
+
+// failSpan marks `span` as failed because of `err`.
+func failSpan(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// endSpan ends `span`, marking it as failed if `err` is not nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		failSpan(span, err)
+	}
+	span.End()
+}
+
+// traceCarrier returns the context of the span of `ctx`, to be
+// carried along with the jobs leaving the process.
+func traceCarrier(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// tracedContext returns a context carrying the span encoded in
+// `carrier` by traceCarrier, if any.
+func tracedContext(carrier map[string]string) context.Context {
+	return propagation.TraceContext{}.Extract(context.Background(), propagation.MapCarrier(carrier))
+}
@@ -0,0 +1,87 @@
+package nexmo_test
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/nexmo/nexmotest"
+	"github.com/jecoz/voicebr/storage"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestBroadcastFlow_tracing(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(prev)
+
+	srv, c := newTestClient(t)
+	dir := t.TempDir()
+	ioutil.WriteFile(dir+"/whitelist.csv", []byte("393330000000,Marco\n"), 0644)
+	ioutil.WriteFile(dir+"/contacts.csv", []byte("393331111111,Anna\n393332222222,Luca\n"), 0644)
+	r := nexmo.NewRouter(c, &storage.Local{RootDir: dir}, c.Origin, nexmo.RouterOptions{})
+
+	r.ServeHTTP(httptest.NewRecorder(), nexmotest.AnswerWebhook("393330000000", "CON-1"))
+	recUUID, recURL := srv.AddRecording([]byte("fake mp3"))
+	r.ServeHTTP(httptest.NewRecorder(), nexmotest.RecordingWebhook(recURL, recUUID, "CON-1"))
+
+	calls := srv.WaitCalls(2, waitTimeout)
+	if len(calls) != 2 {
+		t.Fatalf("Wanted 2 calls, found %d", len(calls))
+	}
+	u, err := url.Parse(calls[0].EventURL[0])
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+	r.ServeHTTP(httptest.NewRecorder(), nexmotest.EventWebhook(u.RequestURI(), calls[0].ConversationUUID, "completed", 10*time.Second))
+
+	byName := func(name string) []sdktrace.ReadOnlySpan {
+		var spans []sdktrace.ReadOnlySpan
+		for _, v := range rec.Ended() {
+			if v.Name() == name {
+				spans = append(spans, v)
+			}
+		}
+		return spans
+	}
+	waitFor(t, "the call spans", func() bool {
+		return len(byName("call.create")) == 2 && len(byName("broadcast")) == 1
+	})
+
+	for _, v := range []string{"webhook.answer", "webhook.recording", "recording.store", "recording.download", "webhook.call_event"} {
+		if n := len(byName(v)); n != 1 {
+			t.Fatalf("Wanted 1 %s span, found %d", v, n)
+		}
+	}
+	trace := byName("webhook.recording")[0].SpanContext().TraceID()
+	for _, v := range append(byName("broadcast"), byName("call.create")...) {
+		if id := v.SpanContext().TraceID(); id != trace {
+			t.Fatalf("Wanted %s to be part of trace %s, found %s", v.Name(), trace, id)
+		}
+	}
+
+	conversations := map[string]bool{}
+	for _, v := range byName("call.create") {
+		for _, a := range v.Attributes() {
+			if a.Key == "voicebr.conversation_uuid" {
+				conversations[a.Value.AsString()] = true
+			}
+		}
+	}
+	var found string
+	for _, a := range byName("webhook.call_event")[0].Attributes() {
+		if a.Key == "voicebr.conversation_uuid" {
+			found = a.Value.AsString()
+		}
+	}
+	if !conversations[found] {
+		t.Fatalf("Wanted the event to carry the conversation of a call %v, found %q", conversations, found)
+	}
+}
@@ -0,0 +1,118 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+)
+
+// ErrTranscodeUnsupported is returned when a recording has to be
+// transcoded but the transcoder is not available.
+var ErrTranscodeUnsupported = errors.New("transcoding requires ffmpeg")
+
+// AudioTarget is the audio the recordings are normalized to before
+// they are played. The zero values keep the corresponding property
+// of the recording.
+type AudioTarget struct {
+	// Format is one of the recording formats.
+	Format string
+	// SampleRate is in Hz, e.g. 16000.
+	SampleRate int
+	// Channels is either 1 or 2.
+	Channels int
+}
+
+// Transcoder converts recordings, encoded in format `from`, to the
+// audio described by `to`.
+type Transcoder interface {
+	Transcode(ctx context.Context, data []byte, from string, to AudioTarget) ([]byte, error)
+}
+
+// FFmpeg is a Transcoder that runs ffmpeg.
+type FFmpeg struct {
+	// Path is the ffmpeg executable, looked up in PATH
+	// if empty.
+	Path string
+}
+
+func (f FFmpeg) path() string {
+	if f.Path == "" {
+		return "ffmpeg"
+	}
+	return f.Path
+}
+
+// Transcode implements Transcoder, returning ErrTranscodeUnsupported
+// if ffmpeg is not installed.
+func (f FFmpeg) Transcode(ctx context.Context, data []byte, from string, to AudioTarget) ([]byte, error) {
+	if to.Format == "" {
+		to.Format = from
+	}
+	if err := ValidateRecFormat(to.Format); err != nil {
+		return nil, fmt.Errorf("transcode: %v", err)
+	}
+	bin, err := exec.LookPath(f.path())
+	if err != nil {
+		return nil, ErrTranscodeUnsupported
+	}
+
+	args := []string{"-f", from, "-i", "pipe:0"}
+	if to.SampleRate > 0 {
+		args = append(args, "-ar", strconv.Itoa(to.SampleRate))
+	}
+	if to.Channels > 0 {
+		args = append(args, "-ac", strconv.Itoa(to.Channels))
+	}
+	args = append(args, "-f", to.Format, "pipe:1")
+	out, err := runFFmpeg(ctx, bin, data, args...)
+	if err != nil {
+		return nil, fmt.Errorf("transcode: %v", err)
+	}
+	return out, nil
+}
+
+// runFFmpeg runs the ffmpeg executable `bin` with `args`, feeding
+// it `data`, and returns its output.
+func runFFmpeg(ctx context.Context, bin string, data []byte, args ...string) ([]byte, error) {
+	args = append([]string{"-hide_banner", "-loglevel", "error"}, args...)
+	cmd := exec.CommandContext(ctx, bin, args...)
+	cmd.Stdin = bytes.NewReader(data)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg: %v: %s", err, stderr.String())
+	}
+	return out.Bytes(), nil
+}
+
+// transcodedRec returns the recording `data` transcoded by `t` to
+// `to`. If transcoding fails, the recording is returned as is.
+func transcodedRec(ctx context.Context, t Transcoder, data []byte, to AudioTarget, lg *log.Logger) []byte {
+	transcoded, err := t.Transcode(ctx, data, to.Format, to)
+	if err != nil {
+		logger(lg).Printf("store recording handler: unable to transcode: %v", err)
+		return data
+	}
+	return transcoded
+}
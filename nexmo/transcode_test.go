@@ -0,0 +1,63 @@
+package nexmo_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+)
+
+// transcoder is a nexmo.Transcoder recording its targets, which
+// turns every recording into a wav file.
+type transcoder []nexmo.AudioTarget
+
+func (t *transcoder) Transcode(ctx context.Context, data []byte, from string, to nexmo.AudioTarget) ([]byte, error) {
+	*t = append(*t, to)
+	return wav(make([]int16, 8)), nil
+}
+
+func TestUploadRecHandler_transcode(t *testing.T) {
+	_, c := newTestClient(t)
+	s := &storage.Local{RootDir: t.TempDir()}
+	tr := &transcoder{}
+	r := nexmo.NewRouter(c, s, c.Origin, nexmo.RouterOptions{
+		RecFormat:  nexmo.FormatWAV,
+		Transcoder: tr,
+		Audio:      nexmo.AudioTarget{SampleRate: 16000, Channels: 1},
+	})
+
+	body, ct := uploadForm(t, "message.mp3", []byte("ID3 fake mp3"), nil)
+	req := httptest.NewRequest("POST", "/admin/recordings", body)
+	req.Header.Set("content-type", ct)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != 201 {
+		t.Fatalf("Wanted status 201, found %d: %s", w.Code, w.Body.String())
+	}
+	want := nexmo.AudioTarget{Format: nexmo.FormatWAV, SampleRate: 16000, Channels: 1}
+	if len(*tr) != 1 || (*tr)[0] != want {
+		t.Fatalf("Wanted the recording to be transcoded to %+v, found %+v", want, *tr)
+	}
+
+	// The extension follows the format.
+	rec, _, err := s.OpenRec(context.TODO(), "message.wav")
+	if err != nil {
+		t.Fatalf("Unexpected open error: %v", err)
+	}
+	defer rec.Close()
+	data, _ := ioutil.ReadAll(rec)
+	if !bytes.Equal(data, wav(make([]int16, 8))) {
+		t.Fatalf("Wanted the transcoded recording to be stored")
+	}
+}
+
+func TestFFmpeg_unsupported(t *testing.T) {
+	f := nexmo.FFmpeg{Path: "/nonexistent/ffmpeg"}
+	if _, err := f.Transcode(context.TODO(), []byte("ID3"), nexmo.FormatMP3, nexmo.AudioTarget{}); err != nexmo.ErrTranscodeUnsupported {
+		t.Fatalf("Wanted %v, found %v", nexmo.ErrTranscodeUnsupported, err)
+	}
+}
@@ -0,0 +1,130 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"time"
+)
+
+var ErrTranscriptNotFound = errors.New("transcript not found")
+
+// Transcript is the text spoken in a recording.
+type Transcript struct {
+	RecName string `json:"rec_name"`
+	// Lang is the language of the recording, if known.
+	Lang      string    `json:"lang,omitempty"`
+	Text      string    `json:"text"`
+	Engine    string    `json:"engine"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Transcriber turns speech into text.
+type Transcriber interface {
+	// Transcribe returns the transcript of `audio`, encoded in
+	// `format`. RecName and CreatedAt are filled by the caller.
+	Transcribe(ctx context.Context, audio []byte, format string) (Transcript, error)
+}
+
+// TranscriptStore is implemented by the storages that are able
+// to keep the transcripts of the recordings.
+type TranscriptStore interface {
+	WriteTranscript(ctx context.Context, t Transcript) error
+	// Transcript returns ErrTranscriptNotFound if `recName`
+	// has not been transcribed.
+	Transcript(ctx context.Context, recName string) (Transcript, error)
+}
+
+// TranscriptWorker transcribes the recordings passed to Enqueue,
+// one at a time, storing their transcripts.
+type TranscriptWorker struct {
+	Transcriber Transcriber
+	Recs        RecStore
+	Store       TranscriptStore
+	Log         *log.Logger
+
+	queue chan string
+}
+
+// NewTranscriptWorker returns a worker that holds at most `size`
+// recordings waiting to be transcribed. Call Run to start it.
+func NewTranscriptWorker(t Transcriber, recs RecStore, store TranscriptStore, size int) *TranscriptWorker {
+	return &TranscriptWorker{
+		Transcriber: t,
+		Recs:        recs,
+		Store:       store,
+		queue:       make(chan string, size),
+	}
+}
+
+// Enqueue schedules the transcription of `recName`, reporting
+// whether it was accepted: it is not if the queue is full.
+func (w *TranscriptWorker) Enqueue(recName string) bool {
+	if w == nil {
+		return false
+	}
+	select {
+	case w.queue <- recName:
+		return true
+	default:
+		logger(w.Log).Printf("transcript worker: queue full, dropping %s", recName)
+		return false
+	}
+}
+
+// Run transcribes the queued recordings until `ctx` is canceled.
+func (w *TranscriptWorker) Run(ctx context.Context) {
+	for {
+		select {
+		case name := <-w.queue:
+			if err := w.transcribe(ctx, name); err != nil {
+				logger(w.Log).Printf("transcript worker: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (w *TranscriptWorker) transcribe(ctx context.Context, name string) error {
+	rec, meta, err := w.Recs.OpenRec(ctx, name)
+	if err != nil {
+		return fmt.Errorf("unable to open %s: %v", name, err)
+	}
+	audio, err := ioutil.ReadAll(rec)
+	rec.Close()
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %v", name, err)
+	}
+
+	start := time.Now()
+	t, err := w.Transcriber.Transcribe(ctx, audio, RecFormat(meta.Name))
+	if err != nil {
+		return fmt.Errorf("unable to transcribe %s: %v", name, err)
+	}
+	t.RecName = name
+	t.CreatedAt = time.Now()
+	if err = w.Store.WriteTranscript(ctx, t); err != nil {
+		return err
+	}
+	logger(w.Log).Printf("transcript worker: %s transcribed in %v", name, time.Since(start))
+	return nil
+}
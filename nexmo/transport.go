@@ -0,0 +1,120 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultRequestTimeout bounds the requests of the clients
+// whose transport timeout is not set, recording downloads
+// included.
+const DefaultRequestTimeout = 2 * time.Minute
+
+// TransportOptions configures the HTTP client talking to the
+// API and downloading the recordings. Zero values keep the
+// defaults of http.DefaultTransport.
+type TransportOptions struct {
+	Dial DialOptions
+	// Proxy is the URL of the proxy the requests go through,
+	// e.g. "http://proxy.example.com:3128". When empty, the
+	// HTTPS_PROXY and NO_PROXY environment variables are used.
+	Proxy string
+	// CAFile is a PEM bundle of certificate authorities
+	// trusted in addition to the system ones, e.g. the one of
+	// a TLS inspecting proxy.
+	CAFile string
+	// Timeout bounds each request, response body included,
+	// DefaultRequestTimeout if zero.
+	Timeout               time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	// MaxIdleConns and MaxIdleConnsPerHost size the pool of
+	// the keep-alive connections, which are closed once idle
+	// for IdleConnTimeout.
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+}
+
+// NewTransport returns the transport configured by `o`.
+func NewTransport(o TransportOptions) (*http.Transport, error) {
+	d, err := NewDialer(o.Dial)
+	if err != nil {
+		return nil, err
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = d.DialContext
+	if o.Proxy != "" {
+		u, err := url.Parse(o.Proxy)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("transport: %q is not a valid proxy URL", o.Proxy)
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+	if o.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		b, err := ioutil.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("transport: unable to read CA bundle: %v", err)
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("transport: %s contains no certificate", o.CAFile)
+		}
+		t.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	if o.TLSHandshakeTimeout > 0 {
+		t.TLSHandshakeTimeout = o.TLSHandshakeTimeout
+	}
+	if o.ResponseHeaderTimeout > 0 {
+		t.ResponseHeaderTimeout = o.ResponseHeaderTimeout
+	}
+	if o.MaxIdleConns > 0 {
+		t.MaxIdleConns = o.MaxIdleConns
+	}
+	if o.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = o.MaxIdleConnsPerHost
+	}
+	if o.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = o.IdleConnTimeout
+	}
+	return t, nil
+}
+
+// SetTransportOptions makes the client talk to nexmo as
+// configured by `o`.
+func (c *Client) SetTransportOptions(o TransportOptions) error {
+	t, err := NewTransport(o)
+	if err != nil {
+		return err
+	}
+	timeout := o.Timeout
+	if timeout == 0 {
+		timeout = DefaultRequestTimeout
+	}
+	c.internal = &http.Client{Transport: t, Timeout: timeout}
+	return nil
+}
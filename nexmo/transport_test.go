@@ -0,0 +1,75 @@
+package nexmo_test
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+func TestClient_SetTransportOptions(t *testing.T) {
+	srv, c := newTestClient(t)
+
+	// The proxy receives the requests with the absolute URL
+	// of the API.
+	proxied := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied <- r.URL.String()
+	}))
+	defer proxy.Close()
+	if err := c.SetTransportOptions(nexmo.TransportOptions{Proxy: proxy.URL}); err != nil {
+		t.Fatalf("Unexpected transport error: %v", err)
+	}
+	resp, err := c.Get(context.TODO(), srv.URL+"/v1/calls")
+	if err != nil {
+		t.Fatalf("Unexpected get error: %v", err)
+	}
+	resp.Body.Close()
+	if u := <-proxied; u != srv.URL+"/v1/calls" {
+		t.Fatalf("Wanted the request to go through the proxy, found %s", u)
+	}
+
+	for _, o := range []nexmo.TransportOptions{
+		{Proxy: "not a url"},
+		{CAFile: filepath.Join(t.TempDir(), "missing.pem")},
+		{Dial: nexmo.DialOptions{Family: "ipv5"}},
+	} {
+		if err := c.SetTransportOptions(o); err == nil {
+			t.Fatalf("%+v: wanted an error", o)
+		}
+	}
+}
+
+func TestNewTransport_caFile(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	// Without the bundle, the certificate of the server
+	// is not trusted.
+	tr, err := nexmo.NewTransport(nexmo.TransportOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected transport error: %v", err)
+	}
+	if _, err = (&http.Client{Transport: tr}).Get(srv.URL); err == nil {
+		t.Fatalf("Wanted an unknown authority error")
+	}
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err = ioutil.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if tr, err = nexmo.NewTransport(nexmo.TransportOptions{CAFile: path}); err != nil {
+		t.Fatalf("Unexpected transport error: %v", err)
+	}
+	resp, err := (&http.Client{Transport: tr}).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Unexpected get error: %v", err)
+	}
+	resp.Body.Close()
+}
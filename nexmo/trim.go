@@ -0,0 +1,189 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// ErrTrimUnsupported is returned when a recording cannot be trimmed,
+// e.g. because it is compressed and ffmpeg is not available.
+var ErrTrimUnsupported = errors.New("silence trimming not supported for this recording")
+
+// SilenceThreshold is the amplitude, relative to full scale, under
+// which samples are considered silent (about -40 dBFS).
+const SilenceThreshold = 0.01
+
+// silenceMargin is the silence left around the message, so
+// that it does not start or end abruptly.
+const silenceMargin = 250 * time.Millisecond
+
+// TrimSilence removes the leading and trailing silence of the
+// recording `data`, encoded in `format`. WAV (PCM) recordings are
+// trimmed natively, other formats require ffmpeg to be installed.
+func TrimSilence(ctx context.Context, data []byte, format string) ([]byte, error) {
+	if format == FormatWAV {
+		return trimWAV(data)
+	}
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return nil, ErrTrimUnsupported
+	}
+	return trimFFmpeg(ctx, data, format)
+}
+
+type wavFormat struct {
+	AudioFormat   uint16
+	Channels      uint16
+	SampleRate    uint32
+	ByteRate      uint32
+	BlockAlign    uint16
+	BitsPerSample uint16
+}
+
+// parseWAV returns the format and the samples of the
+// PCM wav file `data`.
+func parseWAV(data []byte) (wavFormat, []byte, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return wavFormat{}, nil, fmt.Errorf("not a wav file")
+	}
+
+	var (
+		fmtChunk   *wavFormat
+		dataOffset int
+		dataSize   int
+	)
+	for off := 12; off+8 <= len(data); {
+		id := string(data[off : off+4])
+		size := int(binary.LittleEndian.Uint32(data[off+4 : off+8]))
+		body := off + 8
+		if body+size > len(data) {
+			// Streams often report a bogus size for the
+			// last chunk: take what is there.
+			size = len(data) - body
+		}
+		switch id {
+		case "fmt ":
+			f := wavFormat{}
+			if err := binary.Read(bytes.NewReader(data[body:body+size]), binary.LittleEndian, &f); err != nil {
+				return wavFormat{}, nil, fmt.Errorf("invalid fmt chunk: %v", err)
+			}
+			fmtChunk = &f
+		case "data":
+			dataOffset, dataSize = body, size
+		}
+		off = body + size + size%2
+	}
+	if fmtChunk == nil || dataOffset == 0 {
+		return wavFormat{}, nil, fmt.Errorf("missing fmt or data chunk")
+	}
+	return *fmtChunk, data[dataOffset : dataOffset+dataSize], nil
+}
+
+// sample returns the value, between -1 and 1, of the
+// sample at the start of `b`.
+func (f wavFormat) sample(b []byte) float64 {
+	if f.BitsPerSample == 8 {
+		// 8 bit samples are unsigned.
+		return (float64(b[0]) - 128) / 128
+	}
+	return float64(int16(binary.LittleEndian.Uint16(b))) / 32768
+}
+
+func trimWAV(data []byte) ([]byte, error) {
+	fmtChunk, samples, err := parseWAV(data)
+	if err != nil {
+		return nil, fmt.Errorf("trim: %v", err)
+	}
+	if fmtChunk.AudioFormat != 1 || (fmtChunk.BitsPerSample != 8 && fmtChunk.BitsPerSample != 16) || fmtChunk.BlockAlign == 0 {
+		return nil, ErrTrimUnsupported
+	}
+
+	align := int(fmtChunk.BlockAlign)
+	frames := len(samples) / align
+	loud := func(frame int) bool {
+		block := samples[frame*align : (frame+1)*align]
+		step := int(fmtChunk.BitsPerSample / 8)
+		for i := 0; i+step <= len(block); i += step {
+			v := fmtChunk.sample(block[i:])
+			if v > SilenceThreshold || v < -SilenceThreshold {
+				return true
+			}
+		}
+		return false
+	}
+
+	first, last := 0, frames-1
+	for first < frames && !loud(first) {
+		first++
+	}
+	for last > first && !loud(last) {
+		last--
+	}
+	if first >= frames {
+		// Only silence: there is nothing sensible to cut.
+		return data, nil
+	}
+	margin := int(time.Duration(fmtChunk.SampleRate) * silenceMargin / time.Second)
+	if first -= margin; first < 0 {
+		first = 0
+	}
+	if last += margin; last > frames-1 {
+		last = frames - 1
+	}
+
+	return encodeWAV(fmtChunk, samples[first*align:(last+1)*align]), nil
+}
+
+// encodeWAV returns the wav file made of `samples`, in format `f`.
+func encodeWAV(f wavFormat, samples []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(4+8+16+8+len(samples)))
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))
+	binary.Write(&buf, binary.LittleEndian, f)
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(samples)))
+	buf.Write(samples)
+	return buf.Bytes()
+}
+
+func trimFFmpeg(ctx context.Context, data []byte, format string) ([]byte, error) {
+	// Remove the silence at the start, then reverse the audio to
+	// do the same at the end, and reverse it back.
+	silence := fmt.Sprintf("silenceremove=start_periods=1:start_threshold=%gdB:start_silence=%g",
+		-40.0, silenceMargin.Seconds())
+	filter := silence + ",areverse," + silence + ",areverse"
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-loglevel", "error",
+		"-f", format, "-i", "pipe:0", "-af", filter, "-f", format, "pipe:1")
+	cmd.Stdin = bytes.NewReader(data)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("trim: ffmpeg: %v: %s", err, stderr.String())
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,45 @@
+package nexmo_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+// wav encodes 16 bit mono PCM `samples` at 8kHz.
+func wav(samples []int16) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+2*len(samples)))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, struct {
+		Size                      uint32
+		Format, Channels          uint16
+		SampleRate, ByteRate      uint32
+		BlockAlign, BitsPerSample uint16
+	}{16, 1, 1, 8000, 16000, 2, 16})
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(2*len(samples)))
+	binary.Write(&buf, binary.LittleEndian, samples)
+	return buf.Bytes()
+}
+
+func TestTrimSilence_wav(t *testing.T) {
+	// 2s of silence, 1s of signal, 3s of silence.
+	samples := make([]int16, 6*8000)
+	for i := 2 * 8000; i < 3*8000; i++ {
+		samples[i] = 10000
+	}
+
+	trimmed, err := nexmo.TrimSilence(context.TODO(), wav(samples), nexmo.FormatWAV)
+	if err != nil {
+		t.Fatalf("Unexpected trim error: %v", err)
+	}
+	// 1s of signal plus the 250ms margins.
+	if want := len(wav(make([]int16, 8000+2*2000))); len(trimmed) != want {
+		t.Fatalf("Wanted %d bytes, found %d", want, len(trimmed))
+	}
+}
@@ -0,0 +1,193 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TTS is a text-to-speech provider, used to speak the prompts
+// with voices other than nexmo's built-in ones.
+type TTS interface {
+	// Synthesize returns the audio of `text` spoken in `lang`
+	// by `voice`, the provider's default if empty, together
+	// with its format, e.g. "mp3".
+	Synthesize(ctx context.Context, text, lang, voice string) ([]byte, string, error)
+}
+
+// DefaultSpeechTimeout is the default deadline of the synthesis
+// of the prompts that have not been synthesized in advance.
+const DefaultSpeechTimeout = 3 * time.Second
+
+// Speech speaks the prompts through `stream` actions playing
+// the audio synthesized by a TTS, instead of `talk` actions.
+// The audio is synthesized once per text and voice, and served
+// under /tts/. Prompts are spoken through `talk` actions when
+// their synthesis fails.
+type Speech struct {
+	TTS TTS
+	// Origin is the address nexmo reaches the router at.
+	Origin string
+	// Voices maps a language to the voice of the provider
+	// speaking it. The provider's default is used for the
+	// missing languages.
+	Voices map[string]string
+	// Dir, if set, keeps the synthesized audio across
+	// restarts, which is otherwise kept in memory only.
+	Dir string
+	// Timeout is the deadline of the synthesis of each prompt
+	// while answering a call, DefaultSpeechTimeout if zero.
+	Timeout time.Duration
+	Log     *log.Logger
+
+	mu    sync.Mutex
+	audio map[string][]byte
+}
+
+// speechName returns the name of the audio of `text` spoken by
+// `voice` in `lang`, without its extension.
+func speechName(text, lang, voice string) string {
+	sum := sha256.Sum256([]byte(lang + "\x00" + voice + "\x00" + text))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Synthesize returns the name of the audio of `text`, spoken in
+// `lang`, synthesizing it if needed.
+func (s *Speech) Synthesize(ctx context.Context, text, lang string) (string, error) {
+	lang = baseLang(lang)
+	voice := s.Voices[lang]
+	prefix := speechName(text, lang, voice) + "."
+
+	s.mu.Lock()
+	for k := range s.audio {
+		if strings.HasPrefix(k, prefix) {
+			s.mu.Unlock()
+			return k, nil
+		}
+	}
+	s.mu.Unlock()
+	if s.Dir != "" {
+		if m, _ := filepath.Glob(filepath.Join(s.Dir, prefix+"*")); len(m) > 0 {
+			if data, err := ioutil.ReadFile(m[0]); err == nil {
+				name := filepath.Base(m[0])
+				s.store(name, data)
+				return name, nil
+			}
+		}
+	}
+
+	data, format, err := s.TTS.Synthesize(ctx, text, lang, voice)
+	if err != nil {
+		return "", fmt.Errorf("speech: unable to synthesize %q: %v", text, err)
+	}
+	name := prefix + format
+	if s.Dir != "" {
+		if err = os.MkdirAll(s.Dir, 0755); err == nil {
+			err = ioutil.WriteFile(filepath.Join(s.Dir, name), data, 0644)
+		}
+		if err != nil {
+			logger(s.Log).Printf("speech: unable to keep %s: %v", name, err)
+		}
+	}
+	s.store(name, data)
+	return name, nil
+}
+
+func (s *Speech) store(name string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.audio == nil {
+		s.audio = make(map[string][]byte)
+	}
+	s.audio[name] = data
+}
+
+// Presynthesize synthesizes the prompts of `b` which do not
+// depend on the call, so that they are ready before the first
+// call is answered.
+func (s *Speech) Presynthesize(ctx context.Context, b *PromptBook) error {
+	n := 0
+	for lang, p := range b.langs {
+		for _, v := range p.texts() {
+			if v == "" || strings.Contains(v, "{{") {
+				continue
+			}
+			if _, err := s.Synthesize(ctx, v, lang); err != nil {
+				return err
+			}
+			n++
+		}
+	}
+	logger(s.Log).Printf("speech: %d prompts synthesized", n)
+	return nil
+}
+
+// streamAction returns a `stream` NCCO action playing `text`,
+// spoken in `lang`, or false if it could not be synthesized.
+func (s *Speech) streamAction(text, lang string, level float64) (map[string]interface{}, bool) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultSpeechTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	name, err := s.Synthesize(ctx, text, lang)
+	if err != nil {
+		logger(s.Log).Printf("%v, falling back to talk", err)
+		return nil, false
+	}
+	return map[string]interface{}{
+		"action":    "stream",
+		"level":     level,
+		"streamUrl": []string{s.Origin + "/tts/" + name},
+	}, true
+}
+
+// Handler serves the synthesized audio. The path of the
+// requests is the name of the audio.
+func (s *Speech) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Base(r.URL.Path)
+		s.mu.Lock()
+		data, ok := s.audio[name]
+		s.mu.Unlock()
+		if !ok && s.Dir != "" {
+			var err error
+			if data, err = ioutil.ReadFile(filepath.Join(s.Dir, name)); err == nil {
+				ok = true
+			}
+		}
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", ContentType(name))
+		w.Write(data)
+	})
+}
@@ -0,0 +1,100 @@
+package nexmo_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+)
+
+type fakeTTS struct {
+	texts []string
+	err   error
+}
+
+func (f *fakeTTS) Synthesize(ctx context.Context, text, lang, voice string) ([]byte, string, error) {
+	if f.err != nil {
+		return nil, "", f.err
+	}
+	f.texts = append(f.texts, text)
+	return []byte(lang + "/" + voice + ": " + text), "mp3", nil
+}
+
+func TestSpeech(t *testing.T) {
+	tts := &fakeTTS{}
+	book := nexmo.NewPromptBook()
+	book.Speech = &nexmo.Speech{
+		TTS:    tts,
+		Origin: "https://voicebr.example.com",
+		Voices: map[string]string{"en": "Jenny"},
+		Dir:    t.TempDir(),
+	}
+	if err := book.Speech.Presynthesize(context.TODO(), book); err != nil {
+		t.Fatalf("Unexpected synthesis error: %v", err)
+	}
+	n := len(tts.texts)
+
+	p := book.For("en-GB", "")
+	a := p.TalkAction(p.End, nexmo.PromptData{})
+	if a["action"] != "stream" {
+		t.Fatalf("Wanted a stream action, found %v", a)
+	}
+	if len(tts.texts) != n {
+		t.Fatalf("Wanted the presynthesized prompt to be reused, found %d syntheses", len(tts.texts)-n)
+	}
+	url := a["streamUrl"].([]string)[0]
+	if !strings.HasPrefix(url, "https://voicebr.example.com/tts/") {
+		t.Fatalf("Unexpected stream url: %v", url)
+	}
+
+	r := nexmo.NewRouter(nil, &storage.Local{RootDir: t.TempDir()}, "https://voicebr.example.com", nexmo.RouterOptions{Prompts: book})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", strings.TrimPrefix(url, "https://voicebr.example.com"), nil))
+	if w.Code != http.StatusOK || w.Body.String() != "en/Jenny: End of message" {
+		t.Fatalf("Unexpected audio: %d %q", w.Code, w.Body.String())
+	}
+
+	// Not synthesized again after a restart, as it is kept in Dir.
+	restarted := &nexmo.Speech{TTS: &fakeTTS{err: errors.New("unavailable")}, Voices: book.Speech.Voices, Dir: book.Speech.Dir}
+	if _, err := restarted.Synthesize(context.TODO(), "End of message", "en"); err != nil {
+		t.Fatalf("Unexpected synthesis error: %v", err)
+	}
+
+	// Prompts fall back to nexmo's voices when the provider fails.
+	book.Speech.TTS = &fakeTTS{err: errors.New("unavailable")}
+	a = p.TalkAction("Hello {{.CallerName}}", nexmo.PromptData{CallerName: "Luca"})
+	if a["action"] != "talk" || a["text"] != "Hello Luca" {
+		t.Fatalf("Wanted a talk action, found %v", a)
+	}
+}
+
+func TestElevenLabsTTS(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.URL.Path != "/v1/text-to-speech/voice-id" || r.Header.Get("xi-api-key") != "key" || body["text"] != "Ciao" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("audio"))
+	}))
+	defer srv.Close()
+
+	e := nexmo.ElevenLabsTTS{Key: "key", Voice: "voice-id", BaseURL: srv.URL}
+	audio, format, err := e.Synthesize(context.TODO(), "Ciao", "it", "")
+	if err != nil {
+		t.Fatalf("Unexpected synthesis error: %v", err)
+	}
+	if string(audio) != "audio" || format != "mp3" {
+		t.Fatalf("Unexpected audio: %q %s", audio, format)
+	}
+	if _, _, err = e.Synthesize(context.TODO(), "Ciao", "it", "other"); err == nil {
+		t.Fatalf("Wanted an error for the unknown voice")
+	}
+}
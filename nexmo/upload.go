@@ -0,0 +1,223 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotRecording is returned by UploadRec when the uploaded
+// data is not a recording in the format its name says.
+var ErrNotRecording = errors.New("not a recording in the format of its name")
+
+// ValidateRecName returns an error if `name` is not a valid name
+// for an uploaded recording: a file name whose extension is one
+// of the supported formats.
+func ValidateRecName(name string) error {
+	if name == "" || filepath.Base(name) != name || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid recording name %q", name)
+	}
+	return ValidateRecFormat(RecFormat(name))
+}
+
+// UploadOptions configures UploadRec.
+type UploadOptions struct {
+	// MaxSize is the size of the largest recording accepted,
+	// DefaultMaxRecSize if zero.
+	MaxSize int64
+	// Transcoder, if set, converts the recording to Target
+	// before it is stored. The extension of its name follows
+	// the format of Target.
+	Transcoder Transcoder
+	Target     AudioTarget
+	// Loudness, if set, normalizes the loudness of the
+	// recording, once transcoded.
+	Loudness *LoudnessNormalizer
+	// By is who uploaded the recording, for the audit log.
+	By string
+}
+
+func (o UploadOptions) maxSize() int64 {
+	if o.MaxSize <= 0 {
+		return DefaultMaxRecSize
+	}
+	return o.MaxSize
+}
+
+// UploadRec stores the recording read from `r` under `name`,
+// whose extension must be one of the supported formats.
+func (c *Client) UploadRec(ctx context.Context, s RecStore, name string, r io.Reader, opts UploadOptions) (RecMeta, error) {
+	if err := ValidateRecName(name); err != nil {
+		return RecMeta{}, fmt.Errorf("upload: %v", err)
+	}
+	max := opts.maxSize()
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, io.LimitReader(r, max+1)); err != nil {
+		return RecMeta{}, fmt.Errorf("upload: unable to read recording: %v", err)
+	}
+	if int64(buf.Len()) > max {
+		return RecMeta{}, ErrRecTooLarge
+	}
+	format := RecFormat(name)
+	if SniffRecFormat(buf.Bytes()) != format {
+		return RecMeta{}, ErrNotRecording
+	}
+	data := buf.Bytes()
+	if opts.Transcoder != nil {
+		var err error
+		if data, err = opts.Transcoder.Transcode(ctx, data, format, opts.Target); err != nil {
+			return RecMeta{}, err
+		}
+		if to := opts.Target.Format; to != "" && to != format {
+			name = strings.TrimSuffix(name, filepath.Ext(name)) + "." + to
+			format = to
+		}
+	}
+	if opts.Loudness != nil {
+		var err error
+		if data, err = opts.Loudness.Normalize(ctx, data, format); err != nil {
+			return RecMeta{}, err
+		}
+	}
+
+	meta, err := s.WriteRec(ctx, bytes.NewReader(data), name, RecMeta{
+		ContentType: ContentType(name),
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		return meta, err
+	}
+	c.audit(ctx, AuditRecordingStored, map[string]string{
+		"rec_name":    meta.Name,
+		"size":        strconv.FormatInt(meta.Size, 10),
+		"uploaded_by": opts.By,
+	})
+	return meta, nil
+}
+
+// makeUploadRecHandler stores the recording in the `file` field
+// of the multipart request, named after the `name` field or after
+// the file itself. With `transcode` set to true, or when the
+// router has a Transcoder, it is converted to the audio target
+// of the router. With `broadcast` set to
+// true, it is then broadcast to `group`, or to the broadcast list
+// if empty, showing `from` if set, with `priority`, as POST
+// /admin/broadcasts does.
+func makeUploadRecHandler(s Storage, c *Client, opts RouterOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		upload := UploadOptions{MaxSize: opts.MaxRecSize, Loudness: opts.Loudness, By: "anonymous"}
+		// Leave room for the other fields of the form.
+		r.Body = http.MaxBytesReader(w, r.Body, upload.maxSize()+1<<20)
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "file: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		name := r.FormValue("name")
+		if name == "" {
+			name = header.Filename
+		}
+		if err = ValidateRecName(name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.FormValue("transcode") == "true" || opts.Transcoder != nil {
+			upload.Transcoder, upload.Target = opts.transcoder(), opts.audioTarget()
+		}
+
+		b := Broadcast{From: r.FormValue("from"), Priority: r.FormValue("priority")}
+		group, broadcast := r.FormValue("group"), r.FormValue("broadcast") == "true"
+		p, authenticated := PrincipalFromContext(r.Context())
+		b.RequestedBy = "anonymous"
+		if authenticated {
+			upload.By = p.Name
+			b.RequestedBy = p.Name
+		}
+		if broadcast {
+			if authenticated && !p.CanBroadcastTo(group) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			if err = ValidatePriority(b.Priority); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if b.From != "" && !c.Owns(b.From) {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				fmt.Fprintf(w, "%q is not owned by the application\n", b.From)
+				return
+			}
+		}
+
+		meta, err := c.UploadRec(r.Context(), s, name, file, upload)
+		switch {
+		case err == ErrRecTooLarge:
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		case err == ErrNotRecording:
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		case err == ErrTranscodeUnsupported, err == ErrLoudnessUnsupported:
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		case err != nil:
+			opts.logger().Printf("upload recording handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		opts.logger().Printf("upload recording handler: %s uploaded by %s", meta.Name, upload.By)
+		resp := map[string]interface{}{"recording": meta}
+		if broadcast {
+			contacts, err := RecipientsOf(r.Context(), s, group, opts.Log)
+			switch {
+			case err == ErrNoHistory:
+				w.WriteHeader(http.StatusNotImplemented)
+				return
+			case err != nil:
+				opts.logger().Printf("upload recording handler: %v", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			b.RecName = meta.Name
+			if b, err = c.StartBroadcast(r.Context(), s, b, contacts); err != nil {
+				opts.logger().Printf("upload recording handler: %v", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			resp["broadcast"] = b
+		}
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(resp)
+	}
+}
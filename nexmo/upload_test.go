@@ -0,0 +1,98 @@
+package nexmo_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+)
+
+// uploadForm encodes a multipart upload of `data` as `filename`,
+// returning the body and its content type.
+func uploadForm(t *testing.T, filename string, data []byte, fields map[string]string) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	fw, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(data)
+	if err = mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &body, mw.FormDataContentType()
+}
+
+func TestUploadRecHandler(t *testing.T) {
+	srv, c := newTestClient(t)
+	dir := t.TempDir()
+	ioutil.WriteFile(dir+"/contacts.csv", []byte("393331111111,Anna\n393332222222,Luca\n"), 0644)
+	s := &storage.Local{RootDir: dir}
+	r := nexmo.NewRouter(c, s, c.Origin, nexmo.RouterOptions{
+		Auth:       nexmo.APIKeys{"k3y": "ci"},
+		MaxRecSize: 64,
+	})
+	wav := []byte("RIFF\x00\x00\x00\x00WAVEfmt ")
+
+	tt := []struct {
+		name     string
+		filename string
+		data     []byte
+		fields   map[string]string
+		code     int
+	}{
+		{"not a recording", "message.wav", []byte("not audio"), nil, 415},
+		{"bad name", "message.txt", wav, nil, 400},
+		{"too large", "message.wav", append(wav, make([]byte, 64)...), nil, 413},
+		{"bad priority", "message.wav", wav, map[string]string{"broadcast": "true", "priority": "asap"}, 400},
+		{"not owned", "message.wav", wav, map[string]string{"broadcast": "true", "from": "393330000000"}, 422},
+		{"stored", "message.wav", wav, map[string]string{"name": "hello.wav"}, 201},
+		{"broadcast", "message.wav", wav, map[string]string{"broadcast": "true"}, 201},
+	}
+	for _, v := range tt {
+		body, ct := uploadForm(t, v.filename, v.data, v.fields)
+		req := httptest.NewRequest("POST", "/admin/recordings", body)
+		req.Header.Set("content-type", ct)
+		req.Header.Set("X-API-Key", "k3y")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != v.code {
+			t.Fatalf("%s: wanted status %d, found %d: %s", v.name, v.code, w.Code, w.Body.String())
+		}
+	}
+
+	if _, _, err := s.OpenRec(context.TODO(), "hello.wav"); err != nil {
+		t.Fatalf("Wanted the recording to be stored under its name: %v", err)
+	}
+	if calls := srv.WaitCalls(2, waitTimeout); len(calls) != 2 {
+		t.Fatalf("Wanted 2 calls, found %d", len(calls))
+	}
+
+	// The last response carries the broadcast.
+	body, ct := uploadForm(t, "again.wav", wav, map[string]string{"broadcast": "true"})
+	req := httptest.NewRequest("POST", "/admin/recordings", body)
+	req.Header.Set("content-type", ct)
+	req.Header.Set("X-API-Key", "k3y")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var resp struct {
+		Recording nexmo.RecMeta   `json:"recording"`
+		Broadcast nexmo.Broadcast `json:"broadcast"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if resp.Recording.Name != "again.wav" || resp.Broadcast.RecName != "again.wav" || len(resp.Broadcast.Recipients) != 2 {
+		t.Fatalf("Unexpected response: %+v", resp)
+	}
+}
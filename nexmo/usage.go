@@ -0,0 +1,158 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Usage is the amount of completed calls, as billed by nexmo.
+type Usage struct {
+	Calls   int     `json:"calls"`
+	Seconds int64   `json:"seconds"`
+	Price   float64 `json:"price"`
+}
+
+func (u *Usage) add(e CallEvent) {
+	u.Calls++
+	u.Seconds += int64(e.Duration / time.Second)
+	u.Price = round(u.Price + e.Price)
+}
+
+// MonthlyUsage is the usage of a calendar month, in UTC, which
+// is what the nexmo bills cover.
+type MonthlyUsage struct {
+	// Month is formatted as "2006-01".
+	Month string `json:"month"`
+	Usage
+}
+
+// BroadcastUsage is the usage of the calls of a broadcast. The
+// calls that are not part of any broadcast, e.g. the ones of the
+// broadcasters, are reported under broadcast 0.
+type BroadcastUsage struct {
+	BroadcastID int64 `json:"broadcast_id"`
+	Usage
+}
+
+// UsageReport is the usage of the calls completed between
+// Since and Until.
+type UsageReport struct {
+	Since      time.Time        `json:"since"`
+	Until      time.Time        `json:"until"`
+	Total      Usage            `json:"total"`
+	Months     []MonthlyUsage   `json:"months"`
+	Broadcasts []BroadcastUsage `json:"broadcasts"`
+}
+
+// UsageLog is implemented by the EventLogs that are able to list
+// the completed calls.
+type UsageLog interface {
+	// CompletedCalls returns the completed events received
+	// between `since` and `until`, oldest first.
+	CompletedCalls(ctx context.Context, since, until time.Time) ([]CallEvent, error)
+}
+
+// NewUsageReport aggregates `events`, the completed calls between
+// `since` and `until`. Events delivered more than once are
+// counted once.
+func NewUsageReport(since, until time.Time, events []CallEvent) UsageReport {
+	report := UsageReport{
+		Since:      since,
+		Until:      until,
+		Months:     []MonthlyUsage{},
+		Broadcasts: []BroadcastUsage{},
+	}
+	seen := make(map[string]bool, len(events))
+	months := make(map[string]*MonthlyUsage)
+	broadcasts := make(map[int64]*BroadcastUsage)
+	for _, e := range events {
+		if seen[e.UUID] {
+			continue
+		}
+		seen[e.UUID] = true
+
+		month := e.Timestamp.UTC().Format("2006-01")
+		m, ok := months[month]
+		if !ok {
+			m = &MonthlyUsage{Month: month}
+			months[month] = m
+		}
+		b, ok := broadcasts[e.BroadcastID]
+		if !ok {
+			b = &BroadcastUsage{BroadcastID: e.BroadcastID}
+			broadcasts[e.BroadcastID] = b
+		}
+		report.Total.add(e)
+		m.add(e)
+		b.add(e)
+	}
+	for _, v := range months {
+		report.Months = append(report.Months, *v)
+	}
+	sort.Slice(report.Months, func(i, j int) bool {
+		return report.Months[i].Month < report.Months[j].Month
+	})
+	for _, v := range broadcasts {
+		report.Broadcasts = append(report.Broadcasts, *v)
+	}
+	sort.Slice(report.Broadcasts, func(i, j int) bool {
+		return report.Broadcasts[i].BroadcastID < report.Broadcasts[j].BroadcastID
+	})
+	return report
+}
+
+// makeUsageHandler serves the usage between the `since` and
+// `until` query parameters, in RFC 3339 format. The current
+// month, in UTC, is reported if they are missing.
+func makeUsageHandler(l UsageLog, lg *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now().UTC()
+		since := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		until := now
+		for k, dst := range map[string]*time.Time{"since": &since, "until": &until} {
+			v := r.URL.Query().Get(k)
+			if v == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, k+": "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			*dst = t
+		}
+
+		events, err := l.CompletedCalls(r.Context(), since, until)
+		if err == ErrNoHistory {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		if err != nil {
+			logger(lg).Printf("usage handler: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(NewUsageReport(since, until, events))
+	}
+}
@@ -0,0 +1,31 @@
+package nexmo_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+func TestNewUsageReport(t *testing.T) {
+	day := func(m time.Month, d int) time.Time {
+		return time.Date(2020, m, d, 12, 0, 0, 0, time.UTC)
+	}
+	events := []nexmo.CallEvent{
+		{UUID: "a", BroadcastID: 1, Duration: 30 * time.Second, Price: 0.006, Timestamp: day(time.March, 30)},
+		{UUID: "b", BroadcastID: 1, Duration: 60 * time.Second, Price: 0.012, Timestamp: day(time.April, 1)},
+		// Delivered twice.
+		{UUID: "b", BroadcastID: 1, Duration: 60 * time.Second, Price: 0.012, Timestamp: day(time.April, 1)},
+		{UUID: "c", Duration: 90 * time.Second, Price: 0.018, Timestamp: day(time.April, 2)},
+	}
+	r := nexmo.NewUsageReport(day(time.March, 1), day(time.May, 1), events)
+	if r.Total.Calls != 3 || r.Total.Seconds != 180 || r.Total.Price != 0.036 {
+		t.Fatalf("Unexpected total: %+v", r.Total)
+	}
+	if len(r.Months) != 2 || r.Months[0].Month != "2020-03" || r.Months[1].Calls != 2 || r.Months[1].Price != 0.03 {
+		t.Fatalf("Unexpected months: %+v", r.Months)
+	}
+	if len(r.Broadcasts) != 2 || r.Broadcasts[0].BroadcastID != 0 || r.Broadcasts[1].Seconds != 90 {
+		t.Fatalf("Unexpected broadcasts: %+v", r.Broadcasts)
+	}
+}
@@ -0,0 +1,152 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// RecordingWatcher keeps track of the inbound calls that
+// are expected to produce a recording, and calls Notify
+// when a recording does not arrive in time, so that the
+// broadcaster knows that nothing has been sent.
+type RecordingWatcher struct {
+	// Timeout is the time a broadcaster has to complete
+	// the recording, starting from when the call is answered.
+	Timeout time.Duration
+	// Grace is the time the recording event is waited for
+	// after the inbound call has been completed.
+	Grace time.Duration
+	// Notify is called, in its own goroutine, with the
+	// broadcaster whose recording did not arrive.
+	Notify func(caller Contact)
+	Log    *log.Logger
+
+	mu      sync.Mutex
+	pending map[string]*pendingRec
+}
+
+type pendingRec struct {
+	caller Contact
+	timer  *time.Timer
+	// held is set while the recording is being stored.
+	held bool
+}
+
+func NewRecordingWatcher(timeout time.Duration, notify func(Contact)) *RecordingWatcher {
+	return &RecordingWatcher{
+		Timeout: timeout,
+		Grace:   time.Minute,
+		Notify:  notify,
+		pending: make(map[string]*pendingRec),
+	}
+}
+
+// Watch starts waiting for the recording of `conversation`.
+func (w *RecordingWatcher) Watch(conversation string, caller Contact) {
+	if w == nil || conversation == "" {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if p, ok := w.pending[conversation]; ok {
+		p.timer.Stop()
+	}
+	w.pending[conversation] = &pendingRec{
+		caller: caller,
+		timer: time.AfterFunc(w.Timeout, func() {
+			w.expire(conversation)
+		}),
+	}
+}
+
+// Done reports that the recording of `conversation` has arrived.
+func (w *RecordingWatcher) Done(conversation string) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if p, ok := w.pending[conversation]; ok {
+		p.timer.Stop()
+		delete(w.pending, conversation)
+	}
+}
+
+// Hold reports that the recording of `conversation` has arrived
+// but is still being stored: the caller is neither notified nor
+// forgotten until either Done or Failed are called.
+func (w *RecordingWatcher) Hold(conversation string) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if p, ok := w.pending[conversation]; ok {
+		p.timer.Stop()
+		p.held = true
+	}
+}
+
+// Failed reports that the recording of `conversation` arrived
+// but could not be stored, notifying the caller immediately.
+func (w *RecordingWatcher) Failed(conversation string) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	if p, ok := w.pending[conversation]; ok {
+		p.timer.Stop()
+	}
+	w.mu.Unlock()
+	w.expire(conversation)
+}
+
+// Completed reports that the inbound call of `conversation` is
+// over: if its recording is still missing, it will be waited for
+// at most Grace time. Held recordings are left alone.
+func (w *RecordingWatcher) Completed(conversation string) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if p, ok := w.pending[conversation]; ok && !p.held {
+		p.timer.Reset(w.Grace)
+	}
+}
+
+func (w *RecordingWatcher) expire(conversation string) {
+	w.mu.Lock()
+	p, ok := w.pending[conversation]
+	delete(w.pending, conversation)
+	w.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	logger(w.Log).Printf("recording watcher: no recording received from %s (conversation %s)", p.caller.Number, conversation)
+	if w.Notify != nil {
+		go w.Notify(p.caller)
+	}
+}
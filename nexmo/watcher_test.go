@@ -0,0 +1,85 @@
+package nexmo_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+func TestRecordingWatcher(t *testing.T) {
+	notified := make(chan nexmo.Contact, 2)
+	w := nexmo.NewRecordingWatcher(50*time.Millisecond, func(c nexmo.Contact) {
+		notified <- c
+	})
+	w.Grace = 10 * time.Millisecond
+
+	w.Watch("conv-1", nexmo.NewContact("39111", "foo"))
+	w.Watch("conv-2", nexmo.NewContact("39222", "bar"))
+	w.Done("conv-1")
+	w.Completed("conv-2")
+
+	select {
+	case c := <-notified:
+		if c.Number != "39222" {
+			t.Fatalf("Unexpected notification for %s", c.Number)
+		}
+	case <-time.After(40 * time.Millisecond):
+		t.Fatal("Grace period was not applied")
+	}
+
+	select {
+	case c := <-notified:
+		t.Fatalf("Unexpected notification for %s", c.Number)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRecordingWatcher_hold(t *testing.T) {
+	notified := make(chan nexmo.Contact, 2)
+	w := nexmo.NewRecordingWatcher(20*time.Millisecond, func(c nexmo.Contact) {
+		notified <- c
+	})
+
+	w.Watch("conv-1", nexmo.NewContact("39111", "foo"))
+	w.Hold("conv-1")
+	select {
+	case c := <-notified:
+		t.Fatalf("Unexpected notification for %s while holding", c.Number)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	w.Failed("conv-1")
+	select {
+	case c := <-notified:
+		if c.Number != "39111" {
+			t.Fatalf("Unexpected notification for %s", c.Number)
+		}
+	case <-time.After(50 * time.Millisecond):
+		t.Fatal("Failed recording was not notified")
+	}
+}
+
+func TestRecordingWatcher_holdCompleted(t *testing.T) {
+	notified := make(chan nexmo.Contact, 1)
+	w := nexmo.NewRecordingWatcher(20*time.Millisecond, func(c nexmo.Contact) {
+		notified <- c
+	})
+	w.Grace = 10 * time.Millisecond
+
+	w.Watch("conv-1", nexmo.NewContact("39111", "foo"))
+	w.Hold("conv-1")
+	w.Completed("conv-1")
+	select {
+	case c := <-notified:
+		t.Fatalf("Unexpected notification for %s while holding", c.Number)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	w.Done("conv-1")
+	select {
+	case c := <-notified:
+		t.Fatalf("Unexpected notification for %s", c.Number)
+	case <-time.After(30 * time.Millisecond):
+	}
+}
@@ -0,0 +1,125 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nexmo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultWhisperBinary is the name of whisper.cpp's command
+// line tool.
+const DefaultWhisperBinary = "whisper-cli"
+
+// Whisper is a Transcriber running whisper.cpp locally, so that
+// recordings never leave the machine. Recordings are converted
+// to the 16kHz mono wav whisper.cpp expects with ffmpeg.
+type Whisper struct {
+	// Binary is the path of whisper.cpp's command line tool,
+	// DefaultWhisperBinary if empty.
+	Binary string
+	// Model is the path of the ggml model file.
+	Model string
+	// Lang is the spoken language, detected if empty.
+	Lang    string
+	Threads int
+}
+
+var whisperDetectedLang = regexp.MustCompile(`auto-detected language: ([a-z]+)`)
+
+func (w Whisper) Transcribe(ctx context.Context, audio []byte, format string) (Transcript, error) {
+	var t Transcript
+	lang := w.Lang
+	if lang == "" {
+		lang = "auto"
+	}
+	stdout, stderr, err := w.run(ctx, audio, format, "-l", lang, "--no-timestamps", "--no-prints")
+	if err != nil {
+		return t, err
+	}
+
+	t.Engine = "whisper.cpp"
+	t.Lang = w.Lang
+	if m := whisperDetectedLang.FindStringSubmatch(stderr); m != nil {
+		t.Lang = m[1]
+	}
+	t.Text = strings.Join(strings.Fields(stdout), " ")
+	return t, nil
+}
+
+// DetectLang only runs whisper.cpp's language identification,
+// which is much faster than transcribing the whole recording.
+// Lang, when set, is returned as is.
+func (w Whisper) DetectLang(ctx context.Context, audio []byte, format string) (string, error) {
+	if w.Lang != "" {
+		return w.Lang, nil
+	}
+	stdout, stderr, err := w.run(ctx, audio, format, "-l", "auto", "--detect-language")
+	if err != nil {
+		return "", err
+	}
+	m := whisperDetectedLang.FindStringSubmatch(stderr + stdout)
+	if m == nil {
+		return "", nil
+	}
+	return m[1], nil
+}
+
+// run converts `audio` to wav and runs whisper.cpp over it with
+// `args`, returning its standard output and error.
+func (w Whisper) run(ctx context.Context, audio []byte, format string, args ...string) (string, string, error) {
+	dir, err := ioutil.TempDir("", "voicebr-whisper")
+	if err != nil {
+		return "", "", fmt.Errorf("whisper: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	input := dir + "/input.wav"
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-loglevel", "error",
+		"-f", format, "-i", "pipe:0", "-ar", "16000", "-ac", "1", "-c:a", "pcm_s16le", input)
+	cmd.Stdin = bytes.NewReader(audio)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err = cmd.Run(); err != nil {
+		return "", "", fmt.Errorf("whisper: ffmpeg: %v: %s", err, stderr.String())
+	}
+
+	binary := w.Binary
+	if binary == "" {
+		binary = DefaultWhisperBinary
+	}
+	args = append([]string{"-m", w.Model, "-f", input}, args...)
+	if w.Threads > 0 {
+		args = append(args, "-t", strconv.Itoa(w.Threads))
+	}
+	cmd = exec.CommandContext(ctx, binary, args...)
+	var stdout bytes.Buffer
+	stderr.Reset()
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err = cmd.Run(); err != nil {
+		return "", "", fmt.Errorf("whisper: %v: %s", err, stderr.String())
+	}
+	return stdout.String(), stderr.String(), nil
+}
@@ -0,0 +1,107 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package phone normalizes phone numbers to the format nexmo
+// expects: E.164 without the leading "+".
+package phone
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// MinDigits and MaxDigits bound the length of a
+	// normalized number, country code included.
+	MinDigits = 4
+	MaxDigits = 15
+)
+
+// Normalize returns `number` in E.164, without the leading "+".
+// Spaces, dashes, dots and parentheses are ignored. Numbers
+// starting with "+" or "00" are international. The others are
+// national numbers when `countryCode` is not empty and they do
+// not already start with it: their leading zeros are stripped
+// and `countryCode` is prepended. National numbers starting
+// with the digits of the country code must be written with
+// their country code.
+func Normalize(number, countryCode string) (string, error) {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(number) {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '+' && i == 0:
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", fmt.Errorf("invalid phone number %q: unexpected character %q", number, r)
+		}
+	}
+	digits := b.String()
+	countryCode = strings.TrimPrefix(countryCode, "+")
+
+	switch {
+	case strings.HasPrefix(strings.TrimSpace(number), "+"):
+	case strings.HasPrefix(digits, "00"):
+		digits = digits[2:]
+	case countryCode != "" && !strings.HasPrefix(digits, countryCode):
+		digits = countryCode + strings.TrimLeft(digits, "0")
+	}
+
+	switch {
+	case digits == "":
+		return "", fmt.Errorf("invalid phone number %q: no digits", number)
+	case digits[0] == '0':
+		return "", fmt.Errorf("invalid phone number %q: country code missing", number)
+	case len(digits) < MinDigits:
+		return "", fmt.Errorf("invalid phone number %q: too short", number)
+	case len(digits) > MaxDigits:
+		return "", fmt.Errorf("invalid phone number %q: longer than %d digits", number, MaxDigits)
+	}
+	return digits, nil
+}
+
+// countryCodes2 are the two digit country codes. The country
+// codes are prefix free: "1" and "7" are the only one digit
+// codes, every code not listed here has three digits.
+var countryCodes2 = map[string]bool{
+	"20": true, "27": true, "30": true, "31": true, "32": true,
+	"33": true, "34": true, "36": true, "39": true, "40": true,
+	"41": true, "43": true, "44": true, "45": true, "46": true,
+	"47": true, "48": true, "49": true, "51": true, "52": true,
+	"53": true, "54": true, "55": true, "56": true, "57": true,
+	"58": true, "60": true, "61": true, "62": true, "63": true,
+	"64": true, "65": true, "66": true, "81": true, "82": true,
+	"84": true, "86": true, "90": true, "91": true, "92": true,
+	"93": true, "94": true, "95": true, "98": true,
+}
+
+// CountryCode returns the country calling code of `number`, a
+// normalized number, e.g. "39" for "393331234567". Numbers that
+// share a country code are, mostly, in the same country: the
+// North American ones, starting with "1", span several.
+func CountryCode(number string) string {
+	switch {
+	case len(number) < MinDigits:
+		return ""
+	case number[0] == '1' || number[0] == '7':
+		return number[:1]
+	case countryCodes2[number[:2]]:
+		return number[:2]
+	default:
+		return number[:3]
+	}
+}
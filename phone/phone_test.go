@@ -0,0 +1,60 @@
+package phone_test
+
+import (
+	"testing"
+
+	"github.com/jecoz/voicebr/phone"
+)
+
+func TestNormalize(t *testing.T) {
+	tt := []struct {
+		number      string
+		countryCode string
+		want        string
+	}{
+		{"393331111111", "", "393331111111"},
+		{"+39 333 111 1111", "", "393331111111"},
+		{"0039-333-1111111", "44", "393331111111"},
+		{"333 1111111", "39", "393331111111"},
+		{"393331111111", "39", "393331111111"},
+		{"07700 900123", "+44", "447700900123"},
+		{"(020) 7946.0018", "44", "442079460018"},
+	}
+	for _, v := range tt {
+		n, err := phone.Normalize(v.number, v.countryCode)
+		if err != nil {
+			t.Fatalf("Unexpected error normalizing %q: %v", v.number, err)
+		}
+		if n != v.want {
+			t.Fatalf("Wanted %s from %q, found %s", v.want, v.number, n)
+		}
+	}
+}
+
+func TestNormalize_invalid(t *testing.T) {
+	for _, v := range []string{"", "Unknown", "0333 1111111", "+39", "39 333+1111111", "+1234567890123456"} {
+		if n, err := phone.Normalize(v, ""); err == nil {
+			t.Fatalf("Wanted an error normalizing %q, found %s", v, n)
+		}
+	}
+}
+
+func TestCountryCode(t *testing.T) {
+	tt := []struct {
+		number string
+		want   string
+	}{
+		{"393331111111", "39"},
+		{"447700900123", "44"},
+		{"14155550100", "1"},
+		{"79161234567", "7"},
+		{"353851234567", "353"},
+		{"2348031234567", "234"},
+		{"39", ""},
+	}
+	for _, v := range tt {
+		if found := phone.CountryCode(v.number); found != v.want {
+			t.Fatalf("Wanted %q from %s, found %q", v.want, v.number, found)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package prefs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// Environment variables used to decrypt age encrypted
+// preferences files. The first one that is set wins.
+const (
+	EnvPassphrase   = "VOICEBR_PREFS_PASSPHRASE"
+	EnvIdentity     = "VOICEBR_PREFS_IDENTITY"
+	EnvIdentityFile = "VOICEBR_PREFS_IDENTITY_FILE"
+)
+
+var (
+	ageHeader   = []byte("age-encryption.org/")
+	armorHeader = []byte(armor.Header)
+)
+
+// isEncrypted reports whether `b`, the beginning of a preferences
+// file, looks like an age encrypted file, either binary or armored.
+func isEncrypted(b []byte) bool {
+	b = bytes.TrimSpace(b)
+	return bytes.HasPrefix(b, ageHeader) || bytes.HasPrefix(b, armorHeader)
+}
+
+// decrypt returns a reader over the plaintext of the age encrypted
+// `r`. The identity is taken from the environment; the plaintext
+// is never written to disk.
+func decrypt(r *bufio.Reader) (io.Reader, error) {
+	identities, err := identitiesFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	var src io.Reader = r
+	if start, _ := r.Peek(len(armorHeader)); bytes.Equal(start, armorHeader) {
+		src = armor.NewReader(r)
+	}
+
+	plain, err := age.Decrypt(src, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt prefs: %v", err)
+	}
+	return plain, nil
+}
+
+func identitiesFromEnv() ([]age.Identity, error) {
+	if pass := os.Getenv(EnvPassphrase); pass != "" {
+		id, err := age.NewScryptIdentity(pass)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", EnvPassphrase, err)
+		}
+		return []age.Identity{id}, nil
+	}
+	if key := os.Getenv(EnvIdentity); key != "" {
+		ids, err := age.ParseIdentities(bytes.NewBufferString(key))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", EnvIdentity, err)
+		}
+		return ids, nil
+	}
+	if path := os.Getenv(EnvIdentityFile); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open identity file: %v", err)
+		}
+		defer file.Close()
+
+		ids, err := age.ParseIdentities(file)
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity file %s: %v", path, err)
+		}
+		return ids, nil
+	}
+	return nil, fmt.Errorf("prefs are encrypted, but none of %s, %s or %s is set", EnvPassphrase, EnvIdentity, EnvIdentityFile)
+}
@@ -0,0 +1,169 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package prefs
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// EnvPrefix starts the name of the environment variables
+// overriding the preferences, see EnvVar.
+const EnvPrefix = "VOICEBR_"
+
+// envAliases are the shorter names of the most common
+// environment overrides. The full name wins when both are set.
+var envAliases = map[string]string{
+	EnvPrefix + "PORT":   "server.port",
+	EnvPrefix + "ORIGIN": "server.origin",
+}
+
+var durationType = reflect.TypeOf(Duration(0))
+
+// EnvVar returns the environment variable overriding the
+// preference at JSON `path`: "vonage.app_id" is overridden
+// by VOICEBR_VONAGE_APP_ID.
+func EnvVar(path string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+}
+
+// Paths returns the JSON path of every preference that can be
+// overridden, sorted. Objects are descended into, while arrays
+// and maps are overridden as a whole.
+func Paths() []string {
+	acc := paths("", reflect.TypeOf(MasterPrefs{}), nil)
+	sort.Strings(acc)
+	return acc
+}
+
+func paths(prefix string, t reflect.Type, acc []string) []string {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := jsonName(f)
+		if name == "" {
+			continue
+		}
+		if f.Type.Kind() == reflect.Struct && f.Type != durationType {
+			acc = paths(prefix+name+".", f.Type, acc)
+			continue
+		}
+		acc = append(acc, prefix+name)
+	}
+	return acc
+}
+
+func jsonName(f reflect.StructField) string {
+	if f.PkgPath != "" {
+		return ""
+	}
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// ApplyEnv overrides the preferences of `p` with the variables
+// of `environ`, in the "key=value" form of os.Environ, named
+// after their path, see EnvVar. VOICEBR_PORT and VOICEBR_ORIGIN
+// are accepted as well. Unknown variables are ignored.
+//
+// Preferences are meant to be overridden in this order, each
+// step taking precedence over the previous ones: the defaults,
+// the preferences files (see LoadLayers), the environment and
+// finally the command line flags (see Set).
+func (p *MasterPrefs) ApplyEnv(environ []string) error {
+	vars := make(map[string]string, len(environ))
+	for _, v := range environ {
+		if kv := strings.SplitN(v, "=", 2); len(kv) == 2 && strings.HasPrefix(kv[0], EnvPrefix) {
+			vars[kv[0]] = kv[1]
+		}
+	}
+
+	aliases := make([]string, 0, len(envAliases))
+	for k := range envAliases {
+		aliases = append(aliases, k)
+	}
+	sort.Strings(aliases)
+	for _, k := range aliases {
+		path := envAliases[k]
+		if _, ok := vars[EnvVar(path)]; ok {
+			continue
+		}
+		if v, ok := vars[k]; ok {
+			if err := p.Set(path, v); err != nil {
+				return fmt.Errorf("%s: %v", k, err)
+			}
+		}
+	}
+	for _, path := range Paths() {
+		k := EnvVar(path)
+		if v, ok := vars[k]; ok {
+			if err := p.Set(path, v); err != nil {
+				return fmt.Errorf("%s: %v", k, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Set overrides the preference at JSON `path`, e.g.
+// "delivery.max_attempts", with `value`. Strings are taken
+// as they are, durations are parsed as in "1m30s", while any
+// other value, arrays and objects included, is decoded as JSON.
+func (p *MasterPrefs) Set(path, value string) error {
+	v := reflect.ValueOf(p).Elem()
+	for _, name := range strings.Split(path, ".") {
+		if v.Kind() != reflect.Struct || v.Type() == durationType {
+			return FieldError{Path: path, Err: fmt.Errorf("unknown preference")}
+		}
+		found := false
+		for i := 0; i < v.NumField(); i++ {
+			if jsonName(v.Type().Field(i)) == name {
+				v, found = v.Field(i), true
+				break
+			}
+		}
+		if !found {
+			return FieldError{Path: path, Err: fmt.Errorf("unknown preference")}
+		}
+	}
+
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return FieldError{Path: path, Err: err}
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(value)
+	case v.Kind() == reflect.Struct:
+		return FieldError{Path: path, Err: fmt.Errorf("not a single preference, set its fields instead")}
+	default:
+		dst := reflect.New(v.Type())
+		if err := json.Unmarshal([]byte(value), dst.Interface()); err != nil {
+			return FieldError{Path: path, Err: fmt.Errorf("invalid %v: %v", v.Type(), err)}
+		}
+		v.Set(dst.Elem())
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package prefs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// EnvName is the environment variable selecting the
+// environment overlay, when not given explicitly.
+const EnvName = "VOICEBR_ENV"
+
+// Layers returns the preferences files that should be merged,
+// in order, for environment `env`: the `base` file, its environment
+// overlay and its local override. Given "voicebr.json" and "staging"
+// they are "voicebr.json", "voicebr.staging.json" and
+// "voicebr.local.json". Overlays that do not exist are skipped.
+func Layers(base, env string) []string {
+	if env == "" {
+		env = os.Getenv(EnvName)
+	}
+
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	candidates := []string{}
+	if env != "" {
+		candidates = append(candidates, stem+"."+env+ext)
+	}
+	candidates = append(candidates, stem+".local"+ext)
+
+	acc := []string{base}
+	for _, v := range candidates {
+		if _, err := os.Stat(v); err == nil {
+			acc = append(acc, v)
+		}
+	}
+	return acc
+}
+
+// LoadLayers reads each of `paths`, merging them on top of each
+// other: objects are merged key by key, while any other value,
+// arrays included, replaces the one of the previous layers.
+func LoadLayers(paths ...string) (*MasterPrefs, error) {
+	merged := map[string]interface{}{}
+	for _, v := range paths {
+		layer, err := readLayer(v)
+		if err != nil {
+			return nil, fmt.Errorf("load prefs: %v", err)
+		}
+		merge(merged, layer)
+	}
+
+	b, err := json.Marshal(merged)
+	if err != nil {
+		return nil, fmt.Errorf("load prefs: %v", err)
+	}
+	return Decode(bytes.NewReader(b))
+}
+
+func readLayer(path string) (map[string]interface{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r, err := plaintext(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	layer := map[string]interface{}{}
+	if err = json.NewDecoder(r).Decode(&layer); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	// Each layer is migrated on its own, before merging, as
+	// layers may have been written for different versions.
+	if _, err = Migrate(layer); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return layer, nil
+}
+
+func merge(dst, src map[string]interface{}) {
+	for k, v := range src {
+		srcObj, ok := v.(map[string]interface{})
+		if !ok {
+			dst[k] = v
+			continue
+		}
+		dstObj, ok := dst[k].(map[string]interface{})
+		if !ok {
+			dstObj = map[string]interface{}{}
+			dst[k] = dstObj
+		}
+		merge(dstObj, srcObj)
+	}
+}
@@ -0,0 +1,188 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package prefs
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CurrentVersion is the version of the MasterPrefs schema.
+// Files without a version are considered version 0.
+const CurrentVersion = 1
+
+// migration upgrades raw preferences from version `from`
+// to version `from+1`.
+type migration struct {
+	from    int
+	migrate func(raw map[string]interface{}) error
+}
+
+// migrations must be kept sorted. When the schema changes in a
+// backward incompatible way, bump CurrentVersion and append the
+// migration taking the previous version to the new one.
+var migrations = []migration{
+	{from: 0, migrate: migrateDurations},
+}
+
+// durationFields are the fields holding a Duration, which
+// unversioned files may contain as nanoseconds.
+var durationFields = [][]string{
+	{"storage", "gcs", "signed_url_expiry"},
+	{"delivery", "retry_spacing"},
+	{"broadcaster", "record_timeout"},
+}
+
+// migrateDurations converts numeric durations, i.e. nanoseconds,
+// into their string representation.
+func migrateDurations(raw map[string]interface{}) error {
+	for _, path := range durationFields {
+		obj := raw
+		for _, k := range path[:len(path)-1] {
+			next, ok := obj[k].(map[string]interface{})
+			if !ok {
+				obj = nil
+				break
+			}
+			obj = next
+		}
+		if obj == nil {
+			continue
+		}
+		k := path[len(path)-1]
+		if n, ok := obj[k].(float64); ok {
+			obj[k] = time.Duration(n).String()
+		}
+	}
+	return nil
+}
+
+func version(raw map[string]interface{}) (int, error) {
+	v, ok := raw["version"]
+	if !ok {
+		return 0, nil
+	}
+	n, ok := v.(float64)
+	if !ok || n < 0 || n != float64(int(n)) {
+		return 0, fmt.Errorf("invalid prefs version: %v", v)
+	}
+	return int(n), nil
+}
+
+// Migrate upgrades the raw preferences `raw` to CurrentVersion,
+// in place, returning the version they were at.
+func Migrate(raw map[string]interface{}) (int, error) {
+	from, err := version(raw)
+	if err != nil {
+		return 0, err
+	}
+	if from > CurrentVersion {
+		return from, fmt.Errorf("prefs version %d is newer than the supported one (%d)", from, CurrentVersion)
+	}
+	for _, m := range migrations {
+		if m.from < from {
+			continue
+		}
+		if err := m.migrate(raw); err != nil {
+			return from, fmt.Errorf("migrate prefs from version %d: %v", m.from, err)
+		}
+		raw["version"] = m.from + 1
+	}
+	return from, nil
+}
+
+// MigrateFile upgrades the preferences file at `path` to
+// CurrentVersion, returning the version it was at. The original
+// file is first copied next to it, with a ".v<version>.bak" suffix.
+// Files that are already up to date are left untouched. Encrypted
+// files are not supported, as they could not be encrypted back.
+func MigrateFile(path string) (int, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("migrate prefs: %v", err)
+	}
+	if isEncrypted(b) {
+		return 0, fmt.Errorf("migrate prefs: %s is encrypted, decrypt it first", path)
+	}
+
+	raw := map[string]interface{}{}
+	if err = json.Unmarshal(b, &raw); err != nil {
+		return 0, fmt.Errorf("migrate prefs: %s: %v", path, err)
+	}
+	from, err := Migrate(raw)
+	if err != nil {
+		return from, fmt.Errorf("migrate prefs: %s: %v", path, err)
+	}
+	if from == CurrentVersion {
+		return from, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return from, fmt.Errorf("migrate prefs: %v", err)
+	}
+	backup := fmt.Sprintf("%s.v%d.bak", path, from)
+	if err = ioutil.WriteFile(backup, b, info.Mode()); err != nil {
+		return from, fmt.Errorf("migrate prefs: unable to backup %s: %v", path, err)
+	}
+
+	migrated, err := json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return from, fmt.Errorf("migrate prefs: %v", err)
+	}
+	if err = writeFileAtomic(path, append(migrated, '\n'), info.Mode()); err != nil {
+		return from, fmt.Errorf("migrate prefs: %v", err)
+	}
+	return from, nil
+}
+
+// writeFileAtomic replaces `path` with `b`, going through a temporary
+// file so that readers never observe a partially written file.
+func writeFileAtomic(path string, b []byte, mode os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	if _, err = w.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,886 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package prefs
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	StorageLocal = "local"
+	StorageGCS   = "gcs"
+)
+
+// MasterPrefs collects every preference voicebr
+// needs to run. It is usually loaded from a JSON file.
+type MasterPrefs struct {
+	// Version is the schema version, see CurrentVersion.
+	Version     int         `json:"version"`
+	Vonage      Vonage      `json:"vonage"`
+	Server      Server      `json:"server"`
+	Storage     Storage     `json:"storage"`
+	Delivery    Delivery    `json:"delivery"`
+	Broadcaster Broadcaster `json:"broadcaster"`
+	Recording   Recording   `json:"recording"`
+	Prompts     Prompts     `json:"prompts"`
+	Audit       Audit       `json:"audit"`
+	Events      Events      `json:"events"`
+	Webhooks    Webhooks    `json:"webhooks"`
+	Contacts    Contacts    `json:"contacts"`
+	Admin       Admin       `json:"admin"`
+	Duplicates  Duplicates  `json:"duplicates"`
+	// Transcription configures the transcription of
+	// the stored recordings.
+	Transcription Transcription `json:"transcription"`
+	// Notifications configures who is told about the
+	// completed broadcasts.
+	Notifications Notifications `json:"notifications"`
+	// Costs keeps the estimated cost of the broadcasts
+	// within a budget.
+	Costs Costs `json:"costs"`
+	// Cluster lets many instances run behind a load
+	// balancer.
+	Cluster Cluster `json:"cluster"`
+	// Tracing exports the traces of the broadcasts.
+	Tracing Tracing `json:"tracing"`
+}
+
+// Vonage identifies the Vonage (formerly nexmo) application
+// placing and answering the calls.
+type Vonage struct {
+	AppID string `json:"app_id"`
+	// Number is the number of the application, in E.164
+	// format, e.g. "393331234567".
+	Number string `json:"number"`
+	// Numbers are the other numbers of the application the
+	// broadcasts may be made from, in E.164 format.
+	Numbers []string `json:"numbers"`
+	// CallerIDByCountry calls each recipient from the number,
+	// among Number and Numbers, of the recipient's country,
+	// if any, to make the calls look local.
+	CallerIDByCountry bool `json:"caller_id_by_country"`
+	// PrivateKey is the path of the application private
+	// key, used to sign the API requests.
+	PrivateKey string `json:"private_key"`
+	// PrivateKeyPEM is the PEM encoded private key itself,
+	// e.g. from VOICEBR_VONAGE_PRIVATE_KEY_PEM. It excludes
+	// PrivateKey.
+	PrivateKeyPEM string `json:"private_key_pem"`
+	// BaseURL is the address of the REST API, e.g. a regional
+	// endpoint such as "https://api-us-1.vonage.com", the
+	// global one if empty.
+	BaseURL string `json:"base_url"`
+	// Dial configures the connections to the API.
+	Dial Dial `json:"dial"`
+	// Transport configures the HTTP client of the API
+	// and of the recording downloads.
+	Transport Transport `json:"transport"`
+	// CallTimeout bounds each call attempt, the wait for the
+	// rate limiter included, 30s if zero. RequestTimeout bounds
+	// each attempt of every API request, recording downloads
+	// included, leaving it to the transport if zero.
+	CallTimeout    Duration `json:"call_timeout"`
+	RequestTimeout Duration `json:"request_timeout"`
+	// Breaker fails the requests fast while the API is down.
+	Breaker Breaker `json:"breaker"`
+	// SignatureSecret, if set, is the signature secret of the
+	// account: the webhooks must then be signed with it.
+	// It requires a replay window.
+	SignatureSecret string `json:"signature_secret"`
+	// APIKey and APISecret are the credentials of the account,
+	// required only to manage the application and its numbers.
+	APIKey    string `json:"api_key"`
+	APISecret string `json:"api_secret"`
+}
+
+const (
+	DialPreferIPv4 = "prefer-ipv4"
+	DialPreferIPv6 = "prefer-ipv6"
+	DialIPv4       = "ipv4"
+	DialIPv6       = "ipv6"
+)
+
+// Dial selects the source address of the connections to the
+// API, for multi-homed hosts and for NATs or allowlists that
+// expect a specific egress address.
+type Dial struct {
+	// Family is one of the Dial* constants, or empty to let
+	// the system choose.
+	Family string `json:"family"`
+	// LocalAddr is the source IP of the connections.
+	LocalAddr string `json:"local_addr"`
+	// Interface is the network interface the connections
+	// are made from. It excludes LocalAddr.
+	Interface string `json:"interface"`
+	// FallbackDelay is how long the preferred family is tried
+	// alone before trying the other one too, 300ms if zero.
+	FallbackDelay Duration `json:"fallback_delay"`
+}
+
+// Transport configures the proxy, the certificate authorities,
+// the timeouts and the keep-alive pool of the HTTP client talking
+// to the API. Zero values keep Go's defaults.
+type Transport struct {
+	// Proxy is the URL of the proxy, e.g. "http://proxy:3128".
+	// When empty, HTTPS_PROXY and NO_PROXY are honoured.
+	Proxy string `json:"proxy"`
+	// CABundle is the path of a PEM file of certificate
+	// authorities trusted in addition to the system ones.
+	CABundle string `json:"ca_bundle"`
+	// ConnectTimeout bounds the establishment of the
+	// connections, 30s if zero.
+	ConnectTimeout        Duration `json:"connect_timeout"`
+	TLSHandshakeTimeout   Duration `json:"tls_handshake_timeout"`
+	ResponseHeaderTimeout Duration `json:"response_header_timeout"`
+	// Timeout bounds each request, downloads included,
+	// 2m if zero.
+	Timeout             Duration `json:"timeout"`
+	MaxIdleConns        int      `json:"max_idle_conns"`
+	MaxIdleConnsPerHost int      `json:"max_idle_conns_per_host"`
+	IdleConnTimeout     Duration `json:"idle_conn_timeout"`
+}
+
+// Breaker stops calling the API after Threshold consecutive
+// failures, for Cooldown, failing the queued calls of the
+// broadcasts instead of letting them hang.
+type Breaker struct {
+	// Threshold is the number of consecutive failures opening
+	// the breaker, zero disables it.
+	Threshold int `json:"threshold"`
+	// Cooldown is how long the breaker stays open before
+	// probing the API again, 30s if zero.
+	Cooldown Duration `json:"cooldown"`
+}
+
+// Server configures the web server handling the webhooks.
+type Server struct {
+	// Origin is the canonical protocol and authority the
+	// server is reachable at, e.g. "https://voicebr.example.com".
+	Origin string `json:"origin"`
+	Port   int    `json:"port"`
+	// Host is the interface the server listens on, every
+	// interface if empty.
+	Host string `json:"host"`
+	// AdminAddr, if set, is the "host:port" address the admin
+	// routes and the dashboard are served at, leaving only the
+	// webhooks on Host and Port, e.g. "127.0.0.1:4002".
+	AdminAddr string `json:"admin_addr"`
+	// GRPCAddr, if set, is the "host:port" address the gRPC
+	// control API is served at, e.g. "127.0.0.1:4003". Its
+	// calls are authenticated as the admin routes.
+	GRPCAddr string `json:"grpc_addr"`
+	// Tailnet, if it has a hostname, moves the admin routes
+	// and the dashboard off the public port, serving them
+	// only to the devices of a Tailscale network.
+	Tailnet Tailnet `json:"tailnet"`
+	// ReplayWindow, if set, rejects the webhooks older than it
+	// and the ones already processed within it.
+	ReplayWindow Duration `json:"replay_window"`
+	// Allowlist, if it has ranges or an URL, restricts the
+	// webhooks to the addresses of nexmo.
+	Allowlist Allowlist `json:"allowlist"`
+	// Origins, if it has hosts, lets the webhooks answer with
+	// the origin they were reached at, rather than Origin.
+	Origins Origins `json:"origins"`
+}
+
+// Origins lists the hosts, other than the one of Server.Origin,
+// the server is reachable at.
+type Origins struct {
+	// Hosts are hostnames, with an optional port, or "*."
+	// wildcards matching the subdomains of a domain.
+	Hosts []string `json:"hosts"`
+	// TrustProxy takes the protocol and the host of the
+	// requests from the X-Forwarded-Proto and X-Forwarded-Host
+	// headers set by a reverse proxy.
+	TrustProxy bool `json:"trust_proxy"`
+}
+
+// Allowlist lists the addresses the webhooks are accepted from.
+type Allowlist struct {
+	// CIDRs are the ranges, or single addresses, allowed.
+	CIDRs []string `json:"cidrs"`
+	// URL, if set, publishes further ranges, as a JSON array
+	// or one per line. They are downloaded every Refresh, once
+	// a day if zero.
+	URL     string   `json:"url"`
+	Refresh Duration `json:"refresh"`
+	// TrustProxy takes the address of the callers from the
+	// X-Forwarded-For header set by a reverse proxy.
+	TrustProxy bool `json:"trust_proxy"`
+}
+
+// Tailnet configures the node voicebr embeds in a Tailscale
+// network. It requires a build with the tsnet tag.
+type Tailnet struct {
+	// Hostname is the name of the node in the tailnet.
+	Hostname string `json:"hostname"`
+	// Port is the port the admin routes are served at, 80
+	// if zero.
+	Port int `json:"port"`
+	// StateDir keeps the node's identity across restarts,
+	// a directory under the user's configuration if empty.
+	StateDir string `json:"state_dir"`
+	// AuthKey joins the node to the tailnet the first time
+	// it starts. When empty, a login URL is logged instead.
+	AuthKey string `json:"auth_key"`
+}
+
+const (
+	DuplicatesWarn = "warn"
+	DuplicatesHold = "hold"
+)
+
+// Duplicates configures the detection of the recordings that
+// duplicate a recent one, e.g. because the broadcaster sent
+// the same message twice by mistake.
+type Duplicates struct {
+	// Window is how far back the recordings are compared,
+	// zero disables the detection.
+	Window Duration `json:"window"`
+	// Action is either DuplicatesWarn, which only logs and
+	// audits the duplicates, or DuplicatesHold, which keeps
+	// them from being broadcast until confirmed from the
+	// dashboard.
+	Action string `json:"action"`
+	// Threshold is the similarity, between 0 and 1, above
+	// which two recordings are duplicates. Zero keeps the
+	// default.
+	Threshold float64 `json:"threshold"`
+}
+
+const TranscriptionWhisper = "whisper"
+
+type Transcription struct {
+	// Engine is either TranscriptionWhisper or empty,
+	// which disables the transcription.
+	Engine  string  `json:"engine"`
+	Whisper Whisper `json:"whisper"`
+	// DetectLang identifies the language of the recordings
+	// through the engine, speaking the prompts surrounding
+	// them in the same language to the recipients that do
+	// not have one.
+	DetectLang bool `json:"detect_lang"`
+}
+
+// Whisper configures a local whisper.cpp installation.
+type Whisper struct {
+	// Binary is the path of the whisper.cpp command line
+	// tool, looked up in $PATH if empty.
+	Binary string `json:"binary"`
+	// Model is the path of the ggml model file.
+	Model string `json:"model"`
+	// Lang is the spoken language, detected if empty.
+	Lang    string `json:"lang"`
+	Threads int    `json:"threads"`
+}
+
+type Notifications struct {
+	Email   Email   `json:"email"`
+	Webhook Webhook `json:"webhook"`
+}
+
+// Email configures the SMTP server the summaries of the
+// broadcasts are emailed through. Emails are sent only if
+// Host is set.
+type Email struct {
+	Host string `json:"host"`
+	// Port is 587 if zero.
+	Port int `json:"port"`
+	// Username and Password authenticate through PLAIN
+	// auth, which requires TLS unless Host is a loopback
+	// address. No authentication is made if Username is
+	// empty.
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	// AttachRecording attaches the recordings up to 10MB to
+	// the emails. They are always linked anyway.
+	AttachRecording bool `json:"attach_recording"`
+}
+
+// Webhook configures the URL the start, the completion and the
+// call failures of the broadcasts are posted to, as JSON. Events
+// are posted only if URL is set.
+type Webhook struct {
+	URL string `json:"url"`
+	// Slack posts Slack compatible messages instead, for
+	// incoming webhooks.
+	Slack bool `json:"slack"`
+}
+
+// Contacts configures how the phone numbers of the contacts
+// and of the callers are read.
+type Contacts struct {
+	// CountryCode, e.g. "39", is prepended to the national
+	// numbers. When empty, every number must be international.
+	CountryCode string `json:"country_code"`
+}
+
+// Admin lists who may use the admin routes, the dashboard
+// and the broadcast reports. When no credentials are set,
+// those routes refuse every request.
+type Admin struct {
+	APIKeys []APIKey `json:"api_keys"`
+	// Users authenticate through HTTP basic auth, which is
+	// what browsers use to open the dashboard.
+	Users []User `json:"users"`
+	// OIDC, when its issuer is set, logs in the users of an
+	// OpenID Connect provider.
+	OIDC OIDC `json:"oidc"`
+}
+
+// OIDC configures an OpenID Connect provider, e.g. Google or
+// Keycloak. Its callback URL is the origin followed by
+// "/admin/oidc/callback".
+type OIDC struct {
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// GroupsClaim is the ID token claim listing the groups of
+	// the user, "groups" if empty.
+	GroupsClaim string `json:"groups_claim"`
+	// Roles grant the members of a group, "*" matching every
+	// user, what they may do. Users matching no role are
+	// refused.
+	Roles []Role `json:"roles"`
+}
+
+// Role grants the members of Group either everything, when
+// Admin is set, or the Actions, e.g. "broadcast" or "reports",
+// restricted to the Groups of the broadcast list if not empty.
+type Role struct {
+	Group   string   `json:"group"`
+	Admin   bool     `json:"admin"`
+	Actions []string `json:"actions"`
+	Groups  []string `json:"groups"`
+}
+
+// APIKey is sent either in the X-API-Key header or
+// as a bearer token.
+type APIKey struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+type User struct {
+	Name string `json:"name"`
+	// PasswordHash is the bcrypt hash of the password,
+	// e.g. the output of `htpasswd -nB <name>`, without
+	// the name.
+	PasswordHash string `json:"password_hash"`
+}
+
+type Webhooks struct {
+	// SigningKey signs the per call query parameters of the
+	// outbound calls webhooks. When empty, a random key is
+	// generated on each start, invalidating the calls that
+	// are still in progress.
+	SigningKey string `json:"signing_key"`
+}
+
+// Audit configures the tamper evident audit log of the
+// stored recordings, broadcasts and call attempts. The entries
+// of a broadcast are served at /broadcasts/{id}/audit.
+type Audit struct {
+	// Path is the audit log file, empty disables it.
+	Path string `json:"path"`
+}
+
+// Events configures where the voice events of the calls
+// are published to.
+type Events struct {
+	// Path is the file the events are appended to, as JSON
+	// lines. Empty discards them.
+	Path string `json:"path"`
+}
+
+// Prompts overrides the sentences spoken by voicebr. Texts
+// are text/template templates, e.g. "Parla pure {{.CallerName}}".
+type Prompts struct {
+	// Level is the volume of the prompts, between -1 and 1.
+	Level float64 `json:"level"`
+	// Langs maps a language ("it", "en", ...) to its prompts.
+	// Empty fields keep the builtin value.
+	Langs map[string]PromptSet `json:"langs"`
+	// TTS speaks the prompts with a text-to-speech provider
+	// instead of nexmo's built-in voices.
+	TTS TTS `json:"tts"`
+}
+
+const (
+	TTSAzure      = "azure"
+	TTSElevenLabs = "elevenlabs"
+)
+
+type TTS struct {
+	// Provider is either TTSAzure, TTSElevenLabs or empty,
+	// which keeps nexmo's voices.
+	Provider string `json:"provider"`
+	APIKey   string `json:"api_key"`
+	// Region is the region of the Azure Speech resource.
+	Region string `json:"region"`
+	// Model is the ElevenLabs model, its multilingual
+	// one if empty.
+	Model string `json:"model"`
+	// Voice is the provider's voice of the languages
+	// missing from Voices.
+	Voice  string            `json:"voice"`
+	Voices map[string]string `json:"voices"`
+	// Dir keeps the synthesized prompts across restarts.
+	Dir string `json:"dir"`
+}
+
+type PromptSet struct {
+	Voice    string `json:"voice"`
+	Greeting string `json:"greeting"`
+	Confirm  string `json:"confirm"`
+	TooLong  string `json:"too_long"`
+	Menu     string `json:"menu"`
+	Live     string `json:"live"`
+	Listen   string `json:"listen"`
+	Recorded string `json:"recorded"`
+	End      string `json:"end"`
+	OptOut   string `json:"opt_out"`
+	OptedOut string `json:"opted_out"`
+	Replay   string `json:"replay"`
+	// Templates, TemplateCode, TemplateSent and TemplateUnknown
+	// guide the broadcasters through the templates.
+	Templates       string `json:"templates"`
+	TemplateCode    string `json:"template_code"`
+	TemplateSent    string `json:"template_sent"`
+	TemplateUnknown string `json:"template_unknown"`
+	// IVRMenu, IVRGroup, IVRGroupSet, IVRCanceled and IVRNone
+	// are spoken by the IVR.
+	IVRMenu     string `json:"ivr_menu"`
+	IVRGroup    string `json:"ivr_group"`
+	IVRGroupSet string `json:"ivr_group_set"`
+	IVRCanceled string `json:"ivr_canceled"`
+	IVRNone     string `json:"ivr_none"`
+}
+
+type Recording struct {
+	// Format is one of "mp3", "wav" or "ogg".
+	Format string `json:"format"`
+	// TimeOut is the maximum length of a recording, between
+	// 3s and 2h. Zero keeps nexmo's default.
+	TimeOut Duration `json:"time_out"`
+	// EndOnSilence stops the recording after that much
+	// silence, between 3s and 10s. Zero disables it, leaving
+	// the callers that forget to press # recording until
+	// TimeOut.
+	EndOnSilence Duration `json:"end_on_silence"`
+	BeepStart    bool     `json:"beep_start"`
+	// Confirm tells the callers how long their message is
+	// once recorded, see the confirm prompt.
+	Confirm bool `json:"confirm"`
+	// MaxLength is the maximum length of a broadcast message.
+	// Longer recordings are discarded, and the callers are
+	// offered to record again when Confirm is set. Zero
+	// disables the limit.
+	MaxLength Duration `json:"max_length"`
+	// TrimSilence removes the leading and trailing silence
+	// of the recordings before broadcasting them. Formats
+	// other than wav require ffmpeg.
+	TrimSilence bool `json:"trim_silence"`
+	// Transcode normalizes the recordings, both recorded and
+	// uploaded, before broadcasting them.
+	Transcode Transcode `json:"transcode"`
+	// Loudness normalizes the loudness of the recordings,
+	// after transcoding them, before broadcasting them.
+	Loudness Loudness `json:"loudness"`
+	// DownloadWindow is the time a failed recording download
+	// is retried for before notifying the broadcaster.
+	DownloadWindow Duration `json:"download_window"`
+	// MaxSize is the size, in bytes, of the largest recording
+	// that is downloaded. Zero keeps the default, 128MiB.
+	MaxSize int64 `json:"max_size"`
+	// CacheSize is the memory, in bytes, used to keep the
+	// recordings being broadcast ready to be played. Zero
+	// disables the cache.
+	CacheSize int64 `json:"cache_size"`
+	// Hosted leaves the recordings on nexmo: the broadcasts
+	// stream them from there, through the server, instead of
+	// downloading and storing them. Trimming, transcoding,
+	// loudness, transcripts and duplicates need the audio,
+	// and are skipped.
+	Hosted bool `json:"hosted"`
+	// HostedTTL is how long the URLs streaming the hosted
+	// recordings are valid for, 10 minutes if zero.
+	HostedTTL Duration `json:"hosted_ttl"`
+}
+
+// Transcode configures the ffmpeg pass converting the recordings
+// to audio nexmo streams reliably, in the recording format. The
+// zero values keep the corresponding property of the recording.
+type Transcode struct {
+	Enabled bool `json:"enabled"`
+	// FFmpeg is the path of the ffmpeg executable, looked
+	// up in PATH if empty.
+	FFmpeg string `json:"ffmpeg"`
+	// SampleRate is in Hz, one of 8000, 16000, 24000,
+	// 44100 or 48000.
+	SampleRate int `json:"sample_rate"`
+	// Channels is either 1 or 2.
+	Channels int `json:"channels"`
+}
+
+// Loudness configures the loudness normalization of the
+// recordings, measured as EBU R128 does. Formats other than
+// wav require ffmpeg, see Transcode.FFmpeg.
+type Loudness struct {
+	Normalize bool `json:"normalize"`
+	// Target is the integrated loudness, in LUFS, between
+	// -70 and -5. Zero keeps the default, -23.
+	Target float64 `json:"target"`
+}
+
+// Broadcaster configures how voicebr reports back to a
+// broadcaster whose recording never arrived, e.g. because
+// the call dropped before the message was completed, or
+// could not be downloaded.
+type Broadcaster struct {
+	// RecordTimeout is the time a broadcaster has to
+	// record the message once the call is answered.
+	RecordTimeout Duration `json:"record_timeout"`
+	// NotifyVia is either "sms", "call" or empty, which
+	// disables the notification.
+	NotifyVia   string `json:"notify_via"`
+	FailureText string `json:"failure_text"`
+	// Conference offers the broadcasters to speak live to
+	// the recipients, bridged into a conference, instead of
+	// recording a message.
+	Conference bool `json:"conference"`
+	// Passthrough relays the live speech to the recipients
+	// through websockets, with a lower delay than the
+	// conference, storing it as a recording too.
+	Passthrough bool `json:"passthrough"`
+	// AudioSources lets other services broadcast the audio
+	// they generate, streaming it as 16 bit PCM at 16kHz to
+	// POST /admin/audio/{stream}.
+	AudioSources bool `json:"audio_sources"`
+	// Templates lets the broadcasters broadcast a template,
+	// pressing 3 and typing its code. It requires Conference,
+	// whose menu offers the choice.
+	Templates bool `json:"templates"`
+	// IVR greets the broadcasters with a menu, letting them
+	// record a message, listen to their last one, choose the
+	// group to broadcast to among IVRGroups, or cancel their
+	// last broadcast. It replaces the menu of Conference.
+	IVR bool `json:"ivr"`
+	// IVRGroups are the groups the broadcasters choose from,
+	// typing their position, starting from 1.
+	IVRGroups []string `json:"ivr_groups"`
+}
+
+// Delivery holds the default delivery policy of the broadcast
+// list. Each contact may override it in the contacts file.
+type Delivery struct {
+	MaxAttempts  int      `json:"max_attempts"`
+	RetrySpacing Duration `json:"retry_spacing"`
+	// Voicemail is either "leave" or "hangup".
+	Voicemail string `json:"voicemail"`
+	// QuietHours defer the calls until the recipients'
+	// quiet hours are over.
+	QuietHours QuietHours `json:"quiet_hours"`
+	// TimeZone is the IANA time zone of the contacts without
+	// one, e.g. "Europe/Rome", the system's if empty.
+	TimeZone string `json:"time_zone"`
+	// OptOut lets the recipients press 9, after the message,
+	// to stop receiving the broadcasts.
+	OptOut bool `json:"opt_out"`
+	// Replays is how many times the recipients may press 1,
+	// after the message, to listen to it again. Disabled
+	// if zero.
+	Replays int `json:"replays"`
+	// Loop is how many times the message is played in a
+	// row, once if zero.
+	Loop int `json:"loop"`
+	// Emergency configures the emergency broadcasts, which
+	// are called before the routine ones.
+	Emergency Emergency `json:"emergency"`
+	// Pacing keeps the recipients of close broadcasts from
+	// being called twice in quick succession.
+	Pacing Pacing `json:"pacing"`
+}
+
+// Pacing serializes the calls to each number, placing them at
+// least Gap apart. Merge, if true, plays the recordings of the
+// broadcasts waiting for the same number in a single call.
+type Pacing struct {
+	Gap   Duration `json:"gap"`
+	Merge bool     `json:"merge"`
+}
+
+// Emergency raises the delivery policy of the recipients of the
+// emergency broadcasts: they are called at least MaxAttempts
+// times, at most RetrySpacing apart, 3 times 15s apart if unset.
+type Emergency struct {
+	MaxAttempts  int      `json:"max_attempts"`
+	RetrySpacing Duration `json:"retry_spacing"`
+	// SMS, if not empty, is texted to the recipients together
+	// with the first call.
+	SMS string `json:"sms"`
+}
+
+const (
+	OverBudgetRefuse   = "refuse"
+	OverBudgetTruncate = "truncate"
+)
+
+// Cluster shares the state of the instances running behind a
+// load balancer through a Redis server: the webhooks processed
+// by any of them, the rate limits of the API, and the queue of
+// the broadcasts started by the webhooks, which run on the
+// instance leading the dispatch. The
+// storage must be shared too, e.g. a cloud bucket. Disabled if
+// Redis.Addr is empty.
+type Cluster struct {
+	Redis Redis `json:"redis"`
+	// InstanceID identifies the instance, its host name
+	// followed by a random suffix if empty.
+	InstanceID string `json:"instance_id"`
+	// LeaseTTL is how long the leadership of the dispatch
+	// lasts unless renewed, 15s if zero.
+	LeaseTTL Duration `json:"lease_ttl"`
+}
+
+// Tracing exports the spans covering the lifecycle of the
+// broadcasts, from the answer webhook to the events of their
+// calls, to an OTLP collector over HTTP. Disabled if Endpoint
+// is empty.
+type Tracing struct {
+	// Endpoint is the URL the spans are posted to, e.g.
+	// "http://localhost:4318/v1/traces".
+	Endpoint string `json:"endpoint"`
+	// Headers are added to the export requests, e.g. to
+	// authenticate them.
+	Headers map[string]string `json:"headers"`
+	// ServiceName names the instances in the traces,
+	// "voicebr" if empty.
+	ServiceName string `json:"service_name"`
+	// SampleRatio is the fraction of the traces sampled,
+	// between 0 and 1. Zero samples every trace.
+	SampleRatio float64 `json:"sample_ratio"`
+}
+
+// Redis identifies a Redis server, e.g. at "localhost:6379".
+type Redis struct {
+	Addr     string `json:"addr"`
+	Password string `json:"password"`
+	DB       int    `json:"db"`
+}
+
+// Costs estimates the cost of each broadcast as the number of
+// recipients times MinutesPerCall times the per minute price of
+// their destination.
+type Costs struct {
+	// MaxCostPerBroadcast is the budget of each broadcast, in
+	// the currency of the prices, unlimited if zero.
+	MaxCostPerBroadcast float64 `json:"max_cost_per_broadcast"`
+	// OverBudget is either OverBudgetRefuse, the default, which
+	// calls nobody, or OverBudgetTruncate, which calls the
+	// recipients that still fit in the budget, in order, skipping
+	// the ones that do not.
+	OverBudget string `json:"over_budget"`
+	// Prices maps the prefixes of the destination numbers,
+	// e.g. "39" or "44", to the per minute price. The longest
+	// matching prefix wins.
+	Prices map[string]float64 `json:"prices"`
+	// DefaultPrice is the price of the numbers matching none
+	// of the Prices.
+	DefaultPrice float64 `json:"default_price"`
+	// MinutesPerCall is the billed length of each call, 1 if
+	// zero.
+	MinutesPerCall int `json:"minutes_per_call"`
+}
+
+// QuietHours is the daily interval when the recipients are not
+// called, in their time zone, e.g. from "22:00" to "07:00".
+// Empty values allow calling at any time.
+type QuietHours struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// Storage selects and configures the storage backend.
+type Storage struct {
+	// Kind is either StorageLocal or StorageGCS.
+	Kind  string `json:"kind"`
+	Local Local  `json:"local"`
+	GCS   GCS    `json:"gcs"`
+	// SQLite, when its path is set, moves contacts,
+	// groups and broadcasts into a sqlite database.
+	SQLite SQLite `json:"sqlite"`
+	// Mirror, when its kind is set, keeps a copy of every
+	// recording in a secondary backend.
+	Mirror Mirror `json:"mirror"`
+}
+
+// Mirror configures the warm standby of the recordings.
+type Mirror struct {
+	// Kind is either StorageLocal, StorageGCS or empty,
+	// which disables the mirror.
+	Kind  string `json:"kind"`
+	Local Local  `json:"local"`
+	GCS   GCS    `json:"gcs"`
+	// ReconcileInterval is the time between two comparisons
+	// of the stores, which copy the missing recordings.
+	ReconcileInterval Duration `json:"reconcile_interval"`
+}
+
+type SQLite struct {
+	Path string `json:"path"`
+}
+
+type Local struct {
+	RootDir string `json:"root_dir"`
+}
+
+type GCS struct {
+	Bucket string `json:"bucket"`
+	// Prefix is prepended to every object name, allowing
+	// to share a bucket between deployments.
+	Prefix string `json:"prefix"`
+	// CredentialsFile is the path to the service account
+	// JSON key used both to authenticate and to sign URLs.
+	// When empty, the application default credentials are
+	// used and the recordings are not served with signed URLs.
+	CredentialsFile string `json:"credentials_file"`
+	// SignedURLExpiry is the lifetime of the URLs given to
+	// nexmo for playing the recordings. Zero serves them
+	// through voicebr instead.
+	SignedURLExpiry Duration `json:"signed_url_expiry"`
+}
+
+// Default returns the preferences used when no
+// file is provided.
+func Default() *MasterPrefs {
+	return &MasterPrefs{
+		Version: CurrentVersion,
+		Server:  Server{Port: 4001},
+		Storage: Storage{
+			Kind:  StorageLocal,
+			Local: Local{RootDir: "."},
+			GCS: GCS{
+				SignedURLExpiry: Duration(time.Hour),
+			},
+			Mirror: Mirror{
+				GCS: GCS{
+					SignedURLExpiry: Duration(time.Hour),
+				},
+				ReconcileInterval: Duration(time.Hour),
+			},
+		},
+		Delivery: Delivery{
+			MaxAttempts:  1,
+			RetrySpacing: Duration(time.Minute),
+			Voicemail:    "leave",
+		},
+		Broadcaster: Broadcaster{
+			RecordTimeout: Duration(10 * time.Minute),
+			NotifyVia:     "sms",
+			FailureText:   "Il tuo messaggio non è stato inviato, riprova.",
+		},
+		Recording: Recording{
+			Format:         "mp3",
+			EndOnSilence:   Duration(5 * time.Second),
+			BeepStart:      true,
+			Confirm:        true,
+			DownloadWindow: Duration(10 * time.Minute),
+			CacheSize:      64 << 20,
+		},
+		Prompts: Prompts{
+			Level: 0.5,
+		},
+		Duplicates: Duplicates{
+			Window: Duration(10 * time.Minute),
+			Action: DuplicatesWarn,
+		},
+	}
+}
+
+// Decode reads JSON encoded preferences from `r`. Fields
+// that are not present keep their default value. If `r` is
+// age encrypted, it is decrypted in memory using the identity
+// found in the environment, see EnvPassphrase. Preferences
+// of older versions are migrated in memory.
+func Decode(r io.Reader) (*MasterPrefs, error) {
+	r, err := plaintext(r)
+	if err != nil {
+		return nil, fmt.Errorf("decode prefs: %v", err)
+	}
+
+	raw := map[string]interface{}{}
+	if err = json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("decode prefs: %v", err)
+	}
+	if _, err = Migrate(raw); err != nil {
+		return nil, fmt.Errorf("decode prefs: %v", err)
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("decode prefs: %v", err)
+	}
+
+	p := Default()
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("decode prefs: %v", err)
+	}
+	return p, nil
+}
+
+// plaintext returns `r` itself, or a reader over its decrypted
+// contents if it is age encrypted.
+func plaintext(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if start, _ := br.Peek(64); isEncrypted(start) {
+		return decrypt(br)
+	}
+	return br, nil
+}
+
+// Load opens and decodes the preferences file at `path`.
+func Load(path string) (*MasterPrefs, error) {
+	return LoadLayers(path)
+}
+
+// Duration is a time.Duration that is encoded in
+// JSON using its string representation, e.g. "1m30s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration should be a string, e.g. \"1m30s\": %v", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
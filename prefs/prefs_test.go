@@ -0,0 +1,218 @@
+package prefs_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/jecoz/voicebr/prefs"
+)
+
+const sample = `{"storage": {"kind": "gcs", "gcs": {"bucket": "voicebr"}}}`
+
+func TestDecode(t *testing.T) {
+	p, err := prefs.Decode(strings.NewReader(sample))
+	if err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if p.Storage.Kind != prefs.StorageGCS || p.Storage.GCS.Bucket != "voicebr" {
+		t.Fatalf("Unexpected storage prefs: %+v", p.Storage)
+	}
+	if p.Delivery.MaxAttempts != 1 {
+		t.Fatalf("Defaults were not applied: %+v", p.Delivery)
+	}
+}
+
+func TestDecode_encrypted(t *testing.T) {
+	r, err := age.NewScryptRecipient("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, sample)
+	w.Close()
+
+	os.Setenv(prefs.EnvPassphrase, "wrong")
+	if _, err = prefs.Decode(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Fatal("Decode succeeded with the wrong passphrase")
+	}
+
+	os.Setenv(prefs.EnvPassphrase, "secret")
+	defer os.Unsetenv(prefs.EnvPassphrase)
+	p, err := prefs.Decode(&buf)
+	if err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if p.Storage.GCS.Bucket != "voicebr" {
+		t.Fatalf("Unexpected storage prefs: %+v", p.Storage)
+	}
+}
+
+func TestLoadLayers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "voicebr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"voicebr.json":         `{"storage": {"kind": "gcs", "gcs": {"bucket": "base", "prefix": "p"}}, "delivery": {"max_attempts": 2}}`,
+		"voicebr.staging.json": `{"storage": {"gcs": {"bucket": "staging"}}}`,
+		"voicebr.local.json":   `{"delivery": {"max_attempts": 5}}`,
+	}
+	for k, v := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, k), []byte(v), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	base := filepath.Join(dir, "voicebr.json")
+	layers := prefs.Layers(base, "staging")
+	want := []string{base, filepath.Join(dir, "voicebr.staging.json"), filepath.Join(dir, "voicebr.local.json")}
+	if !reflect.DeepEqual(layers, want) {
+		t.Fatalf("Wanted layers %v, found %v", want, layers)
+	}
+	if layers := prefs.Layers(base, "production"); len(layers) != 2 {
+		t.Fatalf("Missing overlay was not skipped: %v", layers)
+	}
+
+	p, err := prefs.LoadLayers(layers...)
+	if err != nil {
+		t.Fatalf("Unexpected load error: %v", err)
+	}
+	if p.Storage.GCS.Bucket != "staging" || p.Storage.GCS.Prefix != "p" {
+		t.Fatalf("Objects were not merged: %+v", p.Storage.GCS)
+	}
+	if p.Delivery.MaxAttempts != 5 || p.Delivery.Voicemail != "leave" {
+		t.Fatalf("Unexpected delivery prefs: %+v", p.Delivery)
+	}
+}
+
+func TestMigrateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "voicebr-prefs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "voicebr.json")
+	old := `{"delivery": {"max_attempts": 3, "retry_spacing": 120000000000}}`
+	if err = ioutil.WriteFile(path, []byte(old), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	from, err := prefs.MigrateFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected migrate error: %v", err)
+	}
+	if from != 0 {
+		t.Fatalf("Wanted version 0, found %d", from)
+	}
+	if b, _ := ioutil.ReadFile(path + ".v0.bak"); string(b) != old {
+		t.Fatalf("Unexpected backup contents: %q", b)
+	}
+
+	p, err := prefs.Load(path)
+	if err != nil {
+		t.Fatalf("Unexpected load error: %v", err)
+	}
+	if p.Version != prefs.CurrentVersion || p.Delivery.RetrySpacing != prefs.Duration(2*time.Minute) {
+		t.Fatalf("Unexpected migrated prefs: %+v", p)
+	}
+
+	if from, err = prefs.MigrateFile(path); err != nil || from != prefs.CurrentVersion {
+		t.Fatalf("Wanted an up to date file, found version %d (%v)", from, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	p := prefs.Default()
+	p.Vonage = prefs.Vonage{AppID: "app", Number: "393331234567", PrivateKey: "key.pem"}
+	p.Server.Origin = "https://voicebr.example.com"
+	p.Delivery.Voicemail = ""
+	if err := p.Validate(); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+	if p.Delivery.Voicemail != "leave" {
+		t.Fatalf("Defaults were not filled: %+v", p.Delivery)
+	}
+
+	p.Vonage.Number = "+39 333 1234567"
+	p.Server.Origin = "http://voicebr.example.com/hooks"
+	p.Server.Port = 70000
+	p.Vonage.Transport.Proxy = "ftp://proxy.example.com"
+	p.Server.AdminAddr = "127.0.0.1"
+	err := p.Validate()
+	errs, ok := err.(prefs.ValidationErrors)
+	if !ok {
+		t.Fatalf("Wanted validation errors, found %v", err)
+	}
+	paths := []string{}
+	for _, v := range errs {
+		paths = append(paths, v.Path)
+	}
+	if want := []string{"vonage.number", "vonage.transport.proxy", "server.origin", "server.port", "server.admin_addr"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("Wanted errors on %v, found %v", want, paths)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	p := prefs.Default()
+	err := p.ApplyEnv([]string{
+		"VOICEBR_VONAGE_APP_ID=app",
+		"VOICEBR_PORT=8080",
+		"VOICEBR_DELIVERY_RETRY_SPACING=30s",
+		"VOICEBR_RECORDING_TRIM_SILENCE=true",
+		`VOICEBR_ADMIN_API_KEYS=[{"name":"ci","key":"secret"}]`,
+		"VOICEBR_ENV=staging",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected env error: %v", err)
+	}
+	if p.Vonage.AppID != "app" || p.Server.Port != 8080 {
+		t.Fatalf("Unexpected prefs: %+v, %+v", p.Vonage, p.Server)
+	}
+	if p.Delivery.RetrySpacing != prefs.Duration(30*time.Second) || !p.Recording.TrimSilence {
+		t.Fatalf("Unexpected prefs: %+v, %+v", p.Delivery, p.Recording)
+	}
+	if len(p.Admin.APIKeys) != 1 || p.Admin.APIKeys[0].Key != "secret" {
+		t.Fatalf("Unexpected api keys: %+v", p.Admin.APIKeys)
+	}
+
+	// The full name wins over the alias.
+	if err = p.ApplyEnv([]string{"VOICEBR_PORT=1", "VOICEBR_SERVER_PORT=2"}); err != nil {
+		t.Fatalf("Unexpected env error: %v", err)
+	}
+	if p.Server.Port != 2 {
+		t.Fatalf("Wanted port 2, found %d", p.Server.Port)
+	}
+	if err = p.ApplyEnv([]string{"VOICEBR_SERVER_PORT=http"}); err == nil {
+		t.Fatalf("Wanted error on invalid port")
+	}
+}
+
+func TestSet(t *testing.T) {
+	p := prefs.Default()
+	if err := p.Set("storage.gcs.bucket", "voicebr"); err != nil {
+		t.Fatalf("Unexpected set error: %v", err)
+	}
+	if p.Storage.GCS.Bucket != "voicebr" {
+		t.Fatalf("Wanted bucket voicebr, found %q", p.Storage.GCS.Bucket)
+	}
+	for _, v := range []string{"storage.nope", "storage.gcs", "delivery.max_attempts.x"} {
+		if err := p.Set(v, "1"); err == nil {
+			t.Fatalf("Wanted error on %s", v)
+		}
+	}
+}
@@ -0,0 +1,448 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package prefs
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jecoz/voicebr/phone"
+)
+
+// FieldError reports an invalid preference.
+type FieldError struct {
+	// Path is the JSON path of the field, e.g. "server.port".
+	Path string
+	Err  error
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+// ValidationErrors lists every invalid preference.
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, v := range e {
+		lines[i] = v.Error()
+	}
+	return "invalid preferences:\n\t" + strings.Join(lines, "\n\t")
+}
+
+func (e *ValidationErrors) add(path string, format string, args ...interface{}) {
+	*e = append(*e, FieldError{Path: path, Err: fmt.Errorf(format, args...)})
+}
+
+// Validate fills the empty fields that have a default value,
+// see Default, then checks `p`. The returned error, if any,
+// is a ValidationErrors listing every invalid field.
+func (p *MasterPrefs) Validate() error {
+	p.fillDefaults()
+
+	var errs ValidationErrors
+	if p.Vonage.AppID == "" {
+		errs.add("vonage.app_id", "required")
+	}
+	switch v := p.Vonage; {
+	case v.PrivateKey == "" && v.PrivateKeyPEM == "":
+		errs.add("vonage.private_key", "required, or set private_key_pem")
+	case v.PrivateKey != "" && v.PrivateKeyPEM != "":
+		errs.add("vonage.private_key", "set either a private key path or private_key_pem")
+	}
+	if p.Vonage.Number == "" {
+		errs.add("vonage.number", "required")
+	} else if n, err := phone.Normalize(p.Vonage.Number, ""); err != nil {
+		errs.add("vonage.number", "%v", err)
+	} else if n != strings.TrimPrefix(p.Vonage.Number, "+") {
+		errs.add("vonage.number", "%q is not in E.164 format, e.g. %q", p.Vonage.Number, n)
+	}
+	for i, v := range p.Vonage.Numbers {
+		if n, err := phone.Normalize(v, ""); err != nil {
+			errs.add(fmt.Sprintf("vonage.numbers[%d]", i), "%v", err)
+		} else if n != strings.TrimPrefix(v, "+") {
+			errs.add(fmt.Sprintf("vonage.numbers[%d]", i), "%q is not in E.164 format, e.g. %q", v, n)
+		}
+	}
+	if b := p.Vonage.BaseURL; b != "" {
+		if u, err := url.Parse(b); err != nil || u.Host == "" || u.Scheme != "https" && !isLoopback(u.Hostname()) {
+			errs.add("vonage.base_url", "%q is not an https URL", b)
+		}
+	}
+	switch d := p.Vonage.Dial; d.Family {
+	case "", DialPreferIPv4, DialPreferIPv6, DialIPv4, DialIPv6:
+	default:
+		errs.add("vonage.dial.family", "unknown family %q", d.Family)
+	}
+	if d := p.Vonage.Dial; d.LocalAddr != "" {
+		if d.Interface != "" {
+			errs.add("vonage.dial.local_addr", "set either a local address or an interface")
+		} else if net.ParseIP(d.LocalAddr) == nil {
+			errs.add("vonage.dial.local_addr", "%q is not an IP address", d.LocalAddr)
+		}
+	}
+	if t := p.Vonage.Transport; t.Proxy != "" {
+		if u, err := url.Parse(t.Proxy); err != nil || u.Host == "" {
+			errs.add("vonage.transport.proxy", "%q is not a valid URL", t.Proxy)
+		} else if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5" {
+			errs.add("vonage.transport.proxy", "unsupported scheme %q", u.Scheme)
+		}
+	}
+	if t := p.Vonage.Transport; t.ConnectTimeout < 0 || t.TLSHandshakeTimeout < 0 || t.ResponseHeaderTimeout < 0 || t.Timeout < 0 || t.IdleConnTimeout < 0 {
+		errs.add("vonage.transport", "timeouts must not be negative")
+	}
+	if t := p.Vonage.Transport; t.MaxIdleConns < 0 || t.MaxIdleConnsPerHost < 0 {
+		errs.add("vonage.transport", "max_idle_conns and max_idle_conns_per_host must not be negative")
+	}
+	if p.Vonage.CallTimeout < 0 || p.Vonage.RequestTimeout < 0 {
+		errs.add("vonage", "call_timeout and request_timeout must not be negative")
+	}
+	if b := p.Vonage.Breaker; b.Threshold < 0 || b.Cooldown < 0 {
+		errs.add("vonage.breaker", "threshold and cooldown must not be negative")
+	}
+	if err := validateOrigin(p.Server.Origin); err != nil {
+		errs.add("server.origin", "%v", err)
+	}
+	for _, v := range p.Server.Origins.Hosts {
+		if strings.ContainsAny(v, "/?#@ ") || v == "" || strings.Contains(v[1:], "*") {
+			errs.add("server.origins.hosts", "%q is not a valid host", v)
+		}
+	}
+	if p.Server.Port < 1 || p.Server.Port > 65535 {
+		errs.add("server.port", "%d is not between 1 and 65535", p.Server.Port)
+	}
+	if a := p.Server.AdminAddr; a != "" {
+		if _, port, err := net.SplitHostPort(a); err != nil {
+			errs.add("server.admin_addr", "%v", err)
+		} else if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			errs.add("server.admin_addr", "%q is not a port between 1 and 65535", port)
+		} else if n == p.Server.Port {
+			errs.add("server.admin_addr", "port %d is already used by the webhooks", n)
+		}
+	}
+	if a := p.Server.GRPCAddr; a != "" {
+		if _, port, err := net.SplitHostPort(a); err != nil {
+			errs.add("server.grpc_addr", "%v", err)
+		} else if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			errs.add("server.grpc_addr", "%q is not a port between 1 and 65535", port)
+		} else if n == p.Server.Port {
+			errs.add("server.grpc_addr", "port %d is already used by the webhooks", n)
+		} else if p.Server.GRPCAddr == p.Server.AdminAddr {
+			errs.add("server.grpc_addr", "%q is already used by the admin routes", p.Server.GRPCAddr)
+		}
+	}
+	if t := p.Server.Tailnet; t.Hostname != "" && (t.Port < 0 || t.Port > 65535) {
+		errs.add("server.tailnet.port", "%d is not between 1 and 65535", t.Port)
+	}
+	if p.Server.ReplayWindow < 0 {
+		errs.add("server.replay_window", "must not be negative")
+	}
+	if (p.Vonage.APIKey == "") != (p.Vonage.APISecret == "") {
+		errs.add("vonage.api_key", "set together with vonage.api_secret")
+	}
+	if p.Vonage.SignatureSecret != "" && p.Server.ReplayWindow == 0 {
+		errs.add("vonage.signature_secret", "requires server.replay_window")
+	}
+	for i, v := range p.Server.Allowlist.CIDRs {
+		if _, _, err := net.ParseCIDR(v); err != nil && net.ParseIP(v) == nil {
+			errs.add(fmt.Sprintf("server.allowlist.cidrs[%d]", i), "%q is not an IP range", v)
+		}
+	}
+	if u := p.Server.Allowlist.URL; u != "" {
+		if v, err := url.Parse(u); err != nil || v.Host == "" || v.Scheme != "https" && !isLoopback(v.Hostname()) {
+			errs.add("server.allowlist.url", "%q is not an https URL", u)
+		}
+	}
+	if p.Server.Allowlist.Refresh < 0 {
+		errs.add("server.allowlist.refresh", "must not be negative")
+	}
+	if cc := strings.TrimPrefix(p.Contacts.CountryCode, "+"); cc != "" && !isCountryCode(cc) {
+		errs.add("contacts.country_code", "%q is not a country code", p.Contacts.CountryCode)
+	}
+
+	for _, v := range []struct{ path, kind string }{
+		{"storage.kind", p.Storage.Kind},
+		{"storage.mirror.kind", p.Storage.Mirror.Kind},
+	} {
+		switch v.kind {
+		case "", StorageLocal, StorageGCS:
+		default:
+			errs.add(v.path, "unknown storage kind %q", v.kind)
+		}
+	}
+	if p.Storage.Kind == StorageGCS && p.Storage.GCS.Bucket == "" {
+		errs.add("storage.gcs.bucket", "required by the gcs storage")
+	}
+	if p.Storage.Mirror.Kind == StorageGCS && p.Storage.Mirror.GCS.Bucket == "" {
+		errs.add("storage.mirror.gcs.bucket", "required by the gcs storage")
+	}
+
+	if p.Recording.HostedTTL < 0 {
+		errs.add("recording.hosted_ttl", "must not be negative")
+	}
+	if p.Delivery.MaxAttempts < 1 {
+		errs.add("delivery.max_attempts", "must be at least 1")
+	}
+	if q := p.Delivery.QuietHours; q.Start != "" || q.End != "" {
+		if _, err := time.Parse("15:04", q.Start); err != nil {
+			errs.add("delivery.quiet_hours.start", "%q is not a time of day, e.g. \"22:00\"", q.Start)
+		}
+		if _, err := time.Parse("15:04", q.End); err != nil {
+			errs.add("delivery.quiet_hours.end", "%q is not a time of day, e.g. \"07:00\"", q.End)
+		}
+	}
+	if tz := p.Delivery.TimeZone; tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil {
+			errs.add("delivery.time_zone", "%v", err)
+		}
+	}
+	switch p.Delivery.Voicemail {
+	case "leave", "hangup":
+	default:
+		errs.add("delivery.voicemail", "either \"leave\" or \"hangup\", found %q", p.Delivery.Voicemail)
+	}
+	if e := p.Delivery.Emergency; e.MaxAttempts < 0 || e.RetrySpacing < 0 {
+		errs.add("delivery.emergency", "max_attempts and retry_spacing must not be negative")
+	}
+	if p.Delivery.Replays < 0 {
+		errs.add("delivery.replays", "must not be negative")
+	}
+	if p.Delivery.Loop < 0 {
+		errs.add("delivery.loop", "must not be negative")
+	}
+	if p.Delivery.Pacing.Gap < 0 {
+		errs.add("delivery.pacing.gap", "must not be negative")
+	}
+	switch p.Broadcaster.NotifyVia {
+	case "", "sms", "call":
+	default:
+		errs.add("broadcaster.notify_via", "either \"sms\", \"call\" or empty, found %q", p.Broadcaster.NotifyVia)
+	}
+	if n := len(p.Broadcaster.IVRGroups); n > 99 {
+		errs.add("broadcaster.ivr_groups", "at most 99 groups can be typed, found %d", n)
+	}
+	if p.Prompts.Level < -1 || p.Prompts.Level > 1 {
+		errs.add("prompts.level", "%v is not between -1 and 1", p.Prompts.Level)
+	}
+
+	switch t := p.Prompts.TTS; t.Provider {
+	case "":
+	case TTSAzure:
+		if t.APIKey == "" || t.Region == "" {
+			errs.add("prompts.tts", "api_key and region are required by azure")
+		}
+	case TTSElevenLabs:
+		if t.APIKey == "" {
+			errs.add("prompts.tts.api_key", "required by elevenlabs")
+		}
+		if t.Voice == "" && len(t.Voices) == 0 {
+			errs.add("prompts.tts.voice", "required by elevenlabs")
+		}
+	default:
+		errs.add("prompts.tts.provider", "unknown provider %q", t.Provider)
+	}
+
+	switch p.Transcription.Engine {
+	case "":
+		if p.Transcription.DetectLang {
+			errs.add("transcription.detect_lang", "requires a transcription engine")
+		}
+	case TranscriptionWhisper:
+		if p.Transcription.Whisper.Model == "" {
+			errs.add("transcription.whisper.model", "required by the whisper engine")
+		}
+	default:
+		errs.add("transcription.engine", "unknown engine %q", p.Transcription.Engine)
+	}
+	if e := p.Notifications.Email; e.Host != "" {
+		if e.Port < 0 || e.Port > 65535 {
+			errs.add("notifications.email.port", "%d is not a valid port", e.Port)
+		}
+		if _, err := mail.ParseAddress(e.From); err != nil {
+			errs.add("notifications.email.from", "%v", err)
+		}
+		if len(e.To) == 0 {
+			errs.add("notifications.email.to", "at least one address is required")
+		}
+		for _, v := range e.To {
+			if _, err := mail.ParseAddress(v); err != nil {
+				errs.add("notifications.email.to", "%q: %v", v, err)
+			}
+		}
+	}
+	if h := p.Notifications.Webhook.URL; h != "" {
+		if u, err := url.Parse(h); err != nil || u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+			errs.add("notifications.webhook.url", "%q is not an http(s) URL", h)
+		}
+	}
+	if p.Costs.MaxCostPerBroadcast < 0 {
+		errs.add("costs.max_cost_per_broadcast", "must not be negative")
+	}
+	switch p.Costs.OverBudget {
+	case "", OverBudgetRefuse, OverBudgetTruncate:
+	default:
+		errs.add("costs.over_budget", "either %q or %q, found %q", OverBudgetRefuse, OverBudgetTruncate, p.Costs.OverBudget)
+	}
+	for prefix, price := range p.Costs.Prices {
+		if _, err := strconv.ParseUint(prefix, 10, 64); err != nil || price < 0 {
+			errs.add("costs.prices", "%q: %v is not a valid prefix and price", prefix, price)
+		}
+	}
+	if p.Costs.DefaultPrice < 0 || p.Costs.MinutesPerCall < 0 {
+		errs.add("costs", "default_price and minutes_per_call must not be negative")
+	}
+	switch p.Duplicates.Action {
+	case DuplicatesWarn, DuplicatesHold:
+	default:
+		errs.add("duplicates.action", "unknown action %q", p.Duplicates.Action)
+	}
+	if p.Broadcaster.Passthrough && !p.Broadcaster.Conference {
+		errs.add("broadcaster.passthrough", "requires broadcaster.conference")
+	}
+	if p.Recording.MaxSize < 0 {
+		errs.add("recording.max_size", "must not be negative")
+	}
+	switch t := p.Recording.Transcode; t.SampleRate {
+	case 0, 8000, 16000, 24000, 44100, 48000:
+	default:
+		errs.add("recording.transcode.sample_rate", "unsupported sample rate %d", t.SampleRate)
+	}
+	if c := p.Recording.Transcode.Channels; c < 0 || c > 2 {
+		errs.add("recording.transcode.channels", "either 1 or 2, found %d", c)
+	}
+	if l := p.Recording.Loudness.Target; l != 0 && (l < -70 || l > -5) {
+		errs.add("recording.loudness.target", "%v LUFS is not between -70 and -5", l)
+	}
+	if c := p.Cluster; c.Redis.DB < 0 || c.LeaseTTL < 0 {
+		errs.add("cluster", "redis.db and lease_ttl must not be negative")
+	} else if c.Redis.Addr == "" && (c.InstanceID != "" || c.LeaseTTL > 0) {
+		errs.add("cluster.redis.addr", "required by the cluster")
+	}
+	if t := p.Tracing; t.Endpoint != "" {
+		if u, err := url.Parse(t.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs.add("tracing.endpoint", "%q is not an http(s) URL", t.Endpoint)
+		}
+	}
+	if r := p.Tracing.SampleRatio; r < 0 || r > 1 {
+		errs.add("tracing.sample_ratio", "%v is not between 0 and 1", r)
+	}
+	if t := p.Duplicates.Threshold; t < 0 || t > 1 {
+		errs.add("duplicates.threshold", "%v is not between 0 and 1", t)
+	}
+	if o := p.Admin.OIDC; o.Issuer != "" {
+		if u, err := url.Parse(o.Issuer); err != nil || u.Scheme != "https" && !isLoopback(u.Hostname()) {
+			errs.add("admin.oidc.issuer", "%q is not an https URL", o.Issuer)
+		}
+		if o.ClientID == "" {
+			errs.add("admin.oidc.client_id", "required")
+		}
+		if len(o.Roles) == 0 {
+			errs.add("admin.oidc.roles", "no role is granted, every user would be refused")
+		}
+		for i, v := range o.Roles {
+			if v.Group == "" {
+				errs.add(fmt.Sprintf("admin.oidc.roles[%d].group", i), "required, use \"*\" to match every user")
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// fillDefaults sets the empty fields that have a default
+// value to it.
+func (p *MasterPrefs) fillDefaults() {
+	d := Default()
+	if p.Server.Port == 0 {
+		p.Server.Port = d.Server.Port
+	}
+	if p.Storage.Kind == "" {
+		p.Storage.Kind = d.Storage.Kind
+	}
+	if p.Storage.Kind == StorageLocal && p.Storage.Local.RootDir == "" {
+		p.Storage.Local.RootDir = d.Storage.Local.RootDir
+	}
+	if p.Delivery.MaxAttempts == 0 {
+		p.Delivery.MaxAttempts = d.Delivery.MaxAttempts
+	}
+	if p.Delivery.Voicemail == "" {
+		p.Delivery.Voicemail = d.Delivery.Voicemail
+	}
+	if p.Recording.Format == "" {
+		p.Recording.Format = d.Recording.Format
+	}
+	if p.Duplicates.Action == "" {
+		p.Duplicates.Action = d.Duplicates.Action
+	}
+}
+
+func isCountryCode(s string) bool {
+	if len(s) > 3 || s[0] == '0' {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// validateOrigin checks that `origin` is an absolute HTTPS URL
+// without a path. Plain HTTP is accepted for loopback hosts only,
+// for local development.
+func validateOrigin(origin string) error {
+	if origin == "" {
+		return fmt.Errorf("required")
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return err
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%q is not an absolute URL", origin)
+	}
+	if strings.TrimSuffix(u.Path, "/") != "" || u.RawQuery != "" {
+		return fmt.Errorf("%q must not have a path or a query", origin)
+	}
+	switch u.Scheme {
+	case "https":
+	case "http":
+		if !isLoopback(u.Hostname()) {
+			return fmt.Errorf("%q must use https", origin)
+		}
+	default:
+		return fmt.Errorf("%q must use https", origin)
+	}
+	return nil
+}
+
+// isLoopback reports whether `host` is the local machine, which
+// is allowed to be reached through plain http while testing.
+func isLoopback(host string) bool {
+	ip := net.ParseIP(host)
+	return host == "localhost" || ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,888 @@
+// Broadcast voice messages to a set of recipients.
+// Copyright (C) 2019 Daniel Morandini (jecoz)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: rpc/controlpb/control.proto
+
+package controlpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type StartBroadcastRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Recording is the name of either a recording or a template.
+	Recording string `protobuf:"bytes,1,opt,name=recording,proto3" json:"recording,omitempty"`
+	// Group is empty for the whole broadcast list.
+	Group string `protobuf:"bytes,2,opt,name=group,proto3" json:"group,omitempty"`
+	// From is the number shown to the recipients, one of those
+	// owned by the application.
+	From string `protobuf:"bytes,3,opt,name=from,proto3" json:"from,omitempty"`
+	// Priority is either "routine", when empty, or "emergency".
+	Priority      string `protobuf:"bytes,4,opt,name=priority,proto3" json:"priority,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StartBroadcastRequest) Reset() {
+	*x = StartBroadcastRequest{}
+	mi := &file_rpc_controlpb_control_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StartBroadcastRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StartBroadcastRequest) ProtoMessage() {}
+
+func (x *StartBroadcastRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rpc_controlpb_control_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StartBroadcastRequest.ProtoReflect.Descriptor instead.
+func (*StartBroadcastRequest) Descriptor() ([]byte, []int) {
+	return file_rpc_controlpb_control_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *StartBroadcastRequest) GetRecording() string {
+	if x != nil {
+		return x.Recording
+	}
+	return ""
+}
+
+func (x *StartBroadcastRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *StartBroadcastRequest) GetFrom() string {
+	if x != nil {
+		return x.From
+	}
+	return ""
+}
+
+func (x *StartBroadcastRequest) GetPriority() string {
+	if x != nil {
+		return x.Priority
+	}
+	return ""
+}
+
+type GetBroadcastRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetBroadcastRequest) Reset() {
+	*x = GetBroadcastRequest{}
+	mi := &file_rpc_controlpb_control_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetBroadcastRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetBroadcastRequest) ProtoMessage() {}
+
+func (x *GetBroadcastRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rpc_controlpb_control_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetBroadcastRequest.ProtoReflect.Descriptor instead.
+func (*GetBroadcastRequest) Descriptor() ([]byte, []int) {
+	return file_rpc_controlpb_control_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetBroadcastRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type Broadcast struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Id is zero when the storage does not keep track of
+	// the broadcasts.
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Recording     string                 `protobuf:"bytes,2,opt,name=recording,proto3" json:"recording,omitempty"`
+	From          string                 `protobuf:"bytes,3,opt,name=from,proto3" json:"from,omitempty"`
+	Priority      string                 `protobuf:"bytes,4,opt,name=priority,proto3" json:"priority,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	Recipients    []*Recipient           `protobuf:"bytes,6,rep,name=recipients,proto3" json:"recipients,omitempty"`
+	Attempts      []*CallAttempt         `protobuf:"bytes,7,rep,name=attempts,proto3" json:"attempts,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Broadcast) Reset() {
+	*x = Broadcast{}
+	mi := &file_rpc_controlpb_control_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Broadcast) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Broadcast) ProtoMessage() {}
+
+func (x *Broadcast) ProtoReflect() protoreflect.Message {
+	mi := &file_rpc_controlpb_control_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Broadcast.ProtoReflect.Descriptor instead.
+func (*Broadcast) Descriptor() ([]byte, []int) {
+	return file_rpc_controlpb_control_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Broadcast) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Broadcast) GetRecording() string {
+	if x != nil {
+		return x.Recording
+	}
+	return ""
+}
+
+func (x *Broadcast) GetFrom() string {
+	if x != nil {
+		return x.From
+	}
+	return ""
+}
+
+func (x *Broadcast) GetPriority() string {
+	if x != nil {
+		return x.Priority
+	}
+	return ""
+}
+
+func (x *Broadcast) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Broadcast) GetRecipients() []*Recipient {
+	if x != nil {
+		return x.Recipients
+	}
+	return nil
+}
+
+func (x *Broadcast) GetAttempts() []*CallAttempt {
+	if x != nil {
+		return x.Attempts
+	}
+	return nil
+}
+
+type Recipient struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Number        string                 `protobuf:"bytes,1,opt,name=number,proto3" json:"number,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Lang          string                 `protobuf:"bytes,3,opt,name=lang,proto3" json:"lang,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Recipient) Reset() {
+	*x = Recipient{}
+	mi := &file_rpc_controlpb_control_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Recipient) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Recipient) ProtoMessage() {}
+
+func (x *Recipient) ProtoReflect() protoreflect.Message {
+	mi := &file_rpc_controlpb_control_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Recipient.ProtoReflect.Descriptor instead.
+func (*Recipient) Descriptor() ([]byte, []int) {
+	return file_rpc_controlpb_control_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Recipient) GetNumber() string {
+	if x != nil {
+		return x.Number
+	}
+	return ""
+}
+
+func (x *Recipient) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Recipient) GetLang() string {
+	if x != nil {
+		return x.Lang
+	}
+	return ""
+}
+
+type CallAttempt struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Number  string                 `protobuf:"bytes,1,opt,name=number,proto3" json:"number,omitempty"`
+	Attempt int32                  `protobuf:"varint,2,opt,name=attempt,proto3" json:"attempt,omitempty"`
+	// Status is either "created" or "failed".
+	Status        string                 `protobuf:"bytes,3,opt,name=status,proto3" json:"status,omitempty"`
+	Error         string                 `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CallAttempt) Reset() {
+	*x = CallAttempt{}
+	mi := &file_rpc_controlpb_control_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CallAttempt) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CallAttempt) ProtoMessage() {}
+
+func (x *CallAttempt) ProtoReflect() protoreflect.Message {
+	mi := &file_rpc_controlpb_control_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CallAttempt.ProtoReflect.Descriptor instead.
+func (*CallAttempt) Descriptor() ([]byte, []int) {
+	return file_rpc_controlpb_control_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CallAttempt) GetNumber() string {
+	if x != nil {
+		return x.Number
+	}
+	return ""
+}
+
+func (x *CallAttempt) GetAttempt() int32 {
+	if x != nil {
+		return x.Attempt
+	}
+	return 0
+}
+
+func (x *CallAttempt) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *CallAttempt) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *CallAttempt) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+type ListContactsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// List is either "broadcast", when empty, or "whitelist".
+	List          string `protobuf:"bytes,1,opt,name=list,proto3" json:"list,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListContactsRequest) Reset() {
+	*x = ListContactsRequest{}
+	mi := &file_rpc_controlpb_control_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListContactsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListContactsRequest) ProtoMessage() {}
+
+func (x *ListContactsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rpc_controlpb_control_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListContactsRequest.ProtoReflect.Descriptor instead.
+func (*ListContactsRequest) Descriptor() ([]byte, []int) {
+	return file_rpc_controlpb_control_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ListContactsRequest) GetList() string {
+	if x != nil {
+		return x.List
+	}
+	return ""
+}
+
+type ListContactsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Contacts      []*Contact             `protobuf:"bytes,1,rep,name=contacts,proto3" json:"contacts,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListContactsResponse) Reset() {
+	*x = ListContactsResponse{}
+	mi := &file_rpc_controlpb_control_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListContactsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListContactsResponse) ProtoMessage() {}
+
+func (x *ListContactsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_rpc_controlpb_control_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListContactsResponse.ProtoReflect.Descriptor instead.
+func (*ListContactsResponse) Descriptor() ([]byte, []int) {
+	return file_rpc_controlpb_control_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ListContactsResponse) GetContacts() []*Contact {
+	if x != nil {
+		return x.Contacts
+	}
+	return nil
+}
+
+type Contact struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Number        string                 `protobuf:"bytes,1,opt,name=number,proto3" json:"number,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Lang          string                 `protobuf:"bytes,3,opt,name=lang,proto3" json:"lang,omitempty"`
+	Voice         string                 `protobuf:"bytes,4,opt,name=voice,proto3" json:"voice,omitempty"`
+	Tz            string                 `protobuf:"bytes,5,opt,name=tz,proto3" json:"tz,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Contact) Reset() {
+	*x = Contact{}
+	mi := &file_rpc_controlpb_control_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Contact) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Contact) ProtoMessage() {}
+
+func (x *Contact) ProtoReflect() protoreflect.Message {
+	mi := &file_rpc_controlpb_control_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Contact.ProtoReflect.Descriptor instead.
+func (*Contact) Descriptor() ([]byte, []int) {
+	return file_rpc_controlpb_control_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Contact) GetNumber() string {
+	if x != nil {
+		return x.Number
+	}
+	return ""
+}
+
+func (x *Contact) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Contact) GetLang() string {
+	if x != nil {
+		return x.Lang
+	}
+	return ""
+}
+
+func (x *Contact) GetVoice() string {
+	if x != nil {
+		return x.Voice
+	}
+	return ""
+}
+
+func (x *Contact) GetTz() string {
+	if x != nil {
+		return x.Tz
+	}
+	return ""
+}
+
+type UploadRecordingRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Data:
+	//
+	//	*UploadRecordingRequest_Info
+	//	*UploadRecordingRequest_Chunk
+	Data          isUploadRecordingRequest_Data `protobuf_oneof:"data"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UploadRecordingRequest) Reset() {
+	*x = UploadRecordingRequest{}
+	mi := &file_rpc_controlpb_control_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadRecordingRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadRecordingRequest) ProtoMessage() {}
+
+func (x *UploadRecordingRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rpc_controlpb_control_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadRecordingRequest.ProtoReflect.Descriptor instead.
+func (*UploadRecordingRequest) Descriptor() ([]byte, []int) {
+	return file_rpc_controlpb_control_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *UploadRecordingRequest) GetData() isUploadRecordingRequest_Data {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *UploadRecordingRequest) GetInfo() *RecordingInfo {
+	if x != nil {
+		if x, ok := x.Data.(*UploadRecordingRequest_Info); ok {
+			return x.Info
+		}
+	}
+	return nil
+}
+
+func (x *UploadRecordingRequest) GetChunk() []byte {
+	if x != nil {
+		if x, ok := x.Data.(*UploadRecordingRequest_Chunk); ok {
+			return x.Chunk
+		}
+	}
+	return nil
+}
+
+type isUploadRecordingRequest_Data interface {
+	isUploadRecordingRequest_Data()
+}
+
+type UploadRecordingRequest_Info struct {
+	Info *RecordingInfo `protobuf:"bytes,1,opt,name=info,proto3,oneof"`
+}
+
+type UploadRecordingRequest_Chunk struct {
+	Chunk []byte `protobuf:"bytes,2,opt,name=chunk,proto3,oneof"`
+}
+
+func (*UploadRecordingRequest_Info) isUploadRecordingRequest_Data() {}
+
+func (*UploadRecordingRequest_Chunk) isUploadRecordingRequest_Data() {}
+
+type RecordingInfo struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Name is the name the recording is stored under, whose
+	// extension is its format, e.g. "announcement.mp3".
+	Name          string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RecordingInfo) Reset() {
+	*x = RecordingInfo{}
+	mi := &file_rpc_controlpb_control_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RecordingInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RecordingInfo) ProtoMessage() {}
+
+func (x *RecordingInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_rpc_controlpb_control_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RecordingInfo.ProtoReflect.Descriptor instead.
+func (*RecordingInfo) Descriptor() ([]byte, []int) {
+	return file_rpc_controlpb_control_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *RecordingInfo) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type Recording struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	ContentType   string                 `protobuf:"bytes,2,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	Size          int64                  `protobuf:"varint,3,opt,name=size,proto3" json:"size,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Recording) Reset() {
+	*x = Recording{}
+	mi := &file_rpc_controlpb_control_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Recording) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Recording) ProtoMessage() {}
+
+func (x *Recording) ProtoReflect() protoreflect.Message {
+	mi := &file_rpc_controlpb_control_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Recording.ProtoReflect.Descriptor instead.
+func (*Recording) Descriptor() ([]byte, []int) {
+	return file_rpc_controlpb_control_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Recording) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Recording) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *Recording) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *Recording) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+var File_rpc_controlpb_control_proto protoreflect.FileDescriptor
+
+const file_rpc_controlpb_control_proto_rawDesc = "" +
+	"\n" +
+	"\x1brpc/controlpb/control.proto\x12\x12voicebr.control.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"{\n" +
+	"\x15StartBroadcastRequest\x12\x1c\n" +
+	"\trecording\x18\x01 \x01(\tR\trecording\x12\x14\n" +
+	"\x05group\x18\x02 \x01(\tR\x05group\x12\x12\n" +
+	"\x04from\x18\x03 \x01(\tR\x04from\x12\x1a\n" +
+	"\bpriority\x18\x04 \x01(\tR\bpriority\"%\n" +
+	"\x13GetBroadcastRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\"\xa0\x02\n" +
+	"\tBroadcast\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x1c\n" +
+	"\trecording\x18\x02 \x01(\tR\trecording\x12\x12\n" +
+	"\x04from\x18\x03 \x01(\tR\x04from\x12\x1a\n" +
+	"\bpriority\x18\x04 \x01(\tR\bpriority\x129\n" +
+	"\n" +
+	"created_at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x12=\n" +
+	"\n" +
+	"recipients\x18\x06 \x03(\v2\x1d.voicebr.control.v1.RecipientR\n" +
+	"recipients\x12;\n" +
+	"\battempts\x18\a \x03(\v2\x1f.voicebr.control.v1.CallAttemptR\battempts\"K\n" +
+	"\tRecipient\x12\x16\n" +
+	"\x06number\x18\x01 \x01(\tR\x06number\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x12\n" +
+	"\x04lang\x18\x03 \x01(\tR\x04lang\"\xa8\x01\n" +
+	"\vCallAttempt\x12\x16\n" +
+	"\x06number\x18\x01 \x01(\tR\x06number\x12\x18\n" +
+	"\aattempt\x18\x02 \x01(\x05R\aattempt\x12\x16\n" +
+	"\x06status\x18\x03 \x01(\tR\x06status\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\x129\n" +
+	"\n" +
+	"created_at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\")\n" +
+	"\x13ListContactsRequest\x12\x12\n" +
+	"\x04list\x18\x01 \x01(\tR\x04list\"O\n" +
+	"\x14ListContactsResponse\x127\n" +
+	"\bcontacts\x18\x01 \x03(\v2\x1b.voicebr.control.v1.ContactR\bcontacts\"o\n" +
+	"\aContact\x12\x16\n" +
+	"\x06number\x18\x01 \x01(\tR\x06number\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x12\n" +
+	"\x04lang\x18\x03 \x01(\tR\x04lang\x12\x14\n" +
+	"\x05voice\x18\x04 \x01(\tR\x05voice\x12\x0e\n" +
+	"\x02tz\x18\x05 \x01(\tR\x02tz\"q\n" +
+	"\x16UploadRecordingRequest\x127\n" +
+	"\x04info\x18\x01 \x01(\v2!.voicebr.control.v1.RecordingInfoH\x00R\x04info\x12\x16\n" +
+	"\x05chunk\x18\x02 \x01(\fH\x00R\x05chunkB\x06\n" +
+	"\x04data\"#\n" +
+	"\rRecordingInfo\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\"\x91\x01\n" +
+	"\tRecording\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12!\n" +
+	"\fcontent_type\x18\x02 \x01(\tR\vcontentType\x12\x12\n" +
+	"\x04size\x18\x03 \x01(\x03R\x04size\x129\n" +
+	"\n" +
+	"created_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt2\x80\x03\n" +
+	"\aControl\x12Z\n" +
+	"\x0eStartBroadcast\x12).voicebr.control.v1.StartBroadcastRequest\x1a\x1d.voicebr.control.v1.Broadcast\x12V\n" +
+	"\fGetBroadcast\x12'.voicebr.control.v1.GetBroadcastRequest\x1a\x1d.voicebr.control.v1.Broadcast\x12a\n" +
+	"\fListContacts\x12'.voicebr.control.v1.ListContactsRequest\x1a(.voicebr.control.v1.ListContactsResponse\x12^\n" +
+	"\x0fUploadRecording\x12*.voicebr.control.v1.UploadRecordingRequest\x1a\x1d.voicebr.control.v1.Recording(\x01B(Z&github.com/jecoz/voicebr/rpc/controlpbb\x06proto3"
+
+var (
+	file_rpc_controlpb_control_proto_rawDescOnce sync.Once
+	file_rpc_controlpb_control_proto_rawDescData []byte
+)
+
+func file_rpc_controlpb_control_proto_rawDescGZIP() []byte {
+	file_rpc_controlpb_control_proto_rawDescOnce.Do(func() {
+		file_rpc_controlpb_control_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_rpc_controlpb_control_proto_rawDesc), len(file_rpc_controlpb_control_proto_rawDesc)))
+	})
+	return file_rpc_controlpb_control_proto_rawDescData
+}
+
+var file_rpc_controlpb_control_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_rpc_controlpb_control_proto_goTypes = []any{
+	(*StartBroadcastRequest)(nil),  // 0: voicebr.control.v1.StartBroadcastRequest
+	(*GetBroadcastRequest)(nil),    // 1: voicebr.control.v1.GetBroadcastRequest
+	(*Broadcast)(nil),              // 2: voicebr.control.v1.Broadcast
+	(*Recipient)(nil),              // 3: voicebr.control.v1.Recipient
+	(*CallAttempt)(nil),            // 4: voicebr.control.v1.CallAttempt
+	(*ListContactsRequest)(nil),    // 5: voicebr.control.v1.ListContactsRequest
+	(*ListContactsResponse)(nil),   // 6: voicebr.control.v1.ListContactsResponse
+	(*Contact)(nil),                // 7: voicebr.control.v1.Contact
+	(*UploadRecordingRequest)(nil), // 8: voicebr.control.v1.UploadRecordingRequest
+	(*RecordingInfo)(nil),          // 9: voicebr.control.v1.RecordingInfo
+	(*Recording)(nil),              // 10: voicebr.control.v1.Recording
+	(*timestamppb.Timestamp)(nil),  // 11: google.protobuf.Timestamp
+}
+var file_rpc_controlpb_control_proto_depIdxs = []int32{
+	11, // 0: voicebr.control.v1.Broadcast.created_at:type_name -> google.protobuf.Timestamp
+	3,  // 1: voicebr.control.v1.Broadcast.recipients:type_name -> voicebr.control.v1.Recipient
+	4,  // 2: voicebr.control.v1.Broadcast.attempts:type_name -> voicebr.control.v1.CallAttempt
+	11, // 3: voicebr.control.v1.CallAttempt.created_at:type_name -> google.protobuf.Timestamp
+	7,  // 4: voicebr.control.v1.ListContactsResponse.contacts:type_name -> voicebr.control.v1.Contact
+	9,  // 5: voicebr.control.v1.UploadRecordingRequest.info:type_name -> voicebr.control.v1.RecordingInfo
+	11, // 6: voicebr.control.v1.Recording.created_at:type_name -> google.protobuf.Timestamp
+	0,  // 7: voicebr.control.v1.Control.StartBroadcast:input_type -> voicebr.control.v1.StartBroadcastRequest
+	1,  // 8: voicebr.control.v1.Control.GetBroadcast:input_type -> voicebr.control.v1.GetBroadcastRequest
+	5,  // 9: voicebr.control.v1.Control.ListContacts:input_type -> voicebr.control.v1.ListContactsRequest
+	8,  // 10: voicebr.control.v1.Control.UploadRecording:input_type -> voicebr.control.v1.UploadRecordingRequest
+	2,  // 11: voicebr.control.v1.Control.StartBroadcast:output_type -> voicebr.control.v1.Broadcast
+	2,  // 12: voicebr.control.v1.Control.GetBroadcast:output_type -> voicebr.control.v1.Broadcast
+	6,  // 13: voicebr.control.v1.Control.ListContacts:output_type -> voicebr.control.v1.ListContactsResponse
+	10, // 14: voicebr.control.v1.Control.UploadRecording:output_type -> voicebr.control.v1.Recording
+	11, // [11:15] is the sub-list for method output_type
+	7,  // [7:11] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
+}
+
+func init() { file_rpc_controlpb_control_proto_init() }
+func file_rpc_controlpb_control_proto_init() {
+	if File_rpc_controlpb_control_proto != nil {
+		return
+	}
+	file_rpc_controlpb_control_proto_msgTypes[8].OneofWrappers = []any{
+		(*UploadRecordingRequest_Info)(nil),
+		(*UploadRecordingRequest_Chunk)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_rpc_controlpb_control_proto_rawDesc), len(file_rpc_controlpb_control_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   11,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_rpc_controlpb_control_proto_goTypes,
+		DependencyIndexes: file_rpc_controlpb_control_proto_depIdxs,
+		MessageInfos:      file_rpc_controlpb_control_proto_msgTypes,
+	}.Build()
+	File_rpc_controlpb_control_proto = out.File
+	file_rpc_controlpb_control_proto_goTypes = nil
+	file_rpc_controlpb_control_proto_depIdxs = nil
+}
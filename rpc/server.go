@@ -0,0 +1,335 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package rpc serves the gRPC control API, defined in
+// controlpb/control.proto, which lets other services start
+// broadcasts without going through the admin routes.
+package rpc
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/rpc/controlpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Control implements the control service on top of a
+// client and of its storage.
+type Control struct {
+	controlpb.UnimplementedControlServer
+
+	Client  *nexmo.Client
+	Storage nexmo.Storage
+	// MaxRecSize is the size of the largest recording that
+	// is uploaded, nexmo.DefaultMaxRecSize if zero.
+	MaxRecSize int64
+	// Transcoder, if set, converts the uploaded recordings
+	// to Audio before they are stored.
+	Transcoder nexmo.Transcoder
+	Audio      nexmo.AudioTarget
+	// Loudness, if set, normalizes the loudness of the
+	// uploaded recordings.
+	Loudness *nexmo.LoudnessNormalizer
+	// Log receives the logs of the service, the one of the
+	// client if nil.
+	Log *log.Logger
+}
+
+func (c *Control) logger() *log.Logger {
+	if c.Log != nil {
+		return c.Log
+	}
+	if c.Client != nil && c.Client.Log != nil {
+		return c.Client.Log
+	}
+	return log.Default()
+}
+
+// methodActions are the actions each method requires,
+// see nexmo.Principal.
+var methodActions = map[string]string{
+	controlpb.Control_StartBroadcast_FullMethodName:  nexmo.ActionBroadcast,
+	controlpb.Control_GetBroadcast_FullMethodName:    nexmo.ActionReports,
+	controlpb.Control_ListContacts_FullMethodName:    nexmo.ActionContacts,
+	controlpb.Control_UploadRecording_FullMethodName: nexmo.ActionRecordings,
+}
+
+// NewServer returns a gRPC server of `ctrl`, authenticating the
+// requests through `auth`, which sees their metadata as the
+// headers of an HTTP request. When `auth` is nil, the requests
+// are not authenticated.
+func NewServer(ctrl *Control, auth nexmo.Authenticator) *grpc.Server {
+	var opts []grpc.ServerOption
+	if auth != nil {
+		opts = append(opts,
+			grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, h grpc.UnaryHandler) (interface{}, error) {
+				ctx, err := authenticate(ctx, auth, info.FullMethod, ctrl.logger())
+				if err != nil {
+					return nil, err
+				}
+				return h(ctx, req)
+			}),
+			grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, h grpc.StreamHandler) error {
+				ctx, err := authenticate(ss.Context(), auth, info.FullMethod, ctrl.logger())
+				if err != nil {
+					return err
+				}
+				return h(srv, authStream{ss, ctx})
+			}),
+		)
+	}
+	srv := grpc.NewServer(opts...)
+	controlpb.RegisterControlServer(srv, ctrl)
+	return srv
+}
+
+// authenticate returns a copy of `ctx` carrying the principal
+// of the request, provided that it may call `method`.
+func authenticate(ctx context.Context, auth nexmo.Authenticator, method string, lg *log.Logger) (context.Context, error) {
+	r, err := http.NewRequestWithContext(ctx, "POST", method, nil)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for k, v := range md {
+		for _, w := range v {
+			r.Header.Add(k, w)
+		}
+	}
+	p, err := auth.Authenticate(r)
+	if err != nil {
+		if err != nexmo.ErrUnauthorized {
+			lg.Printf("rpc: authenticate: %v", err)
+		}
+		return nil, status.Error(codes.Unauthenticated, "unauthenticated")
+	}
+	if action, ok := methodActions[method]; !ok || !p.Can(action) {
+		return nil, status.Errorf(codes.PermissionDenied, "%s may not call %s", p.Name, method)
+	}
+	return nexmo.WithPrincipal(ctx, p), nil
+}
+
+// authStream is a stream whose context carries the principal.
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s authStream) Context() context.Context { return s.ctx }
+
+// principalName returns the name of the principal of `ctx`,
+// for the logs and the broadcasts it requests.
+func principalName(ctx context.Context) string {
+	if p, ok := nexmo.PrincipalFromContext(ctx); ok {
+		return p.Name
+	}
+	return "anonymous"
+}
+
+func (c *Control) StartBroadcast(ctx context.Context, req *controlpb.StartBroadcastRequest) (*controlpb.Broadcast, error) {
+	if req.Recording == "" {
+		return nil, status.Error(codes.InvalidArgument, "recording is required")
+	}
+	if err := nexmo.ValidatePriority(req.Priority); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if p, ok := nexmo.PrincipalFromContext(ctx); ok && !p.CanBroadcastTo(req.Group) {
+		return nil, status.Errorf(codes.PermissionDenied, "%s may not broadcast to %q", p.Name, req.Group)
+	}
+	if req.From != "" && !c.Client.Owns(req.From) {
+		return nil, status.Errorf(codes.InvalidArgument, "%q is not owned by the application", req.From)
+	}
+
+	name, err := nexmo.ResolveRecName(ctx, c.Storage, req.Recording)
+	if err != nil {
+		c.logger().Printf("rpc: start broadcast: %v", err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	rec, _, err := c.Storage.OpenRec(ctx, name)
+	switch {
+	case err == nexmo.ErrRecNotFound:
+		return nil, status.Errorf(codes.NotFound, "recording %q not found", name)
+	case err != nil:
+		c.logger().Printf("rpc: start broadcast: %v", err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	rec.Close()
+
+	contacts, err := nexmo.RecipientsOf(ctx, c.Storage, req.Group, c.Log)
+	switch {
+	case err == nexmo.ErrNoHistory:
+		return nil, status.Error(codes.Unimplemented, "the storage does not support groups")
+	case err != nil:
+		c.logger().Printf("rpc: start broadcast: %v", err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	c.logger().Printf("rpc: broadcasting %s to %d contacts, requested by %s", name, len(contacts), principalName(ctx))
+	b, err := c.Client.StartBroadcast(ctx, c.Storage, nexmo.Broadcast{RecName: name, From: req.From, Priority: req.Priority, RequestedBy: principalName(ctx)}, contacts)
+	switch {
+	case err == nexmo.ErrOverBudget:
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return broadcastToProto(b, nil), nil
+}
+
+func (c *Control) GetBroadcast(ctx context.Context, req *controlpb.GetBroadcastRequest) (*controlpb.Broadcast, error) {
+	h, ok := c.Storage.(nexmo.BroadcastHistory)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "the storage does not keep the broadcasts")
+	}
+	b, err := h.Broadcast(ctx, req.Id)
+	if err == nil {
+		var attempts []nexmo.CallAttempt
+		if attempts, err = h.Attempts(ctx, req.Id); err == nil {
+			return broadcastToProto(b, attempts), nil
+		}
+	}
+	switch err {
+	case nexmo.ErrBroadcastNotFound:
+		return nil, status.Errorf(codes.NotFound, "broadcast %d not found", req.Id)
+	case nexmo.ErrNoHistory:
+		return nil, status.Error(codes.Unimplemented, err.Error())
+	default:
+		c.logger().Printf("rpc: get broadcast: %v", err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+}
+
+func (c *Control) ListContacts(ctx context.Context, req *controlpb.ListContactsRequest) (*controlpb.ListContactsResponse, error) {
+	list := nexmo.ContactList(req.List)
+	switch list {
+	case "":
+		list = nexmo.BroadcastList
+	case nexmo.BroadcastList, nexmo.Whitelist:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown list %q", req.List)
+	}
+	contacts, err := c.Storage.ListContacts(ctx, list)
+	if err != nil && err != nexmo.ErrCorruptedContacts {
+		c.logger().Printf("rpc: list contacts: %v", err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	resp := &controlpb.ListContactsResponse{}
+	for _, v := range contacts {
+		resp.Contacts = append(resp.Contacts, &controlpb.Contact{
+			Number: v.Number,
+			Name:   v.Name,
+			Lang:   v.Lang,
+			Voice:  v.Voice,
+			Tz:     v.TZ,
+		})
+	}
+	return resp, nil
+}
+
+func (c *Control) UploadRecording(stream controlpb.Control_UploadRecordingServer) error {
+	ctx := stream.Context()
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	info := first.GetInfo()
+	if info == nil {
+		return status.Error(codes.InvalidArgument, "the first message must carry the recording info")
+	}
+	if err = nexmo.ValidateRecName(info.Name); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	meta, err := c.Client.UploadRec(ctx, c.Storage, info.Name, &chunkReader{stream: stream}, nexmo.UploadOptions{
+		MaxSize:    c.MaxRecSize,
+		Transcoder: c.Transcoder,
+		Target:     c.Audio,
+		Loudness:   c.Loudness,
+		By:         principalName(ctx),
+	})
+	switch {
+	case err == nexmo.ErrRecTooLarge:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case err == nexmo.ErrNotRecording:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case err == nexmo.ErrTranscodeUnsupported, err == nexmo.ErrLoudnessUnsupported:
+		return status.Error(codes.Unimplemented, err.Error())
+	case err != nil:
+		c.logger().Printf("rpc: upload recording: %v", err)
+		return status.Error(codes.Internal, err.Error())
+	}
+	c.logger().Printf("rpc: %s uploaded by %s", meta.Name, principalName(ctx))
+	return stream.SendAndClose(&controlpb.Recording{
+		Name:        meta.Name,
+		ContentType: meta.ContentType,
+		Size:        meta.Size,
+		CreatedAt:   timestamppb.New(meta.CreatedAt),
+	})
+}
+
+// chunkReader reads the chunks of an upload stream.
+type chunkReader struct {
+	stream controlpb.Control_UploadRecordingServer
+	buf    []byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		req, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		if req.GetInfo() != nil {
+			return 0, status.Error(codes.InvalidArgument, "the recording info must be sent only once")
+		}
+		r.buf = req.GetChunk()
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func broadcastToProto(b nexmo.Broadcast, attempts []nexmo.CallAttempt) *controlpb.Broadcast {
+	acc := &controlpb.Broadcast{
+		Id:        b.ID,
+		Recording: b.RecName,
+		From:      b.From,
+		Priority:  b.Priority,
+		CreatedAt: timestamppb.New(b.CreatedAt),
+	}
+	for _, v := range b.Recipients {
+		acc.Recipients = append(acc.Recipients, &controlpb.Recipient{
+			Number: v.Number,
+			Name:   v.Name,
+			Lang:   v.Lang,
+		})
+	}
+	for _, v := range attempts {
+		acc.Attempts = append(acc.Attempts, &controlpb.CallAttempt{
+			Number:    v.Number,
+			Attempt:   int32(v.Attempt),
+			Status:    v.Status,
+			Error:     v.Err,
+			CreatedAt: timestamppb.New(v.CreatedAt),
+		})
+	}
+	return acc
+}
@@ -0,0 +1,124 @@
+package rpc_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/nexmo/nexmotest"
+	"github.com/jecoz/voicebr/rpc"
+	"github.com/jecoz/voicebr/rpc/controlpb"
+	"github.com/jecoz/voicebr/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestControl(t *testing.T) {
+	srv, err := nexmotest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	c, err := srv.NewClient("app", "393339999999", "https://voicebr.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	db, err := storage.NewSQLite(dir + "/voicebr.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s := storage.Combined{RecStore: &storage.Local{RootDir: dir}, ContactsStore: db}
+	ctx := context.TODO()
+	for _, v := range []nexmo.Contact{nexmo.NewContact("393331111111", "Anna"), nexmo.NewContact("393332222222", "Luca")} {
+		if err = db.AddContact(ctx, nexmo.BroadcastList, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ln := bufconn.Listen(1 << 20)
+	g := rpc.NewServer(&rpc.Control{Client: c, Storage: s}, nexmo.APIKeys{"secret": "ci"})
+	go g.Serve(ln)
+	defer g.Stop()
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	cc := controlpb.NewControlClient(conn)
+
+	if _, err = cc.ListContacts(ctx, &controlpb.ListContactsRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Wanted %v, found %v", codes.Unauthenticated, err)
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-api-key", "secret")
+	list, err := cc.ListContacts(ctx, &controlpb.ListContactsRequest{})
+	if err != nil {
+		t.Fatalf("Unexpected list error: %v", err)
+	}
+	if len(list.Contacts) != 2 {
+		t.Fatalf("Wanted 2 contacts, found %v", list.Contacts)
+	}
+
+	up, err := cc.UploadRecording(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := []*controlpb.UploadRecordingRequest{
+		{Data: &controlpb.UploadRecordingRequest_Info{Info: &controlpb.RecordingInfo{Name: "a.mp3"}}},
+		{Data: &controlpb.UploadRecordingRequest_Chunk{Chunk: []byte("ID3 fake")}},
+		{Data: &controlpb.UploadRecordingRequest_Chunk{Chunk: []byte(" mp3")}},
+	}
+	for _, v := range msgs {
+		if err = up.Send(v); err != nil {
+			t.Fatalf("Unexpected send error: %v", err)
+		}
+	}
+	rec, err := up.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("Unexpected upload error: %v", err)
+	}
+	if rec.Name != "a.mp3" || rec.Size != int64(len("ID3 fake mp3")) {
+		t.Fatalf("Unexpected recording: %v", rec)
+	}
+
+	if _, err = cc.StartBroadcast(ctx, &controlpb.StartBroadcastRequest{Recording: "missing.mp3"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("Wanted %v, found %v", codes.NotFound, err)
+	}
+	b, err := cc.StartBroadcast(ctx, &controlpb.StartBroadcastRequest{Recording: "a.mp3"})
+	if err != nil {
+		t.Fatalf("Unexpected start error: %v", err)
+	}
+	if b.Id == 0 || len(b.Recipients) != 2 {
+		t.Fatalf("Unexpected broadcast: %v", b)
+	}
+	if calls := srv.WaitCalls(2, 5*time.Second); len(calls) != 2 {
+		t.Fatalf("Wanted 2 calls, found %d", len(calls))
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if b, err = cc.GetBroadcast(ctx, &controlpb.GetBroadcastRequest{Id: b.Id}); err != nil {
+			t.Fatalf("Unexpected get error: %v", err)
+		}
+		if len(b.Attempts) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Wanted 2 attempts, found %v", b.Attempts)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err = cc.GetBroadcast(ctx, &controlpb.GetBroadcastRequest{Id: 42}); status.Code(err) != codes.NotFound {
+		t.Fatalf("Wanted %v, found %v", codes.NotFound, err)
+	}
+}
@@ -0,0 +1,664 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package voicebr
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/prefs"
+	"github.com/jecoz/voicebr/storage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// ValidatePrefs checks `p`, filling its defaults, together
+// with the parts that only the nexmo package can validate.
+func ValidatePrefs(p *prefs.MasterPrefs) error {
+	return validatePrefs(p, false)
+}
+
+// vonageCredentials are the preferences used only to create the
+// client, not required when one is provided.
+var vonageCredentials = map[string]bool{
+	"vonage.app_id":      true,
+	"vonage.private_key": true,
+	"vonage.number":      true,
+}
+
+// validatePrefs is ValidatePrefs, skipping the checks of the
+// Vonage credentials if the client is `provided`.
+func validatePrefs(p *prefs.MasterPrefs, provided bool) error {
+	var errs prefs.ValidationErrors
+	if err := p.Validate(); err != nil {
+		for _, v := range err.(prefs.ValidationErrors) {
+			if !provided || !vonageCredentials[v.Path] {
+				errs = append(errs, v)
+			}
+		}
+	}
+	if _, err := recordOptions(p.Recording); err != nil {
+		errs = append(errs, prefs.FieldError{Path: "recording", Err: err})
+	}
+	if _, err := newPromptBook(p.Prompts, p.Server.Origin); err != nil {
+		errs = append(errs, prefs.FieldError{Path: "prompts", Err: err})
+	}
+	if _, err := newOIDC(p.Admin.OIDC, adminOrigin(p.Server)); err != nil {
+		errs = append(errs, prefs.FieldError{Path: "admin.oidc", Err: err})
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func tailnetPort(p prefs.Tailnet) int {
+	if p.Port == 0 {
+		return 80
+	}
+	return p.Port
+}
+
+func tailnetOrigin(p prefs.Tailnet) string {
+	if port := tailnetPort(p); port != 80 {
+		return fmt.Sprintf("http://%s:%d", p.Hostname, port)
+	}
+	return "http://" + p.Hostname
+}
+
+// adminOrigin returns the origin the admin routes are reached
+// at: the tailnet node, when there is one, the admin address,
+// when set, or the public origin.
+func adminOrigin(p prefs.Server) string {
+	switch {
+	case p.Tailnet.Hostname != "":
+		return tailnetOrigin(p.Tailnet)
+	case p.AdminAddr != "":
+		host, port, _ := net.SplitHostPort(p.AdminAddr)
+		if host == "" {
+			host = "localhost"
+		}
+		return "http://" + net.JoinHostPort(host, port)
+	default:
+		return p.Origin
+	}
+}
+
+// NewClient returns the nexmo client configured according
+// to `p`, logging to `l`. Close its audit log, if any, when
+// done.
+func NewClient(p *prefs.MasterPrefs, l *log.Logger) (*nexmo.Client, error) {
+	if p.Vonage.PrivateKey != "" {
+		l.Printf("loading private key from %s", p.Vonage.PrivateKey)
+	}
+	client, err := nexmo.NewClientFromConfig(nexmo.Config{
+		AppID:          p.Vonage.AppID,
+		PrivateKey:     []byte(p.Vonage.PrivateKeyPEM),
+		PrivateKeyPath: p.Vonage.PrivateKey,
+		Number:         p.Vonage.Number,
+		BaseURL:        p.Vonage.BaseURL,
+		Origin:         p.Server.Origin,
+	})
+	if err != nil {
+		return nil, err
+	}
+	client.Log = l
+	client.APIKey, client.APISecret = p.Vonage.APIKey, p.Vonage.APISecret
+
+	for _, v := range p.Vonage.Numbers {
+		client.Numbers = append(client.Numbers, strings.TrimPrefix(v, "+"))
+	}
+	client.CallerIDByCountry = p.Vonage.CallerIDByCountry
+	t := p.Vonage.Transport
+	if err = client.SetTransportOptions(nexmo.TransportOptions{
+		Dial: nexmo.DialOptions{
+			Family:        p.Vonage.Dial.Family,
+			LocalAddr:     p.Vonage.Dial.LocalAddr,
+			Interface:     p.Vonage.Dial.Interface,
+			FallbackDelay: time.Duration(p.Vonage.Dial.FallbackDelay),
+			Timeout:       time.Duration(t.ConnectTimeout),
+		},
+		Proxy:                 t.Proxy,
+		CAFile:                t.CABundle,
+		Timeout:               time.Duration(t.Timeout),
+		TLSHandshakeTimeout:   time.Duration(t.TLSHandshakeTimeout),
+		ResponseHeaderTimeout: time.Duration(t.ResponseHeaderTimeout),
+		MaxIdleConns:          t.MaxIdleConns,
+		MaxIdleConnsPerHost:   t.MaxIdleConnsPerHost,
+		IdleConnTimeout:       time.Duration(t.IdleConnTimeout),
+	}); err != nil {
+		return nil, err
+	}
+	if d := p.Vonage.CallTimeout; d > 0 {
+		client.CallTimeout = time.Duration(d)
+	}
+	client.RequestTimeout = time.Duration(p.Vonage.RequestTimeout)
+	if b := p.Vonage.Breaker; b.Threshold > 0 {
+		client.Breaker = nexmo.NewBreaker(b.Threshold, time.Duration(b.Cooldown))
+	}
+
+	client.Policy = nexmo.DeliveryPolicy{
+		MaxAttempts:  p.Delivery.MaxAttempts,
+		RetrySpacing: time.Duration(p.Delivery.RetrySpacing),
+		Voicemail:    p.Delivery.Voicemail,
+	}.Merge(nexmo.DefaultDeliveryPolicy)
+	client.Emergency = nexmo.EmergencyOptions{
+		Policy: nexmo.DeliveryPolicy{
+			MaxAttempts:  p.Delivery.Emergency.MaxAttempts,
+			RetrySpacing: time.Duration(p.Delivery.Emergency.RetrySpacing),
+		},
+		SMS: p.Delivery.Emergency.SMS,
+	}
+	if pc := p.Delivery.Pacing; pc.Gap > 0 || pc.Merge {
+		client.Pacer = nexmo.NewRecipientPacer(time.Duration(pc.Gap), pc.Merge)
+	}
+	if client.LangDetector, err = newLangDetector(p.Transcription); err != nil {
+		return nil, err
+	}
+	if q := p.Delivery.QuietHours; q.Start != "" || q.End != "" {
+		if client.QuietHours, err = nexmo.ParseQuietHours(q.Start, q.End); err != nil {
+			return nil, err
+		}
+	}
+	if tz := p.Delivery.TimeZone; tz != "" {
+		if client.Location, err = time.LoadLocation(tz); err != nil {
+			return nil, err
+		}
+	}
+
+	if c := p.Costs; c.MaxCostPerBroadcast > 0 || len(c.Prices) > 0 || c.DefaultPrice > 0 {
+		client.Costs = &nexmo.CostGuard{
+			Prices:          nexmo.PriceTable{Prices: c.Prices, Default: c.DefaultPrice},
+			Minutes:         c.MinutesPerCall,
+			MaxPerBroadcast: c.MaxCostPerBroadcast,
+			Truncate:        c.OverBudget == prefs.OverBudgetTruncate,
+		}
+	}
+
+	nexmo.CountryCode = p.Contacts.CountryCode
+
+	if client.Prompts, err = newPromptBook(p.Prompts, p.Server.Origin); err != nil {
+		return nil, err
+	}
+	if client.Prompts.Speech != nil {
+		client.Prompts.Speech.Log = l
+	}
+	if client.URLKey, err = urlKey(p.Webhooks, l); err != nil {
+		return nil, err
+	}
+	if p.Audit.Path != "" {
+		audit, err := storage.OpenAuditFile(p.Audit.Path)
+		if err != nil {
+			return nil, err
+		}
+		client.Audit = audit
+	}
+	return client, nil
+}
+
+// recordOptions validates the recording preferences, returning
+// the options of the record action.
+func recordOptions(p prefs.Recording) (nexmo.RecordOptions, error) {
+	if err := nexmo.ValidateRecFormat(p.Format); err != nil {
+		return nexmo.RecordOptions{}, err
+	}
+	record := nexmo.RecordOptions{
+		TimeOut:      time.Duration(p.TimeOut),
+		EndOnSilence: time.Duration(p.EndOnSilence),
+		NoBeep:       !p.BeepStart,
+		Confirm:      p.Confirm,
+		MaxLength:    time.Duration(p.MaxLength),
+	}
+	return record, record.Validate()
+}
+
+func urlKey(p prefs.Webhooks, l *log.Logger) ([]byte, error) {
+	if p.SigningKey != "" {
+		return []byte(p.SigningKey), nil
+	}
+	l.Printf("no webhooks signing key set, generating a random one")
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("unable to generate webhooks signing key: %v", err)
+	}
+	return key, nil
+}
+
+// newAuthenticator returns the authenticator of the admin
+// routes, which refuses every request if no credentials are set.
+// The API tokens stored in `s`, if any, and the users of `oidc`,
+// if not nil, are accepted too.
+func newAuthenticator(p prefs.Admin, s nexmo.Storage, oidc *nexmo.OIDC, l *log.Logger) nexmo.Authenticator {
+	var auth nexmo.AnyAuthenticator
+	if len(p.APIKeys) > 0 {
+		keys := make(nexmo.APIKeys, len(p.APIKeys))
+		for _, v := range p.APIKeys {
+			keys[v.Key] = v.Name
+		}
+		auth = append(auth, keys)
+	}
+	if len(p.Users) > 0 {
+		users := make(nexmo.BasicAuth, len(p.Users))
+		for _, v := range p.Users {
+			users[v.Name] = v.PasswordHash
+		}
+		auth = append(auth, users)
+	}
+	if oidc != nil {
+		auth = append(auth, oidc)
+	}
+	if len(auth) == 0 {
+		l.Printf("no admin credentials set, admin routes are disabled")
+	}
+	if ts, ok := s.(nexmo.TokenStore); ok {
+		auth = append(auth, nexmo.TokenAuth{Store: ts})
+	}
+	return auth
+}
+
+// newOIDC returns the OpenID Connect authenticator, or nil if
+// no issuer is set.
+func newOIDC(p prefs.OIDC, origin string) (*nexmo.OIDC, error) {
+	if p.Issuer == "" {
+		return nil, nil
+	}
+	roles := make(map[string]*nexmo.Scope, len(p.Roles))
+	for _, v := range p.Roles {
+		if v.Admin {
+			roles[v.Group] = nil
+			continue
+		}
+		scope := &nexmo.Scope{Actions: v.Actions, Groups: v.Groups}
+		if err := scope.Validate(); err != nil {
+			return nil, fmt.Errorf("role of %q: %v", v.Group, err)
+		}
+		roles[v.Group] = scope
+	}
+	return &nexmo.OIDC{
+		Issuer:       p.Issuer,
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		RedirectURL:  strings.TrimSuffix(origin, "/") + nexmo.OIDCCallbackPath,
+		GroupsClaim:  p.GroupsClaim,
+		Roles:        roles,
+	}, nil
+}
+
+func newPromptBook(p prefs.Prompts, origin string) (*nexmo.PromptBook, error) {
+	book := nexmo.NewPromptBook()
+	if p.Level != 0 {
+		book.Level = p.Level
+	}
+	tts, err := newTTS(p.TTS)
+	if err != nil {
+		return nil, err
+	}
+	if tts != nil {
+		book.Speech = &nexmo.Speech{
+			TTS:    tts,
+			Origin: origin,
+			Voices: p.TTS.Voices,
+			Dir:    p.TTS.Dir,
+		}
+	}
+	for lang, v := range p.Langs {
+		if err := book.Set(lang, nexmo.Prompts{
+			Voice:    v.Voice,
+			Greeting: v.Greeting,
+			Confirm:  v.Confirm,
+			TooLong:  v.TooLong,
+			Menu:     v.Menu,
+			Live:     v.Live,
+			Listen:   v.Listen,
+			Recorded: v.Recorded,
+			End:      v.End,
+			OptOut:   v.OptOut,
+			OptedOut: v.OptedOut,
+			Replay:   v.Replay,
+
+			Templates:       v.Templates,
+			TemplateCode:    v.TemplateCode,
+			TemplateSent:    v.TemplateSent,
+			TemplateUnknown: v.TemplateUnknown,
+
+			IVRMenu:     v.IVRMenu,
+			IVRGroup:    v.IVRGroup,
+			IVRGroupSet: v.IVRGroupSet,
+			IVRCanceled: v.IVRCanceled,
+			IVRNone:     v.IVRNone,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return book, nil
+}
+
+// newTTS returns the text-to-speech provider selected by `p`,
+// nil if the prompts are spoken by nexmo.
+func newTTS(p prefs.TTS) (nexmo.TTS, error) {
+	switch p.Provider {
+	case "":
+		return nil, nil
+	case prefs.TTSAzure:
+		return nexmo.AzureTTS{Key: p.APIKey, Region: p.Region, Voice: p.Voice}, nil
+	case prefs.TTSElevenLabs:
+		return nexmo.ElevenLabsTTS{Key: p.APIKey, Voice: p.Voice, Model: p.Model}, nil
+	default:
+		return nil, fmt.Errorf("unknown tts provider %q", p.Provider)
+	}
+}
+
+// NewStorage returns the storage configured according to `p`,
+// logging to `l`.
+func NewStorage(p prefs.Storage, l *log.Logger) (nexmo.Storage, error) {
+	s, err := newRecStorage(p, l)
+	if err != nil {
+		return nil, err
+	}
+	var recs nexmo.RecStore = s
+	var contacts nexmo.ContactsStore = s
+	combined := false
+
+	if p.Mirror.Kind != "" {
+		secondary, err := newRecStorage(prefs.Storage{
+			Kind:  p.Mirror.Kind,
+			Local: p.Mirror.Local,
+			GCS:   p.Mirror.GCS,
+		}, l)
+		if err != nil {
+			return nil, fmt.Errorf("mirror: %v", err)
+		}
+		m := storage.NewMirror(s, secondary)
+		m.Log = l
+		go m.Run(context.Background(), time.Duration(p.Mirror.ReconcileInterval))
+		recs, combined = m, true
+	}
+	if p.SQLite.Path != "" {
+		l.Printf("storing contacts and broadcasts in sqlite database: %s", p.SQLite.Path)
+		db, err := storage.NewSQLite(p.SQLite.Path)
+		if err != nil {
+			return nil, err
+		}
+		contacts, combined = db, true
+	}
+
+	if !combined {
+		return s, nil
+	}
+	return storage.Combined{RecStore: recs, ContactsStore: contacts}, nil
+}
+
+// newDuplicateGuard returns the duplicate recordings detector,
+// or nil if disabled.
+func newDuplicateGuard(p prefs.Duplicates) *nexmo.DuplicateGuard {
+	if p.Window <= 0 {
+		return nil
+	}
+	g := nexmo.NewDuplicateGuard(time.Duration(p.Window))
+	g.Threshold = p.Threshold
+	g.Hold = p.Action == prefs.DuplicatesHold
+	return g
+}
+
+// newSharedState returns the state shared by the instances of
+// the cluster, or nil if disabled.
+func newSharedState(ctx context.Context, p prefs.Cluster) (*storage.Redis, error) {
+	if p.Redis.Addr == "" {
+		return nil, nil
+	}
+	return storage.NewRedis(ctx, p.Redis.Addr, p.Redis.Password, p.Redis.DB)
+}
+
+// newTracerProvider returns the provider exporting the traces
+// to the OTLP collector, or nil if disabled.
+func newTracerProvider(ctx context.Context, p prefs.Tracing) (*sdktrace.TracerProvider, error) {
+	if p.Endpoint == "" {
+		return nil, nil
+	}
+	exp, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(p.Endpoint), otlptracehttp.WithHeaders(p.Headers))
+	if err != nil {
+		return nil, fmt.Errorf("tracing: %v", err)
+	}
+	name := p.ServiceName
+	if name == "" {
+		name = "voicebr"
+	}
+	ratio := p.SampleRatio
+	if ratio == 0 {
+		ratio = 1
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", name))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	), nil
+}
+
+// sharedLimiters paces the limiters on their own again on
+// Close, as they are shared by every server of the process.
+type sharedLimiters []*nexmo.Limiter
+
+func (l sharedLimiters) Close() error {
+	for _, v := range l {
+		v.Share(nil)
+	}
+	return nil
+}
+
+// tracerCloser flushes and stops a TracerProvider on Close.
+type tracerCloser struct {
+	*sdktrace.TracerProvider
+}
+
+func (t tracerCloser) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return t.Shutdown(ctx)
+}
+
+// newTranscoder returns the transcoder of the recordings and
+// the audio they are converted to, or nil if disabled.
+func newTranscoder(p prefs.Recording) (nexmo.Transcoder, nexmo.AudioTarget) {
+	t := p.Transcode
+	if !t.Enabled {
+		return nil, nexmo.AudioTarget{}
+	}
+	return nexmo.FFmpeg{Path: t.FFmpeg}, nexmo.AudioTarget{
+		Format:     p.Format,
+		SampleRate: t.SampleRate,
+		Channels:   t.Channels,
+	}
+}
+
+// newLoudnessNormalizer returns the loudness normalization pass
+// of the recordings, or nil if disabled.
+func newLoudnessNormalizer(p prefs.Recording) *nexmo.LoudnessNormalizer {
+	if !p.Loudness.Normalize {
+		return nil
+	}
+	return &nexmo.LoudnessNormalizer{
+		Target: p.Loudness.Target,
+		FFmpeg: nexmo.FFmpeg{Path: p.Transcode.FFmpeg},
+	}
+}
+
+// newReplayGuard returns the guard of the webhooks, logging to
+// `l`, or nil if disabled.
+func newReplayGuard(p *prefs.MasterPrefs, l *log.Logger) *nexmo.ReplayGuard {
+	if p.Server.ReplayWindow <= 0 {
+		return nil
+	}
+	var secret []byte
+	if v := p.Vonage.SignatureSecret; v != "" {
+		secret = []byte(v)
+	}
+	g := nexmo.NewReplayGuard(time.Duration(p.Server.ReplayWindow), secret)
+	g.Log = l
+	return g
+}
+
+// newOriginResolver returns the resolver of the origin of the
+// webhooks, allowing the host of the canonical origin too, or
+// nil if disabled.
+func newOriginResolver(p prefs.Server) (*nexmo.OriginResolver, error) {
+	if len(p.Origins.Hosts) == 0 {
+		return nil, nil
+	}
+	u, err := url.Parse(p.Origin)
+	if err != nil {
+		return nil, fmt.Errorf("origins: %v", err)
+	}
+	o, err := nexmo.NewOriginResolver(append([]string{u.Host}, p.Origins.Hosts...))
+	if err != nil {
+		return nil, fmt.Errorf("origins: %v", err)
+	}
+	o.TrustProxy = p.Origins.TrustProxy
+	return o, nil
+}
+
+// newIPAllowlist returns the allowlist of the webhooks, updating
+// its ranges until `ctx` is done and logging to `l`, or nil if
+// disabled.
+func newIPAllowlist(ctx context.Context, p prefs.Allowlist, l *log.Logger) (*nexmo.IPAllowlist, error) {
+	if len(p.CIDRs) == 0 && p.URL == "" {
+		return nil, nil
+	}
+	a, err := nexmo.NewIPAllowlist(p.CIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("allowlist: %v", err)
+	}
+	a.URL = p.URL
+	a.Refresh = time.Duration(p.Refresh)
+	a.TrustProxy = p.TrustProxy
+	a.Log = l
+	go a.Run(ctx)
+	return a, nil
+}
+
+// newEmailNotifier returns the notifier emailing the summaries
+// of the broadcasts, attaching the recordings of `s` if asked to.
+func newEmailNotifier(p prefs.Email, s nexmo.Storage, l *log.Logger) *nexmo.EmailNotifier {
+	port := p.Port
+	if port == 0 {
+		port = 587
+	}
+	e := nexmo.NewEmailNotifier(p.Host, port, p.Username, p.Password, p.From, p.To)
+	if p.AttachRecording {
+		e.Recs = s
+	}
+	l.Printf("emailing the broadcast summaries to %s", strings.Join(p.To, ", "))
+	return e
+}
+
+// newTranscriber returns the engine selected by `p`, nil if the
+// transcription is disabled.
+func newTranscriber(p prefs.Transcription) (nexmo.Transcriber, error) {
+	switch p.Engine {
+	case "":
+		return nil, nil
+	case prefs.TranscriptionWhisper:
+		if p.Whisper.Model == "" {
+			return nil, fmt.Errorf("whisper: model path is required")
+		}
+		return nexmo.Whisper{
+			Binary:  p.Whisper.Binary,
+			Model:   p.Whisper.Model,
+			Lang:    p.Whisper.Lang,
+			Threads: p.Whisper.Threads,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown transcription engine %q", p.Engine)
+	}
+}
+
+// newLangDetector returns the detector of the language of the
+// recordings, nil if the detection is disabled.
+func newLangDetector(p prefs.Transcription) (nexmo.LangDetector, error) {
+	if !p.DetectLang {
+		return nil, nil
+	}
+	t, err := newTranscriber(p)
+	if err != nil || t == nil {
+		return nil, err
+	}
+	if d, ok := t.(nexmo.LangDetector); ok {
+		return d, nil
+	}
+	return nexmo.TranscriberLang{Transcriber: t}, nil
+}
+
+// newTranscriptWorker returns the worker transcribing the
+// recordings of `s`, running until `ctx` is done, or nil if
+// transcription is disabled.
+func newTranscriptWorker(ctx context.Context, p prefs.Transcription, s nexmo.Storage, l *log.Logger) (*nexmo.TranscriptWorker, error) {
+	t, err := newTranscriber(p)
+	if err != nil || t == nil {
+		return nil, err
+	}
+	store, ok := s.(nexmo.TranscriptStore)
+	if !ok {
+		return nil, fmt.Errorf("transcription: storage cannot store transcripts")
+	}
+
+	l.Printf("transcribing recordings with %s", p.Engine)
+	w := nexmo.NewTranscriptWorker(t, s, store, 64)
+	w.Log = l
+	go w.Run(ctx)
+	return w, nil
+}
+
+func newRecStorage(p prefs.Storage, l *log.Logger) (nexmo.Storage, error) {
+	switch p.Kind {
+	case prefs.StorageLocal, "":
+		l.Printf("creating local storage in: %s", p.Local.RootDir)
+		return &storage.Local{RootDir: p.Local.RootDir, Log: l}, nil
+	case prefs.StorageGCS:
+		l.Printf("creating gcs storage in: gs://%s/%s", p.GCS.Bucket, p.GCS.Prefix)
+		// Without a credentials file, the application
+		// default credentials are used.
+		var creds io.Reader
+		if p.GCS.CredentialsFile != "" {
+			file, err := os.Open(p.GCS.CredentialsFile)
+			if err != nil {
+				return nil, fmt.Errorf("unable to open gcs credentials: %v", err)
+			}
+			defer file.Close()
+			creds = file
+		}
+
+		s, err := storage.NewGCS(creds, p.GCS.Bucket, p.GCS.Prefix)
+		if err != nil {
+			return nil, err
+		}
+		s.URLExpiry = time.Duration(p.GCS.SignedURLExpiry)
+		s.Log = l
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown storage kind %q", p.Kind)
+	}
+}
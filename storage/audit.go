@@ -0,0 +1,132 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+var (
+	_ nexmo.Auditor     = &AuditFile{}
+	_ nexmo.AuditReader = &AuditFile{}
+)
+
+// AuditFile is an audit log stored in a local file, one JSON
+// encoded nexmo.AuditEntry per line. The file is only ever
+// opened in append mode.
+type AuditFile struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	last *nexmo.AuditEntry
+}
+
+// OpenAuditFile opens, or creates, the audit log at `path`.
+// The existing entries are verified before appending new ones.
+func OpenAuditFile(path string) (*AuditFile, error) {
+	entries, err := ReadAuditFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("audit error: %v", err)
+	}
+	if err = nexmo.VerifyAudit(entries); err != nil {
+		return nil, fmt.Errorf("audit error: %s has been tampered with: %v", path, err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("audit error: %v", err)
+	}
+	a := &AuditFile{path: path, file: file}
+	if len(entries) > 0 {
+		a.last = &entries[len(entries)-1]
+	}
+	return a, nil
+}
+
+// Audit appends an entry, chained to the previous one.
+func (a *AuditFile) Audit(ctx context.Context, action string, details map[string]string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	e := nexmo.AuditEntry{
+		Time:    time.Now().UTC(),
+		Action:  action,
+		Details: details,
+	}.Chain(a.last)
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("audit error: %v", err)
+	}
+	if _, err = a.file.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("audit error: %v", err)
+	}
+	if err = a.file.Sync(); err != nil {
+		return fmt.Errorf("audit error: %v", err)
+	}
+	a.last = &e
+	return nil
+}
+
+// AuditLog reads the entries appended so far.
+func (a *AuditFile) AuditLog(ctx context.Context) ([]nexmo.AuditEntry, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entries, err := ReadAuditFile(a.path)
+	if err != nil {
+		return nil, fmt.Errorf("audit error: %v", err)
+	}
+	return entries, nil
+}
+
+func (a *AuditFile) Close() error {
+	return a.file.Close()
+}
+
+// ReadAuditFile decodes the entries of the audit log at `path`.
+func ReadAuditFile(path string) ([]nexmo.AuditEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadAudit(file)
+}
+
+// ReadAudit decodes the audit entries contained in `r`.
+func ReadAudit(r io.Reader) ([]nexmo.AuditEntry, error) {
+	acc := []nexmo.AuditEntry{}
+	dec := json.NewDecoder(r)
+	for {
+		var e nexmo.AuditEntry
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			return acc, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode audit entry %d: %v", len(acc)+1, err)
+		}
+		acc = append(acc, e)
+	}
+}
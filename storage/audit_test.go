@@ -0,0 +1,48 @@
+package storage_test
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestAuditFile(t *testing.T) {
+	l, done := newLocal(t)
+	defer done()
+	path := filepath.Join(l.RootDir, "audit.jsonl")
+
+	ctx := context.TODO()
+	for i := 0; i < 2; i++ {
+		// Reopening must continue the existing chain.
+		a, err := storage.OpenAuditFile(path)
+		if err != nil {
+			t.Fatalf("Unexpected open error: %v", err)
+		}
+		if err = a.Audit(ctx, nexmo.AuditBroadcast, map[string]string{"rec_name": "a.mp3"}); err != nil {
+			t.Fatalf("Unexpected audit error: %v", err)
+		}
+		a.Close()
+	}
+
+	entries, err := storage.ReadAuditFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected read error: %v", err)
+	}
+	if len(entries) != 2 || entries[1].Prev != entries[0].Hash {
+		t.Fatalf("Unexpected entries: %+v", entries)
+	}
+	if err = nexmo.VerifyAudit(entries); err != nil {
+		t.Fatalf("Unexpected verify error: %v", err)
+	}
+
+	b, _ := ioutil.ReadFile(path)
+	ioutil.WriteFile(path, []byte(strings.Replace(string(b), "a.mp3", "b.mp3", 1)), 0600)
+	if _, err = storage.OpenAuditFile(path); err == nil {
+		t.Fatalf("Tampered audit log was accepted")
+	}
+}
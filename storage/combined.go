@@ -0,0 +1,307 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+var (
+	_ nexmo.Storage          = Combined{}
+	_ nexmo.BroadcastLog     = Combined{}
+	_ nexmo.BroadcastHistory = Combined{}
+	_ nexmo.EventLog         = Combined{}
+	_ nexmo.TranscriptStore  = Combined{}
+	_ nexmo.GroupStore       = Combined{}
+	_ nexmo.TokenStore       = Combined{}
+	_ nexmo.RecClaimer       = Combined{}
+	_ nexmo.SuppressionList  = Combined{}
+	_ nexmo.TemplateStore    = Combined{}
+	_ nexmo.ContactsWriter   = Combined{}
+	_ nexmo.RecUsage         = Combined{}
+	_ nexmo.SubjectStore     = Combined{}
+)
+
+// Combined glues together a recordings store and a contacts
+// store, e.g. GCS for the recordings and SQLite for the contacts.
+type Combined struct {
+	nexmo.RecStore
+	nexmo.ContactsStore
+}
+
+// AppendContacts forwards to the contacts store, see
+// nexmo.AppendContacts.
+func (c Combined) AppendContacts(ctx context.Context, list nexmo.ContactList, contacts []nexmo.Contact) error {
+	return nexmo.AppendContacts(ctx, c.ContactsStore, list, contacts)
+}
+
+// WriteContacts forwards to the contacts store, see
+// nexmo.WriteContacts.
+func (c Combined) WriteContacts(ctx context.Context, list nexmo.ContactList, contacts []nexmo.Contact) error {
+	return nexmo.WriteContacts(ctx, c.ContactsStore, list, contacts)
+}
+
+// UsedRec forwards to the recordings store if it implements
+// nexmo.RecUsage, and is a no-op otherwise.
+func (c Combined) UsedRec(ctx context.Context, name string, id int64) error {
+	if u, ok := c.RecStore.(nexmo.RecUsage); ok {
+		return u.UsedRec(ctx, name, id)
+	}
+	return nil
+}
+
+// CreateBroadcast forwards to the contacts store if it
+// implements nexmo.BroadcastLog, and is a no-op otherwise.
+func (c Combined) CreateBroadcast(ctx context.Context, b nexmo.Broadcast) (nexmo.Broadcast, error) {
+	if l, ok := c.ContactsStore.(nexmo.BroadcastLog); ok {
+		return l.CreateBroadcast(ctx, b)
+	}
+	return b, nil
+}
+
+// LogAttempt forwards to the contacts store if it
+// implements nexmo.BroadcastLog, and is a no-op otherwise.
+func (c Combined) LogAttempt(ctx context.Context, a nexmo.CallAttempt) error {
+	if l, ok := c.ContactsStore.(nexmo.BroadcastLog); ok {
+		return l.LogAttempt(ctx, a)
+	}
+	return nil
+}
+
+// Broadcast forwards to the contacts store if it implements
+// nexmo.BroadcastHistory, and returns nexmo.ErrNoHistory otherwise.
+func (c Combined) Broadcast(ctx context.Context, id int64) (nexmo.Broadcast, error) {
+	if h, ok := c.ContactsStore.(nexmo.BroadcastHistory); ok {
+		return h.Broadcast(ctx, id)
+	}
+	return nexmo.Broadcast{}, nexmo.ErrNoHistory
+}
+
+// Broadcasts forwards to the contacts store if it implements
+// nexmo.BroadcastHistory, and returns nexmo.ErrNoHistory otherwise.
+func (c Combined) Broadcasts(ctx context.Context, since time.Time) ([]nexmo.Broadcast, error) {
+	if h, ok := c.ContactsStore.(nexmo.BroadcastHistory); ok {
+		return h.Broadcasts(ctx, since)
+	}
+	return nil, nexmo.ErrNoHistory
+}
+
+// Attempts forwards to the contacts store if it implements
+// nexmo.BroadcastHistory, and returns nexmo.ErrNoHistory otherwise.
+func (c Combined) Attempts(ctx context.Context, id int64) ([]nexmo.CallAttempt, error) {
+	if h, ok := c.ContactsStore.(nexmo.BroadcastHistory); ok {
+		return h.Attempts(ctx, id)
+	}
+	return nil, nexmo.ErrNoHistory
+}
+
+// LogEvent forwards to the contacts store if it
+// implements nexmo.EventLog, and is a no-op otherwise.
+func (c Combined) LogEvent(ctx context.Context, e nexmo.CallEvent) error {
+	if l, ok := c.ContactsStore.(nexmo.EventLog); ok {
+		return l.LogEvent(ctx, e)
+	}
+	return nil
+}
+
+// Events forwards to the contacts store if it implements
+// nexmo.EventLog, and returns nexmo.ErrNoHistory otherwise.
+func (c Combined) Events(ctx context.Context, conversationUUID string) ([]nexmo.CallEvent, error) {
+	if l, ok := c.ContactsStore.(nexmo.EventLog); ok {
+		return l.Events(ctx, conversationUUID)
+	}
+	return nil, nexmo.ErrNoHistory
+}
+
+// CompletedCalls forwards to the contacts store if it implements
+// nexmo.UsageLog, and returns nexmo.ErrNoHistory otherwise.
+func (c Combined) CompletedCalls(ctx context.Context, since, until time.Time) ([]nexmo.CallEvent, error) {
+	if l, ok := c.ContactsStore.(nexmo.UsageLog); ok {
+		return l.CompletedCalls(ctx, since, until)
+	}
+	return nil, nexmo.ErrNoHistory
+}
+
+// ArchiveFailure forwards to the contacts store if it implements
+// nexmo.FailureArchive, and does nothing otherwise.
+func (c Combined) ArchiveFailure(ctx context.Context, f nexmo.CallFailure) error {
+	if a, ok := c.ContactsStore.(nexmo.FailureArchive); ok {
+		return a.ArchiveFailure(ctx, f)
+	}
+	return nil
+}
+
+// Failures forwards to the contacts store if it implements
+// nexmo.FailureArchive, and returns nexmo.ErrNoHistory otherwise.
+func (c Combined) Failures(ctx context.Context, broadcastID int64) ([]nexmo.CallFailure, error) {
+	if a, ok := c.ContactsStore.(nexmo.FailureArchive); ok {
+		return a.Failures(ctx, broadcastID)
+	}
+	return nil, nexmo.ErrNoHistory
+}
+
+// WriteTranscript forwards to the recordings store if it
+// implements nexmo.TranscriptStore, and returns
+// nexmo.ErrNoHistory otherwise.
+func (c Combined) WriteTranscript(ctx context.Context, t nexmo.Transcript) error {
+	if ts, ok := c.RecStore.(nexmo.TranscriptStore); ok {
+		return ts.WriteTranscript(ctx, t)
+	}
+	return nexmo.ErrNoHistory
+}
+
+// Transcript forwards to the recordings store if it implements
+// nexmo.TranscriptStore, and returns nexmo.ErrNoHistory otherwise.
+func (c Combined) Transcript(ctx context.Context, recName string) (nexmo.Transcript, error) {
+	if ts, ok := c.RecStore.(nexmo.TranscriptStore); ok {
+		return ts.Transcript(ctx, recName)
+	}
+	return nexmo.Transcript{}, nexmo.ErrNoHistory
+}
+
+// GroupMembers forwards to the contacts store if it implements
+// nexmo.GroupStore, and returns nexmo.ErrNoHistory otherwise.
+func (c Combined) GroupMembers(ctx context.Context, group string) ([]nexmo.Contact, error) {
+	if g, ok := c.ContactsStore.(nexmo.GroupStore); ok {
+		return g.GroupMembers(ctx, group)
+	}
+	return nil, nexmo.ErrNoHistory
+}
+
+// SaveToken forwards to the contacts store if it implements
+// nexmo.TokenStore, and returns nexmo.ErrNoHistory otherwise.
+func (c Combined) SaveToken(ctx context.Context, t nexmo.Token) error {
+	if ts, ok := c.ContactsStore.(nexmo.TokenStore); ok {
+		return ts.SaveToken(ctx, t)
+	}
+	return nexmo.ErrNoHistory
+}
+
+// TokenByHash forwards to the contacts store if it implements
+// nexmo.TokenStore, and returns nexmo.ErrNoHistory otherwise.
+func (c Combined) TokenByHash(ctx context.Context, hash string) (nexmo.Token, error) {
+	if ts, ok := c.ContactsStore.(nexmo.TokenStore); ok {
+		return ts.TokenByHash(ctx, hash)
+	}
+	return nexmo.Token{}, nexmo.ErrNoHistory
+}
+
+// Tokens forwards to the contacts store if it implements
+// nexmo.TokenStore, and returns nexmo.ErrNoHistory otherwise.
+func (c Combined) Tokens(ctx context.Context) ([]nexmo.Token, error) {
+	if ts, ok := c.ContactsStore.(nexmo.TokenStore); ok {
+		return ts.Tokens(ctx)
+	}
+	return nil, nexmo.ErrNoHistory
+}
+
+// RevokeToken forwards to the contacts store if it implements
+// nexmo.TokenStore, and returns nexmo.ErrNoHistory otherwise.
+func (c Combined) RevokeToken(ctx context.Context, id string, at time.Time) error {
+	if ts, ok := c.ContactsStore.(nexmo.TokenStore); ok {
+		return ts.RevokeToken(ctx, id, at)
+	}
+	return nexmo.ErrNoHistory
+}
+
+// ClaimRec forwards to the contacts store if it implements
+// nexmo.RecClaimer, to the recordings store if it does, and
+// returns nexmo.ErrNoHistory otherwise.
+func (c Combined) ClaimRec(ctx context.Context, uuid string) (bool, error) {
+	if rc, ok := c.ContactsStore.(nexmo.RecClaimer); ok {
+		return rc.ClaimRec(ctx, uuid)
+	}
+	if rc, ok := c.RecStore.(nexmo.RecClaimer); ok {
+		return rc.ClaimRec(ctx, uuid)
+	}
+	return false, nexmo.ErrNoHistory
+}
+
+// Suppress forwards to the contacts store if it implements
+// nexmo.SuppressionList, and returns nexmo.ErrNoHistory otherwise.
+func (c Combined) Suppress(ctx context.Context, s nexmo.Suppression) error {
+	if l, ok := c.ContactsStore.(nexmo.SuppressionList); ok {
+		return l.Suppress(ctx, s)
+	}
+	return nexmo.ErrNoHistory
+}
+
+// Unsuppress forwards to the contacts store if it implements
+// nexmo.SuppressionList, and returns nexmo.ErrNoHistory otherwise.
+func (c Combined) Unsuppress(ctx context.Context, number string) error {
+	if l, ok := c.ContactsStore.(nexmo.SuppressionList); ok {
+		return l.Unsuppress(ctx, number)
+	}
+	return nexmo.ErrNoHistory
+}
+
+// Suppressions forwards to the contacts store if it implements
+// nexmo.SuppressionList, and returns nexmo.ErrNoHistory otherwise.
+func (c Combined) Suppressions(ctx context.Context) ([]nexmo.Suppression, error) {
+	if l, ok := c.ContactsStore.(nexmo.SuppressionList); ok {
+		return l.Suppressions(ctx)
+	}
+	return nil, nexmo.ErrNoHistory
+}
+
+// SaveTemplate forwards to the contacts store if it implements
+// nexmo.TemplateStore, and returns nexmo.ErrNoHistory otherwise.
+func (c Combined) SaveTemplate(ctx context.Context, t nexmo.Template) error {
+	if ts, ok := c.ContactsStore.(nexmo.TemplateStore); ok {
+		return ts.SaveTemplate(ctx, t)
+	}
+	return nexmo.ErrNoHistory
+}
+
+// Templates forwards to the contacts store if it implements
+// nexmo.TemplateStore, and returns nexmo.ErrNoHistory otherwise.
+func (c Combined) Templates(ctx context.Context) ([]nexmo.Template, error) {
+	if ts, ok := c.ContactsStore.(nexmo.TemplateStore); ok {
+		return ts.Templates(ctx)
+	}
+	return nil, nexmo.ErrNoHistory
+}
+
+// DeleteTemplate forwards to the contacts store if it implements
+// nexmo.TemplateStore, and returns nexmo.ErrNoHistory otherwise.
+func (c Combined) DeleteTemplate(ctx context.Context, name string) error {
+	if ts, ok := c.ContactsStore.(nexmo.TemplateStore); ok {
+		return ts.DeleteTemplate(ctx, name)
+	}
+	return nexmo.ErrNoHistory
+}
+
+// SubjectRecords forwards to the contacts store if it implements
+// nexmo.SubjectStore, and returns nexmo.ErrNoHistory otherwise.
+func (c Combined) SubjectRecords(ctx context.Context, number string) (nexmo.SubjectRecords, error) {
+	if ss, ok := c.ContactsStore.(nexmo.SubjectStore); ok {
+		return ss.SubjectRecords(ctx, number)
+	}
+	return nexmo.SubjectRecords{}, nexmo.ErrNoHistory
+}
+
+// EraseSubjectRecords forwards to the contacts store if it implements
+// nexmo.SubjectStore, and returns nexmo.ErrNoHistory otherwise.
+func (c Combined) EraseSubjectRecords(ctx context.Context, number string) error {
+	if ss, ok := c.ContactsStore.(nexmo.SubjectStore); ok {
+		return ss.EraseSubjectRecords(ctx, number)
+	}
+	return nexmo.ErrNoHistory
+}
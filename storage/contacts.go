@@ -0,0 +1,102 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+const (
+	BroadcastListFile = "contacts.csv"
+	WhitelistFile     = "whitelist.csv"
+)
+
+func contactsFile(list nexmo.ContactList) (string, error) {
+	switch list {
+	case nexmo.BroadcastList:
+		return BroadcastListFile, nil
+	case nexmo.Whitelist:
+		return WhitelistFile, nil
+	default:
+		return "", fmt.Errorf("storage error: unknown contact list %q", list)
+	}
+}
+
+// putContact appends `c` to `contacts`, replacing the
+// contact with the same number if present.
+func putContact(contacts []nexmo.Contact, c nexmo.Contact) []nexmo.Contact {
+	for i, v := range contacts {
+		if v.Number == c.Number {
+			contacts[i] = c
+			return contacts
+		}
+	}
+	return append(contacts, c)
+}
+
+// dropContact removes the contact identified by `number`
+// from `contacts`, reporting whether it was found.
+func dropContact(contacts []nexmo.Contact, number string) ([]nexmo.Contact, bool) {
+	acc := make([]nexmo.Contact, 0, len(contacts))
+	for _, v := range contacts {
+		if v.Number != number {
+			acc = append(acc, v)
+		}
+	}
+	return acc, len(acc) != len(contacts)
+}
+
+// writeFileAtomic replaces the contents of `path` with `data`,
+// see writeAtomic.
+func writeFileAtomic(path string, data []byte) error {
+	_, err := writeAtomic(path, bytes.NewReader(data))
+	return err
+}
+
+// writeAtomic replaces the contents of `path` with the contents
+// of `src`, returning the number of bytes written. They are
+// written to a temporary file in the same directory, synced and
+// then renamed over `path`: readers either find the old contents
+// or the new ones, never a partial write.
+func writeAtomic(path string, src io.Reader) (int64, error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, src)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return n, os.Rename(tmp.Name(), path)
+}
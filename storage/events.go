@@ -0,0 +1,65 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+var _ nexmo.EventSink = &EventFile{}
+
+// EventFile is an events sink appending each event to a local
+// file, one JSON encoded nexmo.CallEvent per line, ready to be
+// tailed by other systems.
+type EventFile struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenEventFile opens, or creates, the events file at `path`.
+func OpenEventFile(path string) (*EventFile, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("event sink error: %v", err)
+	}
+	return &EventFile{file: file}, nil
+}
+
+// Consume appends `e` to the file.
+func (f *EventFile) Consume(ctx context.Context, e nexmo.CallEvent) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("event sink error: %v", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err = f.file.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("event sink error: %v", err)
+	}
+	return nil
+}
+
+func (f *EventFile) Close() error {
+	return f.file.Close()
+}
@@ -0,0 +1,53 @@
+package storage_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/nexmo/nexmotest"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestEventFile(t *testing.T) {
+	l, done := newLocal(t)
+	defer done()
+	path := filepath.Join(l.RootDir, "sink.jsonl")
+	sink, err := storage.OpenEventFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected open error: %v", err)
+	}
+	defer sink.Close()
+
+	r := nexmo.NewRouter(nil, l, "https://voicebr.example.com", nexmo.RouterOptions{Events: sink})
+	for _, v := range []string{"answered", "completed"} {
+		r.ServeHTTP(httptest.NewRecorder(), nexmotest.EventWebhook("/record/voice/event", "CON-1", v, 42*time.Second))
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var events []nexmo.CallEvent
+	for sc := bufio.NewScanner(file); sc.Scan(); {
+		var e nexmo.CallEvent
+		if err = json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("Unexpected decode error: %v", err)
+		}
+		events = append(events, e)
+	}
+	if len(events) != 2 || events[0].ConversationUUID != "CON-1" || events[1].Status != "completed" {
+		t.Fatalf("Unexpected events: %+v", events)
+	}
+	// The events are persisted by the storage too.
+	if persisted, _ := l.Events(context.TODO(), "CON-1"); len(persisted) != 2 {
+		t.Fatalf("Wanted 2 persisted events, found %d", len(persisted))
+	}
+}
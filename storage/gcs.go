@@ -0,0 +1,685 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/jecoz/voicebr/nexmo"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	gcsHost      = "storage.googleapis.com"
+	gcsAPI       = "https://" + gcsHost + "/storage/v1"
+	gcsUploadAPI = "https://" + gcsHost + "/upload/storage/v1"
+	gcsScope     = "https://www.googleapis.com/auth/devstorage.read_write"
+)
+
+var (
+	_ nexmo.Storage         = &GCS{}
+	_ nexmo.TranscriptStore = &GCS{}
+	_ nexmo.ContactsWriter  = &GCS{}
+	_ nexmo.RecUsage        = &GCS{}
+	_ nexmo.RecRangeReader  = &GCS{}
+)
+
+// GCS is a storage implementation backed by a Google Cloud
+// Storage bucket. It talks to the JSON API through an OAuth2
+// client, using either a service account key, which is also used
+// to sign the URLs that nexmo uses to fetch the recordings, or the
+// application default credentials.
+type GCS struct {
+	Bucket string
+	// Prefix is prepended to every object name.
+	Prefix string
+	// URLExpiry is the lifetime of the signed URLs
+	// produced by RecFileHandler. Zero, or credentials
+	// without a service account key, serve the recordings
+	// without signed URLs.
+	URLExpiry time.Duration
+	Log       *log.Logger
+
+	internal *http.Client
+	email    string
+	key      *rsa.PrivateKey
+}
+
+// NewGCS creates a new GCS storage reading the service account
+// JSON key from `credsR`. When `credsR` is nil, the application
+// default credentials are used instead.
+func NewGCS(credsR io.Reader, bucket, prefix string) (*GCS, error) {
+	ctx := context.Background()
+	g := &GCS{
+		Bucket:    bucket,
+		Prefix:    prefix,
+		URLExpiry: time.Hour,
+	}
+	if credsR == nil {
+		creds, err := google.FindDefaultCredentials(ctx, gcsScope)
+		if err != nil {
+			return nil, fmt.Errorf("new gcs error: %v", err)
+		}
+		g.internal = oauth2.NewClient(ctx, creds.TokenSource)
+		return g, nil
+	}
+
+	data, err := ioutil.ReadAll(credsR)
+	if err != nil {
+		return nil, fmt.Errorf("new gcs error: unable to read credentials: %v", err)
+	}
+	conf, err := google.JWTConfigFromJSON(data, gcsScope)
+	if err != nil {
+		return nil, fmt.Errorf("new gcs error: %v", err)
+	}
+	if g.key, err = jwt.ParseRSAPrivateKeyFromPEM(conf.PrivateKey); err != nil {
+		return nil, fmt.Errorf("new gcs error: %v", err)
+	}
+	g.email = conf.Email
+	g.internal = conf.Client(ctx)
+	return g, nil
+}
+
+func (g *GCS) do(ctx context.Context, method, url string, body io.Reader, contentType string) (*http.Response, error) {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	return g.doHeader(ctx, method, url, body, header)
+}
+
+// doHeader is do with the request headers `header`.
+func (g *GCS) doHeader(ctx context.Context, method, url string, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to make request: %v", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := g.internal.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, errGCSNotFound
+	}
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		resp.Body.Close()
+		return nil, errGCSPrecondition
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("request failed: %s", resp.Status)
+	}
+	return resp, nil
+}
+
+var (
+	errGCSNotFound     = errors.New("object not found")
+	errGCSPrecondition = errors.New("object precondition failed")
+)
+
+func (g *GCS) recObject(name string) string {
+	return path.Join(g.Prefix, "recs", path.Base(name))
+}
+
+func (g *GCS) objectURL(object string) string {
+	return gcsAPI + "/b/" + g.Bucket + "/o/" + url.PathEscape(object)
+}
+
+type gcsObject struct {
+	Name        string            `json:"name"`
+	ContentType string            `json:"contentType"`
+	Size        string            `json:"size"`
+	Generation  string            `json:"generation,omitempty"`
+	TimeCreated time.Time         `json:"timeCreated"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+func (o gcsObject) meta() nexmo.RecMeta {
+	size, _ := strconv.ParseInt(o.Size, 10, 64)
+	meta := nexmo.RecMeta{
+		Name:        path.Base(o.Name),
+		ContentType: o.ContentType,
+		Size:        size,
+		CreatedAt:   o.TimeCreated,
+	}
+	if v := o.Metadata["channels"]; v != "" {
+		meta.Channels = strings.Split(v, ",")
+	}
+	meta.Caller = o.Metadata["caller"]
+	if v, err := time.ParseDuration(o.Metadata["duration"]); err == nil {
+		meta.Duration = v
+	}
+	for _, v := range strings.Split(o.Metadata["broadcasts"], ",") {
+		if id, err := strconv.ParseInt(v, 10, 64); err == nil {
+			meta.Broadcasts = append(meta.Broadcasts, id)
+		}
+	}
+	return meta
+}
+
+// recMetadata returns the custom metadata of the
+// recording object described by `meta`.
+func recMetadata(meta nexmo.RecMeta) map[string]string {
+	metadata := make(map[string]string)
+	if len(meta.Channels) > 0 {
+		metadata["channels"] = strings.Join(meta.Channels, ",")
+	}
+	if meta.Caller != "" {
+		metadata["caller"] = meta.Caller
+	}
+	if meta.Duration > 0 {
+		metadata["duration"] = meta.Duration.String()
+	}
+	if len(meta.Broadcasts) > 0 {
+		ids := make([]string, len(meta.Broadcasts))
+		for i, v := range meta.Broadcasts {
+			ids[i] = strconv.FormatInt(v, 10)
+		}
+		metadata["broadcasts"] = strings.Join(ids, ",")
+	}
+	return metadata
+}
+
+// upload stores `src` into `object`. When `metadata` is not empty,
+// it is stored as the object's custom metadata, which requires a
+// multipart upload.
+func (g *GCS) upload(ctx context.Context, src io.Reader, object, contentType string, metadata map[string]string) (gcsObject, error) {
+	u := gcsUploadAPI + "/b/" + g.Bucket + "/o?uploadType=media&name=" + url.QueryEscape(object)
+	if len(metadata) > 0 {
+		var err error
+		u = gcsUploadAPI + "/b/" + g.Bucket + "/o?uploadType=multipart"
+		if src, contentType, err = multipartUpload(src, gcsObject{
+			Name:        object,
+			ContentType: contentType,
+			Metadata:    metadata,
+		}); err != nil {
+			return gcsObject{}, err
+		}
+	}
+	resp, err := g.do(ctx, "POST", u, src, contentType)
+	if err != nil {
+		return gcsObject{}, err
+	}
+	defer resp.Body.Close()
+
+	var obj gcsObject
+	if err = json.NewDecoder(resp.Body).Decode(&obj); err != nil {
+		return gcsObject{}, fmt.Errorf("unable to decode upload response: %v", err)
+	}
+	return obj, nil
+}
+
+// multipartUpload returns the body of a multipart upload of the
+// object described by `obj`, whose contents are read from `src`.
+func multipartUpload(src io.Reader, obj gcsObject) (io.Reader, string, error) {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to encode object metadata: %v", err)
+	}
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/json; charset=UTF-8"}})
+		if err == nil {
+			_, err = part.Write(b)
+		}
+		if err == nil {
+			part, err = mw.CreatePart(textproto.MIMEHeader{"Content-Type": {obj.ContentType}})
+		}
+		if err == nil {
+			_, err = io.Copy(part, src)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, "multipart/related; boundary=" + mw.Boundary(), nil
+}
+
+func (g *GCS) download(ctx context.Context, object string) (io.ReadCloser, error) {
+	resp, err := g.do(ctx, "GET", g.objectURL(object)+"?alt=media", nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// WriteRec uploads `src` into the bucket.
+func (g *GCS) WriteRec(ctx context.Context, src io.Reader, name string, meta nexmo.RecMeta) (nexmo.RecMeta, error) {
+	if meta.ContentType == "" {
+		meta.ContentType = nexmo.ContentType(name)
+	}
+
+	object := g.recObject(name)
+	logger(g.Log).Printf("gcs storage: saving recording gs://%s/%s", g.Bucket, object)
+	obj, err := g.upload(ctx, src, object, meta.ContentType, recMetadata(meta))
+	if err != nil {
+		return meta, fmt.Errorf("gcs storage error: unable to upload rec: %v", err)
+	}
+	return obj.meta(), nil
+}
+
+// OpenRec downloads the recording `name`.
+func (g *GCS) OpenRec(ctx context.Context, name string) (io.ReadCloser, nexmo.RecMeta, error) {
+	meta, err := g.StatRec(ctx, name)
+	if err != nil {
+		return nil, meta, err
+	}
+	body, err := g.download(ctx, g.recObject(name))
+	if err == errGCSNotFound {
+		return nil, nexmo.RecMeta{}, nexmo.ErrRecNotFound
+	}
+	if err != nil {
+		return nil, nexmo.RecMeta{}, fmt.Errorf("gcs storage error: unable to open rec: %v", err)
+	}
+	return body, meta, nil
+}
+
+// StatRec returns the metadata of the recording `name`.
+func (g *GCS) StatRec(ctx context.Context, name string) (nexmo.RecMeta, error) {
+	resp, err := g.do(ctx, "GET", g.objectURL(g.recObject(name)), nil, "")
+	if err == errGCSNotFound {
+		return nexmo.RecMeta{}, nexmo.ErrRecNotFound
+	}
+	if err != nil {
+		return nexmo.RecMeta{}, fmt.Errorf("gcs storage error: unable to stat rec: %v", err)
+	}
+	defer resp.Body.Close()
+	var obj gcsObject
+	if err = json.NewDecoder(resp.Body).Decode(&obj); err != nil {
+		return nexmo.RecMeta{}, fmt.Errorf("gcs storage error: unable to decode rec metadata: %v", err)
+	}
+	return obj.meta(), nil
+}
+
+// UsedRec adds broadcast `id` to the custom metadata of the
+// recording object `name`.
+func (g *GCS) UsedRec(ctx context.Context, name string, id int64) error {
+	meta, err := g.StatRec(ctx, name)
+	if err != nil {
+		return err
+	}
+	for _, v := range meta.Broadcasts {
+		if v == id {
+			return nil
+		}
+	}
+	meta.Broadcasts = append(meta.Broadcasts, id)
+	body, err := json.Marshal(map[string]interface{}{"metadata": recMetadata(meta)})
+	if err != nil {
+		return fmt.Errorf("gcs storage error: %v", err)
+	}
+	resp, err := g.do(ctx, "PATCH", g.objectURL(g.recObject(name)), bytes.NewReader(body), "application/json")
+	if err != nil {
+		return fmt.Errorf("gcs storage error: unable to update rec metadata: %v", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// OpenRecRange downloads `length` bytes of the recording `name`,
+// starting at `offset`.
+func (g *GCS) OpenRecRange(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	if length == 0 {
+		return http.NoBody, nil
+	}
+	header := http.Header{}
+	header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	resp, err := g.doHeader(ctx, "GET", g.objectURL(g.recObject(name))+"?alt=media", nil, header)
+	if err == errGCSNotFound {
+		return nil, nexmo.ErrRecNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("gcs storage error: unable to open rec range: %v", err)
+	}
+	return resp.Body, nil
+}
+
+// ListRecs lists the recordings stored under `Prefix`/recs.
+func (g *GCS) ListRecs(ctx context.Context) ([]nexmo.RecMeta, error) {
+	prefix := g.recObject("") + "/"
+	acc := []nexmo.RecMeta{}
+	pageToken := ""
+	for {
+		u := gcsAPI + "/b/" + g.Bucket + "/o?prefix=" + url.QueryEscape(prefix)
+		if pageToken != "" {
+			u += "&pageToken=" + url.QueryEscape(pageToken)
+		}
+		resp, err := g.do(ctx, "GET", u, nil, "")
+		if err != nil {
+			return nil, fmt.Errorf("gcs storage error: unable to list recs: %v", err)
+		}
+
+		var page struct {
+			Items         []gcsObject `json:"items"`
+			NextPageToken string      `json:"nextPageToken"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("gcs storage error: unable to decode recs list: %v", err)
+		}
+
+		for _, v := range page.Items {
+			acc = append(acc, v.meta())
+		}
+		if page.NextPageToken == "" {
+			return acc, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// DeleteRec removes the recording `name` from the bucket,
+// together with its transcript if there is one.
+func (g *GCS) DeleteRec(ctx context.Context, name string) error {
+	resp, err := g.do(ctx, "DELETE", g.objectURL(g.recObject(name)), nil, "")
+	if err == errGCSNotFound {
+		return nexmo.ErrRecNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("gcs storage error: unable to delete rec: %v", err)
+	}
+	resp.Body.Close()
+	if resp, err = g.do(ctx, "DELETE", g.objectURL(g.transcriptObject(name)), nil, ""); err == nil {
+		resp.Body.Close()
+	}
+	return nil
+}
+
+// RecFileHandler redirects the requests to a signed URL
+// pointing to the requested recording, which GCS serves with
+// byte range support. When URLExpiry is zero, or there is no
+// key to sign the URLs with, the recordings are served through
+// RecHandler instead.
+func (g *GCS) RecFileHandler() http.Handler {
+	if g.URLExpiry == 0 || g.key == nil {
+		return nexmo.RecHandler(g, g.Log)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, err := g.SignedURL(r.URL.Path, g.URLExpiry)
+		if err != nil {
+			logger(g.Log).Printf("gcs storage error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, u, http.StatusFound)
+	})
+}
+
+// SignedURL returns a V4 signed URL that allows to GET the recording
+// `name` for `expiry` time, without any further authentication.
+func (g *GCS) SignedURL(name string, expiry time.Duration) (string, error) {
+	if g.key == nil {
+		return "", errors.New("unable to sign url: no service account key")
+	}
+	now := time.Now().UTC()
+	date := now.Format("20060102")
+	timestamp := now.Format("20060102T150405Z")
+	scope := date + "/auto/storage/goog4_request"
+
+	escaped := (&url.URL{Path: "/" + g.Bucket + "/" + g.recObject(name)}).EscapedPath()
+	query := url.Values{}
+	query.Set("X-Goog-Algorithm", "GOOG4-RSA-SHA256")
+	query.Set("X-Goog-Credential", g.email+"/"+scope)
+	query.Set("X-Goog-Date", timestamp)
+	query.Set("X-Goog-Expires", strconv.Itoa(int(expiry.Seconds())))
+	query.Set("X-Goog-SignedHeaders", "host")
+	// url.Values encodes spaces as "+", which GCS does not accept.
+	canonicalQuery := strings.Replace(query.Encode(), "+", "%20", -1)
+
+	canonicalReq := strings.Join([]string{
+		"GET",
+		escaped,
+		canonicalQuery,
+		"host:" + gcsHost,
+		"",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	reqHash := sha256.Sum256([]byte(canonicalReq))
+
+	toSign := strings.Join([]string{
+		"GOOG4-RSA-SHA256",
+		timestamp,
+		scope,
+		hex.EncodeToString(reqHash[:]),
+	}, "\n")
+	hash := sha256.Sum256([]byte(toSign))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, g.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", fmt.Errorf("unable to sign url: %v", err)
+	}
+
+	return "https://" + gcsHost + escaped + "?" + canonicalQuery + "&X-Goog-Signature=" + hex.EncodeToString(sig), nil
+}
+
+func (g *GCS) readContacts(ctx context.Context, dest io.Writer, fileName string) error {
+	object := path.Join(g.Prefix, fileName)
+	body, err := g.download(ctx, object)
+	if err == errGCSNotFound {
+		// Same as a missing local file: an empty list.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("gcs storage error: unable to read contacts: %v", err)
+	}
+	defer body.Close()
+
+	logger(g.Log).Printf("gcs storage: reading contacts from gs://%s/%s", g.Bucket, object)
+	if _, err = io.Copy(dest, body); err != nil {
+		return fmt.Errorf("gcs storage error: unable to copy contacts to destination: %v", err)
+	}
+	return nil
+}
+
+func (g *GCS) ReadBroadcastList(dest io.Writer) error {
+	return g.readContacts(context.Background(), dest, BroadcastListFile)
+}
+
+func (g *GCS) ReadWhitelist(dest io.Writer) error {
+	return g.readContacts(context.Background(), dest, WhitelistFile)
+}
+
+// ListContacts decodes and returns the contacts stored in `list`.
+func (g *GCS) ListContacts(ctx context.Context, list nexmo.ContactList) ([]nexmo.Contact, error) {
+	fileName, err := contactsFile(list)
+	if err != nil {
+		return nil, err
+	}
+	return nexmo.DecodeContacts(func(w io.Writer) error {
+		return g.readContacts(ctx, w, fileName)
+	}, g.Log)
+}
+
+// AddContact adds `c` to `list`, replacing the contact with
+// the same number if present.
+func (g *GCS) AddContact(ctx context.Context, list nexmo.ContactList, c nexmo.Contact) error {
+	return g.AppendContacts(ctx, list, []nexmo.Contact{c})
+}
+
+// AppendContacts adds `contacts` to `list`, replacing the ones
+// with the same numbers, with a single upload.
+func (g *GCS) AppendContacts(ctx context.Context, list nexmo.ContactList, contacts []nexmo.Contact) error {
+	acc, err := g.ListContacts(ctx, list)
+	if err != nil && err != nexmo.ErrCorruptedContacts {
+		return err
+	}
+	for _, v := range contacts {
+		acc = putContact(acc, v)
+	}
+	return g.writeContacts(ctx, list, acc)
+}
+
+// WriteContacts replaces the contents of `list` with `contacts`.
+func (g *GCS) WriteContacts(ctx context.Context, list nexmo.ContactList, contacts []nexmo.Contact) error {
+	acc := []nexmo.Contact{}
+	for _, v := range contacts {
+		acc = putContact(acc, v)
+	}
+	return g.writeContacts(ctx, list, acc)
+}
+
+// RemoveContact removes the contact identified by `number` from `list`.
+func (g *GCS) RemoveContact(ctx context.Context, list nexmo.ContactList, number string) error {
+	contacts, err := g.ListContacts(ctx, list)
+	if err != nil && err != nexmo.ErrCorruptedContacts {
+		return err
+	}
+	acc, ok := dropContact(contacts, number)
+	if !ok {
+		return nexmo.ErrContactNotFound
+	}
+	return g.writeContacts(ctx, list, acc)
+}
+
+func (g *GCS) writeContacts(ctx context.Context, list nexmo.ContactList, contacts []nexmo.Contact) error {
+	fileName, err := contactsFile(list)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err = nexmo.EncodeContacts(&buf, contacts); err != nil {
+		return fmt.Errorf("gcs storage error: %v", err)
+	}
+	object := path.Join(g.Prefix, fileName)
+	logger(g.Log).Printf("gcs storage: writing %d contacts to gs://%s/%s", len(contacts), g.Bucket, object)
+	if _, err = g.upload(ctx, &buf, object, "text/csv", nil); err != nil {
+		return fmt.Errorf("gcs storage error: unable to write contacts: %v", err)
+	}
+	return nil
+}
+
+func (g *GCS) transcriptObject(recName string) string {
+	return path.Join(g.Prefix, "transcripts", path.Base(recName)+".json")
+}
+
+// WriteTranscript uploads `t` into the bucket, next to the
+// recordings.
+func (g *GCS) WriteTranscript(ctx context.Context, t nexmo.Transcript) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("gcs storage error: unable to encode transcript: %v", err)
+	}
+	if _, err = g.upload(ctx, bytes.NewReader(b), g.transcriptObject(t.RecName), "application/json", nil); err != nil {
+		return fmt.Errorf("gcs storage error: unable to upload transcript: %v", err)
+	}
+	return nil
+}
+
+func (g *GCS) Transcript(ctx context.Context, recName string) (nexmo.Transcript, error) {
+	var t nexmo.Transcript
+	body, err := g.download(ctx, g.transcriptObject(recName))
+	if err == errGCSNotFound {
+		return t, nexmo.ErrTranscriptNotFound
+	}
+	if err != nil {
+		return t, fmt.Errorf("gcs storage error: unable to read transcript: %v", err)
+	}
+	defer body.Close()
+	if err = json.NewDecoder(body).Decode(&t); err != nil {
+		return t, fmt.Errorf("gcs storage error: unable to decode transcript: %v", err)
+	}
+	return t, nil
+}
+
+// ClaimRec creates an empty object named after `uuid`, next
+// to the recordings, failing if it already exists. Claims older
+// than nexmo.RecClaimTTL are removed and claimed again.
+func (g *GCS) ClaimRec(ctx context.Context, uuid string) (bool, error) {
+	object := path.Join(g.Prefix, "claims", path.Base(uuid))
+	u := gcsUploadAPI + "/b/" + g.Bucket + "/o?uploadType=media&ifGenerationMatch=0&name=" + url.QueryEscape(object)
+	resp, err := g.do(ctx, "POST", u, strings.NewReader(""), "text/plain")
+	if err == errGCSPrecondition {
+		var expired bool
+		if expired, err = g.expireClaim(ctx, object); err != nil || !expired {
+			return false, err
+		}
+		resp, err = g.do(ctx, "POST", u, strings.NewReader(""), "text/plain")
+	}
+	if err == errGCSPrecondition {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("gcs storage error: unable to claim recording: %v", err)
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+// expireClaim removes the claim `object` when it is older than
+// nexmo.RecClaimTTL. The generation precondition prevents removing
+// a claim that was just renewed by another instance.
+func (g *GCS) expireClaim(ctx context.Context, object string) (bool, error) {
+	resp, err := g.do(ctx, "GET", g.objectURL(object), nil, "")
+	if err == errGCSNotFound {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("gcs storage error: unable to stat claim: %v", err)
+	}
+	var obj gcsObject
+	err = json.NewDecoder(resp.Body).Decode(&obj)
+	resp.Body.Close()
+	if err != nil {
+		return false, fmt.Errorf("gcs storage error: unable to decode claim: %v", err)
+	}
+	if time.Since(obj.TimeCreated) < nexmo.RecClaimTTL {
+		return false, nil
+	}
+
+	resp, err = g.do(ctx, "DELETE", g.objectURL(object)+"?ifGenerationMatch="+url.QueryEscape(obj.Generation), nil, "")
+	switch err {
+	case nil:
+		resp.Body.Close()
+		return true, nil
+	case errGCSNotFound, errGCSPrecondition:
+		return true, nil
+	default:
+		return false, fmt.Errorf("gcs storage error: unable to expire claim: %v", err)
+	}
+}
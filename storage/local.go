@@ -17,56 +17,317 @@
 package storage
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
 )
 
-const (
-	BroadcastListFile = "contacts.csv"
-	WhitelistFile     = "whitelist.csv"
+var (
+	_ nexmo.Storage         = &Local{}
+	_ nexmo.EventLog        = &Local{}
+	_ nexmo.TranscriptStore = &Local{}
+	_ nexmo.RecClaimer      = &Local{}
+	_ nexmo.RecRangeReader  = &Local{}
+	_ nexmo.SuppressionList = &Local{}
+	_ nexmo.TemplateStore   = &Local{}
+	_ nexmo.ContactsWriter  = &Local{}
+	_ nexmo.RecUsage        = &Local{}
+	_ nexmo.SubjectStore    = &Local{}
 )
 
+// EventsFile is the file, in RootDir, containing the voice
+// events, one JSON object per line.
+const EventsFile = "events.jsonl"
+
+// SuppressionsFile is the file, in RootDir, containing the
+// suppression list, as a JSON array.
+const SuppressionsFile = "suppressions.json"
+
+// TemplatesFile is the file, in RootDir, containing the
+// templates, as a JSON array.
+const TemplatesFile = "templates.json"
+
 // Local is a local storage implementation, capable
 // of writing data into local files.
 type Local struct {
 	// RootDir is the base directory path
 	// where all the data is stored.
 	RootDir string
+	Log     *log.Logger
+
+	recsMu         sync.Mutex
+	recLocks       map[string]*recLock
+	contactsMu     sync.Mutex
+	eventsMu       sync.Mutex
+	suppressionsMu sync.Mutex
+	templatesMu    sync.Mutex
 }
 
-// WriteRec creates a file in `RootDir`/recs/`filename` and copies
-// the contents of `src` into it.
-func (l *Local) WriteRec(src io.Reader, fileName string) (string, error) {
-	path := filepath.Join(l.RootDir, "recs")
+// WriteRec stores the contents of `src` in `RootDir`/recs/`name`.
+// The recording is written to a temporary file first, and then
+// renamed, so that a partial recording is never served. Writes
+// to the same recording are serialized, the last one winning.
+func (l *Local) WriteRec(ctx context.Context, src io.Reader, name string, meta nexmo.RecMeta) (nexmo.RecMeta, error) {
+	name = filepath.Base(name)
+	path := l.recsDir()
 	if err := ensureDirPresent(path); err != nil {
-		return "", fmt.Errorf("local storage error: %v", err)
+		return meta, fmt.Errorf("local storage error: %v", err)
 	}
+	unlock := l.lockRec(name)
+	defer unlock()
 
-	path = filepath.Join(path, fileName)
-	dest, err := os.Create(path)
+	path = filepath.Join(path, name)
+	logger(l.Log).Printf("local storage: saving recording %s", path)
+	n, err := writeAtomic(path, src)
 	if err != nil {
-		return "", fmt.Errorf("local storage error: unable to create destination: %v", err)
+		return meta, fmt.Errorf("local storage error: unable to write rec: %v", err)
+	}
+
+	meta.Name = name
+	meta.Size = n
+	if meta.ContentType == "" {
+		meta.ContentType = nexmo.ContentType(name)
+	}
+	if err = l.writeRecExtra(name, meta); err != nil {
+		return meta, fmt.Errorf("local storage error: %v", err)
+	}
+	return meta, nil
+}
+
+// recLock serializes the writes of a recording.
+type recLock struct {
+	sync.Mutex
+	waiters int
+}
+
+// lockRec locks the recording `name`, returning its unlock
+// function.
+func (l *Local) lockRec(name string) func() {
+	l.recsMu.Lock()
+	if l.recLocks == nil {
+		l.recLocks = make(map[string]*recLock)
+	}
+	lock, ok := l.recLocks[name]
+	if !ok {
+		lock = &recLock{}
+		l.recLocks[name] = lock
+	}
+	lock.waiters++
+	l.recsMu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		l.recsMu.Lock()
+		if lock.waiters--; lock.waiters == 0 {
+			delete(l.recLocks, name)
+		}
+		l.recsMu.Unlock()
+	}
+}
+
+// OpenRec opens the recording `name` for reading.
+func (l *Local) OpenRec(ctx context.Context, name string) (io.ReadCloser, nexmo.RecMeta, error) {
+	path := filepath.Join(l.recsDir(), filepath.Base(name))
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nexmo.RecMeta{}, nexmo.ErrRecNotFound
+	}
+	if err != nil {
+		return nil, nexmo.RecMeta{}, fmt.Errorf("local storage error: unable to open rec: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nexmo.RecMeta{}, fmt.Errorf("local storage error: unable to stat rec: %v", err)
+	}
+	return file, l.recMeta(info), nil
+}
+
+// ListRecs returns the metadata of every recording stored
+// in `RootDir`/recs.
+func (l *Local) ListRecs(ctx context.Context) ([]nexmo.RecMeta, error) {
+	infos, err := ioutil.ReadDir(l.recsDir())
+	if os.IsNotExist(err) {
+		return []nexmo.RecMeta{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("local storage error: unable to list recs: %v", err)
+	}
+
+	acc := make([]nexmo.RecMeta, 0, len(infos))
+	for _, v := range infos {
+		// Skip .meta and the recordings being written.
+		if v.IsDir() || strings.HasPrefix(v.Name(), ".") {
+			continue
+		}
+		acc = append(acc, l.recMeta(v))
+	}
+	return acc, nil
+}
+
+// DeleteRec removes the recording `name`.
+func (l *Local) DeleteRec(ctx context.Context, name string) error {
+	name = filepath.Base(name)
+	unlock := l.lockRec(name)
+	defer unlock()
+	path := filepath.Join(l.recsDir(), name)
+	err := os.Remove(path)
+	if os.IsNotExist(err) {
+		return nexmo.ErrRecNotFound
+	}
+	os.Remove(l.recExtraPath(name))
+	os.Remove(l.transcriptPath(name))
+	if err != nil {
+		return fmt.Errorf("local storage error: unable to delete rec: %v", err)
+	}
+	logger(l.Log).Printf("local storage: deleted recording %s", path)
+	return nil
+}
+
+func (l *Local) recsDir() string {
+	return filepath.Join(l.RootDir, "recs")
+}
+
+// recExtra is the metadata that cannot be derived from the
+// recording file, stored next to it in `RootDir`/recs/.meta.
+type recExtra struct {
+	Channels   []string      `json:"channels,omitempty"`
+	Caller     string        `json:"caller,omitempty"`
+	Duration   time.Duration `json:"duration,omitempty"`
+	Broadcasts []int64       `json:"broadcasts,omitempty"`
+}
+
+func (l *Local) recExtraPath(name string) string {
+	return filepath.Join(l.recsDir(), ".meta", filepath.Base(name)+".json")
+}
+
+func (l *Local) writeRecExtra(name string, meta nexmo.RecMeta) error {
+	extra := recExtra{
+		Channels:   meta.Channels,
+		Caller:     meta.Caller,
+		Duration:   meta.Duration,
+		Broadcasts: meta.Broadcasts,
+	}
+	path := l.recExtraPath(name)
+	if extra.Channels == nil && extra.Caller == "" && extra.Duration == 0 && extra.Broadcasts == nil {
+		// Rewriting a recording drops the metadata of
+		// the previous one.
+		os.Remove(path)
+		return nil
+	}
+	if err := ensureDirPresent(filepath.Dir(path)); err != nil {
+		return err
+	}
+	b, err := json.Marshal(extra)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b)
+}
+
+func (l *Local) recMeta(info os.FileInfo) nexmo.RecMeta {
+	meta := nexmo.RecMeta{
+		Name:        info.Name(),
+		ContentType: nexmo.ContentType(info.Name()),
+		Size:        info.Size(),
+		CreatedAt:   info.ModTime(),
+	}
+	if b, err := ioutil.ReadFile(l.recExtraPath(info.Name())); err == nil {
+		var extra recExtra
+		if err = json.Unmarshal(b, &extra); err != nil {
+			logger(l.Log).Printf("local storage: invalid metadata of %s: %v", info.Name(), err)
+		}
+		meta.Channels = extra.Channels
+		meta.Caller = extra.Caller
+		meta.Duration = extra.Duration
+		meta.Broadcasts = extra.Broadcasts
 	}
+	return meta
+}
 
-	log.Printf("local storage: saving recording %s", path)
-	if _, err = io.Copy(dest, src); err != nil {
-		return "", fmt.Errorf("local storage error: unable to copy rec to destination: %v", err)
+// UsedRec adds broadcast `id` to the metadata of `name`.
+func (l *Local) UsedRec(ctx context.Context, name string, id int64) error {
+	name = filepath.Base(name)
+	unlock := l.lockRec(name)
+	defer unlock()
+	info, err := os.Stat(filepath.Join(l.recsDir(), name))
+	if os.IsNotExist(err) {
+		return nexmo.ErrRecNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("local storage error: unable to stat rec: %v", err)
+	}
+	meta := l.recMeta(info)
+	for _, v := range meta.Broadcasts {
+		if v == id {
+			return nil
+		}
 	}
+	meta.Broadcasts = append(meta.Broadcasts, id)
+	if err = l.writeRecExtra(name, meta); err != nil {
+		return fmt.Errorf("local storage error: %v", err)
+	}
+	return nil
+}
 
-	return path, nil
+// logger returns `l`, or the standard logger if nil.
+func logger(l *log.Logger) *log.Logger {
+	if l == nil {
+		return log.Default()
+	}
+	return l
 }
 
 func ensureDirPresent(dir string) error {
 	return os.MkdirAll(dir, os.ModePerm)
 }
 
+// StatRec returns the metadata of the recording `name`.
+func (l *Local) StatRec(ctx context.Context, name string) (nexmo.RecMeta, error) {
+	info, err := os.Stat(filepath.Join(l.recsDir(), filepath.Base(name)))
+	if os.IsNotExist(err) {
+		return nexmo.RecMeta{}, nexmo.ErrRecNotFound
+	}
+	if err != nil {
+		return nexmo.RecMeta{}, fmt.Errorf("local storage error: unable to stat rec: %v", err)
+	}
+	return l.recMeta(info), nil
+}
+
+// OpenRecRange returns a reader over `length` bytes of the
+// recording `name`, starting at `offset`.
+func (l *Local) OpenRecRange(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	file, err := os.Open(filepath.Join(l.recsDir(), filepath.Base(name)))
+	if os.IsNotExist(err) {
+		return nil, nexmo.ErrRecNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("local storage error: unable to open rec: %v", err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(file, offset, length), file}, nil
+}
+
+// RecFileHandler serves the recordings from disk, with byte
+// range support.
 func (l *Local) RecFileHandler() http.Handler {
-	path := filepath.Join(l.RootDir, "recs")
-	return http.FileServer(http.Dir(path))
+	return nexmo.RecHandler(l, l.Log)
 }
 
 func (l *Local) ReadContacts(dest io.Writer, fileName string) error {
@@ -77,7 +338,7 @@ func (l *Local) ReadContacts(dest io.Writer, fileName string) error {
 	}
 	defer file.Close()
 
-	log.Printf("local storage: reading contacts from %s", path)
+	logger(l.Log).Printf("local storage: reading contacts from %s", path)
 	if _, err = io.Copy(dest, file); err != nil {
 		return fmt.Errorf("local storage error: unable to copy contacts to destination: %v", err)
 	}
@@ -92,9 +353,415 @@ func (l *Local) ReadWhitelist(dest io.Writer) error {
 	return l.ReadContacts(dest, WhitelistFile)
 }
 
+// ListContacts decodes and returns the contacts stored in `list`.
+func (l *Local) ListContacts(ctx context.Context, list nexmo.ContactList) ([]nexmo.Contact, error) {
+	fileName, err := contactsFile(list)
+	if err != nil {
+		return nil, err
+	}
+	return nexmo.DecodeContacts(func(w io.Writer) error {
+		return l.ReadContacts(w, fileName)
+	}, l.Log)
+}
+
+// AddContact appends `c` to `list`, replacing the contact with
+// the same number if present.
+func (l *Local) AddContact(ctx context.Context, list nexmo.ContactList, c nexmo.Contact) error {
+	return l.AppendContacts(ctx, list, []nexmo.Contact{c})
+}
+
+// AppendContacts adds `contacts` to `list`, replacing the ones
+// with the same numbers, with a single write.
+func (l *Local) AppendContacts(ctx context.Context, list nexmo.ContactList, contacts []nexmo.Contact) error {
+	l.contactsMu.Lock()
+	defer l.contactsMu.Unlock()
+	acc, err := l.ListContacts(ctx, list)
+	if err != nil && err != nexmo.ErrCorruptedContacts {
+		return err
+	}
+	for _, v := range contacts {
+		acc = putContact(acc, v)
+	}
+	return l.writeContacts(list, acc)
+}
+
+// WriteContacts replaces the contents of `list` with `contacts`.
+func (l *Local) WriteContacts(ctx context.Context, list nexmo.ContactList, contacts []nexmo.Contact) error {
+	l.contactsMu.Lock()
+	defer l.contactsMu.Unlock()
+	acc := []nexmo.Contact{}
+	for _, v := range contacts {
+		acc = putContact(acc, v)
+	}
+	return l.writeContacts(list, acc)
+}
+
+// RemoveContact removes the contact identified by `number` from `list`.
+func (l *Local) RemoveContact(ctx context.Context, list nexmo.ContactList, number string) error {
+	l.contactsMu.Lock()
+	defer l.contactsMu.Unlock()
+	contacts, err := l.ListContacts(ctx, list)
+	if err != nil && err != nexmo.ErrCorruptedContacts {
+		return err
+	}
+
+	acc, ok := dropContact(contacts, number)
+	if !ok {
+		return nexmo.ErrContactNotFound
+	}
+	return l.writeContacts(list, acc)
+}
+
+// writeContacts replaces the file of `list` atomically, so that
+// a crash while writing does not leave it truncated.
+func (l *Local) writeContacts(list nexmo.ContactList, contacts []nexmo.Contact) error {
+	fileName, err := contactsFile(list)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err = nexmo.EncodeContacts(&buf, contacts); err != nil {
+		return fmt.Errorf("local storage error: %v", err)
+	}
+	path := filepath.Join(l.RootDir, fileName)
+	logger(l.Log).Printf("local storage: writing %d contacts to %s", len(contacts), path)
+	if err = writeFileAtomic(path, buf.Bytes()); err != nil {
+		return fmt.Errorf("local storage error: unable to write contacts file: %v", err)
+	}
+	return nil
+}
+
 func openOrCreate(file string) (*os.File, error) {
 	if _, err := os.Stat(file); os.IsNotExist(err) {
 		return os.Create(file)
 	}
 	return os.Open(file)
 }
+
+// LogEvent appends `e` to `RootDir`/EventsFile.
+func (l *Local) LogEvent(ctx context.Context, e nexmo.CallEvent) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("local storage error: unable to encode event: %v", err)
+	}
+
+	l.eventsMu.Lock()
+	defer l.eventsMu.Unlock()
+	file, err := os.OpenFile(filepath.Join(l.RootDir, EventsFile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("local storage error: unable to open events: %v", err)
+	}
+	defer file.Close()
+	if _, err = file.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("local storage error: unable to write event: %v", err)
+	}
+	return nil
+}
+
+// Events scans `RootDir`/EventsFile, returning the events of
+// `conversationUUID`, or all of them if empty.
+func (l *Local) Events(ctx context.Context, conversationUUID string) ([]nexmo.CallEvent, error) {
+	l.eventsMu.Lock()
+	defer l.eventsMu.Unlock()
+	return l.readEvents(conversationUUID)
+}
+
+// readEvents is Events, to be called with eventsMu held.
+func (l *Local) readEvents(conversationUUID string) ([]nexmo.CallEvent, error) {
+	acc := []nexmo.CallEvent{}
+	file, err := os.Open(filepath.Join(l.RootDir, EventsFile))
+	if os.IsNotExist(err) {
+		return acc, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("local storage error: unable to open events: %v", err)
+	}
+	defer file.Close()
+
+	dec := json.NewDecoder(file)
+	for {
+		var e nexmo.CallEvent
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("local storage error: unable to decode event: %v", err)
+		}
+		if conversationUUID == "" || e.ConversationUUID == conversationUUID {
+			acc = append(acc, e)
+		}
+	}
+	return acc, nil
+}
+
+// CompletedCalls scans `RootDir`/EventsFile, returning the
+// completed events received between `since` and `until`.
+func (l *Local) CompletedCalls(ctx context.Context, since, until time.Time) ([]nexmo.CallEvent, error) {
+	events, err := l.Events(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	acc := []nexmo.CallEvent{}
+	for _, e := range events {
+		if e.Status == "completed" && !e.Timestamp.Before(since) && e.Timestamp.Before(until) {
+			acc = append(acc, e)
+		}
+	}
+	return acc, nil
+}
+
+// SubjectRecords returns the events of `number`, the only
+// records tied to it Local keeps apart from its contacts.
+func (l *Local) SubjectRecords(ctx context.Context, number string) (nexmo.SubjectRecords, error) {
+	events, err := l.Events(ctx, "")
+	if err != nil {
+		return nexmo.SubjectRecords{}, err
+	}
+	rec := nexmo.SubjectRecords{
+		Groups:     []string{},
+		Broadcasts: []int64{},
+		Attempts:   []nexmo.CallAttempt{},
+		Failures:   []nexmo.CallFailure{},
+		Events:     []nexmo.CallEvent{},
+	}
+	for _, e := range events {
+		if e.From == number || e.To == number {
+			rec.Events = append(rec.Events, e)
+		}
+	}
+	return rec, nil
+}
+
+// EraseSubjectRecords rewrites `RootDir`/EventsFile without
+// the events of `number`.
+func (l *Local) EraseSubjectRecords(ctx context.Context, number string) error {
+	l.eventsMu.Lock()
+	defer l.eventsMu.Unlock()
+	events, err := l.readEvents("")
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range events {
+		if e.From == number || e.To == number {
+			continue
+		}
+		if err = enc.Encode(e); err != nil {
+			return fmt.Errorf("local storage error: unable to encode event: %v", err)
+		}
+	}
+	if err = writeFileAtomic(filepath.Join(l.RootDir, EventsFile), buf.Bytes()); err != nil {
+		return fmt.Errorf("local storage error: unable to write events: %v", err)
+	}
+	return nil
+}
+
+func (l *Local) transcriptPath(recName string) string {
+	return filepath.Join(l.recsDir(), ".transcripts", filepath.Base(recName)+".json")
+}
+
+// WriteTranscript stores `t` in `RootDir`/recs/.transcripts.
+func (l *Local) WriteTranscript(ctx context.Context, t nexmo.Transcript) error {
+	path := l.transcriptPath(t.RecName)
+	if err := ensureDirPresent(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("local storage error: %v", err)
+	}
+	b, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("local storage error: unable to encode transcript: %v", err)
+	}
+	if err = writeFileAtomic(path, b); err != nil {
+		return fmt.Errorf("local storage error: unable to write transcript: %v", err)
+	}
+	return nil
+}
+
+func (l *Local) Transcript(ctx context.Context, recName string) (nexmo.Transcript, error) {
+	var t nexmo.Transcript
+	b, err := ioutil.ReadFile(l.transcriptPath(recName))
+	if os.IsNotExist(err) {
+		return t, nexmo.ErrTranscriptNotFound
+	}
+	if err != nil {
+		return t, fmt.Errorf("local storage error: unable to read transcript: %v", err)
+	}
+	if err = json.Unmarshal(b, &t); err != nil {
+		return t, fmt.Errorf("local storage error: unable to decode transcript: %v", err)
+	}
+	return t, nil
+}
+
+// ClaimRec creates an empty file in `RootDir`/claims/`uuid`,
+// failing if it already exists. The claims older than
+// nexmo.RecClaimTTL are removed first, so that a crash does
+// not leave a recording claimed forever.
+func (l *Local) ClaimRec(ctx context.Context, uuid string) (bool, error) {
+	dir := filepath.Join(l.RootDir, "claims")
+	if err := ensureDirPresent(dir); err != nil {
+		return false, fmt.Errorf("local storage error: %v", err)
+	}
+	l.expireClaims(dir)
+	f, err := os.OpenFile(filepath.Join(dir, filepath.Base(uuid)), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if os.IsExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("local storage error: unable to claim recording: %v", err)
+	}
+	return true, f.Close()
+}
+
+// expireClaims removes the claims in `dir` older than
+// nexmo.RecClaimTTL.
+func (l *Local) expireClaims(dir string) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		logger(l.Log).Printf("local storage: unable to list claims: %v", err)
+		return
+	}
+	for _, v := range infos {
+		if time.Since(v.ModTime()) > nexmo.RecClaimTTL {
+			os.Remove(filepath.Join(dir, v.Name()))
+		}
+	}
+}
+
+func (l *Local) readSuppressions() ([]nexmo.Suppression, error) {
+	acc := []nexmo.Suppression{}
+	b, err := ioutil.ReadFile(filepath.Join(l.RootDir, SuppressionsFile))
+	if os.IsNotExist(err) {
+		return acc, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("local storage error: unable to read suppressions: %v", err)
+	}
+	if err = json.Unmarshal(b, &acc); err != nil {
+		return nil, fmt.Errorf("local storage error: unable to decode suppressions: %v", err)
+	}
+	return acc, nil
+}
+
+func (l *Local) writeSuppressions(list []nexmo.Suppression) error {
+	b, err := json.MarshalIndent(list, "", "\t")
+	if err != nil {
+		return fmt.Errorf("local storage error: unable to encode suppressions: %v", err)
+	}
+	if err = writeFileAtomic(filepath.Join(l.RootDir, SuppressionsFile), b); err != nil {
+		return fmt.Errorf("local storage error: unable to write suppressions: %v", err)
+	}
+	return nil
+}
+
+// Suppress adds `s` to `RootDir`/SuppressionsFile.
+func (l *Local) Suppress(ctx context.Context, s nexmo.Suppression) error {
+	l.suppressionsMu.Lock()
+	defer l.suppressionsMu.Unlock()
+	list, err := l.readSuppressions()
+	if err != nil {
+		return err
+	}
+	acc := []nexmo.Suppression{}
+	for _, v := range list {
+		if v.Number != s.Number {
+			acc = append(acc, v)
+		}
+	}
+	return l.writeSuppressions(append(acc, s))
+}
+
+func (l *Local) Unsuppress(ctx context.Context, number string) error {
+	l.suppressionsMu.Lock()
+	defer l.suppressionsMu.Unlock()
+	list, err := l.readSuppressions()
+	if err != nil {
+		return err
+	}
+	acc := []nexmo.Suppression{}
+	for _, v := range list {
+		if v.Number != number {
+			acc = append(acc, v)
+		}
+	}
+	if len(acc) == len(list) {
+		return nexmo.ErrContactNotFound
+	}
+	return l.writeSuppressions(acc)
+}
+
+func (l *Local) Suppressions(ctx context.Context) ([]nexmo.Suppression, error) {
+	l.suppressionsMu.Lock()
+	defer l.suppressionsMu.Unlock()
+	return l.readSuppressions()
+}
+
+func (l *Local) readTemplates() ([]nexmo.Template, error) {
+	acc := []nexmo.Template{}
+	b, err := ioutil.ReadFile(filepath.Join(l.RootDir, TemplatesFile))
+	if os.IsNotExist(err) {
+		return acc, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("local storage error: unable to read templates: %v", err)
+	}
+	if err = json.Unmarshal(b, &acc); err != nil {
+		return nil, fmt.Errorf("local storage error: unable to decode templates: %v", err)
+	}
+	return acc, nil
+}
+
+func (l *Local) writeTemplates(list []nexmo.Template) error {
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	b, err := json.MarshalIndent(list, "", "\t")
+	if err != nil {
+		return fmt.Errorf("local storage error: unable to encode templates: %v", err)
+	}
+	if err = writeFileAtomic(filepath.Join(l.RootDir, TemplatesFile), b); err != nil {
+		return fmt.Errorf("local storage error: unable to write templates: %v", err)
+	}
+	return nil
+}
+
+// SaveTemplate stores `t` in `RootDir`/TemplatesFile.
+func (l *Local) SaveTemplate(ctx context.Context, t nexmo.Template) error {
+	l.templatesMu.Lock()
+	defer l.templatesMu.Unlock()
+	list, err := l.readTemplates()
+	if err != nil {
+		return err
+	}
+	acc := []nexmo.Template{}
+	for _, v := range list {
+		if v.Name != t.Name {
+			acc = append(acc, v)
+		}
+	}
+	return l.writeTemplates(append(acc, t))
+}
+
+func (l *Local) Templates(ctx context.Context) ([]nexmo.Template, error) {
+	l.templatesMu.Lock()
+	defer l.templatesMu.Unlock()
+	return l.readTemplates()
+}
+
+func (l *Local) DeleteTemplate(ctx context.Context, name string) error {
+	l.templatesMu.Lock()
+	defer l.templatesMu.Unlock()
+	list, err := l.readTemplates()
+	if err != nil {
+		return err
+	}
+	acc := []nexmo.Template{}
+	for _, v := range list {
+		if v.Name != name {
+			acc = append(acc, v)
+		}
+	}
+	if len(acc) == len(list) {
+		return nexmo.ErrTemplateNotFound
+	}
+	return l.writeTemplates(acc)
+}
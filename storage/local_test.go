@@ -0,0 +1,408 @@
+package storage_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func newLocal(t *testing.T) (*storage.Local, func()) {
+	dir, err := ioutil.TempDir("", "voicebr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &storage.Local{RootDir: dir}, func() { os.RemoveAll(dir) }
+}
+
+func TestLocal_recs(t *testing.T) {
+	l, done := newLocal(t)
+	defer done()
+
+	ctx := context.TODO()
+	meta, err := l.WriteRec(ctx, strings.NewReader("hello"), "a.mp3", nexmo.RecMeta{})
+	if err != nil {
+		t.Fatalf("Unexpected write error: %v", err)
+	}
+	if meta.Size != 5 {
+		t.Fatalf("Wanted size 5, found %d", meta.Size)
+	}
+	if meta.ContentType != "audio/mpeg" {
+		t.Fatalf("Wanted content type audio/mpeg, found %s", meta.ContentType)
+	}
+
+	recs, err := l.ListRecs(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected list error: %v", err)
+	}
+	if len(recs) != 1 || recs[0].Name != "a.mp3" {
+		t.Fatalf("Unexpected recs: %v", recs)
+	}
+
+	r, _, err := l.OpenRec(ctx, "a.mp3")
+	if err != nil {
+		t.Fatalf("Unexpected open error: %v", err)
+	}
+	b, _ := ioutil.ReadAll(r)
+	r.Close()
+	if string(b) != "hello" {
+		t.Fatalf("Unexpected rec content: %s", b)
+	}
+
+	if err = l.DeleteRec(ctx, "a.mp3"); err != nil {
+		t.Fatalf("Unexpected delete error: %v", err)
+	}
+	if _, _, err = l.OpenRec(ctx, "a.mp3"); err != nexmo.ErrRecNotFound {
+		t.Fatalf("Wanted ErrRecNotFound, found %v", err)
+	}
+}
+
+func TestLocal_recMeta(t *testing.T) {
+	l, done := newLocal(t)
+	defer done()
+
+	ctx := context.TODO()
+	if _, err := l.WriteRec(ctx, strings.NewReader("hello"), "a.mp3", nexmo.RecMeta{Caller: "39111", Duration: 5 * time.Second}); err != nil {
+		t.Fatalf("Unexpected write error: %v", err)
+	}
+	for _, id := range []int64{1, 2, 1} {
+		if err := l.UsedRec(ctx, "a.mp3", id); err != nil {
+			t.Fatalf("Unexpected usage error: %v", err)
+		}
+	}
+	if err := l.UsedRec(ctx, "b.mp3", 1); err != nexmo.ErrRecNotFound {
+		t.Fatalf("Wanted ErrRecNotFound, found %v", err)
+	}
+
+	recs, err := l.ListRecs(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected list error: %v", err)
+	}
+	if len(recs) != 1 || recs[0].Caller != "39111" || recs[0].Duration != 5*time.Second || len(recs[0].Broadcasts) != 2 {
+		t.Fatalf("Unexpected recs: %+v", recs)
+	}
+
+	// Replacing the recording replaces its metadata.
+	if _, err = l.WriteRec(ctx, strings.NewReader("again"), "a.mp3", nexmo.RecMeta{}); err != nil {
+		t.Fatalf("Unexpected write error: %v", err)
+	}
+	if meta, _ := l.StatRec(ctx, "a.mp3"); meta.Caller != "" || meta.Broadcasts != nil {
+		t.Fatalf("Wanted the old metadata to be dropped, found %+v", meta)
+	}
+}
+
+func TestLocal_writeRecAtomic(t *testing.T) {
+	l, done := newLocal(t)
+	defer done()
+
+	ctx := context.TODO()
+	// Every version of the recording read while writing must
+	// be a complete one.
+	stop := make(chan struct{})
+	torn := make(chan string, 1)
+	go func() {
+		defer close(torn)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			r, _, err := l.OpenRec(ctx, "a.mp3")
+			if err != nil {
+				continue
+			}
+			b, _ := ioutil.ReadAll(r)
+			r.Close()
+			if s := string(b); s != "partial first" && s != "second" {
+				torn <- s
+				return
+			}
+		}
+	}()
+
+	pr, pw := io.Pipe()
+	first := make(chan error, 1)
+	go func() {
+		_, err := l.WriteRec(ctx, pr, "a.mp3", nexmo.RecMeta{})
+		first <- err
+	}()
+	// The first writer is blocked reading, mid-write.
+	pw.Write([]byte("partial"))
+	if _, _, err := l.OpenRec(ctx, "a.mp3"); err != nexmo.ErrRecNotFound {
+		t.Fatalf("Wanted the partial recording to be hidden, found %v", err)
+	}
+	if recs, _ := l.ListRecs(ctx); len(recs) != 0 {
+		t.Fatalf("Wanted no recordings while writing, found %v", recs)
+	}
+
+	second := make(chan error, 1)
+	go func() {
+		_, err := l.WriteRec(ctx, strings.NewReader("second"), "a.mp3", nexmo.RecMeta{})
+		second <- err
+	}()
+	select {
+	case err := <-second:
+		t.Fatalf("Wanted the second writer to wait for the first, found it done (%v)", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	pw.Write([]byte(" first"))
+	pw.Close()
+	if err := <-first; err != nil {
+		t.Fatalf("Unexpected write error: %v", err)
+	}
+	if err := <-second; err != nil {
+		t.Fatalf("Unexpected write error: %v", err)
+	}
+	close(stop)
+	if s, ok := <-torn; ok {
+		t.Fatalf("Wanted only complete recordings, read %q", s)
+	}
+
+	r, _, err := l.OpenRec(ctx, "a.mp3")
+	if err != nil {
+		t.Fatalf("Unexpected open error: %v", err)
+	}
+	b, _ := ioutil.ReadAll(r)
+	r.Close()
+	if s := string(b); s != "second" {
+		t.Fatalf("Wanted the last writer to win, found %q", b)
+	}
+	if recs, _ := l.ListRecs(ctx); len(recs) != 1 {
+		t.Fatalf("Wanted one recording, found %v", recs)
+	}
+}
+
+func TestLocal_contacts(t *testing.T) {
+	l, done := newLocal(t)
+	defer done()
+
+	ctx := context.TODO()
+	if err := l.AddContact(ctx, nexmo.Whitelist, nexmo.NewContact("39111", "foo")); err != nil {
+		t.Fatalf("Unexpected add error: %v", err)
+	}
+	if err := l.AddContact(ctx, nexmo.Whitelist, nexmo.NewContact("39222", "bar")); err != nil {
+		t.Fatalf("Unexpected add error: %v", err)
+	}
+	if err := l.AddContact(ctx, nexmo.Whitelist, nexmo.NewContact("39111", "baz")); err != nil {
+		t.Fatalf("Unexpected add error: %v", err)
+	}
+
+	contacts, err := l.ListContacts(ctx, nexmo.Whitelist)
+	if err != nil {
+		t.Fatalf("Unexpected list error: %v", err)
+	}
+	if len(contacts) != 2 || contacts[0].Name != "baz" {
+		t.Fatalf("Unexpected contacts: %v", contacts)
+	}
+
+	if err = l.RemoveContact(ctx, nexmo.Whitelist, "39222"); err != nil {
+		t.Fatalf("Unexpected remove error: %v", err)
+	}
+	if err = l.RemoveContact(ctx, nexmo.Whitelist, "39222"); err != nexmo.ErrContactNotFound {
+		t.Fatalf("Wanted ErrContactNotFound, found %v", err)
+	}
+	if contacts, _ = l.ListContacts(ctx, nexmo.BroadcastList); len(contacts) != 0 {
+		t.Fatalf("Broadcast list should be empty, found %v", contacts)
+	}
+}
+
+func TestLocal_writeContacts(t *testing.T) {
+	l, done := newLocal(t)
+	defer done()
+
+	ctx := context.TODO()
+	if err := l.AppendContacts(ctx, nexmo.BroadcastList, []nexmo.Contact{nexmo.NewContact("39111", "foo"), nexmo.NewContact("39222", "bar")}); err != nil {
+		t.Fatalf("Unexpected append error: %v", err)
+	}
+	if err := l.AppendContacts(ctx, nexmo.Whitelist, []nexmo.Contact{nexmo.NewContact("39333", "admin")}); err != nil {
+		t.Fatalf("Unexpected append error: %v", err)
+	}
+	if err := l.WriteContacts(ctx, nexmo.BroadcastList, []nexmo.Contact{nexmo.NewContact("39222", "baz"), nexmo.NewContact("39444", "qux")}); err != nil {
+		t.Fatalf("Unexpected write error: %v", err)
+	}
+
+	contacts, err := l.ListContacts(ctx, nexmo.BroadcastList)
+	if err != nil {
+		t.Fatalf("Unexpected list error: %v", err)
+	}
+	if len(contacts) != 2 || contacts[0].Name != "baz" || contacts[1].Number != "39444" {
+		t.Fatalf("Unexpected contacts: %v", contacts)
+	}
+	if contacts, _ = l.ListContacts(ctx, nexmo.Whitelist); len(contacts) != 1 {
+		t.Fatalf("Wanted the whitelist to be left alone, found %v", contacts)
+	}
+	files, _ := ioutil.ReadDir(l.RootDir)
+	for _, v := range files {
+		if strings.Contains(v.Name(), ".tmp") {
+			t.Fatalf("Wanted no temporary file left, found %s", v.Name())
+		}
+	}
+}
+
+func TestLocal_events(t *testing.T) {
+	l, done := newLocal(t)
+	defer done()
+
+	ctx := context.TODO()
+	for _, v := range []string{
+		`{"conversation_uuid": "CON-1", "uuid": "a", "status": "started", "timestamp": "2019-03-01T10:00:00.000Z"}`,
+		`{"conversation_uuid": "CON-2", "uuid": "b", "status": "started", "timestamp": "2019-03-01T10:00:01.000Z"}`,
+		`{"conversation_uuid": "CON-1", "uuid": "a", "status": "completed", "duration": "42", "rate": "0.01200000", "price": "0.00840000", "timestamp": "2019-03-01T10:00:43.000Z"}`,
+	} {
+		e, err := nexmo.DecodeCallEvent([]byte(v))
+		if err != nil {
+			t.Fatalf("Unexpected decode error: %v", err)
+		}
+		if err = l.LogEvent(ctx, e); err != nil {
+			t.Fatalf("Unexpected log error: %v", err)
+		}
+	}
+
+	events, err := l.Events(ctx, "CON-1")
+	if err != nil {
+		t.Fatalf("Unexpected events error: %v", err)
+	}
+	if len(events) != 2 || events[1].Status != "completed" || events[1].Duration != 42*time.Second {
+		t.Fatalf("Unexpected events: %+v", events)
+	}
+	if events, _ = l.Events(ctx, ""); len(events) != 3 {
+		t.Fatalf("Wanted 3 events, found %d", len(events))
+	}
+
+	march := time.Date(2019, time.March, 1, 0, 0, 0, 0, time.UTC)
+	events, err = l.CompletedCalls(ctx, march, march.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("Unexpected completed calls error: %v", err)
+	}
+	if len(events) != 1 || events[0].Price != 0.0084 || events[0].Rate != 0.012 {
+		t.Fatalf("Unexpected completed calls: %+v", events)
+	}
+}
+
+func TestLocal_recChannels(t *testing.T) {
+	l, done := newLocal(t)
+	defer done()
+
+	ctx := context.TODO()
+	meta := nexmo.RecMeta{Channels: []string{"caller", "callee"}}
+	if _, err := l.WriteRec(ctx, strings.NewReader("stereo"), "a.wav", meta); err != nil {
+		t.Fatalf("Unexpected write error: %v", err)
+	}
+
+	recs, err := l.ListRecs(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected list error: %v", err)
+	}
+	if len(recs) != 1 || len(recs[0].Channels) != 2 || recs[0].Channels[1] != "callee" {
+		t.Fatalf("Unexpected recs: %+v", recs)
+	}
+}
+
+type fakeTranscriber struct{}
+
+func (fakeTranscriber) Transcribe(ctx context.Context, audio []byte, format string) (nexmo.Transcript, error) {
+	return nexmo.Transcript{Text: format + ": " + string(audio), Engine: "fake"}, nil
+}
+
+func TestLocal_transcripts(t *testing.T) {
+	l, done := newLocal(t)
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := l.WriteRec(ctx, strings.NewReader("ciao"), "a.mp3", nexmo.RecMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Transcript(ctx, "a.mp3"); err != nexmo.ErrTranscriptNotFound {
+		t.Fatalf("Wanted ErrTranscriptNotFound, found %v", err)
+	}
+
+	w := nexmo.NewTranscriptWorker(fakeTranscriber{}, l, l, 1)
+	go w.Run(ctx)
+	if !w.Enqueue("a.mp3") {
+		t.Fatalf("Recording was not enqueued")
+	}
+
+	var tr nexmo.Transcript
+	var err error
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if tr, err = l.Transcript(ctx, "a.mp3"); err != nexmo.ErrTranscriptNotFound {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Unexpected transcript error: %v", err)
+	}
+	if tr.Text != "mp3: ciao" || tr.RecName != "a.mp3" {
+		t.Fatalf("Unexpected transcript: %+v", tr)
+	}
+
+	recs, err := l.ListRecs(ctx)
+	if err != nil || len(recs) != 1 {
+		t.Fatalf("Wanted the transcripts not to be listed as recordings, found %v", recs)
+	}
+}
+
+func TestLocal_recFileHandler(t *testing.T) {
+	l, done := newLocal(t)
+	defer done()
+	if _, err := l.WriteRec(context.TODO(), strings.NewReader("0123456789"), "a.mp3", nexmo.RecMeta{}); err != nil {
+		t.Fatalf("Unexpected write error: %v", err)
+	}
+	h := l.RecFileHandler()
+
+	tt := []struct {
+		rng          string
+		status       int
+		body         string
+		contentRange string
+	}{
+		{"", http.StatusOK, "0123456789", ""},
+		{"bytes=2-4", http.StatusPartialContent, "234", "bytes 2-4/10"},
+		{"bytes=7-", http.StatusPartialContent, "789", "bytes 7-9/10"},
+		{"bytes=-2", http.StatusPartialContent, "89", "bytes 8-9/10"},
+		{"bytes=8-20", http.StatusPartialContent, "89", "bytes 8-9/10"},
+		{"bytes=10-", http.StatusRequestedRangeNotSatisfiable, "", "bytes */10"},
+		{"bytes=0-1,4-5", http.StatusOK, "0123456789", ""},
+	}
+	for _, v := range tt {
+		r := httptest.NewRequest("GET", "/a.mp3", nil)
+		if v.rng != "" {
+			r.Header.Set("Range", v.rng)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != v.status {
+			t.Fatalf("%q: wanted status %d, found %d", v.rng, v.status, w.Code)
+		}
+		if w.Body.String() != v.body {
+			t.Fatalf("%q: wanted body %q, found %q", v.rng, v.body, w.Body.String())
+		}
+		if found := w.Header().Get("Content-Range"); found != v.contentRange {
+			t.Fatalf("%q: wanted content range %q, found %q", v.rng, v.contentRange, found)
+		}
+		if v.status != http.StatusRequestedRangeNotSatisfiable {
+			if w.Header().Get("Accept-Ranges") != "bytes" || w.Header().Get("Content-Type") != "audio/mpeg" {
+				t.Fatalf("%q: unexpected headers: %v", v.rng, w.Header())
+			}
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/missing.mp3", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Wanted status %d, found %d", http.StatusNotFound, w.Code)
+	}
+}
@@ -0,0 +1,229 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+)
+
+var (
+	_ nexmo.RecStore        = &Mirror{}
+	_ nexmo.TranscriptStore = &Mirror{}
+	_ nexmo.RecClaimer      = &Mirror{}
+	_ nexmo.RecUsage        = &Mirror{}
+)
+
+// Mirror is a recordings store keeping a copy of each recording
+// of Primary in Secondary, a warm standby that survives the loss
+// of the primary store. Recordings are read from Primary only,
+// and copied to Secondary in the background: the copies that
+// fail are retried by Reconcile.
+type Mirror struct {
+	Primary   nexmo.RecStore
+	Secondary nexmo.RecStore
+	Log       *log.Logger
+
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	copying map[string]bool
+}
+
+func NewMirror(primary, secondary nexmo.RecStore) *Mirror {
+	return &Mirror{
+		Primary:   primary,
+		Secondary: secondary,
+		copying:   make(map[string]bool),
+	}
+}
+
+// WriteRec stores the recording in Primary, copying it to
+// Secondary afterwards.
+func (m *Mirror) WriteRec(ctx context.Context, src io.Reader, name string, meta nexmo.RecMeta) (nexmo.RecMeta, error) {
+	meta, err := m.Primary.WriteRec(ctx, src, name, meta)
+	if err != nil {
+		return meta, err
+	}
+	m.async(func(ctx context.Context) {
+		if err := m.copy(ctx, name); err != nil {
+			logger(m.Log).Printf("mirror: %v", err)
+		}
+	})
+	return meta, nil
+}
+
+func (m *Mirror) OpenRec(ctx context.Context, name string) (io.ReadCloser, nexmo.RecMeta, error) {
+	return m.Primary.OpenRec(ctx, name)
+}
+
+func (m *Mirror) ListRecs(ctx context.Context) ([]nexmo.RecMeta, error) {
+	return m.Primary.ListRecs(ctx)
+}
+
+// DeleteRec removes the recording from Primary, and then from
+// Secondary in the background.
+func (m *Mirror) DeleteRec(ctx context.Context, name string) error {
+	if err := m.Primary.DeleteRec(ctx, name); err != nil {
+		return err
+	}
+	m.async(func(ctx context.Context) {
+		if err := m.Secondary.DeleteRec(ctx, name); err != nil && err != nexmo.ErrRecNotFound {
+			logger(m.Log).Printf("mirror: unable to delete %s from secondary: %v", name, err)
+		}
+	})
+	return nil
+}
+
+func (m *Mirror) RecFileHandler() http.Handler {
+	return m.Primary.RecFileHandler()
+}
+
+// UsedRec forwards to Primary if it implements
+// nexmo.RecUsage, and is a no-op otherwise.
+func (m *Mirror) UsedRec(ctx context.Context, name string, id int64) error {
+	if u, ok := m.Primary.(nexmo.RecUsage); ok {
+		return u.UsedRec(ctx, name, id)
+	}
+	return nil
+}
+
+// WriteTranscript forwards to Primary if it implements
+// nexmo.TranscriptStore, and returns nexmo.ErrNoHistory otherwise.
+func (m *Mirror) WriteTranscript(ctx context.Context, t nexmo.Transcript) error {
+	if ts, ok := m.Primary.(nexmo.TranscriptStore); ok {
+		return ts.WriteTranscript(ctx, t)
+	}
+	return nexmo.ErrNoHistory
+}
+
+// Transcript forwards to Primary if it implements
+// nexmo.TranscriptStore, and returns nexmo.ErrNoHistory otherwise.
+func (m *Mirror) Transcript(ctx context.Context, recName string) (nexmo.Transcript, error) {
+	if ts, ok := m.Primary.(nexmo.TranscriptStore); ok {
+		return ts.Transcript(ctx, recName)
+	}
+	return nexmo.Transcript{}, nexmo.ErrNoHistory
+}
+
+// ClaimRec forwards to Primary if it implements
+// nexmo.RecClaimer, and returns nexmo.ErrNoHistory otherwise.
+func (m *Mirror) ClaimRec(ctx context.Context, uuid string) (bool, error) {
+	if c, ok := m.Primary.(nexmo.RecClaimer); ok {
+		return c.ClaimRec(ctx, uuid)
+	}
+	return false, nexmo.ErrNoHistory
+}
+
+// Wait blocks until the background copies and deletions
+// have completed.
+func (m *Mirror) Wait() {
+	m.wg.Wait()
+}
+
+func (m *Mirror) async(f func(context.Context)) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		f(context.Background())
+	}()
+}
+
+// copy copies the recording `name` from Primary to Secondary,
+// unless a copy of it is already in progress.
+func (m *Mirror) copy(ctx context.Context, name string) error {
+	m.mu.Lock()
+	if m.copying[name] {
+		m.mu.Unlock()
+		return nil
+	}
+	m.copying[name] = true
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.copying, name)
+		m.mu.Unlock()
+	}()
+
+	src, meta, err := m.Primary.OpenRec(ctx, name)
+	if err != nil {
+		return fmt.Errorf("unable to open %s: %v", name, err)
+	}
+	defer src.Close()
+	if _, err = m.Secondary.WriteRec(ctx, src, name, meta); err != nil {
+		return fmt.Errorf("unable to copy %s: %v", name, err)
+	}
+	return nil
+}
+
+// Reconcile copies to Secondary the recordings of Primary that
+// it is missing, or whose size differs, returning how many
+// recordings have been copied.
+func (m *Mirror) Reconcile(ctx context.Context) (int, error) {
+	primary, err := m.Primary.ListRecs(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("mirror: unable to list primary recs: %v", err)
+	}
+	secondary, err := m.Secondary.ListRecs(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("mirror: unable to list secondary recs: %v", err)
+	}
+	sizes := make(map[string]int64, len(secondary))
+	for _, v := range secondary {
+		sizes[v.Name] = v.Size
+	}
+
+	n := 0
+	for _, v := range primary {
+		if size, ok := sizes[v.Name]; ok && size == v.Size {
+			continue
+		}
+		if err := m.copy(ctx, v.Name); err != nil {
+			return n, fmt.Errorf("mirror: %v", err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Run reconciles the stores every `interval`, until `ctx`
+// is canceled. A zero `interval` reconciles them only once.
+func (m *Mirror) Run(ctx context.Context, interval time.Duration) {
+	for {
+		n, err := m.Reconcile(ctx)
+		if err != nil {
+			logger(m.Log).Println(err)
+		} else if n > 0 {
+			logger(m.Log).Printf("mirror: copied %d recordings to secondary", n)
+		}
+		if interval <= 0 {
+			return
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package storage_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestMirror(t *testing.T) {
+	primary, done := newLocal(t)
+	defer done()
+	secondary, done2 := newLocal(t)
+	defer done2()
+
+	ctx := context.TODO()
+	// Recorded before the mirror was configured.
+	if _, err := primary.WriteRec(ctx, strings.NewReader("old"), "old.mp3", nexmo.RecMeta{}); err != nil {
+		t.Fatal(err)
+	}
+
+	m := storage.NewMirror(primary, secondary)
+	if _, err := m.WriteRec(ctx, strings.NewReader("hello"), "a.mp3", nexmo.RecMeta{}); err != nil {
+		t.Fatalf("Unexpected write error: %v", err)
+	}
+	m.Wait()
+	if _, meta, err := secondary.OpenRec(ctx, "a.mp3"); err != nil || meta.Size != 5 {
+		t.Fatalf("Recording was not mirrored: %v", err)
+	}
+
+	n, err := m.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected reconcile error: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("Wanted 1 recording reconciled, found %d", n)
+	}
+	if _, _, err = secondary.OpenRec(ctx, "old.mp3"); err != nil {
+		t.Fatalf("Recording was not reconciled: %v", err)
+	}
+	if n, _ = m.Reconcile(ctx); n != 0 {
+		t.Fatalf("Wanted nothing left to reconcile, found %d", n)
+	}
+
+	if err = m.DeleteRec(ctx, "a.mp3"); err != nil {
+		t.Fatalf("Unexpected delete error: %v", err)
+	}
+	m.Wait()
+	if _, _, err = secondary.OpenRec(ctx, "a.mp3"); err != nexmo.ErrRecNotFound {
+		t.Fatalf("Wanted ErrRecNotFound, found %v", err)
+	}
+}
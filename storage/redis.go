@@ -0,0 +1,168 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	_ nexmo.SharedState = &Redis{}
+	_ nexmo.RateBucket  = &RedisBucket{}
+)
+
+// leadScript takes or renews the leadership KEYS[1] for ARGV[1],
+// lasting ARGV[2] milliseconds, returning 1 if it leads.
+var leadScript = redis.NewScript(`
+local cur = redis.call("GET", KEYS[1])
+if cur == false or cur == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// resignScript deletes the leadership KEYS[1] if ARGV[1] holds it.
+var resignScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// reserveScript reserves the next slot of the bucket KEYS[1],
+// whose slots are ARGV[1] milliseconds apart, returning how many
+// milliseconds the caller has to wait for it. The time of the
+// server is the clock of every instance.
+var reserveScript = redis.NewScript(`
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local next = tonumber(redis.call("GET", KEYS[1]) or "0")
+if next < now then
+	next = now
+end
+local interval = tonumber(ARGV[1])
+redis.call("SET", KEYS[1], string.format("%d", next + interval), "PX", string.format("%d", next - now + interval))
+return next - now
+`)
+
+// Redis keeps the state shared by the instances of a distributed
+// deployment in a Redis server.
+type Redis struct {
+	client *redis.Client
+}
+
+// NewRedis connects to the Redis server at `addr`, checking
+// that it is reachable.
+func NewRedis(ctx context.Context, addr, password string, db int) (*Redis, error) {
+	c := redis.NewClient(&redis.Options{Addr: addr, Password: password, DB: db})
+	if err := c.Ping(ctx).Err(); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("redis: unable to reach %s: %v", addr, err)
+	}
+	return &Redis{client: c}, nil
+}
+
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
+
+func (r *Redis) Claim(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	ok, err := r.client.SetNX(ctx, key, 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("redis: claim: %v", err)
+	}
+	return ok, nil
+}
+
+func (r *Redis) Push(ctx context.Context, queue string, job []byte) error {
+	if err := r.client.LPush(ctx, queue, job).Err(); err != nil {
+		return fmt.Errorf("redis: push: %v", err)
+	}
+	return nil
+}
+
+func (r *Redis) Pop(ctx context.Context, queue string, wait time.Duration) ([]byte, error) {
+	if wait < time.Second {
+		// BRPOP does not wait less than that.
+		wait = time.Second
+	}
+	v, err := r.client.BRPop(ctx, wait, queue).Result()
+	switch {
+	case err == redis.Nil:
+		return nil, nexmo.ErrNoJob
+	case err != nil:
+		return nil, fmt.Errorf("redis: pop: %v", err)
+	}
+	return []byte(v[1]), nil
+}
+
+func (r *Redis) Lead(ctx context.Context, name, id string, ttl time.Duration) (bool, error) {
+	n, err := leadScript.Run(ctx, r.client, []string{name}, id, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("redis: lead: %v", err)
+	}
+	return n == 1, nil
+}
+
+func (r *Redis) Resign(ctx context.Context, name, id string) error {
+	if err := resignScript.Run(ctx, r.client, []string{name}, id).Err(); err != nil {
+		return fmt.Errorf("redis: resign: %v", err)
+	}
+	return nil
+}
+
+// RedisBucket is a nexmo.RateBucket shared by the instances using
+// the same Redis server and key. The slot of a waiter giving up
+// is lost.
+type RedisBucket struct {
+	client   *redis.Client
+	key      string
+	interval time.Duration
+}
+
+// Bucket returns the bucket `key`, allowing `perSecond` events
+// per second.
+func (r *Redis) Bucket(key string, perSecond int) *RedisBucket {
+	// Rounding the interval up to the millisecond keeps the
+	// rate below the limit.
+	ms := (1000 + perSecond - 1) / perSecond
+	return &RedisBucket{client: r.client, key: key, interval: time.Duration(ms) * time.Millisecond}
+}
+
+func (b *RedisBucket) Wait(ctx context.Context) error {
+	ms, err := reserveScript.Run(ctx, b.client, []string{b.key}, b.interval.Milliseconds()).Int64()
+	if err != nil {
+		return fmt.Errorf("redis: reserve: %v", err)
+	}
+	if ms <= 0 {
+		return nil
+	}
+	t := time.NewTimer(time.Duration(ms) * time.Millisecond)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,85 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestRedis(t *testing.T) {
+	m := miniredis.RunT(t)
+	ctx := context.TODO()
+	r, err := storage.NewRedis(ctx, m.Addr(), "", 0)
+	if err != nil {
+		t.Fatalf("Unexpected new error: %v", err)
+	}
+	defer r.Close()
+
+	if ok, err := r.Claim(ctx, "k", time.Minute); !ok || err != nil {
+		t.Fatalf("Wanted the key to be claimed, found %v, %v", ok, err)
+	}
+	if ok, err := r.Claim(ctx, "k", time.Minute); ok || err != nil {
+		t.Fatalf("Wanted the key to be claimed already, found %v, %v", ok, err)
+	}
+
+	for _, v := range []string{"a", "b"} {
+		if err = r.Push(ctx, "q", []byte(v)); err != nil {
+			t.Fatalf("Unexpected push error: %v", err)
+		}
+	}
+	for _, v := range []string{"a", "b"} {
+		job, err := r.Pop(ctx, "q", time.Second)
+		if err != nil || string(job) != v {
+			t.Fatalf("Wanted job %q, found %q, %v", v, job, err)
+		}
+	}
+	if _, err = r.Pop(ctx, "q", time.Second); err != nexmo.ErrNoJob {
+		t.Fatalf("Wanted %v, found %v", nexmo.ErrNoJob, err)
+	}
+
+	if ok, err := r.Lead(ctx, "l", "one", time.Minute); !ok || err != nil {
+		t.Fatalf("Wanted one to lead, found %v, %v", ok, err)
+	}
+	if ok, err := r.Lead(ctx, "l", "two", time.Minute); ok || err != nil {
+		t.Fatalf("Wanted two not to lead, found %v, %v", ok, err)
+	}
+	if err = r.Resign(ctx, "l", "two"); err != nil {
+		t.Fatalf("Unexpected resign error: %v", err)
+	}
+	if ok, _ := r.Lead(ctx, "l", "one", time.Minute); !ok {
+		t.Fatalf("Wanted one to keep leading")
+	}
+	m.FastForward(2 * time.Minute)
+	if ok, err := r.Lead(ctx, "l", "two", time.Minute); !ok || err != nil {
+		t.Fatalf("Wanted two to lead once the lease expired, found %v, %v", ok, err)
+	}
+}
+
+func TestRedisBucket(t *testing.T) {
+	m := miniredis.RunT(t)
+	ctx := context.TODO()
+	var buckets []*storage.RedisBucket
+	for i := 0; i < 2; i++ {
+		r, err := storage.NewRedis(ctx, m.Addr(), "", 0)
+		if err != nil {
+			t.Fatalf("Unexpected new error: %v", err)
+		}
+		defer r.Close()
+		buckets = append(buckets, r.Bucket("calls", 10))
+	}
+
+	// The replicas share the 10 events per second.
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		if err := buckets[i%2].Wait(ctx); err != nil {
+			t.Fatalf("%d: Unexpected wait error: %v", i, err)
+		}
+	}
+	if d := time.Since(start); d < 500*time.Millisecond {
+		t.Fatalf("Wanted 6 events to take at least 500ms, found %v", d)
+	}
+}
@@ -0,0 +1,922 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jecoz/voicebr/flow"
+	"github.com/jecoz/voicebr/nexmo"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	_ nexmo.ContactsStore    = &SQLite{}
+	_ nexmo.BroadcastLog     = &SQLite{}
+	_ nexmo.BroadcastHistory = &SQLite{}
+	_ nexmo.EventLog         = &SQLite{}
+	_ nexmo.FailureArchive   = &SQLite{}
+	_ nexmo.GroupStore       = &SQLite{}
+	_ nexmo.TokenStore       = &SQLite{}
+	_ nexmo.RecClaimer       = &SQLite{}
+	_ nexmo.SuppressionList  = &SQLite{}
+	_ nexmo.TemplateStore    = &SQLite{}
+	_ nexmo.ContactsWriter   = &SQLite{}
+	_ nexmo.SubjectStore     = &SQLite{}
+	_ flow.Store             = &SQLite{}
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS contacts (
+	list          TEXT NOT NULL,
+	number        TEXT NOT NULL,
+	name          TEXT NOT NULL,
+	max_attempts  INTEGER NOT NULL DEFAULT 0,
+	retry_spacing INTEGER NOT NULL DEFAULT 0,
+	voicemail     TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (list, number)
+);
+CREATE TABLE IF NOT EXISTS groups (
+	name   TEXT NOT NULL,
+	number TEXT NOT NULL,
+	PRIMARY KEY (name, number)
+);
+CREATE TABLE IF NOT EXISTS broadcasts (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	rec_name   TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
+CREATE TABLE IF NOT EXISTS broadcast_recipients (
+	broadcast_id INTEGER NOT NULL REFERENCES broadcasts(id),
+	position     INTEGER NOT NULL,
+	number       TEXT NOT NULL,
+	name         TEXT NOT NULL,
+	lang         TEXT NOT NULL DEFAULT '',
+	voice        TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (broadcast_id, position)
+);
+CREATE TABLE IF NOT EXISTS call_attempts (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	broadcast_id INTEGER NOT NULL REFERENCES broadcasts(id),
+	number       TEXT NOT NULL,
+	attempt      INTEGER NOT NULL,
+	status       TEXT NOT NULL,
+	error        TEXT NOT NULL DEFAULT '',
+	created_at   TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS call_attempts_broadcast ON call_attempts (broadcast_id, number);
+CREATE TABLE IF NOT EXISTS call_events (
+	id                INTEGER PRIMARY KEY AUTOINCREMENT,
+	conversation_uuid TEXT NOT NULL,
+	uuid              TEXT NOT NULL,
+	status            TEXT NOT NULL,
+	direction         TEXT NOT NULL DEFAULT '',
+	sender            TEXT NOT NULL DEFAULT '',
+	recipient         TEXT NOT NULL DEFAULT '',
+	duration          INTEGER NOT NULL DEFAULT 0,
+	timestamp         TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS call_events_conversation ON call_events (conversation_uuid);
+CREATE TABLE IF NOT EXISTS call_failures (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	broadcast_id INTEGER NOT NULL,
+	number       TEXT NOT NULL,
+	attempt      INTEGER NOT NULL,
+	request      TEXT NOT NULL,
+	status       INTEGER NOT NULL,
+	response     TEXT NOT NULL,
+	error        TEXT NOT NULL,
+	created_at   TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS call_failures_broadcast ON call_failures (broadcast_id);
+CREATE TABLE IF NOT EXISTS api_tokens (
+	id         TEXT PRIMARY KEY,
+	name       TEXT NOT NULL,
+	hash       TEXT NOT NULL UNIQUE,
+	scope      TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS claimed_recordings (
+	uuid       TEXT PRIMARY KEY,
+	claimed_at TIMESTAMP NOT NULL
+);
+CREATE TABLE IF NOT EXISTS templates (
+	name       TEXT PRIMARY KEY,
+	rec_name   TEXT NOT NULL,
+	code       TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
+CREATE TABLE IF NOT EXISTS flow_sessions (
+	id         TEXT PRIMARY KEY,
+	flow       TEXT NOT NULL,
+	state      TEXT NOT NULL,
+	data       TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+CREATE TABLE IF NOT EXISTS suppressions (
+	number       TEXT PRIMARY KEY,
+	reason       TEXT NOT NULL,
+	broadcast_id INTEGER NOT NULL,
+	created_at   TIMESTAMP NOT NULL
+);
+`
+
+// sqliteMigrations are applied in order on each start. Statements
+// adding columns that already exist are ignored.
+var sqliteMigrations = []string{
+	`ALTER TABLE contacts ADD COLUMN lang TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE contacts ADD COLUMN voice TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE call_events ADD COLUMN broadcast_id INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE broadcasts ADD COLUMN conference TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE broadcasts ADD COLUMN relay TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE broadcasts ADD COLUMN audio TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE broadcasts ADD COLUMN from_number TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE contacts ADD COLUMN tz TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE broadcasts ADD COLUMN cost TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE call_events ADD COLUMN rate REAL NOT NULL DEFAULT 0`,
+	`ALTER TABLE call_events ADD COLUMN price REAL NOT NULL DEFAULT 0`,
+	`ALTER TABLE broadcasts ADD COLUMN priority TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE broadcasts ADD COLUMN lang TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE broadcasts ADD COLUMN requested_by TEXT NOT NULL DEFAULT ''`,
+}
+
+// SQLite stores contacts, groups, broadcasts and call attempts
+// in a sqlite database. It does not store recordings: combine it
+// with a RecStore using Combined.
+type SQLite struct {
+	db *sql.DB
+}
+
+// NewSQLite opens (or creates) the database at `path`,
+// ensuring that its schema is up to date.
+func NewSQLite(path string) (*SQLite, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite storage error: unable to open database: %v", err)
+	}
+	if _, err = db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("sqlite storage error: unable to create schema: %v", err)
+	}
+	for _, v := range sqliteMigrations {
+		if _, err = db.Exec(v); err != nil && !strings.Contains(err.Error(), "duplicate column") {
+			db.Close()
+			return nil, fmt.Errorf("sqlite storage error: unable to migrate schema: %v", err)
+		}
+	}
+	return &SQLite{db: db}, nil
+}
+
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLite) ReadBroadcastList(dest io.Writer) error {
+	return s.readContacts(dest, nexmo.BroadcastList)
+}
+
+func (s *SQLite) ReadWhitelist(dest io.Writer) error {
+	return s.readContacts(dest, nexmo.Whitelist)
+}
+
+// readContacts encodes `list` in csv, as if it was read from
+// a contacts file.
+func (s *SQLite) readContacts(dest io.Writer, list nexmo.ContactList) error {
+	contacts, err := s.ListContacts(context.Background(), list)
+	if err != nil {
+		return err
+	}
+	return nexmo.EncodeContacts(dest, contacts)
+}
+
+func (s *SQLite) ListContacts(ctx context.Context, list nexmo.ContactList) ([]nexmo.Contact, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT number, name, max_attempts, retry_spacing, voicemail, lang, voice, tz
+		FROM contacts WHERE list = ? ORDER BY rowid`, string(list))
+	if err != nil {
+		return nil, fmt.Errorf("sqlite storage error: unable to list contacts: %v", err)
+	}
+	return scanContacts(rows)
+}
+
+func scanContacts(rows *sql.Rows) ([]nexmo.Contact, error) {
+	defer rows.Close()
+
+	acc := []nexmo.Contact{}
+	for rows.Next() {
+		var number, name, voicemail, lang, voice, tz string
+		var attempts int
+		var spacing int64
+		if err := rows.Scan(&number, &name, &attempts, &spacing, &voicemail, &lang, &voice, &tz); err != nil {
+			return nil, fmt.Errorf("sqlite storage error: unable to scan contact: %v", err)
+		}
+		c := nexmo.NewContact(number, name)
+		c.Policy = nexmo.DeliveryPolicy{
+			MaxAttempts:  attempts,
+			RetrySpacing: time.Duration(spacing),
+			Voicemail:    voicemail,
+		}
+		c.Lang = lang
+		c.Voice = voice
+		c.TZ = tz
+		acc = append(acc, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlite storage error: unable to read contacts: %v", err)
+	}
+	return acc, nil
+}
+
+func (s *SQLite) AddContact(ctx context.Context, list nexmo.ContactList, c nexmo.Contact) error {
+	return s.AppendContacts(ctx, list, []nexmo.Contact{c})
+}
+
+// AppendContacts adds `contacts` to `list` in a single
+// transaction, replacing the ones with the same numbers.
+func (s *SQLite) AppendContacts(ctx context.Context, list nexmo.ContactList, contacts []nexmo.Contact) error {
+	return s.putContacts(ctx, list, contacts, false)
+}
+
+// WriteContacts replaces the contents of `list` with `contacts`
+// in a single transaction. The groups are left untouched.
+func (s *SQLite) WriteContacts(ctx context.Context, list nexmo.ContactList, contacts []nexmo.Contact) error {
+	return s.putContacts(ctx, list, contacts, true)
+}
+
+func (s *SQLite) putContacts(ctx context.Context, list nexmo.ContactList, contacts []nexmo.Contact, replace bool) error {
+	if _, err := contactsFile(list); err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("sqlite storage error: unable to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if replace {
+		if _, err = tx.ExecContext(ctx, `DELETE FROM contacts WHERE list = ?`, string(list)); err != nil {
+			return fmt.Errorf("sqlite storage error: unable to clear contacts: %v", err)
+		}
+	}
+	for _, c := range contacts {
+		_, err = tx.ExecContext(ctx, `
+			INSERT OR REPLACE INTO contacts (list, number, name, max_attempts, retry_spacing, voicemail, lang, voice, tz)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			string(list), c.Number, c.Name, c.Policy.MaxAttempts, int64(c.Policy.RetrySpacing), c.Policy.Voicemail, c.Lang, c.Voice, c.TZ)
+		if err != nil {
+			return fmt.Errorf("sqlite storage error: unable to add contact: %v", err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("sqlite storage error: unable to commit contacts: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLite) RemoveContact(ctx context.Context, list nexmo.ContactList, number string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM contacts WHERE list = ? AND number = ?`, string(list), number)
+	if err != nil {
+		return fmt.Errorf("sqlite storage error: unable to remove contact: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nexmo.ErrContactNotFound
+	}
+	return nil
+}
+
+// AddToGroup adds the broadcast list contact `number` to `group`.
+func (s *SQLite) AddToGroup(ctx context.Context, group, number string) error {
+	if _, err := s.db.ExecContext(ctx, `INSERT OR IGNORE INTO groups (name, number) VALUES (?, ?)`, group, number); err != nil {
+		return fmt.Errorf("sqlite storage error: unable to add to group: %v", err)
+	}
+	return nil
+}
+
+// RemoveFromGroup removes `number` from `group`.
+func (s *SQLite) RemoveFromGroup(ctx context.Context, group, number string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM groups WHERE name = ? AND number = ?`, group, number)
+	if err != nil {
+		return fmt.Errorf("sqlite storage error: unable to remove from group: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nexmo.ErrContactNotFound
+	}
+	return nil
+}
+
+// GroupMembers returns the broadcast list contacts that belong to `group`.
+func (s *SQLite) GroupMembers(ctx context.Context, group string) ([]nexmo.Contact, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT c.number, c.name, c.max_attempts, c.retry_spacing, c.voicemail, c.lang, c.voice, c.tz
+		FROM contacts c JOIN groups g ON g.number = c.number
+		WHERE c.list = ? AND g.name = ? ORDER BY c.rowid`, string(nexmo.BroadcastList), group)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite storage error: unable to list group members: %v", err)
+	}
+	return scanContacts(rows)
+}
+
+func (s *SQLite) CreateBroadcast(ctx context.Context, b nexmo.Broadcast) (nexmo.Broadcast, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return b, fmt.Errorf("sqlite storage error: %v", err)
+	}
+	defer tx.Rollback()
+
+	cost, err := encodeCost(b.Cost)
+	if err != nil {
+		return b, fmt.Errorf("sqlite storage error: %v", err)
+	}
+	res, err := tx.ExecContext(ctx, `INSERT INTO broadcasts (rec_name, conference, relay, audio, from_number, priority, lang, requested_by, cost, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, b.RecName, b.Conference, b.Relay, b.Audio, b.From, b.Priority, b.Lang, b.RequestedBy, cost, b.CreatedAt)
+	if err != nil {
+		return b, fmt.Errorf("sqlite storage error: unable to create broadcast: %v", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return b, fmt.Errorf("sqlite storage error: unable to retrieve broadcast id: %v", err)
+	}
+	for i, v := range b.Recipients {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO broadcast_recipients (broadcast_id, position, number, name, lang, voice)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			id, i, v.Number, v.Name, v.Lang, v.Voice); err != nil {
+			return b, fmt.Errorf("sqlite storage error: unable to store recipient: %v", err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return b, fmt.Errorf("sqlite storage error: %v", err)
+	}
+	b.ID = id
+	return b, nil
+}
+
+func (s *SQLite) LogAttempt(ctx context.Context, a nexmo.CallAttempt) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO call_attempts (broadcast_id, number, attempt, status, error, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		a.BroadcastID, a.Number, a.Attempt, a.Status, a.Err, a.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("sqlite storage error: unable to log attempt: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLite) Broadcast(ctx context.Context, id int64) (nexmo.Broadcast, error) {
+	b := nexmo.Broadcast{}
+	var cost string
+	err := s.db.QueryRowContext(ctx, `SELECT id, rec_name, conference, relay, audio, from_number, priority, lang, requested_by, cost, created_at FROM broadcasts WHERE id = ?`, id).Scan(&b.ID, &b.RecName, &b.Conference, &b.Relay, &b.Audio, &b.From, &b.Priority, &b.Lang, &b.RequestedBy, &cost, &b.CreatedAt)
+	if err == sql.ErrNoRows {
+		return b, nexmo.ErrBroadcastNotFound
+	}
+	if err != nil {
+		return b, fmt.Errorf("sqlite storage error: unable to read broadcast: %v", err)
+	}
+	if b.Cost, err = decodeCost(cost); err != nil {
+		return b, fmt.Errorf("sqlite storage error: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT number, name, lang, voice FROM broadcast_recipients
+		WHERE broadcast_id = ? ORDER BY position`, id)
+	if err != nil {
+		return b, fmt.Errorf("sqlite storage error: unable to list recipients: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r nexmo.Recipient
+		if err := rows.Scan(&r.Number, &r.Name, &r.Lang, &r.Voice); err != nil {
+			return b, fmt.Errorf("sqlite storage error: unable to scan recipient: %v", err)
+		}
+		b.Recipients = append(b.Recipients, r)
+	}
+	return b, rows.Err()
+}
+
+// Broadcasts returns the broadcasts created after `since`,
+// most recent first.
+func (s *SQLite) Broadcasts(ctx context.Context, since time.Time) ([]nexmo.Broadcast, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, rec_name, conference, relay, audio, from_number, priority, lang, requested_by, cost, created_at FROM broadcasts
+		WHERE created_at >= ? ORDER BY created_at DESC`, since)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite storage error: unable to list broadcasts: %v", err)
+	}
+	defer rows.Close()
+
+	acc := []nexmo.Broadcast{}
+	for rows.Next() {
+		var b nexmo.Broadcast
+		var cost string
+		if err := rows.Scan(&b.ID, &b.RecName, &b.Conference, &b.Relay, &b.Audio, &b.From, &b.Priority, &b.Lang, &b.RequestedBy, &cost, &b.CreatedAt); err != nil {
+			return nil, fmt.Errorf("sqlite storage error: unable to scan broadcast: %v", err)
+		}
+		var err error
+		if b.Cost, err = decodeCost(cost); err != nil {
+			return nil, fmt.Errorf("sqlite storage error: %v", err)
+		}
+		acc = append(acc, b)
+	}
+	return acc, rows.Err()
+}
+
+// encodeCost returns the JSON encoding of `e`, empty if nil.
+func encodeCost(e *nexmo.CostEstimate) (string, error) {
+	if e == nil {
+		return "", nil
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return "", fmt.Errorf("unable to encode cost: %v", err)
+	}
+	return string(b), nil
+}
+
+func decodeCost(s string) (*nexmo.CostEstimate, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var e nexmo.CostEstimate
+	if err := json.Unmarshal([]byte(s), &e); err != nil {
+		return nil, fmt.Errorf("unable to decode cost: %v", err)
+	}
+	return &e, nil
+}
+
+// Attempts returns the call attempts of broadcast `id`.
+func (s *SQLite) Attempts(ctx context.Context, id int64) ([]nexmo.CallAttempt, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT broadcast_id, number, attempt, status, error, created_at
+		FROM call_attempts WHERE broadcast_id = ? ORDER BY id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite storage error: unable to list attempts: %v", err)
+	}
+	defer rows.Close()
+
+	acc := []nexmo.CallAttempt{}
+	for rows.Next() {
+		var a nexmo.CallAttempt
+		if err := rows.Scan(&a.BroadcastID, &a.Number, &a.Attempt, &a.Status, &a.Err, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("sqlite storage error: unable to scan attempt: %v", err)
+		}
+		acc = append(acc, a)
+	}
+	return acc, rows.Err()
+}
+
+// Unreached returns the numbers that were part of broadcast `id`
+// but never had a call successfully placed.
+func (s *SQLite) Unreached(ctx context.Context, id int64) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT number FROM call_attempts WHERE broadcast_id = ?
+		GROUP BY number HAVING SUM(status = ?) = 0 ORDER BY number`, id, nexmo.AttemptCreated)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite storage error: unable to query unreached numbers: %v", err)
+	}
+	defer rows.Close()
+
+	acc := []string{}
+	for rows.Next() {
+		var number string
+		if err := rows.Scan(&number); err != nil {
+			return nil, fmt.Errorf("sqlite storage error: unable to scan number: %v", err)
+		}
+		acc = append(acc, number)
+	}
+	return acc, rows.Err()
+}
+
+func (s *SQLite) LogEvent(ctx context.Context, e nexmo.CallEvent) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO call_events (conversation_uuid, uuid, status, direction, sender, recipient, duration, rate, price, timestamp, broadcast_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ConversationUUID, e.UUID, e.Status, e.Direction, e.From, e.To, int64(e.Duration), e.Rate, e.Price, e.Timestamp, e.BroadcastID)
+	if err != nil {
+		return fmt.Errorf("sqlite storage error: unable to log event: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLite) Events(ctx context.Context, conversationUUID string) ([]nexmo.CallEvent, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT conversation_uuid, uuid, status, direction, sender, recipient, duration, rate, price, timestamp, broadcast_id
+		FROM call_events WHERE ? = '' OR conversation_uuid = ? ORDER BY timestamp, id`,
+		conversationUUID, conversationUUID)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite storage error: unable to list events: %v", err)
+	}
+	return scanEvents(rows)
+}
+
+// CompletedCalls returns the completed events received between
+// `since` and `until`, oldest first.
+func (s *SQLite) CompletedCalls(ctx context.Context, since, until time.Time) ([]nexmo.CallEvent, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT conversation_uuid, uuid, status, direction, sender, recipient, duration, rate, price, timestamp, broadcast_id
+		FROM call_events WHERE status = 'completed' AND timestamp >= ? AND timestamp < ? ORDER BY timestamp, id`,
+		since.UTC(), until.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("sqlite storage error: unable to list completed calls: %v", err)
+	}
+	return scanEvents(rows)
+}
+
+func scanEvents(rows *sql.Rows) ([]nexmo.CallEvent, error) {
+	defer rows.Close()
+	acc := []nexmo.CallEvent{}
+	for rows.Next() {
+		var e nexmo.CallEvent
+		var d int64
+		if err := rows.Scan(&e.ConversationUUID, &e.UUID, &e.Status, &e.Direction, &e.From, &e.To, &d, &e.Rate, &e.Price, &e.Timestamp, &e.BroadcastID); err != nil {
+			return nil, fmt.Errorf("sqlite storage error: unable to scan event: %v", err)
+		}
+		e.Duration = time.Duration(d)
+		acc = append(acc, e)
+	}
+	return acc, rows.Err()
+}
+
+func (s *SQLite) ArchiveFailure(ctx context.Context, f nexmo.CallFailure) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO call_failures (broadcast_id, number, attempt, request, status, response, error, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		f.BroadcastID, f.Number, f.Attempt, f.Request, f.Status, f.Response, f.Err, f.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("sqlite storage error: unable to archive failure: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLite) Failures(ctx context.Context, broadcastID int64) ([]nexmo.CallFailure, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT broadcast_id, number, attempt, request, status, response, error, created_at
+		FROM call_failures WHERE broadcast_id = ? ORDER BY id`, broadcastID)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite storage error: unable to list failures: %v", err)
+	}
+	defer rows.Close()
+
+	acc := []nexmo.CallFailure{}
+	for rows.Next() {
+		var f nexmo.CallFailure
+		if err := rows.Scan(&f.BroadcastID, &f.Number, &f.Attempt, &f.Request, &f.Status, &f.Response, &f.Err, &f.CreatedAt); err != nil {
+			return nil, fmt.Errorf("sqlite storage error: unable to scan failure: %v", err)
+		}
+		acc = append(acc, f)
+	}
+	return acc, rows.Err()
+}
+
+// SubjectRecords returns the groups, the broadcasts, the call
+// attempts, the failures and the events of `number`.
+func (s *SQLite) SubjectRecords(ctx context.Context, number string) (nexmo.SubjectRecords, error) {
+	rec := nexmo.SubjectRecords{
+		Groups:     []string{},
+		Broadcasts: []int64{},
+		Attempts:   []nexmo.CallAttempt{},
+		Failures:   []nexmo.CallFailure{},
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT name FROM groups WHERE number = ? ORDER BY name`, number)
+	if err != nil {
+		return rec, fmt.Errorf("sqlite storage error: unable to list groups: %v", err)
+	}
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			rows.Close()
+			return rec, fmt.Errorf("sqlite storage error: unable to scan group: %v", err)
+		}
+		rec.Groups = append(rec.Groups, name)
+	}
+	rows.Close()
+
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT DISTINCT broadcast_id FROM broadcast_recipients
+		WHERE number = ? ORDER BY broadcast_id`, number)
+	if err != nil {
+		return rec, fmt.Errorf("sqlite storage error: unable to list broadcasts: %v", err)
+	}
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return rec, fmt.Errorf("sqlite storage error: unable to scan broadcast: %v", err)
+		}
+		rec.Broadcasts = append(rec.Broadcasts, id)
+	}
+	rows.Close()
+
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT broadcast_id, number, attempt, status, error, created_at
+		FROM call_attempts WHERE number = ? ORDER BY id`, number)
+	if err != nil {
+		return rec, fmt.Errorf("sqlite storage error: unable to list attempts: %v", err)
+	}
+	for rows.Next() {
+		var a nexmo.CallAttempt
+		if err = rows.Scan(&a.BroadcastID, &a.Number, &a.Attempt, &a.Status, &a.Err, &a.CreatedAt); err != nil {
+			rows.Close()
+			return rec, fmt.Errorf("sqlite storage error: unable to scan attempt: %v", err)
+		}
+		rec.Attempts = append(rec.Attempts, a)
+	}
+	rows.Close()
+
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT broadcast_id, number, attempt, request, status, response, error, created_at
+		FROM call_failures WHERE number = ? ORDER BY id`, number)
+	if err != nil {
+		return rec, fmt.Errorf("sqlite storage error: unable to list failures: %v", err)
+	}
+	for rows.Next() {
+		var f nexmo.CallFailure
+		if err = rows.Scan(&f.BroadcastID, &f.Number, &f.Attempt, &f.Request, &f.Status, &f.Response, &f.Err, &f.CreatedAt); err != nil {
+			rows.Close()
+			return rec, fmt.Errorf("sqlite storage error: unable to scan failure: %v", err)
+		}
+		rec.Failures = append(rec.Failures, f)
+	}
+	rows.Close()
+
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT conversation_uuid, uuid, status, direction, sender, recipient, duration, rate, price, timestamp, broadcast_id
+		FROM call_events WHERE sender = ? OR recipient = ? ORDER BY timestamp, id`, number, number)
+	if err != nil {
+		return rec, fmt.Errorf("sqlite storage error: unable to list events: %v", err)
+	}
+	if rec.Events, err = scanEvents(rows); err != nil {
+		return rec, err
+	}
+	return rec, nil
+}
+
+// EraseSubjectRecords removes the records of `number` in a single
+// transaction. The broadcasts it was a recipient of are kept, the
+// number is only removed from their recipients.
+func (s *SQLite) EraseSubjectRecords(ctx context.Context, number string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("sqlite storage error: unable to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, q := range []string{
+		`DELETE FROM groups WHERE number = ?`,
+		`DELETE FROM broadcast_recipients WHERE number = ?`,
+		`DELETE FROM call_attempts WHERE number = ?`,
+		`DELETE FROM call_failures WHERE number = ?`,
+		`DELETE FROM call_events WHERE sender = ?1 OR recipient = ?1`,
+	} {
+		if _, err = tx.ExecContext(ctx, q, number); err != nil {
+			return fmt.Errorf("sqlite storage error: unable to erase subject records: %v", err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("sqlite storage error: unable to commit erasure: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLite) SaveToken(ctx context.Context, t nexmo.Token) error {
+	scope, err := json.Marshal(t.Scope)
+	if err != nil {
+		return fmt.Errorf("sqlite storage error: unable to encode scope: %v", err)
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO api_tokens (id, name, hash, scope, created_at) VALUES (?, ?, ?, ?, ?)`,
+		t.ID, t.Name, t.Hash, string(scope), t.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("sqlite storage error: unable to save token: %v", err)
+	}
+	return nil
+}
+
+const tokenColumns = `id, name, hash, scope, created_at, revoked_at`
+
+func scanToken(row interface{ Scan(...interface{}) error }) (nexmo.Token, error) {
+	var (
+		t       nexmo.Token
+		scope   string
+		revoked sql.NullTime
+	)
+	if err := row.Scan(&t.ID, &t.Name, &t.Hash, &scope, &t.CreatedAt, &revoked); err != nil {
+		return t, err
+	}
+	if err := json.Unmarshal([]byte(scope), &t.Scope); err != nil {
+		return t, fmt.Errorf("unable to decode scope: %v", err)
+	}
+	if revoked.Valid {
+		t.RevokedAt = &revoked.Time
+	}
+	return t, nil
+}
+
+func (s *SQLite) TokenByHash(ctx context.Context, hash string) (nexmo.Token, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+tokenColumns+` FROM api_tokens WHERE hash = ?`, hash)
+	t, err := scanToken(row)
+	switch {
+	case err == sql.ErrNoRows:
+		return t, nexmo.ErrTokenNotFound
+	case err != nil:
+		return t, fmt.Errorf("sqlite storage error: unable to read token: %v", err)
+	}
+	return t, nil
+}
+
+func (s *SQLite) Tokens(ctx context.Context) ([]nexmo.Token, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+tokenColumns+` FROM api_tokens ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite storage error: unable to list tokens: %v", err)
+	}
+	defer rows.Close()
+
+	acc := []nexmo.Token{}
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("sqlite storage error: unable to scan token: %v", err)
+		}
+		acc = append(acc, t)
+	}
+	return acc, rows.Err()
+}
+
+// RevokeToken marks the token `id` as revoked at `at`. Tokens
+// are kept, so that their history remains available.
+func (s *SQLite) RevokeToken(ctx context.Context, id string, at time.Time) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE api_tokens SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, at, id)
+	if err != nil {
+		return fmt.Errorf("sqlite storage error: unable to revoke token: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nexmo.ErrTokenNotFound
+	}
+	return nil
+}
+
+// ClaimRec inserts `uuid` in the claimed recordings, dropping
+// the claims older than nexmo.RecClaimTTL first.
+func (s *SQLite) ClaimRec(ctx context.Context, uuid string) (bool, error) {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM claimed_recordings WHERE claimed_at <= ?`, time.Now().Add(-nexmo.RecClaimTTL)); err != nil {
+		return false, fmt.Errorf("sqlite storage error: unable to expire claims: %v", err)
+	}
+	res, err := s.db.ExecContext(ctx, `INSERT OR IGNORE INTO claimed_recordings (uuid, claimed_at) VALUES (?, ?)`, uuid, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("sqlite storage error: unable to claim recording: %v", err)
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+func (s *SQLite) Suppress(ctx context.Context, sup nexmo.Suppression) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT OR REPLACE INTO suppressions (number, reason, broadcast_id, created_at)
+		VALUES (?, ?, ?, ?)`,
+		sup.Number, sup.Reason, sup.BroadcastID, sup.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("sqlite storage error: unable to suppress number: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLite) Unsuppress(ctx context.Context, number string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM suppressions WHERE number = ?`, number)
+	if err != nil {
+		return fmt.Errorf("sqlite storage error: unable to unsuppress number: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nexmo.ErrContactNotFound
+	}
+	return nil
+}
+
+func (s *SQLite) Suppressions(ctx context.Context) ([]nexmo.Suppression, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT number, reason, broadcast_id, created_at
+		FROM suppressions ORDER BY created_at, number`)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite storage error: unable to list suppressions: %v", err)
+	}
+	defer rows.Close()
+
+	acc := []nexmo.Suppression{}
+	for rows.Next() {
+		var v nexmo.Suppression
+		if err := rows.Scan(&v.Number, &v.Reason, &v.BroadcastID, &v.CreatedAt); err != nil {
+			return nil, fmt.Errorf("sqlite storage error: unable to scan suppression: %v", err)
+		}
+		acc = append(acc, v)
+	}
+	return acc, rows.Err()
+}
+
+func (s *SQLite) SaveTemplate(ctx context.Context, t nexmo.Template) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT OR REPLACE INTO templates (name, rec_name, code, created_at)
+		VALUES (?, ?, ?, ?)`,
+		t.Name, t.RecName, t.Code, t.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("sqlite storage error: unable to save template: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLite) Templates(ctx context.Context) ([]nexmo.Template, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT name, rec_name, code, created_at FROM templates ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite storage error: unable to list templates: %v", err)
+	}
+	defer rows.Close()
+
+	acc := []nexmo.Template{}
+	for rows.Next() {
+		var t nexmo.Template
+		if err := rows.Scan(&t.Name, &t.RecName, &t.Code, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("sqlite storage error: unable to scan template: %v", err)
+		}
+		acc = append(acc, t)
+	}
+	return acc, rows.Err()
+}
+
+func (s *SQLite) DeleteTemplate(ctx context.Context, name string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM templates WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("sqlite storage error: unable to delete template: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nexmo.ErrTemplateNotFound
+	}
+	return nil
+}
+
+// LoadSession ignores the sessions not updated for
+// flow.DefaultTTL.
+func (s *SQLite) LoadSession(ctx context.Context, id string) (flow.Session, error) {
+	var (
+		sess flow.Session
+		data string
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, flow, state, data, created_at, updated_at
+		FROM flow_sessions WHERE id = ? AND updated_at > ?`,
+		id, time.Now().Add(-flow.DefaultTTL)).Scan(&sess.ID, &sess.Flow, &sess.State, &data, &sess.CreatedAt, &sess.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return flow.Session{}, flow.ErrNotFound
+	}
+	if err != nil {
+		return flow.Session{}, fmt.Errorf("sqlite storage error: unable to load session: %v", err)
+	}
+	if err = json.Unmarshal([]byte(data), &sess.Data); err != nil {
+		return flow.Session{}, fmt.Errorf("sqlite storage error: unable to decode session data: %v", err)
+	}
+	return sess, nil
+}
+
+// SaveSession stores `sess`, deleting the expired sessions.
+func (s *SQLite) SaveSession(ctx context.Context, sess flow.Session) error {
+	data, err := json.Marshal(sess.Data)
+	if err != nil {
+		return fmt.Errorf("sqlite storage error: unable to encode session data: %v", err)
+	}
+	if _, err = s.db.ExecContext(ctx, `DELETE FROM flow_sessions WHERE updated_at <= ?`, time.Now().Add(-flow.DefaultTTL)); err != nil {
+		return fmt.Errorf("sqlite storage error: unable to delete expired sessions: %v", err)
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT OR REPLACE INTO flow_sessions (id, flow, state, data, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		sess.ID, sess.Flow, sess.State, string(data), sess.CreatedAt, sess.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("sqlite storage error: unable to save session: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLite) DeleteSession(ctx context.Context, id string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM flow_sessions WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("sqlite storage error: unable to delete session: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package storage_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jecoz/voicebr/flow"
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestSQLite_broadcasts(t *testing.T) {
+	l, done := newLocal(t)
+	defer done()
+
+	s, err := storage.NewSQLite(filepath.Join(l.RootDir, "voicebr.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ctx := context.TODO()
+	for _, v := range []string{"39111", "39222"} {
+		if err = s.AddContact(ctx, nexmo.BroadcastList, nexmo.NewContact(v, "")); err != nil {
+			t.Fatalf("Unexpected add error: %v", err)
+		}
+	}
+	if err = s.AddToGroup(ctx, "staff", "39222"); err != nil {
+		t.Fatalf("Unexpected group error: %v", err)
+	}
+	members, err := s.GroupMembers(ctx, "staff")
+	if err != nil || len(members) != 1 || members[0].Number != "39222" {
+		t.Fatalf("Unexpected group members: %v, %v", members, err)
+	}
+
+	b, err := s.CreateBroadcast(ctx, nexmo.Broadcast{RecName: "a.mp3", CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("Unexpected broadcast error: %v", err)
+	}
+	attempts := []nexmo.CallAttempt{
+		{BroadcastID: b.ID, Number: "39111", Attempt: 1, Status: nexmo.AttemptFailed},
+		{BroadcastID: b.ID, Number: "39222", Attempt: 1, Status: nexmo.AttemptFailed},
+		{BroadcastID: b.ID, Number: "39222", Attempt: 2, Status: nexmo.AttemptCreated},
+	}
+	for _, v := range attempts {
+		if err = s.LogAttempt(ctx, v); err != nil {
+			t.Fatalf("Unexpected log error: %v", err)
+		}
+	}
+
+	unreached, err := s.Unreached(ctx, b.ID)
+	if err != nil {
+		t.Fatalf("Unexpected query error: %v", err)
+	}
+	if len(unreached) != 1 || unreached[0] != "39111" {
+		t.Fatalf("Unexpected unreached numbers: %v", unreached)
+	}
+}
+
+func TestSQLite_broadcastRecipients(t *testing.T) {
+	l, done := newLocal(t)
+	defer done()
+
+	s, err := storage.NewSQLite(filepath.Join(l.RootDir, "voicebr.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ctx := context.TODO()
+	contacts := []nexmo.Contact{nexmo.NewContact("39111", "foo"), nexmo.NewContact("39222", "bar")}
+	b, err := s.CreateBroadcast(ctx, nexmo.Broadcast{
+		RecName:    "a.mp3",
+		CreatedAt:  time.Now(),
+		Recipients: nexmo.Snapshot(contacts),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected broadcast error: %v", err)
+	}
+	if err = s.LogAttempt(ctx, nexmo.CallAttempt{BroadcastID: b.ID, Number: "39111", Attempt: 1, Status: nexmo.AttemptCreated}); err != nil {
+		t.Fatalf("Unexpected log error: %v", err)
+	}
+
+	stored, err := s.Broadcast(ctx, b.ID)
+	if err != nil {
+		t.Fatalf("Unexpected broadcast error: %v", err)
+	}
+	if len(stored.Recipients) != 2 || stored.Recipients[1].Name != "bar" {
+		t.Fatalf("Unexpected recipients: %+v", stored.Recipients)
+	}
+
+	attempts, err := s.Attempts(ctx, b.ID)
+	if err != nil {
+		t.Fatalf("Unexpected attempts error: %v", err)
+	}
+	report := nexmo.NewDeliveryReport(stored, attempts)
+	if report.Reached != 1 || report.Unreached != 1 {
+		t.Fatalf("Wanted the recipient never called to be unreached, found %+v", report)
+	}
+}
+
+func TestClaimRec(t *testing.T) {
+	l, done := newLocal(t)
+	defer done()
+
+	s, err := storage.NewSQLite(filepath.Join(l.RootDir, "voicebr.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ctx := context.TODO()
+	for _, c := range []nexmo.RecClaimer{l, s} {
+		for i, want := range []bool{true, false} {
+			ok, err := c.ClaimRec(ctx, "aaaa-bbbb")
+			if err != nil {
+				t.Fatalf("Unexpected claim error: %v", err)
+			}
+			if ok != want {
+				t.Fatalf("%T, claim %d: wanted %v, found %v", c, i, want, ok)
+			}
+		}
+		if ok, _ := c.ClaimRec(ctx, "cccc-dddd"); !ok {
+			t.Fatalf("%T: wanted a different recording to be claimed", c)
+		}
+	}
+
+	// The stale claims of a crashed server expire.
+	stale := time.Now().Add(-nexmo.RecClaimTTL - time.Minute)
+	if err := os.Chtimes(filepath.Join(l.RootDir, "claims", "aaaa-bbbb"), stale, stale); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := l.ClaimRec(ctx, "aaaa-bbbb"); !ok {
+		t.Fatalf("Wanted the stale local claim to expire")
+	}
+}
+
+func TestSQLite_sessions(t *testing.T) {
+	l, done := newLocal(t)
+	defer done()
+
+	s, err := storage.NewSQLite(filepath.Join(l.RootDir, "voicebr.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ctx := context.TODO()
+	now := time.Now()
+	sess := flow.Session{ID: "CON-1", Flow: "ivr", State: "menu", Data: map[string]string{"group": "staff"}, CreatedAt: now, UpdatedAt: now}
+	if err = s.SaveSession(ctx, sess); err != nil {
+		t.Fatalf("Unexpected save error: %v", err)
+	}
+	found, err := s.LoadSession(ctx, "CON-1")
+	if err != nil {
+		t.Fatalf("Unexpected load error: %v", err)
+	}
+	if found.State != "menu" || found.Get("group") != "staff" {
+		t.Fatalf("Wanted %+v, found %+v", sess, found)
+	}
+
+	sess.ID, sess.UpdatedAt = "CON-2", now.Add(-2*flow.DefaultTTL)
+	if err = s.SaveSession(ctx, sess); err != nil {
+		t.Fatalf("Unexpected save error: %v", err)
+	}
+	if _, err = s.LoadSession(ctx, "CON-2"); err != flow.ErrNotFound {
+		t.Fatalf("Wanted the expired session not to be found, found %v", err)
+	}
+	if err = s.DeleteSession(ctx, "CON-1"); err != nil {
+		t.Fatalf("Unexpected delete error: %v", err)
+	}
+	if _, err = s.LoadSession(ctx, "CON-1"); err != flow.ErrNotFound {
+		t.Fatalf("Wanted %v, found %v", flow.ErrNotFound, err)
+	}
+}
@@ -0,0 +1,49 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+//go:build tsnet
+// +build tsnet
+
+package voicebr
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+
+	"github.com/jecoz/voicebr/prefs"
+	"tailscale.com/tsnet"
+)
+
+// listenTailnet joins the tailnet as `p.Hostname`, returning a
+// listener reachable only from the tailnet and the closer of
+// the embedded node, which logs to `l`.
+func listenTailnet(p prefs.Tailnet, l *log.Logger) (net.Listener, io.Closer, error) {
+	s := &tsnet.Server{
+		Hostname: p.Hostname,
+		Dir:      p.StateDir,
+		AuthKey:  p.AuthKey,
+		Logf:     func(string, ...interface{}) {},
+		UserLogf: l.Printf,
+	}
+	ln, err := s.Listen("tcp", fmt.Sprintf(":%d", tailnetPort(p)))
+	if err != nil {
+		s.Close()
+		return nil, nil, fmt.Errorf("unable to join tailnet as %s: %v", p.Hostname, err)
+	}
+	return ln, s, nil
+}
@@ -0,0 +1,33 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+//go:build !tsnet
+// +build !tsnet
+
+package voicebr
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+
+	"github.com/jecoz/voicebr/prefs"
+)
+
+func listenTailnet(p prefs.Tailnet, l *log.Logger) (net.Listener, io.Closer, error) {
+	return nil, nil, errors.New("voicebr was built without tailnet support, rebuild it with -tags tsnet")
+}
@@ -0,0 +1,158 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package tunnel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// DefaultLocaltunnelServer is the public localtunnel server.
+const DefaultLocaltunnelServer = "https://localtunnel.me"
+
+// localtunnelRetry is the time waited before dialing again a
+// connection that could not be established.
+const localtunnelRetry = time.Second
+
+// localtunnel keeps the connections the localtunnel server
+// proxies the public requests through, piping each of them
+// to the local server.
+type localtunnel struct {
+	url    string
+	remote string
+	local  string
+	log    *log.Logger
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func openLocaltunnel(ctx context.Context, addr string, o Options) (*localtunnel, error) {
+	server := o.Server
+	if server == "" {
+		server = DefaultLocaltunnelServer
+	}
+	u, err := url.Parse(server)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("localtunnel: %q is not a valid server", server)
+	}
+	endpoint := server + "/?new"
+	if o.Subdomain != "" {
+		endpoint = server + "/" + url.PathEscape(o.Subdomain)
+	}
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("localtunnel: %v", err)
+	}
+	resp, err := o.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("localtunnel: %v", err)
+	}
+	defer resp.Body.Close()
+	var info struct {
+		ID           string `json:"id"`
+		Port         int    `json:"port"`
+		MaxConnCount int    `json:"max_conn_count"`
+		URL          string `json:"url"`
+		Message      string `json:"message"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("localtunnel: unable to decode response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || info.URL == "" || info.Port == 0 {
+		return nil, fmt.Errorf("localtunnel: %s: %s", resp.Status, info.Message)
+	}
+	if info.MaxConnCount <= 0 {
+		info.MaxConnCount = 1
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	t := &localtunnel{
+		url:    info.URL,
+		remote: net.JoinHostPort(u.Hostname(), fmt.Sprint(info.Port)),
+		local:  addr,
+		log:    o.logger(),
+		cancel: cancel,
+	}
+	for i := 0; i < info.MaxConnCount; i++ {
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			t.serve(runCtx)
+		}()
+	}
+	return t, nil
+}
+
+func (t *localtunnel) URL() string { return t.url }
+
+func (t *localtunnel) Close() error {
+	t.cancel()
+	t.wg.Wait()
+	return nil
+}
+
+// serve pipes a connection to the server at a time to the
+// local server, until `ctx` is done.
+func (t *localtunnel) serve(ctx context.Context) {
+	var d net.Dialer
+	for ctx.Err() == nil {
+		if err := t.pipe(ctx, &d); err != nil && ctx.Err() == nil {
+			t.log.Printf("localtunnel: %v", err)
+			select {
+			case <-time.After(localtunnelRetry):
+			case <-ctx.Done():
+			}
+		}
+	}
+}
+
+func (t *localtunnel) pipe(ctx context.Context, d *net.Dialer) error {
+	remote, err := d.DialContext(ctx, "tcp", t.remote)
+	if err != nil {
+		return err
+	}
+	defer remote.Close()
+	local, err := d.DialContext(ctx, "tcp", t.local)
+	if err != nil {
+		return err
+	}
+	defer local.Close()
+
+	// Either side closing ends the exchange.
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultNgrokAPI is the address of the API of the ngrok agent.
+const DefaultNgrokAPI = "http://127.0.0.1:4040"
+
+// ngrok is a tunnel opened by the ngrok agent.
+type ngrok struct {
+	url    string
+	api    string
+	name   string
+	client *http.Client
+}
+
+func openNgrok(ctx context.Context, addr string, o Options) (*ngrok, error) {
+	api := strings.TrimSuffix(o.Server, "/")
+	if api == "" {
+		api = DefaultNgrokAPI
+	}
+	name := "voicebr-" + strings.NewReplacer(":", "-", ".", "-").Replace(addr)
+	body, err := json.Marshal(map[string]interface{}{
+		"name":    name,
+		"proto":   "http",
+		"addr":    addr,
+		"schemes": []string{"https"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ngrok: %v", err)
+	}
+	req, err := http.NewRequest("POST", api+"/api/tunnels", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("ngrok: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := o.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("ngrok: is the agent running? %v", err)
+	}
+	defer resp.Body.Close()
+	var info struct {
+		PublicURL string `json:"public_url"`
+		Msg       string `json:"msg"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("ngrok: unable to decode response: %v", err)
+	}
+	if resp.StatusCode != http.StatusCreated || info.PublicURL == "" {
+		return nil, fmt.Errorf("ngrok: %s: %s", resp.Status, info.Msg)
+	}
+	return &ngrok{url: info.PublicURL, api: api, name: name, client: o.client()}, nil
+}
+
+func (t *ngrok) URL() string { return t.url }
+
+func (t *ngrok) Close() error {
+	req, err := http.NewRequest("DELETE", t.api+"/api/tunnels/"+t.name, nil)
+	if err != nil {
+		return fmt.Errorf("ngrok: %v", err)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("ngrok: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ngrok: unable to close tunnel: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package tunnel exposes the local server to the internet through
+// a public tunnel, so that nexmo can reach the webhooks of a
+// development machine and real calls can be tested with a single
+// command.
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Providers of the tunnels.
+const (
+	// Localtunnel speaks the localtunnel protocol with
+	// a public server, https://localtunnel.me by default.
+	Localtunnel = "localtunnel"
+	// Ngrok asks a running ngrok agent to open the tunnel
+	// through its local API.
+	Ngrok = "ngrok"
+)
+
+// Tunnel is a public tunnel to a local address.
+type Tunnel interface {
+	// URL is the public origin of the tunnel, e.g.
+	// "https://abc.loca.lt".
+	URL() string
+	// Close tears the tunnel down.
+	Close() error
+}
+
+// Options configures Open. Each field may be left empty.
+type Options struct {
+	// Server is the address of the localtunnel server, or of
+	// the API of the ngrok agent, the default of the provider
+	// if empty.
+	Server string
+	// Subdomain is the subdomain requested to the localtunnel
+	// server, a random one if empty.
+	Subdomain string
+	// Client performs the requests to the provider,
+	// http.DefaultClient if nil.
+	Client *http.Client
+	// Log receives the logs of the tunnel, the standard
+	// logger if nil.
+	Log *log.Logger
+}
+
+func (o Options) client() *http.Client {
+	if o.Client == nil {
+		return http.DefaultClient
+	}
+	return o.Client
+}
+
+func (o Options) logger() *log.Logger {
+	if o.Log == nil {
+		return log.Default()
+	}
+	return o.Log
+}
+
+// openTimeout bounds the requests opening the tunnels.
+const openTimeout = 30 * time.Second
+
+// Open opens a tunnel, through `provider`, to the server listening
+// at the "host:port" address `addr`.
+func Open(ctx context.Context, provider, addr string, o Options) (Tunnel, error) {
+	ctx, cancel := context.WithTimeout(ctx, openTimeout)
+	defer cancel()
+	switch provider {
+	case Localtunnel:
+		return openLocaltunnel(ctx, addr, o)
+	case Ngrok:
+		return openNgrok(ctx, addr, o)
+	default:
+		return nil, fmt.Errorf("tunnel: unknown provider %q, use %q or %q", provider, Localtunnel, Ngrok)
+	}
+}
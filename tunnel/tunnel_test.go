@@ -0,0 +1,114 @@
+package tunnel_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jecoz/voicebr/tunnel"
+)
+
+func TestOpen_localtunnel(t *testing.T) {
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "hello from %s", r.URL.Path)
+	}))
+	defer local.Close()
+
+	// The server hands the connections of the tunnel out
+	// at `ln`.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["new"]; !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":             "abc",
+			"port":           ln.Addr().(*net.TCPAddr).Port,
+			"max_conn_count": 2,
+			"url":            "https://abc.loca.lt",
+		})
+	}))
+	defer server.Close()
+
+	tun, err := tunnel.Open(context.Background(), tunnel.Localtunnel, strings.TrimPrefix(local.URL, "http://"), tunnel.Options{
+		Server: server.URL,
+		Log:    log.New(ioutil.Discard, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected open error: %v", err)
+	}
+	defer tun.Close()
+	if tun.URL() != "https://abc.loca.lt" {
+		t.Fatalf("Wanted https://abc.loca.lt, found %s", tun.URL())
+	}
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET /record/voice/answer HTTP/1.1\r\nHost: abc.loca.lt\r\nConnection: close\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Unexpected response error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "hello from /record/voice/answer" {
+		t.Fatalf("Wanted the request to reach the local server, found %q", body)
+	}
+}
+
+func TestOpen_ngrok(t *testing.T) {
+	var closed bool
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api/tunnels":
+			var req struct {
+				Name  string `json:"name"`
+				Proto string `json:"proto"`
+				Addr  string `json:"addr"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Proto != "http" || req.Addr != "127.0.0.1:4001" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]string{"name": req.Name, "public_url": "https://abc.ngrok.app"})
+		case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/api/tunnels/voicebr-"):
+			closed = true
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer api.Close()
+
+	tun, err := tunnel.Open(context.Background(), tunnel.Ngrok, "127.0.0.1:4001", tunnel.Options{Server: api.URL})
+	if err != nil {
+		t.Fatalf("Unexpected open error: %v", err)
+	}
+	if tun.URL() != "https://abc.ngrok.app" {
+		t.Fatalf("Wanted https://abc.ngrok.app, found %s", tun.URL())
+	}
+	if err = tun.Close(); err != nil || !closed {
+		t.Fatalf("Wanted the tunnel to be closed, found %v", err)
+	}
+
+	if _, err = tunnel.Open(context.Background(), "frp", "127.0.0.1:4001", tunnel.Options{}); err == nil {
+		t.Fatalf("Wanted an unknown provider to be refused")
+	}
+}
@@ -0,0 +1,435 @@
+/// Broadcast voice messages to a set of recipients.
+/// Copyright (C) 2019 Daniel Morandini (jecoz)
+///
+/// This program is free software: you can redistribute it and/or modify
+/// it under the terms of the GNU General Public License as published by
+/// the Free Software Foundation, either version 3 of the License, or
+/// (at your option) any later version.
+///
+/// This program is distributed in the hope that it will be useful,
+/// but WITHOUT ANY WARRANTY; without even the implied warranty of
+/// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+/// GNU General Public License for more details.
+///
+/// You should have received a copy of the GNU General Public License
+/// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package voicebr runs the broadcast server, so that it can be
+// embedded in other programs. The voicebr command, in
+// cmd/voicebr, is one of them.
+package voicebr
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jecoz/voicebr/flow"
+	"github.com/jecoz/voicebr/nexmo"
+	"github.com/jecoz/voicebr/prefs"
+	"github.com/jecoz/voicebr/rpc"
+	"github.com/jecoz/voicebr/storage"
+	"go.opentelemetry.io/otel"
+	"google.golang.org/grpc"
+)
+
+// ShutdownTimeout is how long Run waits for the requests in
+// progress once its context is done.
+const ShutdownTimeout = 10 * time.Second
+
+// Server serves the nexmo webhooks and the admin routes.
+type Server struct {
+	prefs     *prefs.MasterPrefs
+	storage   nexmo.Storage
+	client    *nexmo.Client
+	log       *log.Logger
+	listener  net.Listener
+	console   bool
+	dashboard bool
+	// closers are closed once Run returns.
+	closers []io.Closer
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithPrefs configures the server with `p`, prefs.Default()
+// otherwise.
+func WithPrefs(p *prefs.MasterPrefs) Option {
+	return func(s *Server) { s.prefs = p }
+}
+
+// WithStorage stores the recordings and the contacts in `st`,
+// instead of the storage configured by the preferences.
+func WithStorage(st nexmo.Storage) Option {
+	return func(s *Server) { s.storage = st }
+}
+
+// WithProvider places the calls through `c`, instead of the
+// client configured by the preferences, whose Vonage credentials
+// are then not required.
+func WithProvider(c *nexmo.Client) Option {
+	return func(s *Server) { s.client = c }
+}
+
+// WithLogger logs to `l`, instead of the standard logger. The
+// client and the storage created by New log to `l` too, as does
+// the client passed to WithProvider if it has no logger.
+func WithLogger(l *log.Logger) Option {
+	return func(s *Server) { s.log = l }
+}
+
+// WithListener serves the webhooks on `ln`, instead of listening
+// on the host and port of the preferences. It is closed once Run
+// returns.
+func WithListener(ln net.Listener) Option {
+	return func(s *Server) { s.listener = ln }
+}
+
+// WithConsole enables the webhook test console.
+func WithConsole() Option {
+	return func(s *Server) { s.console = true }
+}
+
+// WithDashboard enables the web dashboard.
+func WithDashboard() Option {
+	return func(s *Server) { s.dashboard = true }
+}
+
+// New returns a server configured by `opts`. The preferences
+// are validated, and the storage and the client not passed as
+// options are created from them.
+func New(opts ...Option) (*Server, error) {
+	s := &Server{}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.prefs == nil {
+		s.prefs = prefs.Default()
+	}
+	if s.log == nil {
+		s.log = log.Default()
+	}
+	if err := validatePrefs(s.prefs, s.client != nil); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if s.client == nil {
+		if s.client, err = NewClient(s.prefs, s.log); err != nil {
+			return nil, err
+		}
+		if c, ok := s.client.Audit.(io.Closer); ok {
+			s.closers = append(s.closers, c)
+		}
+	}
+	if s.storage == nil {
+		if s.storage, err = NewStorage(s.prefs.Storage, s.log); err != nil {
+			s.close()
+			return nil, err
+		}
+	}
+	s.configureClient()
+	return s, nil
+}
+
+// configureClient sets up the recordings cache and the notifiers
+// of the client, as the preferences say.
+func (s *Server) configureClient() {
+	p, client := s.prefs, s.client
+	if client.Log == nil {
+		client.Log = s.log
+	}
+	if p.Recording.CacheSize > 0 {
+		client.Cache = nexmo.NewRecCache(p.Recording.CacheSize)
+		client.Cache.Log = client.Log
+	}
+	if e := p.Notifications.Email; e.Host != "" {
+		client.Notifiers = append(client.Notifiers, newEmailNotifier(e, s.storage, s.log))
+	}
+	if h := p.Notifications.Webhook; h.URL != "" {
+		client.Notifiers = append(client.Notifiers, &nexmo.WebhookNotifier{URL: h.URL, Slack: h.Slack})
+	}
+}
+
+// Client returns the client placing the calls.
+func (s *Server) Client() *nexmo.Client { return s.client }
+
+// Storage returns the storage of the recordings and of the
+// contacts.
+func (s *Server) Storage() nexmo.Storage { return s.storage }
+
+func (s *Server) close() {
+	for _, v := range s.closers {
+		v.Close()
+	}
+	s.closers = nil
+}
+
+// authenticator returns the authenticator of the admin routes
+// and of the control API, together with the OpenID Connect
+// provider among its ones, if any.
+func (s *Server) authenticator() (nexmo.Authenticator, *nexmo.OIDC, error) {
+	p := s.prefs
+	oidc, err := newOIDC(p.Admin.OIDC, adminOrigin(p.Server))
+	if err != nil {
+		return nil, nil, err
+	}
+	if oidc != nil {
+		oidc.Log = s.log
+	}
+	return newAuthenticator(p.Admin, s.storage, oidc, s.log), oidc, nil
+}
+
+// router returns the handler of both the webhooks and the
+// admin routes, configuring the client as the preferences say.
+// The background workers run until `ctx` is done.
+func (s *Server) router(ctx context.Context, auth nexmo.Authenticator, oidc *nexmo.OIDC) (http.Handler, error) {
+	p, client, st := s.prefs, s.client, s.storage
+	record, err := recordOptions(p.Recording)
+	if err != nil {
+		return nil, err
+	}
+	if book := client.Prompts; book != nil && book.Speech != nil {
+		go func() {
+			if err := book.Speech.Presynthesize(ctx, book); err != nil {
+				s.log.Printf("unable to synthesize the prompts: %v", err)
+			}
+		}()
+	}
+	var watcher *nexmo.RecordingWatcher
+	if via := p.Broadcaster.NotifyVia; via != "" {
+		text := p.Broadcaster.FailureText
+		watcher = nexmo.NewRecordingWatcher(time.Duration(p.Broadcaster.RecordTimeout), func(caller nexmo.Contact) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			if err := client.Notify(ctx, via, caller, text); err != nil {
+				s.log.Printf("unable to notify %s: %v", caller.Number, err)
+			}
+		})
+		watcher.Log = s.log
+	}
+	transcripts, err := newTranscriptWorker(ctx, p.Transcription, st, s.log)
+	if err != nil {
+		return nil, err
+	}
+	origins, err := newOriginResolver(p.Server)
+	if err != nil {
+		return nil, err
+	}
+	allowlist, err := newIPAllowlist(ctx, p.Server.Allowlist, s.log)
+	if err != nil {
+		return nil, err
+	}
+	var events nexmo.EventSink
+	if p.Events.Path != "" {
+		f, err := storage.OpenEventFile(p.Events.Path)
+		if err != nil {
+			return nil, err
+		}
+		s.closers = append(s.closers, f)
+		events = f
+	}
+	var audioSources *nexmo.AudioSources
+	if p.Broadcaster.AudioSources {
+		audioSources = nexmo.NewAudioSources()
+		audioSources.Log = s.log
+	}
+	// The call flows survive restarts in the sqlite
+	// database, if any.
+	var sessions flow.Store
+	if c, ok := st.(storage.Combined); ok {
+		sessions, _ = c.ContactsStore.(flow.Store)
+	}
+	tp, err := newTracerProvider(ctx, p.Tracing)
+	if err != nil {
+		return nil, err
+	}
+	if tp != nil {
+		s.closers = append(s.closers, tracerCloser{tp})
+		otel.SetTracerProvider(tp)
+	}
+	replay := newReplayGuard(p, s.log)
+	state, err := newSharedState(ctx, p.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	if state != nil {
+		// The replicas respect the limits of nexmo together,
+		// until Run returns and the state is closed.
+		nexmo.CallLimiter.Share(state.Bucket("voicebr:limit:calls", nexmo.CallLimiter.Rate()))
+		nexmo.GetLimiter.Share(state.Bucket("voicebr:limit:get", nexmo.GetLimiter.Rate()))
+		s.closers = append(s.closers, sharedLimiters{nexmo.CallLimiter, nexmo.GetLimiter}, state)
+		client.Dispatcher = nexmo.NewDispatcher(state, p.Cluster.InstanceID)
+		client.Dispatcher.LeaseTTL = time.Duration(p.Cluster.LeaseTTL)
+		go func() {
+			if err := client.RunDispatcher(ctx, st); err != nil {
+				s.log.Printf("dispatcher: %v", err)
+			}
+		}()
+		if replay != nil {
+			replay.State = state
+		}
+	}
+	transcoder, audio := newTranscoder(p.Recording)
+	return nexmo.NewRouter(client, st, p.Server.Origin, nexmo.RouterOptions{
+		Watcher:        watcher,
+		Funnel:         nexmo.NewFunnel(),
+		RecFormat:      p.Recording.Format,
+		Prompts:        client.Prompts,
+		Console:        s.console,
+		Dashboard:      s.dashboard,
+		Auth:           auth,
+		OIDC:           oidc,
+		Record:         record,
+		TrimSilence:    p.Recording.TrimSilence,
+		Transcoder:     transcoder,
+		Audio:          audio,
+		Loudness:       newLoudnessNormalizer(p.Recording),
+		DownloadWindow: time.Duration(p.Recording.DownloadWindow),
+		MaxRecSize:     p.Recording.MaxSize,
+		Hosted:         p.Recording.Hosted,
+		HostedTTL:      time.Duration(p.Recording.HostedTTL),
+		Transcripts:    transcripts,
+		Duplicates:     newDuplicateGuard(p.Duplicates),
+		Conference:     p.Broadcaster.Conference,
+		Passthrough:    p.Broadcaster.Passthrough,
+		Templates:      p.Broadcaster.Templates,
+		IVR:            p.Broadcaster.IVR,
+		IVRGroups:      p.Broadcaster.IVRGroups,
+		Sessions:       sessions,
+		AudioSources:   audioSources,
+		OptOut:         p.Delivery.OptOut,
+		Replays:        p.Delivery.Replays,
+		Loop:           p.Delivery.Loop,
+		Replay:         replay,
+		Origins:        origins,
+		Allowlist:      allowlist,
+		Events:         events,
+		Log:            s.log,
+	}), nil
+}
+
+// Run serves until `ctx` is done, or until one of the listeners
+// fails. The admin routes are served on their own address, or
+// tailnet node, when configured, and together with the webhooks
+// otherwise. The resources opened by New are closed on return.
+func (s *Server) Run(ctx context.Context) error {
+	defer s.close()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	auth, oidc, err := s.authenticator()
+	if err != nil {
+		return err
+	}
+	r, err := s.router(ctx, auth, oidc)
+	if err != nil {
+		return err
+	}
+
+	p := s.prefs
+	var servers []*http.Server
+	errc := make(chan error, 4)
+	serve := func(h http.Handler, ln net.Listener) {
+		srv := &http.Server{Handler: h, ErrorLog: s.log}
+		servers = append(servers, srv)
+		go func() { errc <- srv.Serve(ln) }()
+	}
+
+	public := http.Handler(r)
+	if a := p.Server.AdminAddr; a != "" {
+		ln, err := net.Listen("tcp", a)
+		if err != nil {
+			return err
+		}
+		serve(r, ln)
+		s.log.Printf("admin routes served only at %s", a)
+		public = nexmo.WebhooksOnly(r)
+	}
+	if t := p.Server.Tailnet; t.Hostname != "" {
+		ln, node, err := listenTailnet(t, s.log)
+		if err != nil {
+			s.shutdown(servers)
+			return err
+		}
+		defer node.Close()
+		serve(r, ln)
+		s.log.Printf("admin routes served only at %s", tailnetOrigin(t))
+		public = nexmo.WebhooksOnly(r)
+	}
+
+	ln := s.listener
+	if ln == nil {
+		addr := net.JoinHostPort(p.Server.Host, strconv.Itoa(p.Server.Port))
+		if ln, err = net.Listen("tcp", addr); err != nil {
+			s.shutdown(servers)
+			return err
+		}
+	}
+	serve(public, ln)
+	s.log.Printf("listening on %s", ln.Addr())
+
+	if a := p.Server.GRPCAddr; a != "" {
+		ln, err := net.Listen("tcp", a)
+		if err != nil {
+			s.shutdown(servers)
+			return err
+		}
+		transcoder, audio := newTranscoder(p.Recording)
+		g := rpc.NewServer(&rpc.Control{
+			Client:     s.client,
+			Storage:    s.storage,
+			MaxRecSize: p.Recording.MaxSize,
+			Transcoder: transcoder,
+			Audio:      audio,
+			Loudness:   newLoudnessNormalizer(p.Recording),
+			Log:        s.log,
+		}, auth)
+		defer s.stopGRPC(g)
+		go func() { errc <- g.Serve(ln) }()
+		s.log.Printf("control API served at %s", ln.Addr())
+	}
+
+	select {
+	case <-ctx.Done():
+	case err = <-errc:
+	}
+	s.shutdown(servers)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// stopGRPC stops `g`, waiting at most ShutdownTimeout for the
+// calls in progress.
+func (s *Server) stopGRPC(g *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		g.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(ShutdownTimeout):
+		g.Stop()
+	}
+}
+
+// shutdown stops `servers`, waiting at most ShutdownTimeout for
+// the requests in progress.
+func (s *Server) shutdown(servers []*http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	for _, v := range servers {
+		if err := v.Shutdown(ctx); err != nil {
+			s.log.Printf("shutdown error: %v", err)
+		}
+	}
+}
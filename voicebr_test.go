@@ -0,0 +1,83 @@
+package voicebr_test
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jecoz/voicebr"
+	"github.com/jecoz/voicebr/nexmo/nexmotest"
+	"github.com/jecoz/voicebr/prefs"
+	"github.com/jecoz/voicebr/storage"
+)
+
+func TestServer(t *testing.T) {
+	srv, err := nexmotest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	c, err := srv.NewClient("app", "393339999999", "https://voicebr.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+
+	// The credentials are not required with a provider.
+	p := prefs.Default()
+	p.Server.Origin = "https://voicebr.example.com"
+	var logs bytes.Buffer
+	s, err := voicebr.New(
+		voicebr.WithPrefs(p),
+		voicebr.WithProvider(c),
+		voicebr.WithListener(ln),
+		voicebr.WithStorage(&storage.Local{RootDir: t.TempDir()}),
+		voicebr.WithLogger(log.New(&logs, "", 0)),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected new error: %v", err)
+	}
+	if s.Client() != c {
+		t.Fatalf("Wanted the client passed as provider to be used")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	// The listener is bound already, the request waits for Run.
+	resp, err := http.Get("http://" + addr + "/admin/recordings")
+	if err != nil {
+		t.Fatalf("Unexpected get error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Wanted %d, found %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	cancel()
+	if err = <-done; err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+	for _, v := range []string{"listening on " + addr, "[GET] /admin/recordings"} {
+		if !strings.Contains(logs.String(), v) {
+			t.Fatalf("Wanted %q to be logged, found %q", v, logs.String())
+		}
+	}
+}
+
+func TestNew_invalidPrefs(t *testing.T) {
+	p := prefs.Default()
+	p.Delivery.Voicemail = "ignore"
+	if _, err := voicebr.New(voicebr.WithPrefs(p)); err == nil {
+		t.Fatalf("Wanted the preferences to be refused")
+	}
+}